@@ -37,6 +37,7 @@ const (
 	SummaryJobIdKey                    = "SummaryJobIdKey"
 	OperationStartTimeKeyPostfix       = FullGroupName + "/started-at"        // instance/target
 	DeleteOperationStartTimeKeyPostfix = FullGroupName + "/delete-started-at" // instance/target
+	SyncedGenerationKey                = FullGroupName + "/synced-generation" // catalogversion
 
 	ProviderName = "management.azure.com/provider-name"
 )
@@ -66,6 +67,7 @@ func SystemReservedAnnotations() []string {
 		RunningAzureCorrelationIdKey,
 		SummaryJobIdKey,
 		GuidKey,
+		SyncedGenerationKey,
 	}
 }
 
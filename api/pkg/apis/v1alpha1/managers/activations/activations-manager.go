@@ -314,7 +314,9 @@ func (t *ActivationsManager) ReportStageStatus(ctx context.Context, name string,
 		activationState.ObjectMeta.Labels = make(map[string]string)
 	}
 	// label doesn't allow space, so remove space
-	activationState.ObjectMeta.Labels[constants.StatusMessage] = utils.ConvertStringToValidLabel(current.Status.String())
+	if current.CompensatedStage == "" {
+		activationState.ObjectMeta.Labels[constants.StatusMessage] = utils.ConvertStringToValidLabel(current.Status.String())
+	}
 
 	var entry states.StateEntry
 	entry.ID = activationState.ObjectMeta.Name
@@ -369,7 +371,7 @@ func mergeStageStatus(ctx context.Context, activationState *model.ActivationStat
 
 		if len(activationState.Status.StageHistory) == 0 {
 			activationState.Status.StageHistory = append(activationState.Status.StageHistory, current)
-		} else if activationState.Status.StageHistory[len(activationState.Status.StageHistory)-1].Stage != current.Stage {
+		} else if last := activationState.Status.StageHistory[len(activationState.Status.StageHistory)-1]; last.Stage != current.Stage || last.CompensatedStage != current.CompensatedStage {
 			if len(activationState.Status.StageHistory)+1 > activationHistorySize {
 				oldestStage := activationState.Status.StageHistory[0].Stage
 				activationState.Status.StageHistory = activationState.Status.StageHistory[1:]
@@ -428,6 +430,10 @@ func mergeStageStatus(ctx context.Context, activationState *model.ActivationStat
 	}
 
 	latestStage := &activationState.Status.StageHistory[len(activationState.Status.StageHistory)-1]
+	if latestStage.CompensatedStage != "" {
+		// Compensation runs after the activation has failed, keep the failed status
+		return nil
+	}
 	if latestStage.NextStage != "" {
 		activationState.Status.Status = v1alpha2.Running
 	} else {
@@ -109,6 +109,35 @@ func TestUpdateStageStatus(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestUpdateStageStatusWithCompensation(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	manager := ActivationsManager{
+		StateProvider: stateProvider,
+	}
+	err := manager.UpsertState(context.Background(), "test", model.ActivationState{Spec: &model.ActivationSpec{}})
+	assert.Nil(t, err)
+	for _, status := range []model.StageStatus{
+		{Stage: "a", NextStage: "b", Status: v1alpha2.Done},
+		{Stage: "b", Status: v1alpha2.InternalError},
+		{Stage: "undo", CompensatedStage: "b", Status: v1alpha2.Done},
+		{Stage: "undo", CompensatedStage: "a", Status: v1alpha2.Done},
+	} {
+		err = manager.ReportStageStatus(context.Background(), "test", "default", status)
+		assert.Nil(t, err)
+	}
+	state, err := manager.GetState(context.Background(), "test", "default")
+	assert.Nil(t, err)
+	// compensations sharing a stage are recorded separately
+	assert.Equal(t, 4, len(state.Status.StageHistory))
+	assert.Equal(t, "b", state.Status.StageHistory[2].CompensatedStage)
+	assert.Equal(t, "a", state.Status.StageHistory[3].CompensatedStage)
+	// the activation keeps the failed status
+	assert.Equal(t, v1alpha2.InternalError, state.Status.Status)
+	err = manager.DeleteState(context.Background(), "test", "default")
+	assert.Nil(t, err)
+}
+
 func TestUpdateStageStatusRemote(t *testing.T) {
 	stateProvider := &memorystate.MemoryStateProvider{}
 	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
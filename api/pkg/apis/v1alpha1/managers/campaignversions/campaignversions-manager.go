@@ -10,9 +10,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/eclipse-symphony/symphony/api/constants"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	sp "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers"
+	mockstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/mock"
+	api_utils "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
@@ -21,11 +26,16 @@ import (
 	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
 )
 
 var log = logger.NewLogger("coa.runtime")
 
+// defaultSimulationMaxSteps caps the number of stages a simulation runs, so
+// campaigns that loop forever still produce a result
+const defaultSimulationMaxSteps = 100
+
 type CampaignVersionsManager struct {
 	managers.Manager
 	StateProvider     states.IStateProvider
@@ -237,3 +247,265 @@ func (t *CampaignVersionsManager) CampaignVersionActivationsLookup(ctx context.C
 	}
 	return len(activationList) > 0, nil
 }
+
+// ValidateCampaignVersion statically analyzes the stage graph of a campaign version. If requested,
+// and the campaign version has no errors, it also simulates the campaign version with mock stage providers.
+func (m *CampaignVersionsManager) ValidateCampaignVersion(ctx context.Context, request model.CampaignValidationRequest) model.CampaignValidationResult {
+	ctx, span := observability.StartSpan("CampaignVersions Manager", ctx, &map[string]string{
+		"method": "ValidateCampaignVersion",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	state := request.CampaignVersion
+	if state.Spec == nil {
+		state.Spec = &model.CampaignVersionSpec{}
+	}
+	log.InfofCtx(ctx, "Validate campaignversion %s in namespace %s, simulate: %t", state.ObjectMeta.Name, state.ObjectMeta.Namespace, request.Simulate)
+
+	result := model.CampaignValidationResult{
+		Issues: m.CampaignVersionValidator.ValidateStageGraph(state, sp.IsStageProviderType),
+	}
+	result.Valid = !result.HasErrors()
+	if request.Simulate && result.Valid {
+		simulation := m.simulateCampaignVersion(ctx, state, request)
+		result.Simulation = &simulation
+	}
+	return result
+}
+
+// simulateCampaignVersion walks the campaign version from its first stage the same way the stage manager
+// does, but processes every stage with the mock stage provider. Stub outputs supplied for a stage
+// override the mock outputs, which allows exercising the stageSelector expressions.
+func (m *CampaignVersionsManager) simulateCampaignVersion(ctx context.Context, state model.CampaignVersionState, request model.CampaignValidationRequest) model.CampaignSimulationResult {
+	ret := model.CampaignSimulationResult{
+		StageHistory: make([]model.StageStatus, 0),
+	}
+	maxSteps := request.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultSimulationMaxSteps
+	}
+	namespace := state.ObjectMeta.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	triggers := request.Inputs
+	if triggers == nil {
+		triggers = make(map[string]interface{})
+	}
+	mgrContext := contexts.ManagerContext{}
+	if m.Context != nil {
+		mgrContext = *m.Context
+	}
+
+	outputs := make(map[string]map[string]interface{})
+	previous := ""
+	current := state.Spec.FirstStage
+	for step := 0; current != ""; step++ {
+		if step >= maxSteps {
+			ret.Message = fmt.Sprintf("simulation stopped after %d steps", maxSteps)
+			return ret
+		}
+		stage := state.Spec.Stages[current]
+		status := model.StageStatus{
+			Stage:   current,
+			Outputs: make(map[string]interface{}),
+		}
+
+		inputs := map[string]interface{}{
+			"__campaignversion": state.ObjectMeta.Name,
+			"__namespace":       namespace,
+			"__activation":      "simulation",
+			"__stage":           current,
+			"__previousStage":   previous,
+			"__target":          stage.Target,
+		}
+		for k, v := range stage.Inputs {
+			inputs[k] = v
+		}
+		for k, v := range inputs {
+			val, err := m.evaluateValue(ctx, v, namespace, inputs, triggers, outputs)
+			if err != nil {
+				m.setSimulatedStageStatus(&status, "", v1alpha2.InternalError, fmt.Sprintf("failed to evaluate input %s: %s", k, err.Error()))
+				ret.StageHistory = append(ret.StageHistory, status)
+				ret.Message = fmt.Sprintf("stage %s failed", current)
+				return ret
+			}
+			inputs[k] = val
+		}
+		status.Inputs = api_utils.DeepCopyCollectionWithPrefixExclude(inputs, "__")
+
+		provider := &mockstage.MockStageProvider{}
+		stageOutputs, _, err := provider.Process(ctx, mgrContext, inputs)
+		if err != nil {
+			stageOutputs = map[string]interface{}{
+				"status": v1alpha2.InternalError,
+				"error":  err.Error(),
+			}
+		}
+		for k, v := range request.StubOutputs[current] {
+			stageOutputs[k] = v
+		}
+		if _, ok := stageOutputs["status"]; !ok {
+			stageOutputs["status"] = v1alpha2.OK
+		}
+		outputs[current] = stageOutputs
+		for k, v := range stageOutputs {
+			if !strings.HasPrefix(k, "__") {
+				status.Outputs[k] = v
+			}
+		}
+		hasStageError := !isSimulatedStatusOK(stageOutputs["status"])
+
+		if !state.Spec.SelfDriving {
+			if hasStageError {
+				m.setSimulatedStageStatus(&status, "", v1alpha2.InternalError, fmt.Sprintf("stage %s failed", current))
+			} else {
+				m.setSimulatedStageStatus(&status, "", v1alpha2.Done, "")
+			}
+			ret.StageHistory = append(ret.StageHistory, status)
+			ret.Completed = !hasStageError
+			ret.Message = "campaign version is not self-driving, simulation stops after the first stage"
+			return ret
+		}
+
+		eCtx := m.newEvaluationContext(ctx, namespace)
+		eCtx.Triggers = triggers
+		eCtx.Inputs = inputs
+		if v, ok := inputs["context"]; ok {
+			eCtx.Value = v
+		}
+		eCtx.Outputs = outputs
+		val, err := api_utils.NewParser(stage.StageSelector).Eval(*eCtx)
+		if err != nil {
+			m.setSimulatedStageStatus(&status, "", v1alpha2.InternalError, fmt.Sprintf("failed to evaluate stage selector: %s", err.Error()))
+			ret.StageHistory = append(ret.StageHistory, status)
+			ret.Message = fmt.Sprintf("stage %s failed", current)
+			return ret
+		}
+		next := ""
+		if val != nil {
+			next = api_utils.FormatAsString(val)
+		}
+		if next != "" {
+			nextStage, ok := state.Spec.Stages[next]
+			if !ok {
+				m.setSimulatedStageStatus(&status, "", v1alpha2.BadRequest, fmt.Sprintf("stage %s is not found", next))
+				ret.StageHistory = append(ret.StageHistory, status)
+				ret.Message = fmt.Sprintf("stage %s selected a stage that does not exist", current)
+				return ret
+			}
+			if hasStageError && !nextStage.HandleErrors {
+				next = ""
+			}
+		}
+		if hasStageError && next == "" {
+			m.setSimulatedStageStatus(&status, "", v1alpha2.InternalError, fmt.Sprintf("stage %s failed", current))
+			ret.StageHistory = append(ret.StageHistory, status)
+			ret.Message = fmt.Sprintf("stage %s failed", current)
+			return ret
+		}
+		m.setSimulatedStageStatus(&status, next, v1alpha2.Done, "")
+		ret.StageHistory = append(ret.StageHistory, status)
+		previous = current
+		current = next
+	}
+	ret.Completed = true
+	return ret
+}
+
+func (m *CampaignVersionsManager) setSimulatedStageStatus(status *model.StageStatus, nextStage string, state v1alpha2.State, errMsg string) {
+	status.NextStage = nextStage
+	status.Status = state
+	status.StatusMessage = state.String()
+	status.IsActive = false
+	status.ErrorMessage = errMsg
+}
+
+// newEvaluationContext creates the evaluation context of a simulation. $config() and $secret()
+// are answered by stub providers, so a simulation never reads real configs or secrets and the
+// simulated stage history doesn't echo them.
+func (m *CampaignVersionsManager) newEvaluationContext(ctx context.Context, namespace string) *coa_utils.EvaluationContext {
+	var eCtx *coa_utils.EvaluationContext
+	if m.VendorContext != nil {
+		eCtx = m.VendorContext.EvaluationContext.Clone()
+	}
+	if eCtx == nil {
+		eCtx = &coa_utils.EvaluationContext{}
+	}
+	eCtx.Context = ctx
+	eCtx.Namespace = namespace
+	eCtx.ConfigProvider = simulationConfigProvider{}
+	eCtx.SecretProvider = simulationSecretProvider{}
+	return eCtx
+}
+
+// simulationConfigProvider returns a placeholder for every config field
+type simulationConfigProvider struct{}
+
+func (simulationConfigProvider) Get(ctx context.Context, object string, field string, overrides []string, localContext interface{}) (interface{}, error) {
+	return fmt.Sprintf("<config %s/%s>", object, field), nil
+}
+
+func (simulationConfigProvider) GetObject(ctx context.Context, object string, overrides []string, localContext interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+// simulationSecretProvider returns a placeholder for every secret field
+type simulationSecretProvider struct{}
+
+func (simulationSecretProvider) Get(ctx context.Context, name string, field string, localContext interface{}) (string, error) {
+	return fmt.Sprintf("<secret %s/%s>", name, field), nil
+}
+
+func (m *CampaignVersionsManager) evaluateValue(ctx context.Context, v interface{}, namespace string, inputs map[string]interface{}, triggers map[string]interface{}, outputs map[string]map[string]interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		eCtx := m.newEvaluationContext(ctx, namespace)
+		eCtx.Inputs = inputs
+		if v, ok := inputs["context"]; ok {
+			eCtx.Value = v
+		}
+		eCtx.Triggers = triggers
+		eCtx.Outputs = outputs
+		return api_utils.NewParser(val).Eval(*eCtx)
+	case []interface{}:
+		ret := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			tv, err := m.evaluateValue(ctx, item, namespace, inputs, triggers, outputs)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, tv)
+		}
+		return ret, nil
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			tv, err := m.evaluateValue(ctx, item, namespace, inputs, triggers, outputs)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = tv
+		}
+		return ret, nil
+	default:
+		return val, nil
+	}
+}
+
+func isSimulatedStatusOK(status interface{}) bool {
+	switch v := status.(type) {
+	case v1alpha2.State:
+		return v == v1alpha2.OK
+	case int:
+		return v == int(v1alpha2.OK)
+	case float64:
+		return int(v) == int(v1alpha2.OK)
+	case string:
+		code, err := strconv.Atoi(v)
+		return err == nil && code == int(v1alpha2.OK)
+	}
+	return false
+}
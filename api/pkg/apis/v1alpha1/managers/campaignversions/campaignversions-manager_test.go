@@ -11,7 +11,11 @@ import (
 	"testing"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	mocksecret "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/secret/mock"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -219,3 +223,136 @@ func TestCreateCampaignVersionWithWrongFirstStage(t *testing.T) {
 	assert.Contains(t, err.Error(), "firstStage must be one of the stages in the stages list")
 }
 */
+
+func TestValidateCampaignVersionStageGraph(t *testing.T) {
+	manager := CampaignVersionsManager{}
+	result := manager.ValidateCampaignVersion(context.Background(), model.CampaignValidationRequest{
+		CampaignVersion: model.CampaignVersionState{
+			ObjectMeta: model.ObjectMeta{
+				Name: "test-v-version1",
+			},
+			Spec: &model.CampaignVersionSpec{
+				FirstStage:  "a",
+				SelfDriving: true,
+				Stages: map[string]model.StageSpec{
+					"a": {Name: "a", Provider: "providers.stage.mock", StageSelector: "b"},
+					"b": {Name: "b", Provider: "providers.stage.mock", StageSelector: "a"},
+					"c": {Name: "c", Provider: "providers.stage.unknown", StageSelector: "missing"},
+					"d": {Name: "d", Provider: "providers.stage.mock", StageSelector: "${{$foo()}}"},
+				},
+			},
+		},
+	})
+	assert.False(t, result.Valid)
+	messages := map[string][]string{}
+	for _, issue := range result.Issues {
+		messages[issue.Stage] = append(messages[issue.Stage], issue.Message)
+	}
+	assert.Contains(t, messages["a"], "stage leads into a cycle without an exit")
+	assert.Contains(t, messages["b"], "stage leads into a cycle without an exit")
+	assert.Contains(t, messages["c"], "unknown stage provider 'providers.stage.unknown'")
+	assert.Contains(t, messages["c"], "dead end: stage 'missing' does not exist")
+	assert.Contains(t, messages["c"], "stage is unreachable from firstStage 'a'")
+	assert.Equal(t, 2, len(messages["d"]))
+	assert.Nil(t, result.Simulation)
+}
+
+func TestValidateCampaignVersionSimulation(t *testing.T) {
+	manager := CampaignVersionsManager{}
+	result := manager.ValidateCampaignVersion(context.Background(), model.CampaignValidationRequest{
+		CampaignVersion: model.CampaignVersionState{
+			ObjectMeta: model.ObjectMeta{
+				Name: "test-v-version1",
+			},
+			Spec: &model.CampaignVersionSpec{
+				FirstStage:  "counter",
+				SelfDriving: true,
+				Stages: map[string]model.StageSpec{
+					"counter": {
+						Name:          "counter",
+						Provider:      "providers.stage.mock",
+						Inputs:        map[string]interface{}{"foo": "${{$output(counter,foo)}}"},
+						StageSelector: "${{$if($lt($output(counter,foo),3),counter,cleanup)}}",
+					},
+					"cleanup": {
+						Name:         "cleanup",
+						Provider:     "providers.stage.mock",
+						HandleErrors: true,
+					},
+				},
+			},
+		},
+		Simulate: true,
+		StubOutputs: map[string]map[string]interface{}{
+			"cleanup": {"status": 500, "error": "stubbed failure"},
+		},
+	})
+	assert.True(t, result.Valid)
+	assert.NotNil(t, result.Simulation)
+	assert.False(t, result.Simulation.Completed)
+	history := result.Simulation.StageHistory
+	assert.Equal(t, 4, len(history))
+	assert.Equal(t, "counter", history[0].NextStage)
+	assert.Equal(t, "cleanup", history[2].NextStage)
+	assert.Equal(t, "cleanup", history[3].Stage)
+	assert.Equal(t, v1alpha2.InternalError, history[3].Status)
+}
+
+func TestValidateCampaignVersionSimulationStubsSecrets(t *testing.T) {
+	secretProvider := &mocksecret.MockSecretProvider{}
+	secretProvider.Init(mocksecret.MockSecretProviderConfig{})
+	manager := CampaignVersionsManager{}
+	manager.VendorContext = &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{
+			SecretProvider: secretProvider,
+		},
+	}
+	result := manager.ValidateCampaignVersion(context.Background(), model.CampaignValidationRequest{
+		CampaignVersion: model.CampaignVersionState{
+			Spec: &model.CampaignVersionSpec{
+				FirstStage: "deploy",
+				Stages: map[string]model.StageSpec{
+					"deploy": {
+						Name:     "deploy",
+						Provider: "providers.stage.mock",
+						Inputs: map[string]interface{}{
+							"password": "${{$secret('db', 'password')}}",
+							"host":     "${{$config('db-config', 'host')}}",
+						},
+					},
+				},
+			},
+		},
+		Simulate: true,
+	})
+	assert.True(t, result.Valid)
+	assert.Equal(t, 1, len(result.Simulation.StageHistory))
+	inputs := result.Simulation.StageHistory[0].Inputs
+	assert.Equal(t, "<secret db/password>", inputs["password"])
+	assert.Equal(t, "<config db-config/host>", inputs["host"])
+}
+
+func TestValidateCampaignVersionSimulationMaxSteps(t *testing.T) {
+	manager := CampaignVersionsManager{}
+	result := manager.ValidateCampaignVersion(context.Background(), model.CampaignValidationRequest{
+		CampaignVersion: model.CampaignVersionState{
+			Spec: &model.CampaignVersionSpec{
+				FirstStage:  "loop",
+				SelfDriving: true,
+				Stages: map[string]model.StageSpec{
+					"loop": {
+						Name:          "loop",
+						Provider:      "providers.stage.mock",
+						StageSelector: "${{$if($equal(1,1),loop,'')}}",
+					},
+				},
+			},
+		},
+		Simulate: true,
+		MaxSteps: 5,
+	})
+	assert.True(t, result.Valid)
+	assert.False(t, result.Simulation.Completed)
+	assert.Equal(t, 5, len(result.Simulation.StageHistory))
+	assert.Equal(t, "simulation stopped after 5 steps", result.Simulation.Message)
+}
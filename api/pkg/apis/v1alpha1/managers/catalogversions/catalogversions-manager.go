@@ -7,13 +7,18 @@
 package catalogversions
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/eclipse-symphony/symphony/api/constants"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
@@ -34,8 +39,19 @@ type CatalogVersionsManager struct {
 	GraphProvider    graph.IGraphProvider
 	needValidate     bool
 	CatalogVersionValidator validation.CatalogVersionValidator
+	// conflictPolicies are the conflict policies of catalog types, conflictPolicy applies to other types
+	conflictPolicies map[string]string
+	conflictPolicy   string
+	// effective caches resolved catalog versions, when enabled
+	effective *effectiveCache
+	// history keeps the revisions of catalog versions, when enabled
+	history *catalogHistory
+	// impactChecker applies the impact check policy to changes of catalog versions
+	impactChecker *validation.ImpactChecker
 }
 
+const conflictPolicyProperty = "sync.conflictPolicy"
+
 func (s *CatalogVersionsManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
 	err := s.Manager.Init(context, config, providers)
 	if err != nil {
@@ -53,12 +69,35 @@ func (s *CatalogVersionsManager) Init(context *contexts.VendorContext, config ma
 		}
 	}
 	s.needValidate = managers.NeedObjectValidate(config, providers)
-	if s.needValidate {
-		// Turn off validation of differnt types: https://github.com/eclipse-symphony/symphony/issues/445
-		// s.CatalogVersionValidator = validation.NewCatalogVersionValidator(s.CatalogVersionLookup, s.CatalogLookup, s.ChildCatalogVersionLookup)
-		s.CatalogVersionValidator = validation.NewCatalogVersionValidator(s.CatalogVersionLookup, nil, s.ChildCatalogVersionLookup)
+	// Turn off validation of differnt types: https://github.com/eclipse-symphony/symphony/issues/445
+	// s.CatalogVersionValidator = validation.NewCatalogVersionValidator(s.CatalogVersionLookup, s.CatalogLookup, s.ChildCatalogVersionLookup)
+	// the validator is always set up, as schemas are enforced even when other validations are left to the state store
+	s.CatalogVersionValidator = validation.NewCatalogVersionValidator(s.CatalogVersionLookup, nil, s.ChildCatalogVersionLookup)
+	s.conflictPolicy = model.ConflictPolicyParentWins
+	s.conflictPolicies = make(map[string]string)
+	for key, value := range config.Properties {
+		if key != conflictPolicyProperty && !strings.HasPrefix(key, conflictPolicyProperty+".") {
+			continue
+		}
+		if value != model.ConflictPolicyParentWins && value != model.ConflictPolicyChildWins && value != model.ConflictPolicyManual {
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid conflict policy '%s' of %s", value, key), v1alpha2.BadConfig)
+		}
+		if key == conflictPolicyProperty {
+			s.conflictPolicy = value
+		} else {
+			s.conflictPolicies[strings.TrimPrefix(key, conflictPolicyProperty+".")] = value
+		}
 	}
-	return nil
+	s.effective, err = readEffectiveCache(config.Properties)
+	if err != nil {
+		return err
+	}
+	s.history, err = readHistory(config, providers)
+	if err != nil {
+		return err
+	}
+	s.impactChecker, err = validation.NewImpactChecker(config.Properties, validation.CatalogVersion, states.ObjectLister(s.StateProvider))
+	return err
 }
 
 func (s *CatalogVersionsManager) GetState(ctx context.Context, name string, namespace string) (model.CatalogVersionState, error) {
@@ -117,6 +156,14 @@ func (m *CatalogVersionsManager) UpsertState(ctx context.Context, name string, s
 	defer observ_utils.CloseSpanWithError(span, &err)
 	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
 
+	err = m.upsertState(ctx, name, state, false)
+	return err
+}
+
+// upsertState writes a catalog version. The generation is bumped when the spec changes, and
+// catalog versions written by sync are marked as synced at the new generation.
+func (m *CatalogVersionsManager) upsertState(ctx context.Context, name string, state model.CatalogVersionState, synced bool) error {
+	var err error
 	if state.ObjectMeta.Name != "" && state.ObjectMeta.Name != name {
 		return v1alpha2.NewCOAError(nil, fmt.Sprintf("Name in metadata (%s) does not match name in request (%s)", state.ObjectMeta.Name, name), v1alpha2.BadRequest)
 	}
@@ -126,6 +173,10 @@ func (m *CatalogVersionsManager) UpsertState(ctx context.Context, name string, s
 	if getStateErr == nil {
 		state.ObjectMeta.PreserveSystemMetadata(oldState.ObjectMeta)
 	}
+	state.ObjectMeta.ObjGeneration = nextGeneration(oldState, getStateErr, state.Spec)
+	if synced {
+		state.ObjectMeta.UpdateAnnotation(constants.SyncedGenerationKey, strconv.FormatInt(state.ObjectMeta.ObjGeneration, 10))
+	}
 
 	if m.needValidate {
 		if state.ObjectMeta.Labels == nil {
@@ -140,6 +191,18 @@ func (m *CatalogVersionsManager) UpsertState(ctx context.Context, name string, s
 		if err = validation.ValidateCreateOrUpdateWrapper(ctx, &m.CatalogVersionValidator, state, oldState, getStateErr); err != nil {
 			return err
 		}
+	} else if state.Spec != nil && state.Spec.Metadata["schema"] != "" {
+		// catalogs that declare a schema are always checked against it
+		if errorField := m.CatalogVersionValidator.ValidateSchema(ctx, state); errorField != nil {
+			return v1alpha2.NewCOAError(nil, "Failed to create or update object: "+validation.ConvertErrorFieldsToString([]validation.ErrorField{*errorField}), v1alpha2.BadRequest)
+		}
+	}
+
+	// updates synced from the parent site aren't checked, like deletions
+	if getStateErr == nil && !synced {
+		if err = m.impactChecker.CheckUpdate(ctx, name, state.ObjectMeta.Namespace, state); err != nil {
+			return err
+		}
 	}
 
 	upsertRequest := states.UpsertRequest{
@@ -165,6 +228,13 @@ func (m *CatalogVersionsManager) UpsertState(ctx context.Context, name string, s
 	if err != nil {
 		return err
 	}
+	m.effective.invalidate(state.ObjectMeta.Namespace, name)
+	// writes that leave the spec unchanged are not recorded
+	if getStateErr != nil {
+		m.recordChange(ctx, model.RevisionCreated, state)
+	} else if state.ObjectMeta.ObjGeneration != oldState.ObjectMeta.ObjGeneration {
+		m.recordChange(ctx, model.RevisionUpdated, state)
+	}
 	m.Context.Publish("catalogversion", v1alpha2.Event{
 		Metadata: map[string]string{
 			"objectType": state.Spec.CatalogType,
@@ -187,13 +257,26 @@ func (m *CatalogVersionsManager) DeleteState(ctx context.Context, name string, n
 	defer observ_utils.CloseSpanWithError(span, &err)
 	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
 
+	err = m.deleteState(ctx, name, namespace, false)
+	return err
+}
+
+// deleteState deletes a catalog version. Deletions synced from the parent site aren't checked
+// for dependent objects, as the catalog version is already gone on the parent site.
+func (m *CatalogVersionsManager) deleteState(ctx context.Context, name string, namespace string, synced bool) error {
+	var err error
 	if m.needValidate {
 		if err = m.ValidateDelete(ctx, name, namespace); err != nil {
 			return err
 		}
 	}
+	if !synced {
+		if err = m.impactChecker.CheckDelete(ctx, name, namespace); err != nil {
+			return err
+		}
+	}
 
-	//TODO: publish DELETE event
+	oldState, getStateErr := m.GetState(ctx, name, namespace)
 	err = m.StateProvider.Delete(ctx, states.DeleteRequest{
 		ID: name,
 		Metadata: map[string]interface{}{
@@ -204,9 +287,160 @@ func (m *CatalogVersionsManager) DeleteState(ctx context.Context, name string, n
 			"kind":      "CatalogVersion",
 		},
 	})
+	if err != nil {
+		return err
+	}
+	m.effective.invalidate(namespace, name)
+	if getStateErr != nil {
+		return nil
+	}
+	m.recordChange(ctx, model.RevisionDeleted, oldState)
+	// the deleted catalog version is the tombstone synced to child sites
+	m.Context.Publish("catalogversion", v1alpha2.Event{
+		Metadata: map[string]string{
+			"objectType": oldState.Spec.CatalogType,
+		},
+		Body: v1alpha2.JobData{
+			Id:     name,
+			Action: v1alpha2.JobDelete,
+			Body:   oldState,
+		},
+		Context: ctx,
+	})
+	return nil
+}
+
+// ConflictPolicy returns the conflict policy of a catalog type
+func (m *CatalogVersionsManager) ConflictPolicy(catalogType string) string {
+	if policy, ok := m.conflictPolicies[catalogType]; ok {
+		return policy
+	}
+	if m.conflictPolicy == "" {
+		return model.ConflictPolicyParentWins
+	}
+	return m.conflictPolicy
+}
+
+// ApplySyncedState applies a catalog version update or deletion synced from the origin site.
+// The local copy is named after the origin. When the local copy was modified since it was last
+// synced, the conflict policy of its catalog type decides whether it's overwritten; the conflict
+// is returned when the local changes are kept.
+func (m *CatalogVersionsManager) ApplySyncedState(ctx context.Context, origin string, action v1alpha2.JobAction, state model.CatalogVersionState) (*model.CatalogConflict, error) {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "ApplySyncedState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if authorOf(ctx) == "" {
+		ctx = WithAuthor(ctx, "site/"+origin)
+	}
+	// don't modify the caller's spec
+	spec := model.CatalogVersionSpec{}
+	if state.Spec != nil {
+		spec = *state.Spec
+	}
+	state.Spec = &spec
+	sourceName := state.ObjectMeta.Name
+	name := fmt.Sprintf("%s-%s", origin, sourceName)
+	namespace := state.ObjectMeta.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	var local model.CatalogVersionState
+	local, err = m.GetState(ctx, name, namespace)
+	if err != nil && !utils.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	err = nil
+
+	if exists && locallyModified(local) {
+		catalogType := state.Spec.CatalogType
+		if catalogType == "" {
+			catalogType = local.Spec.CatalogType
+		}
+		conflict := model.CatalogConflict{
+			Origin:           origin,
+			SourceName:       sourceName,
+			Namespace:        namespace,
+			CatalogType:      catalogType,
+			Action:           action,
+			Policy:           m.ConflictPolicy(catalogType),
+			LocalGeneration:  local.ObjectMeta.ObjGeneration,
+			ParentGeneration: state.ObjectMeta.ObjGeneration,
+			DetectedAt:       time.Now().UTC().Format(time.RFC3339),
+		}
+		if conflict.Policy != model.ConflictPolicyParentWins {
+			log.InfofCtx(ctx, " M (CatalogVersions): keeping local changes of %s synced from %s, policy: %s", name, origin, conflict.Policy)
+			return &conflict, nil
+		}
+		log.InfofCtx(ctx, " M (CatalogVersions): overwriting local changes of %s synced from %s", name, origin)
+	}
+
+	if action == v1alpha2.JobDelete {
+		if exists {
+			err = m.deleteState(ctx, name, namespace, true)
+		}
+		return nil, err
+	}
+
+	state.ObjectMeta.Name = name
+	state.ObjectMeta.Namespace = namespace
+	state.ObjectMeta.ETag = ""
+	if exists {
+		state.ObjectMeta.ETag = local.ObjectMeta.ETag
+	}
+	state.Spec.RootResource = validation.GetRootResourceFromName(name)
+	if state.Spec.ParentName != "" {
+		state.Spec.ParentName = fmt.Sprintf("%s-%s", origin, state.Spec.ParentName)
+	}
+	err = m.upsertState(ctx, name, state, true)
+	return nil, err
+}
+
+// AcceptLocalState resolves a sync conflict by keeping the local changes of a catalog version.
+// The catalog version is marked as synced, so later updates from the parent site apply again.
+func (m *CatalogVersionsManager) AcceptLocalState(ctx context.Context, name string, namespace string) error {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "AcceptLocalState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var state model.CatalogVersionState
+	state, err = m.GetState(ctx, name, namespace)
+	if err != nil {
+		return err
+	}
+	err = m.upsertState(ctx, name, state, true)
 	return err
 }
 
+// locallyModified checks if a synced catalog version changed since it was last synced
+func locallyModified(state model.CatalogVersionState) bool {
+	synced, ok := state.ObjectMeta.Annotations[constants.SyncedGenerationKey]
+	if !ok {
+		return false
+	}
+	return synced != strconv.FormatInt(state.ObjectMeta.ObjGeneration, 10)
+}
+
+func nextGeneration(oldState model.CatalogVersionState, getStateErr error, spec *model.CatalogVersionSpec) int64 {
+	if getStateErr != nil {
+		return 1
+	}
+	oldSpec, _ := json.Marshal(oldState.Spec)
+	newSpec, _ := json.Marshal(spec)
+	if bytes.Equal(oldSpec, newSpec) {
+		return oldState.ObjectMeta.ObjGeneration
+	}
+	return oldState.ObjectMeta.ObjGeneration + 1
+}
+
 func (t *CatalogVersionsManager) ListState(ctx context.Context, namespace string, filterType string, filterValue string) ([]model.CatalogVersionState, error) {
 	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
 		"method": "ListState",
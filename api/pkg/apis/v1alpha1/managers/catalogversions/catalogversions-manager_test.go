@@ -13,7 +13,9 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/eclipse-symphony/symphony/api/constants"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	memorygraph "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph/memory"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
@@ -23,6 +25,7 @@ import (
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
 	"github.com/stretchr/testify/assert"
 )
@@ -217,7 +220,7 @@ func TestDelete(t *testing.T) {
 			err := json.Unmarshal(jData, &job)
 			assert.Nil(t, err)
 			assert.Equal(t, "catalogversion", event.Metadata["objectType"])
-			assert.Equal(t, "name1", job.Id)
+			assert.Equal(t, catalogversionState.ObjectMeta.Name, job.Id)
 			assert.Equal(t, true, job.Action == v1alpha2.JobUpdate || job.Action == v1alpha2.JobDelete)
 			return nil
 		},
@@ -322,6 +325,72 @@ func TestSchemaCheck(t *testing.T) {
 	assert.True(t, strings.Contains(err.Error(), "email: property does not match pattern"))
 }
 
+func TestJSONSchemaCheck(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	// schemas are enforced even when the state store doesn't need other validations
+	manager.needValidate = false
+	schemaCatalogVersion := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "DeviceSchema-v-version1",
+			Namespace: "default",
+		},
+		Spec: &model.CatalogVersionSpec{
+			RootResource: "DeviceSchema",
+			CatalogType:  "schema",
+			Properties: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"$schema":  "https://json-schema.org/draft/2020-12/schema",
+					"type":     "object",
+					"required": []string{"ports"},
+					"properties": map[string]interface{}{
+						"ports": map[string]interface{}{
+							"type":  "array",
+							"items": map[string]interface{}{"$ref": "#/$defs/port"},
+						},
+						"mode": map[string]interface{}{"enum": []string{"auto", "manual"}},
+					},
+					"$defs": map[string]interface{}{
+						"port": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 65535},
+					},
+				},
+			},
+		},
+	}
+	err = manager.UpsertState(context.Background(), schemaCatalogVersion.ObjectMeta.Name, schemaCatalogVersion)
+	assert.Nil(t, err)
+
+	catalogversion := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "Device-v-version1",
+			Namespace: "default",
+		},
+		Spec: &model.CatalogVersionSpec{
+			RootResource: "Device",
+			CatalogType:  "catalogVersion",
+			Metadata: map[string]string{
+				"schema": "DeviceSchema:version1",
+			},
+			Properties: map[string]interface{}{
+				"ports": []interface{}{80, 70000},
+				"mode":  "off",
+			},
+		},
+	}
+	err = manager.UpsertState(context.Background(), catalogversion.ObjectMeta.Name, catalogversion)
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadRequest, err.(v1alpha2.COAError).State)
+	assert.True(t, strings.Contains(err.Error(), "/ports/1: maximum: got 70000, want 65535"))
+	assert.True(t, strings.Contains(err.Error(), "/mode: value must be one of"))
+
+	catalogversion.Spec.Properties = map[string]interface{}{
+		"ports": []interface{}{80, 443},
+		"mode":  "auto",
+	}
+	err = manager.UpsertState(context.Background(), catalogversion.ObjectMeta.Name, catalogversion)
+	assert.Nil(t, err)
+}
+
 func TestParentCatalogVersion(t *testing.T) {
 	err := initalizeManager()
 	assert.Nil(t, err)
@@ -378,6 +447,189 @@ func TestParentCatalogVersion(t *testing.T) {
 	assert.Contains(t, err.Error(), "CatalogVersion has one or more child catalogversions. Update or Deletion is not allowed")
 }
 
+func TestDeletePublishesTombstone(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.CatalogVersionValidator.CatalogLookupFunc = nil
+
+	err = manager.UpsertState(context.Background(), catalogversionState.ObjectMeta.Name, catalogversionState)
+	assert.Nil(t, err)
+	sig := make(chan v1alpha2.JobData, 1)
+	manager.Context.Subscribe("catalogversion", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			job := event.Body.(v1alpha2.JobData)
+			if job.Action == v1alpha2.JobDelete {
+				sig <- job
+			}
+			return nil
+		},
+	})
+	err = manager.DeleteState(context.Background(), catalogversionState.ObjectMeta.Name, "default")
+	assert.Nil(t, err)
+	select {
+	case job := <-sig:
+		assert.Equal(t, catalogversionState.ObjectMeta.Name, job.Id)
+		tombstone := job.Body.(model.CatalogVersionState)
+		assert.Equal(t, "catalogversion", tombstone.Spec.CatalogType)
+		assert.Equal(t, int64(1), tombstone.ObjectMeta.ObjGeneration)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "tombstone is not published")
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.CatalogVersionValidator.CatalogLookupFunc = nil
+
+	state := copyState(catalogversionState)
+	err = manager.UpsertState(context.Background(), state.ObjectMeta.Name, state)
+	assert.Nil(t, err)
+	val, err := manager.GetState(context.Background(), state.ObjectMeta.Name, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), val.ObjectMeta.ObjGeneration)
+
+	// unchanged spec keeps the generation
+	err = manager.UpsertState(context.Background(), state.ObjectMeta.Name, val)
+	assert.Nil(t, err)
+	val, err = manager.GetState(context.Background(), state.ObjectMeta.Name, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), val.ObjectMeta.ObjGeneration)
+
+	val.Spec.Properties["property1"] = "changed"
+	err = manager.UpsertState(context.Background(), state.ObjectMeta.Name, val)
+	assert.Nil(t, err)
+	val, err = manager.GetState(context.Background(), state.ObjectMeta.Name, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), val.ObjectMeta.ObjGeneration)
+}
+
+func TestConflictPolicyConfig(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	m := CatalogVersionsManager{}
+	err := m.Init(&contexts.VendorContext{}, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate":   "StateProvider",
+			"sync.conflictPolicy":         "manual",
+			"sync.conflictPolicy.config":  "child-wins",
+			"sync.conflictPolicy.profile": "parent-wins",
+		},
+	}, map[string]providers.IProvider{"StateProvider": stateProvider})
+	assert.Nil(t, err)
+	assert.Equal(t, model.ConflictPolicyManual, m.ConflictPolicy("asset"))
+	assert.Equal(t, model.ConflictPolicyChildWins, m.ConflictPolicy("config"))
+	assert.Equal(t, model.ConflictPolicyParentWins, m.ConflictPolicy("profile"))
+
+	err = m.Init(&contexts.VendorContext{}, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "StateProvider",
+			"sync.conflictPolicy":       "newest-wins",
+		},
+	}, map[string]providers.IProvider{"StateProvider": stateProvider})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadConfig, v1alpha2.GetErrorState(err))
+}
+
+func copyState(state model.CatalogVersionState) model.CatalogVersionState {
+	var ret model.CatalogVersionState
+	jData, _ := json.Marshal(state)
+	json.Unmarshal(jData, &ret)
+	return ret
+}
+
+func TestApplySyncedState(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.CatalogVersionValidator.CatalogLookupFunc = nil
+	manager.conflictPolicies["catalogversion"] = model.ConflictPolicyManual
+
+	parent := copyState(catalogversionState)
+	parent.ObjectMeta.ObjGeneration = 3
+	conflict, err := manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, copyState(parent))
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+	local, err := manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "hq-name1", local.Spec.RootResource)
+	assert.Equal(t, "1", local.ObjectMeta.Annotations[constants.SyncedGenerationKey])
+
+	// updates apply while the local copy is unchanged
+	parent.Spec.Properties["property1"] = "parent"
+	conflict, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, copyState(parent))
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+	local, err = manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "parent", local.Spec.Properties["property1"])
+
+	// a local change conflicts with the next update
+	local.Spec.Properties["property1"] = "local"
+	err = manager.UpsertState(context.Background(), local.ObjectMeta.Name, local)
+	assert.Nil(t, err)
+	parent.Spec.Properties["property1"] = "parent2"
+	conflict, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, copyState(parent))
+	assert.Nil(t, err)
+	assert.NotNil(t, conflict)
+	assert.Equal(t, model.ConflictPolicyManual, conflict.Policy)
+	assert.Equal(t, "name1-v-version1", conflict.SourceName)
+	assert.Equal(t, int64(3), conflict.ParentGeneration)
+	assert.Equal(t, int64(3), conflict.LocalGeneration)
+	local, err = manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "local", local.Spec.Properties["property1"])
+
+	// deletions conflict too
+	conflict, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobDelete, copyState(parent))
+	assert.Nil(t, err)
+	assert.NotNil(t, conflict)
+	assert.Equal(t, v1alpha2.JobDelete, conflict.Action)
+
+	// keeping the local changes marks the local copy as synced
+	err = manager.AcceptLocalState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	conflict, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, copyState(parent))
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+	local, err = manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "parent2", local.Spec.Properties["property1"])
+
+	conflict, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobDelete, copyState(parent))
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+	_, err = manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.True(t, utils.IsNotFound(err))
+
+	// deleting a catalog version that doesn't exist locally is a no-op
+	conflict, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobDelete, copyState(parent))
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+}
+
+func TestApplySyncedStateParentWins(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.CatalogVersionValidator.CatalogLookupFunc = nil
+
+	parent := copyState(catalogversionState)
+	_, err = manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, copyState(parent))
+	assert.Nil(t, err)
+	local, err := manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	local.Spec.Properties["property1"] = "local"
+	err = manager.UpsertState(context.Background(), local.ObjectMeta.Name, local)
+	assert.Nil(t, err)
+
+	parent.Spec.Properties["property1"] = "parent"
+	conflict, err := manager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, copyState(parent))
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+	local, err = manager.GetState(context.Background(), "hq-name1-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "parent", local.Spec.Properties["property1"])
+}
+
 /*
 func TestCatalogVersion(t *testing.T) {
 	err := initalizeManager()
@@ -428,3 +680,386 @@ func TestCatalogVersion(t *testing.T) {
 	assert.Nil(t, err)
 }
 */
+
+func upsertConfig(t *testing.T, name string, parent string, properties map[string]interface{}) {
+	err := manager.UpsertState(context.Background(), name, model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType:  "config",
+			RootResource: validation.GetRootResourceFromName(name),
+			ParentName:   parent,
+			Properties:   properties,
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func TestGetEffectiveState(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	upsertConfig(t, "base-v-v1", "", map[string]interface{}{
+		"region":  "west",
+		"retries": 3,
+		"logging": map[string]interface{}{"level": "info", "format": "json"},
+		"proxy":   map[string]interface{}{"url": "http://proxy"},
+	})
+	upsertConfig(t, "site-v-v1", "base:v1", map[string]interface{}{
+		"retries": 5,
+		"logging": map[string]interface{}{"level": "debug"},
+	})
+	upsertConfig(t, "line-v-v1", "site:v1", map[string]interface{}{
+		"retries": 7,
+		"region":  "west",
+		"proxy":   "none",
+		"line":    "1",
+	})
+
+	effective, err := manager.GetEffectiveState(context.Background(), "line-v-v1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "default", effective.Namespace)
+	assert.Equal(t, []string{"line-v-v1", "site-v-v1", "base-v-v1"}, effective.Chain)
+	assert.Equal(t, map[string]interface{}{
+		"region":  "west",
+		"retries": float64(7),
+		"logging": map[string]interface{}{"level": "debug", "format": "json"},
+		"proxy":   "none",
+		"line":    "1",
+	}, effective.Properties)
+	assert.Equal(t, map[string]string{
+		"/region":         "line-v-v1",
+		"/retries":        "line-v-v1",
+		"/logging/level":  "site-v-v1",
+		"/logging/format": "base-v-v1",
+		"/proxy":          "line-v-v1",
+		"/line":           "line-v-v1",
+	}, effective.Provenance)
+
+	// equal values aren't conflicts
+	assert.Equal(t, 3, len(effective.Conflicts))
+	assert.Equal(t, model.PropertyConflict{
+		Property: "/logging/level",
+		Catalog:  "site-v-v1",
+		Value:    "debug",
+		Overridden: []model.CatalogValue{
+			{Catalog: "base-v-v1", Value: "info"},
+		},
+	}, effective.Conflicts[0])
+	assert.Equal(t, "/proxy", effective.Conflicts[1].Property)
+	assert.Equal(t, "base-v-v1", effective.Conflicts[1].Overridden[0].Catalog)
+	assert.Equal(t, model.PropertyConflict{
+		Property: "/retries",
+		Catalog:  "line-v-v1",
+		Value:    float64(7),
+		Overridden: []model.CatalogValue{
+			{Catalog: "site-v-v1", Value: float64(5)},
+			{Catalog: "base-v-v1", Value: float64(3)},
+		},
+	}, effective.Conflicts[2])
+
+	_, err = manager.GetEffectiveState(context.Background(), "missing-v-v1", "default")
+	assert.True(t, utils.IsNotFound(err))
+}
+
+func TestGetEffectiveStateBrokenChain(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.needValidate = false
+	upsertConfig(t, "orphan-v-v1", "gone:v1", map[string]interface{}{"a": "b"})
+	_, err = manager.GetEffectiveState(context.Background(), "orphan-v-v1", "default")
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+
+	upsertConfig(t, "a-v-v1", "b:v1", map[string]interface{}{})
+	upsertConfig(t, "b-v-v1", "a:v1", map[string]interface{}{})
+	_, err = manager.GetEffectiveState(context.Background(), "a-v-v1", "default")
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+}
+
+func TestEffectiveCache(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.effective, err = readEffectiveCache(map[string]string{"effective.cache": "true"})
+	assert.Nil(t, err)
+	upsertConfig(t, "base-v-v1", "", map[string]interface{}{"level": "info"})
+	upsertConfig(t, "app-v-v1", "base:v1", map[string]interface{}{"name": "app"})
+	upsertConfig(t, "other-v-v1", "", map[string]interface{}{"level": "warn"})
+
+	effective, err := manager.GetEffectiveState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "info", effective.Properties["level"])
+	_, ok := manager.effective.get("default", "app-v-v1")
+	assert.True(t, ok)
+
+	// callers can't change the cached copy
+	effective.Properties["level"] = "error"
+	effective, err = manager.GetEffectiveState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "info", effective.Properties["level"])
+
+	// unrelated catalogs keep the entry
+	upsertConfig(t, "other-v-v1", "", map[string]interface{}{"level": "error"})
+	_, ok = manager.effective.get("default", "app-v-v1")
+	assert.True(t, ok)
+
+	// a change of an ancestor drops it
+	upsertConfig(t, "base-v-v1", "", map[string]interface{}{"level": "debug"})
+	_, ok = manager.effective.get("default", "app-v-v1")
+	assert.False(t, ok)
+	effective, err = manager.GetEffectiveState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "debug", effective.Properties["level"])
+
+	err = manager.DeleteState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	_, ok = manager.effective.get("default", "app-v-v1")
+	assert.False(t, ok)
+
+	for _, properties := range []map[string]string{
+		{"effective.cache": "true", "effective.cacheTTL": "soon"},
+		{"effective.cache": "true", "effective.cacheTTL": "-1s"},
+	} {
+		_, err = readEffectiveCache(properties)
+		assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+	}
+	cache, err := readEffectiveCache(map[string]string{})
+	assert.Nil(t, err)
+	assert.Nil(t, cache)
+}
+
+func enableHistory(t *testing.T) {
+	historyProvider := &memorystate.MemoryStateProvider{}
+	err := historyProvider.Init(memorystate.MemoryStateProviderConfig{})
+	assert.Nil(t, err)
+	manager.history, err = readHistory(managers.ManagerConfig{
+		Properties: map[string]string{"providers.historystate": "HistoryProvider"},
+	}, map[string]providers.IProvider{"HistoryProvider": historyProvider})
+	assert.Nil(t, err)
+}
+
+func TestCatalogHistory(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	enableHistory(t)
+	ctx := WithAuthor(context.Background(), "alice")
+	err = manager.UpsertState(ctx, "app-v-v1", model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{Name: "app-v-v1"},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType:  "config",
+			RootResource: "app",
+			Properties:   map[string]interface{}{"level": "info", "db": map[string]interface{}{"host": "a", "port": 5432}},
+		},
+	})
+	assert.Nil(t, err)
+	// writes without changes are not recorded
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "info", "db": map[string]interface{}{"host": "a", "port": 5432}})
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "debug", "db": map[string]interface{}{"host": "b"}, "new": true})
+	upsertConfig(t, "other-v-v1", "", map[string]interface{}{"level": "warn"})
+
+	revisions, err := manager.ListRevisions(context.Background(), "app-v-v1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, int64(1), revisions[0].Revision)
+	assert.Equal(t, model.RevisionCreated, revisions[0].Action)
+	assert.Equal(t, "alice", revisions[0].Author)
+	assert.Equal(t, int64(1), revisions[0].Generation)
+	assert.NotEmpty(t, revisions[0].Timestamp)
+	assert.Equal(t, int64(2), revisions[1].Revision)
+	assert.Equal(t, model.RevisionUpdated, revisions[1].Action)
+	assert.Equal(t, "", revisions[1].Author)
+	assert.Equal(t, int64(2), revisions[1].Generation)
+
+	diff, err := manager.DiffRevisions(context.Background(), "app-v-v1", "default", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), diff.From)
+	assert.Equal(t, int64(2), diff.To)
+	assert.Equal(t, []model.PropertyChange{
+		{Property: "/properties/db/host", Operation: model.ChangeReplaced, Old: "a", New: "b"},
+		{Property: "/properties/db/port", Operation: model.ChangeRemoved, Old: float64(5432)},
+		{Property: "/properties/level", Operation: model.ChangeReplaced, Old: "info", New: "debug"},
+		{Property: "/properties/new", Operation: model.ChangeAdded, New: true},
+	}, diff.Changes)
+
+	err = manager.RestoreRevision(WithAuthor(context.Background(), "bob"), "app-v-v1", "default", 1)
+	assert.Nil(t, err)
+	state, err := manager.GetState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "info", state.Spec.Properties["level"])
+	restored, err := manager.GetRevision(context.Background(), "app-v-v1", "default", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RevisionRestored, restored.Action)
+	assert.Equal(t, int64(1), restored.RestoredFrom)
+	assert.Equal(t, "bob", restored.Author)
+	diff, err = manager.DiffRevisions(context.Background(), "app-v-v1", "default", 1, 3)
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Changes)
+
+	err = manager.DeleteState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	deleted, err := manager.GetRevision(context.Background(), "app-v-v1", "default", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RevisionDeleted, deleted.Action)
+	assert.Equal(t, "info", deleted.Spec.Properties["level"])
+
+	// a deleted catalog version can be brought back
+	err = manager.RestoreRevision(context.Background(), "app-v-v1", "default", 2)
+	assert.Nil(t, err)
+	state, err = manager.GetState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "debug", state.Spec.Properties["level"])
+
+	_, err = manager.GetRevision(context.Background(), "app-v-v1", "default", 9)
+	assert.True(t, utils.IsNotFound(err))
+	_, err = manager.DiffRevisions(context.Background(), "app-v-v1", "default", 1, 9)
+	assert.True(t, utils.IsNotFound(err))
+}
+
+func TestCatalogHistoryHead(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	enableHistory(t)
+	ctx := context.Background()
+	// a history without a head is counted once
+	_, err = manager.history.state.Upsert(ctx, states.UpsertRequest{
+		Value:    revisionEntry(revisionId("app-v-v1", 4), model.CatalogRevision{Name: "app-v-v1", Namespace: "default", Revision: 4, Action: model.RevisionUpdated}, ""),
+		Metadata: historyMetadata("default"),
+	})
+	assert.Nil(t, err)
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "info"})
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "debug"})
+
+	head, err := manager.history.state.Get(ctx, states.GetRequest{ID: revisionHeadId("app-v-v1"), Metadata: historyMetadata("default")})
+	assert.Nil(t, err)
+	revision, err := readRevision(head.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), revision.Revision)
+
+	// revisions are stored as objects, and the head isn't listed
+	entry, err := manager.history.state.Get(ctx, states.GetRequest{ID: revisionId("app-v-v1", 6), Metadata: historyMetadata("default")})
+	assert.Nil(t, err)
+	assert.Equal(t, revisionId("app-v-v1", 6), entry.Body.(map[string]interface{})["metadata"].(map[string]interface{})["name"])
+	revisions, err := manager.ListRevisions(ctx, "app-v-v1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(revisions))
+	assert.Equal(t, int64(6), revisions[2].Revision)
+}
+
+func TestCatalogHistoryDisabled(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "info"})
+	_, err = manager.ListRevisions(context.Background(), "app-v-v1", "default")
+	assert.Equal(t, v1alpha2.BadRequest, err.(v1alpha2.COAError).State)
+
+	_, err = readHistory(managers.ManagerConfig{
+		Properties: map[string]string{"providers.historystate": "missing"},
+	}, map[string]providers.IProvider{})
+	assert.Equal(t, v1alpha2.MissingConfig, err.(v1alpha2.COAError).State)
+}
+
+func TestCatalogRevisionEvent(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	enableHistory(t)
+	sig := make(chan v1alpha2.Event, 2)
+	manager.Context.Subscribe(CatalogRevisionTopic, v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			sig <- event
+			return nil
+		},
+	})
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "info"})
+	select {
+	case event := <-sig:
+		assert.Equal(t, "app-v-v1", event.Metadata["name"])
+		assert.Equal(t, "default", event.Metadata["namespace"])
+		assert.Equal(t, model.RevisionCreated, event.Metadata["action"])
+		assert.Equal(t, "1", event.Metadata["revision"])
+		revision := event.Body.(model.CatalogRevision)
+		assert.Equal(t, "info", revision.Spec.Properties["level"])
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "revision is not published")
+	}
+}
+
+func TestApplySyncedStateAuthor(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	enableHistory(t)
+	_, err = manager.ApplySyncedState(context.Background(), "parent", v1alpha2.JobUpdate, model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{Name: "app-v-v1", Namespace: "default"},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType: "config",
+			Properties:  map[string]interface{}{"level": "info"},
+		},
+	})
+	assert.Nil(t, err)
+	revisions, err := manager.ListRevisions(context.Background(), "parent-app-v-v1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(revisions))
+	assert.Equal(t, "site/parent", revisions[0].Author)
+}
+
+func TestDeleteImpactCheck(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.impactChecker.Policy = model.ImpactCheckBlock
+	upsertConfig(t, "base-v-v1", "", map[string]interface{}{"level": "info"})
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "${{$config('base:v1', 'level')}}"})
+
+	err = manager.DeleteState(context.Background(), "base-v-v1", "default")
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadRequest, v1alpha2.GetErrorState(err))
+	assert.Contains(t, err.Error(), "catalogversion app-v-v1")
+	_, err = manager.GetState(context.Background(), "base-v-v1", "default")
+	assert.Nil(t, err)
+
+	// updates don't break references by name
+	upsertConfig(t, "base-v-v1", "", map[string]interface{}{"level": "debug"})
+
+	// objects without dependents are deleted
+	err = manager.DeleteState(context.Background(), "app-v-v1", "default")
+	assert.Nil(t, err)
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "${{$config('base:v1', 'level')}}"})
+
+	manager.impactChecker.Policy = model.ImpactCheckWarn
+	err = manager.DeleteState(context.Background(), "base-v-v1", "default")
+	assert.Nil(t, err)
+}
+
+func TestDeleteImpactCheckSynced(t *testing.T) {
+	err := initalizeManager()
+	assert.Nil(t, err)
+	manager.impactChecker.Policy = model.ImpactCheckBlock
+	state := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{Name: "base-v-v1", Namespace: "default"},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType: "config",
+			Properties:  map[string]interface{}{"level": "info"},
+		},
+	}
+	_, err = manager.ApplySyncedState(context.Background(), "parent", v1alpha2.JobUpdate, state)
+	assert.Nil(t, err)
+	upsertConfig(t, "app-v-v1", "", map[string]interface{}{"level": "${{$config('parent-base:v1', 'level')}}"})
+
+	// deletions synced from the parent site aren't blocked
+	_, err = manager.ApplySyncedState(context.Background(), "parent", v1alpha2.JobDelete, state)
+	assert.Nil(t, err)
+	_, err = manager.GetState(context.Background(), "parent-base-v-v1", "default")
+	assert.True(t, utils.IsNotFound(err))
+}
+
+func TestImpactCheckConfig(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	m := CatalogVersionsManager{}
+	err := m.Init(&contexts.VendorContext{}, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "StateProvider",
+			"impact.check":              "refuse",
+		},
+	}, map[string]providers.IProvider{"StateProvider": stateProvider})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadConfig, v1alpha2.GetErrorState(err))
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package catalogversions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+)
+
+// effectiveCache keeps resolved catalog versions until one of their chain changes
+type effectiveCache struct {
+	lock sync.RWMutex
+	// ttl bounds how long entries are kept, for stores that are also changed without the manager
+	ttl     time.Duration
+	entries map[string]effectiveEntry
+}
+
+type effectiveEntry struct {
+	catalog model.EffectiveCatalog
+	expires time.Time
+}
+
+func readEffectiveCache(properties map[string]string) (*effectiveCache, error) {
+	if properties["effective.cache"] != "true" {
+		return nil, nil
+	}
+	ret := &effectiveCache{entries: make(map[string]effectiveEntry)}
+	if v := properties["effective.cacheTTL"]; v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			return nil, v1alpha2.NewCOAError(err, "invalid effective.cacheTTL: "+v, v1alpha2.BadConfig)
+		}
+		ret.ttl = ttl
+	}
+	return ret, nil
+}
+
+func (c *effectiveCache) get(namespace string, name string) (model.EffectiveCatalog, bool) {
+	if c == nil {
+		return model.EffectiveCatalog{}, false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	entry, ok := c.entries[namespace+"/"+name]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return model.EffectiveCatalog{}, false
+	}
+	return entry.catalog, true
+}
+
+func (c *effectiveCache) set(catalog model.EffectiveCatalog) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := effectiveEntry{catalog: catalog}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	c.entries[catalog.Namespace+"/"+catalog.Name] = entry
+}
+
+// invalidate drops the resolved catalog versions that have a catalog version in their chain
+func (c *effectiveCache) invalidate(namespace string, name string) {
+	if c == nil {
+		return
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, entry := range c.entries {
+		if entry.catalog.Namespace != namespace {
+			continue
+		}
+		for _, link := range entry.catalog.Chain {
+			if link == name {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// GetEffectiveState resolves the properties of a catalog version with the properties of its
+// parent chain. Nested objects are merged, and other values of descendants override the values
+// of their ancestors.
+func (m *CatalogVersionsManager) GetEffectiveState(ctx context.Context, name string, namespace string) (model.EffectiveCatalog, error) {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "GetEffectiveState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if namespace == "" {
+		namespace = "default"
+	}
+	if cached, ok := m.effective.get(namespace, name); ok {
+		return copyEffectiveCatalog(cached), nil
+	}
+
+	chain := make([]model.CatalogVersionState, 0)
+	visited := make(map[string]bool)
+	current := name
+	for current != "" {
+		if visited[current] {
+			err = v1alpha2.NewCOAError(nil, fmt.Sprintf("catalog version %s has a circular parent chain through %s", name, current), v1alpha2.BadConfig)
+			return model.EffectiveCatalog{}, err
+		}
+		visited[current] = true
+		var state model.CatalogVersionState
+		state, err = m.GetState(ctx, current, namespace)
+		if err != nil {
+			if current != name && utils.IsNotFound(err) {
+				err = v1alpha2.NewCOAError(err, fmt.Sprintf("parent %s of catalog version %s is not found", current, chain[len(chain)-1].ObjectMeta.Name), v1alpha2.BadConfig)
+			}
+			return model.EffectiveCatalog{}, err
+		}
+		chain = append(chain, state)
+		current = ""
+		if state.Spec.ParentName != "" {
+			current = validation.ConvertReferenceToObjectName(state.Spec.ParentName)
+		}
+	}
+
+	ret := resolveChain(chain)
+	ret.Name = name
+	ret.Namespace = namespace
+	m.effective.set(ret)
+	return copyEffectiveCatalog(ret), nil
+}
+
+// resolveChain merges the properties of a chain of catalog versions, from the catalog version
+// up to the root
+func resolveChain(chain []model.CatalogVersionState) model.EffectiveCatalog {
+	r := resolver{
+		distance:   make(map[string]int),
+		provenance: make(map[string]string),
+		conflicts:  make(map[string]*model.PropertyConflict),
+	}
+	ret := model.EffectiveCatalog{
+		Chain:      make([]string, 0, len(chain)),
+		Properties: make(map[string]interface{}),
+	}
+	for i, state := range chain {
+		ret.Chain = append(ret.Chain, state.ObjectMeta.Name)
+		r.distance[state.ObjectMeta.Name] = i
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		r.merge(ret.Properties, chain[i].Spec.Properties, "", chain[i].ObjectMeta.Name)
+	}
+	ret.Provenance = r.provenance
+	for _, pointer := range sortedKeys(r.conflicts) {
+		ret.Conflicts = append(ret.Conflicts, *r.conflicts[pointer])
+	}
+	return ret
+}
+
+type resolver struct {
+	// distance is how far each catalog version of the chain is from the resolved catalog version
+	distance   map[string]int
+	provenance map[string]string
+	conflicts  map[string]*model.PropertyConflict
+}
+
+func (r *resolver) merge(dst map[string]interface{}, src map[string]interface{}, pointer string, catalog string) {
+	for _, key := range sortedKeys(src) {
+		value := src[key]
+		child := pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+		old, exists := dst[key]
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if dstMap, ok := old.(map[string]interface{}); ok {
+				r.merge(dstMap, srcMap, child, catalog)
+				continue
+			}
+			if exists {
+				r.override(child, old, value, catalog)
+			}
+			merged := make(map[string]interface{})
+			dst[key] = merged
+			r.merge(merged, srcMap, child, catalog)
+			if len(srcMap) == 0 {
+				r.provenance[child] = catalog
+			}
+			continue
+		}
+		if exists && !reflect.DeepEqual(old, value) {
+			r.override(child, old, value, catalog)
+		} else {
+			r.clear(child)
+		}
+		dst[key] = value
+		r.provenance[child] = catalog
+	}
+}
+
+// override marks the value at a pointer as overridden by a catalog version
+func (r *resolver) override(pointer string, old interface{}, value interface{}, catalog string) {
+	previous := r.supplier(pointer)
+	r.clear(pointer)
+	conflict, ok := r.conflicts[pointer]
+	if !ok {
+		conflict = &model.PropertyConflict{Property: pointer, Overridden: make([]model.CatalogValue, 0)}
+		r.conflicts[pointer] = conflict
+	}
+	conflict.Overridden = append([]model.CatalogValue{{Catalog: previous, Value: old}}, conflict.Overridden...)
+	conflict.Catalog = catalog
+	conflict.Value = value
+}
+
+// supplier returns the nearest catalog version that supplied the value at a pointer, or a value
+// nested in it
+func (r *resolver) supplier(pointer string) string {
+	ret := ""
+	for p, catalog := range r.provenance {
+		if p != pointer && !strings.HasPrefix(p, pointer+"/") {
+			continue
+		}
+		if ret == "" || r.distance[catalog] < r.distance[ret] {
+			ret = catalog
+		}
+	}
+	return ret
+}
+
+// clear removes the provenance and conflicts of values nested in a pointer
+func (r *resolver) clear(pointer string) {
+	for p := range r.provenance {
+		if p == pointer || strings.HasPrefix(p, pointer+"/") {
+			delete(r.provenance, p)
+		}
+	}
+	for p := range r.conflicts {
+		if strings.HasPrefix(p, pointer+"/") {
+			delete(r.conflicts, p)
+		}
+	}
+}
+
+func copyEffectiveCatalog(catalog model.EffectiveCatalog) model.EffectiveCatalog {
+	var ret model.EffectiveCatalog
+	jData, _ := json.Marshal(catalog)
+	_ = json.Unmarshal(jData, &ret)
+	return ret
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
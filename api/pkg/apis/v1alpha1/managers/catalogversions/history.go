@@ -0,0 +1,410 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package catalogversions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+)
+
+// CatalogRevisionTopic is published for each change of a catalog version
+const CatalogRevisionTopic = "catalogversion-revision"
+
+type authorKey struct{}
+type restoreKey struct{}
+
+// WithAuthor returns a context that attributes the catalog version changes made with it to an author
+func WithAuthor(ctx context.Context, author string) context.Context {
+	if author == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, authorKey{}, author)
+}
+
+func authorOf(ctx context.Context) string {
+	if author, ok := ctx.Value(authorKey{}).(string); ok {
+		return author
+	}
+	return ""
+}
+
+// catalogHistory keeps the revisions of catalog versions. Revisions are kept apart from the
+// catalog versions, as not all state providers separate resources. Each revision is stored as
+// a CatalogRevision object, and a head object per catalog version counts its revisions.
+type catalogHistory struct {
+	// lock serializes the numbering of revisions
+	lock  sync.Mutex
+	state states.IStateProvider
+}
+
+func readHistory(config managers.ManagerConfig, providers map[string]providers.IProvider) (*catalogHistory, error) {
+	name := config.Properties["providers.historystate"]
+	if name == "" {
+		return nil, nil
+	}
+	provider, ok := providers[name]
+	if !ok {
+		return nil, v1alpha2.NewCOAError(nil, "history state provider is not supplied", v1alpha2.MissingConfig)
+	}
+	stateProvider, ok := provider.(states.IStateProvider)
+	if !ok {
+		return nil, v1alpha2.NewCOAError(nil, "supplied provider is not a state provider", v1alpha2.BadConfig)
+	}
+	return &catalogHistory{state: stateProvider}, nil
+}
+
+func historyMetadata(namespace string) map[string]interface{} {
+	return map[string]interface{}{
+		"version":   "v1",
+		"group":     model.FederationGroup,
+		"resource":  "catalogrevisions",
+		"kind":      "CatalogRevision",
+		"namespace": namespace,
+	}
+}
+
+func revisionId(name string, revision int64) string {
+	return fmt.Sprintf("%s-r-%d", name, revision)
+}
+
+// revisionHeadId is the id of the object that keeps the latest revision number of a catalog version
+func revisionHeadId(name string) string {
+	return name + "-r-head"
+}
+
+// revisionEntry wraps a revision in an object with metadata, as the k8s state provider stores specs
+func revisionEntry(id string, revision model.CatalogRevision, etag string) states.StateEntry {
+	return states.StateEntry{
+		ID:   id,
+		ETag: etag,
+		Body: map[string]interface{}{
+			"metadata": model.ObjectMeta{
+				Name:      id,
+				Namespace: revision.Namespace,
+			},
+			"spec": revision,
+		},
+	}
+}
+
+func readRevision(body interface{}) (model.CatalogRevision, error) {
+	var entry struct {
+		Spec model.CatalogRevision `json:"spec"`
+	}
+	jData, _ := json.Marshal(body)
+	err := json.Unmarshal(jData, &entry)
+	return entry.Spec, err
+}
+
+// recordChange adds a change of a catalog version to its history, and publishes it
+func (m *CatalogVersionsManager) recordChange(ctx context.Context, action string, state model.CatalogVersionState) {
+	revision := model.CatalogRevision{
+		Name:       state.ObjectMeta.Name,
+		Namespace:  state.ObjectMeta.Namespace,
+		Generation: state.ObjectMeta.ObjGeneration,
+		Action:     action,
+		Author:     authorOf(ctx),
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		Spec:       state.Spec,
+	}
+	if restoredFrom, ok := ctx.Value(restoreKey{}).(int64); ok && action != model.RevisionDeleted {
+		revision.Action = model.RevisionRestored
+		revision.RestoredFrom = restoredFrom
+	}
+	if m.history != nil {
+		var err error
+		revision, err = m.history.append(ctx, revision)
+		if err != nil {
+			log.ErrorfCtx(ctx, " M (CatalogVersions): failed to record revision of %s: %v", state.ObjectMeta.Name, err)
+		}
+	}
+	m.Context.Publish(CatalogRevisionTopic, v1alpha2.Event{
+		Metadata: map[string]string{
+			"name":      revision.Name,
+			"namespace": revision.Namespace,
+			"action":    revision.Action,
+			"revision":  fmt.Sprintf("%d", revision.Revision),
+		},
+		Body:    revision,
+		Context: ctx,
+	})
+}
+
+// append numbers a revision after the latest revision in the head of its catalog version, and
+// stores both. Histories written before heads were kept are counted once.
+func (h *catalogHistory) append(ctx context.Context, revision model.CatalogRevision) (model.CatalogRevision, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	metadata := historyMetadata(revision.Namespace)
+	head := model.CatalogRevision{Name: revision.Name, Namespace: revision.Namespace}
+	entry, err := h.state.Get(ctx, states.GetRequest{
+		ID:       revisionHeadId(revision.Name),
+		Metadata: metadata,
+	})
+	switch {
+	case err == nil:
+		if head, err = readRevision(entry.Body); err != nil {
+			return revision, err
+		}
+	case utils.IsNotFound(err):
+		revisions, err := h.list(ctx, revision.Name, revision.Namespace)
+		if err != nil {
+			return revision, err
+		}
+		if len(revisions) > 0 {
+			head.Revision = revisions[len(revisions)-1].Revision
+		}
+	default:
+		return revision, err
+	}
+	revision.Revision = head.Revision + 1
+	head.Revision = revision.Revision
+	// the ETag of the head rejects numbers taken by another replica in the meantime
+	_, err = h.state.Upsert(ctx, states.UpsertRequest{
+		Value:    revisionEntry(revisionHeadId(revision.Name), head, entry.ETag),
+		Metadata: metadata,
+	})
+	if err != nil {
+		return revision, err
+	}
+	_, err = h.state.Upsert(ctx, states.UpsertRequest{
+		Value:    revisionEntry(revisionId(revision.Name, revision.Revision), revision, ""),
+		Metadata: metadata,
+	})
+	return revision, err
+}
+
+func (h *catalogHistory) list(ctx context.Context, name string, namespace string) ([]model.CatalogRevision, error) {
+	entries, _, err := h.state.List(ctx, states.ListRequest{
+		Metadata: historyMetadata(namespace),
+	})
+	if err != nil {
+		if utils.IsNotFound(err) {
+			return []model.CatalogRevision{}, nil
+		}
+		return nil, err
+	}
+	ret := make([]model.CatalogRevision, 0)
+	for _, entry := range entries {
+		if entry.ID == revisionHeadId(name) {
+			continue
+		}
+		revision, err := readRevision(entry.Body)
+		if err != nil {
+			return nil, err
+		}
+		if revision.Name == name && revision.Namespace == namespace {
+			ret = append(ret, revision)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Revision < ret[j].Revision
+	})
+	return ret, nil
+}
+
+func (m *CatalogVersionsManager) checkHistory() error {
+	if m.history == nil {
+		return v1alpha2.NewCOAError(nil, "catalog version history is not enabled, providers.historystate is not configured", v1alpha2.BadRequest)
+	}
+	return nil
+}
+
+// ListRevisions returns the history of a catalog version, from the oldest change
+func (m *CatalogVersionsManager) ListRevisions(ctx context.Context, name string, namespace string) ([]model.CatalogRevision, error) {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "ListRevisions",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = m.checkHistory(); err != nil {
+		return nil, err
+	}
+	var ret []model.CatalogRevision
+	ret, err = m.history.list(ctx, name, defaultNamespace(namespace))
+	return ret, err
+}
+
+// GetRevision returns a revision of a catalog version
+func (m *CatalogVersionsManager) GetRevision(ctx context.Context, name string, namespace string, revision int64) (model.CatalogRevision, error) {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "GetRevision",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = m.checkHistory(); err != nil {
+		return model.CatalogRevision{}, err
+	}
+	var entry states.StateEntry
+	entry, err = m.history.state.Get(ctx, states.GetRequest{
+		ID:       revisionId(name, revision),
+		Metadata: historyMetadata(defaultNamespace(namespace)),
+	})
+	if err != nil {
+		if utils.IsNotFound(err) {
+			err = v1alpha2.NewCOAError(err, fmt.Sprintf("revision %d of catalog version %s is not found", revision, name), v1alpha2.NotFound)
+		}
+		return model.CatalogRevision{}, err
+	}
+	var ret model.CatalogRevision
+	ret, err = readRevision(entry.Body)
+	return ret, err
+}
+
+// DiffRevisions compares the specs of two revisions of a catalog version. Without a revision to
+// compare to, the latest revision is used; without a revision to compare from, the revision
+// before it.
+func (m *CatalogVersionsManager) DiffRevisions(ctx context.Context, name string, namespace string, from int64, to int64) (model.CatalogDiff, error) {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "DiffRevisions",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = m.checkHistory(); err != nil {
+		return model.CatalogDiff{}, err
+	}
+	namespace = defaultNamespace(namespace)
+	var revisions []model.CatalogRevision
+	revisions, err = m.history.list(ctx, name, namespace)
+	if err != nil {
+		return model.CatalogDiff{}, err
+	}
+	if len(revisions) == 0 {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("catalog version %s has no history", name), v1alpha2.NotFound)
+		return model.CatalogDiff{}, err
+	}
+	if to == 0 {
+		to = revisions[len(revisions)-1].Revision
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	specs := make(map[int64]interface{})
+	for _, revision := range revisions {
+		specs[revision.Revision] = specValue(revision)
+	}
+	for _, revision := range []int64{from, to} {
+		if _, ok := specs[revision]; !ok && revision != 0 {
+			err = v1alpha2.NewCOAError(nil, fmt.Sprintf("revision %d of catalog version %s is not found", revision, name), v1alpha2.NotFound)
+			return model.CatalogDiff{}, err
+		}
+	}
+	// revision 0 is before the catalog version was created
+	if specs[0] == nil {
+		specs[0] = map[string]interface{}{}
+	}
+	ret := model.CatalogDiff{
+		Name:    name,
+		From:    from,
+		To:      to,
+		Changes: make([]model.PropertyChange, 0),
+	}
+	diffValues(specs[from], specs[to], "", &ret.Changes)
+	return ret, nil
+}
+
+// RestoreRevision brings a catalog version back to the spec of a revision. A revision that
+// deleted the catalog version restores the spec it had before.
+func (m *CatalogVersionsManager) RestoreRevision(ctx context.Context, name string, namespace string, revision int64) error {
+	ctx, span := observability.StartSpan("CatalogVersions Manager", ctx, &map[string]string{
+		"method": "RestoreRevision",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var target model.CatalogRevision
+	target, err = m.GetRevision(ctx, name, namespace, revision)
+	if err != nil {
+		return err
+	}
+	if target.Spec == nil {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("revision %d of catalog version %s has no spec", revision, name), v1alpha2.BadRequest)
+		return err
+	}
+	state := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      name,
+			Namespace: defaultNamespace(namespace),
+		},
+		Spec: target.Spec,
+	}
+	err = m.UpsertState(context.WithValue(ctx, restoreKey{}, revision), name, state)
+	return err
+}
+
+// specValue returns the spec of a revision as JSON values, a deletion has no spec
+func specValue(revision model.CatalogRevision) interface{} {
+	if revision.Action == model.RevisionDeleted || revision.Spec == nil {
+		return map[string]interface{}{}
+	}
+	var ret interface{}
+	jData, _ := json.Marshal(revision.Spec)
+	_ = json.Unmarshal(jData, &ret)
+	return ret
+}
+
+// diffValues lists the changes from one value to another by JSON pointer. Objects are compared
+// key by key, other values as a whole.
+func diffValues(old interface{}, new interface{}, pointer string, changes *[]model.PropertyChange) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(old, new) {
+			*changes = append(*changes, model.PropertyChange{Property: pointer, Operation: model.ChangeReplaced, Old: old, New: new})
+		}
+		return
+	}
+	keys := make(map[string]interface{})
+	for k := range oldMap {
+		keys[k] = nil
+	}
+	for k := range newMap {
+		keys[k] = nil
+	}
+	for _, key := range sortedKeys(keys) {
+		child := pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+		oldValue, inOld := oldMap[key]
+		newValue, inNew := newMap[key]
+		switch {
+		case !inOld:
+			*changes = append(*changes, model.PropertyChange{Property: child, Operation: model.ChangeAdded, New: newValue})
+		case !inNew:
+			*changes = append(*changes, model.PropertyChange{Property: child, Operation: model.ChangeRemoved, Old: oldValue})
+		default:
+			diffValues(oldValue, newValue, child, changes)
+		}
+	}
+}
+
+func defaultNamespace(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package impact
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+)
+
+var log = logger.NewLogger("coa.runtime")
+
+// ImpactManager answers which Symphony objects depend on an object. It reads the objects from the
+// state store shared with the managers of the objects.
+type ImpactManager struct {
+	managers.Manager
+	StateProvider states.IStateProvider
+}
+
+func (s *ImpactManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
+	err := s.Manager.Init(context, config, providers)
+	if err != nil {
+		return err
+	}
+	stateprovider, err := managers.GetPersistentStateProvider(config, providers)
+	if err == nil {
+		s.StateProvider = stateprovider
+	} else {
+		return err
+	}
+	return nil
+}
+
+// ListObjects lists the objects of a resource type, it's the object list function of dependency graphs
+func (s *ImpactManager) ListObjects(ctx context.Context, resourceType validation.ResourceType, namespace string) ([]interface{}, error) {
+	return states.ListObjectStateWithLabels(ctx, s.StateProvider, resourceType, namespace, nil, 0)
+}
+
+// GetGraph returns the dependencies of all objects of a namespace
+func (s *ImpactManager) GetGraph(ctx context.Context, namespace string) ([]model.Dependency, error) {
+	ctx, span := observability.StartSpan("Impact Manager", ctx, &map[string]string{
+		"method": "GetGraph",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var graph *validation.DependencyGraph
+	graph, err = validation.BuildDependencyGraph(ctx, s.ListObjects, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return graph.Dependencies, nil
+}
+
+// GetImpact returns the objects affected by changing or deleting an object
+func (s *ImpactManager) GetImpact(ctx context.Context, kind string, name string, namespace string) (model.ImpactReport, error) {
+	ctx, span := observability.StartSpan("Impact Manager", ctx, &map[string]string{
+		"method": "GetImpact",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var graph *validation.DependencyGraph
+	var key model.ObjectKey
+	graph, key, err = s.graphOf(ctx, kind, name, namespace)
+	if err != nil {
+		return model.ImpactReport{}, err
+	}
+	report := graph.Impact(key)
+	log.DebugfCtx(ctx, " M (Impact): %d objects depend on %s %s", len(report.Affected), kind, name)
+	return report, nil
+}
+
+// GetDependencies returns the objects an object depends on directly
+func (s *ImpactManager) GetDependencies(ctx context.Context, kind string, name string, namespace string) ([]model.Dependency, error) {
+	ctx, span := observability.StartSpan("Impact Manager", ctx, &map[string]string{
+		"method": "GetDependencies",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var graph *validation.DependencyGraph
+	var key model.ObjectKey
+	graph, key, err = s.graphOf(ctx, kind, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return graph.DependenciesOf(key), nil
+}
+
+// graphOf builds the dependency graph of the namespace of an object and returns the key of the
+// object, the object must exist
+func (s *ImpactManager) graphOf(ctx context.Context, kind string, name string, namespace string) (*validation.DependencyGraph, model.ObjectKey, error) {
+	if _, _, _, k := validation.GetResourceMetadata(validation.ResourceType(kind)); k == "" {
+		return nil, model.ObjectKey{}, v1alpha2.NewCOAError(nil, fmt.Sprintf("unsupported object kind: %s", kind), v1alpha2.BadRequest)
+	}
+	graph, err := validation.BuildDependencyGraph(ctx, s.ListObjects, namespace)
+	if err != nil {
+		return nil, model.ObjectKey{}, err
+	}
+	key := model.ObjectKey{Kind: kind, Name: validation.ConvertReferenceToObjectName(name), Namespace: graph.Namespace}
+	if !graph.Exists(key) {
+		return nil, key, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s '%s' is not found in namespace %s", kind, key.Name, graph.Namespace), v1alpha2.NotFound)
+	}
+	return graph, key, nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package impact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/stretchr/testify/assert"
+)
+
+func initializeManager(t *testing.T) *ImpactManager {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	err := stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	assert.Nil(t, err)
+	manager := &ImpactManager{}
+	err = manager.Init(&contexts.VendorContext{}, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "StateProvider",
+		},
+	}, map[string]providers.IProvider{"StateProvider": stateProvider})
+	assert.Nil(t, err)
+	return manager
+}
+
+func upsertObject(t *testing.T, manager *ImpactManager, kind string, name string, spec map[string]interface{}) {
+	_, err := manager.StateProvider.Upsert(context.Background(), states.UpsertRequest{
+		Value: states.StateEntry{
+			ID: name,
+			Body: map[string]interface{}{
+				"kind": kind,
+				"metadata": map[string]interface{}{
+					"name":      name,
+					"namespace": "default",
+				},
+				"spec": spec,
+			},
+		},
+		Metadata: map[string]interface{}{
+			"namespace": "default",
+		},
+	})
+	assert.Nil(t, err)
+}
+
+// seedObjects writes a catalog with two versions, a solution version reading the base version
+// with $config(), and instances deploying the solution version to targets by name and selector
+func seedObjects(t *testing.T, manager *ImpactManager) {
+	upsertObject(t, manager, "Catalog", "base", map[string]interface{}{})
+	upsertObject(t, manager, "CatalogVersion", "base-v-v1", map[string]interface{}{
+		"rootResource": "base",
+		"properties":   map[string]interface{}{"x": "1"},
+	})
+	upsertObject(t, manager, "CatalogVersion", "site-v-v1", map[string]interface{}{
+		"rootResource": "site",
+		"parentName":   "base:v1",
+	})
+	upsertObject(t, manager, "SolutionVersion", "app-v-v1", map[string]interface{}{
+		"rootResource": "app",
+		"components": []interface{}{
+			map[string]interface{}{
+				"name": "web",
+				"properties": map[string]interface{}{
+					"x": "${{$config('base:v1', 'x')}}",
+				},
+			},
+		},
+	})
+	upsertObject(t, manager, "Target", "edge", map[string]interface{}{
+		"properties": map[string]interface{}{"group": "edge"},
+	})
+	upsertObject(t, manager, "Target", "cloud", map[string]interface{}{})
+	upsertObject(t, manager, "Instance", "app-edge", map[string]interface{}{
+		"solutionversion": "app:v1",
+		"target": map[string]interface{}{
+			"selector": map[string]interface{}{"group": "edge"},
+		},
+	})
+	upsertObject(t, manager, "Instance", "app-cloud", map[string]interface{}{
+		"solutionversion": "app:v1",
+		"target": map[string]interface{}{
+			"name": "cloud",
+		},
+	})
+	upsertObject(t, manager, "Activation", "rollout", map[string]interface{}{
+		"campaignversion": "rollout:v1",
+	})
+}
+
+func key(kind validation.ResourceType, name string) model.ObjectKey {
+	return model.ObjectKey{Kind: string(kind), Name: name, Namespace: "default"}
+}
+
+func TestGetImpact(t *testing.T) {
+	manager := initializeManager(t)
+	seedObjects(t, manager)
+
+	report, err := manager.GetImpact(context.Background(), string(validation.CatalogVersion), "base:v1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, key(validation.CatalogVersion, "base-v-v1"), report.Object)
+	assert.Equal(t, []model.ImpactedObject{
+		{ObjectKey: key(validation.CatalogVersion, "site-v-v1"), Relation: model.RelationParent, Via: key(validation.CatalogVersion, "base-v-v1"), Depth: 1},
+		{ObjectKey: key(validation.SolutionVersion, "app-v-v1"), Relation: model.RelationConfig, Via: key(validation.CatalogVersion, "base-v-v1"), Depth: 1},
+		{ObjectKey: key(validation.Instance, "app-cloud"), Relation: model.RelationSolutionVersion, Via: key(validation.SolutionVersion, "app-v-v1"), Depth: 2},
+		{ObjectKey: key(validation.Instance, "app-edge"), Relation: model.RelationSolutionVersion, Via: key(validation.SolutionVersion, "app-v-v1"), Depth: 2},
+	}, report.Affected)
+
+	report, err = manager.GetImpact(context.Background(), string(validation.Target), "edge", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ImpactedObject{
+		{ObjectKey: key(validation.Instance, "app-edge"), Relation: model.RelationTarget, Via: key(validation.Target, "edge"), Depth: 1},
+	}, report.Affected)
+
+	report, err = manager.GetImpact(context.Background(), string(validation.Catalog), "base", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(report.Affected))
+	assert.Equal(t, key(validation.CatalogVersion, "base-v-v1"), report.Affected[0].ObjectKey)
+	assert.Equal(t, model.RelationContainer, report.Affected[0].Relation)
+
+	report, err = manager.GetImpact(context.Background(), string(validation.Instance), "app-edge", "default")
+	assert.Nil(t, err)
+	assert.Empty(t, report.Affected)
+}
+
+func TestGetImpactErrors(t *testing.T) {
+	manager := initializeManager(t)
+	seedObjects(t, manager)
+
+	_, err := manager.GetImpact(context.Background(), string(validation.Target), "missing", "default")
+	assert.Equal(t, v1alpha2.NotFound, v1alpha2.GetErrorState(err))
+
+	_, err = manager.GetImpact(context.Background(), "widget", "base", "default")
+	assert.Equal(t, v1alpha2.BadRequest, v1alpha2.GetErrorState(err))
+
+	_, err = manager.GetImpact(context.Background(), string(validation.Target), "edge", "other")
+	assert.Equal(t, v1alpha2.NotFound, v1alpha2.GetErrorState(err))
+}
+
+func TestGetDependencies(t *testing.T) {
+	manager := initializeManager(t)
+	seedObjects(t, manager)
+
+	dependencies, err := manager.GetDependencies(context.Background(), string(validation.Instance), "app-edge", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Dependency{
+		{From: key(validation.Instance, "app-edge"), To: key(validation.SolutionVersion, "app-v-v1"), Relation: model.RelationSolutionVersion},
+		{From: key(validation.Instance, "app-edge"), To: key(validation.Target, "edge"), Relation: model.RelationTarget},
+	}, dependencies)
+
+	// references to missing objects are reported
+	dependencies, err = manager.GetDependencies(context.Background(), string(validation.Activation), "rollout", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []model.Dependency{
+		{From: key(validation.Activation, "rollout"), To: key(validation.CampaignVersion, "rollout-v-v1"), Relation: model.RelationCampaignVersion},
+	}, dependencies)
+}
+
+func TestGetGraph(t *testing.T) {
+	manager := initializeManager(t)
+	seedObjects(t, manager)
+
+	graph, err := manager.GetGraph(context.Background(), "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(graph))
+
+	graph, err = manager.GetGraph(context.Background(), "other")
+	assert.Nil(t, err)
+	assert.Empty(t, graph)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/catalogversions"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/configs"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/devices"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/impact"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/instances"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/jobs"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/models"
@@ -28,6 +29,7 @@ import (
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/target"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/targets"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/trails"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/triggers"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/users"
 	cm "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	"github.com/stretchr/testify/assert"
@@ -65,6 +67,8 @@ func TestCreateManager(t *testing.T) {
 	testCreateManager[*models.ModelsManager](t, getModelsManagerConfig())
 	testCreateManager[*skills.SkillsManager](t, getSkillsManagerConfig())
 	testCreateManager[*trails.TrailsManager](t, getTrailsManagerConfig())
+	testCreateManager[*triggers.ActivationTriggersManager](t, getTriggersManagerConfig())
+	testCreateManager[*impact.ImpactManager](t, getImpactManagerConfig())
 }
 
 func getSolutionVersionManagerConfig() cm.ManagerConfig {
@@ -448,3 +452,34 @@ func getTrailsManagerConfig() cm.ManagerConfig {
 		},
 	}
 }
+
+func getTriggersManagerConfig() cm.ManagerConfig {
+	// symphony-api-no-k8s.json
+	return cm.ManagerConfig{
+		Type: "managers.symphony.triggers",
+		Properties: map[string]string{
+			"providers.persistentstate": "mem-state",
+			"providers.volatilestate":   "mem-state",
+		},
+		Providers: map[string]cm.ProviderConfig{
+			"mem-state": {
+				Type: "providers.state.memory",
+			},
+		},
+	}
+}
+
+func getImpactManagerConfig() cm.ManagerConfig {
+	// symphony-api-no-k8s.json
+	return cm.ManagerConfig{
+		Type: "managers.symphony.impact",
+		Properties: map[string]string{
+			"providers.persistentstate": "mem-state",
+		},
+		Providers: map[string]cm.ProviderConfig{
+			"mem-state": {
+				Type: "providers.state.memory",
+			},
+		},
+	}
+}
@@ -0,0 +1,522 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sites
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+)
+
+const (
+	defaultCertValidity = 90 * 24 * time.Hour
+	// maxSignatureAge is how far the time of a signed request may be off
+	maxSignatureAge = 5 * time.Minute
+)
+
+// SiteCredentials are what a federation request presents to authenticate its site
+type SiteCredentials struct {
+	Method string
+	Path   string
+	// Query is the raw query string of the request
+	Query string
+	Body  []byte
+	// Site, Timestamp, Nonce and Signature come from the site authentication headers
+	Site      string
+	Timestamp string
+	Nonce     string
+	Signature string
+	// PeerCertificates is the certificate chain the client presented over TLS
+	PeerCertificates []*x509.Certificate
+}
+
+func (s *SitesManager) initEnrollment(config managers.ManagerConfig, providers map[string]providers.IProvider) error {
+	var err error
+	if name := config.Properties["providers.certs"]; name != "" {
+		provider, ok := providers[name]
+		if !ok {
+			return v1alpha2.NewCOAError(nil, "certs provider is not supplied", v1alpha2.MissingConfig)
+		}
+		s.CertIssuer, ok = provider.(certs.ICertIssuer)
+		if !ok {
+			return v1alpha2.NewCOAError(nil, "supplied provider can't issue certificates", v1alpha2.BadConfig)
+		}
+		// enrollments are kept apart from the sites, as not all state providers separate resources
+		name = config.Properties["providers.enrollmentstate"]
+		if name == "" {
+			return v1alpha2.NewCOAError(nil, "providers.enrollmentstate is required to enroll sites", v1alpha2.MissingConfig)
+		}
+		provider, ok = providers[name]
+		if !ok {
+			return v1alpha2.NewCOAError(nil, "enrollment state provider is not supplied", v1alpha2.MissingConfig)
+		}
+		s.EnrollmentStateProvider, ok = provider.(states.IStateProvider)
+		if !ok {
+			return v1alpha2.NewCOAError(nil, "supplied provider is not a state provider", v1alpha2.BadConfig)
+		}
+	}
+	s.certValidity = defaultCertValidity
+	if v := config.Properties["enrollment.certValidity"]; v != "" {
+		s.certValidity, err = time.ParseDuration(v)
+		if err != nil || s.certValidity <= 0 {
+			return v1alpha2.NewCOAError(err, "invalid enrollment.certValidity: "+v, v1alpha2.BadConfig)
+		}
+	}
+	s.requireSiteAuth = config.Properties["enrollment.required"] == "true"
+	if s.requireSiteAuth && s.CertIssuer == nil {
+		return v1alpha2.NewCOAError(nil, "enrollment.required needs a certs provider", v1alpha2.MissingConfig)
+	}
+	return nil
+}
+
+// SiteAuthRequired reports whether child sites must authenticate with an enrolled certificate
+func (s *SitesManager) SiteAuthRequired() bool {
+	return s.requireSiteAuth
+}
+
+func enrollmentMetadata() map[string]interface{} {
+	return map[string]interface{}{
+		"version":  "v1",
+		"group":    model.FederationGroup,
+		"resource": "siteenrollments",
+	}
+}
+
+func toSiteEnrollment(body interface{}) (model.SiteEnrollment, error) {
+	var enrollment model.SiteEnrollment
+	data, _ := json.Marshal(body)
+	err := json.Unmarshal(data, &enrollment)
+	return enrollment, err
+}
+
+func (s *SitesManager) enrollmentConfigured() error {
+	if s.CertIssuer == nil || s.EnrollmentStateProvider == nil {
+		return v1alpha2.NewCOAError(nil, "site enrollment isn't configured", v1alpha2.MissingConfig)
+	}
+	return nil
+}
+
+// GetEnrollment returns the enrollment of a site
+func (s *SitesManager) GetEnrollment(ctx context.Context, site string) (model.SiteEnrollment, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "GetEnrollment",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = s.enrollmentConfigured(); err != nil {
+		return model.SiteEnrollment{}, err
+	}
+
+	var entry states.StateEntry
+	entry, err = s.EnrollmentStateProvider.Get(ctx, states.GetRequest{
+		ID:       site,
+		Metadata: enrollmentMetadata(),
+	})
+	if err != nil {
+		return model.SiteEnrollment{}, err
+	}
+	var enrollment model.SiteEnrollment
+	enrollment, err = toSiteEnrollment(entry.Body)
+	return enrollment, err
+}
+
+// ListEnrollments returns the enrollments of all sites
+func (s *SitesManager) ListEnrollments(ctx context.Context) ([]model.SiteEnrollment, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "ListEnrollments",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = s.enrollmentConfigured(); err != nil {
+		return nil, err
+	}
+
+	var entries []states.StateEntry
+	entries, _, err = s.EnrollmentStateProvider.List(ctx, states.ListRequest{
+		Metadata: enrollmentMetadata(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]model.SiteEnrollment, 0, len(entries))
+	for _, entry := range entries {
+		var enrollment model.SiteEnrollment
+		enrollment, err = toSiteEnrollment(entry.Body)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, enrollment)
+	}
+	return ret, nil
+}
+
+func (s *SitesManager) saveEnrollment(ctx context.Context, enrollment model.SiteEnrollment) error {
+	_, err := s.EnrollmentStateProvider.Upsert(ctx, states.UpsertRequest{
+		Value: states.StateEntry{
+			ID:   enrollment.Site,
+			Body: enrollment,
+		},
+		Metadata: enrollmentMetadata(),
+	})
+	return err
+}
+
+// RequestEnrollment records the certificate signing request of a site. A new enrollment waits
+// for approval, unless the site was registered with the fingerprint of the requested key. An
+// enrolled site renews its certificate with a request authenticated by its current
+// certificate, which is approved right away.
+func (s *SitesManager) RequestEnrollment(ctx context.Context, request model.SiteEnrollmentRequest, authenticated bool) (model.SiteEnrollment, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "RequestEnrollment",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = s.enrollmentConfigured(); err != nil {
+		return model.SiteEnrollment{}, err
+	}
+
+	var csr *x509.CertificateRequest
+	csr, err = parseCSR(request.CSR)
+	if err != nil {
+		return model.SiteEnrollment{}, err
+	}
+	if request.Site == "" || csr.Subject.CommonName != request.Site {
+		err = v1alpha2.NewCOAError(nil, "certificate signing request must be for site "+request.Site, v1alpha2.BadRequest)
+		return model.SiteEnrollment{}, err
+	}
+
+	enrollment, getErr := s.GetEnrollment(ctx, request.Site)
+	if getErr != nil && !utils.IsNotFound(getErr) {
+		err = getErr
+		return model.SiteEnrollment{}, err
+	}
+	switch enrollment.State {
+	case model.SiteEnrollmentRevoked:
+		err = v1alpha2.NewCOAError(nil, "site "+request.Site+" is revoked", v1alpha2.Forbidden)
+		return model.SiteEnrollment{}, err
+	case model.SiteEnrollmentApproved:
+		if !authenticated {
+			err = v1alpha2.NewCOAError(nil, "site "+request.Site+" is enrolled, renewals must be signed with its certificate", v1alpha2.Unauthorized)
+			return model.SiteEnrollment{}, err
+		}
+	}
+
+	var fingerprint string
+	fingerprint, err = PublicKeyFingerprint(csr.PublicKey)
+	if err != nil {
+		err = v1alpha2.NewCOAError(err, "unsupported public key", v1alpha2.BadRequest)
+		return model.SiteEnrollment{}, err
+	}
+	enrollment = model.SiteEnrollment{
+		Site:        request.Site,
+		State:       model.SiteEnrollmentPending,
+		CSR:         request.CSR,
+		Fingerprint: fingerprint,
+		RequestedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if authenticated || s.preRegistered(ctx, request.Site, fingerprint) {
+		enrollment, err = s.issue(ctx, enrollment)
+		return enrollment, err
+	}
+	log.InfofCtx(ctx, " M (Sites): site %s requested enrollment", request.Site)
+	err = s.saveEnrollment(ctx, enrollment)
+	return enrollment, err
+}
+
+// preRegistered reports whether the site was registered with the fingerprint of the key it
+// requests a certificate for
+func (s *SitesManager) preRegistered(ctx context.Context, site string, fingerprint string) bool {
+	state, err := s.GetState(ctx, site)
+	if err != nil || state.Spec == nil || state.Spec.PublicKey == "" {
+		return false
+	}
+	return strings.EqualFold(fingerprint, state.Spec.PublicKey)
+}
+
+// ApproveEnrollment issues the certificate of a pending enrollment. If a fingerprint is given,
+// the enrollment is only approved if it's for the key with that fingerprint, so a request
+// replaced after it was reviewed isn't approved.
+func (s *SitesManager) ApproveEnrollment(ctx context.Context, site string, fingerprint string) (model.SiteEnrollment, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "ApproveEnrollment",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var enrollment model.SiteEnrollment
+	enrollment, err = s.GetEnrollment(ctx, site)
+	if err != nil {
+		return model.SiteEnrollment{}, err
+	}
+	if enrollment.State != model.SiteEnrollmentPending {
+		err = v1alpha2.NewCOAError(nil, "enrollment of site "+site+" is "+enrollment.State+", not pending", v1alpha2.BadRequest)
+		return model.SiteEnrollment{}, err
+	}
+	if fingerprint != "" && !strings.EqualFold(fingerprint, enrollment.Fingerprint) {
+		err = v1alpha2.NewCOAError(nil, "enrollment of site "+site+" is for a different key", v1alpha2.BadRequest)
+		return model.SiteEnrollment{}, err
+	}
+	enrollment, err = s.issue(ctx, enrollment)
+	return enrollment, err
+}
+
+func (s *SitesManager) issue(ctx context.Context, enrollment model.SiteEnrollment) (model.SiteEnrollment, error) {
+	certPEM, err := s.CertIssuer.IssueCert([]byte(enrollment.CSR), s.certValidity)
+	if err != nil {
+		return enrollment, err
+	}
+	caPEM, err := s.CertIssuer.GetCACert()
+	if err != nil {
+		return enrollment, err
+	}
+	cert, err := parseCert(string(certPEM))
+	if err != nil {
+		return enrollment, err
+	}
+	enrollment.State = model.SiteEnrollmentApproved
+	enrollment.Certificate = string(certPEM)
+	enrollment.CACertificate = string(caPEM)
+	enrollment.SerialNumber = cert.SerialNumber.String()
+	enrollment.NotAfter = cert.NotAfter.UTC().Format(time.RFC3339)
+	enrollment.ApprovedAt = time.Now().UTC().Format(time.RFC3339)
+	enrollment.RevokedAt = ""
+	log.InfofCtx(ctx, " M (Sites): issued certificate %s to site %s", enrollment.SerialNumber, enrollment.Site)
+	return enrollment, s.saveEnrollment(ctx, enrollment)
+}
+
+// RevokeEnrollment stops accepting the certificate of a site. A revoked site can't enroll
+// again until its enrollment is deleted.
+func (s *SitesManager) RevokeEnrollment(ctx context.Context, site string) (model.SiteEnrollment, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "RevokeEnrollment",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var enrollment model.SiteEnrollment
+	enrollment, err = s.GetEnrollment(ctx, site)
+	if err != nil {
+		return model.SiteEnrollment{}, err
+	}
+	enrollment.State = model.SiteEnrollmentRevoked
+	enrollment.RevokedAt = time.Now().UTC().Format(time.RFC3339)
+	log.InfofCtx(ctx, " M (Sites): revoked site %s", site)
+	err = s.saveEnrollment(ctx, enrollment)
+	return enrollment, err
+}
+
+// DeleteEnrollment removes the enrollment of a site, so it can enroll again
+func (s *SitesManager) DeleteEnrollment(ctx context.Context, site string) error {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "DeleteEnrollment",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if err = s.enrollmentConfigured(); err != nil {
+		return err
+	}
+
+	err = s.EnrollmentStateProvider.Delete(ctx, states.DeleteRequest{
+		ID:       site,
+		Metadata: enrollmentMetadata(),
+	})
+	return err
+}
+
+// AuthenticateSite verifies the site credentials of a request, either a client certificate
+// or a request signature, against the site's enrollment. It returns the authenticated site,
+// or an empty string if the request doesn't carry site credentials.
+func (s *SitesManager) AuthenticateSite(ctx context.Context, credentials SiteCredentials) (string, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "AuthenticateSite",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	if len(credentials.PeerCertificates) == 0 && credentials.Signature == "" && credentials.Site == "" {
+		return "", nil
+	}
+	if err = s.enrollmentConfigured(); err != nil {
+		return "", err
+	}
+	site := ""
+	if len(credentials.PeerCertificates) > 0 {
+		site, err = s.verifyClientCert(ctx, credentials.PeerCertificates)
+		if err != nil {
+			return "", err
+		}
+	}
+	if credentials.Signature != "" || credentials.Site != "" {
+		if site != "" && site != credentials.Site {
+			err = v1alpha2.NewCOAError(nil, "client certificate and signature are of different sites", v1alpha2.Unauthorized)
+			return "", err
+		}
+		err = s.verifySignature(ctx, credentials)
+		if err != nil {
+			return "", err
+		}
+		site = credentials.Site
+	}
+	return site, nil
+}
+
+func (s *SitesManager) approvedEnrollment(ctx context.Context, site string) (model.SiteEnrollment, *x509.Certificate, error) {
+	enrollment, err := s.GetEnrollment(ctx, site)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			return enrollment, nil, v1alpha2.NewCOAError(nil, "site "+site+" is not enrolled", v1alpha2.Unauthorized)
+		}
+		return enrollment, nil, err
+	}
+	if enrollment.State != model.SiteEnrollmentApproved {
+		return enrollment, nil, v1alpha2.NewCOAError(nil, "enrollment of site "+site+" is "+enrollment.State, v1alpha2.Unauthorized)
+	}
+	cert, err := parseCert(enrollment.Certificate)
+	if err != nil {
+		return enrollment, nil, err
+	}
+	if time.Now().After(cert.NotAfter) {
+		return enrollment, nil, v1alpha2.NewCOAError(nil, "certificate of site "+site+" has expired", v1alpha2.Unauthorized)
+	}
+	return enrollment, cert, nil
+}
+
+func (s *SitesManager) verifyClientCert(ctx context.Context, chain []*x509.Certificate) (string, error) {
+	leaf := chain[0]
+	site := leaf.Subject.CommonName
+	_, cert, err := s.approvedEnrollment(ctx, site)
+	if err != nil {
+		return "", err
+	}
+	// only the current certificate of the site is accepted, which rules out rotated ones
+	if leaf.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return "", v1alpha2.NewCOAError(nil, "client certificate is not the current certificate of site "+site, v1alpha2.Unauthorized)
+	}
+	caPEM, err := s.CertIssuer.GetCACert()
+	if err != nil {
+		return "", err
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return "", v1alpha2.NewCOAError(err, "client certificate of site "+site+" is not valid", v1alpha2.Unauthorized)
+	}
+	return site, nil
+}
+
+func (s *SitesManager) verifySignature(ctx context.Context, credentials SiteCredentials) error {
+	if credentials.Site == "" || credentials.Timestamp == "" || credentials.Nonce == "" || credentials.Signature == "" {
+		return v1alpha2.NewCOAError(nil, "signed requests need the site, timestamp, nonce and signature headers", v1alpha2.Unauthorized)
+	}
+	signedAt, err := time.Parse(time.RFC3339, credentials.Timestamp)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "invalid site timestamp: "+credentials.Timestamp, v1alpha2.Unauthorized)
+	}
+	if age := time.Since(signedAt); age > maxSignatureAge || age < -maxSignatureAge {
+		return v1alpha2.NewCOAError(nil, "site signature has expired", v1alpha2.Unauthorized)
+	}
+	_, cert, err := s.approvedEnrollment(ctx, credentials.Site)
+	if err != nil {
+		return err
+	}
+	err = utils.VerifySiteSignature(cert, credentials.Method, credentials.Path, credentials.Query, credentials.Timestamp, credentials.Nonce, credentials.Body, credentials.Signature)
+	if err != nil {
+		return err
+	}
+	return s.useNonce(credentials.Site, credentials.Nonce, signedAt.Add(maxSignatureAge))
+}
+
+// useNonce records the nonce of a signed request until its signature expires, and rejects
+// requests that reuse a recorded nonce. Nonces are kept in memory, so each replica of the
+// API tracks the requests it received.
+func (s *SitesManager) useNonce(site string, nonce string, expires time.Time) error {
+	s.nonceLock.Lock()
+	defer s.nonceLock.Unlock()
+	now := time.Now()
+	if s.nonces == nil {
+		s.nonces = make(map[string]time.Time)
+	}
+	for key, expiry := range s.nonces {
+		if now.After(expiry) {
+			delete(s.nonces, key)
+		}
+	}
+	key := site + "/" + nonce
+	if _, ok := s.nonces[key]; ok {
+		return v1alpha2.NewCOAError(nil, "signed request of site "+site+" was replayed", v1alpha2.Unauthorized)
+	}
+	s.nonces[key] = expires
+	return nil
+}
+
+// PublicKeyFingerprint returns the hex encoded SHA-256 hash of a public key, which is what
+// SiteSpec.PublicKey holds to pre-register the key of a site
+func PublicKeyFingerprint(key interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func parseCSR(csrPEM string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, v1alpha2.NewCOAError(nil, "certificate signing request is not PEM encoded", v1alpha2.BadRequest)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to parse certificate signing request", v1alpha2.BadRequest)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, v1alpha2.NewCOAError(err, "certificate signing request has an invalid signature", v1alpha2.BadRequest)
+	}
+	return csr, nil
+}
+
+func parseCert(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, v1alpha2.NewCOAError(nil, "certificate is not PEM encoded", v1alpha2.InternalError)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to parse certificate", v1alpha2.InternalError)
+	}
+	return cert, nil
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sites
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEnrollmentManager(t *testing.T) *SitesManager {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	enrollmentProvider := &memorystate.MemoryStateProvider{}
+	enrollmentProvider.Init(memorystate.MemoryStateProviderConfig{})
+	issuer := &ca.CACertProvider{}
+	err := issuer.Init(ca.CACertProviderConfig{Name: "ca"})
+	assert.Nil(t, err)
+	return &SitesManager{
+		StateProvider:           stateProvider,
+		CertIssuer:              issuer,
+		EnrollmentStateProvider: enrollmentProvider,
+		certValidity:            time.Hour,
+	}
+}
+
+func newEnrollmentRequest(t *testing.T, site string) (model.SiteEnrollmentRequest, []byte) {
+	keyPEM, err := utils.GenerateSiteKey()
+	assert.Nil(t, err)
+	csr, err := utils.CreateSiteCSR(site, keyPEM)
+	assert.Nil(t, err)
+	return model.SiteEnrollmentRequest{Site: site, CSR: string(csr)}, keyPEM
+}
+
+func signedCredentials(t *testing.T, enrollment model.SiteEnrollment, keyPEM []byte, body []byte) SiteCredentials {
+	identity := &utils.SiteIdentity{}
+	err := identity.Load(enrollment.Site, keyPEM, []byte(enrollment.Certificate))
+	assert.Nil(t, err)
+	req, _ := http.NewRequest(http.MethodGet, "http://parent/v1alpha2/federation/sync/"+enrollment.Site+"?count=10", nil)
+	err = identity.Sign(req, body, time.Now())
+	assert.Nil(t, err)
+	return SiteCredentials{
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Query:     req.URL.RawQuery,
+		Body:      body,
+		Site:      req.Header.Get(v1alpha2.SiteIdHeader),
+		Timestamp: req.Header.Get(v1alpha2.SiteTimestampHeader),
+		Nonce:     req.Header.Get(v1alpha2.SiteNonceHeader),
+		Signature: req.Header.Get(v1alpha2.SiteSignatureHeader),
+	}
+}
+
+func TestEnrollmentApproval(t *testing.T) {
+	manager := newEnrollmentManager(t)
+	ctx := context.Background()
+	request, keyPEM := newEnrollmentRequest(t, "site1")
+
+	enrollment, err := manager.RequestEnrollment(ctx, request, false)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentPending, enrollment.State)
+	assert.Equal(t, "", enrollment.Certificate)
+
+	// approval is refused if the enrollment isn't for the reviewed key
+	_, err = manager.ApproveEnrollment(ctx, "site1", "0000")
+	assert.Equal(t, v1alpha2.BadRequest, err.(v1alpha2.COAError).State)
+
+	enrollment, err = manager.ApproveEnrollment(ctx, "site1", enrollment.Fingerprint)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentApproved, enrollment.State)
+	assert.NotEqual(t, "", enrollment.SerialNumber)
+
+	// the issued certificate authenticates signed requests of the site
+	credentials := signedCredentials(t, enrollment, keyPEM, []byte("{}"))
+	site, err := manager.AuthenticateSite(ctx, credentials)
+	assert.Nil(t, err)
+	assert.Equal(t, "site1", site)
+
+	// a replayed request is rejected
+	_, err = manager.AuthenticateSite(ctx, credentials)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	assert.Contains(t, err.Error(), "replayed")
+
+	// a tampered body doesn't verify
+	credentials = signedCredentials(t, enrollment, keyPEM, []byte("{}"))
+	credentials.Body = []byte("{\"x\":1}")
+	_, err = manager.AuthenticateSite(ctx, credentials)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+
+	// requests without site credentials aren't authenticated as any site
+	site, err = manager.AuthenticateSite(ctx, SiteCredentials{Method: http.MethodGet, Path: "/"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", site)
+}
+
+func TestEnrollmentRenewal(t *testing.T) {
+	manager := newEnrollmentManager(t)
+	ctx := context.Background()
+	request, _ := newEnrollmentRequest(t, "site1")
+	_, err := manager.RequestEnrollment(ctx, request, false)
+	assert.Nil(t, err)
+	enrollment, err := manager.ApproveEnrollment(ctx, "site1", "")
+	assert.Nil(t, err)
+
+	// an enrolled site can't be taken over with an unauthenticated request
+	renewal, newKeyPEM := newEnrollmentRequest(t, "site1")
+	_, err = manager.RequestEnrollment(ctx, renewal, false)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+
+	renewed, err := manager.RequestEnrollment(ctx, renewal, true)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentApproved, renewed.State)
+	assert.NotEqual(t, enrollment.SerialNumber, renewed.SerialNumber)
+
+	// the rotated certificate is no longer accepted over TLS
+	_, err = manager.AuthenticateSite(ctx, SiteCredentials{PeerCertificates: []*x509.Certificate{parseTestCert(t, enrollment.Certificate)}})
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	site, err := manager.AuthenticateSite(ctx, SiteCredentials{PeerCertificates: []*x509.Certificate{parseTestCert(t, renewed.Certificate)}})
+	assert.Nil(t, err)
+	assert.Equal(t, "site1", site)
+
+	site, err = manager.AuthenticateSite(ctx, signedCredentials(t, renewed, newKeyPEM, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "site1", site)
+}
+
+func TestEnrollmentRevocation(t *testing.T) {
+	manager := newEnrollmentManager(t)
+	ctx := context.Background()
+	request, keyPEM := newEnrollmentRequest(t, "site1")
+	_, err := manager.RequestEnrollment(ctx, request, false)
+	assert.Nil(t, err)
+	enrollment, err := manager.ApproveEnrollment(ctx, "site1", "")
+	assert.Nil(t, err)
+	credentials := signedCredentials(t, enrollment, keyPEM, nil)
+
+	_, err = manager.RevokeEnrollment(ctx, "site1")
+	assert.Nil(t, err)
+	_, err = manager.AuthenticateSite(ctx, credentials)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	_, err = manager.RequestEnrollment(ctx, request, true)
+	assert.Equal(t, v1alpha2.Forbidden, err.(v1alpha2.COAError).State)
+
+	// once the enrollment is deleted, the site can enroll again
+	err = manager.DeleteEnrollment(ctx, "site1")
+	assert.Nil(t, err)
+	enrollment, err = manager.RequestEnrollment(ctx, request, false)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentPending, enrollment.State)
+}
+
+func TestEnrollmentPreRegistered(t *testing.T) {
+	manager := newEnrollmentManager(t)
+	ctx := context.Background()
+	request, _ := newEnrollmentRequest(t, "site1")
+	csr, err := parseCSR(request.CSR)
+	assert.Nil(t, err)
+	fingerprint, err := PublicKeyFingerprint(csr.PublicKey)
+	assert.Nil(t, err)
+	err = manager.UpsertState(ctx, "site1", model.SiteState{Id: "site1", Spec: &model.SiteSpec{Name: "site1", PublicKey: fingerprint}})
+	assert.Nil(t, err)
+
+	enrollment, err := manager.RequestEnrollment(ctx, request, false)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentApproved, enrollment.State)
+	state, err := manager.GetState(ctx, "site1")
+	assert.Nil(t, err)
+	assert.Equal(t, fingerprint, state.Spec.PublicKey)
+
+	// a key other than the registered one waits for approval
+	other, _ := newEnrollmentRequest(t, "site2")
+	err = manager.UpsertState(ctx, "site2", model.SiteState{Id: "site2", Spec: &model.SiteSpec{Name: "site2", PublicKey: fingerprint}})
+	assert.Nil(t, err)
+	enrollment, err = manager.RequestEnrollment(ctx, other, false)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentPending, enrollment.State)
+
+	// the request must be for the site it enrolls
+	request.Site = "site3"
+	_, err = manager.RequestEnrollment(ctx, request, false)
+	assert.Equal(t, v1alpha2.BadRequest, err.(v1alpha2.COAError).State)
+}
+
+func parseTestCert(t *testing.T, certPEM string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(certPEM))
+	assert.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+	return cert
+}
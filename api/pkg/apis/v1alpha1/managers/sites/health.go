@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sites
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+)
+
+const (
+	// SiteHealthTopic is published when a site changes its health
+	SiteHealthTopic = "site-health"
+
+	defaultHeartbeatInterval = time.Minute
+	defaultDegradedAfter     = 2
+	defaultOfflineAfter      = 5
+)
+
+// heartbeat is how often a site is expected to report, and what happens when it doesn't
+type heartbeat struct {
+	Interval      time.Duration
+	DegradedAfter int
+	OfflineAfter  int
+	OfflineJobs   string
+}
+
+func readHeartbeat(properties map[string]string) (heartbeat, error) {
+	ret := heartbeat{
+		Interval:      defaultHeartbeatInterval,
+		DegradedAfter: defaultDegradedAfter,
+		OfflineAfter:  defaultOfflineAfter,
+		OfflineJobs:   model.OfflineJobsHold,
+	}
+	spec := model.SiteHeartbeatSpec{
+		Interval:    properties["health.interval"],
+		OfflineJobs: properties["health.offlineJobs"],
+	}
+	for key, value := range map[string]*int{
+		"health.degradedAfter": &spec.DegradedAfter,
+		"health.offlineAfter":  &spec.OfflineAfter,
+	} {
+		if v := properties[key]; v != "" {
+			count, err := strconv.Atoi(v)
+			if err != nil {
+				return ret, v1alpha2.NewCOAError(err, "invalid "+key+": "+v, v1alpha2.BadConfig)
+			}
+			*value = count
+		}
+	}
+	return ret.merge(spec, v1alpha2.BadConfig)
+}
+
+// healthEnabled reports whether the health of child sites is checked: health checks are enabled
+// by setting any of the health properties, unless health.enabled is "false"
+func healthEnabled(properties map[string]string) bool {
+	if v, ok := properties["health.enabled"]; ok {
+		return v == "true"
+	}
+	for key := range properties {
+		if strings.HasPrefix(key, "health.") {
+			return true
+		}
+	}
+	return false
+}
+
+// merge overrides the heartbeat with the fields set in a heartbeat spec
+func (h heartbeat) merge(spec model.SiteHeartbeatSpec, state v1alpha2.State) (heartbeat, error) {
+	if spec.Interval != "" {
+		interval, err := time.ParseDuration(spec.Interval)
+		if err != nil || interval <= 0 {
+			return h, v1alpha2.NewCOAError(err, "invalid heartbeat interval: "+spec.Interval, state)
+		}
+		h.Interval = interval
+	}
+	if spec.DegradedAfter != 0 {
+		h.DegradedAfter = spec.DegradedAfter
+	}
+	if spec.OfflineAfter != 0 {
+		h.OfflineAfter = spec.OfflineAfter
+	}
+	if h.DegradedAfter <= 0 || h.OfflineAfter < h.DegradedAfter {
+		return h, v1alpha2.NewCOAError(nil, "heartbeat offlineAfter must be at least degradedAfter, and both must be positive", state)
+	}
+	switch spec.OfflineJobs {
+	case "":
+	case model.OfflineJobsHold, model.OfflineJobsExpire:
+		h.OfflineJobs = spec.OfflineJobs
+	default:
+		return h, v1alpha2.NewCOAError(nil, "invalid heartbeat offlineJobs: "+spec.OfflineJobs, state)
+	}
+	return h, nil
+}
+
+// heartbeatOf returns the heartbeat expected from a site
+func (m *SitesManager) heartbeatOf(site model.SiteState) heartbeat {
+	defaults := m.heartbeat
+	if defaults.Interval == 0 {
+		// the manager wasn't initialized with a configuration
+		defaults, _ = readHeartbeat(nil)
+	}
+	if site.Spec == nil || site.Spec.Heartbeat == nil {
+		return defaults
+	}
+	ret, err := defaults.merge(*site.Spec.Heartbeat, v1alpha2.BadRequest)
+	if err != nil {
+		log.Errorf(" M (Sites): ignoring heartbeat of site %s: %v", site.Id, err)
+		return defaults
+	}
+	return ret
+}
+
+// healthOf derives the health of a site from the time it last reported. Sites that haven't
+// reported yet have no health.
+func (h heartbeat) healthOf(status *model.SiteStatus, now time.Time) string {
+	if status == nil || status.LastReported == "" {
+		return ""
+	}
+	reported, err := time.Parse(time.RFC3339, status.LastReported)
+	if err != nil {
+		return ""
+	}
+	missed := int(now.Sub(reported) / h.Interval)
+	switch {
+	case missed >= h.OfflineAfter:
+		return model.SiteOffline
+	case missed >= h.DegradedAfter:
+		return model.SiteDegraded
+	}
+	return model.SiteHealthy
+}
+
+// updateHealth sets the health of a site as of now, and returns its previous health if it changed
+func (m *SitesManager) updateHealth(site *model.SiteState, now time.Time) (string, bool) {
+	health := m.heartbeatOf(*site).healthOf(site.Status, now)
+	previous := site.Status.Health
+	if health == previous {
+		return "", false
+	}
+	site.Status.Health = health
+	site.Status.HealthChanged = now.UTC().Format(time.RFC3339)
+	if health == model.SiteOffline {
+		site.Status.IsOnline = false
+	}
+	return previous, true
+}
+
+func (m *SitesManager) publishHealth(ctx context.Context, site model.SiteState, previous string) {
+	log.InfofCtx(ctx, " M (Sites): site %s is %s, was %s", site.Id, site.Status.Health, previous)
+	if m.Context == nil {
+		return
+	}
+	err := m.Context.Publish(SiteHealthTopic, v1alpha2.Event{
+		Metadata: map[string]string{
+			"site":     site.Id,
+			"health":   site.Status.Health,
+			"previous": previous,
+		},
+		Body:    site,
+		Context: ctx,
+	})
+	if err != nil {
+		log.ErrorfCtx(ctx, " M (Sites): failed to publish health of site %s: %v", site.Id, err)
+	}
+}
+
+// CheckHealth marks the sites that stopped reporting degraded or offline
+func (m *SitesManager) CheckHealth(ctx context.Context) error {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "CheckHealth",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var sites []model.SiteState
+	sites, err = m.ListState(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, site := range sites {
+		if site.Id == m.VendorContext.SiteInfo.SiteId || site.Spec.IsSelf {
+			continue
+		}
+		if _, changed := m.updateHealth(&site, now); !changed {
+			continue
+		}
+		if err = m.saveHealth(ctx, site.Id, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveHealth updates the stored health of a site, unless the site reported in the meantime
+func (m *SitesManager) saveHealth(ctx context.Context, id string, now time.Time) error {
+	getRequest := states.GetRequest{
+		ID: id,
+		Metadata: map[string]interface{}{
+			"version":  "v1",
+			"group":    model.FederationGroup,
+			"resource": "sites",
+		},
+	}
+	entry, err := m.StateProvider.Get(ctx, getRequest)
+	if err != nil {
+		return err
+	}
+	site, err := getSiteState(entry.ID, entry.Body)
+	if err != nil {
+		return err
+	}
+	previous, changed := m.updateHealth(&site, now)
+	if !changed {
+		return nil
+	}
+	_, err = m.StateProvider.Upsert(ctx, states.UpsertRequest{
+		Value: states.StateEntry{ID: id, Body: site, ETag: entry.ETag},
+		Metadata: map[string]interface{}{
+			"version":  "v1",
+			"group":    model.FederationGroup,
+			"resource": "sites",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	m.publishHealth(ctx, site, previous)
+	return nil
+}
+
+// ExpiresJobs checks whether the staged jobs of a site expire, because the site is offline
+// and doesn't hold its jobs
+func (m *SitesManager) ExpiresJobs(ctx context.Context, id string) bool {
+	site, err := m.GetState(ctx, id)
+	if err != nil {
+		return false
+	}
+	return site.Status.Health == model.SiteOffline && m.heartbeatOf(site).OfflineJobs == model.OfflineJobsExpire
+}
+
+// GetFleetHealth summarizes the health of the sites in the registry, and the statuses of
+// their targets and instances
+func (m *SitesManager) GetFleetHealth(ctx context.Context) (model.FleetHealth, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "GetFleetHealth",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	ret := model.FleetHealth{
+		Sites:     make(map[string]int),
+		Targets:   make(map[string]int),
+		Instances: make(map[string]int),
+		Details:   make([]model.SiteHealth, 0),
+	}
+	var sites []model.SiteState
+	sites, err = m.ListState(ctx)
+	if err != nil {
+		return ret, err
+	}
+	for _, site := range sites {
+		if site.Id == m.VendorContext.SiteInfo.SiteId || site.Spec.IsSelf {
+			continue
+		}
+		health := site.Status.Health
+		if health == "" {
+			health = model.SiteUnknown
+		}
+		details := model.SiteHealth{
+			Site:         site.Id,
+			Health:       health,
+			LastReported: site.Status.LastReported,
+			Targets:      make(map[string]int),
+			Instances:    make(map[string]int),
+		}
+		for _, target := range site.Status.TargetStatuses {
+			details.Targets[target.State.String()]++
+			ret.Targets[target.State.String()]++
+		}
+		for _, instance := range site.Status.InstanceStatuses {
+			details.Instances[instance.State.String()]++
+			ret.Instances[instance.State.String()]++
+		}
+		ret.Sites[health]++
+		ret.Details = append(ret.Details, details)
+	}
+	return ret, nil
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sites
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHealthManager(t *testing.T, properties map[string]string) (*SitesManager, chan v1alpha2.Event) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	vendorContext := &contexts.VendorContext{
+		SiteInfo: v1alpha2.SiteInfo{SiteId: "hq"},
+	}
+	vendorContext.PubsubProvider = &memory.InMemoryPubSubProvider{}
+	vendorContext.PubsubProvider.Init(memory.InMemoryPubSubConfig{})
+	properties["providers.persistentstate"] = "StateProvider"
+	manager := &SitesManager{}
+	err := manager.Init(vendorContext, managers.ManagerConfig{Properties: properties},
+		map[string]providers.IProvider{"StateProvider": stateProvider})
+	assert.Nil(t, err)
+
+	events := make(chan v1alpha2.Event, 10)
+	vendorContext.Subscribe(SiteHealthTopic, v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			events <- event
+			return nil
+		},
+	})
+	return manager, events
+}
+
+// reportedAt stores a site as if it last reported some time ago
+func reportedAt(t *testing.T, manager *SitesManager, site model.SiteState, ago time.Duration) {
+	if site.Status == nil {
+		site.Status = &model.SiteStatus{IsOnline: true}
+	}
+	site.Status.LastReported = time.Now().Add(-ago).UTC().Format(time.RFC3339)
+	_, err := manager.StateProvider.Upsert(context.Background(), states.UpsertRequest{
+		Value: states.StateEntry{ID: site.Id, Body: site},
+		Metadata: map[string]interface{}{
+			"version":  "v1",
+			"group":    model.FederationGroup,
+			"resource": "sites",
+		},
+	})
+	assert.Nil(t, err)
+}
+
+func TestHeartbeatConfig(t *testing.T) {
+	h, err := readHeartbeat(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, h.Interval)
+	assert.Equal(t, model.OfflineJobsHold, h.OfflineJobs)
+
+	h, err = readHeartbeat(map[string]string{
+		"health.interval":      "10s",
+		"health.degradedAfter": "3",
+		"health.offlineAfter":  "6",
+		"health.offlineJobs":   "expire",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, h.Interval)
+	assert.Equal(t, 3, h.DegradedAfter)
+	assert.Equal(t, 6, h.OfflineAfter)
+	assert.Equal(t, model.OfflineJobsExpire, h.OfflineJobs)
+
+	for _, properties := range []map[string]string{
+		{"health.interval": "soon"},
+		{"health.degradedAfter": "x"},
+		{"health.degradedAfter": "4", "health.offlineAfter": "3"},
+		{"health.offlineJobs": "drop"},
+	} {
+		_, err = readHeartbeat(properties)
+		assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State, properties)
+	}
+}
+
+func TestHealthEnabled(t *testing.T) {
+	manager, _ := newHealthManager(t, map[string]string{})
+	assert.False(t, manager.Enabled())
+
+	manager, _ = newHealthManager(t, map[string]string{"health.offlineJobs": "expire"})
+	assert.True(t, manager.Enabled())
+
+	manager, _ = newHealthManager(t, map[string]string{"health.enabled": "true"})
+	assert.True(t, manager.Enabled())
+
+	manager, _ = newHealthManager(t, map[string]string{"health.enabled": "false", "health.interval": "10s"})
+	assert.False(t, manager.Enabled())
+}
+
+func TestCheckHealth(t *testing.T) {
+	manager, events := newHealthManager(t, map[string]string{"health.interval": "1m"})
+	ctx := context.Background()
+	reportedAt(t, manager, model.SiteState{Id: "site1", Spec: &model.SiteSpec{Name: "site1"}}, 30*time.Second)
+	reportedAt(t, manager, model.SiteState{Id: "site2", Spec: &model.SiteSpec{Name: "site2"}}, 3*time.Minute)
+	reportedAt(t, manager, model.SiteState{Id: "site3", Spec: &model.SiteSpec{Name: "site3"}}, 10*time.Minute)
+	// a site that reports less often isn't degraded as early
+	reportedAt(t, manager, model.SiteState{Id: "site4", Spec: &model.SiteSpec{
+		Name:      "site4",
+		Heartbeat: &model.SiteHeartbeatSpec{Interval: "10m"},
+	}}, 10*time.Minute)
+
+	err := manager.CheckHealth(ctx)
+	assert.Nil(t, err)
+	for site, health := range map[string]string{
+		"site1": model.SiteHealthy,
+		"site2": model.SiteDegraded,
+		"site3": model.SiteOffline,
+		"site4": model.SiteHealthy,
+	} {
+		state, err := manager.GetState(ctx, site)
+		assert.Nil(t, err)
+		assert.Equal(t, health, state.Status.Health, site)
+		assert.NotEqual(t, "", state.Status.HealthChanged)
+		assert.Equal(t, health != model.SiteOffline, state.Status.IsOnline, site)
+	}
+	transitions := make(map[string]string)
+	for i := 0; i < 4; i++ {
+		select {
+		case event := <-events:
+			transitions[event.Metadata["site"]] = event.Metadata["health"]
+			assert.Equal(t, "", event.Metadata["previous"])
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "missing site health event")
+		}
+	}
+	assert.Equal(t, model.SiteOffline, transitions["site3"])
+
+	// unchanged sites don't publish again
+	err = manager.CheckHealth(ctx)
+	assert.Nil(t, err)
+	select {
+	case event := <-events:
+		assert.Fail(t, "unexpected site health event", event.Metadata["site"])
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// a site that reports again is back to healthy
+	err = manager.ReportState(ctx, model.SiteState{Id: "site3", Spec: &model.SiteSpec{Name: "site3"}, Status: &model.SiteStatus{IsOnline: true}})
+	assert.Nil(t, err)
+	event := <-events
+	assert.Equal(t, "site3", event.Metadata["site"])
+	assert.Equal(t, model.SiteHealthy, event.Metadata["health"])
+	assert.Equal(t, model.SiteOffline, event.Metadata["previous"])
+}
+
+func TestExpiresJobs(t *testing.T) {
+	manager, _ := newHealthManager(t, map[string]string{})
+	ctx := context.Background()
+	reportedAt(t, manager, model.SiteState{Id: "site1", Spec: &model.SiteSpec{Name: "site1"}}, time.Hour)
+	reportedAt(t, manager, model.SiteState{Id: "site2", Spec: &model.SiteSpec{
+		Name:      "site2",
+		Heartbeat: &model.SiteHeartbeatSpec{OfflineJobs: model.OfflineJobsExpire},
+	}}, time.Hour)
+	reportedAt(t, manager, model.SiteState{Id: "site3", Spec: &model.SiteSpec{
+		Name:      "site3",
+		Heartbeat: &model.SiteHeartbeatSpec{OfflineJobs: model.OfflineJobsExpire},
+	}}, time.Second)
+	err := manager.CheckHealth(ctx)
+	assert.Nil(t, err)
+
+	assert.False(t, manager.ExpiresJobs(ctx, "site1"))
+	assert.True(t, manager.ExpiresJobs(ctx, "site2"))
+	assert.False(t, manager.ExpiresJobs(ctx, "site3"))
+	assert.False(t, manager.ExpiresJobs(ctx, "unknown"))
+
+	// invalid heartbeats are refused
+	err = manager.UpsertState(ctx, "site4", model.SiteState{Id: "site4", Spec: &model.SiteSpec{
+		Name:      "site4",
+		Heartbeat: &model.SiteHeartbeatSpec{OfflineJobs: "drop"},
+	}})
+	assert.Equal(t, v1alpha2.BadRequest, err.(v1alpha2.COAError).State)
+}
+
+func TestGetFleetHealth(t *testing.T) {
+	manager, _ := newHealthManager(t, map[string]string{})
+	ctx := context.Background()
+	err := manager.UpsertState(ctx, "hq", model.SiteState{Id: "hq", Spec: &model.SiteSpec{Name: "hq", IsSelf: true}})
+	assert.Nil(t, err)
+	reportedAt(t, manager, model.SiteState{
+		Id:   "site1",
+		Spec: &model.SiteSpec{Name: "site1"},
+		Status: &model.SiteStatus{
+			IsOnline: true,
+			TargetStatuses: map[string]model.SiteTargetStatus{
+				"target1": {State: v1alpha2.OK},
+				"target2": {State: v1alpha2.UpdateFailed},
+			},
+			InstanceStatuses: map[string]model.SiteInstanceStatus{
+				"instance1": {State: v1alpha2.OK},
+			},
+		},
+	}, time.Second)
+	reportedAt(t, manager, model.SiteState{
+		Id:   "site2",
+		Spec: &model.SiteSpec{Name: "site2"},
+		Status: &model.SiteStatus{
+			TargetStatuses: map[string]model.SiteTargetStatus{
+				"target1": {State: v1alpha2.OK},
+			},
+		},
+	}, time.Hour)
+	err = manager.UpsertState(ctx, "site3", model.SiteState{Id: "site3", Spec: &model.SiteSpec{Name: "site3"}})
+	assert.Nil(t, err)
+	err = manager.CheckHealth(ctx)
+	assert.Nil(t, err)
+
+	health, err := manager.GetFleetHealth(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{model.SiteHealthy: 1, model.SiteOffline: 1, model.SiteUnknown: 1}, health.Sites)
+	assert.Equal(t, map[string]int{v1alpha2.OK.String(): 2, v1alpha2.UpdateFailed.String(): 1}, health.Targets)
+	assert.Equal(t, map[string]int{v1alpha2.OK.String(): 1}, health.Instances)
+	assert.Equal(t, 3, len(health.Details))
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
@@ -20,6 +21,7 @@ import (
 	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
 	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
 )
@@ -30,6 +32,22 @@ type SitesManager struct {
 	managers.Manager
 	StateProvider states.IStateProvider
 	apiClient     utils.ApiClient
+	// CertIssuer issues the certificates of enrolled sites
+	CertIssuer certs.ICertIssuer
+	// EnrollmentStateProvider keeps the enrollments of sites
+	EnrollmentStateProvider states.IStateProvider
+	certValidity            time.Duration
+	// requireSiteAuth rejects federation requests of sites that don't authenticate with
+	// an enrolled certificate
+	requireSiteAuth bool
+	// heartbeat is how often sites are expected to report, unless they override it
+	heartbeat heartbeat
+	// checkHealth enables the health checks of child sites in Poll
+	checkHealth bool
+	// nonces are the nonces of signed requests that are recent enough to be replayed,
+	// with the time they expire
+	nonceLock sync.Mutex
+	nonces    map[string]time.Time
 }
 
 func (s *SitesManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
@@ -47,7 +65,12 @@ func (s *SitesManager) Init(context *contexts.VendorContext, config managers.Man
 	if err != nil {
 		return err
 	}
-	return nil
+	s.heartbeat, err = readHeartbeat(config.Properties)
+	if err != nil {
+		return err
+	}
+	s.checkHealth = healthEnabled(config.Properties)
+	return s.initEnrollment(config, providers)
 }
 
 func (m *SitesManager) GetState(ctx context.Context, name string) (model.SiteState, error) {
@@ -147,8 +170,21 @@ func (t *SitesManager) ReportState(ctx context.Context, current model.SiteState)
 		siteState.Status.IsOnline = current.Status.IsOnline
 		siteState.Status.InstanceStatuses = current.Status.InstanceStatuses
 		siteState.Status.TargetStatuses = current.Status.TargetStatuses
+		siteState.Status.CatalogConflicts = current.Status.CatalogConflicts
 	}
-	siteState.Status.LastReported = time.Now().UTC().Format(time.RFC3339)
+	now := time.Now()
+	siteState.Status.LastReported = now.UTC().Format(time.RFC3339)
+	if current.Spec != nil && current.Spec.Parent != "" {
+		if siteState.Spec == nil {
+			siteState.Spec = &model.SiteSpec{}
+		}
+		siteState.Spec.Parent = current.Spec.Parent
+		// relay sites report the sites below them with the time they last reported
+		if current.Spec.Parent != t.VendorContext.SiteInfo.SiteId && current.Status != nil && current.Status.LastReported != "" {
+			siteState.Status.LastReported = current.Status.LastReported
+		}
+	}
+	previous, healthChanged := t.updateHealth(&siteState, now)
 
 	updateRequest := states.UpsertRequest{
 		Value: states.StateEntry{ID: current.Id, Body: siteState, ETag: entry.ETag},
@@ -163,9 +199,63 @@ func (t *SitesManager) ReportState(ctx context.Context, current model.SiteState)
 	if err != nil {
 		return err
 	}
+	if healthChanged {
+		t.publishHealth(ctx, siteState, previous)
+	}
 	return nil
 }
 
+// UpdateCatalogConflict records a catalog sync conflict in the status of a site, a nil conflict
+// clears the conflict of the catalog version
+func (t *SitesManager) UpdateCatalogConflict(ctx context.Context, site string, name string, conflict *model.CatalogConflict) error {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "UpdateCatalogConflict",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var entry states.StateEntry
+	entry, err = t.StateProvider.Get(ctx, states.GetRequest{
+		ID: site,
+		Metadata: map[string]interface{}{
+			"version":  "v1",
+			"group":    model.FederationGroup,
+			"resource": "sites",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var siteState model.SiteState
+	siteState, err = getSiteState(entry.ID, entry.Body)
+	if err != nil {
+		return err
+	}
+	_, exists := siteState.Status.CatalogConflicts[name]
+	if conflict == nil {
+		if !exists {
+			return nil
+		}
+		delete(siteState.Status.CatalogConflicts, name)
+	} else {
+		if siteState.Status.CatalogConflicts == nil {
+			siteState.Status.CatalogConflicts = make(map[string]model.CatalogConflict)
+		}
+		siteState.Status.CatalogConflicts[name] = *conflict
+	}
+
+	_, err = t.StateProvider.Upsert(ctx, states.UpsertRequest{
+		Value: states.StateEntry{ID: site, Body: siteState, ETag: entry.ETag},
+		Metadata: map[string]interface{}{
+			"version":  "v1",
+			"group":    model.FederationGroup,
+			"resource": "sites",
+		},
+	})
+	return err
+}
+
 func (m *SitesManager) UpsertState(ctx context.Context, name string, state model.SiteState) error {
 	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
 		"method": "UpsertSpec",
@@ -181,6 +271,12 @@ func (m *SitesManager) UpsertState(ctx context.Context, name string, state model
 		return v1alpha2.NewCOAError(nil, fmt.Sprintf("Name in metadata (%s) does not match name in request (%s)", state.ObjectMeta.Name, name), v1alpha2.BadRequest)
 	}
 
+	if state.Spec != nil && state.Spec.Heartbeat != nil {
+		if _, err = m.heartbeatOf(model.SiteState{}).merge(*state.Spec.Heartbeat, v1alpha2.BadRequest); err != nil {
+			return err
+		}
+	}
+
 	oldState, getStateErr := m.GetState(ctx, state.ObjectMeta.Name)
 	if getStateErr == nil {
 		state.ObjectMeta.PreserveSystemMetadata(oldState.ObjectMeta)
@@ -268,7 +364,7 @@ func (t *SitesManager) ListState(ctx context.Context) ([]model.SiteState, error)
 	return ret, nil
 }
 func (s *SitesManager) Enabled() bool {
-	return s.VendorContext.SiteInfo.ParentSite.BaseUrl != ""
+	return s.VendorContext.SiteInfo.ParentSite.BaseUrl != "" || s.checkHealth
 }
 func (s *SitesManager) Poll() []error {
 	ctx, span := observability.StartSpan("Sites Manager", context.Background(), &map[string]string{
@@ -278,6 +374,15 @@ func (s *SitesManager) Poll() []error {
 	defer observ_utils.CloseSpanWithError(span, &err)
 	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
 
+	if s.checkHealth {
+		if healthErr := s.CheckHealth(ctx); healthErr != nil {
+			log.ErrorfCtx(ctx, " M (Sites): failed to check site health: %v", healthErr)
+		}
+	}
+	if s.VendorContext.SiteInfo.ParentSite.BaseUrl == "" {
+		return nil
+	}
+
 	var thisSite model.SiteState
 	thisSite, err = s.GetState(ctx, s.VendorContext.SiteInfo.SiteId)
 	if err != nil {
@@ -285,6 +390,7 @@ func (s *SitesManager) Poll() []error {
 		return nil
 	}
 	thisSite.Spec.IsSelf = false
+	thisSite.Spec.Parent = ""
 	jData, _ := json.Marshal(thisSite)
 	s.apiClient.UpdateSite(
 		ctx,
@@ -292,6 +398,28 @@ func (s *SitesManager) Poll() []error {
 		jData,
 		s.VendorContext.SiteInfo.ParentSite.Username,
 		s.VendorContext.SiteInfo.ParentSite.Password)
+
+	// relay the status of the sites below this site, so the parent site sees the whole tree
+	var sites []model.SiteState
+	sites, err = s.ListState(ctx)
+	if err != nil {
+		return []error{err}
+	}
+	for _, site := range sites {
+		if site.Id == s.VendorContext.SiteInfo.SiteId || site.Spec.IsSelf {
+			continue
+		}
+		site.Spec.Parent = s.parentOf(site)
+		jData, _ = json.Marshal(site)
+		if relayErr := s.apiClient.UpdateSite(
+			ctx,
+			site.Id,
+			jData,
+			s.VendorContext.SiteInfo.ParentSite.Username,
+			s.VendorContext.SiteInfo.ParentSite.Password); relayErr != nil {
+			log.ErrorfCtx(ctx, " M (Sites): failed to relay status of site %s: %v", site.Id, relayErr)
+		}
+	}
 	return nil
 }
 func (s *SitesManager) Reconcil() []error {
@@ -58,3 +58,42 @@ func TestUpdateTargetStatus(t *testing.T) {
 	assert.Equal(t, true, spec.Status.IsOnline)
 	assert.NotEqual(t, "", spec.Status.LastReported)
 }
+
+func TestUpdateCatalogConflict(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	manager := SitesManager{
+		StateProvider: stateProvider,
+	}
+	err := manager.UpsertState(context.Background(), "test", model.SiteState{Spec: &model.SiteSpec{Name: "test"}})
+	assert.Nil(t, err)
+	err = manager.UpdateCatalogConflict(context.Background(), "test", "hq-config", &model.CatalogConflict{
+		Origin:     "hq",
+		SourceName: "config",
+		Policy:     model.ConflictPolicyManual,
+	})
+	assert.Nil(t, err)
+	state, err := manager.GetState(context.Background(), "test")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(state.Status.CatalogConflicts))
+	assert.Equal(t, "config", state.Status.CatalogConflicts["hq-config"].SourceName)
+	assert.Equal(t, "test", state.Spec.Name)
+
+	// conflicts are reported to the parent site with the site status
+	parentProvider := &memorystate.MemoryStateProvider{}
+	parentProvider.Init(memorystate.MemoryStateProviderConfig{})
+	parent := SitesManager{
+		StateProvider: parentProvider,
+	}
+	err = parent.ReportState(context.Background(), state)
+	assert.Nil(t, err)
+	reported, err := parent.GetState(context.Background(), "test")
+	assert.Nil(t, err)
+	assert.Equal(t, model.ConflictPolicyManual, reported.Status.CatalogConflicts["hq-config"].Policy)
+
+	err = manager.UpdateCatalogConflict(context.Background(), "test", "hq-config", nil)
+	assert.Nil(t, err)
+	state, err = manager.GetState(context.Background(), "test")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(state.Status.CatalogConflicts))
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sites
+
+import (
+	"context"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph"
+	memorygraph "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph/memory"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+)
+
+// parentOf returns the parent of a site in the registry of this site. Sites without a parent
+// sync with this site.
+func (m *SitesManager) parentOf(site model.SiteState) string {
+	if site.Spec == nil || site.Spec.Parent == "" {
+		return m.VendorContext.SiteInfo.SiteId
+	}
+	return site.Spec.Parent
+}
+
+// parents maps the sites in the registry to their parents, leaving out this site
+func (m *SitesManager) parents(ctx context.Context) (map[string]string, error) {
+	sites, err := m.ListState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	for _, site := range sites {
+		if site.Id == m.VendorContext.SiteInfo.SiteId || (site.Spec != nil && site.Spec.IsSelf) {
+			continue
+		}
+		ret[site.Id] = m.parentOf(site)
+	}
+	return ret, nil
+}
+
+// path returns the sites between this site and a site, starting with the site that syncs with
+// this site and ending with the site itself
+func (m *SitesManager) path(ctx context.Context, site string) ([]string, error) {
+	parents, err := m.parents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	self := m.VendorContext.SiteInfo.SiteId
+	ret := []string{site}
+	for current := site; ; {
+		parent, ok := parents[current]
+		if !ok {
+			// a site that isn't in the registry is reached directly
+			return ret, nil
+		}
+		if parent == self {
+			return ret, nil
+		}
+		for _, visited := range ret {
+			if visited == parent {
+				return nil, v1alpha2.NewCOAError(nil, "site "+site+" is in a parent cycle", v1alpha2.BadConfig)
+			}
+		}
+		ret = append([]string{parent}, ret...)
+		current = parent
+	}
+}
+
+// NextHop returns the site that syncs with this site through which a site is reached. Jobs
+// for a site are queued for its next hop, which relays them down the topology.
+func (m *SitesManager) NextHop(ctx context.Context, site string) (string, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "NextHop",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	var path []string
+	path, err = m.path(ctx, site)
+	if err != nil {
+		return "", err
+	}
+	return path[0], nil
+}
+
+// IsDescendant checks whether a site is below another site in the topology
+func (m *SitesManager) IsDescendant(ctx context.Context, site string, ancestor string) (bool, error) {
+	path, err := m.path(ctx, site)
+	if err != nil {
+		return false, err
+	}
+	for _, hop := range path[:len(path)-1] {
+		if hop == ancestor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetTree returns the topology of the sites below this site, rooted at this site
+func (m *SitesManager) GetTree(ctx context.Context) (model.SiteTreeNode, error) {
+	ctx, span := observability.StartSpan("Sites Manager", ctx, &map[string]string{
+		"method": "GetTree",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	self := m.VendorContext.SiteInfo.SiteId
+	var sites []model.SiteState
+	sites, err = m.ListState(ctx)
+	if err != nil {
+		return model.SiteTreeNode{}, err
+	}
+	root := model.SiteState{Id: self, Spec: &model.SiteSpec{Name: self, IsSelf: true}}
+	nodes := make([]v1alpha2.INode, 0, len(sites)+1)
+	for _, site := range sites {
+		if site.Id == self || (site.Spec != nil && site.Spec.IsSelf) {
+			root = site
+			root.Id = self
+			if root.Spec != nil {
+				spec := *root.Spec
+				spec.Parent = ""
+				root.Spec = &spec
+			}
+			continue
+		}
+		spec := model.SiteSpec{}
+		if site.Spec != nil {
+			spec = *site.Spec
+		}
+		spec.Parent = m.parentOf(site)
+		site.Spec = &spec
+		nodes = append(nodes, site)
+	}
+	nodes = append(nodes, root)
+
+	provider := &memorygraph.MemoryGraphProvider{}
+	if err = provider.Init(memorygraph.MemoryGraphProviderConfig{}); err != nil {
+		return model.SiteTreeNode{}, err
+	}
+	if err = provider.SetData(nodes); err != nil {
+		return model.SiteTreeNode{}, err
+	}
+	var response graph.GetSetResponse
+	response, err = provider.GetTree(ctx, graph.GetRequest{Name: self, Filter: model.SiteNodeType})
+	if err != nil {
+		return model.SiteTreeNode{}, err
+	}
+
+	children := make(map[string][]model.SiteState)
+	for _, node := range response.Nodes[1:] {
+		site := node.(model.SiteState)
+		children[site.Spec.Parent] = append(children[site.Spec.Parent], site)
+	}
+	return buildSiteTree(root, children), nil
+}
+
+func buildSiteTree(site model.SiteState, children map[string][]model.SiteState) model.SiteTreeNode {
+	node := model.SiteTreeNode{Site: site}
+	for _, child := range children[site.Id] {
+		node.Children = append(node.Children, buildSiteTree(child, children))
+	}
+	return node
+}
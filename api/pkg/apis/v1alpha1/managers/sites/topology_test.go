@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sites
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTopologyManager registers a topology of root -> relay1 -> (leaf1 -> leaf2), relay1 -> leaf3,
+// and root -> child1
+func newTopologyManager(t *testing.T) *SitesManager {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	manager := &SitesManager{
+		Manager: managers.Manager{
+			VendorContext: &contexts.VendorContext{
+				SiteInfo: v1alpha2.SiteInfo{SiteId: "root"},
+			},
+		},
+		StateProvider: stateProvider,
+	}
+	sites := map[string]string{
+		"root":   "",
+		"relay1": "",
+		"child1": "root",
+		"leaf1":  "relay1",
+		"leaf2":  "leaf1",
+		"leaf3":  "relay1",
+	}
+	for site, parent := range sites {
+		err := manager.UpsertState(context.Background(), site, model.SiteState{
+			Id:   site,
+			Spec: &model.SiteSpec{Name: site, Parent: parent, IsSelf: site == "root"},
+		})
+		assert.Nil(t, err)
+	}
+	return manager
+}
+
+func TestNextHop(t *testing.T) {
+	manager := newTopologyManager(t)
+	ctx := context.Background()
+	for site, hop := range map[string]string{
+		"relay1":  "relay1",
+		"child1":  "child1",
+		"leaf1":   "relay1",
+		"leaf2":   "relay1",
+		"leaf3":   "relay1",
+		"unknown": "unknown",
+	} {
+		nextHop, err := manager.NextHop(ctx, site)
+		assert.Nil(t, err)
+		assert.Equal(t, hop, nextHop, site)
+	}
+
+	isDescendant, err := manager.IsDescendant(ctx, "leaf2", "relay1")
+	assert.Nil(t, err)
+	assert.True(t, isDescendant)
+	isDescendant, err = manager.IsDescendant(ctx, "leaf2", "leaf1")
+	assert.Nil(t, err)
+	assert.True(t, isDescendant)
+	isDescendant, err = manager.IsDescendant(ctx, "relay1", "leaf1")
+	assert.Nil(t, err)
+	assert.False(t, isDescendant)
+	isDescendant, err = manager.IsDescendant(ctx, "leaf1", "leaf1")
+	assert.Nil(t, err)
+	assert.False(t, isDescendant)
+}
+
+func TestNextHopCycle(t *testing.T) {
+	manager := newTopologyManager(t)
+	ctx := context.Background()
+	err := manager.UpsertState(ctx, "relay1", model.SiteState{
+		Id:   "relay1",
+		Spec: &model.SiteSpec{Name: "relay1", Parent: "leaf2"},
+	})
+	assert.Nil(t, err)
+	_, err = manager.NextHop(ctx, "leaf2")
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+
+	// sites in a cycle aren't reachable from this site
+	tree, err := manager.GetTree(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tree.Children))
+	assert.Equal(t, "child1", tree.Children[0].Site.Id)
+}
+
+func TestGetTree(t *testing.T) {
+	manager := newTopologyManager(t)
+	tree, err := manager.GetTree(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "root", tree.Site.Id)
+	assert.Equal(t, 2, len(tree.Children))
+
+	children := make(map[string]model.SiteTreeNode)
+	for _, child := range tree.Children {
+		children[child.Site.Id] = child
+	}
+	assert.Equal(t, 0, len(children["child1"].Children))
+	relay := children["relay1"]
+	assert.Equal(t, "root", relay.Site.Spec.Parent)
+	assert.Equal(t, 2, len(relay.Children))
+	for _, child := range relay.Children {
+		if child.Site.Id == "leaf1" {
+			assert.Equal(t, 1, len(child.Children))
+			assert.Equal(t, "leaf2", child.Children[0].Site.Id)
+		} else {
+			assert.Equal(t, "leaf3", child.Site.Id)
+		}
+	}
+}
+
+func TestReportStateRelayed(t *testing.T) {
+	manager := newTopologyManager(t)
+	ctx := context.Background()
+	err := manager.ReportState(ctx, model.SiteState{
+		Id:     "leaf4",
+		Spec:   &model.SiteSpec{Name: "leaf4", Parent: "leaf3"},
+		Status: &model.SiteStatus{IsOnline: true, LastReported: "2024-01-01T00:00:00Z"},
+	})
+	assert.Nil(t, err)
+	state, err := manager.GetState(ctx, "leaf4")
+	assert.Nil(t, err)
+	assert.Equal(t, "leaf3", state.Spec.Parent)
+	assert.Equal(t, "2024-01-01T00:00:00Z", state.Status.LastReported)
+
+	nextHop, err := manager.NextHop(ctx, "leaf4")
+	assert.Nil(t, err)
+	assert.Equal(t, "relay1", nextHop)
+
+	// direct children report with the time they're received
+	err = manager.ReportState(ctx, model.SiteState{
+		Id:     "child1",
+		Spec:   &model.SiteSpec{Name: "child1", Parent: "root"},
+		Status: &model.SiteStatus{IsOnline: true, LastReported: "2024-01-01T00:00:00Z"},
+	})
+	assert.Nil(t, err)
+	state, err = manager.GetState(ctx, "child1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "2024-01-01T00:00:00Z", state.Status.LastReported)
+}
@@ -555,7 +555,24 @@ func (s *SolutionVersionManager) saveSummaryProgress(ctx context.Context, object
 }
 
 func (s *SolutionVersionManager) concludeSummary(ctx context.Context, objectName string, summaryId string, generation string, hash string, summary model.SummarySpec, namespace string) error {
-	return s.saveSummary(ctx, objectName, summaryId, generation, hash, summary, model.SummaryStateDone, namespace)
+	err := s.saveSummary(ctx, objectName, summaryId, generation, hash, summary, model.SummaryStateDone, namespace)
+	if err == nil && s.VendorContext != nil {
+		// Let other components (such as activation triggers) react to concluded deployments
+		s.VendorContext.Publish(model.InstanceSummaryTopic, v1alpha2.Event{
+			Metadata: map[string]string{
+				"objectType": model.TriggerObjectType_Instance,
+				"namespace":  namespace,
+			},
+			Body: v1alpha2.JobData{
+				Id:     objectName,
+				Scope:  namespace,
+				Action: v1alpha2.JobUpdate,
+				Body:   summary,
+			},
+			Context: ctx,
+		})
+	}
+	return err
 }
 
 func (s *SolutionVersionManager) canSkipStep(ctx context.Context, step model.DeploymentStep, target string, provider tgt.ITargetProvider, previousComponents []model.ComponentSpec, currentState model.DeploymentState) bool {
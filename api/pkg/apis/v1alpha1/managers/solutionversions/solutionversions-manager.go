@@ -33,6 +33,8 @@ type SolutionVersionsManager struct {
 	StateProvider     states.IStateProvider
 	needValidate      bool
 	SolutionVersionValidator validation.SolutionVersionValidator
+	// impactChecker applies the impact check policy to changes of solution versions
+	impactChecker *validation.ImpactChecker
 }
 
 func (s *SolutionVersionsManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
@@ -52,7 +54,8 @@ func (s *SolutionVersionsManager) Init(context *contexts.VendorContext, config m
 		// s.SolutionVersionValidator = validation.NewSolutionVersionValidator(s.solutionversionInstanceLookup, s.solutionversionContainerLookup, s.uniqueNameSolutionVersionLookup)
 		s.SolutionVersionValidator = validation.NewSolutionVersionValidator(nil, nil, s.uniqueNameSolutionVersionLookup)
 	}
-	return nil
+	s.impactChecker, err = validation.NewImpactChecker(config.Properties, validation.SolutionVersion, states.ObjectLister(s.StateProvider))
+	return err
 }
 
 func (t *SolutionVersionsManager) DeleteState(ctx context.Context, name string, namespace string) error {
@@ -68,6 +71,9 @@ func (t *SolutionVersionsManager) DeleteState(ctx context.Context, name string,
 			return err
 		}
 	}
+	if err = t.impactChecker.CheckDelete(ctx, name, namespace); err != nil {
+		return err
+	}
 
 	err = t.StateProvider.Delete(ctx, states.DeleteRequest{
 		ID: name,
@@ -113,6 +119,12 @@ func (t *SolutionVersionsManager) UpsertState(ctx context.Context, name string,
 		}
 	}
 
+	if getStateErr == nil {
+		if err = t.impactChecker.CheckUpdate(ctx, name, state.ObjectMeta.Namespace, state); err != nil {
+			return err
+		}
+	}
+
 	body := map[string]interface{}{
 		"apiVersion": model.SolutionVersionGroup + "/v1",
 		"kind":       "SolutionVersion",
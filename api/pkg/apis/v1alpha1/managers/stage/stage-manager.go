@@ -9,6 +9,7 @@ package stage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -173,7 +174,9 @@ func (h *CampaignVersionTaskHandler) HandleTask(ctx context.Context, task model.
 	}
 
 	// Process task
-	outputs, _, err := taskProvider.(stage.IStageProvider).Process(ctx, *h.manager.Manager.Context, taskInputs)
+	outputs, _, err := processWithTimeout(ctx, task.Timeout, func(ctx context.Context) (map[string]interface{}, bool, error) {
+		return taskProvider.(stage.IStageProvider).Process(ctx, *h.manager.Manager.Context, taskInputs)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -394,6 +397,56 @@ func processWithRetry(ctx context.Context, retry *model.RetrySpec, fn func() (ma
 	return outputs, pause, err
 }
 
+// abandonTimeout is how long processWithTimeout waits for a provider to stop after
+// its context is cancelled
+var abandonTimeout = 5 * time.Second
+
+// processWithTimeout executes fn with a context that is cancelled once timeout
+// (duration format, e.g. "30s") expires. An empty timeout calls fn with ctx as is.
+// fn runs in its own goroutine. When the timeout expires, processWithTimeout waits
+// for fn to stop on the cancellation, and abandons it after abandonTimeout so that a
+// provider ignoring the cancellation doesn't block the stage. The results of an
+// abandoned fn are discarded.
+func processWithTimeout(ctx context.Context, timeout string, fn func(ctx context.Context) (map[string]interface{}, bool, error)) (map[string]interface{}, bool, error) {
+	if timeout == "" {
+		return fn(ctx)
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, false, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid timeout %q", timeout), v1alpha2.BadConfig)
+	}
+	tCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	type processResult struct {
+		outputs map[string]interface{}
+		pause   bool
+		err     error
+	}
+	done := make(chan processResult, 1)
+	go func() {
+		outputs, pause, err := fn(tCtx)
+		done <- processResult{outputs: outputs, pause: pause, err: err}
+	}()
+	select {
+	case result := <-done:
+		if result.err != nil && errors.Is(tCtx.Err(), context.DeadlineExceeded) {
+			return result.outputs, result.pause, v1alpha2.NewCOAError(result.err, fmt.Sprintf("timed out after %s", timeout), v1alpha2.TimedOut)
+		}
+		return result.outputs, result.pause, result.err
+	case <-tCtx.Done():
+		select {
+		case <-done:
+		case <-time.After(abandonTimeout):
+			log.ErrorfCtx(ctx, " M (Stage): provider didn't stop within %s after it was cancelled, abandoning it", abandonTimeout)
+		}
+		if errors.Is(tCtx.Err(), context.DeadlineExceeded) {
+			return nil, false, v1alpha2.NewCOAError(tCtx.Err(), fmt.Sprintf("timed out after %s", timeout), v1alpha2.TimedOut)
+		}
+		return nil, false, tCtx.Err()
+	}
+}
+
 func (s *StageManager) processTasks(ctx context.Context, currentStage model.StageSpec, inputCopy map[string]interface{}, triggerData v1alpha2.ActivationData, triggers map[string]interface{}, siteName string) (map[string]interface{}, error) {
 	if len(currentStage.Tasks) == 0 {
 		return make(map[string]interface{}), nil
@@ -405,8 +458,20 @@ func (s *StageManager) processTasks(ctx context.Context, currentStage model.Stag
 	processor := NewGoRoutineTaskProcessor(s, ctx)
 	handler := NewCampaignVersionTaskHandler(s, triggerData, triggers)
 
+	// Tasks without their own timeout inherit the stage timeout
+	tasks := currentStage.Tasks
+	if currentStage.Timeout != "" {
+		tasks = make([]model.TaskSpec, len(currentStage.Tasks))
+		for i, task := range currentStage.Tasks {
+			if task.Timeout == "" {
+				task.Timeout = currentStage.Timeout
+			}
+			tasks[i] = task
+		}
+	}
+
 	// Process tasks using the processor
-	return processor.Process(ctx, currentStage.Tasks, inputCopy, handler, currentStage.TaskOption.ErrorAction, currentStage.TaskOption.Concurrency, siteName)
+	return processor.Process(ctx, tasks, inputCopy, handler, currentStage.TaskOption.ErrorAction, currentStage.TaskOption.Concurrency, siteName)
 }
 
 func (s *StageManager) evaluateProxyConfig(ctx context.Context, triggerData v1alpha2.ActivationData, runtimeInputs map[string]interface{}, activationTriggers map[string]interface{}) (map[string]interface{}, error) {
@@ -1146,11 +1211,16 @@ func (s *StageManager) HandleTriggerEvent(ctx context.Context, campaignversion m
 						triggerDataForProxy.Inputs = proxyInputs
 
 						outputs, pause, iErr = processWithRetry(ctx, currentStage.Retry, func() (map[string]interface{}, bool, error) {
-							return proxyProvider.(stage.IProxyStageProvider).Process(ctx, *s.Manager.Context, triggerDataForProxy)
+							return processWithTimeout(ctx, currentStage.Timeout, func(ctx context.Context) (map[string]interface{}, bool, error) {
+								return proxyProvider.(stage.IProxyStageProvider).Process(ctx, *s.Manager.Context, triggerDataForProxy)
+							})
 						})
 					} else {
 						outputs, pause, iErr = processWithRetry(ctx, currentStage.Retry, func() (map[string]interface{}, bool, error) {
-							return provider.(stage.IStageProvider).Process(ctx, *s.Manager.Context, inputCopy)
+							return processWithTimeout(ctx, currentStage.Timeout, func(ctx context.Context) (map[string]interface{}, bool, error) {
+								// the provider gets its own inputs, so a provider that is abandoned can't change them
+								return provider.(stage.IStageProvider).Process(ctx, *s.Manager.Context, utils.MergeCollection_StringAny(inputCopy))
+							})
 						})
 					}
 					if iErr != nil {
@@ -1437,6 +1507,109 @@ func (s *StageManager) traceValue(ctx context.Context, v interface{}, namespace
 	}
 }
 
+// CompensationStep pairs a succeeded stage with the stage that undoes it
+type CompensationStep struct {
+	Stage        string
+	Compensation string
+}
+
+// IsCampaignFailed returns true if the stage status ends the campaign with a failure
+func IsCampaignFailed(status model.StageStatus) bool {
+	return status.NextStage == "" && status.Status != v1alpha2.Done && status.Status != v1alpha2.Paused
+}
+
+// GetCompensationSteps walks the stage history backwards and returns a step for
+// every succeeded stage that defines a compensation stage. Each stage is only
+// compensated once, at the position of its latest successful run.
+func (s *StageManager) GetCompensationSteps(campaignversion model.CampaignVersionSpec, history []model.StageStatus) []CompensationStep {
+	steps := make([]CompensationStep, 0)
+	compensated := make(map[string]bool)
+	for i := len(history) - 1; i >= 0; i-- {
+		entry := history[i]
+		if entry.CompensatedStage != "" || entry.Status != v1alpha2.Done || compensated[entry.Stage] {
+			continue
+		}
+		stageSpec, ok := campaignversion.Stages[entry.Stage]
+		if !ok || stageSpec.Compensation == "" {
+			continue
+		}
+		compensated[entry.Stage] = true
+		steps = append(steps, CompensationStep{
+			Stage:        entry.Stage,
+			Compensation: stageSpec.Compensation,
+		})
+	}
+	return steps
+}
+
+// HandleCompensation runs the compensation stages of the succeeded stages in
+// reverse order after a campaign failure. Every compensation result is handed
+// to report, with CompensatedStage set to the stage being undone. A failed
+// compensation doesn't stop the remaining ones.
+func (s *StageManager) HandleCompensation(ctx context.Context, campaignversion model.CampaignVersionSpec, triggerData v1alpha2.ActivationData, history []model.StageStatus, report func(status model.StageStatus) error) error {
+	ctx, span := observability.StartSpan("Stage Manager", ctx, &map[string]string{
+		"method": "HandleCompensation",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	steps := s.GetCompensationSteps(campaignversion, history)
+	if len(steps) == 0 {
+		return nil
+	}
+	log.InfofCtx(ctx, " M (Stage): campaign %s failed at stage %s, running %d compensation stage(s)", triggerData.CampaignVersion, triggerData.Stage, len(steps))
+
+	// Make the outputs of all stages in the history available to compensation stages
+	outputs := make(map[string]map[string]interface{})
+	for _, entry := range history {
+		if entry.CompensatedStage == "" && entry.Outputs != nil {
+			outputs[entry.Stage] = entry.Outputs
+		}
+	}
+	for k, v := range triggerData.Outputs {
+		outputs[k] = v
+	}
+
+	// Compensation stages run one at a time and never select a next stage
+	spec := campaignversion
+	spec.SelfDriving = false
+	for _, step := range steps {
+		var status model.StageStatus
+		if compensation, ok := campaignversion.Stages[step.Compensation]; ok {
+			compensationData := v1alpha2.ActivationData{
+				CampaignVersion:      triggerData.CampaignVersion,
+				Activation:           triggerData.Activation,
+				ActivationGeneration: triggerData.ActivationGeneration,
+				Stage:                step.Compensation,
+				Inputs:               triggerData.Inputs,
+				Outputs:              outputs,
+				Provider:             compensation.Provider,
+				Config:               compensation.Config,
+				TriggeringStage:      step.Stage,
+				Namespace:            triggerData.Namespace,
+				Proxy:                compensation.Proxy,
+			}
+			status, _ = s.HandleTriggerEvent(ctx, spec, compensationData)
+		} else {
+			status = model.StageStatus{
+				Stage:   step.Compensation,
+				Outputs: map[string]interface{}{},
+			}
+			s.setStageStatus(&status, "", v1alpha2.BadConfig, fmt.Sprintf("compensation stage %s is not found", step.Compensation))
+		}
+		status.CompensatedStage = step.Stage
+		if status.Status != v1alpha2.Done {
+			log.ErrorfCtx(ctx, " M (Stage): compensation stage %s for stage %s failed: %s", step.Compensation, step.Stage, status.ErrorMessage)
+		}
+		if err = report(status); err != nil {
+			log.ErrorfCtx(ctx, " M (Stage): failed to report compensation of stage %s: %v", step.Stage, err)
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *StageManager) HandleActivationEvent(ctx context.Context, actData v1alpha2.ActivationData, campaignversion model.CampaignVersionSpec, activation model.ActivationState) (*v1alpha2.ActivationData, error) {
 	stage := actData.Stage
 	if _, ok := campaignversion.Stages[stage]; !ok {
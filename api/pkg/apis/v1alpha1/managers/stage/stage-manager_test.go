@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -2208,3 +2209,187 @@ func TestStageWithoutRetryFailsImmediately(t *testing.T) {
 	assert.Equal(t, v1alpha2.InternalError, status.Status)
 	assert.Equal(t, 1, flaky.GetCallCount("retry-none"))
 }
+
+func TestStageTimeout(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	manager := StageManager{
+		StateProvider: stateProvider,
+	}
+	manager.VendorContext = &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{},
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: "fake",
+		},
+	}
+	manager.Context = &contexts.ManagerContext{
+		VencorContext: manager.VendorContext,
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: "fake",
+		},
+	}
+	activation := v1alpha2.ActivationData{
+		CampaignVersion:      "test-campaignversion",
+		Activation:           "test-activation",
+		Stage:                "test",
+		ActivationGeneration: "1",
+		Provider:             "providers.stage.delay",
+		Namespace:            "fakens",
+	}
+	timeStamp := time.Now().UTC()
+	status, next := manager.HandleTriggerEvent(context.Background(), model.CampaignVersionSpec{
+		SelfDriving: true,
+		FirstStage:  "test",
+		Stages: map[string]model.StageSpec{
+			"test": {
+				Provider: "providers.stage.delay",
+				Timeout:  "100ms",
+				Inputs: map[string]interface{}{
+					"delay": "5s",
+				},
+			},
+		},
+	}, activation)
+	assert.Nil(t, next)
+	assert.Equal(t, v1alpha2.InternalError, status.Status)
+	assert.Equal(t, v1alpha2.TimedOut, status.Outputs["status"])
+	assert.Contains(t, status.Outputs["error"], "timed out after 100ms")
+	assert.True(t, time.Now().UTC().Sub(timeStamp) < 5*time.Second)
+}
+
+func TestProcessWithTimeout(t *testing.T) {
+	outputs, _, err := processWithTimeout(context.Background(), "", func(ctx context.Context) (map[string]interface{}, bool, error) {
+		return map[string]interface{}{"a": "b"}, false, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "b", outputs["a"])
+
+	_, _, err = processWithTimeout(context.Background(), "10ms", func(ctx context.Context) (map[string]interface{}, bool, error) {
+		<-ctx.Done()
+		return nil, false, ctx.Err()
+	})
+	coaErr, ok := err.(v1alpha2.COAError)
+	assert.True(t, ok)
+	assert.Equal(t, v1alpha2.TimedOut, coaErr.State)
+
+	_, _, err = processWithTimeout(context.Background(), "invalid", func(ctx context.Context) (map[string]interface{}, bool, error) {
+		return nil, false, nil
+	})
+	coaErr, ok = err.(v1alpha2.COAError)
+	assert.True(t, ok)
+	assert.Equal(t, v1alpha2.BadConfig, coaErr.State)
+
+	// a provider that stops on the cancellation is waited for
+	var stopped atomic.Bool
+	_, _, err = processWithTimeout(context.Background(), "10ms", func(ctx context.Context) (map[string]interface{}, bool, error) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		stopped.Store(true)
+		return nil, false, ctx.Err()
+	})
+	assert.NotNil(t, err)
+	assert.True(t, stopped.Load())
+
+	// a provider that ignores the cancellation is abandoned
+	abandonTimeout = 50 * time.Millisecond
+	defer func() { abandonTimeout = 5 * time.Second }()
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	_, _, err = processWithTimeout(context.Background(), "10ms", func(ctx context.Context) (map[string]interface{}, bool, error) {
+		<-release
+		return nil, false, nil
+	})
+	coaErr, ok = err.(v1alpha2.COAError)
+	assert.True(t, ok)
+	assert.Equal(t, v1alpha2.TimedOut, coaErr.State)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestGetCompensationSteps(t *testing.T) {
+	manager := StageManager{}
+	spec := model.CampaignVersionSpec{
+		Stages: map[string]model.StageSpec{
+			"a":      {Provider: "providers.stage.mock", Compensation: "undo-a"},
+			"b":      {Provider: "providers.stage.mock", Compensation: "undo-b"},
+			"c":      {Provider: "providers.stage.mock"},
+			"undo-a": {Provider: "providers.stage.mock"},
+			"undo-b": {Provider: "providers.stage.mock"},
+		},
+	}
+	steps := manager.GetCompensationSteps(spec, []model.StageStatus{
+		{Stage: "a", Status: v1alpha2.Done},
+		{Stage: "b", Status: v1alpha2.Done},
+		{Stage: "a", Status: v1alpha2.Done},
+		{Stage: "c", Status: v1alpha2.InternalError},
+	})
+	assert.Equal(t, []CompensationStep{
+		{Stage: "a", Compensation: "undo-a"},
+		{Stage: "b", Compensation: "undo-b"},
+	}, steps)
+
+	steps = manager.GetCompensationSteps(spec, []model.StageStatus{
+		{Stage: "a", Status: v1alpha2.Done},
+		{Stage: "b", Status: v1alpha2.InternalError},
+	})
+	assert.Equal(t, []CompensationStep{
+		{Stage: "a", Compensation: "undo-a"},
+	}, steps)
+}
+
+func TestHandleCompensation(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	manager := StageManager{
+		StateProvider: stateProvider,
+	}
+	manager.VendorContext = &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{},
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: "fake",
+		},
+	}
+	manager.Context = &contexts.ManagerContext{
+		VencorContext: manager.VendorContext,
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: "fake",
+		},
+	}
+	spec := model.CampaignVersionSpec{
+		SelfDriving: true,
+		FirstStage:  "a",
+		Stages: map[string]model.StageSpec{
+			"a":      {Provider: "providers.stage.mock", StageSelector: "b", Compensation: "undo-a"},
+			"b":      {Provider: "providers.stage.mock", StageSelector: "c", Compensation: "undo-b"},
+			"c":      {Provider: "providers.stage.mock"},
+			"undo-a": {Provider: "providers.stage.mock", StageSelector: "a"},
+			"undo-b": {Provider: "providers.stage.mock", Compensation: "missing"},
+		},
+	}
+	history := []model.StageStatus{
+		{Stage: "a", NextStage: "b", Status: v1alpha2.Done, Outputs: map[string]interface{}{"foo": "bar"}},
+		{Stage: "b", NextStage: "c", Status: v1alpha2.Done},
+		{Stage: "c", Status: v1alpha2.InternalError},
+	}
+	reported := make([]model.StageStatus, 0)
+	err := manager.HandleCompensation(context.Background(), spec, v1alpha2.ActivationData{
+		CampaignVersion:      "test-campaignversion",
+		Activation:           "test-activation",
+		Stage:                "c",
+		ActivationGeneration: "1",
+		Namespace:            "fakens",
+	}, history, func(status model.StageStatus) error {
+		reported = append(reported, status)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(reported))
+	assert.Equal(t, "undo-b", reported[0].Stage)
+	assert.Equal(t, "b", reported[0].CompensatedStage)
+	assert.Equal(t, v1alpha2.Done, reported[0].Status)
+	assert.Equal(t, "undo-a", reported[1].Stage)
+	assert.Equal(t, "a", reported[1].CompensatedStage)
+	assert.Equal(t, v1alpha2.Done, reported[1].Status)
+	// compensation stages never select a next stage
+	assert.Equal(t, "", reported[1].NextStage)
+}
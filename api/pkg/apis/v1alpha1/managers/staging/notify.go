@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package staging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/mqtt"
+	gmqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultPushTopicPrefix is the MQTT topic prefix job notifications are published under,
+	// followed by the site id
+	DefaultPushTopicPrefix = "symphony/federation"
+	// MaxSyncWait caps how long a site can wait for jobs in a single request
+	MaxSyncWait = 5 * time.Minute
+)
+
+// siteSignal tracks the job notifications of a site. The channel is closed and replaced
+// whenever jobs are queued for the site, waking up everyone waiting on it.
+type siteSignal struct {
+	seq uint64
+	ch  chan struct{}
+}
+
+// PushTopic returns the MQTT topic job notifications for a site are published to
+func PushTopic(prefix string, site string) string {
+	if prefix == "" {
+		prefix = DefaultPushTopicPrefix
+	}
+	return strings.TrimRight(prefix, "/") + "/" + site
+}
+
+func (s *StagingManager) initNotifier(properties map[string]string) error {
+	s.pushTopicPrefix = properties["push.mqtt.topicPrefix"]
+	config, err := mqtt.ConfigFromProperties(properties, "push.mqtt.")
+	if err != nil {
+		return err
+	}
+	if config.BrokerAddress == "" {
+		return nil
+	}
+	if config.ClientID == "" {
+		config.ClientID = "symphony-staging-" + uuid.New().String()
+	}
+	opts, err := mqtt.NewClientOptions(config)
+	if err != nil {
+		return err
+	}
+	// the broker may come up after the control plane, notifications are best effort and
+	// sites keep polling until they're connected
+	opts.SetConnectRetry(true)
+	opts.SetAutoReconnect(true)
+	s.notifier = gmqtt.NewClient(opts)
+	s.notifier.Connect()
+	return nil
+}
+
+func (s *StagingManager) signalFor(site string) *siteSignal {
+	if s.signals == nil {
+		s.signals = make(map[string]*siteSignal)
+	}
+	if s.epoch == "" {
+		s.epoch = uuid.New().String()
+	}
+	signal, ok := s.signals[site]
+	if !ok {
+		signal = &siteSignal{ch: make(chan struct{})}
+		s.signals[site] = signal
+	}
+	return signal
+}
+
+// Cursor returns the current notification cursor of a site. Cursors change whenever jobs
+// are queued for the site, and cursors handed out before a restart never match again.
+func (s *StagingManager) Cursor(site string) string {
+	s.signalLock.Lock()
+	defer s.signalLock.Unlock()
+	return fmt.Sprintf("%s:%d", s.epoch, s.signalFor(site).seq)
+}
+
+// WaitForJobs blocks until jobs are queued for a site after the given cursor, the timeout
+// elapses or the context is done. It returns true if the cursor has moved on.
+func (s *StagingManager) WaitForJobs(ctx context.Context, site string, cursor string, timeout time.Duration) bool {
+	s.signalLock.Lock()
+	signal := s.signalFor(site)
+	if cursor != fmt.Sprintf("%s:%d", s.epoch, signal.seq) {
+		s.signalLock.Unlock()
+		return true
+	}
+	ch := signal.ch
+	s.signalLock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// notify moves the cursor of a site on, wakes up its waiting requests and, if configured,
+// publishes the new cursor to the site's MQTT topic
+func (s *StagingManager) notify(site string) {
+	if site == "" {
+		return
+	}
+	s.signalLock.Lock()
+	signal := s.signalFor(site)
+	signal.seq++
+	close(signal.ch)
+	signal.ch = make(chan struct{})
+	cursor := fmt.Sprintf("%s:%d", s.epoch, signal.seq)
+	s.signalLock.Unlock()
+
+	if s.notifier == nil || !s.notifier.IsConnectionOpen() {
+		return
+	}
+	data, _ := json.Marshal(model.SyncNotification{
+		Site:   site,
+		Cursor: cursor,
+	})
+	// the notification is retained, so a site that (re)subscribes picks up the latest
+	// cursor and catches up on what it missed
+	token := s.notifier.Publish(PushTopic(s.pushTopicPrefix, site), 1, true, data)
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			log.Errorf(" M (Staging): Failed to notify site %s: %s", site, token.Error().Error())
+		}
+	}()
+}
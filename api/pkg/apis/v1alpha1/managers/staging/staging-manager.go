@@ -9,6 +9,8 @@ package staging
 import (
 	"context"
 	"encoding/json"
+	"sync"
+	"time"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
@@ -22,6 +24,7 @@ import (
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
 
 	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	gmqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 var log = logger.NewLogger("coa.runtime")
@@ -31,9 +34,24 @@ type StagingManager struct {
 	QueueProvider queue.IQueueProvider
 	StateProvider states.IStateProvider
 	apiClient     utils.ApiClient
+	// visibilityTimeout is how long jobs handed to a site stay invisible before they're
+	// delivered again, unless the site acknowledges them
+	visibilityTimeout time.Duration
+	// queueLock serializes changes to the site queues, so jobs aren't handed out or enqueued
+	// while ExpireJobsForSite rotates a queue
+	queueLock sync.Mutex
+	// job notifications let sites wait for work instead of polling for it
+	signalLock      sync.Mutex
+	signals         map[string]*siteSignal
+	epoch           string
+	notifier        gmqtt.Client
+	pushTopicPrefix string
 }
 
-const Site_Job_Queue = "site-job-queue"
+const (
+	Site_Job_Queue           = "site-job-queue"
+	defaultVisibilityTimeout = 5 * time.Minute
+)
 
 func (s *StagingManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
 	err := s.Manager.Init(context, config, providers)
@@ -56,7 +74,14 @@ func (s *StagingManager) Init(context *contexts.VendorContext, config managers.M
 	if err != nil {
 		return err
 	}
-	return nil
+	s.visibilityTimeout = defaultVisibilityTimeout
+	if v, ok := config.Properties["visibilityTimeout"]; ok && v != "" {
+		s.visibilityTimeout, err = time.ParseDuration(v)
+		if err != nil || s.visibilityTimeout <= 0 {
+			return v1alpha2.NewCOAError(err, "invalid visibilityTimeout: "+v, v1alpha2.BadConfig)
+		}
+	}
+	return s.initNotifier(config.Properties)
 }
 func (s *StagingManager) Enabled() bool {
 	return s.Config.Properties["poll.enabled"] == "true"
@@ -80,6 +105,12 @@ func (s *StagingManager) Poll() []error {
 		return []error{err}
 	}
 	siteId := utils.FormatAsString(site)
+	queued := false
+	defer func() {
+		if queued {
+			s.notify(siteId)
+		}
+	}()
 	var catalogversions []model.CatalogVersionState
 	catalogversions, err = s.apiClient.GetCatalogVersions(ctx, "",
 		s.VendorContext.SiteInfo.CurrentSite.Username,
@@ -112,6 +143,7 @@ func (s *StagingManager) Poll() []error {
 			Action: v1alpha2.JobUpdate,
 			Body:   catalogversion,
 		})
+		queued = true
 
 		// TODO: clean up the catalogversion synchronization status for multi-site
 		_, err = s.StateProvider.Upsert(ctx, states.UpsertRequest{
@@ -135,9 +167,15 @@ func (s *StagingManager) Poll() []error {
 func (s *StagingManager) Reconcil() []error {
 	return nil
 }
+func (s *StagingManager) Shutdown(ctx context.Context) error {
+	if s.notifier != nil {
+		s.notifier.Disconnect(250)
+	}
+	return nil
+}
 
 func (s *StagingManager) HandleJobEvent(ctx context.Context, event v1alpha2.Event) error {
-	_, span := observability.StartSpan("Staging Manager", ctx, &map[string]string{
+	ctx, span := observability.StartSpan("Staging Manager", ctx, &map[string]string{
 		"method": "HandleJobEvent",
 	})
 	var err error = nil
@@ -151,21 +189,59 @@ func (s *StagingManager) HandleJobEvent(ctx context.Context, event v1alpha2.Even
 		err = v1alpha2.NewCOAError(nil, "event body is not a job", v1alpha2.BadRequest)
 		return err
 	}
+	if job.Action == v1alpha2.JobDelete {
+		// forget the synced version, so the catalog version is synced again if it's recreated
+		var catalogversion model.CatalogVersionState
+		jData, _ = json.Marshal(job.Body)
+		if json.Unmarshal(jData, &catalogversion) == nil {
+			err = s.StateProvider.Delete(ctx, states.DeleteRequest{
+				ID: event.Metadata["site"] + "-" + job.Id,
+				Metadata: map[string]interface{}{
+					"version":   "v1",
+					"group":     model.FederationGroup,
+					"resource":  "catalogversions",
+					"namespace": catalogversion.ObjectMeta.Namespace,
+				},
+			})
+			if err != nil && !utils.IsNotFound(err) {
+				log.Errorf(" M (Staging): Failed to clean up catalogversion %s: %s", job.Id, err.Error())
+			}
+			err = nil
+		}
+	}
+	s.queueLock.Lock()
 	s.QueueProvider.Enqueue(Site_Job_Queue, event.Metadata["site"])
-	return s.QueueProvider.Enqueue(event.Metadata["site"], job)
+	err = s.QueueProvider.Enqueue(event.Metadata["site"], job)
+	s.queueLock.Unlock()
+	if err != nil {
+		return err
+	}
+	s.notify(event.Metadata["site"])
+	return nil
 }
-func (s *StagingManager) GetABatchForSite(site string, count int) ([]v1alpha2.JobData, error) {
+
+// GetABatchForSite returns up to count jobs for a site. When the site acknowledges jobs (ack)
+// and the queue provider supports acknowledged delivery, the jobs stay in flight and a receipt
+// is returned for each job; the site acknowledges the receipts with AckBatchForSite once it
+// has processed the jobs, otherwise the jobs are delivered again after the visibility timeout.
+// Otherwise the jobs are removed from the queue and receipts are nil.
+func (s *StagingManager) GetABatchForSite(site string, count int, ack bool) ([]v1alpha2.JobData, []string, error) {
 	//TODO: this should return a group of jobs as optimization
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
 	s.QueueProvider.Enqueue(Site_Job_Queue, site)
+	if reliableQueue, ok := s.QueueProvider.(queue.IReliableQueueProvider); ok && ack {
+		return s.receiveBatch(reliableQueue, site, count)
+	}
 	if s.QueueProvider.Size(site) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	items := []v1alpha2.JobData{}
 	itemCount := 0
 	for {
 		queueElement, err := s.QueueProvider.Dequeue(site)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if job, ok := queueElement.(v1alpha2.JobData); ok {
 			items = append(items, job)
@@ -177,5 +253,126 @@ func (s *StagingManager) GetABatchForSite(site string, count int) ([]v1alpha2.Jo
 			break
 		}
 	}
-	return items, nil
+	return items, nil, nil
+}
+
+func (s *StagingManager) receiveBatch(reliableQueue queue.IReliableQueueProvider, site string, count int) ([]v1alpha2.JobData, []string, error) {
+	timeout := s.visibilityTimeout
+	if timeout <= 0 {
+		timeout = defaultVisibilityTimeout
+	}
+	messages, err := reliableQueue.Receive(site, count, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil, nil
+	}
+	items := make([]v1alpha2.JobData, 0, len(messages))
+	receipts := make([]string, 0, len(messages))
+	invalid := []string{}
+	for _, message := range messages {
+		job, ok := message.Body.(v1alpha2.JobData)
+		if !ok {
+			// persistent queues return decoded JSON rather than the enqueued type
+			data, _ := json.Marshal(message.Body)
+			if json.Unmarshal(data, &job) != nil || job.Id == "" {
+				log.Errorf(" M (Staging): Dropping queue element %s for site %s as it's not a job", message.ID, site)
+				invalid = append(invalid, message.ID)
+				continue
+			}
+		}
+		items = append(items, job)
+		receipts = append(receipts, message.ID)
+	}
+	if len(invalid) > 0 {
+		reliableQueue.Ack(site, invalid)
+	}
+	return items, receipts, nil
+}
+
+// AckBatchForSite acknowledges jobs a site has processed, so they aren't delivered again
+func (s *StagingManager) AckBatchForSite(site string, receipts []string) error {
+	if len(receipts) == 0 {
+		return nil
+	}
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	reliableQueue, ok := s.QueueProvider.(queue.IReliableQueueProvider)
+	if !ok {
+		// jobs were removed from the queue when they were delivered
+		return nil
+	}
+	return reliableQueue.Ack(site, receipts)
+}
+
+// ExpireJobsForSite removes the pending run jobs of a site and returns them, including run jobs
+// the site has received but not acknowledged. Catalog jobs stay queued, so the site catches up
+// on catalogs when it's back.
+func (s *StagingManager) ExpireJobsForSite(site string) ([]v1alpha2.JobData, error) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	expired := make([]v1alpha2.JobData, 0)
+	if reliableQueue, ok := s.QueueProvider.(queue.IReliableQueueProvider); ok {
+		messages, err := reliableQueue.InFlightMessages(site)
+		if err != nil {
+			return expired, err
+		}
+		receipts := make([]string, 0)
+		for _, message := range messages {
+			if job, ok := toJob(message.Body); ok && job.Action == v1alpha2.JobRun {
+				expired = append(expired, job)
+				receipts = append(receipts, message.ID)
+			}
+		}
+		// acknowledging the leases keeps the jobs from being delivered again; a late
+		// acknowledgement of the site is ignored
+		if err = reliableQueue.Ack(site, receipts); err != nil {
+			return expired, err
+		}
+	}
+	for pending := s.QueueProvider.Size(site); pending > 0; pending-- {
+		element, err := s.QueueProvider.Dequeue(site)
+		if err != nil {
+			return expired, err
+		}
+		if job, ok := toJob(element); ok && job.Action == v1alpha2.JobRun {
+			expired = append(expired, job)
+			continue
+		}
+		if err = s.QueueProvider.Enqueue(site, element); err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// toJob converts a queue element to a job. Persistent queues return decoded JSON rather than
+// the enqueued type.
+func toJob(element interface{}) (v1alpha2.JobData, bool) {
+	job, ok := element.(v1alpha2.JobData)
+	if !ok {
+		data, _ := json.Marshal(element)
+		ok = json.Unmarshal(data, &job) == nil
+	}
+	return job, ok
+}
+
+// GetQueueStatus reports the pending, in-flight and dead-lettered jobs of a site
+func (s *StagingManager) GetQueueStatus(site string) (model.SiteQueueStatus, error) {
+	status := model.SiteQueueStatus{
+		Site:    site,
+		Pending: s.QueueProvider.Size(site),
+	}
+	reliableQueue, ok := s.QueueProvider.(queue.IReliableQueueProvider)
+	if !ok {
+		return status, nil
+	}
+	status.InFlight = reliableQueue.InFlight(site)
+	deadLetters, err := reliableQueue.DeadLetters(site)
+	if err != nil {
+		return status, err
+	}
+	status.DeadLetters = deadLetters
+	return status, nil
 }
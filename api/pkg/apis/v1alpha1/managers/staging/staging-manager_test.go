@@ -13,12 +13,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/eclipse-symphony/symphony/api/constants"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue"
 	memoryqueue "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue/memory"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
@@ -116,6 +118,60 @@ func TestHandleJobEvent(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, "fake", site.(string))
 }
+func TestHandleJobEventDelete(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
+
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+
+	manager := StagingManager{
+		StateProvider: stateProvider,
+		QueueProvider: queueProvider,
+	}
+	metadata := map[string]interface{}{
+		"version":   "v1",
+		"group":     model.FederationGroup,
+		"resource":  "catalogversions",
+		"namespace": "default",
+	}
+	_, err := stateProvider.Upsert(context.Background(), states.UpsertRequest{
+		Value: states.StateEntry{
+			ID:   "fake-catalogversion1",
+			Body: "1",
+		},
+		Metadata: metadata,
+	})
+	assert.Nil(t, err)
+
+	err = manager.HandleJobEvent(context.Background(), v1alpha2.Event{
+		Metadata: map[string]string{
+			"site": "fake",
+		},
+		Body: v1alpha2.JobData{
+			Id:     "catalogversion1",
+			Action: v1alpha2.JobDelete,
+			Body: model.CatalogVersionState{
+				ObjectMeta: model.ObjectMeta{
+					Name:      "catalogversion1",
+					Namespace: "default",
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	// the synced version is forgotten, so a recreated catalog version is synced again
+	_, err = stateProvider.Get(context.Background(), states.GetRequest{
+		ID:       "fake-catalogversion1",
+		Metadata: metadata,
+	})
+	assert.True(t, utils.IsNotFound(err))
+	jobData, err := queueProvider.Dequeue("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.JobDelete, jobData.(v1alpha2.JobData).Action)
+}
+
 func TestGetABatchForSite(t *testing.T) {
 	queueProvider := &memoryqueue.MemoryQueueProvider{}
 	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
@@ -136,19 +192,277 @@ func TestGetABatchForSite(t *testing.T) {
 		Id:     "catalogversion2",
 		Action: v1alpha2.JobUpdate,
 	})
-	jobs, err := manager.GetABatchForSite("fake", 1)
+	jobs, receipts, err := manager.GetABatchForSite("fake", 1, true)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, 1, len(receipts))
 	assert.Equal(t, "catalogversion1", jobs[0].Id)
 	assert.Equal(t, v1alpha2.JobUpdate, jobs[0].Action)
 
-	jobs, err = manager.GetABatchForSite("fake", 1)
+	jobs, _, err = manager.GetABatchForSite("fake", 1, true)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(jobs))
 	assert.Equal(t, "catalogversion2", jobs[0].Id)
 	assert.Equal(t, v1alpha2.JobUpdate, jobs[0].Action)
 }
 
+func TestExpireJobsForSite(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
+
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+
+	manager := StagingManager{
+		StateProvider: stateProvider,
+		QueueProvider: queueProvider,
+	}
+
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion1",
+		Action: v1alpha2.JobUpdate,
+	})
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Action: v1alpha2.JobRun,
+		Body:   v1alpha2.InputOutputData{Inputs: map[string]interface{}{"__stage": "stage1"}},
+	})
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion2",
+		Action: v1alpha2.JobUpdate,
+	})
+	jobs, err := manager.ExpireJobsForSite("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, v1alpha2.JobRun, jobs[0].Action)
+
+	// catalog jobs stay queued in order
+	jobs, _, err = manager.GetABatchForSite("fake", 5, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(jobs))
+	assert.Equal(t, "catalogversion1", jobs[0].Id)
+	assert.Equal(t, "catalogversion2", jobs[1].Id)
+
+	jobs, err = manager.ExpireJobsForSite("empty")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs))
+}
+
+func TestExpireLeasedJobsForSite(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
+
+	manager := StagingManager{
+		QueueProvider: queueProvider,
+	}
+
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "run1",
+		Action: v1alpha2.JobRun,
+	})
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion1",
+		Action: v1alpha2.JobUpdate,
+	})
+	jobs, receipts, err := manager.GetABatchForSite("fake", 5, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(jobs))
+
+	// the site went offline before acknowledging the batch
+	jobs, err = manager.ExpireJobsForSite("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "run1", jobs[0].Id)
+	assert.Equal(t, 1, queueProvider.InFlight("fake"))
+
+	// a late acknowledgement of the expired job is ignored
+	err = manager.AckBatchForSite("fake", receipts)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, queueProvider.InFlight("fake"))
+}
+
+func TestAckBatchForSite(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
+
+	manager := StagingManager{
+		QueueProvider:     queueProvider,
+		visibilityTimeout: 50 * time.Millisecond,
+	}
+
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion1",
+		Action: v1alpha2.JobUpdate,
+	})
+	jobs, receipts, err := manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, 1, len(receipts))
+
+	// the job is in flight until it's acknowledged or its visibility timeout expires
+	jobs, _, err = manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs))
+	time.Sleep(100 * time.Millisecond)
+	jobs, receipts, err = manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "catalogversion1", jobs[0].Id)
+
+	err = manager.AckBatchForSite("fake", receipts)
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+	jobs, _, err = manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs))
+
+	status, err := manager.GetQueueStatus("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, status.Pending)
+	assert.Equal(t, 0, status.InFlight)
+	assert.Equal(t, 0, len(status.DeadLetters))
+}
+
+func TestGetQueueStatusWithDeadLetters(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{MaxDeliveries: 1})
+
+	manager := StagingManager{
+		QueueProvider:     queueProvider,
+		visibilityTimeout: 50 * time.Millisecond,
+	}
+
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion1",
+		Action: v1alpha2.JobUpdate,
+	})
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion2",
+		Action: v1alpha2.JobUpdate,
+	})
+	jobs, _, err := manager.GetABatchForSite("fake", 1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+
+	status, err := manager.GetQueueStatus("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, "fake", status.Site)
+	assert.Equal(t, 1, status.Pending)
+	assert.Equal(t, 1, status.InFlight)
+
+	// the unacknowledged job reached the maximum deliveries
+	time.Sleep(100 * time.Millisecond)
+	jobs, _, err = manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Equal(t, "catalogversion2", jobs[0].Id)
+	status, err = manager.GetQueueStatus("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(status.DeadLetters))
+	assert.Equal(t, "catalogversion1", status.DeadLetters[0].Body.(v1alpha2.JobData).Id)
+}
+
+func TestGetABatchForSiteWithoutAck(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{MaxDeliveries: 1})
+
+	manager := StagingManager{
+		QueueProvider:     queueProvider,
+		visibilityTimeout: 50 * time.Millisecond,
+	}
+
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion1",
+		Action: v1alpha2.JobUpdate,
+	})
+	// sites that don't acknowledge batches get the jobs removed from the queue
+	jobs, receipts, err := manager.GetABatchForSite("fake", 10, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Nil(t, receipts)
+
+	time.Sleep(100 * time.Millisecond)
+	jobs, _, err = manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs))
+	status, err := manager.GetQueueStatus("fake")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, status.InFlight)
+	assert.Equal(t, 0, len(status.DeadLetters))
+}
+
+type unacknowledgedQueue struct {
+	queue.IQueueProvider
+}
+
+func TestGetABatchForSiteWithoutAcknowledgements(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
+
+	manager := StagingManager{
+		QueueProvider: unacknowledgedQueue{queueProvider},
+	}
+
+	queueProvider.Enqueue("fake", v1alpha2.JobData{
+		Id:     "catalogversion1",
+		Action: v1alpha2.JobUpdate,
+	})
+	jobs, receipts, err := manager.GetABatchForSite("fake", 10, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jobs))
+	assert.Nil(t, receipts)
+	assert.Equal(t, 0, queueProvider.Size("fake"))
+	assert.Nil(t, manager.AckBatchForSite("fake", []string{"any"}))
+}
+
+func TestWaitForJobs(t *testing.T) {
+	queueProvider := &memoryqueue.MemoryQueueProvider{}
+	queueProvider.Init(memoryqueue.MemoryQueueProviderConfig{})
+
+	manager := StagingManager{
+		QueueProvider: queueProvider,
+	}
+	cursor := manager.Cursor("fake")
+	assert.Equal(t, cursor, manager.Cursor("fake"))
+
+	// nothing is queued, the wait times out
+	assert.False(t, manager.WaitForJobs(context.Background(), "fake", cursor, 10*time.Millisecond))
+
+	// a stale cursor returns right away
+	assert.True(t, manager.WaitForJobs(context.Background(), "fake", "stale:0", time.Minute))
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- manager.WaitForJobs(context.Background(), "fake", cursor, time.Minute)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	err := manager.HandleJobEvent(context.Background(), v1alpha2.Event{
+		Metadata: map[string]string{
+			"site": "fake",
+		},
+		Body: v1alpha2.JobData{
+			Id:     "job1",
+			Action: v1alpha2.JobRun,
+		},
+	})
+	assert.Nil(t, err)
+	select {
+	case moved := <-done:
+		assert.True(t, moved)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "waiting for jobs didn't wake up")
+	}
+	assert.NotEqual(t, cursor, manager.Cursor("fake"))
+
+	// cursors are tracked per site
+	other := manager.Cursor("other")
+	assert.False(t, manager.WaitForJobs(context.Background(), "other", other, 10*time.Millisecond))
+}
+
+func TestPushTopic(t *testing.T) {
+	assert.Equal(t, "symphony/federation/site1", PushTopic("", "site1"))
+	assert.Equal(t, "sites/site1", PushTopic("sites/", "site1"))
+}
+
 func InitializeMockSymphonyAPI() *httptest.Server {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var response interface{}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sync
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+)
+
+const defaultRenewBefore = 30 * 24 * time.Hour
+
+type enrollmentConfig struct {
+	Enabled  bool
+	KeyPath  string
+	CertPath string
+	// RenewBefore is how long before its certificate expires the site requests a new one
+	RenewBefore time.Duration
+}
+
+func readEnrollmentConfig(properties map[string]string) (enrollmentConfig, error) {
+	config := enrollmentConfig{
+		Enabled:     properties["enrollment.enabled"] == "true",
+		KeyPath:     properties["enrollment.keyPath"],
+		CertPath:    properties["enrollment.certPath"],
+		RenewBefore: defaultRenewBefore,
+	}
+	if !config.Enabled {
+		return config, nil
+	}
+	if config.KeyPath == "" || config.CertPath == "" {
+		return config, v1alpha2.NewCOAError(nil, "enrollment.keyPath and enrollment.certPath are required for enrollment", v1alpha2.MissingConfig)
+	}
+	if v := properties["enrollment.renewBefore"]; v != "" {
+		renewBefore, err := time.ParseDuration(v)
+		if err != nil || renewBefore < 0 {
+			return config, v1alpha2.NewCOAError(err, "invalid enrollment.renewBefore: "+v, v1alpha2.BadConfig)
+		}
+		config.RenewBefore = renewBefore
+	}
+	return config, nil
+}
+
+// pendingKeyPath is where the key of a renewal is kept until its certificate is issued
+func (c enrollmentConfig) pendingKeyPath() string {
+	return c.KeyPath + ".pending"
+}
+
+// initIdentity loads the site key, generating it on first start, and the certificate issued
+// for it, if the site is enrolled
+func (s *SyncManager) initIdentity() error {
+	if s.identity == nil {
+		s.identity = utils.ParentSiteIdentity()
+	}
+	keyPEM, err := readOrGenerateKey(s.enrollment.KeyPath)
+	if err != nil {
+		return err
+	}
+	certPEM, err := os.ReadFile(s.enrollment.CertPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to read site certificate", v1alpha2.InternalError)
+	}
+	err = s.identity.Load(s.Context.SiteInfo.SiteId, keyPEM, certPEM)
+	if err == nil {
+		return nil
+	}
+	// a renewal may have been interrupted after its certificate was saved
+	if pendingPEM, pendingErr := os.ReadFile(s.enrollment.pendingKeyPath()); pendingErr == nil &&
+		s.identity.Load(s.Context.SiteInfo.SiteId, pendingPEM, certPEM) == nil {
+		return os.Rename(s.enrollment.pendingKeyPath(), s.enrollment.KeyPath)
+	}
+	// the site enrolls again, for instance when its key was replaced
+	log.Errorf(" M (Sync): failed to load site certificate, enrolling again: %v", err)
+	return nil
+}
+
+func readOrGenerateKey(path string) ([]byte, error) {
+	keyPEM, err := os.ReadFile(path)
+	if err == nil {
+		return keyPEM, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, v1alpha2.NewCOAError(err, "failed to read site key", v1alpha2.InternalError)
+	}
+	keyPEM, err = utils.GenerateSiteKey()
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to generate site key", v1alpha2.InternalError)
+	}
+	if err = os.WriteFile(path, keyPEM, 0600); err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to save site key", v1alpha2.InternalError)
+	}
+	return keyPEM, nil
+}
+
+// enroll requests a certificate from the parent site when the site isn't enrolled or its
+// certificate is about to expire, and installs the certificate once it's issued. A new
+// enrollment waits for approval at the parent site; a renewal is signed with the current
+// certificate and issued right away.
+func (s *SyncManager) enroll(ctx context.Context) error {
+	if !s.enrollment.Enabled {
+		return nil
+	}
+	site := s.Context.SiteInfo.SiteId
+	keyPath := s.enrollment.KeyPath
+	if cert := s.identity.Certificate(); cert != nil {
+		if time.Until(cert.NotAfter) > s.enrollment.RenewBefore {
+			return nil
+		}
+		// renewals rotate the key, which replaces the current one once the certificate is issued
+		keyPath = s.enrollment.pendingKeyPath()
+	}
+	keyPEM, err := readOrGenerateKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	var enrollment model.SiteEnrollment
+	if s.requestedKey != keyPath {
+		var csr []byte
+		csr, err = utils.CreateSiteCSR(site, keyPEM)
+		if err != nil {
+			return v1alpha2.NewCOAError(err, "failed to create certificate signing request", v1alpha2.InternalError)
+		}
+		enrollment, err = s.apiClient.EnrollSite(ctx, model.SiteEnrollmentRequest{
+			Site: site,
+			CSR:  string(csr),
+		}, s.VendorContext.SiteInfo.ParentSite.Username, s.VendorContext.SiteInfo.ParentSite.Password)
+		if err != nil {
+			return err
+		}
+		s.requestedKey = keyPath
+	} else {
+		enrollment, err = s.apiClient.GetSiteEnrollment(ctx, site,
+			s.VendorContext.SiteInfo.ParentSite.Username, s.VendorContext.SiteInfo.ParentSite.Password)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch enrollment.State {
+	case model.SiteEnrollmentPending:
+		log.InfofCtx(ctx, " M (Sync): enrollment of site %s is waiting for approval", site)
+		return nil
+	case model.SiteEnrollmentRevoked:
+		s.requestedKey = ""
+		return v1alpha2.NewCOAError(nil, "enrollment of site "+site+" is revoked", v1alpha2.Forbidden)
+	}
+	if !certificateMatches(enrollment.Certificate, keyPEM) {
+		// the parent still has a certificate for another key, request one for this key
+		s.requestedKey = ""
+		return v1alpha2.NewCOAError(nil, "issued certificate doesn't match the site key", v1alpha2.InternalError)
+	}
+	if err = s.identity.Load(site, keyPEM, []byte(enrollment.Certificate)); err != nil {
+		return err
+	}
+	if err = os.WriteFile(s.enrollment.CertPath, []byte(enrollment.Certificate), 0644); err != nil {
+		return v1alpha2.NewCOAError(err, "failed to save site certificate", v1alpha2.InternalError)
+	}
+	if keyPath != s.enrollment.KeyPath {
+		if err = os.Rename(keyPath, s.enrollment.KeyPath); err != nil {
+			return v1alpha2.NewCOAError(err, "failed to replace site key", v1alpha2.InternalError)
+		}
+	}
+	s.requestedKey = ""
+	log.InfofCtx(ctx, " M (Sync): site %s is enrolled until %s", site, enrollment.NotAfter)
+	return nil
+}
+
+func certificateMatches(certPEM string, keyPEM []byte) bool {
+	_, err := tls.X509KeyPair([]byte(certPEM), keyPEM)
+	return err == nil
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/staging"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/mqtt"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	gmqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var log = logger.NewLogger("coa.runtime")
+
+const (
+	// PushModeLongPoll holds a sync request at the parent site until jobs are queued
+	PushModeLongPoll = "longpoll"
+	// PushModeMQTT pulls jobs when the parent site notifies them over MQTT
+	PushModeMQTT = "mqtt"
+
+	defaultPushWait = 30 * time.Second
+	// pushGrace is how much longer than the wait a long poll may take before the push
+	// channel is considered down
+	pushGrace       = 15 * time.Second
+	minRetryBackoff = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+type pushConfig struct {
+	Mode  string
+	Wait  time.Duration
+	Topic string
+	MQTT  mqtt.MQTTBindingConfig
+}
+
+func readPushConfig(properties map[string]string, site string) (pushConfig, error) {
+	config := pushConfig{
+		Mode: properties["push.mode"],
+		Wait: defaultPushWait,
+	}
+	switch config.Mode {
+	case "", PushModeLongPoll, PushModeMQTT:
+	default:
+		return config, v1alpha2.NewCOAError(nil, "invalid push.mode: "+config.Mode, v1alpha2.BadConfig)
+	}
+	if v, ok := properties["push.wait"]; ok && v != "" {
+		wait, err := time.ParseDuration(v)
+		if err != nil || wait <= 0 || wait > staging.MaxSyncWait {
+			return config, v1alpha2.NewCOAError(err, "invalid push.wait: "+v, v1alpha2.BadConfig)
+		}
+		config.Wait = wait
+	}
+	if config.Mode != PushModeMQTT {
+		return config, nil
+	}
+	var err error
+	config.MQTT, err = mqtt.ConfigFromProperties(properties, "push.mqtt.")
+	if err != nil {
+		return config, err
+	}
+	if config.MQTT.BrokerAddress == "" {
+		return config, v1alpha2.NewCOAError(nil, "push.mqtt.brokerAddress is required for mqtt push mode", v1alpha2.MissingConfig)
+	}
+	if config.MQTT.ClientID == "" {
+		config.MQTT.ClientID = "symphony-sync-" + site
+	}
+	config.Topic = staging.PushTopic(properties["push.mqtt.topicPrefix"], site)
+	return config, nil
+}
+
+// Cursor returns the last notification cursor the site has processed
+func (s *SyncManager) Cursor() string {
+	s.batchLock.Lock()
+	defer s.batchLock.Unlock()
+	return s.cursor
+}
+
+func (s *SyncManager) startPush() error {
+	if s.push.Mode == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	switch s.push.Mode {
+	case PushModeLongPoll:
+		go s.longPoll(ctx)
+	case PushModeMQTT:
+		s.trigger = make(chan struct{}, 1)
+		opts, err := mqtt.NewClientOptions(s.push.MQTT)
+		if err != nil {
+			cancel()
+			return err
+		}
+		opts.SetConnectRetry(true)
+		opts.SetAutoReconnect(true)
+		opts.SetOnConnectHandler(func(client gmqtt.Client) {
+			token := client.Subscribe(s.push.Topic, 1, s.onNotification)
+			go func() {
+				if token.Wait() && token.Error() != nil {
+					log.Errorf(" M (Sync): Failed to subscribe to %s: %s", s.push.Topic, token.Error().Error())
+				}
+			}()
+			// catch up on the jobs queued while disconnected
+			s.pullSoon()
+		})
+		s.mqttClient = gmqtt.NewClient(opts)
+		s.mqttClient.Connect()
+		go s.pullOnNotification(ctx)
+	}
+	return nil
+}
+
+// pushHealthy reports whether the push channel is up, in which case polling is skipped
+func (s *SyncManager) pushHealthy() bool {
+	switch s.push.Mode {
+	case PushModeLongPoll:
+		last := s.lastContact.Load()
+		return last != 0 && time.Since(time.Unix(0, last)) < s.push.Wait+pushGrace
+	case PushModeMQTT:
+		return s.mqttClient != nil && s.mqttClient.IsConnectionOpen()
+	}
+	return false
+}
+
+func (s *SyncManager) longPoll(ctx context.Context) {
+	retry := minRetryBackoff
+	for ctx.Err() == nil {
+		_, err := s.pull(ctx, s.push.Wait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf(" M (Sync): Failed to wait for jobs, retrying in %s: %s", retry, err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			retry *= 2
+			if retry > maxRetryBackoff {
+				retry = maxRetryBackoff
+			}
+			continue
+		}
+		retry = minRetryBackoff
+		s.lastContact.Store(time.Now().UnixNano())
+		if s.Cursor() == "" {
+			// the parent site doesn't hold requests, don't hammer it
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.push.Wait):
+			}
+		}
+	}
+}
+
+func (s *SyncManager) onNotification(client gmqtt.Client, msg gmqtt.Message) {
+	var notification model.SyncNotification
+	if err := json.Unmarshal(msg.Payload(), &notification); err != nil {
+		log.Errorf(" M (Sync): Ignoring invalid job notification: %s", err.Error())
+		return
+	}
+	if notification.Cursor != "" && notification.Cursor == s.Cursor() {
+		// a retained notification for jobs the site has already pulled
+		return
+	}
+	s.pullSoon()
+}
+
+func (s *SyncManager) pullSoon() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+		// a pull is already pending
+	}
+}
+
+func (s *SyncManager) pullOnNotification(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.trigger:
+		}
+		// a batch is capped, keep pulling until the queue is drained
+		for ctx.Err() == nil {
+			count, err := s.pull(ctx, 0)
+			if err != nil {
+				log.Errorf(" M (Sync): Failed to pull notified jobs: %s", err.Error())
+				break
+			}
+			if count == 0 {
+				break
+			}
+		}
+	}
+}
+
+func (s *SyncManager) Shutdown(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.mqttClient != nil {
+		s.mqttClient.Disconnect(250)
+	}
+	return nil
+}
@@ -8,7 +8,12 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
@@ -16,11 +21,25 @@ import (
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
 	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	gmqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 type SyncManager struct {
 	managers.Manager
 	apiClient utils.ApiClient
+	// batchLock serializes the hand-over of batches pulled by polling and the push channel
+	batchLock sync.Mutex
+	cursor    string
+	push      pushConfig
+	// lastContact is when the push channel last heard from the parent site, in unix nanoseconds
+	lastContact atomic.Int64
+	mqttClient  gmqtt.Client
+	trigger     chan struct{}
+	cancel      context.CancelFunc
+	enrollment  enrollmentConfig
+	identity    *utils.SiteIdentity
+	// requestedKey is the key file a certificate was requested for, and not issued yet
+	requestedKey string
 }
 
 func (s *SyncManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
@@ -35,6 +54,23 @@ func (s *SyncManager) Init(context *contexts.VendorContext, config managers.Mana
 	if err != nil {
 		return err
 	}
+	s.push, err = readPushConfig(config.Properties, s.Context.SiteInfo.SiteId)
+	if err != nil {
+		return err
+	}
+	s.enrollment, err = readEnrollmentConfig(config.Properties)
+	if err != nil {
+		return err
+	}
+	if s.enrollment.Enabled {
+		err = s.initIdentity()
+		if err != nil {
+			return err
+		}
+	}
+	if s.Enabled() && s.VendorContext.SiteInfo.ParentSite.BaseUrl != "" {
+		return s.startPush()
+	}
 	return nil
 }
 func (s *SyncManager) Enabled() bool {
@@ -50,44 +86,158 @@ func (s *SyncManager) Poll() []error {
 	if s.VendorContext.SiteInfo.ParentSite.BaseUrl == "" {
 		return nil
 	}
-	batch, err := s.apiClient.GetABatchForSite(ctx, s.VendorContext.SiteInfo.SiteId,
-		s.VendorContext.SiteInfo.ParentSite.Username,
-		s.VendorContext.SiteInfo.ParentSite.Password)
+	err = s.enroll(ctx)
+	if err != nil {
+		log.ErrorfCtx(ctx, " M (Sync): failed to enroll site: %v", err)
+		if !s.identity.Ready() {
+			return []error{err}
+		}
+		// the current certificate is still valid, keep syncing while the renewal is retried
+		err = nil
+	}
+	if s.pushHealthy() {
+		// the push channel delivers the jobs, polling is the fallback when it's down
+		return nil
+	}
+	_, err = s.pull(ctx, 0)
 	if err != nil {
 		return []error{err}
 	}
+	return nil
+}
+
+// pull gets a batch of jobs from the parent site and hands it over. With a wait, the parent
+// holds the request until jobs are queued after the last cursor seen by the site. It returns
+// the number of items in the batch.
+func (s *SyncManager) pull(ctx context.Context, wait time.Duration) (int, error) {
+	var batch model.SyncPackage
+	var err error
+	if wait > 0 {
+		batch, err = s.apiClient.WaitForBatchForSite(ctx, s.VendorContext.SiteInfo.SiteId, s.Cursor(), wait,
+			s.VendorContext.SiteInfo.ParentSite.Username,
+			s.VendorContext.SiteInfo.ParentSite.Password)
+	} else {
+		batch, err = s.apiClient.GetABatchForSite(ctx, s.VendorContext.SiteInfo.SiteId,
+			s.VendorContext.SiteInfo.ParentSite.Username,
+			s.VendorContext.SiteInfo.ParentSite.Password)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.batchLock.Lock()
+	defer s.batchLock.Unlock()
+	err = s.processBatch(ctx, batch)
+	if err != nil {
+		return 0, err
+	}
+	if batch.Cursor != "" {
+		s.cursor = batch.Cursor
+	}
+	return len(batch.CatalogVersions) + len(batch.Tombstones) + len(batch.Jobs), nil
+}
+
+func (s *SyncManager) processBatch(ctx context.Context, batch model.SyncPackage) error {
+	var err error
 	if batch.CatalogVersions != nil {
 		for _, catalogversion := range batch.CatalogVersions {
-			s.Context.Publish("catalogversion-sync", v1alpha2.Event{
+			err = s.Context.Publish("catalogversion-sync", v1alpha2.Event{
 				Metadata: map[string]string{
 					"objectType": catalogversion.Spec.CatalogType,
 					"origin":     batch.Origin,
 				},
 				Body: v1alpha2.JobData{
 					Id:     catalogversion.ObjectMeta.Name,
-					Action: v1alpha2.JobUpdate, //TODO: handle deletion, this probably requires BetBachForSites return flags
+					Action: v1alpha2.JobUpdate,
 					Body:   catalogversion,
 				},
 				Context: ctx,
 			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, tombstone := range batch.Tombstones {
+		err = s.Context.Publish("catalogversion-sync", v1alpha2.Event{
+			Metadata: map[string]string{
+				"objectType": tombstone.CatalogType,
+				"origin":     batch.Origin,
+			},
+			Body: v1alpha2.JobData{
+				Id:     tombstone.Name,
+				Action: v1alpha2.JobDelete,
+				Body: model.CatalogVersionState{
+					ObjectMeta: model.ObjectMeta{
+						Name:          tombstone.Name,
+						Namespace:     tombstone.Namespace,
+						ObjGeneration: tombstone.Generation,
+					},
+					Spec: &model.CatalogVersionSpec{
+						CatalogType: tombstone.CatalogType,
+					},
+				},
+			},
+			Context: ctx,
+		})
+		if err != nil {
+			return err
 		}
 	}
 	if batch.Jobs != nil {
 		for _, job := range batch.Jobs {
-			s.Context.Publish("remote-job", v1alpha2.Event{
+			if destination := jobDestination(job); destination != "" && destination != s.VendorContext.SiteInfo.SiteId {
+				// the job is for a site below this site, relay it down the topology
+				err = s.Context.Publish("remote", v1alpha2.Event{
+					Metadata: map[string]string{
+						"site":       destination,
+						"objectType": "task",
+						"origin":     batch.Origin,
+					},
+					Body:    job,
+					Context: ctx,
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err = s.Context.Publish("remote-job", v1alpha2.Event{
 				Metadata: map[string]string{
 					"origin": batch.Origin,
 				},
 				Body:    job,
 				Context: ctx,
 			})
+			if err != nil {
+				return err
+			}
 		}
 	}
-	if err != nil {
-		return []error{err}
+	// the batch is acknowledged only when all its jobs are handed over, otherwise the
+	// parent delivers the unacknowledged jobs again after their visibility timeout
+	if len(batch.Receipts) > 0 {
+		err = s.apiClient.AckBatchForSite(ctx, s.VendorContext.SiteInfo.SiteId, batch.Receipts,
+			s.VendorContext.SiteInfo.ParentSite.Username,
+			s.VendorContext.SiteInfo.ParentSite.Password)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// jobDestination returns the site a job is for
+func jobDestination(job v1alpha2.JobData) string {
+	jData, _ := json.Marshal(job.Body)
+	var dataPackage v1alpha2.InputOutputData
+	if err := json.Unmarshal(jData, &dataPackage); err != nil {
+		return ""
+	}
+	if site, ok := dataPackage.Inputs["__site"].(string); ok {
+		return site
+	}
+	return ""
+}
 func (s *SyncManager) Reconcil() []error {
 	return nil
 }
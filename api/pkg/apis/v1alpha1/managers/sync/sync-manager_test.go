@@ -7,18 +7,23 @@
 package sync
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
 	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
@@ -90,7 +95,7 @@ func TestReconcil(t *testing.T) {
 	assert.Nil(t, errs)
 }
 
-func InitiazlizeMockSymphonyAPI(siteId string) *httptest.Server {
+func InitiazlizeMockSymphonyAPI(siteId string, acks chan model.SyncAck) *httptest.Server {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var response interface{}
 		fmt.Println("Mock Symphony API called", "path", r.URL.Path)
@@ -119,8 +124,13 @@ func InitiazlizeMockSymphonyAPI(siteId string) *httptest.Server {
 						},
 					},
 				},
-				Origin: "batch-origin",
+				Origin:   "batch-origin",
+				Receipts: []string{"receipt1", "receipt2"},
 			}
+		case "/federation/ack/" + siteId:
+			var ack model.SyncAck
+			json.NewDecoder(r.Body).Decode(&ack)
+			acks <- ack
 		case "/users/auth":
 			response = utils.AuthResponse{
 				AccessToken: "test-token",
@@ -137,7 +147,8 @@ func InitiazlizeMockSymphonyAPI(siteId string) *httptest.Server {
 
 func TestPoll(t *testing.T) {
 	siteId := "fake"
-	ts := InitiazlizeMockSymphonyAPI(siteId)
+	acks := make(chan model.SyncAck, 1)
+	ts := InitiazlizeMockSymphonyAPI(siteId, acks)
 	defer ts.Close()
 	_, err := url.Parse(ts.URL)
 	assert.Nil(t, err)
@@ -198,4 +209,399 @@ func TestPoll(t *testing.T) {
 	assert.Equal(t, 1, jobCount)
 	assert.Equal(t, "catalogversion1", catalogversion1.ObjectMeta.Name)
 	assert.Equal(t, "job1", job1.Id)
+	ack := <-acks
+	assert.Equal(t, []string{"receipt1", "receipt2"}, ack.Receipts)
+}
+
+func TestProcessBatchRelaysJobs(t *testing.T) {
+	manager := SyncManager{}
+	vendorContext := &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{},
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: "relay1",
+		},
+		Logger: logger.NewLogger("coa.runtime"),
+	}
+	vendorContext.PubsubProvider = &memory.InMemoryPubSubProvider{}
+	vendorContext.PubsubProvider.Init(memory.InMemoryPubSubConfig{})
+	err := manager.Init(vendorContext, managers.ManagerConfig{}, nil)
+	assert.Nil(t, err)
+
+	relayed := make(chan v1alpha2.Event, 1)
+	vendorContext.Subscribe("remote", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			relayed <- event
+			return nil
+		},
+	})
+	local := make(chan v1alpha2.Event, 1)
+	vendorContext.Subscribe("remote-job", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			local <- event
+			return nil
+		},
+	})
+
+	err = manager.processBatch(context.Background(), model.SyncPackage{
+		Origin: "root",
+		Jobs: []v1alpha2.JobData{
+			{
+				Id:     "job1",
+				Action: v1alpha2.JobRun,
+				Body: v1alpha2.InputOutputData{
+					Inputs: map[string]interface{}{"__site": "leaf1"},
+				},
+			},
+			{
+				Id:     "job2",
+				Action: v1alpha2.JobRun,
+				Body: v1alpha2.InputOutputData{
+					Inputs: map[string]interface{}{"__site": "relay1"},
+				},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	// jobs for sites below this site are handed to the federation vendor to be queued
+	event := <-relayed
+	assert.Equal(t, "leaf1", event.Metadata["site"])
+	assert.Equal(t, "root", event.Metadata["origin"])
+	assert.Equal(t, "job1", event.Body.(v1alpha2.JobData).Id)
+	event = <-local
+	assert.Equal(t, "job2", event.Body.(v1alpha2.JobData).Id)
+}
+
+func TestPollTombstones(t *testing.T) {
+	siteId := "fake"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/federation/sync/" + siteId:
+			response = model.SyncPackage{
+				Tombstones: []model.CatalogVersionTombstone{
+					{
+						Name:        "catalogversion1",
+						Namespace:   "default",
+						CatalogType: "config",
+						Generation:  2,
+					},
+				},
+				Origin: "batch-origin",
+			}
+		case "/users/auth":
+			response = utils.AuthResponse{
+				AccessToken: "test-token",
+				TokenType:   "Bearer",
+				Username:    "test-user",
+				Roles:       []string{"role1", "role2"},
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+
+	manager := SyncManager{}
+	vendorContext := &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{},
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: siteId,
+			ParentSite: v1alpha2.SiteConnection{
+				BaseUrl:  ts.URL + "/",
+				Username: "admin",
+				Password: "",
+			},
+		},
+		Logger: logger.NewLogger("coa.runtime"),
+	}
+	vendorContext.PubsubProvider = &memory.InMemoryPubSubProvider{}
+	vendorContext.PubsubProvider.Init(memory.InMemoryPubSubConfig{})
+	err := manager.Init(vendorContext, managers.ManagerConfig{
+		Properties: map[string]string{
+			"sync.enabled": "true",
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	sig := make(chan v1alpha2.Event, 1)
+	vendorContext.Subscribe("catalogversion-sync", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			sig <- event
+			return nil
+		},
+	})
+	errs := manager.Poll()
+	assert.Nil(t, errs)
+
+	event := <-sig
+	assert.Equal(t, "batch-origin", event.Metadata["origin"])
+	assert.Equal(t, "config", event.Metadata["objectType"])
+	job := event.Body.(v1alpha2.JobData)
+	assert.Equal(t, v1alpha2.JobDelete, job.Action)
+	assert.Equal(t, "catalogversion1", job.Id)
+	tombstone := job.Body.(model.CatalogVersionState)
+	assert.Equal(t, int64(2), tombstone.ObjectMeta.ObjGeneration)
+	assert.Equal(t, "config", tombstone.Spec.CatalogType)
+}
+
+func TestPushConfig(t *testing.T) {
+	config, err := readPushConfig(map[string]string{}, "fake")
+	assert.Nil(t, err)
+	assert.Equal(t, "", config.Mode)
+	assert.Equal(t, defaultPushWait, config.Wait)
+
+	config, err = readPushConfig(map[string]string{
+		"push.mode":               PushModeMQTT,
+		"push.wait":               "10s",
+		"push.mqtt.brokerAddress": "tcp://localhost:1883",
+	}, "fake")
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, config.Wait)
+	assert.Equal(t, "symphony/federation/fake", config.Topic)
+	assert.Equal(t, "symphony-sync-fake", config.MQTT.ClientID)
+
+	_, err = readPushConfig(map[string]string{
+		"push.mode": "websocket",
+	}, "fake")
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+
+	_, err = readPushConfig(map[string]string{
+		"push.mode": PushModeMQTT,
+	}, "fake")
+	assert.Equal(t, v1alpha2.MissingConfig, err.(v1alpha2.COAError).State)
+
+	_, err = readPushConfig(map[string]string{
+		"push.mode": PushModeLongPoll,
+		"push.wait": "1h",
+	}, "fake")
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+}
+
+func TestLongPoll(t *testing.T) {
+	siteId := "fake"
+	requests := make(chan url.Values, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/federation/sync/" + siteId:
+			query := r.URL.Query()
+			requests <- query
+			if query.Get("cursor") == "" {
+				// the first request picks up the cursor and the pending job
+				response = model.SyncPackage{
+					Jobs: []v1alpha2.JobData{
+						{
+							Id:     "job1",
+							Action: v1alpha2.JobRun,
+						},
+					},
+					Origin: "batch-origin",
+					Cursor: "epoch:1",
+				}
+			} else {
+				// nothing new, the request is held until the wait elapses
+				time.Sleep(100 * time.Millisecond)
+				response = model.SyncPackage{
+					Origin: "batch-origin",
+					Cursor: query.Get("cursor"),
+				}
+			}
+		case "/users/auth":
+			response = utils.AuthResponse{
+				AccessToken: "test-token",
+				TokenType:   "Bearer",
+				Username:    "test-user",
+				Roles:       []string{"role1", "role2"},
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+
+	manager := SyncManager{}
+	vendorContext := &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{},
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: siteId,
+			ParentSite: v1alpha2.SiteConnection{
+				BaseUrl:  ts.URL + "/",
+				Username: "admin",
+				Password: "",
+			},
+		},
+		Logger: logger.NewLogger("coa.runtime"),
+	}
+	vendorContext.PubsubProvider = &memory.InMemoryPubSubProvider{}
+	vendorContext.PubsubProvider.Init(memory.InMemoryPubSubConfig{})
+	sig := make(chan v1alpha2.JobData, 1)
+	vendorContext.Subscribe("remote-job", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			sig <- event.Body.(v1alpha2.JobData)
+			return nil
+		},
+	})
+	err := manager.Init(vendorContext, managers.ManagerConfig{
+		Properties: map[string]string{
+			"sync.enabled": "true",
+			"push.mode":    PushModeLongPoll,
+			"push.wait":    "2s",
+		},
+	}, nil)
+	assert.Nil(t, err)
+	defer manager.Shutdown(context.Background())
+
+	first := <-requests
+	assert.Equal(t, "", first.Get("cursor"))
+	assert.Equal(t, "2s", first.Get("wait"))
+	job := <-sig
+	assert.Equal(t, "job1", job.Id)
+
+	second := <-requests
+	assert.Equal(t, "epoch:1", second.Get("cursor"))
+	assert.Equal(t, "epoch:1", manager.Cursor())
+	assert.True(t, manager.pushHealthy())
+
+	// polling stands down while the push channel is healthy
+	errs := manager.Poll()
+	assert.Nil(t, errs)
+	select {
+	case query := <-requests:
+		assert.Equal(t, "epoch:1", query.Get("cursor"))
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	manager.lastContact.Store(time.Now().Add(-time.Minute).UnixNano())
+	assert.False(t, manager.pushHealthy())
+}
+
+func TestEnrollmentConfig(t *testing.T) {
+	config, err := readEnrollmentConfig(map[string]string{})
+	assert.Nil(t, err)
+	assert.False(t, config.Enabled)
+
+	_, err = readEnrollmentConfig(map[string]string{"enrollment.enabled": "true"})
+	assert.Equal(t, v1alpha2.MissingConfig, err.(v1alpha2.COAError).State)
+
+	config, err = readEnrollmentConfig(map[string]string{
+		"enrollment.enabled":     "true",
+		"enrollment.keyPath":     "site.key",
+		"enrollment.certPath":    "site.crt",
+		"enrollment.renewBefore": "48h",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 48*time.Hour, config.RenewBefore)
+	assert.Equal(t, "site.key.pending", config.pendingKeyPath())
+
+	_, err = readEnrollmentConfig(map[string]string{
+		"enrollment.enabled":     "true",
+		"enrollment.keyPath":     "site.key",
+		"enrollment.certPath":    "site.crt",
+		"enrollment.renewBefore": "soon",
+	})
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+}
+
+func TestEnrollment(t *testing.T) {
+	siteId := "fake"
+	issuer := &ca.CACertProvider{}
+	err := issuer.Init(ca.CACertProviderConfig{Name: "ca"})
+	assert.Nil(t, err)
+	var enrollment model.SiteEnrollment
+	approved := false
+	signed := make(chan bool, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/federation/enroll":
+			var request model.SiteEnrollmentRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			signed <- r.Header.Get(v1alpha2.SiteSignatureHeader) != ""
+			enrollment = model.SiteEnrollment{Site: request.Site, State: model.SiteEnrollmentPending, CSR: request.CSR}
+			if approved {
+				// renewals are issued right away
+				cert, _ := issuer.IssueCert([]byte(request.CSR), time.Hour)
+				enrollment.State = model.SiteEnrollmentApproved
+				enrollment.Certificate = string(cert)
+			}
+			response = enrollment
+		case "/federation/enroll/" + siteId:
+			if !approved {
+				cert, _ := issuer.IssueCert([]byte(enrollment.CSR), time.Hour)
+				enrollment.State = model.SiteEnrollmentApproved
+				enrollment.Certificate = string(cert)
+				approved = true
+			}
+			response = enrollment
+		case "/federation/sync/" + siteId:
+			response = model.SyncPackage{Origin: "parent"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "site.key")
+	certPath := filepath.Join(dir, "site.crt")
+	manager := SyncManager{}
+	vendorContext := &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{},
+		SiteInfo: v1alpha2.SiteInfo{
+			SiteId: siteId,
+			ParentSite: v1alpha2.SiteConnection{
+				BaseUrl: ts.URL + "/",
+			},
+		},
+		Logger: logger.NewLogger("coa.runtime"),
+	}
+	vendorContext.PubsubProvider = &memory.InMemoryPubSubProvider{}
+	vendorContext.PubsubProvider.Init(memory.InMemoryPubSubConfig{})
+	err = manager.Init(vendorContext, managers.ManagerConfig{
+		Properties: map[string]string{
+			"enrollment.enabled":  "true",
+			"enrollment.keyPath":  keyPath,
+			"enrollment.certPath": certPath,
+		},
+	}, nil)
+	assert.Nil(t, err)
+	keyPEM, err := os.ReadFile(keyPath)
+	assert.Nil(t, err)
+
+	// the first poll requests a certificate, which waits for approval
+	errs := manager.Poll()
+	assert.Nil(t, errs)
+	assert.False(t, <-signed)
+	assert.False(t, manager.identity.Ready())
+
+	// once approved, the next poll installs it
+	errs = manager.Poll()
+	assert.Nil(t, errs)
+	assert.True(t, manager.identity.Ready())
+	certPEM, err := os.ReadFile(certPath)
+	assert.Nil(t, err)
+	assert.Equal(t, enrollment.Certificate, string(certPEM))
+	serial := manager.identity.Certificate().SerialNumber
+
+	// a certificate within the renewal window is renewed with a new key, signed with the old one
+	manager.enrollment.RenewBefore = 2 * time.Hour
+	errs = manager.Poll()
+	assert.Nil(t, errs)
+	assert.True(t, <-signed)
+	assert.NotEqual(t, serial, manager.identity.Certificate().SerialNumber)
+	newKeyPEM, err := os.ReadFile(keyPath)
+	assert.Nil(t, err)
+	assert.NotEqual(t, keyPEM, newKeyPEM)
+	_, err = os.Stat(keyPath + ".pending")
+	assert.True(t, os.IsNotExist(err))
+
+	// a restarted site loads its certificate
+	restarted := SyncManager{identity: &utils.SiteIdentity{}}
+	err = restarted.Init(vendorContext, managers.ManagerConfig{
+		Properties: map[string]string{
+			"enrollment.enabled":  "true",
+			"enrollment.keyPath":  keyPath,
+			"enrollment.certPath": certPath,
+		},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, manager.identity.Certificate().SerialNumber, restarted.identity.Certificate().SerialNumber)
 }
@@ -35,6 +35,8 @@ type TargetsManager struct {
 	RegistryProvider registry.IRegistryProvider
 	needValidate     bool
 	TargetValidator  validation.TargetValidator
+	// impactChecker applies the impact check policy to changes of targets
+	impactChecker *validation.ImpactChecker
 }
 
 func (s *TargetsManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
@@ -54,7 +56,8 @@ func (s *TargetsManager) Init(context *contexts.VendorContext, config managers.M
 		// s.TargetValidator = validation.NewTargetValidator(s.targetInstanceLookup, s.targetUniqueNameLookup)
 		s.TargetValidator = validation.NewTargetValidator(nil, s.targetUniqueNameLookup)
 	}
-	return nil
+	s.impactChecker, err = validation.NewImpactChecker(config.Properties, validation.Target, states.ObjectLister(s.StateProvider))
+	return err
 }
 
 func (t *TargetsManager) DeleteSpec(ctx context.Context, name string, namespace string) error {
@@ -70,6 +73,9 @@ func (t *TargetsManager) DeleteSpec(ctx context.Context, name string, namespace
 			return err
 		}
 	}
+	if err = t.impactChecker.CheckDelete(ctx, name, namespace); err != nil {
+		return err
+	}
 
 	err = t.StateProvider.Delete(ctx, states.DeleteRequest{
 		ID: name,
@@ -114,6 +120,12 @@ func (t *TargetsManager) UpsertState(ctx context.Context, name string, state mod
 		}
 	}
 
+	if getStateErr == nil {
+		if err = t.impactChecker.CheckUpdate(ctx, name, state.ObjectMeta.Namespace, state); err != nil {
+			return err
+		}
+	}
+
 	body := map[string]interface{}{
 		"apiVersion": model.FabricGroup + "/v1",
 		"kind":       "Target",
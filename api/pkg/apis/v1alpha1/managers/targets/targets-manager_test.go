@@ -13,6 +13,8 @@ import (
 	"github.com/eclipse-symphony/symphony/api/constants"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
 	"github.com/stretchr/testify/assert"
 )
@@ -200,3 +202,60 @@ func TestDeleteTargetWithInstance(t *testing.T) {
 	assert.Contains(t, err.Error(), "Target has one or more associated instances")
 }
 */
+
+func TestTargetImpactCheck(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	manager := TargetsManager{
+		StateProvider: stateProvider,
+	}
+	var err error
+	manager.impactChecker, err = validation.NewImpactChecker(map[string]string{"impact.check": model.ImpactCheckBlock}, validation.Target, states.ObjectLister(stateProvider))
+	assert.Nil(t, err)
+	_, err = stateProvider.Upsert(context.Background(), states.UpsertRequest{
+		Value: states.StateEntry{
+			ID: "app-edge",
+			Body: map[string]interface{}{
+				"kind":     "Instance",
+				"metadata": model.ObjectMeta{Name: "app-edge", Namespace: "default"},
+				"spec": model.InstanceSpec{
+					SolutionVersion: "app:v1",
+					Target:          model.TargetSelector{Selector: map[string]string{"group": "edge"}},
+				},
+			},
+		},
+		Metadata: map[string]interface{}{"namespace": "default"},
+	})
+	assert.Nil(t, err)
+	target := func(group string) model.TargetState {
+		return model.TargetState{
+			ObjectMeta: model.ObjectMeta{Name: "edge", Namespace: "default"},
+			Spec: &model.TargetSpec{
+				DisplayName: "edge",
+				Properties:  map[string]string{"group": group},
+			},
+		}
+	}
+	err = manager.UpsertState(context.Background(), "edge", target("edge"))
+	assert.Nil(t, err)
+
+	// updates that keep the instance on the target go ahead
+	updated := target("edge")
+	updated.Spec.Properties["os"] = "linux"
+	err = manager.UpsertState(context.Background(), "edge", updated)
+	assert.Nil(t, err)
+
+	// updates that move the target out of the selector of the instance are refused
+	err = manager.UpsertState(context.Background(), "edge", target("cloud"))
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadRequest, v1alpha2.GetErrorState(err))
+	assert.Contains(t, err.Error(), "instance app-edge")
+	err = manager.DeleteSpec(context.Background(), "edge", "default")
+	assert.NotNil(t, err)
+	_, err = manager.GetState(context.Background(), "edge", "default")
+	assert.Nil(t, err)
+
+	manager.impactChecker.Policy = model.ImpactCheckWarn
+	err = manager.UpsertState(context.Background(), "edge", target("cloud"))
+	assert.Nil(t, err)
+}
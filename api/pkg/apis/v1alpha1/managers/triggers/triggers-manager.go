@@ -0,0 +1,524 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package triggers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	api_utils "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	observability "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+var log = logger.NewLogger("coa.runtime")
+
+const (
+	defaultDeduplicationWindow = time.Hour
+	// TriggerLabel is the label put on activations created by a trigger
+	TriggerLabel = "trigger"
+)
+
+type ActivationTriggersManager struct {
+	managers.Manager
+	StateProvider         states.IStateProvider
+	VolatileStateProvider states.IStateProvider
+	dedupLock             sync.Mutex
+}
+
+type deduplicationEntry struct {
+	Time time.Time `json:"time"`
+}
+
+func (s *ActivationTriggersManager) Init(context *contexts.VendorContext, config managers.ManagerConfig, providers map[string]providers.IProvider) error {
+	err := s.Manager.Init(context, config, providers)
+	if err != nil {
+		return err
+	}
+	stateprovider, err := managers.GetPersistentStateProvider(config, providers)
+	if err == nil {
+		s.StateProvider = stateprovider
+	} else {
+		return err
+	}
+	volatilestateprovider, err := managers.GetVolatileStateProvider(config, providers)
+	if err == nil {
+		s.VolatileStateProvider = volatilestateprovider
+	} else {
+		return err
+	}
+	return nil
+}
+
+func (t *ActivationTriggersManager) DeleteState(ctx context.Context, name string, namespace string) error {
+	ctx, span := observability.StartSpan("Activation Triggers Manager", ctx, &map[string]string{
+		"method": "DeleteState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	log.InfofCtx(ctx, " M (Triggers): DeleteState, name: %s, namespace: %s", name, namespace)
+	err = t.StateProvider.Delete(ctx, states.DeleteRequest{
+		ID: name,
+		Metadata: map[string]interface{}{
+			"namespace": namespace,
+			"group":     model.WorkflowGroup,
+			"version":   "v1",
+			"resource":  "activationtriggers",
+			"kind":      "ActivationTrigger",
+		},
+	})
+	return err
+}
+
+func (t *ActivationTriggersManager) UpsertState(ctx context.Context, name string, state model.ActivationTriggerState) error {
+	ctx, span := observability.StartSpan("Activation Triggers Manager", ctx, &map[string]string{
+		"method": "UpsertState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	log.InfofCtx(ctx, " M (Triggers): UpsertState, name: %s, namespace: %s", name, state.ObjectMeta.Namespace)
+
+	if state.ObjectMeta.Name != "" && state.ObjectMeta.Name != name {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("Name in metadata (%s) does not match name in request (%s)", state.ObjectMeta.Name, name), v1alpha2.BadRequest)
+		return err
+	}
+	state.ObjectMeta.FixNames(name)
+
+	if err = ValidateTrigger(state); err != nil {
+		return err
+	}
+
+	oldState, getStateErr := t.GetState(ctx, state.ObjectMeta.Name, state.ObjectMeta.Namespace)
+	if getStateErr == nil {
+		state.ObjectMeta.PreserveSystemMetadata(oldState.ObjectMeta)
+		if state.Status == nil {
+			state.Status = oldState.Status
+		}
+	}
+	if state.Status == nil {
+		state.Status = &model.ActivationTriggerStatus{}
+	}
+
+	upsertRequest := states.UpsertRequest{
+		Value: states.StateEntry{
+			ID: name,
+			Body: map[string]interface{}{
+				"apiVersion": model.WorkflowGroup + "/v1",
+				"kind":       "ActivationTrigger",
+				"metadata":   state.ObjectMeta,
+				"spec":       state.Spec,
+				"status":     state.Status,
+			},
+			ETag: state.ObjectMeta.ETag,
+		},
+		Metadata: map[string]interface{}{
+			"namespace": state.ObjectMeta.Namespace,
+			"group":     model.WorkflowGroup,
+			"version":   "v1",
+			"resource":  "activationtriggers",
+			"kind":      "ActivationTrigger",
+		},
+	}
+	_, err = t.StateProvider.Upsert(ctx, upsertRequest)
+	return err
+}
+
+func (t *ActivationTriggersManager) ListState(ctx context.Context, namespace string) ([]model.ActivationTriggerState, error) {
+	ctx, span := observability.StartSpan("Activation Triggers Manager", ctx, &map[string]string{
+		"method": "ListState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	log.InfofCtx(ctx, " M (Triggers): ListState, namespace: %s", namespace)
+	listRequest := states.ListRequest{
+		Metadata: map[string]interface{}{
+			"version":   "v1",
+			"group":     model.WorkflowGroup,
+			"resource":  "activationtriggers",
+			"namespace": namespace,
+			"kind":      "ActivationTrigger",
+		},
+	}
+	var entries []states.StateEntry
+	entries, _, err = t.StateProvider.List(ctx, listRequest)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]model.ActivationTriggerState, 0)
+	for _, entry := range entries {
+		var rt model.ActivationTriggerState
+		rt, err = getActivationTriggerState(entry.Body)
+		if err != nil {
+			return nil, err
+		}
+		rt.ObjectMeta.UpdateEtag(entry.ETag)
+		ret = append(ret, rt)
+	}
+	return ret, nil
+}
+
+func getActivationTriggerState(body interface{}) (model.ActivationTriggerState, error) {
+	var triggerState model.ActivationTriggerState
+	bytes, _ := json.Marshal(body)
+	err := json.Unmarshal(bytes, &triggerState)
+	if err != nil {
+		return model.ActivationTriggerState{}, err
+	}
+	if triggerState.Spec == nil {
+		triggerState.Spec = &model.ActivationTriggerSpec{}
+	}
+	if triggerState.Status == nil {
+		triggerState.Status = &model.ActivationTriggerStatus{}
+	}
+	return triggerState, nil
+}
+
+func (t *ActivationTriggersManager) GetState(ctx context.Context, name string, namespace string) (model.ActivationTriggerState, error) {
+	ctx, span := observability.StartSpan("Activation Triggers Manager", ctx, &map[string]string{
+		"method": "GetState",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	log.InfofCtx(ctx, " M (Triggers): GetState, name: %s, namespace: %s", name, namespace)
+	getRequest := states.GetRequest{
+		ID: name,
+		Metadata: map[string]interface{}{
+			"version":   "v1",
+			"group":     model.WorkflowGroup,
+			"resource":  "activationtriggers",
+			"namespace": namespace,
+			"kind":      "ActivationTrigger",
+		},
+	}
+	var entry states.StateEntry
+	entry, err = t.StateProvider.Get(ctx, getRequest)
+	if err != nil {
+		return model.ActivationTriggerState{}, err
+	}
+	var ret model.ActivationTriggerState
+	ret, err = getActivationTriggerState(entry.Body)
+	if err != nil {
+		return model.ActivationTriggerState{}, err
+	}
+	ret.ObjectMeta.UpdateEtag(entry.ETag)
+	return ret, nil
+}
+
+// ValidateTrigger checks that a trigger definition is complete for its source type
+// and that its expressions parse
+func ValidateTrigger(state model.ActivationTriggerState) error {
+	spec := state.Spec
+	if spec == nil {
+		return v1alpha2.NewCOAError(nil, "trigger spec is missing", v1alpha2.BadRequest)
+	}
+	if spec.CampaignVersion == "" {
+		return v1alpha2.NewCOAError(nil, "trigger campaignversion is missing", v1alpha2.BadRequest)
+	}
+	switch spec.Source.Type {
+	case model.TriggerSourceType_Topic:
+		if spec.Source.Topic == "" {
+			return v1alpha2.NewCOAError(nil, "topic trigger requires a topic", v1alpha2.BadRequest)
+		}
+	case model.TriggerSourceType_Webhook:
+		if spec.Source.Secret == "" {
+			return v1alpha2.NewCOAError(nil, "webhook trigger requires a shared secret", v1alpha2.BadRequest)
+		}
+	case model.TriggerSourceType_Object:
+		if spec.Source.ObjectType != model.TriggerObjectType_CatalogVersion && spec.Source.ObjectType != model.TriggerObjectType_Instance {
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("unsupported object type '%s', expected '%s' or '%s'", spec.Source.ObjectType, model.TriggerObjectType_CatalogVersion, model.TriggerObjectType_Instance), v1alpha2.BadRequest)
+		}
+	default:
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("unsupported trigger source type '%s'", spec.Source.Type), v1alpha2.BadRequest)
+	}
+	expressions := []string{spec.Filter}
+	if spec.Deduplication != nil {
+		if spec.Deduplication.Key == "" {
+			return v1alpha2.NewCOAError(nil, "deduplication requires a key", v1alpha2.BadRequest)
+		}
+		if spec.Deduplication.Window != "" {
+			if _, err := time.ParseDuration(spec.Deduplication.Window); err != nil {
+				return v1alpha2.NewCOAError(err, fmt.Sprintf("invalid deduplication window '%s'", spec.Deduplication.Window), v1alpha2.BadRequest)
+			}
+		}
+		expressions = append(expressions, spec.Deduplication.Key)
+	}
+	for _, v := range spec.Inputs {
+		if s, ok := v.(string); ok {
+			expressions = append(expressions, s)
+		}
+	}
+	for _, expression := range expressions {
+		if _, _, err := api_utils.NewParser(expression).Analyze(); err != nil {
+			return v1alpha2.NewCOAError(err, fmt.Sprintf("invalid expression '%s'", expression), v1alpha2.BadRequest)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the trigger listens on events of the given source
+func Matches(trigger model.ActivationTriggerState, sourceType model.TriggerSourceType, topicOrObjectType string, catalogType string) bool {
+	if trigger.Spec == nil || trigger.Spec.Disabled || trigger.Spec.Source.Type != sourceType {
+		return false
+	}
+	switch sourceType {
+	case model.TriggerSourceType_Topic:
+		return trigger.Spec.Source.Topic == topicOrObjectType
+	case model.TriggerSourceType_Object:
+		if trigger.Spec.Source.ObjectType != topicOrObjectType {
+			return false
+		}
+		return trigger.Spec.Source.CatalogType == "" || trigger.Spec.Source.CatalogType == catalogType
+	}
+	return true
+}
+
+// ResolveSecret evaluates the shared secret of a webhook trigger
+func (t *ActivationTriggersManager) ResolveSecret(ctx context.Context, trigger model.ActivationTriggerState) (string, error) {
+	val, err := api_utils.NewParser(trigger.Spec.Source.Secret).Eval(*t.newEvaluationContext(ctx, trigger.ObjectMeta.Namespace, nil))
+	if err != nil {
+		return "", err
+	}
+	return coa_utils.FormatAsString(val), nil
+}
+
+// Fire evaluates a trigger against an event payload. It returns the activation to
+// create, or nil if the event is filtered out or is a duplicate.
+func (t *ActivationTriggersManager) Fire(ctx context.Context, trigger model.ActivationTriggerState, payload interface{}) (*model.ActivationState, error) {
+	ctx, span := observability.StartSpan("Activation Triggers Manager", ctx, &map[string]string{
+		"method": "Fire",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	namespace := trigger.ObjectMeta.Namespace
+	if trigger.Spec.Filter != "" {
+		var val interface{}
+		val, err = api_utils.NewParser(trigger.Spec.Filter).Eval(*t.newEvaluationContext(ctx, namespace, payload))
+		if err != nil {
+			log.ErrorfCtx(ctx, " M (Triggers): failed to evaluate filter of trigger %s: %v", trigger.ObjectMeta.Name, err)
+			return nil, err
+		}
+		if !isTrue(val) {
+			log.DebugfCtx(ctx, " M (Triggers): event is filtered out by trigger %s", trigger.ObjectMeta.Name)
+			return nil, nil
+		}
+	}
+
+	if trigger.Spec.Deduplication != nil {
+		var duplicated bool
+		duplicated, err = t.checkDuplicate(ctx, trigger, payload)
+		if err != nil {
+			return nil, err
+		}
+		if duplicated {
+			log.InfofCtx(ctx, " M (Triggers): dropping duplicated event for trigger %s", trigger.ObjectMeta.Name)
+			return nil, nil
+		}
+	}
+
+	inputs := make(map[string]interface{}, len(trigger.Spec.Inputs))
+	for k, v := range trigger.Spec.Inputs {
+		var val interface{}
+		val, err = t.evaluateValue(ctx, v, namespace, payload)
+		if err != nil {
+			log.ErrorfCtx(ctx, " M (Triggers): failed to evaluate input %s of trigger %s: %v", k, trigger.ObjectMeta.Name, err)
+			return nil, err
+		}
+		inputs[k] = val
+	}
+
+	return &model.ActivationState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", trigger.ObjectMeta.Name, strconv.FormatInt(time.Now().UnixNano(), 36)),
+			Namespace: namespace,
+			Labels: map[string]string{
+				TriggerLabel: trigger.ObjectMeta.Name,
+			},
+		},
+		Spec: &model.ActivationSpec{
+			CampaignVersion: trigger.Spec.CampaignVersion,
+			Stage:           trigger.Spec.Stage,
+			Inputs:          inputs,
+		},
+	}, nil
+}
+
+// ReportFired records the outcome of a fired trigger in its status
+func (t *ActivationTriggersManager) ReportFired(ctx context.Context, name string, namespace string, activation string, fireErr error) error {
+	trigger, err := t.GetState(ctx, name, namespace)
+	if err != nil {
+		return err
+	}
+	if fireErr != nil {
+		trigger.Status.LastError = fireErr.Error()
+	} else {
+		trigger.Status.FireCount++
+		trigger.Status.LastFired = time.Now().UTC().Format(time.RFC3339)
+		trigger.Status.LastActivation = activation
+		trigger.Status.LastError = ""
+	}
+	return t.UpsertState(ctx, name, trigger)
+}
+
+// deduplicationID returns the state ID the deduplication key of the payload is recorded under,
+// and the deduplication window of the trigger
+func (t *ActivationTriggersManager) deduplicationID(ctx context.Context, trigger model.ActivationTriggerState, payload interface{}) (string, time.Duration, error) {
+	key, err := api_utils.NewParser(trigger.Spec.Deduplication.Key).Eval(*t.newEvaluationContext(ctx, trigger.ObjectMeta.Namespace, payload))
+	if err != nil {
+		return "", 0, err
+	}
+	window := defaultDeduplicationWindow
+	if trigger.Spec.Deduplication.Window != "" {
+		window, err = time.ParseDuration(trigger.Spec.Deduplication.Window)
+		if err != nil {
+			return "", 0, v1alpha2.NewCOAError(err, "invalid deduplication window", v1alpha2.BadConfig)
+		}
+	}
+	hash := sha256.Sum256([]byte(coa_utils.FormatAsString(key)))
+	return fmt.Sprintf("trigger-dedup-%s-%s", trigger.ObjectMeta.Name, hex.EncodeToString(hash[:8])), window, nil
+}
+
+// checkDuplicate returns true if the deduplication key of the payload has already
+// fired within the deduplication window. Otherwise the key is recorded, and must be
+// released with ReleaseDeduplication if the activation isn't created.
+func (t *ActivationTriggersManager) checkDuplicate(ctx context.Context, trigger model.ActivationTriggerState, payload interface{}) (bool, error) {
+	id, window, err := t.deduplicationID(ctx, trigger, payload)
+	if err != nil {
+		return false, err
+	}
+	metadata := map[string]interface{}{
+		"namespace": trigger.ObjectMeta.Namespace,
+	}
+
+	t.dedupLock.Lock()
+	defer t.dedupLock.Unlock()
+	entry, err := t.VolatileStateProvider.Get(ctx, states.GetRequest{
+		ID:       id,
+		Metadata: metadata,
+	})
+	if err == nil {
+		var seen deduplicationEntry
+		data, _ := json.Marshal(entry.Body)
+		if json.Unmarshal(data, &seen) == nil && time.Since(seen.Time) < window {
+			return true, nil
+		}
+	} else if !v1alpha2.IsNotFound(err) {
+		return false, err
+	}
+	_, err = t.VolatileStateProvider.Upsert(ctx, states.UpsertRequest{
+		Value: states.StateEntry{
+			ID:   id,
+			Body: deduplicationEntry{Time: time.Now().UTC()},
+		},
+		Metadata: metadata,
+	})
+	return false, err
+}
+
+// ReleaseDeduplication forgets the deduplication key a fired payload recorded, so the
+// payload can fire again after its activation failed to be created
+func (t *ActivationTriggersManager) ReleaseDeduplication(ctx context.Context, trigger model.ActivationTriggerState, payload interface{}) error {
+	if trigger.Spec == nil || trigger.Spec.Deduplication == nil {
+		return nil
+	}
+	id, _, err := t.deduplicationID(ctx, trigger, payload)
+	if err != nil {
+		return err
+	}
+	t.dedupLock.Lock()
+	defer t.dedupLock.Unlock()
+	err = t.VolatileStateProvider.Delete(ctx, states.DeleteRequest{
+		ID: id,
+		Metadata: map[string]interface{}{
+			"namespace": trigger.ObjectMeta.Namespace,
+		},
+	})
+	if err != nil && !v1alpha2.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (t *ActivationTriggersManager) newEvaluationContext(ctx context.Context, namespace string, payload interface{}) *coa_utils.EvaluationContext {
+	var eCtx *coa_utils.EvaluationContext
+	if t.VendorContext != nil {
+		eCtx = t.VendorContext.EvaluationContext.Clone()
+	}
+	if eCtx == nil {
+		eCtx = &coa_utils.EvaluationContext{}
+	}
+	eCtx.Context = ctx
+	eCtx.Namespace = namespace
+	eCtx.Value = payload
+	if m, ok := payload.(map[string]interface{}); ok {
+		eCtx.Triggers = m
+	}
+	return eCtx
+}
+
+func (t *ActivationTriggersManager) evaluateValue(ctx context.Context, v interface{}, namespace string, payload interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return api_utils.NewParser(val).Eval(*t.newEvaluationContext(ctx, namespace, payload))
+	case []interface{}:
+		ret := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			tv, err := t.evaluateValue(ctx, item, namespace, payload)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, tv)
+		}
+		return ret, nil
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			tv, err := t.evaluateValue(ctx, item, namespace, payload)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = tv
+		}
+		return ret, nil
+	default:
+		return val, nil
+	}
+}
+
+func isTrue(val interface{}) bool {
+	switch v := val.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
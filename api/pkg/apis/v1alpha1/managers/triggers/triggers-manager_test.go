@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package triggers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/stretchr/testify/assert"
+)
+
+func initManager(t *testing.T) *ActivationTriggersManager {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	err := stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	assert.Nil(t, err)
+	volatileProvider := &memorystate.MemoryStateProvider{}
+	err = volatileProvider.Init(memorystate.MemoryStateProviderConfig{})
+	assert.Nil(t, err)
+
+	manager := &ActivationTriggersManager{}
+	err = manager.Init(nil, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "memory-state",
+			"providers.volatilestate":   "volatile-state",
+		},
+	}, map[string]providers.IProvider{
+		"memory-state":   stateProvider,
+		"volatile-state": volatileProvider,
+	})
+	assert.Nil(t, err)
+	return manager
+}
+
+func topicTrigger(name string) model.ActivationTriggerState {
+	return model.ActivationTriggerState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: &model.ActivationTriggerSpec{
+			CampaignVersion: "campaign-v-v1",
+			Stage:           "deploy",
+			Source: model.TriggerSourceSpec{
+				Type:  model.TriggerSourceType_Topic,
+				Topic: "alerts",
+			},
+			Filter: "${{$equal($val('$.severity'), 'high')}}",
+			Inputs: map[string]interface{}{
+				"device": "${{$val('$.device')}}",
+				"static": "value",
+				"nested": map[string]interface{}{
+					"severity": "${{$val('$.severity')}}",
+				},
+			},
+		},
+	}
+}
+
+func TestInitFailWithoutVolatileState(t *testing.T) {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	err := stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	assert.Nil(t, err)
+
+	manager := ActivationTriggersManager{}
+	err = manager.Init(nil, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "memory-state",
+		},
+	}, map[string]providers.IProvider{
+		"memory-state": stateProvider,
+	})
+	assert.NotNil(t, err)
+}
+
+func TestUpsertGetListDelete(t *testing.T) {
+	manager := initManager(t)
+	trigger := topicTrigger("trigger1")
+	err := manager.UpsertState(context.Background(), "trigger1", trigger)
+	assert.Nil(t, err)
+
+	state, err := manager.GetState(context.Background(), "trigger1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "alerts", state.Spec.Source.Topic)
+	assert.NotNil(t, state.Status)
+
+	list, err := manager.ListState(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+
+	err = manager.DeleteState(context.Background(), "trigger1", "default")
+	assert.Nil(t, err)
+	_, err = manager.GetState(context.Background(), "trigger1", "default")
+	assert.NotNil(t, err)
+}
+
+func TestUpsertNameMismatch(t *testing.T) {
+	manager := initManager(t)
+	err := manager.UpsertState(context.Background(), "other", topicTrigger("trigger1"))
+	assert.NotNil(t, err)
+}
+
+func TestValidateTrigger(t *testing.T) {
+	trigger := topicTrigger("trigger1")
+	assert.Nil(t, ValidateTrigger(trigger))
+
+	trigger.Spec.CampaignVersion = ""
+	assert.NotNil(t, ValidateTrigger(trigger))
+
+	trigger = topicTrigger("trigger1")
+	trigger.Spec.Source.Topic = ""
+	assert.NotNil(t, ValidateTrigger(trigger))
+
+	trigger = topicTrigger("trigger1")
+	trigger.Spec.Source = model.TriggerSourceSpec{Type: model.TriggerSourceType_Webhook}
+	assert.NotNil(t, ValidateTrigger(trigger))
+	trigger.Spec.Source.Secret = "s3cret"
+	assert.Nil(t, ValidateTrigger(trigger))
+
+	trigger.Spec.Source = model.TriggerSourceSpec{Type: model.TriggerSourceType_Object, ObjectType: "solution"}
+	assert.NotNil(t, ValidateTrigger(trigger))
+	trigger.Spec.Source.ObjectType = model.TriggerObjectType_Instance
+	assert.Nil(t, ValidateTrigger(trigger))
+
+	trigger.Spec.Source.Type = "unknown"
+	assert.NotNil(t, ValidateTrigger(trigger))
+
+	trigger = topicTrigger("trigger1")
+	trigger.Spec.Deduplication = &model.TriggerDeduplicationSpec{Window: "1m"}
+	assert.NotNil(t, ValidateTrigger(trigger))
+	trigger.Spec.Deduplication = &model.TriggerDeduplicationSpec{Key: "${{$val('$.id')}}", Window: "soon"}
+	assert.NotNil(t, ValidateTrigger(trigger))
+
+	trigger = topicTrigger("trigger1")
+	trigger.Spec.Filter = "${{$val('$.severity'}}"
+	assert.NotNil(t, ValidateTrigger(trigger))
+}
+
+func TestMatches(t *testing.T) {
+	trigger := topicTrigger("trigger1")
+	assert.True(t, Matches(trigger, model.TriggerSourceType_Topic, "alerts", ""))
+	assert.False(t, Matches(trigger, model.TriggerSourceType_Topic, "other", ""))
+	assert.False(t, Matches(trigger, model.TriggerSourceType_Object, "alerts", ""))
+
+	trigger.Spec.Disabled = true
+	assert.False(t, Matches(trigger, model.TriggerSourceType_Topic, "alerts", ""))
+
+	trigger = topicTrigger("trigger2")
+	trigger.Spec.Source = model.TriggerSourceSpec{
+		Type:        model.TriggerSourceType_Object,
+		ObjectType:  model.TriggerObjectType_CatalogVersion,
+		CatalogType: "config",
+	}
+	assert.True(t, Matches(trigger, model.TriggerSourceType_Object, model.TriggerObjectType_CatalogVersion, "config"))
+	assert.False(t, Matches(trigger, model.TriggerSourceType_Object, model.TriggerObjectType_CatalogVersion, "asset"))
+	assert.False(t, Matches(trigger, model.TriggerSourceType_Object, model.TriggerObjectType_Instance, ""))
+}
+
+func TestFire(t *testing.T) {
+	manager := initManager(t)
+	trigger := topicTrigger("trigger1")
+	activation, err := manager.Fire(context.Background(), trigger, map[string]interface{}{
+		"severity": "high",
+		"device":   "camera-1",
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+	assert.Equal(t, "campaign-v-v1", activation.Spec.CampaignVersion)
+	assert.Equal(t, "deploy", activation.Spec.Stage)
+	assert.Equal(t, "default", activation.ObjectMeta.Namespace)
+	assert.Equal(t, "trigger1", activation.ObjectMeta.Labels[TriggerLabel])
+	assert.Equal(t, "camera-1", activation.Spec.Inputs["device"])
+	assert.Equal(t, "value", activation.Spec.Inputs["static"])
+	assert.Equal(t, "high", activation.Spec.Inputs["nested"].(map[string]interface{})["severity"])
+}
+
+func TestFireFiltered(t *testing.T) {
+	manager := initManager(t)
+	activation, err := manager.Fire(context.Background(), topicTrigger("trigger1"), map[string]interface{}{
+		"severity": "low",
+		"device":   "camera-1",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, activation)
+}
+
+func TestFireDeduplication(t *testing.T) {
+	manager := initManager(t)
+	trigger := topicTrigger("trigger1")
+	trigger.Spec.Deduplication = &model.TriggerDeduplicationSpec{
+		Key:    "${{$val('$.device')}}",
+		Window: "1h",
+	}
+	payload := map[string]interface{}{
+		"severity": "high",
+		"device":   "camera-1",
+	}
+	activation, err := manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+
+	activation, err = manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.Nil(t, activation)
+
+	payload["device"] = "camera-2"
+	activation, err = manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+}
+
+func TestReleaseDeduplication(t *testing.T) {
+	manager := initManager(t)
+	trigger := topicTrigger("trigger1")
+	trigger.Spec.Deduplication = &model.TriggerDeduplicationSpec{
+		Key:    "${{$val('$.device')}}",
+		Window: "1h",
+	}
+	payload := map[string]interface{}{
+		"severity": "high",
+		"device":   "camera-1",
+	}
+	activation, err := manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+
+	// a payload whose activation failed to be created fires again
+	err = manager.ReleaseDeduplication(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	activation, err = manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+
+	err = manager.ReleaseDeduplication(context.Background(), topicTrigger("trigger2"), payload)
+	assert.Nil(t, err)
+}
+
+func TestFireDeduplicationWindowExpired(t *testing.T) {
+	manager := initManager(t)
+	trigger := topicTrigger("trigger1")
+	trigger.Spec.Deduplication = &model.TriggerDeduplicationSpec{
+		Key:    "${{$val('$.device')}}",
+		Window: "1ns",
+	}
+	payload := map[string]interface{}{
+		"severity": "high",
+		"device":   "camera-1",
+	}
+	activation, err := manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+
+	activation, err = manager.Fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotNil(t, activation)
+}
+
+func TestReportFired(t *testing.T) {
+	manager := initManager(t)
+	err := manager.UpsertState(context.Background(), "trigger1", topicTrigger("trigger1"))
+	assert.Nil(t, err)
+
+	err = manager.ReportFired(context.Background(), "trigger1", "default", "trigger1-abc", nil)
+	assert.Nil(t, err)
+	state, err := manager.GetState(context.Background(), "trigger1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, state.Status.FireCount)
+	assert.Equal(t, "trigger1-abc", state.Status.LastActivation)
+	assert.NotEmpty(t, state.Status.LastFired)
+
+	err = manager.ReportFired(context.Background(), "trigger1", "default", "", errors.New("campaign not found"))
+	assert.Nil(t, err)
+	state, err = manager.GetState(context.Background(), "trigger1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, state.Status.FireCount)
+	assert.Equal(t, "campaign not found", state.Status.LastError)
+}
+
+func TestResolveSecret(t *testing.T) {
+	manager := initManager(t)
+	trigger := topicTrigger("trigger1")
+	trigger.Spec.Source = model.TriggerSourceSpec{
+		Type:   model.TriggerSourceType_Webhook,
+		Secret: "s3cret",
+	}
+	secret, err := manager.ResolveSecret(context.Background(), trigger)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cret", secret)
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package model
+
+import (
+	"errors"
+	"reflect"
+)
+
+// +kubebuilder:validation:Enum=topic;webhook;object;
+type TriggerSourceType string
+
+const (
+	TriggerSourceType_Topic   TriggerSourceType = "topic"
+	TriggerSourceType_Webhook TriggerSourceType = "webhook"
+	TriggerSourceType_Object  TriggerSourceType = "object"
+)
+
+const (
+	// TriggerObjectType_CatalogVersion fires when a catalog version is created or updated
+	TriggerObjectType_CatalogVersion = "catalogversion"
+	// TriggerObjectType_Instance fires when a deployment of an instance concludes
+	TriggerObjectType_Instance = "instance"
+	// InstanceSummaryTopic is the pubsub topic on which concluded instance deployment summaries are published
+	InstanceSummaryTopic = "instancesummary"
+)
+
+type ActivationTriggerState struct {
+	ObjectMeta ObjectMeta               `json:"metadata,omitempty"`
+	Spec       *ActivationTriggerSpec   `json:"spec,omitempty"`
+	Status     *ActivationTriggerStatus `json:"status,omitempty"`
+}
+
+type TriggerSourceSpec struct {
+	Type TriggerSourceType `json:"type"`
+	// Topic is the pubsub topic to listen on (topic sources)
+	Topic string `json:"topic,omitempty"`
+	// Secret is the shared secret inbound webhook calls must present (webhook sources).
+	// It may be an expression, such as ${{$secret('webhook-secrets', 'github')}}
+	Secret string `json:"secret,omitempty"`
+	// ObjectType is the type of object changes to listen on: catalogversion or instance (object sources)
+	ObjectType string `json:"objectType,omitempty"`
+	// CatalogType narrows catalogversion changes to the given catalog type
+	CatalogType string `json:"catalogType,omitempty"`
+}
+
+type TriggerDeduplicationSpec struct {
+	// Key is an expression evaluated against the event payload. Events yielding
+	// a key that already fired within Window are dropped
+	Key string `json:"key"`
+	// Window is the de-duplication window in duration format, defaults to 1h
+	Window string `json:"window,omitempty"`
+}
+
+type ActivationTriggerSpec struct {
+	CampaignVersion string            `json:"campaignversion"`
+	Stage           string            `json:"stage,omitempty"`
+	Source          TriggerSourceSpec `json:"source"`
+	// Filter is an expression evaluated against the event payload; the trigger
+	// only fires when it evaluates to true
+	Filter string `json:"filter,omitempty"`
+	// Inputs maps the event payload to activation inputs using expressions
+	Inputs        map[string]interface{}    `json:"inputs,omitempty"`
+	Deduplication *TriggerDeduplicationSpec `json:"deduplication,omitempty"`
+	Disabled      bool                      `json:"disabled,omitempty"`
+}
+
+type ActivationTriggerStatus struct {
+	FireCount      int    `json:"fireCount,omitempty"`
+	LastFired      string `json:"lastFired,omitempty"`
+	LastActivation string `json:"lastActivation,omitempty"`
+	LastError      string `json:"lastError,omitempty"`
+}
+
+func (c ActivationTriggerSpec) DeepEquals(other IDeepEquals) (bool, error) {
+	otherC, ok := other.(ActivationTriggerSpec)
+	if !ok {
+		return false, errors.New("parameter is not a ActivationTriggerSpec type")
+	}
+
+	if c.CampaignVersion != otherC.CampaignVersion {
+		return false, nil
+	}
+
+	if c.Stage != otherC.Stage {
+		return false, nil
+	}
+
+	if c.Source != otherC.Source {
+		return false, nil
+	}
+
+	if c.Filter != otherC.Filter {
+		return false, nil
+	}
+
+	if !reflect.DeepEqual(c.Inputs, otherC.Inputs) {
+		return false, nil
+	}
+
+	if !reflect.DeepEqual(c.Deduplication, otherC.Deduplication) {
+		return false, nil
+	}
+
+	if c.Disabled != otherC.Disabled {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (c ActivationTriggerState) DeepEquals(other IDeepEquals) (bool, error) {
+	otherC, ok := other.(ActivationTriggerState)
+	if !ok {
+		return false, errors.New("parameter is not a ActivationTriggerState type")
+	}
+
+	equal, err := c.ObjectMeta.DeepEquals(otherC.ObjectMeta)
+	if err != nil || !equal {
+		return equal, err
+	}
+
+	equal, err = c.Spec.DeepEquals(*otherC.Spec)
+	if err != nil || !equal {
+		return equal, err
+	}
+
+	return true, nil
+}
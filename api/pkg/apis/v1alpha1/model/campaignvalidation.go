@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package model
+
+// +kubebuilder:validation:Enum=error;warning;
+type ValidationSeverity string
+
+const (
+	ValidationSeverity_Error   ValidationSeverity = "error"
+	ValidationSeverity_Warning ValidationSeverity = "warning"
+)
+
+// CampaignValidationRequest is the payload of the campaign version validate endpoint.
+// When Simulate is set, the campaign version is also executed with mock stage
+// providers, using StubOutputs (keyed by stage name) as the stage outputs.
+type CampaignValidationRequest struct {
+	CampaignVersion CampaignVersionState              `json:"campaignVersion"`
+	Simulate        bool                              `json:"simulate,omitempty"`
+	Inputs          map[string]interface{}            `json:"inputs,omitempty"`
+	StubOutputs     map[string]map[string]interface{} `json:"stubOutputs,omitempty"`
+	MaxSteps        int                               `json:"maxSteps,omitempty"`
+}
+
+type CampaignValidationIssue struct {
+	Severity  ValidationSeverity `json:"severity"`
+	Stage     string             `json:"stage,omitempty"`
+	FieldPath string             `json:"fieldPath,omitempty"`
+	Value     interface{}        `json:"value,omitempty"`
+	Message   string             `json:"message"`
+}
+
+type CampaignSimulationResult struct {
+	Completed    bool          `json:"completed"`
+	Message      string        `json:"message,omitempty"`
+	StageHistory []StageStatus `json:"stageHistory,omitempty"`
+}
+
+type CampaignValidationResult struct {
+	Valid      bool                      `json:"valid"`
+	Issues     []CampaignValidationIssue `json:"issues,omitempty"`
+	Simulation *CampaignSimulationResult `json:"simulation,omitempty"`
+}
+
+// HasErrors returns true if any of the issues is an error (as opposed to a warning)
+func (r CampaignValidationResult) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == ValidationSeverity_Error {
+			return true
+		}
+	}
+	return false
+}
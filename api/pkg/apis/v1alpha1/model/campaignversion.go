@@ -71,6 +71,8 @@ type TaskSpec struct {
 	Config   interface{}            `json:"config,omitempty"`
 	Inputs   map[string]interface{} `json:"inputs,omitempty"`
 	Target   string                 `json:"target,omitempty"`
+	// Timeout bounds the task's provider call in duration format (e.g. "30s")
+	Timeout string `json:"timeout,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
@@ -96,6 +98,12 @@ type StageSpec struct {
 	Target        string                 `json:"target,omitempty"`
 	Tasks         []TaskSpec             `json:"tasks,omitempty"`
 	TaskOption    TaskOption             `json:"taskOption,omitempty"`
+	// Timeout bounds each attempt of the stage in duration format (e.g. "5m");
+	// the provider context is cancelled when it expires
+	Timeout string `json:"timeout,omitempty"`
+	// Compensation is the name of the stage that undoes this stage. It runs
+	// when the campaign fails after this stage has succeeded
+	Compensation string `json:"compensation,omitempty"`
 }
 
 // UnmarshalJSON customizes the JSON unmarshalling for StageSpec
@@ -115,6 +123,11 @@ func (s *StageSpec) UnmarshalJSON(data []byte) error {
 			return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid timestamp format: %v", err), v1alpha2.BadConfig)
 		}
 	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid timeout format: %v", err), v1alpha2.BadConfig)
+		}
+	}
 	return nil
 }
 
@@ -162,6 +175,14 @@ func (s StageSpec) DeepEquals(other IDeepEquals) (bool, error) {
 	if !reflect.DeepEqual(s.Schedule, otherS.Schedule) {
 		return false, nil
 	}
+
+	if s.Timeout != otherS.Timeout {
+		return false, nil
+	}
+
+	if s.Compensation != otherS.Compensation {
+		return false, nil
+	}
 	if s.Proxy == nil && otherS.Proxy != nil {
 		return false, nil
 	}
@@ -192,6 +213,9 @@ type StageStatus struct {
 	IsActive      bool                   `json:"isActive,omitempty"`
 	StatusMessage string                 `json:"statusMessage,omitempty"`
 	ErrorMessage  string                 `json:"errorMessage,omitempty"`
+	// CompensatedStage is set when this entry records a compensation run
+	// undoing the named stage
+	CompensatedStage string `json:"compensatedStage,omitempty"`
 }
 
 type ActivationSpec struct {
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package model
+
+const (
+	RevisionCreated  = "create"
+	RevisionUpdated  = "update"
+	RevisionDeleted  = "delete"
+	RevisionRestored = "restore"
+)
+
+// CatalogRevision is a change of a catalog version, recorded in its history
+type CatalogRevision struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Revision numbers the changes of a catalog version, from 1
+	Revision   int64  `json:"revision"`
+	Generation int64  `json:"generation"`
+	Action     string `json:"action"`
+	Author     string `json:"author,omitempty"`
+	Timestamp  string `json:"timestamp"`
+	// RestoredFrom is the revision a restore brought back
+	RestoredFrom int64 `json:"restoredFrom,omitempty"`
+	// Spec is the spec after the change, or before a deletion
+	Spec *CatalogVersionSpec `json:"spec,omitempty"`
+}
+
+// CatalogDiff is the difference of the specs of two revisions of a catalog version
+type CatalogDiff struct {
+	Name    string           `json:"name"`
+	From    int64            `json:"from"`
+	To      int64            `json:"to"`
+	Changes []PropertyChange `json:"changes"`
+}
+
+const (
+	ChangeAdded    = "add"
+	ChangeRemoved  = "remove"
+	ChangeReplaced = "replace"
+)
+
+// PropertyChange is a changed value of a spec, located by its JSON pointer
+type PropertyChange struct {
+	Property  string      `json:"property"`
+	Operation string      `json:"op"`
+	Old       interface{} `json:"old,omitempty"`
+	New       interface{} `json:"new,omitempty"`
+}
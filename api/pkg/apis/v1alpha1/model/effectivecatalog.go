@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package model
+
+// EffectiveCatalog is a catalog version with the properties it inherits from its parent chain
+type EffectiveCatalog struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Chain is the catalog version and its ancestors, from the catalog version up to the root
+	Chain      []string               `json:"chain"`
+	Properties map[string]interface{} `json:"properties"`
+	// Provenance is the catalog version that supplied each value, by the JSON pointer of the value
+	Provenance map[string]string  `json:"provenance"`
+	Conflicts  []PropertyConflict `json:"conflicts,omitempty"`
+}
+
+// PropertyConflict is a value that overrides different values of the ancestors
+type PropertyConflict struct {
+	Property string      `json:"property"`
+	Catalog  string      `json:"catalog"`
+	Value    interface{} `json:"value"`
+	// Overridden are the values of the ancestors, from the nearest ancestor up
+	Overridden []CatalogValue `json:"overridden"`
+}
+
+// CatalogValue is a value supplied by a catalog version
+type CatalogValue struct {
+	Catalog string      `json:"catalog"`
+	Value   interface{} `json:"value"`
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package model
+
+// Relations of Symphony objects, from the dependent object to the object it depends on
+const (
+	// RelationContainer is a version of a root resource, such as a solution version of a solution
+	RelationContainer = "container"
+	// RelationParent is a catalog version inheriting from a parent catalog version
+	RelationParent = "parent"
+	// RelationConfig is an object reading a catalog version with $config()
+	RelationConfig = "config"
+	// RelationSolutionVersion is an instance deploying a solution version
+	RelationSolutionVersion = "solutionversion"
+	// RelationTarget is an instance deploying to a target, by name or selector
+	RelationTarget = "target"
+	// RelationCampaignVersion is an activation running a campaign version
+	RelationCampaignVersion = "campaignversion"
+)
+
+// ImpactCheck policies decide what happens when a deleted object has dependents
+const (
+	ImpactCheckBlock = "block"
+	ImpactCheckWarn  = "warn"
+)
+
+// ObjectKey identifies a Symphony object in a dependency graph
+type ObjectKey struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Dependency is an object depending on another object
+type Dependency struct {
+	From     ObjectKey `json:"from"`
+	To       ObjectKey `json:"to"`
+	Relation string    `json:"relation"`
+}
+
+// ImpactedObject is an object affected by a change of another object
+type ImpactedObject struct {
+	ObjectKey
+	Relation string `json:"relation"`
+	// Via is the object this object depends on directly
+	Via ObjectKey `json:"via"`
+	// Depth is how many dependencies away this object is from the changed object
+	Depth int `json:"depth"`
+}
+
+// ImpactReport lists the objects affected by changing or deleting an object, nearest first
+type ImpactReport struct {
+	Object   ObjectKey        `json:"object"`
+	Affected []ImpactedObject `json:"affected"`
+}
@@ -27,20 +27,121 @@ type SiteInstanceStatus struct {
 	Reason string         `json:"reason,omitempty"`
 }
 
+// SiteNodeType is the node type of sites in the site tree
+const SiteNodeType = "site"
+
+// INode interface
+func (s SiteState) GetId() string {
+	return s.Id
+}
+func (s SiteState) GetParent() string {
+	if s.Spec != nil {
+		return s.Spec.Parent
+	}
+	return ""
+}
+func (s SiteState) GetType() string {
+	return SiteNodeType
+}
+func (s SiteState) GetProperties() map[string]interface{} {
+	ret := make(map[string]interface{})
+	if s.Spec != nil {
+		for k, v := range s.Spec.Properties {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// SiteTreeNode is a site and the sites below it in the federation topology
+type SiteTreeNode struct {
+	Site     SiteState      `json:"site"`
+	Children []SiteTreeNode `json:"children,omitempty"`
+}
+
 // +kubebuilder:object:generate=true
 type SiteStatus struct {
 	IsOnline         bool                          `json:"isOnline,omitempty"`
 	TargetStatuses   map[string]SiteTargetStatus   `json:"targetStatuses,omitempty"`
 	InstanceStatuses map[string]SiteInstanceStatus `json:"instanceStatuses,omitempty"`
 	LastReported     string                        `json:"lastReported,omitempty"`
+	// Health is healthy, degraded or offline, depending on how many reports the site missed
+	Health string `json:"health,omitempty"`
+	// HealthChanged is when the site last changed its health
+	HealthChanged string `json:"healthChanged,omitempty"`
+	// CatalogConflicts are the synced catalog versions that were modified at the site, by name
+	CatalogConflicts map[string]CatalogConflict `json:"catalogConflicts,omitempty"`
+}
+
+// FleetHealth summarizes the health of the sites in the registry of a site, with the number
+// of sites by health, and the number of targets and instances by state
+type FleetHealth struct {
+	Sites     map[string]int `json:"sites"`
+	Targets   map[string]int `json:"targets"`
+	Instances map[string]int `json:"instances"`
+	Details   []SiteHealth   `json:"details"`
+}
+
+// SiteHealth is the health of a site, with the number of its targets and instances by state
+type SiteHealth struct {
+	Site         string         `json:"site"`
+	Health       string         `json:"health"`
+	LastReported string         `json:"lastReported,omitempty"`
+	Targets      map[string]int `json:"targets"`
+	Instances    map[string]int `json:"instances"`
+}
+
+// CatalogConflict is a catalog version synced from the parent site that was modified at the site
+type CatalogConflict struct {
+	Origin           string             `json:"origin"`
+	SourceName       string             `json:"sourceName"`
+	Namespace        string             `json:"namespace,omitempty"`
+	CatalogType      string             `json:"catalogType,omitempty"`
+	Action           v1alpha2.JobAction `json:"action"`
+	Policy           string             `json:"policy"`
+	LocalGeneration  int64              `json:"localGeneration"`
+	ParentGeneration int64              `json:"parentGeneration"`
+	DetectedAt       string             `json:"detectedAt"`
 }
 
 // +kubebuilder:object:generate=true
 type SiteSpec struct {
-	Name       string            `json:"name,omitempty"`
-	IsSelf     bool              `json:"isSelf,omitempty"`
+	Name   string `json:"name,omitempty"`
+	IsSelf bool   `json:"isSelf,omitempty"`
+	// Parent is the site the site syncs with, empty for the sites that sync with this site
+	Parent     string            `json:"parent,omitempty"`
 	PublicKey  string            `json:"secretHash,omitempty"`
 	Properties map[string]string `json:"properties,omitempty"`
+	// Heartbeat overrides how often the sites manager expects the site to report
+	Heartbeat *SiteHeartbeatSpec `json:"heartbeat,omitempty"`
+}
+
+// Site health states, derived from how long ago a site last reported
+const (
+	SiteHealthy  = "healthy"
+	SiteDegraded = "degraded"
+	SiteOffline  = "offline"
+	// SiteUnknown is the health of sites that haven't reported yet
+	SiteUnknown = "unknown"
+)
+
+// Policies for the staged jobs of an offline site
+const (
+	// OfflineJobsHold keeps the jobs queued until the site is back
+	OfflineJobsHold = "hold"
+	// OfflineJobsExpire fails the jobs, and the jobs staged while the site is offline
+	OfflineJobsExpire = "expire"
+)
+
+// SiteHeartbeatSpec is how often a site is expected to report its status, and what happens
+// when it doesn't. Fields that aren't set take the defaults of the sites manager.
+type SiteHeartbeatSpec struct {
+	Interval string `json:"interval,omitempty"`
+	// DegradedAfter is the number of missed reports after which the site is degraded
+	DegradedAfter int `json:"degradedAfter,omitempty"`
+	// OfflineAfter is the number of missed reports after which the site is offline
+	OfflineAfter int    `json:"offlineAfter,omitempty"`
+	OfflineJobs  string `json:"offlineJobs,omitempty"`
 }
 
 func (s SiteSpec) DeepEquals(other IDeepEquals) (bool, error) {
@@ -53,9 +154,55 @@ func (s SiteSpec) DeepEquals(other IDeepEquals) (bool, error) {
 		return false, nil
 	}
 
+	if s.Parent != otherS.Parent {
+		return false, nil
+	}
+
 	if s.PublicKey != otherS.PublicKey {
 		return false, nil
 	}
 
+	if (s.Heartbeat == nil) != (otherS.Heartbeat == nil) {
+		return false, nil
+	}
+	if s.Heartbeat != nil && *s.Heartbeat != *otherS.Heartbeat {
+		return false, nil
+	}
+
 	return true, nil
 }
+
+// Enrollment states of a site
+const (
+	// SiteEnrollmentPending is an enrollment waiting for approval at the parent site
+	SiteEnrollmentPending = "pending"
+	// SiteEnrollmentApproved is an enrollment the parent site issued a certificate for
+	SiteEnrollmentApproved = "approved"
+	// SiteEnrollmentRevoked is an enrollment whose certificate the parent site no longer accepts
+	SiteEnrollmentRevoked = "revoked"
+)
+
+// SiteEnrollmentRequest asks the parent site to issue a certificate for a site's key
+type SiteEnrollmentRequest struct {
+	Site string `json:"site"`
+	// CSR is the PEM encoded certificate signing request, with the site id as common name
+	CSR string `json:"csr"`
+}
+
+// SiteEnrollment is the identity a child site enrolled with at its parent site
+type SiteEnrollment struct {
+	Site  string `json:"site"`
+	State string `json:"state"`
+	CSR   string `json:"csr,omitempty"`
+	// Fingerprint is the SHA-256 hash of the requested public key, to check before approval
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Certificate is the PEM encoded certificate issued to the site, only requests signed by
+	// its key are accepted
+	Certificate   string `json:"certificate,omitempty"`
+	CACertificate string `json:"caCertificate,omitempty"`
+	SerialNumber  string `json:"serialNumber,omitempty"`
+	NotAfter      string `json:"notAfter,omitempty"`
+	RequestedAt   string `json:"requestedAt,omitempty"`
+	ApprovedAt    string `json:"approvedAt,omitempty"`
+	RevokedAt     string `json:"revokedAt,omitempty"`
+}
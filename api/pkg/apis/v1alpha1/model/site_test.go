@@ -64,6 +64,20 @@ func TestSitePublicKeyNotMatch(t *testing.T) {
 	assert.False(t, equal)
 }
 
+func TestSiteParentNotMatch(t *testing.T) {
+	s1 := SiteSpec{
+		Name:   "site",
+		Parent: "relay1",
+	}
+	s2 := SiteSpec{
+		Name:   "site",
+		Parent: "relay2",
+	}
+	equal, err := s1.DeepEquals(s2)
+	assert.Nil(t, err)
+	assert.False(t, equal)
+}
+
 func TestSiteEqualNil(t *testing.T) {
 	s1 := SiteSpec{
 		Name: "site",
@@ -6,10 +6,58 @@
 
 package model
 
-import "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+import (
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue"
+)
 
 type SyncPackage struct {
-	Origin   string             `json:"origin,omitempty"`
-	CatalogVersions []CatalogVersionState     `json:"catalogversions,omitempty"`
-	Jobs     []v1alpha2.JobData `json:"jobs,omitempty"`
+	Origin          string                `json:"origin,omitempty"`
+	CatalogVersions []CatalogVersionState `json:"catalogversions,omitempty"`
+	Jobs            []v1alpha2.JobData    `json:"jobs,omitempty"`
+	// Tombstones are the catalog versions deleted at the parent site
+	Tombstones []CatalogVersionTombstone `json:"tombstones,omitempty"`
+	// Receipts acknowledge the jobs of the package once the site has processed them
+	Receipts []string `json:"receipts,omitempty"`
+	// Cursor marks the job notifications of the site covered by the package; a site passes
+	// it back when it waits for more work, so it doesn't miss notifications in between
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// SyncNotification tells a site that jobs are queued for it
+type SyncNotification struct {
+	Site   string `json:"site"`
+	Cursor string `json:"cursor"`
+}
+
+// CatalogVersionTombstone records the deletion of a catalog version
+type CatalogVersionTombstone struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	CatalogType string `json:"catalogType,omitempty"`
+	Generation  int64  `json:"generation,omitempty"`
+}
+
+// Conflict policies decide which side wins when a catalog version synced from the parent
+// site was modified at the child site
+const (
+	// ConflictPolicyParentWins overwrites local changes with the parent's version
+	ConflictPolicyParentWins = "parent-wins"
+	// ConflictPolicyChildWins keeps local changes and ignores the parent's version
+	ConflictPolicyChildWins = "child-wins"
+	// ConflictPolicyManual keeps local changes until the conflict is resolved
+	ConflictPolicyManual = "manual"
+)
+
+// SyncAck acknowledges the jobs a site has processed
+type SyncAck struct {
+	Receipts []string `json:"receipts"`
+}
+
+// SiteQueueStatus reports the jobs queued for a site
+type SiteQueueStatus struct {
+	Site        string               `json:"site"`
+	Pending     int                  `json:"pending"`
+	InFlight    int                  `json:"inFlight"`
+	DeadLetters []queue.QueueMessage `json:"deadLetters,omitempty"`
 }
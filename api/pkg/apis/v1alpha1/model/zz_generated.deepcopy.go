@@ -352,6 +352,11 @@ func (in *SiteSpec) DeepCopyInto(out *SiteSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.Heartbeat != nil {
+		in, out := &in.Heartbeat, &out.Heartbeat
+		*out = new(SiteHeartbeatSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SiteSpec.
@@ -381,6 +386,13 @@ func (in *SiteStatus) DeepCopyInto(out *SiteStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.CatalogConflicts != nil {
+		in, out := &in.CatalogConflicts, &out.CatalogConflicts
+		*out = make(map[string]CatalogConflict, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SiteStatus.
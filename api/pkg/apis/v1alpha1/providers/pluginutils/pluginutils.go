@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package pluginutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/scriptutils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+)
+
+const (
+	// HealthRoute is the route every plugin serves, relative to its URL
+	HealthRoute = "health"
+
+	DefaultTimeout        = "1m"
+	DefaultHealthInterval = "30s"
+	healthCheckTimeout    = 5 * time.Second
+	maxResponseSize       = 10 * 1024 * 1024
+)
+
+var (
+	healthLock  sync.Mutex
+	healthCache = map[string]healthRecord{}
+	// pluginClient doesn't follow redirects, so a plugin can't redirect calls to an address
+	// the security policy would reject
+	pluginClient = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+type healthRecord struct {
+	checked time.Time
+	err     error
+}
+
+// ErrorResponse is the body a plugin returns with a non-2xx status
+type ErrorResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Client calls an out-of-process provider that implements the plugin HTTP contract: a health
+// route, and routes that take and return JSON bodies
+type Client struct {
+	// URL is the base URL of the plugin, ending with a slash
+	URL            string
+	Token          string
+	Timeout        time.Duration
+	HealthInterval time.Duration
+}
+
+// NewClient creates a client of the plugin at a URL. Empty timeout and health interval
+// use the defaults; a health interval of "0s" checks the health before every call.
+func NewClient(pluginURL string, token string, timeout string, healthInterval string) (*Client, error) {
+	if timeout == "" {
+		timeout = DefaultTimeout
+	}
+	if healthInterval == "" {
+		healthInterval = DefaultHealthInterval
+	}
+	ret := &Client{URL: pluginURL, Token: token}
+	var err error
+	ret.Timeout, err = time.ParseDuration(timeout)
+	if err != nil || ret.Timeout <= 0 {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid plugin timeout '%s'", timeout), v1alpha2.BadConfig)
+	}
+	ret.HealthInterval, err = time.ParseDuration(healthInterval)
+	if err != nil || ret.HealthInterval < 0 {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid plugin health interval '%s'", healthInterval), v1alpha2.BadConfig)
+	}
+	if ret.URL != "" && !strings.HasSuffix(ret.URL, "/") {
+		ret.URL += "/"
+	}
+	return ret, nil
+}
+
+// CheckHealth calls the health route of the plugin. Results are cached per plugin URL
+// for the health interval, so a failing plugin isn't called for every request.
+func (c *Client) CheckHealth(ctx context.Context) error {
+	healthLock.Lock()
+	record, ok := healthCache[c.URL]
+	healthLock.Unlock()
+	if ok && time.Since(record.checked) < c.HealthInterval {
+		return record.err
+	}
+
+	hCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	err := c.callHealth(hCtx)
+
+	healthLock.Lock()
+	healthCache[c.URL] = healthRecord{checked: time.Now(), err: err}
+	healthLock.Unlock()
+	return err
+}
+
+func (c *Client) callHealth(ctx context.Context) error {
+	req, err := c.newRequest(ctx, http.MethodGet, HealthRoute, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := pluginClient.Do(req)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("plugin %s health check failed", c.URL), v1alpha2.InternalError)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("plugin %s health check returned status %d", c.URL, resp.StatusCode), v1alpha2.InternalError)
+	}
+	return nil
+}
+
+// Call sends a request to a route of the plugin and reads the response into response. A nil
+// request sends a GET, other requests are POSTed as JSON. Errors of the plugin are returned
+// as COAErrors with the state of the HTTP status.
+func (c *Client) Call(ctx context.Context, route string, request interface{}, response interface{}) error {
+	method := http.MethodGet
+	var body []byte
+	if request != nil {
+		method = http.MethodPost
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return v1alpha2.NewCOAError(err, "failed to serialize plugin request", v1alpha2.SerializationError)
+		}
+	}
+
+	pCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	req, err := c.newRequest(pCtx, method, route, body)
+	if err != nil {
+		return err
+	}
+	resp, err := pluginClient.Do(req)
+	if err != nil {
+		if pCtx.Err() == context.DeadlineExceeded {
+			return v1alpha2.NewCOAError(err, fmt.Sprintf("plugin %s timed out after %s", c.URL, c.Timeout), v1alpha2.TimedOut)
+		}
+		// a plugin that can't be reached is re-checked on the next call
+		c.invalidateHealth()
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to call plugin %s", c.URL), v1alpha2.HttpSendRequestFailed)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read response of plugin %s", c.URL), v1alpha2.HttpErrorResponse)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message := strings.TrimSpace(string(data))
+		var errResponse ErrorResponse
+		if json.Unmarshal(data, &errResponse) == nil && errResponse.Error != "" {
+			message = errResponse.Error
+		}
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("plugin %s returned status %d: %s", c.URL, resp.StatusCode, message), v1alpha2.GetHttpStatus(resp.StatusCode))
+	}
+	if len(bytes.TrimSpace(data)) > 0 && response != nil {
+		// unknown fields are rejected, like utils.UnmarshalJson does
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(response); err != nil {
+			return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to parse response of plugin %s", c.URL), v1alpha2.DeserializeError)
+		}
+	}
+	return nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, route string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+route, bytes.NewReader(body))
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to create request to plugin %s", c.URL), v1alpha2.HttpNewRequestFailed)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+func (c *Client) invalidateHealth() {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	delete(healthCache, c.URL)
+}
+
+// ValidateURL checks the plugin URL against the security policy. Plugins on private or
+// loopback addresses, such as sidecars, must be allowed with allowedIPRanges.
+func (c *Client) ValidateURL(mgrContext *contexts.ManagerContext) error {
+	if c.URL == "" {
+		return v1alpha2.NewCOAError(nil, "plugin url is not specified", v1alpha2.BadConfig)
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "invalid plugin url", v1alpha2.BadConfig)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid URL scheme %q: only http and https are permitted", u.Scheme), v1alpha2.BadConfig)
+	}
+	var allowedNets []*net.IPNet
+	exclusiveMode := false
+	if policy := mgrContext.GetSecurityPolicy(); policy != nil {
+		allowedNets, err = scriptutils.ParseIPRanges(policy.AllowedIPRanges)
+		if err != nil {
+			return v1alpha2.NewCOAError(err, "invalid allowedIPRanges in security policy", v1alpha2.BadConfig)
+		}
+		exclusiveMode = policy.AllowListExclusive
+	}
+	return scriptutils.ValidateURLHost(u.Hostname(), allowedNets, exclusiveMode)
+}
@@ -13,6 +13,7 @@ import (
 	catalogversionconfig "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/config/catalogversion"
 	memorygraph "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph/memory"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/secret"
+	containerstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/container"
 	counterstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/counter"
 	symphonystage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/create"
 	delaystage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/delay"
@@ -22,6 +23,7 @@ import (
 	materialize "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/materialize"
 	mockstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/mock"
 	patchstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/patch"
+	pluginstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/plugin"
 	httpproxystage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/proxy/http"
 	mqttproxystage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/proxy/mqtt"
 	remotestage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/remote"
@@ -29,9 +31,11 @@ import (
 	waitstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/wait"
 	k8sstate "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/states/k8s"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/adb"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/artifact"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/azure/adu"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/azure/iotedge"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/configmap"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/crd"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/docker"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/helm"
 	targethttp "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/http"
@@ -40,14 +44,19 @@ import (
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/kubectl"
 	tgtmock "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/mock"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/mqtt"
+	plugintarget "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/plugin"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/proxy"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/remoteagent"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/rust"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/script"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/staging"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/systemd"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/wasm"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/win10/sideload"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
 	cp "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	cacerts "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
 	mockconfig "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/config/mock"
 	memorykeylock "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/keylock/memory"
 	mockledger "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/ledger/mock"
@@ -55,6 +64,7 @@ import (
 	mempubsub "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
 	reidspubsub "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/redis"
 	memoryqueue "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue/memory"
+	redisqueue "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue/redis"
 	cvref "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/reference/customvision"
 	httpref "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/reference/http"
 	k8sref "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/reference/k8s"
@@ -89,8 +99,43 @@ func (c SymphonyProviderFactory) CreateProviders(config vendors.VendorConfig) (m
 	return ret, nil
 }
 
+// stageProviders creates the stage providers CreateProvider knows about, so campaign validation
+// checks stage provider types against the same table the factory creates them from
+var stageProviders = map[string]func() cp.IProvider{
+	"providers.stage.counter":     func() cp.IProvider { return &counterstage.CounterStageProvider{} },
+	"providers.stage.flaky":       func() cp.IProvider { return &flakystage.FlakyStageProvider{} },
+	"providers.stage.proxy.http":  func() cp.IProvider { return &httpproxystage.HTTPProxyStageProvider{} },
+	"providers.stage.proxy.mqtt":  func() cp.IProvider { return &mqttproxystage.MQTTProxyStageProvider{} },
+	"providers.stage.mock":        func() cp.IProvider { return &mockstage.MockStageProvider{} },
+	"providers.stage.http":        func() cp.IProvider { return &httpstage.HttpStageProvider{} },
+	"providers.stage.create":      func() cp.IProvider { return &symphonystage.CreateStageProvider{} },
+	"providers.stage.script":      func() cp.IProvider { return &scriptstage.ScriptStageProvider{} },
+	"providers.stage.container":   func() cp.IProvider { return &containerstage.ContainerStageProvider{} },
+	"providers.stage.plugin":      func() cp.IProvider { return &pluginstage.PluginStageProvider{} },
+	"providers.stage.patch":       func() cp.IProvider { return &patchstage.PatchStageProvider{} },
+	"providers.stage.list":        func() cp.IProvider { return &liststage.ListStageProvider{} },
+	"providers.stage.remote":      func() cp.IProvider { return &remotestage.RemoteStageProvider{} },
+	"providers.stage.wait":        func() cp.IProvider { return &waitstage.WaitStageProvider{} },
+	"providers.stage.delay":       func() cp.IProvider { return &delaystage.DelayStageProvider{} },
+	"providers.stage.materialize": func() cp.IProvider { return &materialize.MaterializeStageProvider{} },
+}
+
+// IsStageProviderType checks if the provider type is a stage provider known to this factory
+func IsStageProviderType(providerType string) bool {
+	_, ok := stageProviders[providerType]
+	return ok
+}
+
 func (s SymphonyProviderFactory) CreateProvider(providerType string, config cp.IProviderConfig) (cp.IProvider, error) {
 	var err error
+	if newProvider, ok := stageProviders[providerType]; ok {
+		mProvider := newProvider()
+		err = mProvider.Init(config)
+		if err == nil {
+			return mProvider, nil
+		}
+		return nil, err
+	}
 	switch providerType {
 	case "providers.state.memory":
 		mProvider := &memorystate.MemoryStateProvider{}
@@ -170,30 +215,6 @@ func (s SymphonyProviderFactory) CreateProvider(providerType string, config cp.I
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.counter":
-		mProvider := &counterstage.CounterStageProvider{}
-		err = mProvider.Init(config)
-		if err == nil {
-			return mProvider, nil
-		}
-	case "providers.stage.flaky":
-		mProvider := &flakystage.FlakyStageProvider{}
-		err = mProvider.Init(config)
-		if err == nil {
-			return mProvider, nil
-		}
-	case "providers.stage.proxy.http":
-		mProvider := &httpproxystage.HTTPProxyStageProvider{}
-		err = mProvider.Init(config)
-		if err == nil {
-			return mProvider, nil
-		}
-	case "providers.stage.proxy.mqtt":
-		mProvider := &mqttproxystage.MQTTProxyStageProvider{}
-		err = mProvider.Init(config)
-		if err == nil {
-			return mProvider, nil
-		}
 	case "providers.target.azure.iotedge":
 		mProvider := &iotedge.IoTEdgeTargetProvider{}
 		err = mProvider.Init(config)
@@ -260,134 +281,122 @@ func (s SymphonyProviderFactory) CreateProvider(providerType string, config cp.I
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.target.proxy":
-		mProvider := &proxy.ProxyUpdateProvider{}
-		err = mProvider.Init(config)
-		if err == nil {
-			return mProvider, nil
-		}
-	case "providers.target.mqtt":
-		mProvider := &mqtt.MQTTTargetProvider{}
-		err = mProvider.Init(config)
-		if err == nil {
-			return mProvider, nil
-		}
-	case "providers.target.mock":
-		mProvider := &tgtmock.MockTargetProvider{}
+	case "providers.target.systemd":
+		mProvider := &systemd.SystemdTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.target.configmap":
-		mProvider := &configmap.ConfigMapTargetProvider{}
+	case "providers.target.artifact":
+		mProvider := &artifact.ArtifactTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.target.rust":
-		mProvider := &rust.RustTargetProvider{}
+	case "providers.target.wasm":
+		mProvider := &wasm.WasmTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.config.mock":
-		mProvider := &mockconfig.MockConfigProvider{}
+	case "providers.target.crd":
+		mProvider := &crd.CRDTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.config.catalogversion":
-		mProvider := &catalogversionconfig.CatalogVersionConfigProvider{}
+	case "providers.target.remoteagent":
+		mProvider := &remoteagent.RemoteAgentTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.secret.mock":
-		mProvider := &mocksecret.MockSecretProvider{}
+	case "providers.target.plugin":
+		mProvider := &plugintarget.PluginTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.secret.k8s":
-		mProvider := &secret.K8sSecretProvider{}
+	case "providers.target.proxy":
+		mProvider := &proxy.ProxyUpdateProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.pubsub.memory":
-		mProvider := &mempubsub.InMemoryPubSubProvider{}
+	case "providers.target.mqtt":
+		mProvider := &mqtt.MQTTTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.pubsub.redis":
-		mProvider := &reidspubsub.RedisPubSubProvider{}
+	case "providers.target.mock":
+		mProvider := &tgtmock.MockTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.mock":
-		mProvider := &mockstage.MockStageProvider{}
+	case "providers.target.configmap":
+		mProvider := &configmap.ConfigMapTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.http":
-		mProvider := &httpstage.HttpStageProvider{}
+	case "providers.target.rust":
+		mProvider := &rust.RustTargetProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.create":
-		mProvider := &symphonystage.CreateStageProvider{}
+	case "providers.config.mock":
+		mProvider := &mockconfig.MockConfigProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.script":
-		mProvider := &scriptstage.ScriptStageProvider{}
+	case "providers.config.catalogversion":
+		mProvider := &catalogversionconfig.CatalogVersionConfigProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.patch":
-		mProvider := &patchstage.PatchStageProvider{}
+	case "providers.secret.mock":
+		mProvider := &mocksecret.MockSecretProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.list":
-		mProvider := &liststage.ListStageProvider{}
+	case "providers.secret.k8s":
+		mProvider := &secret.K8sSecretProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.remote":
-		mProvider := &remotestage.RemoteStageProvider{}
+	case "providers.pubsub.memory":
+		mProvider := &mempubsub.InMemoryPubSubProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.wait":
-		mProvider := &waitstage.WaitStageProvider{}
+	case "providers.pubsub.redis":
+		mProvider := &reidspubsub.RedisPubSubProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.delay":
-		mProvider := &delaystage.DelayStageProvider{}
+	case "providers.queue.memory":
+		mProvider := &memoryqueue.MemoryQueueProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.stage.materialize":
-		mProvider := &materialize.MaterializeStageProvider{}
+	case "providers.queue.redis":
+		mProvider := &redisqueue.RedisQueueProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
 		}
-	case "providers.queue.memory":
-		mProvider := &memoryqueue.MemoryQueueProvider{}
+	case "providers.certs.ca":
+		mProvider := &cacerts.CACertProvider{}
 		err = mProvider.Init(config)
 		if err == nil {
 			return mProvider, nil
@@ -505,6 +514,54 @@ func CreateProviderForTargetRole(context *contexts.ManagerContext, role string,
 					}
 					provider.Context = context
 					return provider, nil
+				case "providers.target.systemd":
+					provider := &systemd.SystemdTargetProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
+				case "providers.target.artifact":
+					provider := &artifact.ArtifactTargetProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
+				case "providers.target.wasm":
+					provider := &wasm.WasmTargetProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
+				case "providers.target.crd":
+					provider := &crd.CRDTargetProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
+				case "providers.target.remoteagent":
+					provider := &remoteagent.RemoteAgentTargetProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
+				case "providers.target.plugin":
+					provider := &plugintarget.PluginTargetProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
 				case "providers.target.proxy":
 					if override == nil {
 						provider := &proxy.ProxyUpdateProvider{}
@@ -689,6 +746,22 @@ func CreateProviderForTargetRole(context *contexts.ManagerContext, role string,
 					}
 					provider.SetContext(context)
 					return provider, nil
+				case "providers.stage.container":
+					provider := &containerstage.ContainerStageProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.SetContext(context)
+					return provider, nil
+				case "providers.stage.plugin":
+					provider := &pluginstage.PluginStageProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.SetContext(context)
+					return provider, nil
 				case "providers.stage.patch":
 					provider := &patchstage.PatchStageProvider{}
 					err := provider.InitWithMap(binding.Config)
@@ -777,6 +850,14 @@ func CreateProviderForTargetRole(context *contexts.ManagerContext, role string,
 					}
 					provider.Context = context
 					return provider, nil
+				case "providers.queue.redis":
+					provider := &redisqueue.RedisQueueProvider{}
+					err := provider.InitWithMap(binding.Config)
+					if err != nil {
+						return nil, err
+					}
+					provider.Context = context
+					return provider, nil
 				case "providers.graph.memory":
 					provider := &memorygraph.MemoryGraphProvider{}
 					err := provider.InitWithMap(binding.Config)
@@ -13,6 +13,7 @@ import (
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	catalogversionconfig "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/config/catalogversion"
 	memorygraph "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph/memory"
+	containerstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/container"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/counter"
 	symphonystage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/create"
 	delaystage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/delay"
@@ -21,29 +22,38 @@ import (
 	materialize "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/materialize"
 	mockstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/mock"
 	patchstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/patch"
+	pluginstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/plugin"
 	remotestage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/remote"
 	scriptstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/script"
 	waitstage "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage/wait"
 	k8sstate "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/states/k8s"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/adb"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/artifact"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/azure/adu"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/azure/iotedge"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/configmap"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/crd"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/docker"
 	targethttp "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/http"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/ingress"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/k8s"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/kubectl"
 	tgtmock "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/mock"
+	plugintarget "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/plugin"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/proxy"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/remoteagent"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/script"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/staging"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/systemd"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/wasm"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/win10/sideload"
+	cacerts "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
 	mockconfig "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/config/mock"
 	mockledger "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/ledger/mock"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/probe/rtsp"
 	mempubsub "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
 	memoryqueue "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue/memory"
+	redisqueue "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue/redis"
 	cvref "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/reference/customvision"
 	httpref "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/reference/http"
 	k8sref "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/reference/k8s"
@@ -80,6 +90,10 @@ func TestCreateProvider(t *testing.T) {
 		provider, err = providerfactory.CreateProvider("providers.state.redis", redisstate.RedisStateProviderConfig{Host: "localhost:6379"})
 		assert.Nil(t, err)
 		assert.NotNil(t, *provider.(*redisstate.RedisStateProvider))
+
+		provider, err = providerfactory.CreateProvider("providers.queue.redis", redisqueue.RedisQueueProviderConfig{Host: "localhost:6379"})
+		assert.Nil(t, err)
+		assert.NotNil(t, *provider.(*redisqueue.RedisQueueProvider))
 	}
 
 	if getTestMiniKubeEnabled == "" {
@@ -194,6 +208,34 @@ func TestCreateProvider(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, *provider.(*adb.AdbProvider))
 
+	provider, err = providerfactory.CreateProvider("providers.target.systemd", systemd.SystemdTargetProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*systemd.SystemdTargetProvider))
+
+	provider, err = providerfactory.CreateProvider("providers.target.artifact", artifact.ArtifactTargetProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*artifact.ArtifactTargetProvider))
+
+	provider, err = providerfactory.CreateProvider("providers.target.wasm", wasm.WasmTargetProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*wasm.WasmTargetProvider))
+
+	if getTestMiniKubeEnabled == "" {
+		t.Log("Skipping providers.target.crd test as TEST_MINIKUBE_ENABLED is not set")
+	} else {
+		provider, err = providerfactory.CreateProvider("providers.target.crd", crd.CRDTargetProviderConfig{ConfigType: "path"})
+		assert.Nil(t, err)
+		assert.NotNil(t, *provider.(*crd.CRDTargetProvider))
+	}
+
+	provider, err = providerfactory.CreateProvider("providers.target.remoteagent", remoteagent.RemoteAgentTargetProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*remoteagent.RemoteAgentTargetProvider))
+
+	provider, err = providerfactory.CreateProvider("providers.target.plugin", plugintarget.PluginTargetProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, provider.(*plugintarget.PluginTargetProvider))
+
 	provider, err = providerfactory.CreateProvider("providers.target.proxy", proxy.ProxyUpdateProviderConfig{})
 	assert.Nil(t, err)
 	assert.NotNil(t, *provider.(*proxy.ProxyUpdateProvider))
@@ -224,7 +266,7 @@ func TestCreateProvider(t *testing.T) {
 
 	provider, err = providerfactory.CreateProvider("providers.pubsub.memory", mempubsub.InMemoryPubSubConfig{})
 	assert.Nil(t, err)
-	assert.NotNil(t, *provider.(*mempubsub.InMemoryPubSubProvider))
+	assert.NotNil(t, provider.(*mempubsub.InMemoryPubSubProvider))
 
 	provider, err = providerfactory.CreateProvider("providers.stage.mock", mockstage.MockStageProviderConfig{})
 	assert.Nil(t, err)
@@ -242,6 +284,14 @@ func TestCreateProvider(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, provider.(*scriptstage.ScriptStageProvider))
 
+	provider, err = providerfactory.CreateProvider("providers.stage.container", containerstage.ContainerStageProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, provider.(*containerstage.ContainerStageProvider))
+
+	provider, err = providerfactory.CreateProvider("providers.stage.plugin", pluginstage.PluginStageProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, provider.(*pluginstage.PluginStageProvider))
+
 	provider, err = providerfactory.CreateProvider("providers.stage.patch", patchstage.PatchStageProviderConfig{})
 	assert.Nil(t, err)
 	assert.NotNil(t, *provider.(*patchstage.PatchStageProvider))
@@ -273,6 +323,10 @@ func TestCreateProvider(t *testing.T) {
 	provider, err = providerfactory.CreateProvider("providers.graph.memory", memorygraph.MemoryGraphProviderConfig{})
 	assert.Nil(t, err)
 	assert.NotNil(t, *provider.(*memorygraph.MemoryGraphProvider))
+
+	provider, err = providerfactory.CreateProvider("providers.certs.ca", cacerts.CACertProviderConfig{})
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*cacerts.CACertProvider))
 }
 
 func TestCreateProviderForTargetRole(t *testing.T) {
@@ -394,6 +448,42 @@ func TestCreateProviderForTargetRole(t *testing.T) {
 							Provider: "providers.target.adb",
 							Config:   map[string]string{},
 						},
+						{
+							Role:     "systemd",
+							Provider: "providers.target.systemd",
+							Config:   map[string]string{},
+						},
+						{
+							Role:     "artifact",
+							Provider: "providers.target.artifact",
+							Config:   map[string]string{},
+						},
+						{
+							Role:     "wasm",
+							Provider: "providers.target.wasm",
+							Config:   map[string]string{},
+						},
+						{
+							Role:     "crd",
+							Provider: "providers.target.crd",
+							Config: map[string]string{
+								"configType": "path",
+							},
+						},
+						{
+							Role:     "remoteagent",
+							Provider: "providers.target.remoteagent",
+							Config: map[string]string{
+								"targetName": "edge-01",
+							},
+						},
+						{
+							Role:     "plugin",
+							Provider: "providers.target.plugin",
+							Config: map[string]string{
+								"url": "http://firmware.tools.svc:8080/v1/",
+							},
+						},
 						{
 							Role:     "proxy",
 							Provider: "providers.target.proxy",
@@ -670,6 +760,34 @@ func TestCreateProviderForTargetRole(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, *provider.(*adb.AdbProvider))
 
+	provider, err = CreateProviderForTargetRole(nil, "systemd", targetState, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*systemd.SystemdTargetProvider))
+
+	provider, err = CreateProviderForTargetRole(nil, "artifact", targetState, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*artifact.ArtifactTargetProvider))
+
+	provider, err = CreateProviderForTargetRole(nil, "wasm", targetState, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*wasm.WasmTargetProvider))
+
+	if getTestMiniKubeEnabled == "" {
+		t.Log("Skipping crd test as TEST_MINIKUBE_ENABLED is not set")
+	} else {
+		provider, err = CreateProviderForTargetRole(nil, "crd", targetState, nil)
+		assert.Nil(t, err)
+		assert.NotNil(t, *provider.(*crd.CRDTargetProvider))
+	}
+
+	provider, err = CreateProviderForTargetRole(nil, "remoteagent", targetState, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, *provider.(*remoteagent.RemoteAgentTargetProvider))
+
+	provider, err = CreateProviderForTargetRole(nil, "plugin", targetState, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, provider.(*plugintarget.PluginTargetProvider))
+
 	provider, err = CreateProviderForTargetRole(nil, "proxy", targetState, nil)
 	assert.Nil(t, err)
 	assert.NotNil(t, *provider.(*proxy.ProxyUpdateProvider))
@@ -756,7 +874,7 @@ func TestCreateProviderForTargetRole(t *testing.T) {
 
 	provider, err = CreateProviderForTargetRole(nil, "mempubsub", targetState, nil)
 	assert.Nil(t, err)
-	assert.NotNil(t, *provider.(*mempubsub.InMemoryPubSubProvider))
+	assert.NotNil(t, provider.(*mempubsub.InMemoryPubSubProvider))
 
 	provider, err = CreateProviderForTargetRole(nil, "httpreporter", targetState, nil)
 	assert.Nil(t, err)
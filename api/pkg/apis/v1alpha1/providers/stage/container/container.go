@@ -0,0 +1,514 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/metrics"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/stage"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	utils2 "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	loggerName    = "providers.stage.container"
+	containerType = "container"
+
+	RuntimeDocker     = "docker"
+	RuntimeKubernetes = "kubernetes"
+
+	InputModeEnv  = "env"
+	InputModeFile = "file"
+	InputModeBoth = "both"
+
+	OutputModeStdout = "stdout"
+	OutputModeFile   = "file"
+
+	// InputsFile is the path of the inputs JSON file inside the container
+	InputsFile = "/symphony/inputs.json"
+	// OutputsFile is the path the container writes its outputs JSON to
+	OutputsFile = "/symphony/outputs.json"
+
+	defaultCPU     = "1"
+	defaultMemory  = "512Mi"
+	defaultTimeout = "10m"
+)
+
+var (
+	sLog                     = logger.NewLogger(loggerName)
+	once                     sync.Once
+	providerOperationMetrics *metrics.Metrics
+	envNameSanitizer         = regexp.MustCompile(`[^A-Z0-9_]`)
+)
+
+type ContainerStageProviderConfig struct {
+	Name       string   `json:"name"`
+	Runtime    string   `json:"runtime,omitempty"`
+	Image      string   `json:"image"`
+	Command    []string `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	InputMode  string   `json:"inputMode,omitempty"`
+	OutputMode string   `json:"outputMode,omitempty"`
+	CPU        string   `json:"cpu,omitempty"`
+	Memory     string   `json:"memory,omitempty"`
+	Timeout    string   `json:"timeout,omitempty"`
+	// AllowNetwork gives the container network access. Containers run without a network by default (docker runtime only).
+	AllowNetwork bool `json:"allowNetwork,omitempty"`
+	// Kubernetes runtime settings, same as the K8s target provider
+	InCluster  bool   `json:"inCluster,omitempty"`
+	ConfigType string `json:"configType,omitempty"`
+	ConfigData string `json:"configData,omitempty"`
+}
+
+// containerRun describes a single container execution
+type containerRun struct {
+	Name      string
+	Namespace string
+	Image     string
+	Command   []string
+	Args      []string
+	Env       map[string]string
+	// InputsFile is the content of InputsFile, nil if inputs are not passed as a file
+	InputsFile   []byte
+	ReadOutputs  bool
+	NanoCPUs     int64
+	CPU          resource.Quantity
+	Memory       resource.Quantity
+	Timeout      time.Duration
+	AllowNetwork bool
+}
+
+type containerResult struct {
+	ExitCode int
+	Stdout   []byte
+	// Outputs is the content of OutputsFile, if requested
+	Outputs []byte
+}
+
+// containerRunner runs a container to completion
+type containerRunner interface {
+	Run(ctx context.Context, run containerRun) (containerResult, error)
+}
+
+type ContainerStageProvider struct {
+	Config  ContainerStageProviderConfig
+	Context *contexts.ManagerContext
+	runner  containerRunner
+}
+
+func ContainerStageProviderConfigFromMap(properties map[string]string) (ContainerStageProviderConfig, error) {
+	ret := ContainerStageProviderConfig{}
+	ret.Name = properties["name"]
+	ret.Runtime = properties["runtime"]
+	ret.Image = properties["image"]
+	ret.InputMode = properties["inputMode"]
+	ret.OutputMode = properties["outputMode"]
+	ret.CPU = properties["cpu"]
+	ret.Memory = properties["memory"]
+	ret.Timeout = properties["timeout"]
+	ret.ConfigType = properties["configType"]
+	ret.ConfigData = properties["configData"]
+	for _, key := range []string{"command", "args"} {
+		if v, ok := properties[key]; ok && v != "" {
+			var list []string
+			if err := json.Unmarshal([]byte(v), &list); err != nil {
+				return ret, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid '%s' setting of container stage provider, expected a JSON array of strings", key), v1alpha2.BadConfig)
+			}
+			if key == "command" {
+				ret.Command = list
+			} else {
+				ret.Args = list
+			}
+		}
+	}
+	for _, key := range []string{"allowNetwork", "inCluster"} {
+		if v, ok := properties[key]; ok && v != "" {
+			bVal, err := strconv.ParseBool(v)
+			if err != nil {
+				return ret, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid bool value in the '%s' setting of container stage provider", key), v1alpha2.BadConfig)
+			}
+			if key == "allowNetwork" {
+				ret.AllowNetwork = bVal
+			} else {
+				ret.InCluster = bVal
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (i *ContainerStageProvider) InitWithMap(properties map[string]string) error {
+	config, err := ContainerStageProviderConfigFromMap(properties)
+	if err != nil {
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *ContainerStageProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *ContainerStageProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("[Stage] Container Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Container Stage): Init()")
+
+	updateConfig, err := toContainerStageProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Container Stage): expected ContainerStageProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected ContainerStageProviderConfig", v1alpha2.BadConfig)
+		return err
+	}
+	if updateConfig.Runtime == "" {
+		updateConfig.Runtime = RuntimeDocker
+	}
+	if updateConfig.InputMode == "" {
+		updateConfig.InputMode = InputModeEnv
+	}
+	if updateConfig.OutputMode == "" {
+		updateConfig.OutputMode = OutputModeStdout
+	}
+	if updateConfig.Runtime != RuntimeDocker && updateConfig.Runtime != RuntimeKubernetes {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid runtime '%s', expected '%s' or '%s'", updateConfig.Runtime, RuntimeDocker, RuntimeKubernetes), v1alpha2.BadConfig)
+		return err
+	}
+	if updateConfig.InputMode != InputModeEnv && updateConfig.InputMode != InputModeFile && updateConfig.InputMode != InputModeBoth {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid input mode '%s', expected '%s', '%s' or '%s'", updateConfig.InputMode, InputModeEnv, InputModeFile, InputModeBoth), v1alpha2.BadConfig)
+		return err
+	}
+	if updateConfig.OutputMode != OutputModeStdout && updateConfig.OutputMode != OutputModeFile {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid output mode '%s', expected '%s' or '%s'", updateConfig.OutputMode, OutputModeStdout, OutputModeFile), v1alpha2.BadConfig)
+		return err
+	}
+	i.Config = updateConfig
+
+	once.Do(func() {
+		if providerOperationMetrics == nil {
+			providerOperationMetrics, err = metrics.New()
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Container Stage): failed to create metrics: %+v", err)
+			}
+		}
+	})
+	return err
+}
+
+func toContainerStageProviderConfig(config providers.IProviderConfig) (ContainerStageProviderConfig, error) {
+	ret := ContainerStageProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = utils2.UnmarshalJson(data, &ret)
+	return ret, err
+}
+
+func (i *ContainerStageProvider) Process(ctx context.Context, mgrContext contexts.ManagerContext, inputs map[string]interface{}) (map[string]interface{}, bool, error) {
+	ctx, span := observability.StartSpan("[Stage] Container Provider", ctx, &map[string]string{
+		"method": "Process",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Container Stage): start process request, image: %s", i.Config.Image)
+
+	processTime := time.Now().UTC()
+	functionName := observ_utils.GetFunctionName()
+	defer providerOperationMetrics.ProviderOperationLatency(
+		processTime,
+		containerType,
+		metrics.ProcessOperation,
+		metrics.RunOperationType,
+		functionName,
+	)
+
+	var run containerRun
+	run, err = i.buildRun(inputs)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Container Stage): rejected container run: %+v", err)
+		return nil, false, err
+	}
+
+	var runner containerRunner
+	runner, err = i.getRunner()
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Container Stage): failed to create %s runner: %+v", i.Config.Runtime, err)
+		return nil, false, err
+	}
+
+	observ_utils.EmitUserAuditsLogs(ctx, "  P (Container Stage): Start to run container %s with image %s", run.Name, run.Image)
+	runCtx, cancel := context.WithTimeout(ctx, run.Timeout)
+	defer cancel()
+	var result containerResult
+	result, err = runner.Run(runCtx, run)
+	if err == nil && runCtx.Err() == context.DeadlineExceeded {
+		err = runCtx.Err()
+	}
+	if err != nil {
+		if runCtx.Err() == context.DeadlineExceeded {
+			err = v1alpha2.NewCOAError(err, fmt.Sprintf("container %s timed out after %s", run.Name, run.Timeout), v1alpha2.TimedOut)
+		}
+		sLog.ErrorfCtx(ctx, "  P (Container Stage): failed to run container %s: %+v", run.Name, err)
+		providerOperationMetrics.ProviderOperationErrors(
+			containerType,
+			functionName,
+			metrics.ProcessOperation,
+			metrics.RunOperationType,
+			v1alpha2.GetErrorState(err).String(),
+		)
+		return nil, false, err
+	}
+	sLog.DebugfCtx(ctx, "  P (Container Stage): container %s exited with code %d, output: %s", run.Name, result.ExitCode, result.Stdout)
+
+	var outputs map[string]interface{}
+	outputs, err = i.parseOutputs(result)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Container Stage): failed to parse container output (expected map[string]interface{}): %+v", err)
+		providerOperationMetrics.ProviderOperationErrors(
+			containerType,
+			functionName,
+			metrics.ProcessOperation,
+			metrics.RunOperationType,
+			v1alpha2.ScriptResultParsingFailed.String(),
+		)
+		return nil, false, err
+	}
+	if result.ExitCode != 0 {
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("container %s exited with code %d", run.Name, result.ExitCode), v1alpha2.InternalError)
+		providerOperationMetrics.ProviderOperationErrors(
+			containerType,
+			functionName,
+			metrics.ProcessOperation,
+			metrics.RunOperationType,
+			v1alpha2.ScriptExecutionFailed.String(),
+		)
+		return outputs, false, err
+	}
+	return outputs, false, nil
+}
+
+func (i *ContainerStageProvider) getRunner() (containerRunner, error) {
+	if i.runner != nil {
+		return i.runner, nil
+	}
+	switch i.Config.Runtime {
+	case RuntimeKubernetes:
+		return newKubernetesRunner(i.Config)
+	default:
+		return newDockerRunner()
+	}
+}
+
+// buildRun validates the requested container against the server-side security policy
+// and resolves the inputs, limits and name of the run
+func (i *ContainerStageProvider) buildRun(inputs map[string]interface{}) (containerRun, error) {
+	policy := i.Context.GetSecurityPolicy()
+	if policy == nil {
+		policy = &contexts.SecurityPolicy{}
+	}
+	if i.Config.Image == "" {
+		return containerRun{}, v1alpha2.NewCOAError(nil, "container image is not specified", v1alpha2.BadConfig)
+	}
+	if !IsImageAllowed(i.Config.Image, policy.AllowedImages) {
+		return containerRun{}, v1alpha2.NewCOAError(nil, fmt.Sprintf("image '%s' is not allowed by the security policy", i.Config.Image), v1alpha2.Forbidden)
+	}
+
+	run := containerRun{
+		Name:         fmt.Sprintf("symphony-stage-%s", strconv.FormatInt(time.Now().UnixNano(), 36)),
+		Image:        i.Config.Image,
+		Command:      i.Config.Command,
+		Args:         i.Config.Args,
+		Env:          map[string]string{},
+		ReadOutputs:  i.Config.OutputMode == OutputModeFile,
+		AllowNetwork: i.Config.AllowNetwork,
+	}
+	namespace := stage.GetNamespace(inputs)
+	if namespace == "" {
+		namespace = "default"
+	}
+	run.Namespace = namespace
+
+	var err error
+	run.CPU, err = resolveQuantity("cpu", i.Config.CPU, policy.MaxContainerCPU, defaultCPU)
+	if err != nil {
+		return containerRun{}, err
+	}
+	run.NanoCPUs = run.CPU.MilliValue() * 1000000
+	run.Memory, err = resolveQuantity("memory", i.Config.Memory, policy.MaxContainerMemory, defaultMemory)
+	if err != nil {
+		return containerRun{}, err
+	}
+	run.Timeout, err = resolveTimeout(i.Config.Timeout, policy.MaxContainerTimeout)
+	if err != nil {
+		return containerRun{}, err
+	}
+
+	if i.Config.InputMode == InputModeEnv || i.Config.InputMode == InputModeBoth {
+		for k, v := range BuildInputEnv(inputs) {
+			run.Env[k] = v
+		}
+	}
+	if i.Config.InputMode == InputModeFile || i.Config.InputMode == InputModeBoth {
+		run.InputsFile, _ = json.Marshal(filterInputs(inputs))
+		run.Env["SYMPHONY_INPUTS_FILE"] = InputsFile
+	}
+	if run.ReadOutputs {
+		run.Env["SYMPHONY_OUTPUTS_FILE"] = OutputsFile
+	}
+	return run, nil
+}
+
+// parseOutputs reads the outputs from the outputs file or stdout. Stdout that is not
+// a JSON object is returned as the 'stdout' output.
+func (i *ContainerStageProvider) parseOutputs(result containerResult) (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	if i.Config.OutputMode == OutputModeFile {
+		if len(strings.TrimSpace(string(result.Outputs))) > 0 {
+			if err := utils2.UnmarshalJson(result.Outputs, &ret); err != nil {
+				if result.ExitCode == 0 {
+					return nil, v1alpha2.NewCOAError(err, "failed to parse container outputs file", v1alpha2.ScriptResultParsingFailed)
+				}
+				ret = make(map[string]interface{})
+			}
+		}
+	} else {
+		trimmed := strings.TrimSpace(string(result.Stdout))
+		if strings.HasPrefix(trimmed, "{") && json.Unmarshal([]byte(trimmed), &ret) == nil {
+			// stdout is a JSON object
+		} else {
+			ret = map[string]interface{}{
+				"stdout": trimmed,
+			}
+		}
+	}
+	ret["exitCode"] = result.ExitCode
+	return ret, nil
+}
+
+// IsImageAllowed checks the image against the allow-list patterns, where '*' matches
+// any sequence of characters. Images without a tag or digest are matched as ':latest'.
+func IsImageAllowed(image string, patterns []string) bool {
+	candidates := []string{image}
+	lastPart := image[strings.LastIndex(image, "/")+1:]
+	if !strings.Contains(lastPart, ":") && !strings.Contains(lastPart, "@") {
+		candidates = append(candidates, image+":latest")
+	}
+	for _, pattern := range patterns {
+		expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		for _, c := range candidates {
+			if re.MatchString(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BuildInputEnv maps stage inputs to SYMPHONY_INPUT_<NAME> environment variables.
+// Non-string values are JSON encoded.
+func BuildInputEnv(inputs map[string]interface{}) map[string]string {
+	ret := make(map[string]string)
+	for k, v := range filterInputs(inputs) {
+		name := "SYMPHONY_INPUT_" + envNameSanitizer.ReplaceAllString(strings.ToUpper(k), "_")
+		if s, ok := v.(string); ok {
+			ret[name] = s
+		} else {
+			data, _ := json.Marshal(v)
+			ret[name] = string(data)
+		}
+	}
+	return ret
+}
+
+// filterInputs removes the system inputs (prefixed with '__')
+func filterInputs(inputs map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for k, v := range inputs {
+		if !strings.HasPrefix(k, "__") {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+func resolveQuantity(name string, requested string, max string, def string) (resource.Quantity, error) {
+	var maxQ *resource.Quantity
+	if max != "" {
+		q, err := resource.ParseQuantity(max)
+		if err != nil {
+			return resource.Quantity{}, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid maximum container %s in security policy", name), v1alpha2.BadConfig)
+		}
+		maxQ = &q
+	}
+	if requested == "" {
+		// the default is capped at the policy maximum
+		q := resource.MustParse(def)
+		if maxQ != nil && q.Cmp(*maxQ) > 0 {
+			return *maxQ, nil
+		}
+		return q, nil
+	}
+	q, err := resource.ParseQuantity(requested)
+	if err != nil {
+		return resource.Quantity{}, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid container %s '%s'", name, requested), v1alpha2.BadConfig)
+	}
+	if maxQ != nil && q.Cmp(*maxQ) > 0 {
+		return resource.Quantity{}, v1alpha2.NewCOAError(nil, fmt.Sprintf("container %s '%s' exceeds the maximum of '%s'", name, requested, max), v1alpha2.BadConfig)
+	}
+	return q, nil
+}
+
+func resolveTimeout(requested string, max string) (time.Duration, error) {
+	var maxD time.Duration
+	if max != "" {
+		d, err := time.ParseDuration(max)
+		if err != nil {
+			return 0, v1alpha2.NewCOAError(err, "invalid maximum container timeout in security policy", v1alpha2.BadConfig)
+		}
+		maxD = d
+	}
+	if requested == "" {
+		d, _ := time.ParseDuration(defaultTimeout)
+		if maxD > 0 && d > maxD {
+			return maxD, nil
+		}
+		return d, nil
+	}
+	d, err := time.ParseDuration(requested)
+	if err != nil || d <= 0 {
+		return 0, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid container timeout '%s'", requested), v1alpha2.BadConfig)
+	}
+	if maxD > 0 && d > maxD {
+		return 0, v1alpha2.NewCOAError(nil, fmt.Sprintf("container timeout '%s' exceeds the maximum of '%s'", requested, max), v1alpha2.BadConfig)
+	}
+	return d, nil
+}
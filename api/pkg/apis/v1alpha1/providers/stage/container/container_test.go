@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package container
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeRunner struct {
+	result containerResult
+	err    error
+	delay  time.Duration
+	runs   []containerRun
+}
+
+func (f *fakeRunner) Run(ctx context.Context, run containerRun) (containerResult, error) {
+	f.runs = append(f.runs, run)
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return containerResult{}, ctx.Err()
+		}
+	}
+	return f.result, f.err
+}
+
+func newTestProvider(t *testing.T, config ContainerStageProviderConfig, policy *contexts.SecurityPolicy, runner containerRunner) *ContainerStageProvider {
+	provider := &ContainerStageProvider{}
+	err := provider.Init(config)
+	require.Nil(t, err)
+	provider.SetContext(&contexts.ManagerContext{
+		VencorContext: &contexts.VendorContext{
+			SecurityPolicy: policy,
+		},
+	})
+	provider.runner = runner
+	return provider
+}
+
+func TestContainerInitWithMap(t *testing.T) {
+	provider := ContainerStageProvider{}
+	err := provider.InitWithMap(map[string]string{
+		"name":         "test",
+		"runtime":      "kubernetes",
+		"image":        "alpine:3.19",
+		"command":      `["sh", "-c"]`,
+		"args":         `["echo hello"]`,
+		"inputMode":    "both",
+		"outputMode":   "file",
+		"allowNetwork": "true",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, RuntimeKubernetes, provider.Config.Runtime)
+	assert.Equal(t, []string{"sh", "-c"}, provider.Config.Command)
+	assert.Equal(t, []string{"echo hello"}, provider.Config.Args)
+	assert.True(t, provider.Config.AllowNetwork)
+}
+
+func TestContainerInitDefaults(t *testing.T) {
+	provider := ContainerStageProvider{}
+	err := provider.Init(ContainerStageProviderConfig{Image: "alpine"})
+	assert.Nil(t, err)
+	assert.Equal(t, RuntimeDocker, provider.Config.Runtime)
+	assert.Equal(t, InputModeEnv, provider.Config.InputMode)
+	assert.Equal(t, OutputModeStdout, provider.Config.OutputMode)
+}
+
+func TestContainerInitInvalid(t *testing.T) {
+	provider := ContainerStageProvider{}
+	err := provider.InitWithMap(map[string]string{
+		"image":   "alpine",
+		"command": "sh -c",
+	})
+	assert.NotNil(t, err)
+	err = provider.Init(ContainerStageProviderConfig{Image: "alpine", Runtime: "podman"})
+	assert.NotNil(t, err)
+	err = provider.Init(ContainerStageProviderConfig{Image: "alpine", InputMode: "stdin"})
+	assert.NotNil(t, err)
+	err = provider.Init(ContainerStageProviderConfig{Image: "alpine", OutputMode: "stderr"})
+	assert.NotNil(t, err)
+}
+
+func TestIsImageAllowed(t *testing.T) {
+	patterns := []string{"alpine:*", "myregistry.io/tools/*", "busybox:1.36"}
+	assert.True(t, IsImageAllowed("alpine:3.19", patterns))
+	assert.True(t, IsImageAllowed("alpine", patterns))
+	assert.True(t, IsImageAllowed("myregistry.io/tools/jq:1.7", patterns))
+	assert.True(t, IsImageAllowed("busybox:1.36", patterns))
+	assert.False(t, IsImageAllowed("busybox", patterns))
+	assert.False(t, IsImageAllowed("myregistry.io/other/jq:1.7", patterns))
+	assert.False(t, IsImageAllowed("evil.io/alpine:3.19", patterns))
+	assert.False(t, IsImageAllowed("alpine:3.19", nil))
+}
+
+func TestBuildInputEnv(t *testing.T) {
+	env := BuildInputEnv(map[string]interface{}{
+		"message":     "hello",
+		"retry-count": 3,
+		"tags":        []string{"a", "b"},
+		"__campaign":  "test",
+	})
+	assert.Equal(t, map[string]string{
+		"SYMPHONY_INPUT_MESSAGE":     "hello",
+		"SYMPHONY_INPUT_RETRY_COUNT": "3",
+		"SYMPHONY_INPUT_TAGS":        `["a","b"]`,
+	}, env)
+}
+
+func TestContainerImageNotAllowed(t *testing.T) {
+	runner := &fakeRunner{}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "ubuntu:22.04"}, &contexts.SecurityPolicy{
+		AllowedImages: []string{"alpine:*"},
+	}, runner)
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.Forbidden, v1alpha2.GetErrorState(err))
+	assert.Empty(t, runner.runs)
+}
+
+func TestContainerNoSecurityPolicy(t *testing.T) {
+	runner := &fakeRunner{}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine:3.19"}, nil, runner)
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.Forbidden, v1alpha2.GetErrorState(err))
+}
+
+func TestContainerLimits(t *testing.T) {
+	runner := &fakeRunner{}
+	policy := &contexts.SecurityPolicy{
+		AllowedImages:       []string{"alpine:*"},
+		MaxContainerCPU:     "500m",
+		MaxContainerMemory:  "256Mi",
+		MaxContainerTimeout: "1m",
+	}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine:3.19"}, policy, runner)
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	require.Equal(t, 1, len(runner.runs))
+	assert.Equal(t, "500m", runner.runs[0].CPU.String())
+	assert.Equal(t, int64(500000000), runner.runs[0].NanoCPUs)
+	assert.Equal(t, "256Mi", runner.runs[0].Memory.String())
+	assert.Equal(t, time.Minute, runner.runs[0].Timeout)
+
+	provider = newTestProvider(t, ContainerStageProviderConfig{Image: "alpine:3.19", CPU: "250m", Memory: "128Mi", Timeout: "30s"}, policy, runner)
+	_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	require.Equal(t, 2, len(runner.runs))
+	assert.Equal(t, "250m", runner.runs[1].CPU.String())
+	assert.Equal(t, "128Mi", runner.runs[1].Memory.String())
+	assert.Equal(t, 30*time.Second, runner.runs[1].Timeout)
+
+	for _, config := range []ContainerStageProviderConfig{
+		{Image: "alpine:3.19", CPU: "2"},
+		{Image: "alpine:3.19", Memory: "1Gi"},
+		{Image: "alpine:3.19", Timeout: "2m"},
+	} {
+		provider = newTestProvider(t, config, policy, runner)
+		_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+		assert.NotNil(t, err)
+		assert.Equal(t, v1alpha2.BadConfig, v1alpha2.GetErrorState(err))
+	}
+	assert.Equal(t, 2, len(runner.runs))
+}
+
+func TestContainerInputModes(t *testing.T) {
+	runner := &fakeRunner{}
+	policy := &contexts.SecurityPolicy{AllowedImages: []string{"*"}}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine", InputMode: InputModeFile, OutputMode: OutputModeFile}, policy, runner)
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{
+		"key":         "value",
+		"__namespace": "test-ns",
+	})
+	assert.Nil(t, err)
+	require.Equal(t, 1, len(runner.runs))
+	run := runner.runs[0]
+	assert.Equal(t, "test-ns", run.Namespace)
+	assert.JSONEq(t, `{"key":"value"}`, string(run.InputsFile))
+	assert.True(t, run.ReadOutputs)
+	assert.Equal(t, map[string]string{
+		"SYMPHONY_INPUTS_FILE":  InputsFile,
+		"SYMPHONY_OUTPUTS_FILE": OutputsFile,
+	}, run.Env)
+
+	provider = newTestProvider(t, ContainerStageProviderConfig{Image: "alpine"}, policy, runner)
+	_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{"key": "value"})
+	assert.Nil(t, err)
+	require.Equal(t, 2, len(runner.runs))
+	run = runner.runs[1]
+	assert.Equal(t, "default", run.Namespace)
+	assert.Nil(t, run.InputsFile)
+	assert.False(t, run.ReadOutputs)
+	assert.Equal(t, map[string]string{"SYMPHONY_INPUT_KEY": "value"}, run.Env)
+}
+
+func TestContainerStdoutOutputs(t *testing.T) {
+	policy := &contexts.SecurityPolicy{AllowedImages: []string{"*"}}
+	runner := &fakeRunner{result: containerResult{Stdout: []byte(`{"status": "done", "count": 2}` + "\n")}}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine"}, policy, runner)
+	outputs, paused, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.False(t, paused)
+	assert.Equal(t, "done", outputs["status"])
+	assert.Equal(t, float64(2), outputs["count"])
+	assert.Equal(t, 0, outputs["exitCode"])
+
+	runner.result = containerResult{Stdout: []byte("hello world\n")}
+	outputs, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", outputs["stdout"])
+}
+
+func TestContainerFileOutputs(t *testing.T) {
+	policy := &contexts.SecurityPolicy{AllowedImages: []string{"*"}}
+	runner := &fakeRunner{result: containerResult{Stdout: []byte("log line"), Outputs: []byte(`{"result": "ok"}`)}}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine", OutputMode: OutputModeFile}, policy, runner)
+	outputs, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"result": "ok", "exitCode": 0}, outputs)
+
+	runner.result = containerResult{Outputs: []byte("not json")}
+	_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.ScriptResultParsingFailed, v1alpha2.GetErrorState(err))
+}
+
+func TestContainerNonZeroExit(t *testing.T) {
+	policy := &contexts.SecurityPolicy{AllowedImages: []string{"*"}}
+	runner := &fakeRunner{result: containerResult{ExitCode: 3, Stdout: []byte("boom")}}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine"}, policy, runner)
+	outputs, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, outputs["exitCode"])
+	assert.Equal(t, "boom", outputs["stdout"])
+}
+
+func TestContainerTimeout(t *testing.T) {
+	policy := &contexts.SecurityPolicy{AllowedImages: []string{"*"}}
+	runner := &fakeRunner{delay: 5 * time.Second}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine", Timeout: "100ms"}, policy, runner)
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.TimedOut, v1alpha2.GetErrorState(err))
+}
+
+func TestKubernetesRunner(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	runner := &kubernetesRunner{client: client, pollInterval: 10 * time.Millisecond}
+	provider := newTestProvider(t, ContainerStageProviderConfig{Image: "alpine", InputMode: InputModeBoth, OutputMode: OutputModeFile}, &contexts.SecurityPolicy{
+		AllowedImages: []string{"alpine"},
+	}, runner)
+
+	go func() {
+		ctx := context.Background()
+		for {
+			jobs, err := client.BatchV1().Jobs("default").List(ctx, metav1.ListOptions{})
+			if err == nil && len(jobs.Items) > 0 {
+				job := jobs.Items[0]
+				// the inputs config map is created before the job
+				if _, err := client.CoreV1().ConfigMaps("default").Get(ctx, job.Name, metav1.GetOptions{}); err != nil {
+					return
+				}
+				_, _ = client.CoreV1().Pods("default").Create(ctx, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   job.Name + "-abcde",
+						Labels: job.Spec.Template.Labels,
+					},
+					Status: corev1.PodStatus{
+						ContainerStatuses: []corev1.ContainerStatus{{
+							Name: stageLabel,
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									ExitCode: 0,
+									Message:  `{"result": "ok"}`,
+								},
+							},
+						}},
+					},
+				}, metav1.CreateOptions{})
+				job.Status.Succeeded = 1
+				_, _ = client.BatchV1().Jobs("default").UpdateStatus(ctx, &job, metav1.UpdateOptions{})
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	outputs, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{"key": "value"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", outputs["result"])
+	assert.Equal(t, 0, outputs["exitCode"])
+
+	// the job and the inputs config map are cleaned up
+	jobs, err := client.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, jobs.Items)
+	configMaps, err := client.CoreV1().ConfigMaps("default").List(context.Background(), metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, configMaps.Items)
+}
+
+func TestBuildJob(t *testing.T) {
+	provider := newTestProvider(t, ContainerStageProviderConfig{
+		Image:      "alpine",
+		Command:    []string{"sh", "-c"},
+		Args:       []string{"cat $SYMPHONY_INPUTS_FILE > $SYMPHONY_OUTPUTS_FILE"},
+		InputMode:  InputModeFile,
+		OutputMode: OutputModeFile,
+		Timeout:    "90s",
+	}, &contexts.SecurityPolicy{AllowedImages: []string{"alpine"}}, nil)
+	run, err := provider.buildRun(map[string]interface{}{"key": "value"})
+	require.Nil(t, err)
+	job := buildJob(run)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	assert.Equal(t, int64(90), *job.Spec.ActiveDeadlineSeconds)
+	pod := job.Spec.Template.Spec
+	assert.Equal(t, corev1.RestartPolicyNever, pod.RestartPolicy)
+	assert.False(t, *pod.AutomountServiceAccountToken)
+	require.Equal(t, 1, len(pod.Containers))
+	c := pod.Containers[0]
+	assert.Equal(t, OutputsFile, c.TerminationMessagePath)
+	assert.Equal(t, InputsFile, c.VolumeMounts[0].MountPath)
+	assert.Equal(t, run.Name, pod.Volumes[0].ConfigMap.Name)
+	assert.Equal(t, "1", c.Resources.Limits.Cpu().String())
+	assert.Equal(t, "512Mi", c.Resources.Limits.Memory().String())
+}
+
+func TestDockerRunner(t *testing.T) {
+	testDocker := os.Getenv("TEST_DOCKER_PROVIDER")
+	if testDocker == "" {
+		t.Skip("Skipping because TEST_DOCKER_PROVIDER environment variable is not set")
+	}
+	runner, err := newDockerRunner()
+	require.Nil(t, err)
+	provider := newTestProvider(t, ContainerStageProviderConfig{
+		Image:      "alpine:3.19",
+		Command:    []string{"sh", "-c"},
+		Args:       []string{`echo "{\"message\": \"$SYMPHONY_INPUT_MESSAGE\"}" > $SYMPHONY_OUTPUTS_FILE`},
+		OutputMode: OutputModeFile,
+	}, &contexts.SecurityPolicy{AllowedImages: []string{"alpine:*"}}, runner)
+	outputs, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{"message": "hello"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", outputs["message"])
+}
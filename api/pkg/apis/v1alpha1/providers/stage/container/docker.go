@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+)
+
+// dockerRunner runs stage containers on the local docker engine
+type dockerRunner struct {
+	client *client.Client
+}
+
+func newDockerRunner() (containerRunner, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to create docker client", v1alpha2.InternalError)
+	}
+	return &dockerRunner{client: cli}, nil
+}
+
+func (d *dockerRunner) Run(ctx context.Context, run containerRun) (containerResult, error) {
+	ret := containerResult{}
+	if _, _, err := d.client.ImageInspectWithRaw(ctx, run.Image); err != nil {
+		sLog.InfofCtx(ctx, "  P (Container Stage): pulling image %s", run.Image)
+		reader, err := d.client.ImagePull(ctx, run.Image, image.PullOptions{})
+		if err != nil {
+			return ret, err
+		}
+		_, err = io.Copy(io.Discard, reader)
+		reader.Close()
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	env := make([]string, 0, len(run.Env))
+	for k, v := range run.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	hostConfig := &container.HostConfig{
+		Resources: container.Resources{
+			NanoCPUs: run.NanoCPUs,
+			Memory:   run.Memory.Value(),
+		},
+	}
+	if !run.AllowNetwork {
+		hostConfig.NetworkMode = "none"
+	}
+	config := &container.Config{
+		Image: run.Image,
+		Env:   env,
+		Cmd:   run.Args,
+	}
+	if len(run.Command) > 0 {
+		config.Entrypoint = run.Command
+	}
+	created, err := d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, run.Name)
+	if err != nil {
+		return ret, err
+	}
+	defer func() {
+		// The run context may already be cancelled, so the container is removed with a fresh one
+		removeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := d.client.ContainerRemove(removeCtx, created.ID, container.RemoveOptions{Force: true}); err != nil {
+			sLog.Warnf("  P (Container Stage): failed to remove container %s: %+v", run.Name, err)
+		}
+	}()
+
+	// The outputs folder is created even when inputs are passed as environment variables
+	archive, err := buildInputsArchive(run.InputsFile)
+	if err != nil {
+		return ret, err
+	}
+	err = d.client.CopyToContainer(ctx, created.ID, "/", archive, container.CopyToContainerOptions{})
+	if err != nil {
+		return ret, err
+	}
+
+	if err = d.client.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return ret, err
+	}
+
+	statusCh, errCh := d.client.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case err = <-errCh:
+		if err != nil {
+			return ret, err
+		}
+	case status := <-statusCh:
+		ret.ExitCode = int(status.StatusCode)
+	case <-ctx.Done():
+		return ret, ctx.Err()
+	}
+
+	logs, err := d.client.ContainerLogs(ctx, created.ID, container.LogsOptions{ShowStdout: true})
+	if err != nil {
+		return ret, err
+	}
+	defer logs.Close()
+	var stdout bytes.Buffer
+	if _, err = stdcopy.StdCopy(&stdout, io.Discard, logs); err != nil {
+		return ret, err
+	}
+	ret.Stdout = stdout.Bytes()
+
+	if run.ReadOutputs {
+		ret.Outputs, err = d.readOutputs(ctx, created.ID)
+		if err != nil {
+			sLog.InfofCtx(ctx, "  P (Container Stage): container %s did not write an outputs file: %+v", run.Name, err)
+		}
+	}
+	return ret, nil
+}
+
+func (d *dockerRunner) readOutputs(ctx context.Context, id string) ([]byte, error) {
+	reader, _, err := d.client.CopyFromContainer(ctx, id, OutputsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && header.Name == path.Base(OutputsFile) {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// buildInputsArchive creates a tar archive with the symphony folder and, if supplied, the inputs file
+func buildInputsArchive(inputs []byte) (io.Reader, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dir := path.Dir(InputsFile)[1:]
+	if err := tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0777}); err != nil {
+		return nil, err
+	}
+	if inputs != nil {
+		if err := tw.WriteHeader(&tar.Header{Name: InputsFile[1:], Typeflag: tar.TypeReg, Mode: 0444, Size: int64(len(inputs))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(inputs); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
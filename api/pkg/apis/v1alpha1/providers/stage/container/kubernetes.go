@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package container
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
+)
+
+const (
+	stageLabel          = "symphony-stage"
+	jobPollInterval     = time.Second
+	jobTTLAfterFinished = int32(300)
+)
+
+// kubernetesRunner runs stage containers as Kubernetes Jobs
+type kubernetesRunner struct {
+	client       kubernetes.Interface
+	pollInterval time.Duration
+}
+
+func newKubernetesRunner(config ContainerStageProviderConfig) (containerRunner, error) {
+	kConfig, err := getKubernetesConfig(config)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to get kubernetes config", v1alpha2.BadConfig)
+	}
+	client, err := kubernetes.NewForConfig(kConfig)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to create kubernetes client", v1alpha2.InternalError)
+	}
+	return &kubernetesRunner{client: client, pollInterval: jobPollInterval}, nil
+}
+
+func getKubernetesConfig(config ContainerStageProviderConfig) (*rest.Config, error) {
+	if config.InCluster {
+		return rest.InClusterConfig()
+	}
+	switch config.ConfigType {
+	case "", "path":
+		configPath := config.ConfigData
+		if configPath == "" {
+			home := homedir.HomeDir()
+			if home == "" {
+				return nil, v1alpha2.NewCOAError(nil, "can't locate home directory to read default kubernetes config file. To run in cluster, set inCluster to true", v1alpha2.BadConfig)
+			}
+			configPath = filepath.Join(home, ".kube", "config")
+		}
+		return clientcmd.BuildConfigFromFlags("", configPath)
+	case "bytes":
+		if config.ConfigData == "" {
+			return nil, v1alpha2.NewCOAError(nil, "config data is not supplied", v1alpha2.BadConfig)
+		}
+		return clientcmd.RESTConfigFromKubeConfig([]byte(config.ConfigData))
+	default:
+		return nil, v1alpha2.NewCOAError(nil, "unrecognized config type, accepted values are: path and bytes", v1alpha2.BadConfig)
+	}
+}
+
+func (k *kubernetesRunner) Run(ctx context.Context, run containerRun) (containerResult, error) {
+	ret := containerResult{}
+	job := buildJob(run)
+
+	if run.InputsFile != nil {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   run.Name,
+				Labels: map[string]string{stageLabel: run.Name},
+			},
+			Data: map[string]string{
+				path.Base(InputsFile): string(run.InputsFile),
+			},
+		}
+		if _, err := k.client.CoreV1().ConfigMaps(run.Namespace).Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+			return ret, err
+		}
+		defer func() {
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := k.client.CoreV1().ConfigMaps(run.Namespace).Delete(cleanupCtx, run.Name, metav1.DeleteOptions{}); err != nil {
+				sLog.Warnf("  P (Container Stage): failed to delete config map %s: %+v", run.Name, err)
+			}
+		}()
+	}
+
+	if _, err := k.client.BatchV1().Jobs(run.Namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return ret, err
+	}
+	defer func() {
+		// The run context may already be cancelled, so the job is deleted with a fresh one
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		policy := metav1.DeletePropagationBackground
+		if err := k.client.BatchV1().Jobs(run.Namespace).Delete(cleanupCtx, run.Name, metav1.DeleteOptions{PropagationPolicy: &policy}); err != nil {
+			sLog.Warnf("  P (Container Stage): failed to delete job %s: %+v", run.Name, err)
+		}
+	}()
+
+	ticker := time.NewTicker(k.pollInterval)
+	defer ticker.Stop()
+	for {
+		current, err := k.client.BatchV1().Jobs(run.Namespace).Get(ctx, run.Name, metav1.GetOptions{})
+		if err != nil {
+			return ret, err
+		}
+		if current.Status.Succeeded > 0 || current.Status.Failed > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ret, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	pods, err := k.client.CoreV1().Pods(run.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", stageLabel, run.Name),
+	})
+	if err != nil {
+		return ret, err
+	}
+	if len(pods.Items) == 0 {
+		return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("no pod found for job %s", run.Name), v1alpha2.InternalError)
+	}
+	// the job has no retries, but pick the latest pod to be safe
+	sort.Slice(pods.Items, func(a, b int) bool {
+		return pods.Items[a].CreationTimestamp.Before(&pods.Items[b].CreationTimestamp)
+	})
+	pod := pods.Items[len(pods.Items)-1]
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == stageLabel && status.State.Terminated != nil {
+			ret.ExitCode = int(status.State.Terminated.ExitCode)
+			if run.ReadOutputs {
+				// outputs are collected through the termination message, which is limited to 4KB
+				ret.Outputs = []byte(status.State.Terminated.Message)
+			}
+		}
+	}
+
+	logs, err := k.client.CoreV1().Pods(run.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: stageLabel}).DoRaw(ctx)
+	if err != nil {
+		return ret, err
+	}
+	ret.Stdout = logs
+	return ret, nil
+}
+
+func buildJob(run containerRun) *batchv1.Job {
+	backoffLimit := int32(0)
+	ttl := jobTTLAfterFinished
+	deadline := int64(run.Timeout.Seconds())
+	automount := false
+	allowEscalation := false
+
+	env := make([]corev1.EnvVar, 0, len(run.Env))
+	for k, v := range run.Env {
+		env = append(env, corev1.EnvVar{Name: k, Value: v})
+	}
+	sort.Slice(env, func(a, b int) bool { return env[a].Name < env[b].Name })
+
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:    run.CPU,
+		corev1.ResourceMemory: run.Memory,
+	}
+	c := corev1.Container{
+		Name:    stageLabel,
+		Image:   run.Image,
+		Command: run.Command,
+		Args:    run.Args,
+		Env:     env,
+		Resources: corev1.ResourceRequirements{
+			Limits:   resources,
+			Requests: resources,
+		},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &allowEscalation,
+		},
+	}
+	if run.ReadOutputs {
+		c.TerminationMessagePath = OutputsFile
+	}
+	podSpec := corev1.PodSpec{
+		RestartPolicy:                corev1.RestartPolicyNever,
+		AutomountServiceAccountToken: &automount,
+	}
+	if run.InputsFile != nil {
+		c.VolumeMounts = []corev1.VolumeMount{{
+			Name:      "inputs",
+			MountPath: InputsFile,
+			SubPath:   path.Base(InputsFile),
+			ReadOnly:  true,
+		}}
+		podSpec.Volumes = []corev1.Volume{{
+			Name: "inputs",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: run.Name},
+				},
+			},
+		}}
+	}
+	podSpec.Containers = []corev1.Container{c}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   run.Name,
+			Labels: map[string]string{stageLabel: run.Name},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{stageLabel: run.Name},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
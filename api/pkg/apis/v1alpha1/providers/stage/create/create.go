@@ -363,7 +363,9 @@ func (i *CreateStageProvider) Process(ctx context.Context, mgrContext contexts.M
 					return outputs, false, nil
 				}
 				mLog.InfofCtx(ctx, "  P (Create Stage) process: Waiting for instance deletion: %+v", remainings)
-				time.Sleep(time.Duration(i.Config.WaitInterval) * time.Second)
+				if err = api_utils.SleepWithContext(ctx, time.Duration(i.Config.WaitInterval)*time.Second); err != nil {
+					return nil, false, err
+				}
 			}
 			providerOperationMetrics.ProviderOperationErrors(
 				create,
@@ -563,7 +565,9 @@ func (i *CreateStageProvider) Process(ctx context.Context, mgrContext contexts.M
 					}
 					return outputs, false, nil
 				}
-				time.Sleep(time.Duration(i.Config.WaitInterval) * time.Second)
+				if err = api_utils.SleepWithContext(ctx, time.Duration(i.Config.WaitInterval)*time.Second); err != nil {
+					return nil, false, err
+				}
 			}
 			providerOperationMetrics.ProviderOperationErrors(
 				create,
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/metrics"
+	api_utils "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
@@ -119,9 +120,9 @@ func (i *DelayStageProvider) Process(ctx context.Context, mgrContext contexts.Ma
 	outputs[v1alpha2.StatusOutput] = v1alpha2.OK
 
 	if v, ok := inputs["delay"]; ok {
+		var duration time.Duration
 		switch vs := v.(type) {
 		case string:
-			var duration time.Duration
 			duration, err = time.ParseDuration(vs)
 			if err != nil {
 				var vi int
@@ -141,16 +142,20 @@ func (i *DelayStageProvider) Process(ctx context.Context, mgrContext contexts.Ma
 				}
 			}
 			observ_utils.EmitUserAuditsLogs(ctx, "  P (Delay Stage): Delaying for %s", duration)
-			time.Sleep(duration)
 		case int:
 			observ_utils.EmitUserAuditsLogs(ctx, "  P (Delay Stage): Delaying for %d seconds", vs)
-			time.Sleep(time.Duration(vs) * time.Second)
+			duration = time.Duration(vs) * time.Second
 		case int32:
 			observ_utils.EmitUserAuditsLogs(ctx, "  P (Delay Stage): Delaying for %d seconds", vs)
-			time.Sleep(time.Duration(vs) * time.Second)
+			duration = time.Duration(vs) * time.Second
 		case int64:
 			observ_utils.EmitUserAuditsLogs(ctx, "  P (Delay Stage): Delaying for %d seconds", vs)
-			time.Sleep(time.Duration(vs) * time.Second)
+			duration = time.Duration(vs) * time.Second
+		}
+		// the delay ends early when the stage is canceled or times out
+		if err = api_utils.SleepWithContext(ctx, duration); err != nil {
+			mLog.ErrorfCtx(ctx, "  P (Delay Stage) process canceled: %+v", err)
+			return nil, false, err
 		}
 	}
 
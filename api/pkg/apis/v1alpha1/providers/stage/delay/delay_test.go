@@ -80,3 +80,17 @@ func TestDelayProcessFailedCase(t *testing.T) {
 	})
 	assert.Equal(t, v1alpha2.InternalError, outputs[v1alpha2.StatusOutput])
 }
+
+func TestDelayProcessCanceled(t *testing.T) {
+	provider := DelayStageProvider{}
+	err := provider.InitWithMap(map[string]string{})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dt1 := time.Now()
+	_, _, err = provider.Process(ctx, contexts.ManagerContext{}, map[string]interface{}{
+		"delay": "1m",
+	})
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(dt1).Seconds(), 5.0)
+}
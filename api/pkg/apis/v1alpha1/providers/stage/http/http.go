@@ -462,7 +462,9 @@ func (i *HttpStageProvider) Process(ctx context.Context, mgrContext contexts.Man
 				counter++
 				if i.Config.WaitInterval > 0 {
 					sLog.DebugCtx(ctx, "  P (Http Stage): sleep for wait interval")
-					time.Sleep(time.Duration(i.Config.WaitInterval) * time.Second)
+					if err = utils.SleepWithContext(ctx, time.Duration(i.Config.WaitInterval)*time.Second); err != nil {
+						return nil, false, err
+					}
 				}
 			} else {
 				break
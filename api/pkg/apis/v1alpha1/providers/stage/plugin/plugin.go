@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/metrics"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/pluginutils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	utils2 "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+const (
+	loggerName = "providers.stage.plugin"
+	plugin     = "plugin"
+
+	// HealthRoute and ProcessRoute are the routes a stage plugin serves, relative to its URL
+	HealthRoute  = pluginutils.HealthRoute
+	ProcessRoute = "process"
+)
+
+var (
+	sLog                     = logger.NewLogger(loggerName)
+	once                     sync.Once
+	providerOperationMetrics *metrics.Metrics
+)
+
+type PluginStageProviderConfig struct {
+	Name string `json:"name"`
+	// URL is the base URL of the plugin, such as http://approvals.tools.svc:8080/v1/
+	URL string `json:"url"`
+	// Token, if set, is sent to the plugin as a bearer token
+	Token string `json:"token,omitempty"`
+	// Timeout is the maximum duration of a process call
+	Timeout string `json:"timeout,omitempty"`
+	// HealthInterval is how long a health check result is reused. Set it to "0s" to check before every call.
+	HealthInterval string `json:"healthInterval,omitempty"`
+}
+
+// PluginProcessRequest is the body of the process call. Inputs include the system inputs,
+// such as __campaign, __activation, __stage, __namespace and __site.
+type PluginProcessRequest struct {
+	Inputs map[string]interface{} `json:"inputs"`
+}
+
+// PluginProcessResponse is the body a plugin returns from the process call. Error is set
+// by plugins returning a non-2xx status.
+type PluginProcessResponse struct {
+	Outputs map[string]interface{} `json:"outputs,omitempty"`
+	Paused  bool                   `json:"paused,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+type PluginStageProvider struct {
+	Config  PluginStageProviderConfig
+	Context *contexts.ManagerContext
+	client  *pluginutils.Client
+}
+
+func PluginStageProviderConfigFromMap(properties map[string]string) (PluginStageProviderConfig, error) {
+	ret := PluginStageProviderConfig{}
+	ret.Name = properties["name"]
+	ret.URL = properties["url"]
+	ret.Token = properties["token"]
+	ret.Timeout = properties["timeout"]
+	ret.HealthInterval = properties["healthInterval"]
+	return ret, nil
+}
+
+func (i *PluginStageProvider) InitWithMap(properties map[string]string) error {
+	config, err := PluginStageProviderConfigFromMap(properties)
+	if err != nil {
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *PluginStageProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *PluginStageProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("[Stage] Plugin Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Plugin Stage): Init()")
+
+	updateConfig, err := toPluginStageProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Stage): expected PluginStageProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected PluginStageProviderConfig", v1alpha2.BadConfig)
+		return err
+	}
+	i.client, err = pluginutils.NewClient(updateConfig.URL, updateConfig.Token, updateConfig.Timeout, updateConfig.HealthInterval)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Stage): invalid plugin config: %+v", err)
+		return err
+	}
+	updateConfig.URL = i.client.URL
+	i.Config = updateConfig
+
+	once.Do(func() {
+		if providerOperationMetrics == nil {
+			providerOperationMetrics, err = metrics.New()
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Plugin Stage): failed to create metrics: %+v", err)
+			}
+		}
+	})
+	return err
+}
+
+func toPluginStageProviderConfig(config providers.IProviderConfig) (PluginStageProviderConfig, error) {
+	ret := PluginStageProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = utils2.UnmarshalJson(data, &ret)
+	return ret, err
+}
+
+func (i *PluginStageProvider) Process(ctx context.Context, mgrContext contexts.ManagerContext, inputs map[string]interface{}) (map[string]interface{}, bool, error) {
+	ctx, span := observability.StartSpan("[Stage] Plugin Provider", ctx, &map[string]string{
+		"method": "Process",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Plugin Stage): start process request, plugin: %s", i.Config.URL)
+
+	processTime := time.Now().UTC()
+	functionName := observ_utils.GetFunctionName()
+	defer providerOperationMetrics.ProviderOperationLatency(
+		processTime,
+		plugin,
+		metrics.ProcessOperation,
+		metrics.RunOperationType,
+		functionName,
+	)
+
+	if err = i.client.ValidateURL(i.Context); err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Stage): plugin URL validation failed: %+v", err)
+		return nil, false, err
+	}
+	if err = i.client.CheckHealth(ctx); err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Stage): plugin %s is not healthy: %+v", i.Config.URL, err)
+		providerOperationMetrics.ProviderOperationErrors(
+			plugin,
+			functionName,
+			metrics.ProcessOperation,
+			metrics.RunOperationType,
+			v1alpha2.GetErrorState(err).String(),
+		)
+		return nil, false, err
+	}
+
+	var response PluginProcessResponse
+	err = i.client.Call(ctx, ProcessRoute, PluginProcessRequest{Inputs: inputs}, &response)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Stage): plugin %s failed to process stage: %+v", i.Config.URL, err)
+		providerOperationMetrics.ProviderOperationErrors(
+			plugin,
+			functionName,
+			metrics.ProcessOperation,
+			metrics.RunOperationType,
+			v1alpha2.GetErrorState(err).String(),
+		)
+		return nil, false, err
+	}
+	if response.Outputs == nil {
+		response.Outputs = make(map[string]interface{})
+	}
+	sLog.InfoCtx(ctx, "  P (Plugin Stage): end process request")
+	return response.Outputs, response.Paused, nil
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPlugin struct {
+	healthy      atomic.Bool
+	healthChecks atomic.Int32
+	handler      func(w http.ResponseWriter, request PluginProcessRequest)
+	delay        time.Duration
+}
+
+func (p *testPlugin) start(t *testing.T) *httptest.Server {
+	p.healthy.Store(true)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		p.healthChecks.Add(1)
+		if !p.healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/v1/process", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if p.delay > 0 {
+			time.Sleep(p.delay)
+		}
+		var request PluginProcessRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p.handler(w, request)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProvider(t *testing.T, server *httptest.Server, config PluginStageProviderConfig) *PluginStageProvider {
+	config.URL = server.URL + "/v1"
+	if config.Token == "" {
+		config.Token = "secret"
+	}
+	provider := &PluginStageProvider{}
+	err := provider.Init(config)
+	require.Nil(t, err)
+	provider.SetContext(&contexts.ManagerContext{
+		VencorContext: &contexts.VendorContext{
+			SecurityPolicy: &contexts.SecurityPolicy{
+				AllowedIPRanges: []string{"127.0.0.1", "::1"},
+			},
+		},
+	})
+	return provider
+}
+
+func TestPluginInitWithMap(t *testing.T) {
+	provider := PluginStageProvider{}
+	err := provider.InitWithMap(map[string]string{
+		"name":           "test",
+		"url":            "http://localhost:8080/v1",
+		"timeout":        "30s",
+		"healthInterval": "0s",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:8080/v1/", provider.Config.URL)
+	assert.Equal(t, 30*time.Second, provider.client.Timeout)
+	assert.Equal(t, time.Duration(0), provider.client.HealthInterval)
+
+	err = provider.InitWithMap(map[string]string{
+		"url":     "http://localhost:8080/v1",
+		"timeout": "soon",
+	})
+	assert.NotNil(t, err)
+}
+
+func TestPluginProcess(t *testing.T) {
+	p := &testPlugin{
+		handler: func(w http.ResponseWriter, request PluginProcessRequest) {
+			json.NewEncoder(w).Encode(PluginProcessResponse{
+				Outputs: map[string]interface{}{
+					"greeting": "hello " + request.Inputs["name"].(string),
+					"stage":    request.Inputs["__stage"],
+				},
+			})
+		},
+	}
+	server := p.start(t)
+	provider := newTestProvider(t, server, PluginStageProviderConfig{})
+	outputs, paused, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{
+		"name":    "world",
+		"__stage": "greet",
+	})
+	assert.Nil(t, err)
+	assert.False(t, paused)
+	assert.Equal(t, "hello world", outputs["greeting"])
+	assert.Equal(t, "greet", outputs["stage"])
+}
+
+func TestPluginPaused(t *testing.T) {
+	p := &testPlugin{
+		handler: func(w http.ResponseWriter, request PluginProcessRequest) {
+			json.NewEncoder(w).Encode(PluginProcessResponse{Paused: true})
+		},
+	}
+	server := p.start(t)
+	provider := newTestProvider(t, server, PluginStageProviderConfig{})
+	outputs, paused, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.True(t, paused)
+	assert.NotNil(t, outputs)
+}
+
+func TestPluginError(t *testing.T) {
+	p := &testPlugin{
+		handler: func(w http.ResponseWriter, request PluginProcessRequest) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(PluginProcessResponse{Error: "name is required"})
+		},
+	}
+	server := p.start(t)
+	provider := newTestProvider(t, server, PluginStageProviderConfig{})
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadRequest, v1alpha2.GetErrorState(err))
+	assert.Contains(t, err.Error(), "name is required")
+
+	provider.Config.Token = "wrong"
+	_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadRequest, v1alpha2.GetErrorState(err))
+}
+
+func TestPluginUnhealthy(t *testing.T) {
+	var called atomic.Bool
+	p := &testPlugin{
+		handler: func(w http.ResponseWriter, request PluginProcessRequest) {
+			called.Store(true)
+			json.NewEncoder(w).Encode(PluginProcessResponse{})
+		},
+	}
+	server := p.start(t)
+	p.healthy.Store(false)
+	provider := newTestProvider(t, server, PluginStageProviderConfig{})
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "health check")
+	assert.False(t, called.Load())
+
+	// the failed health check is cached for the health interval
+	p.healthy.Store(true)
+	_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), p.healthChecks.Load())
+
+	provider = newTestProvider(t, server, PluginStageProviderConfig{HealthInterval: "0s"})
+	_, _, err = provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.True(t, called.Load())
+}
+
+func TestPluginTimeout(t *testing.T) {
+	p := &testPlugin{
+		delay: 500 * time.Millisecond,
+		handler: func(w http.ResponseWriter, request PluginProcessRequest) {
+			json.NewEncoder(w).Encode(PluginProcessResponse{})
+		},
+	}
+	server := p.start(t)
+	provider := newTestProvider(t, server, PluginStageProviderConfig{Timeout: "100ms"})
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.TimedOut, v1alpha2.GetErrorState(err))
+}
+
+func TestPluginURLNotAllowed(t *testing.T) {
+	p := &testPlugin{
+		handler: func(w http.ResponseWriter, request PluginProcessRequest) {
+			json.NewEncoder(w).Encode(PluginProcessResponse{})
+		},
+	}
+	server := p.start(t)
+	provider := newTestProvider(t, server, PluginStageProviderConfig{})
+	provider.SetContext(&contexts.ManagerContext{})
+	_, _, err := provider.Process(context.Background(), contexts.ManagerContext{}, map[string]interface{}{})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.BadConfig, v1alpha2.GetErrorState(err))
+	assert.Equal(t, int32(0), p.healthChecks.Load())
+}
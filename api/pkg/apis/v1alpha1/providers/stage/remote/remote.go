@@ -96,6 +96,16 @@ func (i *RemoteStageProvider) Process(ctx context.Context, mgrContext contexts.M
 		return nil, false, err
 	}
 
+	// the site that runs the campaign gets the status of the job, even when the job is
+	// relayed through other sites
+	jobInputs := make(map[string]interface{}, len(inputs)+1)
+	for k, v := range inputs {
+		jobInputs[k] = v
+	}
+	if _, ok := jobInputs["__originSite"]; !ok {
+		jobInputs["__originSite"] = mgrContext.SiteInfo.SiteId
+	}
+
 	err = mgrContext.Publish("remote", v1alpha2.Event{
 		Metadata: map[string]string{
 			"site":       siteString,
@@ -106,7 +116,7 @@ func (i *RemoteStageProvider) Process(ctx context.Context, mgrContext contexts.M
 			Id:     "",
 			Action: v1alpha2.JobRun,
 			Body: v1alpha2.InputOutputData{
-				Inputs:  inputs,
+				Inputs:  jobInputs,
 				Outputs: i.OutputContext,
 			},
 		},
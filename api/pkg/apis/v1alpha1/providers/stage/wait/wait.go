@@ -317,7 +317,9 @@ func (i *WaitStageProvider) Process(ctx context.Context, mgrContext contexts.Man
 			log.InfoCtx(ctx, "  P (Wait Processor): waiting for objects to be ready...")
 		}
 		if i.Config.WaitInterval > 0 {
-			time.Sleep(time.Duration(i.Config.WaitInterval) * time.Second)
+			if err := api_utils.SleepWithContext(ctx, time.Duration(i.Config.WaitInterval)*time.Second); err != nil {
+				return nil, false, err
+			}
 		}
 	}
 
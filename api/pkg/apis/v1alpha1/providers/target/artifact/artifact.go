@@ -0,0 +1,598 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package artifact
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+const (
+	loggerName = "providers.target.artifact"
+
+	artifactUrl           = "artifact.url"
+	artifactVersion       = "artifact.version"
+	artifactSha256        = "artifact.sha256"
+	artifactFileName      = "artifact.fileName"
+	artifactMode          = "artifact.mode"
+	artifactExtract       = "artifact.extract"
+	artifactSignature     = "artifact.signature"
+	artifactSignatureUrl  = "artifact.signatureUrl"
+	artifactSignatureType = "artifact.signatureType"
+	artifactPublicKey     = "artifact.publicKey"
+	artifactAuthSecret    = "artifact.auth.secret"
+
+	defaultInstallFolder = "/opt/symphony/artifacts"
+	defaultKeepVersions  = 2
+
+	// currentLink is the symlink to the installed version of a component
+	currentLink    = "current"
+	versionsFolder = "versions"
+)
+
+var (
+	sLog           = logger.NewLogger(loggerName)
+	versionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+	sha256Pattern  = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+)
+
+type ArtifactTargetProviderConfig struct {
+	Name string `json:"name"`
+	// InstallFolder is the folder artifacts are installed to, in a subfolder per component
+	InstallFolder string `json:"installFolder,omitempty"`
+	// KeepVersions is the number of previous versions kept for rollbacks
+	KeepVersions *int `json:"keepVersions,omitempty"`
+	// PlainHTTP accesses OCI registries over HTTP, for local registries
+	PlainHTTP bool `json:"plainHttp,omitempty"`
+}
+
+type ArtifactTargetProvider struct {
+	Config  ArtifactTargetProviderConfig
+	Context *contexts.ManagerContext
+}
+
+// artifactSpec is an artifact read from component properties
+type artifactSpec struct {
+	Url           string
+	Version       string
+	Sha256        string
+	FileName      string
+	Mode          os.FileMode
+	Extract       string
+	Signature     string
+	SignatureUrl  string
+	SignatureType string
+	PublicKey     string
+	AuthSecret    string
+}
+
+// installedArtifact is the record of an installed version, next to the version folder. Previous
+// versions are kept by the time they were last activated.
+type installedArtifact struct {
+	Version     string    `json:"version"`
+	Digest      string    `json:"digest"`
+	Url         string    `json:"url"`
+	ActivatedAt time.Time `json:"activatedAt"`
+}
+
+func ArtifactTargetProviderConfigFromMap(properties map[string]string) (ArtifactTargetProviderConfig, error) {
+	ret := ArtifactTargetProviderConfig{}
+	if v, ok := properties["name"]; ok {
+		ret.Name = v
+	}
+	if v, ok := properties["installFolder"]; ok {
+		ret.InstallFolder = v
+	}
+	if v, ok := properties["keepVersions"]; ok {
+		keep, err := strconv.Atoi(v)
+		if err != nil || keep < 0 {
+			return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid artifact provider config, invalid keepVersions '%s'", v), v1alpha2.BadConfig)
+		}
+		ret.KeepVersions = &keep
+	}
+	if v, ok := properties["plainHttp"]; ok {
+		ret.PlainHTTP = v == "true"
+	}
+	return ret, nil
+}
+
+func (i *ArtifactTargetProvider) InitWithMap(properties map[string]string) error {
+	config, err := ArtifactTargetProviderConfigFromMap(properties)
+	if err != nil {
+		sLog.Errorf("  P (Artifact Target): expected ArtifactTargetProviderConfig: %+v", err)
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *ArtifactTargetProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *ArtifactTargetProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("Artifact Target Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Artifact Target): Init()")
+
+	updateConfig, err := toArtifactTargetProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Artifact Target): expected ArtifactTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected ArtifactTargetProviderConfig", v1alpha2.InitFailed)
+		return err
+	}
+	if updateConfig.InstallFolder == "" {
+		updateConfig.InstallFolder = defaultInstallFolder
+	}
+	if updateConfig.KeepVersions == nil {
+		keep := defaultKeepVersions
+		updateConfig.KeepVersions = &keep
+	}
+	i.Config = updateConfig
+	return nil
+}
+
+func toArtifactTargetProviderConfig(config providers.IProviderConfig) (ArtifactTargetProviderConfig, error) {
+	ret := ArtifactTargetProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+func (i *ArtifactTargetProvider) Get(ctx context.Context, deployment model.DeploymentSpec, references []model.ComponentStep) ([]model.ComponentSpec, error) {
+	ctx, span := observability.StartSpan("Artifact Target Provider", ctx, &map[string]string{
+		"method": "Get",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Artifact Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	ret := make([]model.ComponentSpec, 0)
+	for _, component := range references {
+		var folder string
+		var installed *installedArtifact
+		folder, err = i.componentFolder(component.Component)
+		if err == nil {
+			installed, err = readCurrent(folder)
+		}
+		if err != nil {
+			if !os.IsNotExist(err) {
+				sLog.ErrorfCtx(ctx, "  P (Artifact Target): failed to read installed version of %s: %+v", component.Component.Name, err)
+			}
+			continue
+		}
+		sLog.InfofCtx(ctx, "  P (Artifact Target): append component: %s", component.Component.Name)
+		ret = append(ret, model.ComponentSpec{
+			Name: component.Component.Name,
+			Type: component.Component.Type,
+			Properties: map[string]interface{}{
+				artifactUrl:     installed.Url,
+				artifactVersion: installed.Version,
+				artifactSha256:  installed.Digest,
+			},
+		})
+	}
+	err = nil
+	return ret, nil
+}
+
+func (i *ArtifactTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
+	ctx, span := observability.StartSpan("Artifact Target Provider", ctx, &map[string]string{
+		"method": "Apply",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Artifact Target): applying artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	injections := &model.ValueInjections{
+		InstanceId:        deployment.Instance.ObjectMeta.Name,
+		SolutionVersionId: deployment.Instance.Spec.SolutionVersion,
+		TargetId:          deployment.ActiveTarget,
+	}
+
+	components := step.GetComponents()
+	err = i.GetValidationRule(ctx).Validate(components)
+	if err == nil {
+		for _, component := range step.Components {
+			if err = validateName(component.Component); err != nil {
+				break
+			}
+			if component.Action != model.ComponentUpdate {
+				continue
+			}
+			if _, err = readArtifactSpec(component.Component, injections); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Artifact Target): failed to validate components: %+v", err)
+		return nil, err
+	}
+	if isDryRun {
+		sLog.DebugCtx(ctx, "  P (Artifact Target): dryRun is enabled, skipping apply")
+		err = nil
+		return nil, nil
+	}
+
+	ret := step.PrepareResultMap()
+	for _, component := range step.Components {
+		if component.Action == model.ComponentUpdate {
+			spec, _ := readArtifactSpec(component.Component, injections)
+			var installed *installedArtifact
+			installed, err = i.install(ctx, deployment, component.Component, spec)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Artifact Target): failed to install %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Updated,
+				Message: fmt.Sprintf("installed version %s (sha256:%s)", installed.Version, installed.Digest),
+			}
+		} else {
+			var folder string
+			folder, err = i.componentFolder(component.Component)
+			if err == nil {
+				sLog.InfofCtx(ctx, "  P (Artifact Target): remove %s", folder)
+				err = os.RemoveAll(folder)
+			}
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.DeleteFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Artifact Target): failed to remove %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Deleted,
+				Message: "",
+			}
+		}
+	}
+	return ret, nil
+}
+
+// install downloads, verifies and extracts a version, then points the current link of the
+// component to it. A version that is still installed with the same digest is not downloaded again.
+func (i *ArtifactTargetProvider) install(ctx context.Context, deployment model.DeploymentSpec, component model.ComponentSpec, spec artifactSpec) (*installedArtifact, error) {
+	folder, err := i.componentFolder(component)
+	if err != nil {
+		return nil, err
+	}
+	versions := filepath.Join(folder, versionsFolder)
+	if err = os.MkdirAll(versions, 0755); err != nil {
+		return nil, err
+	}
+
+	if spec.Version != "" {
+		if installed, name := findInstalled(versions, spec); installed != nil {
+			sLog.InfofCtx(ctx, "  P (Artifact Target): version %s of %s is already downloaded", spec.Version, component.Name)
+			installed.ActivatedAt = time.Now().UTC()
+			if err := activate(folder, name, installed); err != nil {
+				return nil, err
+			}
+			return installed, i.prune(ctx, folder)
+		}
+	}
+
+	auth, err := readCredentials(ctx, i.Context, spec.AuthSecret, deployment.Instance.ObjectMeta.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	download, err := i.download(ctx, spec, auth, folder)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(download.Path)
+
+	if spec.Sha256 != "" && !strings.EqualFold(download.Digest, spec.Sha256) {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("sha256 of %s is %s, expected %s", spec.Url, download.Digest, spec.Sha256), v1alpha2.BadRequest)
+	}
+	if spec.SignatureType != "" {
+		if err = i.verifySignature(ctx, spec, auth, download); err != nil {
+			return nil, err
+		}
+	}
+
+	version := spec.Version
+	if version == "" {
+		version = download.Digest[:12]
+	}
+	staging, err := os.MkdirTemp(versions, ".staging-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	if err = extract(download, spec, staging); err != nil {
+		return nil, err
+	}
+
+	// versions are installed to new folders, so the current link always points to a complete version
+	name := version + "_" + download.Digest[:12]
+	target := filepath.Join(versions, name)
+	if _, err = os.Stat(target); os.IsNotExist(err) {
+		if err = os.Rename(staging, target); err != nil {
+			return nil, err
+		}
+	}
+	installed := &installedArtifact{
+		Version:     version,
+		Digest:      download.Digest,
+		Url:         spec.Url,
+		ActivatedAt: time.Now().UTC(),
+	}
+	sLog.InfofCtx(ctx, "  P (Artifact Target): install version %s of %s", version, component.Name)
+	if err = activate(folder, name, installed); err != nil {
+		return nil, err
+	}
+	return installed, i.prune(ctx, folder)
+}
+
+// activate records an installed version and points the current link of the component to it
+func activate(folder string, name string, installed *installedArtifact) error {
+	data, _ := json.Marshal(installed)
+	if err := os.WriteFile(filepath.Join(folder, versionsFolder, name+".json"), data, 0644); err != nil {
+		return err
+	}
+	return swapCurrent(folder, name)
+}
+
+// prune removes the versions that are older than the kept previous versions
+func (i *ArtifactTargetProvider) prune(ctx context.Context, folder string) error {
+	current, err := os.Readlink(filepath.Join(folder, currentLink))
+	if err != nil {
+		return err
+	}
+	versions := filepath.Join(folder, versionsFolder)
+	previous := make([]string, 0)
+	installed := listInstalled(versions)
+	for name := range installed {
+		if name != filepath.Base(current) {
+			previous = append(previous, name)
+		}
+	}
+	sort.Slice(previous, func(a, b int) bool {
+		return installed[previous[a]].ActivatedAt.After(installed[previous[b]].ActivatedAt)
+	})
+	for n, name := range previous {
+		if n < *i.Config.KeepVersions {
+			continue
+		}
+		sLog.InfofCtx(ctx, "  P (Artifact Target): remove previous version %s", installed[name].Version)
+		if err = os.RemoveAll(filepath.Join(versions, name)); err != nil {
+			return err
+		}
+		if err = os.Remove(filepath.Join(versions, name+".json")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// componentFolder returns the folder of a component, which is named after the component
+func (i *ArtifactTargetProvider) componentFolder(component model.ComponentSpec) (string, error) {
+	if err := validateName(component); err != nil {
+		return "", err
+	}
+	return filepath.Join(i.Config.InstallFolder, component.Name), nil
+}
+
+// validateName checks that the name of a component is a single path element, as the folder of
+// the component is named after it and deleted with the component
+func validateName(component model.ComponentSpec) error {
+	name := component.Name
+	if name == "" || name == "." || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid component name '%s'", name), v1alpha2.BadRequest)
+	}
+	return nil
+}
+
+// swapCurrent points the current link to a version folder. The new link is renamed over the old
+// one, so the link always points to a complete version.
+func swapCurrent(folder string, name string) error {
+	link := filepath.Join(folder, currentLink)
+	temp := filepath.Join(folder, fmt.Sprintf(".%s-%d", currentLink, time.Now().UnixNano()))
+	if err := os.Symlink(filepath.Join(versionsFolder, name), temp); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, link); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+func readCurrent(folder string) (*installedArtifact, error) {
+	target, err := os.Readlink(filepath.Join(folder, currentLink))
+	if err != nil {
+		return nil, err
+	}
+	return readInstalled(filepath.Join(folder, versionsFolder, filepath.Base(target)+".json"))
+}
+
+func readInstalled(file string) (*installedArtifact, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ret installedArtifact
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// listInstalled returns the installed versions by their folder names
+func listInstalled(versions string) map[string]*installedArtifact {
+	ret := make(map[string]*installedArtifact)
+	files, _ := filepath.Glob(filepath.Join(versions, "*.json"))
+	for _, file := range files {
+		if installed, err := readInstalled(file); err == nil {
+			ret[strings.TrimSuffix(filepath.Base(file), ".json")] = installed
+		}
+	}
+	return ret
+}
+
+// findInstalled returns the latest installed version that matches the version, URL and digest of an artifact
+func findInstalled(versions string, spec artifactSpec) (*installedArtifact, string) {
+	var ret *installedArtifact
+	name := ""
+	for n, installed := range listInstalled(versions) {
+		if installed.Version != spec.Version || installed.Url != spec.Url || (spec.Sha256 != "" && installed.Digest != spec.Sha256) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(versions, n)); err != nil {
+			continue
+		}
+		if ret == nil || installed.ActivatedAt.After(ret.ActivatedAt) {
+			ret, name = installed, n
+		}
+	}
+	return ret, name
+}
+
+// readArtifactSpec reads and checks the artifact of a component
+func readArtifactSpec(component model.ComponentSpec, injections *model.ValueInjections) (artifactSpec, error) {
+	read := func(key string) string {
+		return strings.TrimSpace(model.ReadPropertyCompat(component.Properties, key, injections))
+	}
+	ret := artifactSpec{
+		Url:           read(artifactUrl),
+		Version:       read(artifactVersion),
+		Sha256:        strings.ToLower(read(artifactSha256)),
+		FileName:      read(artifactFileName),
+		Extract:       strings.ToLower(read(artifactExtract)),
+		Signature:     read(artifactSignature),
+		SignatureUrl:  read(artifactSignatureUrl),
+		SignatureType: strings.ToLower(read(artifactSignatureType)),
+		PublicKey:     read(artifactPublicKey),
+		AuthSecret:    read(artifactAuthSecret),
+	}
+	invalid := func(format string, args ...interface{}) (artifactSpec, error) {
+		return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("component %s: %s", component.Name, fmt.Sprintf(format, args...)), v1alpha2.BadRequest)
+	}
+	u, err := url.Parse(ret.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci") || u.Host == "" {
+		return invalid("invalid %s '%s', expected an http, https or oci URL", artifactUrl, ret.Url)
+	}
+	if ret.Version != "" && !versionPattern.MatchString(ret.Version) {
+		return invalid("invalid %s '%s'", artifactVersion, ret.Version)
+	}
+	if ret.Sha256 != "" {
+		ret.Sha256 = strings.TrimPrefix(ret.Sha256, "sha256:")
+		if !sha256Pattern.MatchString(ret.Sha256) {
+			return invalid("invalid %s '%s', expected 64 hex digits", artifactSha256, ret.Sha256)
+		}
+	}
+	if ret.FileName != "" && !isFileName(ret.FileName) {
+		return invalid("invalid %s '%s'", artifactFileName, ret.FileName)
+	}
+	switch ret.Extract {
+	case "":
+		ret.Extract = extractAuto
+	case extractAuto, extractNone, extractTar, extractTarGz, extractZip:
+	default:
+		return invalid("invalid %s '%s', expected %s, %s, %s, %s or %s", artifactExtract, ret.Extract, extractAuto, extractNone, extractTar, extractTarGz, extractZip)
+	}
+	ret.Mode = 0644
+	if mode := read(artifactMode); mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return invalid("invalid %s '%s', expected an octal mode", artifactMode, mode)
+		}
+		ret.Mode = os.FileMode(m)
+	}
+	switch ret.SignatureType {
+	case "":
+		if ret.Signature != "" || ret.SignatureUrl != "" {
+			return invalid("%s is set but %s is not", artifactSignature, artifactSignatureType)
+		}
+	case signatureCosign, signatureGpg:
+		if ret.Signature == "" && ret.SignatureUrl == "" {
+			return invalid("%s or %s is required", artifactSignature, artifactSignatureUrl)
+		}
+		if ret.PublicKey == "" {
+			return invalid("%s is required to verify signatures", artifactPublicKey)
+		}
+	default:
+		return invalid("invalid %s '%s', expected %s or %s", artifactSignatureType, ret.SignatureType, signatureCosign, signatureGpg)
+	}
+	// downloads are always verified, by their digest or by a signature
+	if ret.Sha256 == "" && ret.SignatureType == "" {
+		return invalid("%s or %s is required", artifactSha256, artifactSignatureType)
+	}
+	return ret, nil
+}
+
+// isDigestChanged compares an installed digest with a desired digest, which can have the sha256: prefix
+func isDigestChanged(oldProp, newProp any) bool {
+	desired := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(fmt.Sprintf("%v", newProp)), "sha256:"))
+	if newProp == nil || desired == "" {
+		return false
+	}
+	_, err := hex.DecodeString(desired)
+	return err != nil || fmt.Sprintf("%v", oldProp) != desired
+}
+
+func (*ArtifactTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
+	return model.ValidationRule{
+		AllowSidecar: false,
+		ComponentValidationRule: model.ComponentValidationRule{
+			RequiredProperties: []string{artifactUrl},
+			OptionalProperties: []string{artifactVersion, artifactSha256, artifactFileName, artifactMode, artifactExtract,
+				artifactSignature, artifactSignatureUrl, artifactSignatureType, artifactPublicKey, artifactAuthSecret},
+			RequiredComponentType: "",
+			RequiredMetadata:      []string{},
+			OptionalMetadata:      []string{},
+			ChangeDetectionProperties: []model.PropertyDesc{
+				{Name: artifactUrl, IgnoreCase: false, SkipIfMissing: true},
+				{Name: artifactVersion, IgnoreCase: false, SkipIfMissing: true},
+				{Name: artifactSha256, IgnoreCase: true, SkipIfMissing: true, PropChanged: isDigestChanged},
+			},
+		},
+	}
+}
+
+// isFileName returns whether a name is a single path element, so a file of that name stays in its folder
+func isFileName(name string) bool {
+	return !strings.ContainsAny(name, `/\`) && name != "." && name != ".."
+}
@@ -0,0 +1,563 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package artifact
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSecretProvider struct {
+	secrets map[string]map[string]string
+}
+
+func (s *testSecretProvider) Get(ctx context.Context, name string, field string, localContext interface{}) (string, error) {
+	if v, ok := s.secrets[name][field]; ok {
+		return v, nil
+	}
+	return "", errors.New("secret not found")
+}
+
+func createTestProvider(t *testing.T) *ArtifactTargetProvider {
+	provider := &ArtifactTargetProvider{}
+	keep := 1
+	err := provider.Init(ArtifactTargetProviderConfig{InstallFolder: t.TempDir(), KeepVersions: &keep, PlainHTTP: true})
+	assert.Nil(t, err)
+	provider.SetContext(&contexts.ManagerContext{
+		VencorContext: &contexts.VendorContext{
+			EvaluationContext: &coa_utils.EvaluationContext{
+				SecretProvider: &testSecretProvider{secrets: map[string]map[string]string{
+					"registry": {"username": "admin", "password": "pass"},
+				}},
+			},
+		},
+	})
+	return provider
+}
+
+func testDeployment() model.DeploymentSpec {
+	return model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "edge-instance", Namespace: "default"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+}
+
+func applyComponent(provider *ArtifactTargetProvider, action model.ComponentAction, component model.ComponentSpec) (map[string]model.ComponentResultSpec, error) {
+	return provider.Apply(context.Background(), testDeployment(),
+		model.DeploymentStep{Components: []model.ComponentStep{{Action: action, Component: component}}}, false)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		assert.Nil(t, archive.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := archive.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, archive.Close())
+	assert.Nil(t, gz.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, archive.Close())
+	return buf.Bytes()
+}
+
+func serveFiles(files map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := files[r.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+}
+
+func readCurrentFile(t *testing.T, provider *ArtifactTargetProvider, component string, name string) string {
+	data, err := os.ReadFile(filepath.Join(provider.Config.InstallFolder, component, currentLink, name))
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestArtifactTargetProviderConfigFromMap(t *testing.T) {
+	config, err := ArtifactTargetProviderConfigFromMap(map[string]string{
+		"name":          "artifact",
+		"installFolder": "/var/lib/artifacts",
+		"keepVersions":  "3",
+		"plainHttp":     "true",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "/var/lib/artifacts", config.InstallFolder)
+	assert.Equal(t, 3, *config.KeepVersions)
+	assert.True(t, config.PlainHTTP)
+
+	_, err = ArtifactTargetProviderConfigFromMap(map[string]string{"keepVersions": "-1"})
+	assert.NotNil(t, err)
+
+	provider := ArtifactTargetProvider{}
+	err = provider.InitWithMap(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultInstallFolder, provider.Config.InstallFolder)
+	assert.Equal(t, defaultKeepVersions, *provider.Config.KeepVersions)
+}
+
+// TestArtifactTargetProviderLifecycle tests that versions are installed, kept for rollbacks, pruned and removed
+func TestArtifactTargetProviderLifecycle(t *testing.T) {
+	v1 := tarGz(t, map[string]string{"bin/collector": "v1", "README": "collector"})
+	v2 := tarGz(t, map[string]string{"bin/collector": "v2", "README": "collector"})
+	v3 := zipArchive(t, map[string]string{"bin/collector": "v3"})
+	ts := serveFiles(map[string][]byte{"/1.0.0/collector.tar.gz": v1, "/2.0.0/collector.tar.gz": v2, "/3.0.0/collector.zip": v3})
+	defer ts.Close()
+
+	provider := createTestProvider(t)
+	component := func(version string, file string, data []byte) model.ComponentSpec {
+		return model.ComponentSpec{
+			Name: "collector",
+			Properties: map[string]interface{}{
+				artifactUrl:     fmt.Sprintf("%s/%s/%s", ts.URL, version, file),
+				artifactVersion: version,
+				artifactSha256:  "sha256:" + sha256Hex(data),
+			},
+		}
+	}
+	references := []model.ComponentStep{{Action: model.ComponentUpdate, Component: component("1.0.0", "collector.tar.gz", v1)}}
+
+	components, err := provider.Get(context.Background(), testDeployment(), references)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(components))
+
+	ret, err := applyComponent(provider, model.ComponentUpdate, component("1.0.0", "collector.tar.gz", v1))
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["collector"].Status)
+	assert.Equal(t, "v1", readCurrentFile(t, provider, "collector", "bin/collector"))
+	info, err := os.Stat(filepath.Join(provider.Config.InstallFolder, "collector", currentLink, "bin", "collector"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	components, err = provider.Get(context.Background(), testDeployment(), references)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+	assert.Equal(t, "1.0.0", components[0].Properties[artifactVersion])
+	assert.Equal(t, sha256Hex(v1), components[0].Properties[artifactSha256])
+	rule := provider.GetValidationRule(context.Background())
+	assert.False(t, rule.IsComponentChanged(components[0], component("1.0.0", "collector.tar.gz", v1)))
+	assert.True(t, rule.IsComponentChanged(components[0], component("2.0.0", "collector.tar.gz", v2)))
+
+	_, err = applyComponent(provider, model.ComponentUpdate, component("2.0.0", "collector.tar.gz", v2))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", readCurrentFile(t, provider, "collector", "bin/collector"))
+
+	// rolling back to a kept version doesn't download it again
+	ts.Close()
+	_, err = applyComponent(provider, model.ComponentUpdate, component("1.0.0", "collector.tar.gz", v1))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", readCurrentFile(t, provider, "collector", "bin/collector"))
+
+	ts = serveFiles(map[string][]byte{"/3.0.0/collector.zip": v3})
+	defer ts.Close()
+	_, err = applyComponent(provider, model.ComponentUpdate, component("3.0.0", "collector.zip", v3))
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", readCurrentFile(t, provider, "collector", "bin/collector"))
+	installed := listInstalled(filepath.Join(provider.Config.InstallFolder, "collector", versionsFolder))
+	assert.Equal(t, 2, len(installed))
+	versions := []string{}
+	for _, v := range installed {
+		versions = append(versions, v.Version)
+	}
+	assert.ElementsMatch(t, []string{"1.0.0", "3.0.0"}, versions)
+
+	ret, err = applyComponent(provider, model.ComponentDelete, component("3.0.0", "collector.zip", v3))
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["collector"].Status)
+	_, err = os.Stat(filepath.Join(provider.Config.InstallFolder, "collector"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestArtifactTargetProviderSingleFile(t *testing.T) {
+	ts := serveFiles(map[string][]byte{"/tool": []byte("#!/bin/sh\n")})
+	defer ts.Close()
+	provider := createTestProvider(t)
+	_, err := applyComponent(provider, model.ComponentUpdate, model.ComponentSpec{
+		Name:       "tool",
+		Properties: map[string]interface{}{artifactUrl: ts.URL + "/tool", artifactSha256: sha256Hex([]byte("#!/bin/sh\n")), artifactFileName: "run.sh", artifactMode: "0755"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "#!/bin/sh\n", readCurrentFile(t, provider, "tool", "run.sh"))
+	info, err := os.Stat(filepath.Join(provider.Config.InstallFolder, "tool", currentLink, "run.sh"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	current, err := readCurrent(filepath.Join(provider.Config.InstallFolder, "tool"))
+	assert.Nil(t, err)
+	assert.Equal(t, sha256Hex([]byte("#!/bin/sh\n"))[:12], current.Version)
+}
+
+func TestArtifactTargetProviderChecksumMismatch(t *testing.T) {
+	ts := serveFiles(map[string][]byte{"/tool": []byte("tampered")})
+	defer ts.Close()
+	provider := createTestProvider(t)
+	ret, err := applyComponent(provider, model.ComponentUpdate, model.ComponentSpec{
+		Name:       "tool",
+		Properties: map[string]interface{}{artifactUrl: ts.URL + "/tool", artifactSha256: sha256Hex([]byte("original"))},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.UpdateFailed, ret["tool"].Status)
+	_, err = os.Stat(filepath.Join(provider.Config.InstallFolder, "tool", currentLink))
+	assert.True(t, os.IsNotExist(err))
+	downloads, _ := filepath.Glob(filepath.Join(provider.Config.InstallFolder, "tool", ".download-*"))
+	assert.Equal(t, 0, len(downloads))
+}
+
+func TestArtifactTargetProviderUnsafeArchive(t *testing.T) {
+	data := tarGz(t, map[string]string{"../../escape": "x"})
+	ts := serveFiles(map[string][]byte{"/bad.tar.gz": data})
+	defer ts.Close()
+	provider := createTestProvider(t)
+	_, err := applyComponent(provider, model.ComponentUpdate, model.ComponentSpec{
+		Name:       "bad",
+		Properties: map[string]interface{}{artifactUrl: ts.URL + "/bad.tar.gz", artifactSha256: sha256Hex(data)},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "outside of the archive")
+	_, err = os.Stat(filepath.Join(provider.Config.InstallFolder, "escape"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func tarGzEntries(t *testing.T, headers []*tar.Header) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for _, header := range headers {
+		content := ""
+		if header.Typeflag == tar.TypeReg {
+			content = header.Name
+			header.Size = int64(len(content))
+			header.Mode = 0644
+		}
+		assert.Nil(t, archive.WriteHeader(header))
+		_, err := archive.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, archive.Close())
+	assert.Nil(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestArtifactTargetProviderArchiveLinks(t *testing.T) {
+	link := func(name string, target string) *tar.Header {
+		return &tar.Header{Name: name, Linkname: target, Typeflag: tar.TypeSymlink}
+	}
+	file := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg}
+	}
+	unsafe := map[string][]*tar.Header{
+		// each link stays in the archive, but the second one leads out through the first one
+		"chained": {link("self", "."), link("up", "self/..")},
+		"nested":  {link("self", "."), link("self/up", "..")},
+		"through": {link("self", "."), file("self/escape")},
+		"replace": {link("bin", "."), file("bin")},
+	}
+	for name, headers := range unsafe {
+		data := tarGzEntries(t, headers)
+		ts := serveFiles(map[string][]byte{"/bad.tar.gz": data})
+		provider := createTestProvider(t)
+		_, err := applyComponent(provider, model.ComponentUpdate, model.ComponentSpec{
+			Name:       "bad",
+			Properties: map[string]interface{}{artifactUrl: ts.URL + "/bad.tar.gz", artifactSha256: sha256Hex(data)},
+		})
+		ts.Close()
+		assert.NotNil(t, err, name)
+		_, err = os.Lstat(filepath.Join(provider.Config.InstallFolder, "bad", currentLink))
+		assert.True(t, os.IsNotExist(err), name)
+		escaped, _ := filepath.Glob(filepath.Join(provider.Config.InstallFolder, "bad", versionsFolder, "escape"))
+		assert.Empty(t, escaped, name)
+	}
+
+	// links between entries of the archive are extracted
+	data := tarGzEntries(t, []*tar.Header{file("lib/libcollector.so.1"), link("lib/libcollector.so", "libcollector.so.1"), link("current-lib", "lib")})
+	ts := serveFiles(map[string][]byte{"/collector.tar.gz": data})
+	defer ts.Close()
+	provider := createTestProvider(t)
+	_, err := applyComponent(provider, model.ComponentUpdate, model.ComponentSpec{
+		Name:       "collector",
+		Properties: map[string]interface{}{artifactUrl: ts.URL + "/collector.tar.gz", artifactSha256: sha256Hex(data)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "lib/libcollector.so.1", readCurrentFile(t, provider, "collector", "current-lib/libcollector.so"))
+}
+
+func TestArtifactTargetProviderInvalidName(t *testing.T) {
+	provider := createTestProvider(t)
+	marker := filepath.Join(provider.Config.InstallFolder, "keep")
+	assert.Nil(t, os.WriteFile(marker, []byte("keep"), 0644))
+	for _, name := range []string{"", ".", "..", "../tool", "bin/tool", `bin\tool`} {
+		for _, action := range []model.ComponentAction{model.ComponentUpdate, model.ComponentDelete} {
+			_, err := applyComponent(provider, action, model.ComponentSpec{
+				Name:       name,
+				Properties: map[string]interface{}{artifactUrl: "https://example.com/tool", artifactSha256: sha256Hex([]byte("tool"))},
+			})
+			assert.NotNil(t, err, name)
+		}
+	}
+	_, err := os.Stat(marker)
+	assert.Nil(t, err)
+}
+
+func TestArtifactTargetProviderCosignSignature(t *testing.T) {
+	data := []byte("collector binary")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	digest := sha256.Sum256(data)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.Nil(t, err)
+	ts := serveFiles(map[string][]byte{"/collector": data, "/collector.sig": []byte(base64.StdEncoding.EncodeToString(signature))})
+	defer ts.Close()
+
+	provider := createTestProvider(t)
+	component := model.ComponentSpec{
+		Name: "collector",
+		Properties: map[string]interface{}{
+			artifactUrl:           ts.URL + "/collector",
+			artifactSignatureUrl:  ts.URL + "/collector.sig",
+			artifactSignatureType: signatureCosign,
+			artifactPublicKey:     publicKey,
+		},
+	}
+	_, err = applyComponent(provider, model.ComponentUpdate, component)
+	assert.Nil(t, err)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, _ = x509.MarshalPKIXPublicKey(&other.PublicKey)
+	component.Properties[artifactPublicKey] = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	_, err = applyComponent(provider, model.ComponentUpdate, component)
+	assert.NotNil(t, err)
+}
+
+func TestArtifactTargetProviderGpgSignature(t *testing.T) {
+	data := []byte("collector binary")
+	entity, err := openpgp.NewEntity("Symphony", "", "symphony@example.com", nil)
+	assert.Nil(t, err)
+	var publicKey bytes.Buffer
+	writer, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, entity.Serialize(writer))
+	assert.Nil(t, writer.Close())
+	var signature bytes.Buffer
+	assert.Nil(t, openpgp.ArmoredDetachSign(&signature, entity, bytes.NewReader(data), nil))
+	ts := serveFiles(map[string][]byte{"/collector": data, "/tampered": []byte("tampered binary")})
+	defer ts.Close()
+
+	provider := createTestProvider(t)
+	component := model.ComponentSpec{
+		Name: "collector",
+		Properties: map[string]interface{}{
+			artifactUrl:           ts.URL + "/collector",
+			artifactSignature:     signature.String(),
+			artifactSignatureType: signatureGpg,
+			artifactPublicKey:     publicKey.String(),
+		},
+	}
+	_, err = applyComponent(provider, model.ComponentUpdate, component)
+	assert.Nil(t, err)
+
+	component.Properties[artifactUrl] = ts.URL + "/tampered"
+	_, err = applyComponent(provider, model.ComponentUpdate, component)
+	assert.NotNil(t, err)
+}
+
+// TestArtifactTargetProviderOCI tests that artifacts are pulled from a registry with credentials
+func TestArtifactTargetProviderOCI(t *testing.T) {
+	layer := tarGz(t, map[string]string{"model.onnx": "weights"})
+	layerDigest := digest.FromBytes(layer)
+	config := []byte("{}")
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers: []ocispec.Descriptor{
+			{MediaType: "application/vnd.symphony.readme", Digest: digest.FromString("readme"), Size: 6, Annotations: map[string]string{ocispec.AnnotationTitle: "README"}},
+			{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: layerDigest, Size: int64(len(layer)), Annotations: map[string]string{ocispec.AnnotationTitle: "model.tar.gz"}},
+		},
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/models/detector/manifests/1.0":
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+			w.Write(manifest)
+		case "/v2/models/detector/blobs/" + layerDigest.String():
+			w.Write(layer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	provider := createTestProvider(t)
+	component := model.ComponentSpec{
+		Name: "detector",
+		Properties: map[string]interface{}{
+			artifactUrl:        "oci://" + strings.TrimPrefix(ts.URL, "http://") + "/models/detector:1.0",
+			artifactSha256:     layerDigest.Encoded(),
+			artifactFileName:   "model.tar.gz",
+			artifactAuthSecret: "registry",
+		},
+	}
+	_, err := applyComponent(provider, model.ComponentUpdate, component)
+	assert.Nil(t, err)
+	assert.Equal(t, "weights", readCurrentFile(t, provider, "detector", "model.onnx"))
+
+	component.Properties[artifactFileName] = "weights.bin"
+	_, err = applyComponent(provider, model.ComponentUpdate, component)
+	assert.NotNil(t, err)
+
+	delete(component.Properties, artifactAuthSecret)
+	component.Properties[artifactFileName] = "model.tar.gz"
+	_, err = applyComponent(provider, model.ComponentUpdate, component)
+	assert.NotNil(t, err)
+}
+
+func TestArtifactTargetProviderOCIUnsafeTitle(t *testing.T) {
+	layer := []byte("* * * * * root rm -rf /")
+	layerDigest := digest.FromBytes(layer)
+	config := []byte("{}")
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: "application/vnd.oci.empty.v1+json", Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers: []ocispec.Descriptor{
+			{MediaType: "application/octet-stream", Digest: layerDigest, Size: int64(len(layer)), Annotations: map[string]string{ocispec.AnnotationTitle: "../../escape"}},
+		},
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/jobs/cron/manifests/1.0":
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+			w.Write(manifest)
+		case "/v2/jobs/cron/blobs/" + layerDigest.String():
+			w.Write(layer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	provider := createTestProvider(t)
+	// the digest of the layer is right, the title in the manifest isn't covered by it
+	component := model.ComponentSpec{
+		Name: "cron",
+		Properties: map[string]interface{}{
+			artifactUrl:    "oci://" + strings.TrimPrefix(ts.URL, "http://") + "/jobs/cron:1.0",
+			artifactSha256: layerDigest.Encoded(),
+		},
+	}
+	_, err := applyComponent(provider, model.ComponentUpdate, component)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid file name")
+	err = filepath.WalkDir(filepath.Dir(provider.Config.InstallFolder), func(path string, entry fs.DirEntry, err error) error {
+		if err == nil {
+			assert.NotEqual(t, "escape", entry.Name())
+		}
+		return err
+	})
+	assert.Nil(t, err)
+}
+
+func TestArtifactTargetProviderValidation(t *testing.T) {
+	provider := createTestProvider(t)
+	invalid := []map[string]interface{}{
+		{artifactUrl: "ftp://example.com/tool"},
+		{artifactUrl: "/tmp/tool"},
+		{artifactUrl: "https://example.com/tool", artifactVersion: "../1.0"},
+		{artifactUrl: "https://example.com/tool", artifactSha256: "abc"},
+		{artifactUrl: "https://example.com/tool", artifactFileName: "../tool"},
+		{artifactUrl: "https://example.com/tool", artifactExtract: "rar"},
+		{artifactUrl: "https://example.com/tool", artifactMode: "rwx"},
+		{artifactUrl: "https://example.com/tool", artifactSignature: "c2ln"},
+		{artifactUrl: "https://example.com/tool", artifactSignatureType: signatureCosign, artifactPublicKey: "key"},
+		{artifactUrl: "https://example.com/tool", artifactSignatureType: signatureGpg, artifactSignature: "c2ln"},
+		{artifactUrl: "https://example.com/tool", artifactSignatureType: "x509", artifactSignature: "c2ln", artifactPublicKey: "key"},
+		{artifactUrl: "https://example.com/tool"},
+	}
+	for _, properties := range invalid {
+		_, err := applyComponent(provider, model.ComponentUpdate, model.ComponentSpec{Name: "tool", Properties: properties})
+		assert.NotNil(t, err, properties)
+	}
+}
+
+func TestIsDigestChanged(t *testing.T) {
+	digest := sha256Hex([]byte("tool"))
+	assert.False(t, isDigestChanged(digest, "sha256:"+strings.ToUpper(digest)))
+	assert.False(t, isDigestChanged(digest, nil))
+	assert.True(t, isDigestChanged(digest, sha256Hex([]byte("other"))))
+	assert.True(t, isDigestChanged(nil, digest))
+}
+
+func TestConformanceSuite(t *testing.T) {
+	provider := createTestProvider(t)
+	conformance.ConformanceSuite(t, provider)
+}
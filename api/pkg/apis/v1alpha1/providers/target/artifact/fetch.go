@@ -0,0 +1,538 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package artifact
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const (
+	extractAuto  = "auto"
+	extractNone  = "none"
+	extractTar   = "tar"
+	extractTarGz = "tar.gz"
+	extractZip   = "zip"
+
+	signatureCosign = "cosign"
+	signatureGpg    = "gpg"
+
+	// maxSignatureSize limits the size of downloaded signatures
+	maxSignatureSize = 1 << 20
+)
+
+// credentials are read from the secret of a component, with a token field or with username and
+// password fields
+type credentials struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// downloadedFile is an artifact downloaded to a temporary file
+type downloadedFile struct {
+	Path      string
+	Digest    string
+	FileName  string
+	MediaType string
+}
+
+func readCredentials(ctx context.Context, managerContext *contexts.ManagerContext, secretName string, namespace string) (*credentials, error) {
+	if secretName == "" {
+		return nil, nil
+	}
+	if managerContext == nil || managerContext.VencorContext == nil || managerContext.VencorContext.EvaluationContext == nil ||
+		managerContext.VencorContext.EvaluationContext.SecretProvider == nil {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s is set but no secret provider is configured", artifactAuthSecret), v1alpha2.BadConfig)
+	}
+	evalContext := managerContext.VencorContext.EvaluationContext.Clone()
+	evalContext.Context = ctx
+	evalContext.Namespace = namespace
+	secretProvider := evalContext.SecretProvider
+	if token, err := secretProvider.Get(ctx, secretName, "token", evalContext); err == nil && token != "" {
+		return &credentials{Token: token}, nil
+	}
+	ret := &credentials{}
+	var err error
+	if ret.Username, err = secretProvider.Get(ctx, secretName, "username", evalContext); err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read token or username from secret %s", secretName), v1alpha2.BadConfig)
+	}
+	if ret.Password, err = secretProvider.Get(ctx, secretName, "password", evalContext); err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read password from secret %s", secretName), v1alpha2.BadConfig)
+	}
+	return ret, nil
+}
+
+// download fetches an artifact to a temporary file in a folder and computes its SHA-256 digest
+func (i *ArtifactTargetProvider) download(ctx context.Context, spec artifactSpec, creds *credentials, folder string) (*downloadedFile, error) {
+	var reader io.ReadCloser
+	var err error
+	ret := &downloadedFile{}
+	expectedDigest := ""
+	sLog.InfofCtx(ctx, "  P (Artifact Target): download %s", spec.Url)
+	if strings.HasPrefix(spec.Url, "oci://") {
+		reader, expectedDigest, ret.FileName, ret.MediaType, err = i.fetchOCI(ctx, strings.TrimPrefix(spec.Url, "oci://"), spec.FileName, creds)
+	} else {
+		reader, err = fetchHTTP(ctx, spec.Url, creds, -1)
+		if u, _ := url.Parse(spec.Url); u != nil {
+			ret.FileName = path.Base(u.Path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if spec.FileName != "" {
+		ret.FileName = spec.FileName
+	}
+	if ret.FileName == "" || ret.FileName == "/" || ret.FileName == "." {
+		ret.FileName = "artifact"
+	}
+	// the title of an OCI layer isn't covered by the digest or signature of the layer
+	if !isFileName(ret.FileName) {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid file name '%s' of %s", ret.FileName, spec.Url), v1alpha2.BadRequest)
+	}
+
+	file, err := os.CreateTemp(folder, ".download-")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ret.Path = file.Name()
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(file, hash), reader); err != nil {
+		os.Remove(ret.Path)
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to download %s", spec.Url), v1alpha2.InternalError)
+	}
+	ret.Digest = hex.EncodeToString(hash.Sum(nil))
+	if expectedDigest != "" && expectedDigest != ret.Digest {
+		os.Remove(ret.Path)
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("digest of %s is sha256:%s, the registry reports sha256:%s", spec.Url, ret.Digest, expectedDigest), v1alpha2.InternalError)
+	}
+	return ret, nil
+}
+
+// fetchHTTP opens the body of a URL. maxSize limits the size of the body when it is not negative.
+func fetchHTTP(ctx context.Context, u string, creds *credentials, maxSize int64) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to create request to %s", u), v1alpha2.HttpNewRequestFailed)
+	}
+	if creds != nil {
+		if creds.Token != "" {
+			request.Header.Set("Authorization", "Bearer "+creds.Token)
+		} else {
+			request.SetBasicAuth(creds.Username, creds.Password)
+		}
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to send request to %s", u), v1alpha2.HttpSendRequestFailed)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("request to %s responded %d", u, resp.StatusCode), v1alpha2.HttpErrorResponse)
+	}
+	if maxSize >= 0 {
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, maxSize), resp.Body}, nil
+	}
+	return resp.Body, nil
+}
+
+// fetchOCI opens a layer of an OCI artifact: the layer titled with the file name if it is set,
+// or the first layer. It returns the layer, its digest, title and media type.
+func (i *ArtifactTargetProvider) fetchOCI(ctx context.Context, reference string, fileName string, creds *credentials) (io.ReadCloser, string, string, string, error) {
+	repo, err := remote.NewRepository(reference)
+	if err != nil {
+		return nil, "", "", "", v1alpha2.NewCOAError(err, fmt.Sprintf("invalid OCI reference %s", reference), v1alpha2.BadRequest)
+	}
+	repo.PlainHTTP = i.Config.PlainHTTP
+	if creds != nil {
+		credential := auth.Credential{Username: creds.Username, Password: creds.Password}
+		if creds.Token != "" {
+			credential = auth.Credential{AccessToken: creds.Token}
+		}
+		repo.Client = &auth.Client{
+			Client:     http.DefaultClient,
+			Credential: auth.StaticCredential(repo.Reference.Registry, credential),
+		}
+	}
+	ref := repo.Reference.Reference
+	if ref == "" {
+		ref = "latest"
+	}
+	descriptor, reader, err := repo.FetchReference(ctx, ref)
+	if err != nil {
+		return nil, "", "", "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to fetch manifest of %s", reference), v1alpha2.InternalError)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, descriptor.Size))
+	reader.Close()
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	if descriptor.MediaType != ocispec.MediaTypeImageManifest {
+		return nil, "", "", "", v1alpha2.NewCOAError(nil, fmt.Sprintf("%s is a %s, expected an image manifest", reference, descriptor.MediaType), v1alpha2.BadRequest)
+	}
+	var manifest ocispec.Manifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", "", "", err
+	}
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations[ocispec.AnnotationTitle]
+		if fileName != "" && title != fileName {
+			continue
+		}
+		if layer.Digest.Algorithm() != "sha256" {
+			return nil, "", "", "", v1alpha2.NewCOAError(nil, fmt.Sprintf("layer of %s has a %s digest, expected sha256", reference, layer.Digest.Algorithm()), v1alpha2.BadRequest)
+		}
+		blob, err := repo.Fetch(ctx, layer)
+		if err != nil {
+			return nil, "", "", "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to fetch layer of %s", reference), v1alpha2.InternalError)
+		}
+		return blob, layer.Digest.Encoded(), title, layer.MediaType, nil
+	}
+	return nil, "", "", "", v1alpha2.NewCOAError(nil, fmt.Sprintf("%s has no layer %s", reference, fileName), v1alpha2.BadRequest)
+}
+
+// verifySignature verifies the cosign or GPG signature of a downloaded artifact with a public key
+func (i *ArtifactTargetProvider) verifySignature(ctx context.Context, spec artifactSpec, creds *credentials, download *downloadedFile) error {
+	signature := []byte(spec.Signature)
+	if spec.SignatureUrl != "" {
+		reader, err := fetchHTTP(ctx, spec.SignatureUrl, creds, maxSignatureSize)
+		if err != nil {
+			return err
+		}
+		signature, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	switch spec.SignatureType {
+	case signatureCosign:
+		err = verifyCosign(download, signature, spec.PublicKey)
+	case signatureGpg:
+		err = verifyGpg(download, signature, spec.PublicKey)
+	}
+	if err != nil {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to verify %s signature of %s", spec.SignatureType, spec.Url), v1alpha2.BadRequest)
+	}
+	sLog.InfofCtx(ctx, "  P (Artifact Target): verified %s signature of %s", spec.SignatureType, spec.Url)
+	return nil
+}
+
+// verifyCosign verifies a signature created with cosign sign-blob and a key pair. The signature is
+// base64 encoded and signs the SHA-256 digest of the artifact.
+func verifyCosign(download *downloadedFile, signature []byte, publicKey string) error {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return fmt.Errorf("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64 encoded")
+	}
+	digest, err := hex.DecodeString(download.Digest)
+	if err != nil {
+		return err
+	}
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// verifyGpg verifies a detached GPG signature, armored or binary, with an armored or binary public key
+func verifyGpg(download *downloadedFile, signature []byte, publicKey string) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(publicKey))
+	if err != nil {
+		if keyring, err = openpgp.ReadKeyRing(strings.NewReader(publicKey)); err != nil {
+			return err
+		}
+	}
+	file, err := os.Open(download.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, file, bytes.NewReader(signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, file, bytes.NewReader(signature), nil)
+	}
+	return err
+}
+
+// extractFormat returns how a download is extracted, from the extract property, the media type of
+// OCI layers or the file name
+func extractFormat(download *downloadedFile, extract string) string {
+	if extract != extractAuto {
+		return extract
+	}
+	name := strings.ToLower(download.FileName)
+	switch {
+	case download.MediaType == ocispec.MediaTypeImageLayerGzip, strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTarGz
+	case download.MediaType == ocispec.MediaTypeImageLayer, strings.HasSuffix(name, ".tar"):
+		return extractTar
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip
+	}
+	return extractNone
+}
+
+// extract extracts a download into a folder, or copies it into the folder if it is not an archive
+func extract(download *downloadedFile, spec artifactSpec, folder string) error {
+	switch extractFormat(download, spec.Extract) {
+	case extractTar, extractTarGz:
+		file, err := os.Open(download.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		var reader io.Reader = file
+		if extractFormat(download, spec.Extract) == extractTarGz {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return v1alpha2.NewCOAError(err, "artifact is not a gzip archive", v1alpha2.BadRequest)
+			}
+			defer gz.Close()
+			reader = gz
+		}
+		return extractTarArchive(reader, folder)
+	case extractZip:
+		return extractZipArchive(download.Path, folder)
+	default:
+		source, err := os.Open(download.Path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		root, err := os.OpenRoot(folder)
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+		return writeRootFile(root, download.FileName, source, spec.Mode)
+	}
+}
+
+// archiveName returns the path of an archive entry relative to the folder it is extracted to,
+// entries must stay in the folder
+func archiveName(name string) (string, error) {
+	name = filepath.FromSlash(strings.TrimPrefix(name, "./"))
+	if name == "" || name == "." {
+		return ".", nil
+	}
+	if !filepath.IsLocal(name) {
+		return "", v1alpha2.NewCOAError(nil, fmt.Sprintf("archive entry %s is outside of the archive", name), v1alpha2.BadRequest)
+	}
+	return filepath.Clean(name), nil
+}
+
+// extractTarArchive extracts a tar archive into a folder. Entries are written through an os.Root
+// of the folder and can't be written through links, and links must resolve to entries of the
+// archive once it's extracted.
+func extractTarArchive(reader io.Reader, folder string) error {
+	root, err := os.OpenRoot(folder)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	links := make([]string, 0)
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return checkLinks(folder, links)
+		}
+		if err != nil {
+			return v1alpha2.NewCOAError(err, "artifact is not a valid tar archive", v1alpha2.BadRequest)
+		}
+		name, err := archiveName(header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = mkdirRoot(root, name)
+		case tar.TypeReg:
+			err = writeRootFile(root, name, archive, os.FileMode(header.Mode).Perm())
+		case tar.TypeSymlink:
+			// links must point into the archive as well
+			if filepath.IsAbs(header.Linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), header.Linkname)) {
+				return v1alpha2.NewCOAError(nil, fmt.Sprintf("archive link %s points outside of the archive", header.Name), v1alpha2.BadRequest)
+			}
+			if err = mkdirRoot(root, filepath.Dir(name)); err != nil {
+				return err
+			}
+			// the parent folders are checked to be real folders of the archive, so the link is
+			// created in the folder
+			if err = os.Symlink(header.Linkname, filepath.Join(folder, name)); err != nil {
+				return err
+			}
+			links = append(links, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkLinks checks that the links of an extracted archive resolve to entries in its folder, as
+// links that are each inside of the archive can still lead out of it through each other
+func checkLinks(folder string, links []string) error {
+	base, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		return err
+	}
+	for _, name := range links {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(folder, name))
+		if err == nil {
+			var rel string
+			if rel, err = filepath.Rel(base, resolved); err == nil && !filepath.IsLocal(rel) {
+				err = fmt.Errorf("%s resolves to %s", name, resolved)
+			}
+		}
+		if err != nil {
+			return v1alpha2.NewCOAError(err, fmt.Sprintf("archive link %s doesn't resolve to an entry of the archive", name), v1alpha2.BadRequest)
+		}
+	}
+	return nil
+}
+
+// mkdirRoot creates a folder and its parents in a root. Existing parents must be folders, not
+// links, so no entry is extracted through a link.
+func mkdirRoot(root *os.Root, name string) error {
+	if name == "." {
+		return nil
+	}
+	current := ""
+	for _, part := range strings.Split(name, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := root.Lstat(current)
+		if os.IsNotExist(err) {
+			err = root.Mkdir(current, 0755)
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("archive path %s is not a folder", current), v1alpha2.BadRequest)
+		}
+	}
+	return nil
+}
+
+// writeRootFile writes an archive entry, or a download that is not an archive, to a file in a root
+func writeRootFile(root *os.Root, name string, reader io.Reader, mode os.FileMode) error {
+	if name == "." {
+		return v1alpha2.NewCOAError(nil, "archive file entry has no name", v1alpha2.BadRequest)
+	}
+	if err := mkdirRoot(root, filepath.Dir(name)); err != nil {
+		return err
+	}
+	if info, err := root.Lstat(name); err == nil && !info.Mode().IsRegular() {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("archive entry %s replaces a link or folder", name), v1alpha2.BadRequest)
+	}
+	file, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Chmod(mode); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func extractZipArchive(path string, folder string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "artifact is not a valid zip archive", v1alpha2.BadRequest)
+	}
+	defer archive.Close()
+	root, err := os.OpenRoot(folder)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	for _, entry := range archive.File {
+		name, err := archiveName(entry.Name)
+		if err != nil {
+			return err
+		}
+		if entry.FileInfo().IsDir() {
+			if err = mkdirRoot(root, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		reader, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeRootFile(root, name, reader, entry.Mode().Perm())
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
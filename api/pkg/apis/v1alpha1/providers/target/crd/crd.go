@@ -0,0 +1,950 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package crd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/constants"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils/metahelper"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+var sLog = logger.NewLogger("providers.target.crd")
+
+const (
+	crdResources = "crd.resources"
+	crdReadiness = "crd.readiness"
+	crdTimeout   = "crd.timeout"
+	crdPrune     = "crd.prune"
+	crdObjects   = "crd.objects"
+	crdState     = "crd.state"
+
+	stateDeployed = "deployed"
+	stateMissing  = "missing"
+
+	defaultFieldManager = "symphony"
+	defaultTimeout      = "5m"
+	defaultPollInterval = "5s"
+
+	inventoryObjects = "objects"
+	inventoryDigest  = "digest"
+)
+
+var (
+	configMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespaceResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	invalidNameChars  = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+type (
+	// CRDTargetProviderConfig is the configuration of the CRD target provider
+	CRDTargetProviderConfig struct {
+		Name       string `json:"name,omitempty"`
+		ConfigType string `json:"configType,omitempty"`
+		ConfigData string `json:"configData,omitempty"`
+		InCluster  bool   `json:"inCluster"`
+		// FieldManager owns the fields the provider applies, default is symphony
+		FieldManager string `json:"fieldManager,omitempty"`
+		// ForceConflicts takes over fields that are owned by other field managers
+		ForceConflicts bool `json:"forceConflicts,omitempty"`
+		// Timeout is how long the provider waits for objects to be ready, default is 5m
+		Timeout string `json:"timeout,omitempty"`
+		// PollInterval is how often the provider checks whether objects are ready, default is 5s
+		PollInterval string `json:"pollInterval,omitempty"`
+	}
+
+	// CRDTargetProvider applies arbitrary Kubernetes objects, including custom resources, with
+	// server-side apply, and waits for them to be ready
+	CRDTargetProvider struct {
+		Config        CRDTargetProviderConfig
+		Context       *contexts.ManagerContext
+		DynamicClient dynamic.Interface
+		Mapper        meta.RESTMapper
+		MetaPopulator metahelper.MetaPopulator
+	}
+
+	// objectRef identifies an applied object
+	objectRef struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Namespace  string `json:"namespace,omitempty"`
+		Name       string `json:"name"`
+	}
+
+	// componentSpec is the objects of a component, and how to wait for them to be ready
+	componentSpec struct {
+		Objects   []*unstructured.Unstructured
+		Readiness []ReadinessCheck
+		Timeout   time.Duration
+		Prune     bool
+		Digest    string
+	}
+)
+
+func (r objectRef) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// sameObject returns whether two refs name the same object. The version isn't compared, as an object
+// of a group is served by each of its versions.
+func (r objectRef) sameObject(other objectRef) bool {
+	return groupOf(r.APIVersion) == groupOf(other.APIVersion) && r.Kind == other.Kind && r.Namespace == other.Namespace && r.Name == other.Name
+}
+
+func groupOf(apiVersion string) string {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return apiVersion
+	}
+	return gv.Group
+}
+
+func refOf(obj *unstructured.Unstructured) objectRef {
+	return objectRef{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+func CRDTargetProviderConfigFromMap(properties map[string]string) (CRDTargetProviderConfig, error) {
+	ret := CRDTargetProviderConfig{}
+	if v, ok := properties["name"]; ok {
+		ret.Name = v
+	}
+	if v, ok := properties["configType"]; ok {
+		ret.ConfigType = v
+	}
+	if v, ok := properties["configData"]; ok {
+		ret.ConfigData = v
+	}
+	if v, ok := properties["inCluster"]; ok && v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(err, "invalid bool value in the 'inCluster' setting of crd provider", v1alpha2.BadConfig)
+		}
+		ret.InCluster = b
+	}
+	if v, ok := properties["fieldManager"]; ok {
+		ret.FieldManager = v
+	}
+	if v, ok := properties["forceConflicts"]; ok && v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(err, "invalid bool value in the 'forceConflicts' setting of crd provider", v1alpha2.BadConfig)
+		}
+		ret.ForceConflicts = b
+	}
+	if v, ok := properties["timeout"]; ok {
+		ret.Timeout = v
+	}
+	if v, ok := properties["pollInterval"]; ok {
+		ret.PollInterval = v
+	}
+	return ret, nil
+}
+
+func (i *CRDTargetProvider) InitWithMap(properties map[string]string) error {
+	config, err := CRDTargetProviderConfigFromMap(properties)
+	if err != nil {
+		sLog.Errorf("  P (CRD Target): expected CRDTargetProviderConfig: %+v", err)
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *CRDTargetProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *CRDTargetProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("CRD Target Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (CRD Target): Init()")
+
+	updateConfig, err := toCRDTargetProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (CRD Target): expected CRDTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected CRDTargetProviderConfig", v1alpha2.InitFailed)
+		return err
+	}
+	if updateConfig.FieldManager == "" {
+		updateConfig.FieldManager = defaultFieldManager
+	}
+	if updateConfig.Timeout == "" {
+		updateConfig.Timeout = defaultTimeout
+	}
+	if updateConfig.PollInterval == "" {
+		updateConfig.PollInterval = defaultPollInterval
+	}
+	for key, value := range map[string]string{"timeout": updateConfig.Timeout, "pollInterval": updateConfig.PollInterval} {
+		if d, perr := time.ParseDuration(value); perr != nil || d <= 0 {
+			err = v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid crd provider config, invalid %s '%s'", key, value), v1alpha2.BadConfig)
+			sLog.ErrorfCtx(ctx, "  P (CRD Target): %+v", err)
+			return err
+		}
+	}
+	i.Config = updateConfig
+
+	if i.MetaPopulator == nil {
+		i.MetaPopulator, err = metahelper.NewMetaPopulator(metahelper.WithDefaultPopulators())
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to create meta populator: %+v", err)
+			err = v1alpha2.NewCOAError(err, "failed to create meta populator", v1alpha2.InitFailed)
+			return err
+		}
+	}
+	if i.DynamicClient != nil && i.Mapper != nil {
+		return nil
+	}
+
+	var kConfig *rest.Config
+	kConfig, err = i.getKubernetesConfig()
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to get the cluster config: %+v", err)
+		err = v1alpha2.NewCOAError(err, "failed to get kubernetes config", v1alpha2.InitFailed)
+		return err
+	}
+	i.DynamicClient, err = dynamic.NewForConfig(kConfig)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to create a dynamic client: %+v", err)
+		err = v1alpha2.NewCOAError(err, "failed to create dynamic client", v1alpha2.InitFailed)
+		return err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kConfig)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to create a discovery client: %+v", err)
+		err = v1alpha2.NewCOAError(err, "failed to create discovery client", v1alpha2.InitFailed)
+		return err
+	}
+	i.Mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return nil
+}
+
+func (i *CRDTargetProvider) getKubernetesConfig() (*rest.Config, error) {
+	if i.Config.InCluster {
+		return rest.InClusterConfig()
+	}
+	switch i.Config.ConfigType {
+	case "path":
+		if i.Config.ConfigData == "" {
+			home := homedir.HomeDir()
+			if home == "" {
+				return nil, v1alpha2.NewCOAError(nil, "can't locate home directory to read default kubernetes config file. To run in cluster, set inCluster to true", v1alpha2.BadConfig)
+			}
+			i.Config.ConfigData = filepath.Join(home, ".kube", "config")
+		}
+		return clientcmd.BuildConfigFromFlags("", i.Config.ConfigData)
+	case "inline":
+		if i.Config.ConfigData == "" {
+			return nil, v1alpha2.NewCOAError(nil, "config data is not supplied", v1alpha2.BadConfig)
+		}
+		return clientcmd.RESTConfigFromKubeConfig([]byte(i.Config.ConfigData))
+	default:
+		return nil, v1alpha2.NewCOAError(nil, "unrecognized config type, accepted values are: path and inline", v1alpha2.BadConfig)
+	}
+}
+
+func toCRDTargetProviderConfig(config providers.IProviderConfig) (CRDTargetProviderConfig, error) {
+	ret := CRDTargetProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+func (i *CRDTargetProvider) Get(ctx context.Context, deployment model.DeploymentSpec, references []model.ComponentStep) ([]model.ComponentSpec, error) {
+	ctx, span := observability.StartSpan("CRD Target Provider", ctx, &map[string]string{
+		"method": "Get",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (CRD Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	ret := make([]model.ComponentSpec, 0)
+	for _, component := range references {
+		var refs []objectRef
+		var digest string
+		var found bool
+		refs, digest, found, err = i.readInventory(ctx, deployment, component.Component.Name)
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to read the objects of %s: %+v", component.Component.Name, err)
+			return nil, err
+		}
+		if !found {
+			sLog.InfofCtx(ctx, "  P (CRD Target): objects of %s are not deployed", component.Component.Name)
+			continue
+		}
+		state := stateDeployed
+		objects := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			objects = append(objects, ref.String())
+			_, gerr := i.getObject(ctx, ref)
+			if kerrors.IsNotFound(gerr) || meta.IsNoMatchError(gerr) {
+				sLog.InfofCtx(ctx, "  P (CRD Target): object %s of %s is missing", ref, component.Component.Name)
+				state = stateMissing
+			} else if gerr != nil {
+				err = gerr
+				sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to get object %s: %+v", ref, err)
+				return nil, err
+			}
+		}
+		sLog.InfofCtx(ctx, "  P (CRD Target): append component: %s, objects are %s", component.Component.Name, state)
+		ret = append(ret, model.ComponentSpec{
+			Name: component.Component.Name,
+			Type: component.Component.Type,
+			Properties: map[string]interface{}{
+				crdResources: digest,
+				crdObjects:   objects,
+				crdState:     state,
+			},
+		})
+	}
+	return ret, nil
+}
+
+func (i *CRDTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
+	ctx, span := observability.StartSpan("CRD Target Provider", ctx, &map[string]string{
+		"method": "Apply",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (CRD Target): applying artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	injections := &model.ValueInjections{
+		InstanceId:        deployment.Instance.ObjectMeta.Name,
+		SolutionVersionId: deployment.Instance.Spec.SolutionVersion,
+		TargetId:          deployment.ActiveTarget,
+	}
+
+	components := step.GetComponents()
+	err = i.GetValidationRule(ctx).Validate(components)
+	if err == nil {
+		for _, component := range step.GetUpdatedComponents() {
+			if _, err = i.readComponentSpec(component, injections); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to validate components: %+v", err)
+		return nil, err
+	}
+	if isDryRun {
+		sLog.DebugCtx(ctx, "  P (CRD Target): dryRun is enabled, skipping apply")
+		err = nil
+		return nil, nil
+	}
+
+	ret := step.PrepareResultMap()
+	for _, component := range step.Components {
+		if component.Action == model.ComponentUpdate {
+			var statuses []string
+			statuses, err = i.deploy(ctx, deployment, component.Component, injections)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: joinStatuses(err.Error(), statuses),
+				}
+				sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to deploy objects of %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Updated,
+				Message: joinStatuses("", statuses),
+			}
+		} else {
+			err = i.remove(ctx, deployment, component.Component, injections)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.DeleteFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to remove objects of %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Deleted,
+				Message: "",
+			}
+		}
+	}
+	return ret, nil
+}
+
+// deploy applies the objects of a component, prunes the objects that were removed from it, and
+// waits for the objects to be ready. It returns the status of each object.
+func (i *CRDTargetProvider) deploy(ctx context.Context, deployment model.DeploymentSpec, component model.ComponentSpec, injections *model.ValueInjections) ([]string, error) {
+	spec, err := i.readComponentSpec(component, injections)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(spec.Timeout)
+	previous, _, _, err := i.readInventory(ctx, deployment, component.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err = i.ensureNamespace(ctx, scopeOf(deployment)); err != nil {
+		return nil, err
+	}
+
+	applied := make([]*unstructured.Unstructured, 0, len(spec.Objects))
+	refs := make([]objectRef, 0, len(spec.Objects))
+	for _, obj := range spec.Objects {
+		var result *unstructured.Unstructured
+		result, err = i.applyObject(ctx, deployment, obj, deadline)
+		if err != nil {
+			// records what was applied so far, so a later update or removal can clean it up
+			if ierr := i.writeInventory(ctx, deployment, component.Name, mergeRefs(previous, refs), ""); ierr != nil {
+				sLog.ErrorfCtx(ctx, "  P (CRD Target): failed to record the objects of %s: %+v", component.Name, ierr)
+			}
+			return nil, err
+		}
+		applied = append(applied, result)
+		refs = append(refs, refOf(result))
+	}
+
+	if spec.Prune {
+		for n := len(previous) - 1; n >= 0; n-- {
+			if containsRef(refs, previous[n]) {
+				continue
+			}
+			sLog.InfofCtx(ctx, "  P (CRD Target): prune object %s of %s", previous[n], component.Name)
+			if err = i.deleteObject(ctx, previous[n]); err != nil {
+				i.writeInventory(ctx, deployment, component.Name, mergeRefs(previous, refs), "")
+				return nil, err
+			}
+		}
+	} else {
+		refs = mergeRefs(previous, refs)
+	}
+	if err = i.writeInventory(ctx, deployment, component.Name, refs, spec.Digest); err != nil {
+		return nil, err
+	}
+	return i.waitForObjects(ctx, applied, spec.Readiness, deadline)
+}
+
+// remove deletes the objects of a component, in the reverse order they were applied
+func (i *CRDTargetProvider) remove(ctx context.Context, deployment model.DeploymentSpec, component model.ComponentSpec, injections *model.ValueInjections) error {
+	refs, _, found, err := i.readInventory(ctx, deployment, component.Name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// the objects of components that were deployed without an inventory are read from the component
+		spec, serr := i.readComponentSpec(component, injections)
+		if serr != nil {
+			return nil
+		}
+		for _, obj := range spec.Objects {
+			mapping, merr := i.Mapper.RESTMapping(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version)
+			if merr != nil {
+				continue
+			}
+			ref := refOf(obj)
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace && ref.Namespace == "" {
+				ref.Namespace = scopeOf(deployment)
+			}
+			refs = append(refs, ref)
+		}
+	}
+	for n := len(refs) - 1; n >= 0; n-- {
+		sLog.InfofCtx(ctx, "  P (CRD Target): delete object %s of %s", refs[n], component.Name)
+		if err = i.deleteObject(ctx, refs[n]); err != nil {
+			return err
+		}
+	}
+	err = i.DynamicClient.Resource(configMapResource).Namespace(scopeOf(deployment)).Delete(ctx, inventoryName(deployment, component.Name), metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// resourceFor finds the resource of an object. An object of a kind that is not known yet, such as
+// a custom resource of a definition that was just applied, is looked up again until the deadline.
+func (i *CRDTargetProvider) resourceFor(ctx context.Context, gvk schema.GroupVersionKind, deadline time.Time) (*meta.RESTMapping, error) {
+	interval, _ := time.ParseDuration(i.Config.PollInterval)
+	for {
+		mapping, err := i.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err == nil || !meta.IsNoMatchError(err) || time.Now().Add(interval).After(deadline) {
+			return mapping, err
+		}
+		sLog.InfofCtx(ctx, "  P (CRD Target): kind %s is not known yet, retrying", gvk)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		if r, ok := i.Mapper.(meta.ResettableRESTMapper); ok {
+			r.Reset()
+		}
+	}
+}
+
+// applyObject applies an object with server-side apply, as the configured field manager
+func (i *CRDTargetProvider) applyObject(ctx context.Context, deployment model.DeploymentSpec, obj *unstructured.Unstructured, deadline time.Time) (*unstructured.Unstructured, error) {
+	obj = obj.DeepCopy()
+	mapping, err := i.resourceFor(ctx, obj.GroupVersionKind(), deadline)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to find the resource of %s", refOf(obj)), v1alpha2.ApplyResourceFailed)
+	}
+	var dr dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(scopeOf(deployment))
+		}
+		dr = i.DynamicClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	} else {
+		obj.SetNamespace("")
+		dr = i.DynamicClient.Resource(mapping.Resource)
+	}
+	if err = i.MetaPopulator.PopulateMeta(obj, deployment.Instance); err != nil {
+		return nil, err
+	}
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+
+	observ_utils.EmitUserAuditsLogs(ctx, "  P (CRD Target): Start to apply object - %s", refOf(obj))
+	result, err := dr.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: i.Config.FieldManager, Force: i.Config.ForceConflicts})
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to apply %s", refOf(obj)), v1alpha2.ApplyResourceFailed)
+	}
+	return result, nil
+}
+
+func (i *CRDTargetProvider) resourceInterface(ref objectRef) (dynamic.ResourceInterface, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := i.Mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return i.DynamicClient.Resource(mapping.Resource).Namespace(ref.Namespace), nil
+	}
+	return i.DynamicClient.Resource(mapping.Resource), nil
+}
+
+func (i *CRDTargetProvider) getObject(ctx context.Context, ref objectRef) (*unstructured.Unstructured, error) {
+	dr, err := i.resourceInterface(ref)
+	if err != nil {
+		return nil, err
+	}
+	return dr.Get(ctx, ref.Name, metav1.GetOptions{})
+}
+
+// deleteObject deletes an object, an object that is already gone or whose kind is gone is ignored
+func (i *CRDTargetProvider) deleteObject(ctx context.Context, ref objectRef) error {
+	dr, err := i.resourceInterface(ref)
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to find the resource of %s", ref), v1alpha2.DeleteResourceFailed)
+	}
+	observ_utils.EmitUserAuditsLogs(ctx, "  P (CRD Target): Start to delete object - %s", ref)
+	propagation := metav1.DeletePropagationBackground
+	err = dr.Delete(ctx, ref.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to delete %s", ref), v1alpha2.DeleteResourceFailed)
+	}
+	return nil
+}
+
+// waitForObjects waits until the applied objects are ready, or one of them fails, or the deadline
+// passes. It returns the status of each object.
+func (i *CRDTargetProvider) waitForObjects(ctx context.Context, objects []*unstructured.Unstructured, checks []ReadinessCheck, deadline time.Time) ([]string, error) {
+	interval, _ := time.ParseDuration(i.Config.PollInterval)
+	statuses := make([]objectStatus, len(objects))
+	for {
+		pending := 0
+		for n, obj := range objects {
+			if statuses[n].Ready {
+				continue
+			}
+			current, err := i.getObject(ctx, refOf(obj))
+			if err != nil {
+				statuses[n] = objectStatus{Reason: fmt.Sprintf("can't be read: %v", err)}
+				pending++
+				continue
+			}
+			statuses[n] = evaluateReadiness(current, checks)
+			if statuses[n].Failed {
+				return describeStatuses(objects, statuses), v1alpha2.NewCOAError(nil, fmt.Sprintf("%s failed: %s", refOf(obj), statuses[n].Reason), v1alpha2.CheckResourceStatusFailed)
+			}
+			if !statuses[n].Ready {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return describeStatuses(objects, statuses), nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return describeStatuses(objects, statuses), v1alpha2.NewCOAError(nil, fmt.Sprintf("%d objects are not ready within the timeout", pending), v1alpha2.CheckResourceStatusFailed)
+		}
+		select {
+		case <-ctx.Done():
+			return describeStatuses(objects, statuses), ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func describeStatuses(objects []*unstructured.Unstructured, statuses []objectStatus) []string {
+	ret := make([]string, 0, len(objects))
+	for n, obj := range objects {
+		switch {
+		case statuses[n].Ready:
+			ret = append(ret, fmt.Sprintf("%s: ready", refOf(obj)))
+		case statuses[n].Failed:
+			ret = append(ret, fmt.Sprintf("%s: failed, %s", refOf(obj), statuses[n].Reason))
+		default:
+			ret = append(ret, fmt.Sprintf("%s: not ready, %s", refOf(obj), statuses[n].Reason))
+		}
+	}
+	return ret
+}
+
+func joinStatuses(message string, statuses []string) string {
+	if len(statuses) == 0 {
+		return message
+	}
+	if message == "" {
+		return strings.Join(statuses, "; ")
+	}
+	return message + "; " + strings.Join(statuses, "; ")
+}
+
+// ensureNamespace creates the namespace of the instance scope
+func (i *CRDTargetProvider) ensureNamespace(ctx context.Context, namespace string) error {
+	if namespace == constants.DefaultScope {
+		return nil
+	}
+	_, err := i.DynamicClient.Resource(namespaceResource).Get(ctx, namespace, metav1.GetOptions{})
+	if err == nil || !kerrors.IsNotFound(err) {
+		return err
+	}
+	observ_utils.EmitUserAuditsLogs(ctx, "  P (CRD Target): Start to create namespace - %s", namespace)
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName(namespace)
+	_, err = i.DynamicClient.Resource(namespaceResource).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// inventoryName is the name of the config map that records the objects of a component. The sanitized
+// names of different instances and components can be the same, so a hash of the pair tells them apart.
+func inventoryName(deployment model.DeploymentSpec, component string) string {
+	sum := sha256.Sum256([]byte(deployment.Instance.ObjectMeta.Name + "\x00" + component))
+	suffix := "-" + hex.EncodeToString(sum[:])[:10]
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(fmt.Sprintf("%s-%s", deployment.Instance.ObjectMeta.Name, component)), "-")
+	name = "symphony-crd-" + strings.Trim(name, "-")
+	if len(name) > 253-len(suffix) {
+		name = name[:253-len(suffix)]
+	}
+	return strings.TrimRight(name, "-") + suffix
+}
+
+func scopeOf(deployment model.DeploymentSpec) string {
+	if deployment.Instance.Spec == nil || deployment.Instance.Spec.Scope == "" {
+		return constants.DefaultScope
+	}
+	return deployment.Instance.Spec.Scope
+}
+
+// readInventory reads the objects that were applied for a component, and the digest of its resources
+func (i *CRDTargetProvider) readInventory(ctx context.Context, deployment model.DeploymentSpec, component string) ([]objectRef, string, bool, error) {
+	obj, err := i.DynamicClient.Resource(configMapResource).Namespace(scopeOf(deployment)).Get(ctx, inventoryName(deployment, component), metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, "", false, nil
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	var refs []objectRef
+	if err = json.Unmarshal([]byte(data[inventoryObjects]), &refs); err != nil {
+		return nil, "", false, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid inventory of %s", component), v1alpha2.InternalError)
+	}
+	return refs, data[inventoryDigest], true, nil
+}
+
+// writeInventory records the objects that were applied for a component
+func (i *CRDTargetProvider) writeInventory(ctx context.Context, deployment model.DeploymentSpec, component string, refs []objectRef, digest string) error {
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName(inventoryName(deployment, component))
+	obj.SetNamespace(scopeOf(deployment))
+	if err = i.MetaPopulator.PopulateMeta(obj, deployment.Instance); err != nil {
+		return err
+	}
+	unstructured.SetNestedStringMap(obj.Object, map[string]string{
+		inventoryObjects: string(data),
+		inventoryDigest:  digest,
+	}, "data")
+	_, err = i.DynamicClient.Resource(configMapResource).Namespace(obj.GetNamespace()).Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: i.Config.FieldManager, Force: true})
+	return err
+}
+
+func containsRef(refs []objectRef, ref objectRef) bool {
+	for _, r := range refs {
+		if r.sameObject(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeRefs(previous []objectRef, refs []objectRef) []objectRef {
+	ret := append([]objectRef{}, refs...)
+	for _, ref := range previous {
+		if !containsRef(ret, ref) {
+			ret = append(ret, ref)
+		}
+	}
+	return ret
+}
+
+// readComponentSpec reads and validates the objects of a component, and how to wait for them
+func (i *CRDTargetProvider) readComponentSpec(component model.ComponentSpec, injections *model.ValueInjections) (componentSpec, error) {
+	invalid := func(format string, args ...interface{}) (componentSpec, error) {
+		return componentSpec{}, v1alpha2.NewCOAError(nil, fmt.Sprintf("component %s: %s", component.Name, fmt.Sprintf(format, args...)), v1alpha2.BadRequest)
+	}
+	ret := componentSpec{Prune: true, Digest: resourcesDigest(component.Properties[crdResources])}
+	objects, err := readObjects(component.Properties[crdResources], injections)
+	if err != nil {
+		return invalid("invalid %s: %v", crdResources, err)
+	}
+	if len(objects) == 0 {
+		return invalid("%s has no objects", crdResources)
+	}
+	var refs []objectRef
+	for _, obj := range objects {
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			return invalid("every object of %s needs an apiVersion, a kind and a metadata.name", crdResources)
+		}
+		if _, err = schema.ParseGroupVersion(obj.GetAPIVersion()); err != nil {
+			return invalid("invalid apiVersion '%s'", obj.GetAPIVersion())
+		}
+		if containsRef(refs, refOf(obj)) {
+			return invalid("%s is defined more than once", refOf(obj))
+		}
+		refs = append(refs, refOf(obj))
+	}
+	// namespaces and definitions are applied before the objects that need them
+	sort.SliceStable(objects, func(a, b int) bool {
+		return applyOrder(objects[a]) < applyOrder(objects[b])
+	})
+	ret.Objects = objects
+
+	if err = readJSONProperty(component.Properties, crdReadiness, &ret.Readiness); err != nil {
+		return invalid("invalid %s, expected a list of checks: %v", crdReadiness, err)
+	}
+	for n := range ret.Readiness {
+		if err = ret.Readiness[n].compile(); err != nil {
+			return invalid("invalid %s: %v", crdReadiness, err)
+		}
+	}
+	timeout := model.ReadPropertyCompat(component.Properties, crdTimeout, injections)
+	if timeout == "" {
+		timeout = i.Config.Timeout
+	}
+	if ret.Timeout, err = time.ParseDuration(timeout); err != nil || ret.Timeout <= 0 {
+		return invalid("invalid %s '%s', expected a duration such as 5m", crdTimeout, timeout)
+	}
+	if v := model.ReadPropertyCompat(component.Properties, crdPrune, injections); v != "" {
+		if ret.Prune, err = strconv.ParseBool(v); err != nil {
+			return invalid("invalid %s '%s', expected true or false", crdPrune, v)
+		}
+	}
+	return ret, nil
+}
+
+func applyOrder(obj *unstructured.Unstructured) int {
+	switch obj.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Kind: "Namespace"}:
+		return 0
+	case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+		return 1
+	}
+	return 2
+}
+
+// readObjects reads objects given as an object, a list of objects, or YAML documents
+func readObjects(value interface{}, injections *model.ValueInjections) ([]*unstructured.Unstructured, error) {
+	var docs []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(strings.NewReader(model.ResolveString(v, injections))))
+		for {
+			data, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			var doc interface{}
+			if err = yaml.Unmarshal(data, &doc); err != nil {
+				return nil, err
+			}
+			if doc != nil {
+				docs = append(docs, doc)
+			}
+		}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var doc interface{}
+		if err = json.Unmarshal([]byte(model.ResolveString(string(data), injections)), &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	var ret []*unstructured.Unstructured
+	var add func(doc interface{}) error
+	add = func(doc interface{}) error {
+		switch d := doc.(type) {
+		case []interface{}:
+			for _, item := range d {
+				if err := add(item); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			obj := &unstructured.Unstructured{Object: d}
+			if obj.IsList() {
+				items, _, _ := unstructured.NestedSlice(d, "items")
+				return add(items)
+			}
+			ret = append(ret, obj)
+		default:
+			return fmt.Errorf("expected objects, got %T", doc)
+		}
+		return nil
+	}
+	for _, doc := range docs {
+		if err := add(doc); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// readJSONProperty reads a property given as a value or as a JSON string
+func readJSONProperty(properties map[string]interface{}, key string, target interface{}) error {
+	v, ok := properties[key]
+	if !ok || v == nil {
+		return nil
+	}
+	var data []byte
+	if s, ok := v.(string); ok {
+		data = []byte(s)
+	} else {
+		data, _ = json.Marshal(v)
+	}
+	return yaml.Unmarshal(data, target)
+}
+
+// resourcesDigest is the digest of the resources of a component, which Get reports as the resources
+func resourcesDigest(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isResourcesChanged compares the digest of the deployed resources with the desired resources
+func isResourcesChanged(oldProp, newProp any) bool {
+	if oldProp == nil {
+		return newProp != nil
+	}
+	return fmt.Sprintf("%v", oldProp) != resourcesDigest(newProp)
+}
+
+// isStateChanged reports a component with missing objects
+func isStateChanged(oldProp, newProp any) bool {
+	return oldProp != nil && fmt.Sprintf("%v", oldProp) != stateDeployed
+}
+
+func (*CRDTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
+	return model.ValidationRule{
+		AllowSidecar: false,
+		ComponentValidationRule: model.ComponentValidationRule{
+			RequiredProperties:    []string{crdResources},
+			OptionalProperties:    []string{crdReadiness, crdTimeout, crdPrune},
+			RequiredComponentType: "",
+			RequiredMetadata:      []string{},
+			OptionalMetadata:      []string{},
+			ChangeDetectionProperties: []model.PropertyDesc{
+				{Name: crdResources, IgnoreCase: false, SkipIfMissing: false, PropChanged: isResourcesChanged},
+				{Name: crdState, IgnoreCase: false, SkipIfMissing: false, PropChanged: isStateChanged},
+			},
+		},
+	}
+}
@@ -0,0 +1,593 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package crd
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://127.0.0.1:6443
+  name: test
+contexts:
+- context:
+    cluster: test
+    user: test
+  name: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+var (
+	widgetResource = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	widgetKind     = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+)
+
+// recordingClient records the options objects are applied with, which the fake client ignores
+type recordingClient struct {
+	dynamic.Interface
+	lock    *sync.Mutex
+	applies *[]metav1.ApplyOptions
+}
+
+type recordingResource struct {
+	dynamic.NamespaceableResourceInterface
+	client recordingClient
+}
+
+type recordingNamespacedResource struct {
+	dynamic.ResourceInterface
+	client recordingClient
+}
+
+func (c recordingClient) record(options metav1.ApplyOptions) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	*c.applies = append(*c.applies, options)
+}
+
+func (c recordingClient) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return recordingResource{NamespaceableResourceInterface: c.Interface.Resource(resource), client: c}
+}
+
+func (r recordingResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return recordingNamespacedResource{ResourceInterface: r.NamespaceableResourceInterface.Namespace(namespace), client: r.client}
+}
+
+func (r recordingResource) Apply(ctx context.Context, name string, obj *unstructured.Unstructured, options metav1.ApplyOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.client.record(options)
+	return r.NamespaceableResourceInterface.Apply(ctx, name, obj, options, subresources...)
+}
+
+func (r recordingNamespacedResource) Apply(ctx context.Context, name string, obj *unstructured.Unstructured, options metav1.ApplyOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.client.record(options)
+	return r.ResourceInterface.Apply(ctx, name, obj, options, subresources...)
+}
+
+// newFakeClient creates a dynamic client that creates or replaces objects that are applied, keeps
+// their status, and increases their generation when their spec changes
+func newFakeClient(objects ...runtime.Object) *dfake.FakeDynamicClient {
+	client := dfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &obj.Object); err != nil {
+			return true, nil, err
+		}
+		tracker := client.Tracker()
+		existing, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if kerrors.IsNotFound(err) {
+			obj.SetGeneration(1)
+			err = tracker.Create(patch.GetResource(), obj, patch.GetNamespace())
+		} else if err == nil {
+			current := existing.(*unstructured.Unstructured)
+			obj.SetGeneration(current.GetGeneration())
+			if !reflect.DeepEqual(obj.Object["spec"], current.Object["spec"]) {
+				obj.SetGeneration(current.GetGeneration() + 1)
+			}
+			if status, ok := current.Object["status"]; ok {
+				obj.Object["status"] = status
+			}
+			err = tracker.Update(patch.GetResource(), obj, patch.GetNamespace())
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		ret, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		return true, ret, err
+	})
+	return client
+}
+
+func newMapper() *meta.DefaultRESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	mapper.Add(widgetKind, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"}, meta.RESTScopeRoot)
+	return mapper
+}
+
+func createTestProvider(t *testing.T, mapper meta.RESTMapper, objects ...runtime.Object) (*CRDTargetProvider, *dfake.FakeDynamicClient, *[]metav1.ApplyOptions) {
+	fakeClient := newFakeClient(objects...)
+	applies := &[]metav1.ApplyOptions{}
+	provider := &CRDTargetProvider{
+		DynamicClient: recordingClient{Interface: fakeClient, lock: &sync.Mutex{}, applies: applies},
+		Mapper:        mapper,
+	}
+	err := provider.Init(CRDTargetProviderConfig{Timeout: "2s", PollInterval: "10ms"})
+	assert.Nil(t, err)
+	return provider, fakeClient, applies
+}
+
+func testDeployment(scope string) model.DeploymentSpec {
+	return model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "edge"},
+			Spec:       &model.InstanceSpec{Scope: scope},
+		},
+	}
+}
+
+func widget(name string, size int) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{"size": size, "owner": "${{$instance()}}"},
+	}
+}
+
+func getWidget(t *testing.T, client *dfake.FakeDynamicClient, namespace string, name string) (*unstructured.Unstructured, error) {
+	return client.Resource(widgetResource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+}
+
+func TestCRDTargetProviderConfigFromMap(t *testing.T) {
+	config, err := CRDTargetProviderConfigFromMap(map[string]string{
+		"name":           "crd",
+		"configType":     "inline",
+		"configData":     testKubeConfig,
+		"fieldManager":   "edge-manager",
+		"forceConflicts": "true",
+		"timeout":        "10m",
+		"pollInterval":   "1s",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "edge-manager", config.FieldManager)
+	assert.True(t, config.ForceConflicts)
+	assert.Equal(t, "10m", config.Timeout)
+
+	for _, properties := range []map[string]string{{"inCluster": "maybe"}, {"forceConflicts": "maybe"}} {
+		_, err = CRDTargetProviderConfigFromMap(properties)
+		assert.NotNil(t, err, properties)
+	}
+
+	provider := CRDTargetProvider{}
+	err = provider.InitWithMap(map[string]string{"configType": "inline", "configData": testKubeConfig})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultFieldManager, provider.Config.FieldManager)
+	assert.Equal(t, defaultTimeout, provider.Config.Timeout)
+	assert.Equal(t, defaultPollInterval, provider.Config.PollInterval)
+	assert.NotNil(t, provider.DynamicClient)
+	assert.NotNil(t, provider.Mapper)
+
+	for _, properties := range []map[string]string{
+		{"configType": "remote"},
+		{"configType": "inline"},
+		{"configType": "inline", "configData": testKubeConfig, "timeout": "soon"},
+		{"configType": "inline", "configData": testKubeConfig, "pollInterval": "0s"},
+	} {
+		provider = CRDTargetProvider{}
+		err = provider.InitWithMap(properties)
+		assert.NotNil(t, err, properties)
+	}
+}
+
+func TestReadComponentSpec(t *testing.T) {
+	provider, _, _ := createTestProvider(t, newMapper())
+	injections := &model.ValueInjections{InstanceId: "edge"}
+
+	spec, err := provider.readComponentSpec(model.ComponentSpec{
+		Name: "widgets",
+		Properties: map[string]interface{}{
+			crdResources: []interface{}{widget("a", 1), widget("b", 2)},
+			crdReadiness: []interface{}{map[string]interface{}{"kind": "Widget", "condition": "Ready"}},
+			crdTimeout:   "30s",
+			crdPrune:     "false",
+		},
+	}, injections)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(spec.Objects))
+	assert.Equal(t, "edge", spec.Objects[0].Object["spec"].(map[string]interface{})["owner"])
+	assert.Equal(t, "True", spec.Readiness[0].Status)
+	assert.Equal(t, 30*time.Second, spec.Timeout)
+	assert.False(t, spec.Prune)
+
+	// YAML documents and lists are read in order, after namespaces and definitions
+	spec, err = provider.readComponentSpec(model.ComponentSpec{
+		Name: "widgets",
+		Properties: map[string]interface{}{
+			crdResources: `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: ${{$instance()}}-widget
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apiextensions.k8s.io/v1
+  kind: CustomResourceDefinition
+  metadata:
+    name: widgets.example.com
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: widgets
+`,
+			crdReadiness: `[{"jsonPath": ".status.phase", "values": ["Running"]}]`,
+		},
+	}, injections)
+	assert.Nil(t, err)
+	var names []string
+	for _, obj := range spec.Objects {
+		names = append(names, refOf(obj).String())
+	}
+	assert.Equal(t, []string{"Namespace/widgets", "CustomResourceDefinition/widgets.example.com", "Widget/edge-widget"}, names)
+	assert.Equal(t, 2*time.Second, spec.Timeout)
+	assert.True(t, spec.Prune)
+
+	invalid := []map[string]interface{}{
+		{crdResources: "kind: Widget"},
+		{crdResources: map[string]interface{}{"apiVersion": "example.com/v1", "kind": "Widget"}},
+		{crdResources: []interface{}{widget("a", 1), widget("a", 2)}},
+		{crdResources: []interface{}{"a"}},
+		{crdResources: "a: [b"},
+		{crdResources: widget("a", 1), crdReadiness: []interface{}{map[string]interface{}{"kind": "Widget"}}},
+		{crdResources: widget("a", 1), crdReadiness: []interface{}{map[string]interface{}{"condition": "Ready", "jsonPath": ".status.phase"}}},
+		{crdResources: widget("a", 1), crdReadiness: []interface{}{map[string]interface{}{"jsonPath": "{.status[}"}}},
+		{crdResources: widget("a", 1), crdReadiness: "Ready"},
+		{crdResources: widget("a", 1), crdTimeout: "30"},
+		{crdResources: widget("a", 1), crdPrune: "sometimes"},
+	}
+	for _, properties := range invalid {
+		_, err = provider.readComponentSpec(model.ComponentSpec{Name: "widgets", Properties: properties}, injections)
+		assert.NotNil(t, err, properties)
+	}
+}
+
+func TestEvaluateReadiness(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: widget("a", 1)}
+	obj.SetGeneration(2)
+	checks := []ReadinessCheck{
+		{Kind: "Widget", Condition: "Ready"},
+		{Kind: "Widget", JSONPath: "{.status.phase}", Values: []string{"Running"}, FailedValues: []string{"Failed"}},
+		{Kind: "Gadget", Condition: "Synced"},
+	}
+	for n := range checks {
+		assert.Nil(t, checks[n].compile())
+	}
+
+	status := evaluateReadiness(obj, checks)
+	assert.False(t, status.Ready)
+	assert.Equal(t, "condition Ready is not reported", status.Reason)
+
+	obj.Object["status"] = map[string]interface{}{
+		"observedGeneration": int64(1),
+		"conditions":         []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+	}
+	assert.Equal(t, "status is not observed yet", evaluateReadiness(obj, checks).Reason)
+
+	obj.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False", "message": "waiting for quota", "observedGeneration": int64(2)}},
+	}
+	assert.Equal(t, "condition Ready is False: waiting for quota", evaluateReadiness(obj, checks).Reason)
+
+	obj.Object["status"] = map[string]interface{}{
+		"phase":      "Pending",
+		"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+	}
+	status = evaluateReadiness(obj, checks)
+	assert.False(t, status.Ready)
+	assert.False(t, status.Failed)
+	assert.Equal(t, "{.status.phase} is Pending", status.Reason)
+
+	unstructured.SetNestedField(obj.Object, "Failed", "status", "phase")
+	status = evaluateReadiness(obj, checks)
+	assert.True(t, status.Failed)
+
+	unstructured.SetNestedField(obj.Object, "Running", "status", "phase")
+	assert.True(t, evaluateReadiness(obj, checks).Ready)
+
+	// an expression without values is ready with any value
+	check := ReadinessCheck{JSONPath: ".status.endpoint"}
+	assert.Nil(t, check.compile())
+	assert.False(t, evaluateReadiness(obj, []ReadinessCheck{check}).Ready)
+	unstructured.SetNestedField(obj.Object, "10.0.0.1", "status", "endpoint")
+	assert.True(t, evaluateReadiness(obj, []ReadinessCheck{check}).Ready)
+
+	// objects that are not selected by a check are ready
+	gadget := &unstructured.Unstructured{}
+	gadget.SetAPIVersion("example.com/v1")
+	gadget.SetKind("Gizmo")
+	assert.True(t, evaluateReadiness(gadget, checks).Ready)
+}
+
+func TestCRDTargetProviderLifecycle(t *testing.T) {
+	provider, client, applies := createTestProvider(t, newMapper())
+	deployment := testDeployment("widgets")
+	gadget := map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Gadget",
+		"metadata":   map[string]interface{}{"name": "g", "namespace": "ignored"},
+	}
+	component := model.ComponentSpec{
+		Name:       "widgets",
+		Properties: map[string]interface{}{crdResources: []interface{}{widget("a", 1), widget("b", 1), gadget}},
+	}
+	references := []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}
+
+	components, err := provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(components))
+
+	ret, err := provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["widgets"].Status)
+	assert.Equal(t, "Widget/widgets/a: ready; Widget/widgets/b: ready; Gadget/g: ready", ret["widgets"].Message)
+	obj, err := getWidget(t, client, "widgets", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "edge", obj.Object["spec"].(map[string]interface{})["owner"])
+	_, err = client.Resource(namespaceResource).Get(context.Background(), "widgets", metav1.GetOptions{})
+	assert.Nil(t, err)
+	for _, options := range *applies {
+		assert.Equal(t, defaultFieldManager, options.FieldManager)
+	}
+	// the three objects are applied as their own, and the inventory takes over its fields
+	assert.Equal(t, 4, len(*applies))
+	assert.False(t, (*applies)[0].Force)
+
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+	assert.Equal(t, stateDeployed, components[0].Properties[crdState])
+	assert.Equal(t, []string{"Widget/widgets/a", "Widget/widgets/b", "Gadget/g"}, components[0].Properties[crdObjects])
+	rule := provider.GetValidationRule(context.Background())
+	assert.False(t, rule.IsComponentChanged(components[0], component))
+
+	// objects that are removed from the component are pruned
+	changed := model.ComponentSpec{
+		Name:       "widgets",
+		Properties: map[string]interface{}{crdResources: []interface{}{widget("a", 2)}},
+	}
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: changed}}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["widgets"].Status)
+	obj, err = getWidget(t, client, "widgets", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), obj.GetGeneration())
+	_, err = getWidget(t, client, "widgets", "b")
+	assert.True(t, kerrors.IsNotFound(err))
+	_, err = client.Resource(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "gadgets"}).Get(context.Background(), "g", metav1.GetOptions{})
+	assert.True(t, kerrors.IsNotFound(err))
+
+	// an object that is deleted out of band is deployed again
+	err = client.Resource(widgetResource).Namespace("widgets").Delete(context.Background(), "a", metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, stateMissing, components[0].Properties[crdState])
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+
+	references[0].Action = model.ComponentDelete
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["widgets"].Status)
+	_, err = client.Resource(configMapResource).Namespace("widgets").Get(context.Background(), inventoryName(deployment, "widgets"), metav1.GetOptions{})
+	assert.True(t, kerrors.IsNotFound(err))
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(components))
+}
+
+func TestCRDTargetProviderWithoutPruning(t *testing.T) {
+	provider, client, _ := createTestProvider(t, newMapper())
+	provider.Config.ForceConflicts = true
+	deployment := testDeployment("")
+	apply := func(properties map[string]interface{}) {
+		_, err := provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: []model.ComponentStep{{
+			Action:    model.ComponentUpdate,
+			Component: model.ComponentSpec{Name: "widgets", Properties: properties},
+		}}}, false)
+		assert.Nil(t, err)
+	}
+	apply(map[string]interface{}{crdResources: []interface{}{widget("a", 1), widget("b", 1)}})
+	apply(map[string]interface{}{crdResources: []interface{}{widget("a", 1)}, crdPrune: false})
+	_, err := getWidget(t, client, "default", "b")
+	assert.Nil(t, err)
+
+	// objects that were kept stay in the inventory, and are removed with the component
+	_, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: []model.ComponentStep{{
+		Action:    model.ComponentDelete,
+		Component: model.ComponentSpec{Name: "widgets", Properties: map[string]interface{}{crdResources: []interface{}{widget("a", 1)}}},
+	}}}, false)
+	assert.Nil(t, err)
+	_, err = getWidget(t, client, "default", "b")
+	assert.True(t, kerrors.IsNotFound(err))
+}
+
+func TestCRDTargetProviderReadiness(t *testing.T) {
+	provider, client, _ := createTestProvider(t, newMapper())
+	deployment := testDeployment("")
+	component := model.ComponentSpec{
+		Name: "widgets",
+		Properties: map[string]interface{}{
+			crdResources: widget("a", 1),
+			crdReadiness: []interface{}{map[string]interface{}{"kind": "Widget", "condition": "Ready"}},
+		},
+	}
+	step := model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}}
+
+	// the controller reports the widget ready after it is applied
+	go func() {
+		for {
+			obj, err := getWidget(t, client, "default", "a")
+			if err == nil {
+				obj.Object["status"] = map[string]interface{}{
+					"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True", "observedGeneration": obj.GetGeneration()}},
+				}
+				client.Tracker().Update(widgetResource, obj, "default")
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	ret, err := provider.Apply(context.Background(), deployment, step, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["widgets"].Status)
+	assert.Equal(t, "Widget/default/a: ready", ret["widgets"].Message)
+
+	// a new generation is not ready until the controller observes it
+	component.Properties[crdResources] = widget("a", 2)
+	component.Properties[crdTimeout] = "200ms"
+	ret, err = provider.Apply(context.Background(), deployment, step, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.UpdateFailed, ret["widgets"].Status)
+	assert.True(t, strings.HasSuffix(ret["widgets"].Message, "Widget/default/a: not ready, condition Ready is not observed yet"), ret["widgets"].Message)
+
+	// a failed value fails the component without waiting for the timeout
+	obj, err := getWidget(t, client, "default", "a")
+	assert.Nil(t, err)
+	obj.Object["status"] = map[string]interface{}{"phase": "Failed"}
+	client.Tracker().Update(widgetResource, obj, "default")
+	component.Properties[crdTimeout] = "1m"
+	component.Properties[crdReadiness] = []interface{}{map[string]interface{}{"jsonPath": "{.status.phase}", "values": []interface{}{"Running"}, "failedValues": []interface{}{"Failed"}}}
+	start := time.Now()
+	ret, err = provider.Apply(context.Background(), deployment, step, false)
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.True(t, strings.HasSuffix(ret["widgets"].Message, "Widget/default/a: failed, {.status.phase} is Failed"), ret["widgets"].Message)
+}
+
+// lateMapper doesn't know widgets until it is reset, like a mapper that was cached before the
+// definition of widgets was applied
+type lateMapper struct {
+	*meta.DefaultRESTMapper
+	lock  sync.Mutex
+	known bool
+}
+
+func (m *lateMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	m.lock.Lock()
+	known := m.known
+	m.lock.Unlock()
+	if gk == widgetKind.GroupKind() && !known {
+		return nil, &meta.NoKindMatchError{GroupKind: gk, SearchedVersions: versions}
+	}
+	return m.DefaultRESTMapper.RESTMapping(gk, versions...)
+}
+
+func (m *lateMapper) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.known = true
+}
+
+func TestCRDTargetProviderWaitsForKind(t *testing.T) {
+	mapper := &lateMapper{DefaultRESTMapper: newMapper()}
+	provider, client, _ := createTestProvider(t, mapper)
+	component := model.ComponentSpec{
+		Name: "widgets",
+		Properties: map[string]interface{}{
+			crdResources: []interface{}{
+				widget("a", 1),
+				map[string]interface{}{
+					"apiVersion": "apiextensions.k8s.io/v1",
+					"kind":       "CustomResourceDefinition",
+					"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+				},
+			},
+		},
+	}
+	ret, err := provider.Apply(context.Background(), testDeployment(""), model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "CustomResourceDefinition/widgets.example.com: ready; Widget/default/a: ready", ret["widgets"].Message)
+	_, err = getWidget(t, client, "default", "a")
+	assert.Nil(t, err)
+}
+
+func TestObjectRefSameObject(t *testing.T) {
+	ref := objectRef{APIVersion: "example.com/v1beta1", Kind: "Widget", Namespace: "widgets", Name: "a"}
+	// an object keeps its identity when its version changes, so it isn't pruned
+	moved := ref
+	moved.APIVersion = "example.com/v1"
+	assert.True(t, ref.sameObject(moved))
+	assert.True(t, containsRef([]objectRef{moved}, ref))
+	assert.Equal(t, []objectRef{moved}, mergeRefs([]objectRef{ref}, []objectRef{moved}))
+
+	other := ref
+	other.APIVersion = "other.example.com/v1beta1"
+	assert.False(t, ref.sameObject(other))
+	other = ref
+	other.Namespace = "gadgets"
+	assert.False(t, ref.sameObject(other))
+	assert.True(t, objectRef{APIVersion: "v1", Kind: "ConfigMap", Name: "c"}.sameObject(objectRef{APIVersion: "v1", Kind: "ConfigMap", Name: "c"}))
+}
+
+func TestInventoryName(t *testing.T) {
+	named := func(name string) model.DeploymentSpec {
+		deployment := testDeployment("widgets")
+		deployment.Instance.ObjectMeta.Name = name
+		return deployment
+	}
+	// the sanitized names of both pairs are the same
+	a := inventoryName(named("a-b"), "c")
+	b := inventoryName(named("a"), "b-c")
+	assert.NotEqual(t, a, b)
+	assert.True(t, strings.HasPrefix(a, "symphony-crd-a-b-c-"))
+	assert.Equal(t, a, inventoryName(named("a-b"), "c"))
+
+	long := inventoryName(named(strings.Repeat("x", 300)), "c")
+	assert.Equal(t, 253, len(long))
+	assert.NotEqual(t, long, inventoryName(named(strings.Repeat("x", 300)), "d"))
+}
+
+func TestConformanceSuite(t *testing.T) {
+	provider, _, _ := createTestProvider(t, newMapper())
+	conformance.ConformanceSuite(t, provider)
+}
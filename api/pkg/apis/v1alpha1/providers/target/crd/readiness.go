@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package crd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ReadinessCheck describes when the objects it selects are ready. An object is selected when it
+// matches the apiVersion, kind and name of the check, an empty field matches any object.
+type ReadinessCheck struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// Condition is the type of a status condition, such as Ready
+	Condition string `json:"condition,omitempty"`
+	// Status is the expected status of the condition, default is True
+	Status string `json:"status,omitempty"`
+	// JSONPath is a kubectl JSONPath expression, such as {.status.phase}
+	JSONPath string `json:"jsonPath,omitempty"`
+	// Values are the values of the expression that make the object ready. Without values, any
+	// non-empty value makes the object ready.
+	Values []string `json:"values,omitempty"`
+	// FailedValues are the values of the expression that make the object fail
+	FailedValues []string `json:"failedValues,omitempty"`
+
+	path *jsonpath.JSONPath
+}
+
+// objectStatus is the readiness of an object
+type objectStatus struct {
+	Ready  bool
+	Failed bool
+	Reason string
+}
+
+// compile validates a check and parses its expression
+func (c *ReadinessCheck) compile() error {
+	if (c.Condition == "") == (c.JSONPath == "") {
+		return fmt.Errorf("a readiness check needs either a condition or a jsonPath")
+	}
+	if c.Condition != "" {
+		if len(c.Values) > 0 || len(c.FailedValues) > 0 {
+			return fmt.Errorf("values and failedValues can only be used with a jsonPath")
+		}
+		if c.Status == "" {
+			c.Status = "True"
+		}
+		return nil
+	}
+	expression := strings.TrimSpace(c.JSONPath)
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	c.path = jsonpath.New("readiness").AllowMissingKeys(true)
+	if err := c.path.Parse(expression); err != nil {
+		return fmt.Errorf("invalid jsonPath '%s': %v", c.JSONPath, err)
+	}
+	return nil
+}
+
+func (c *ReadinessCheck) matches(obj *unstructured.Unstructured) bool {
+	return (c.APIVersion == "" || c.APIVersion == obj.GetAPIVersion()) &&
+		(c.Kind == "" || c.Kind == obj.GetKind()) &&
+		(c.Name == "" || c.Name == obj.GetName())
+}
+
+func (c *ReadinessCheck) evaluate(obj *unstructured.Unstructured) objectStatus {
+	if c.Condition != "" {
+		return c.evaluateCondition(obj)
+	}
+	return c.evaluateJSONPath(obj)
+}
+
+func (c *ReadinessCheck) evaluateCondition(obj *unstructured.Unstructured) objectStatus {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok || fmt.Sprintf("%v", condition["type"]) != c.Condition {
+			continue
+		}
+		if generation, ok := condition["observedGeneration"]; ok && toInt64(generation) < obj.GetGeneration() {
+			return objectStatus{Reason: fmt.Sprintf("condition %s is not observed yet", c.Condition)}
+		}
+		status := fmt.Sprintf("%v", condition["status"])
+		if strings.EqualFold(status, c.Status) {
+			return objectStatus{Ready: true}
+		}
+		reason := fmt.Sprintf("condition %s is %s", c.Condition, status)
+		if message, ok := condition["message"]; ok && message != "" {
+			reason = fmt.Sprintf("%s: %v", reason, message)
+		}
+		return objectStatus{Reason: reason}
+	}
+	return objectStatus{Reason: fmt.Sprintf("condition %s is not reported", c.Condition)}
+}
+
+func (c *ReadinessCheck) evaluateJSONPath(obj *unstructured.Unstructured) objectStatus {
+	var values []string
+	results, err := c.path.FindResults(obj.Object)
+	if err != nil {
+		return objectStatus{Reason: fmt.Sprintf("%s can't be read: %v", c.JSONPath, err)}
+	}
+	for _, result := range results {
+		for _, value := range result {
+			var buf bytes.Buffer
+			if err = c.path.PrintResults(&buf, []reflect.Value{value}); err == nil && buf.Len() > 0 {
+				values = append(values, buf.String())
+			}
+		}
+	}
+	for _, value := range values {
+		if contains(c.FailedValues, value) {
+			return objectStatus{Failed: true, Reason: fmt.Sprintf("%s is %s", c.JSONPath, value)}
+		}
+	}
+	for _, value := range values {
+		if len(c.Values) == 0 || contains(c.Values, value) {
+			return objectStatus{Ready: true}
+		}
+	}
+	if len(values) == 0 {
+		return objectStatus{Reason: fmt.Sprintf("%s is not reported", c.JSONPath)}
+	}
+	return objectStatus{Reason: fmt.Sprintf("%s is %s", c.JSONPath, strings.Join(values, ","))}
+}
+
+// evaluateReadiness evaluates the checks that select an object. An object without checks is ready
+// once it is applied. An object that reports the generation of its status is not ready until the
+// status is of the applied generation.
+func evaluateReadiness(obj *unstructured.Unstructured, checks []ReadinessCheck) objectStatus {
+	selected := false
+	for n := range checks {
+		if !checks[n].matches(obj) {
+			continue
+		}
+		if !selected {
+			selected = true
+			if generation, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "status", "observedGeneration"); ok && toInt64(generation) < obj.GetGeneration() {
+				return objectStatus{Reason: "status is not observed yet"}
+			}
+		}
+		status := checks[n].evaluate(obj)
+		if !status.Ready {
+			return status
+		}
+	}
+	return objectStatus{Ready: true}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
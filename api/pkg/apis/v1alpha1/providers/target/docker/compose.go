@@ -0,0 +1,731 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// composeComponentType is the type of components that deploy a compose project
+	composeComponentType = "docker-compose"
+	composeDocument      = "compose.document"
+	composeFile          = "compose.file"
+	composeProjectName   = "compose.project"
+	composeServices      = "compose.services"
+
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeHashLabel    = "symphony.compose.hash"
+	composeCountLabel   = "symphony.compose.services"
+)
+
+var composeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// composeProject is the subset of the compose file format the docker provider deploys
+type composeProject struct {
+	Name     string                     `json:"name,omitempty"`
+	Services map[string]composeService  `json:"services"`
+	Networks map[string]*composeNetwork `json:"networks,omitempty"`
+	Volumes  map[string]*composeVolume  `json:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image       string              `json:"image"`
+	Command     composeCommand      `json:"command,omitempty"`
+	Entrypoint  composeCommand      `json:"entrypoint,omitempty"`
+	Environment composeMap          `json:"environment,omitempty"`
+	Labels      composeMap          `json:"labels,omitempty"`
+	Ports       composeStrings      `json:"ports,omitempty"`
+	Volumes     composeStrings      `json:"volumes,omitempty"`
+	Devices     composeStrings      `json:"devices,omitempty"`
+	Networks    composeNetworks     `json:"networks,omitempty"`
+	DependsOn   composeDependencies `json:"depends_on,omitempty"`
+	Restart     string              `json:"restart,omitempty"`
+	Healthcheck *composeHealthcheck `json:"healthcheck,omitempty"`
+	WorkingDir  string              `json:"working_dir,omitempty"`
+	User        string              `json:"user,omitempty"`
+}
+
+type composeNetwork struct {
+	Name     string `json:"name,omitempty"`
+	Driver   string `json:"driver,omitempty"`
+	External bool   `json:"external,omitempty"`
+}
+
+type composeVolume struct {
+	Name     string `json:"name,omitempty"`
+	External bool   `json:"external,omitempty"`
+}
+
+type composeHealthcheck struct {
+	Test        composeStrings `json:"test,omitempty"`
+	Interval    string         `json:"interval,omitempty"`
+	Timeout     string         `json:"timeout,omitempty"`
+	StartPeriod string         `json:"start_period,omitempty"`
+	Retries     int            `json:"retries,omitempty"`
+	Disable     bool           `json:"disable,omitempty"`
+}
+
+// composeCommand is a command given as a list or as a string of words
+type composeCommand []string
+
+func (c *composeCommand) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = strings.Fields(s)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings")
+	}
+	*c = list
+	return nil
+}
+
+// composeStrings is a string or a list of strings and numbers
+type composeStrings []string
+
+func (c *composeStrings) UnmarshalJSON(data []byte) error {
+	var items []interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		var s string
+		if err = json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("expected a string or a list")
+		}
+		*c = []string{s}
+		return nil
+	}
+	ret := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			ret = append(ret, v)
+		case float64:
+			ret = append(ret, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("expected strings, found %v", item)
+		}
+	}
+	*c = ret
+	return nil
+}
+
+// composeMap is a map or a list of key=value items
+type composeMap map[string]string
+
+func (c *composeMap) UnmarshalJSON(data []byte) error {
+	ret := make(map[string]string)
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, item := range list {
+			if k, v, ok := strings.Cut(item, "="); ok {
+				ret[k] = v
+			}
+		}
+		*c = ret
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("expected a map or a list of key=value items")
+	}
+	for k, v := range m {
+		switch value := v.(type) {
+		case nil:
+			ret[k] = ""
+		case string:
+			ret[k] = value
+		default:
+			ret[k] = strings.Trim(string(mustMarshal(value)), `"`)
+		}
+	}
+	*c = ret
+	return nil
+}
+
+// composeNetworks is a list of network names or a map of networks with aliases
+type composeNetworks map[string][]string
+
+func (c *composeNetworks) UnmarshalJSON(data []byte) error {
+	ret := make(map[string][]string)
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, name := range list {
+			ret[name] = nil
+		}
+		*c = ret
+		return nil
+	}
+	var m map[string]*struct {
+		Aliases []string `json:"aliases,omitempty"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("expected a list of names or a map of networks")
+	}
+	for name, settings := range m {
+		if settings != nil {
+			ret[name] = settings.Aliases
+		} else {
+			ret[name] = nil
+		}
+	}
+	*c = ret
+	return nil
+}
+
+// composeDependencies is a list of service names or a map keyed by service names
+type composeDependencies []string
+
+func (c *composeDependencies) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*c = list
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("expected a list of services or a map of services")
+	}
+	ret := make([]string, 0, len(m))
+	for name := range m {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	*c = ret
+	return nil
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// composeDeployment is a compose project read from a component
+type composeDeployment struct {
+	Project *composeProject
+	// Name is the project name, which prefixes the names of containers, networks and volumes
+	Name string
+	// Hash identifies the document the project is read from
+	Hash string
+	// Dir is the directory relative bind mounts are resolved against, empty for inline documents
+	Dir string
+	// Order is the order services are started in, dependencies first
+	Order []string
+}
+
+// readComposeDocument reads the compose document of a component, inline or from a file
+func readComposeDocument(properties map[string]interface{}, injections *model.ValueInjections) (string, string, error) {
+	document := readJSONProperty(properties, composeDocument, injections)
+	file := readJSONProperty(properties, composeFile, injections)
+	if document != "" && file != "" {
+		return "", "", fmt.Errorf("only one of %s and %s can be set", composeDocument, composeFile)
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read compose file %s: %s", file, err.Error())
+		}
+		return string(data), filepath.Dir(file), nil
+	}
+	if document == "" {
+		return "", "", fmt.Errorf("component doesn't have %s or %s property", composeDocument, composeFile)
+	}
+	return document, "", nil
+}
+
+// composeHash returns the hash of a compose document, independent of its formatting
+func composeHash(document string) (string, error) {
+	data, err := yaml.YAMLToJSON([]byte(document))
+	if err != nil {
+		return "", err
+	}
+	var normalized interface{}
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(mustMarshal(normalized))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readComposeDeployment reads and checks the compose project of a component
+func readComposeDeployment(component model.ComponentSpec, injections *model.ValueInjections) (composeDeployment, error) {
+	ret := composeDeployment{}
+	document, dir, err := readComposeDocument(component.Properties, injections)
+	if err != nil {
+		return ret, v1alpha2.NewCOAError(err, err.Error(), v1alpha2.BadRequest)
+	}
+	ret.Dir = dir
+	if ret.Hash, err = composeHash(document); err != nil {
+		return ret, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid compose document of %s: %s", component.Name, err.Error()), v1alpha2.BadRequest)
+	}
+	data, _ := yaml.YAMLToJSON([]byte(document))
+	var project composeProject
+	if err = json.Unmarshal(data, &project); err != nil {
+		return ret, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid compose document of %s: %s", component.Name, err.Error()), v1alpha2.BadRequest)
+	}
+	ret.Project = &project
+	ret.Name = composeName(component, project.Name)
+	if !composeNamePattern.MatchString(ret.Name) {
+		return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid compose project name '%s', expected lowercase letters, digits, dashes and underscores", ret.Name), v1alpha2.BadRequest)
+	}
+	if len(project.Services) == 0 {
+		return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("compose document of %s has no services", component.Name), v1alpha2.BadRequest)
+	}
+	for name, service := range project.Services {
+		if service.Image == "" {
+			return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("compose service %s doesn't have an image, building images isn't supported", name), v1alpha2.BadRequest)
+		}
+		for network := range service.Networks {
+			if _, ok := project.Networks[network]; !ok && network != "default" {
+				return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("compose service %s uses undefined network %s", name, network), v1alpha2.BadRequest)
+			}
+		}
+		if _, err = ret.containerConfigs(name); err != nil {
+			return ret, v1alpha2.NewCOAError(err, err.Error(), v1alpha2.BadRequest)
+		}
+	}
+	if ret.Order, err = composeOrder(project.Services); err != nil {
+		return ret, v1alpha2.NewCOAError(err, err.Error(), v1alpha2.BadRequest)
+	}
+	return ret, nil
+}
+
+// composeName returns the project name of a component: the compose.project property, the name
+// in the document or the component name
+func composeName(component model.ComponentSpec, documentName string) string {
+	if name := readJSONProperty(component.Properties, composeProjectName, nil); name != "" {
+		return name
+	}
+	if documentName != "" {
+		return documentName
+	}
+	return strings.ToLower(component.Name)
+}
+
+// composeProjectOf returns the project name of a component, also when its document can't be read
+func composeProjectOf(component model.ComponentSpec) string {
+	if d, err := readComposeDeployment(component, nil); err == nil {
+		return d.Name
+	}
+	return composeName(component, "")
+}
+
+// composeOrder sorts services so that services start after the services they depend on
+func composeOrder(services map[string]composeService) ([]string, error) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]string, 0, len(names))
+	state := make(map[string]int) // 1: visiting, 2: done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("compose services have circular dependencies: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dependency := range services[name].DependsOn {
+			if _, ok := services[dependency]; !ok {
+				return fmt.Errorf("compose service %s depends on undefined service %s", name, dependency)
+			}
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ret = append(ret, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (d composeDeployment) networkName(name string) string {
+	if n, ok := d.Project.Networks[name]; ok && n != nil {
+		if n.Name != "" {
+			return n.Name
+		}
+		if n.External {
+			return name
+		}
+	}
+	return d.Name + "_" + name
+}
+
+func (d composeDeployment) volumeName(name string) string {
+	if v, ok := d.Project.Volumes[name]; ok && v != nil {
+		if v.Name != "" {
+			return v.Name
+		}
+		if v.External {
+			return name
+		}
+	}
+	return d.Name + "_" + name
+}
+
+// serviceNetworks returns the networks of a service, services are reachable by their names on
+// all their networks
+func (d composeDeployment) serviceNetworks(service string) []containerNetwork {
+	networks := d.Project.Services[service].Networks
+	if len(networks) == 0 {
+		networks = composeNetworks{"default": nil}
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]containerNetwork, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, containerNetwork{Name: d.networkName(name), Aliases: append([]string{service}, networks[name]...)})
+	}
+	return ret
+}
+
+// containerName returns the container name of a service
+func (d composeDeployment) containerName(service string) string {
+	return d.Name + "-" + service + "-1"
+}
+
+// containerConfigs returns the settings of the container of a service
+func (d composeDeployment) containerConfigs(service string) (containerOptions, error) {
+	s := d.Project.Services[service]
+	options := containerOptions{
+		Networks: d.serviceNetworks(service),
+		Labels: map[string]string{
+			composeProjectLabel: d.Name,
+			composeServiceLabel: service,
+			composeHashLabel:    d.Hash,
+			composeCountLabel:   strconv.Itoa(len(d.Project.Services)),
+		},
+	}
+	for k, v := range s.Labels {
+		options.Labels[k] = v
+	}
+	var err error
+	if s.Restart != "" {
+		var policy container.RestartPolicy
+		if policy, err = parseRestartPolicy(s.Restart); err != nil {
+			return options, fmt.Errorf("compose service %s: %s", service, err.Error())
+		}
+		options.RestartPolicy = &policy
+	}
+	if s.Healthcheck != nil {
+		if options.Healthcheck, err = s.Healthcheck.toHealthConfig(); err != nil {
+			return options, fmt.Errorf("compose service %s: %s", service, err.Error())
+		}
+	}
+	if len(s.Devices) > 0 {
+		if options.Devices, err = parseDevices(string(mustMarshal(s.Devices))); err != nil {
+			return options, fmt.Errorf("compose service %s: %s", service, err.Error())
+		}
+	}
+	if _, _, err = nat.ParsePortSpecs(s.Ports); err != nil {
+		return options, fmt.Errorf("compose service %s has invalid ports: %s", service, err.Error())
+	}
+	if _, _, err = d.volumeBinds(service); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// volumeBinds returns the bind mounts and anonymous volumes of a service
+func (d composeDeployment) volumeBinds(service string) ([]string, map[string]struct{}, error) {
+	binds := make([]string, 0)
+	volumes := make(map[string]struct{})
+	for _, v := range d.Project.Services[service].Volumes {
+		parts := strings.Split(v, ":")
+		if len(parts) == 1 {
+			volumes[parts[0]] = struct{}{}
+			continue
+		}
+		if len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, fmt.Errorf("compose service %s has invalid volume '%s'", service, v)
+		}
+		source := parts[0]
+		switch {
+		case strings.HasPrefix(source, "/"):
+		case strings.HasPrefix(source, "."):
+			if d.Dir == "" {
+				return nil, nil, fmt.Errorf("compose service %s has relative volume '%s', which needs %s", service, v, composeFile)
+			}
+			source = filepath.Join(d.Dir, source)
+		default:
+			source = d.volumeName(source)
+		}
+		parts[0] = source
+		binds = append(binds, strings.Join(parts, ":"))
+	}
+	return binds, volumes, nil
+}
+
+func (h *composeHealthcheck) toHealthConfig() (*container.HealthConfig, error) {
+	if h.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+	spec := containerHealthcheckSpec{
+		Test:        h.Test,
+		Interval:    h.Interval,
+		Timeout:     h.Timeout,
+		StartPeriod: h.StartPeriod,
+		Retries:     h.Retries,
+	}
+	// a test given as a string runs in a shell
+	if len(spec.Test) == 1 && spec.Test[0] != "NONE" {
+		spec.Test = []string{"CMD-SHELL", spec.Test[0]}
+	}
+	return parseHealthcheck(string(mustMarshal(spec)))
+}
+
+// applyCompose creates the networks and containers of a compose project. Containers of an
+// earlier deployment of the project are removed first.
+func (i *DockerTargetProvider) applyCompose(ctx context.Context, cli *client.Client, deployment model.DeploymentSpec, component model.ComponentSpec, d composeDeployment) error {
+	pullOptions := image.PullOptions{}
+	if secret := readJSONProperty(component.Properties, containerRegistrySecret, nil); secret != "" {
+		auth, err := registryAuth(ctx, i.Context, secret, deployment.Instance.ObjectMeta.Namespace)
+		if err != nil {
+			return err
+		}
+		pullOptions.RegistryAuth = auth
+	}
+	for _, service := range d.Order {
+		reader, err := cli.ImagePull(ctx, d.Project.Services[service].Image, pullOptions)
+		if err != nil {
+			return fmt.Errorf("failed to pull image of compose service %s: %s", service, err.Error())
+		}
+		io.Copy(os.Stdout, reader)
+		reader.Close()
+	}
+
+	if err := removeComposeContainers(ctx, cli, d.Name); err != nil {
+		return err
+	}
+	if err := ensureComposeNetworks(ctx, cli, d); err != nil {
+		return err
+	}
+
+	for _, service := range d.Order {
+		s := d.Project.Services[service]
+		options, _ := d.containerConfigs(service)
+		binds, volumes, _ := d.volumeBinds(service)
+		exposedPorts, portBindings, _ := nat.ParsePortSpecs(s.Ports)
+		env := make([]string, 0, len(s.Environment))
+		for k, v := range s.Environment {
+			env = append(env, k+"="+v)
+		}
+		sort.Strings(env)
+		containerConfig := container.Config{
+			Image:        s.Image,
+			Env:          env,
+			Cmd:          []string(s.Command),
+			Entrypoint:   []string(s.Entrypoint),
+			WorkingDir:   s.WorkingDir,
+			User:         s.User,
+			ExposedPorts: exposedPorts,
+		}
+		if len(volumes) > 0 {
+			containerConfig.Volumes = volumes
+		}
+		hostConfig := container.HostConfig{
+			Binds:        binds,
+			PortBindings: portBindings,
+		}
+		networkingConfig := options.apply(&containerConfig, &hostConfig)
+
+		name := d.containerName(service)
+		sLog.InfofCtx(ctx, "  P (Docker Target): create container %s of compose project %s", name, d.Name)
+		response, err := cli.ContainerCreate(ctx, &containerConfig, &hostConfig, networkingConfig, nil, name)
+		if err != nil {
+			return fmt.Errorf("failed to create container of compose service %s: %s", service, err.Error())
+		}
+		for n := 1; n < len(options.Networks); n++ {
+			err = cli.NetworkConnect(ctx, options.Networks[n].Name, response.ID, &network.EndpointSettings{Aliases: options.Networks[n].Aliases})
+			if err != nil {
+				return fmt.Errorf("failed to connect compose service %s to network %s: %s", service, options.Networks[n].Name, err.Error())
+			}
+		}
+		if err = cli.ContainerStart(ctx, response.ID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("failed to start container of compose service %s: %s", service, err.Error())
+		}
+	}
+	return nil
+}
+
+// ensureComposeNetworks creates the networks of a compose project that don't exist yet
+func ensureComposeNetworks(ctx context.Context, cli *client.Client, d composeDeployment) error {
+	created := make(map[string]bool)
+	for _, service := range d.Order {
+		for _, n := range d.serviceNetworks(service) {
+			if created[n.Name] {
+				continue
+			}
+			created[n.Name] = true
+			_, err := cli.NetworkInspect(ctx, n.Name, network.InspectOptions{})
+			if err == nil {
+				continue
+			}
+			if !client.IsErrNotFound(err) {
+				return err
+			}
+			driver := "bridge"
+			for key, settings := range d.Project.Networks {
+				if d.networkName(key) == n.Name && settings != nil {
+					if settings.External {
+						return fmt.Errorf("external network %s of compose project %s is not found", n.Name, d.Name)
+					}
+					if settings.Driver != "" {
+						driver = settings.Driver
+					}
+				}
+			}
+			sLog.InfofCtx(ctx, "  P (Docker Target): create network %s of compose project %s", n.Name, d.Name)
+			_, err = cli.NetworkCreate(ctx, n.Name, network.CreateOptions{
+				Driver: driver,
+				Labels: map[string]string{composeProjectLabel: d.Name},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create network %s of compose project %s: %s", n.Name, d.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func listComposeContainers(ctx context.Context, cli *client.Client, project string) ([]types.Container, error) {
+	return cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel+"="+project)),
+	})
+}
+
+func removeComposeContainers(ctx context.Context, cli *client.Client, project string) error {
+	containers, err := listComposeContainers(ctx, cli, project)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		sLog.InfofCtx(ctx, "  P (Docker Target): remove container %s of compose project %s", c.ID, project)
+		if err = cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCompose removes the containers and networks of a compose project. Volumes are kept.
+func removeCompose(ctx context.Context, cli *client.Client, project string) error {
+	if err := removeComposeContainers(ctx, cli, project); err != nil {
+		return err
+	}
+	networks, err := cli.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel+"="+project)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		sLog.InfofCtx(ctx, "  P (Docker Target): remove network %s of compose project %s", n.Name, project)
+		if err = cli.NetworkRemove(ctx, n.ID); err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// getCompose reports a compose project as one component. The compose document property is
+// reported as the hash of the deployed document, which is empty when containers are missing.
+func getCompose(ctx context.Context, cli *client.Client, reference model.ComponentSpec) (*model.ComponentSpec, error) {
+	containers, err := listComposeContainers(ctx, cli, composeProjectOf(reference))
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+	return composeComponent(reference, containers), nil
+}
+
+func composeComponent(reference model.ComponentSpec, containers []types.Container) *model.ComponentSpec {
+	hash := containers[0].Labels[composeHashLabel]
+	services := make(map[string]string, len(containers))
+	for _, c := range containers {
+		if c.Labels[composeHashLabel] != hash {
+			hash = ""
+		}
+		services[c.Labels[composeServiceLabel]] = c.State
+	}
+	if strconv.Itoa(len(containers)) != containers[0].Labels[composeCountLabel] {
+		hash = ""
+	}
+	key := composeDocument
+	if _, ok := reference.Properties[composeFile]; ok {
+		key = composeFile
+	}
+	return &model.ComponentSpec{
+		Name: reference.Name,
+		Type: composeComponentType,
+		Properties: map[string]interface{}{
+			key:             hash,
+			composeServices: string(mustMarshal(services)),
+		},
+	}
+}
+
+// composeChanged compares the hash of a deployed compose document with a desired document
+func composeChanged(fromFile bool) func(oldProp, newProp any) bool {
+	return func(oldProp, newProp any) bool {
+		document := readJSONProperty(map[string]interface{}{"v": newProp}, "v", nil)
+		if document == "" {
+			return false
+		}
+		if fromFile {
+			data, err := os.ReadFile(document)
+			if err != nil {
+				return true
+			}
+			document = string(data)
+		}
+		hash, err := composeHash(document)
+		if err != nil {
+			return true
+		}
+		return fmt.Sprintf("%v", oldProp) != hash
+	}
+}
@@ -0,0 +1,459 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+)
+
+const (
+	containerNetworks       = "container.networks"
+	containerRestartPolicy  = "container.restartPolicy"
+	containerHealthcheck    = "container.healthcheck"
+	containerLabels         = "container.labels"
+	containerLogDriver      = "container.logDriver"
+	containerLogOptions     = "container.logOptions"
+	containerDevices        = "container.devices"
+	containerRegistrySecret = "container.registrySecret"
+)
+
+// containerNetwork is a user-defined network a container joins
+type containerNetwork struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// containerHealthcheckSpec is the healthcheck of a container, with durations such as "30s"
+type containerHealthcheckSpec struct {
+	Test        []string `json:"test"`
+	Interval    string   `json:"interval,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+	StartPeriod string   `json:"startPeriod,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+}
+
+// containerOptions are the optional container settings of a component
+type containerOptions struct {
+	Networks       []containerNetwork
+	RestartPolicy  *container.RestartPolicy
+	Healthcheck    *container.HealthConfig
+	Labels         map[string]string
+	LogConfig      *container.LogConfig
+	Devices        []container.DeviceMapping
+	RegistrySecret string
+}
+
+// readContainerOptions reads the optional container settings of a component
+func readContainerOptions(properties map[string]interface{}, injections *model.ValueInjections) (containerOptions, error) {
+	ret := containerOptions{}
+	var err error
+	if v := readJSONProperty(properties, containerNetworks, injections); v != "" {
+		if ret.Networks, err = parseContainerNetworks(v); err != nil {
+			return ret, err
+		}
+	}
+	if v := readJSONProperty(properties, containerRestartPolicy, injections); v != "" {
+		var policy container.RestartPolicy
+		if policy, err = parseRestartPolicy(v); err != nil {
+			return ret, err
+		}
+		ret.RestartPolicy = &policy
+	}
+	if v := readJSONProperty(properties, containerHealthcheck, injections); v != "" {
+		if ret.Healthcheck, err = parseHealthcheck(v); err != nil {
+			return ret, err
+		}
+	}
+	if v := readJSONProperty(properties, containerLabels, injections); v != "" {
+		if ret.Labels, err = parseStringMap(containerLabels, v); err != nil {
+			return ret, err
+		}
+	}
+	logDriver := readJSONProperty(properties, containerLogDriver, injections)
+	logOptions := readJSONProperty(properties, containerLogOptions, injections)
+	if logDriver != "" || logOptions != "" {
+		ret.LogConfig = &container.LogConfig{Type: logDriver}
+		if logOptions != "" {
+			if ret.LogConfig.Config, err = parseStringMap(containerLogOptions, logOptions); err != nil {
+				return ret, err
+			}
+		}
+	}
+	if v := readJSONProperty(properties, containerDevices, injections); v != "" {
+		if ret.Devices, err = parseDevices(v); err != nil {
+			return ret, err
+		}
+	}
+	ret.RegistrySecret = readJSONProperty(properties, containerRegistrySecret, injections)
+	return ret, nil
+}
+
+// apply sets the options on the configurations of a new container
+func (o containerOptions) apply(containerConfig *container.Config, hostConfig *container.HostConfig) *network.NetworkingConfig {
+	if o.Healthcheck != nil {
+		containerConfig.Healthcheck = o.Healthcheck
+	}
+	if len(o.Labels) > 0 {
+		containerConfig.Labels = o.Labels
+	}
+	if o.RestartPolicy != nil {
+		hostConfig.RestartPolicy = *o.RestartPolicy
+	}
+	if o.LogConfig != nil {
+		hostConfig.LogConfig = *o.LogConfig
+	}
+	if len(o.Devices) > 0 {
+		hostConfig.Resources.Devices = append(hostConfig.Resources.Devices, o.Devices...)
+	}
+	if len(o.Networks) == 0 {
+		return nil
+	}
+	// containers are created on the first network and connected to the others before they start
+	hostConfig.NetworkMode = container.NetworkMode(o.Networks[0].Name)
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			o.Networks[0].Name: {Aliases: o.Networks[0].Aliases},
+		},
+	}
+}
+
+// ensureNetworks creates the networks that don't exist yet, with the bridge driver
+func ensureNetworks(ctx context.Context, cli *client.Client, networks []containerNetwork) error {
+	for _, n := range networks {
+		_, err := cli.NetworkInspect(ctx, n.Name, network.InspectOptions{})
+		if err == nil {
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return err
+		}
+		sLog.InfofCtx(ctx, "  P (Docker Target): create network: %s", n.Name)
+		if _, err = cli.NetworkCreate(ctx, n.Name, network.CreateOptions{Driver: "bridge"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJSONProperty reads a property as a string, values that aren't strings are read as JSON
+func readJSONProperty(properties map[string]interface{}, key string, injections *model.ValueInjections) string {
+	v, ok := properties[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return strings.TrimSpace(model.ResolveString(s, injections))
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return model.ResolveString(string(data), injections)
+}
+
+// parseContainerNetworks reads a list of network names or of objects with a name and aliases
+func parseContainerNetworks(value string) ([]containerNetwork, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, fmt.Errorf("invalid %s format, expected a JSON array: %s", containerNetworks, err.Error())
+	}
+	ret := make([]containerNetwork, 0, len(items))
+	for _, item := range items {
+		var n containerNetwork
+		var name string
+		if err := json.Unmarshal(item, &name); err == nil {
+			n.Name = name
+		} else if err := json.Unmarshal(item, &n); err != nil {
+			return nil, fmt.Errorf("invalid %s item %s, expected a name or an object with a name", containerNetworks, string(item))
+		}
+		if n.Name == "" {
+			return nil, fmt.Errorf("invalid %s item %s, network name is empty", containerNetworks, string(item))
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+// parseRestartPolicy reads a restart policy such as "always" or "on-failure:5"
+func parseRestartPolicy(value string) (container.RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(strings.TrimSpace(value), ":")
+	policy := container.RestartPolicy{Name: container.RestartPolicyMode(name)}
+	if hasRetries {
+		count, err := strconv.Atoi(retries)
+		if err != nil {
+			return policy, fmt.Errorf("invalid %s '%s', the maximum retry count is not a number", containerRestartPolicy, value)
+		}
+		policy.MaximumRetryCount = count
+	}
+	if policy.Name == "" {
+		return policy, fmt.Errorf("invalid %s '%s'", containerRestartPolicy, value)
+	}
+	if err := container.ValidateRestartPolicy(policy); err != nil {
+		return policy, fmt.Errorf("invalid %s '%s': %s", containerRestartPolicy, value, err.Error())
+	}
+	return policy, nil
+}
+
+func formatRestartPolicy(policy container.RestartPolicy) string {
+	name := string(policy.Name)
+	if name == "" {
+		name = string(container.RestartPolicyDisabled)
+	}
+	if policy.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", name, policy.MaximumRetryCount)
+	}
+	return name
+}
+
+func parseHealthcheck(value string) (*container.HealthConfig, error) {
+	var spec containerHealthcheckSpec
+	if err := json.Unmarshal([]byte(value), &spec); err != nil {
+		return nil, fmt.Errorf("invalid %s format: %s", containerHealthcheck, err.Error())
+	}
+	if len(spec.Test) == 0 {
+		return nil, fmt.Errorf("invalid %s, test is not set", containerHealthcheck)
+	}
+	ret := &container.HealthConfig{Test: spec.Test, Retries: spec.Retries}
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"interval", spec.Interval, &ret.Interval},
+		{"timeout", spec.Timeout, &ret.Timeout},
+		{"startPeriod", spec.StartPeriod, &ret.StartPeriod},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s '%s'", containerHealthcheck, d.name, d.value)
+		}
+		*d.field = duration
+	}
+	return ret, nil
+}
+
+func formatHealthcheck(config *container.HealthConfig) string {
+	spec := containerHealthcheckSpec{Test: config.Test, Retries: config.Retries}
+	if config.Interval > 0 {
+		spec.Interval = config.Interval.String()
+	}
+	if config.Timeout > 0 {
+		spec.Timeout = config.Timeout.String()
+	}
+	if config.StartPeriod > 0 {
+		spec.StartPeriod = config.StartPeriod.String()
+	}
+	data, _ := json.Marshal(spec)
+	return string(data)
+}
+
+func parseStringMap(key string, value string) (map[string]string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, fmt.Errorf("invalid %s format, expected a JSON object: %s", key, err.Error())
+	}
+	ret := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			ret[k] = s
+		} else {
+			data, _ := json.Marshal(v)
+			ret[k] = string(data)
+		}
+	}
+	return ret, nil
+}
+
+// parseDevices reads a list of devices such as "/dev/ttyUSB0", "/dev/ttyUSB0:/dev/serial" or
+// "/dev/ttyUSB0:/dev/serial:r"
+func parseDevices(value string) ([]container.DeviceMapping, error) {
+	var items []string
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, fmt.Errorf("invalid %s format, expected a JSON array of strings: %s", containerDevices, err.Error())
+	}
+	ret := make([]container.DeviceMapping, 0, len(items))
+	for _, item := range items {
+		parts := strings.Split(item, ":")
+		if parts[0] == "" || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid %s item '%s'", containerDevices, item)
+		}
+		device := container.DeviceMapping{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: "rwm"}
+		if len(parts) > 1 && parts[1] != "" {
+			device.PathInContainer = parts[1]
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			device.CgroupPermissions = parts[2]
+		}
+		ret = append(ret, device)
+	}
+	return ret, nil
+}
+
+func formatDevices(devices []container.DeviceMapping) string {
+	items := make([]string, 0, len(devices))
+	for _, device := range devices {
+		items = append(items, device.PathOnHost+":"+device.PathInContainer+":"+device.CgroupPermissions)
+	}
+	data, _ := json.Marshal(items)
+	return string(data)
+}
+
+// registryAuth reads the credentials of a private registry from the secret provider. The secret
+// has username and password fields, and an optional serveraddress field.
+func registryAuth(ctx context.Context, managerContext *contexts.ManagerContext, secretName string, namespace string) (string, error) {
+	if managerContext == nil || managerContext.VencorContext == nil || managerContext.VencorContext.EvaluationContext == nil ||
+		managerContext.VencorContext.EvaluationContext.SecretProvider == nil {
+		return "", v1alpha2.NewCOAError(nil, fmt.Sprintf("%s is set but no secret provider is configured", containerRegistrySecret), v1alpha2.BadConfig)
+	}
+	evalContext := managerContext.VencorContext.EvaluationContext.Clone()
+	evalContext.Context = ctx
+	evalContext.Namespace = namespace
+	secretProvider := evalContext.SecretProvider
+	auth := registry.AuthConfig{}
+	var err error
+	if auth.Username, err = secretProvider.Get(ctx, secretName, "username", evalContext); err != nil {
+		return "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read registry username from secret %s", secretName), v1alpha2.BadConfig)
+	}
+	if auth.Password, err = secretProvider.Get(ctx, secretName, "password", evalContext); err != nil {
+		return "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read registry password from secret %s", secretName), v1alpha2.BadConfig)
+	}
+	if address, err := secretProvider.Get(ctx, secretName, "serveraddress", evalContext); err == nil {
+		auth.ServerAddress = address
+	}
+	return registry.EncodeAuthConfig(auth)
+}
+
+// reportContainerOptions adds the optional container settings of a running container to a
+// component. Labels are reported only when the reference sets them, as images add labels too.
+func reportContainerOptions(info types.ContainerJSON, reference model.ComponentSpec, component *model.ComponentSpec) {
+	if info.Config != nil {
+		if info.Config.Healthcheck != nil && len(info.Config.Healthcheck.Test) > 0 {
+			component.Properties[containerHealthcheck] = formatHealthcheck(info.Config.Healthcheck)
+		}
+		if desired, err := parseStringMap(containerLabels, readJSONProperty(reference.Properties, containerLabels, nil)); err == nil {
+			labels := make(map[string]string)
+			for k := range desired {
+				if v, ok := info.Config.Labels[k]; ok {
+					labels[k] = v
+				}
+			}
+			data, _ := json.Marshal(labels)
+			component.Properties[containerLabels] = string(data)
+		}
+	}
+	if info.HostConfig != nil {
+		component.Properties[containerRestartPolicy] = formatRestartPolicy(info.HostConfig.RestartPolicy)
+		if info.HostConfig.LogConfig.Type != "" {
+			component.Properties[containerLogDriver] = info.HostConfig.LogConfig.Type
+		}
+		if len(info.HostConfig.LogConfig.Config) > 0 {
+			data, _ := json.Marshal(info.HostConfig.LogConfig.Config)
+			component.Properties[containerLogOptions] = string(data)
+		}
+		if len(info.HostConfig.Devices) > 0 {
+			component.Properties[containerDevices] = formatDevices(info.HostConfig.Devices)
+		}
+	}
+	if info.NetworkSettings != nil && len(info.NetworkSettings.Networks) > 0 {
+		names := make([]string, 0, len(info.NetworkSettings.Networks))
+		for name := range info.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		data, _ := json.Marshal(names)
+		component.Properties[containerNetworks] = string(data)
+	}
+}
+
+// optionChanged compares a reported option with the desired option after normalizing both. An
+// option that isn't set in the desired state is ignored.
+func optionChanged(normalize func(string) (string, bool)) func(oldProp, newProp any) bool {
+	return func(oldProp, newProp any) bool {
+		newValue := readJSONProperty(map[string]interface{}{"v": newProp}, "v", nil)
+		if newValue == "" {
+			return false
+		}
+		oldValue := readJSONProperty(map[string]interface{}{"v": oldProp}, "v", nil)
+		oldNormalized, oldOk := normalize(oldValue)
+		newNormalized, newOk := normalize(newValue)
+		if oldOk && newOk {
+			return oldNormalized != newNormalized
+		}
+		return oldValue != newValue
+	}
+}
+
+func normalizeNetworks(value string) (string, bool) {
+	networks, err := parseContainerNetworks(value)
+	if err != nil {
+		return "", false
+	}
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ","), true
+}
+
+func normalizeRestartPolicy(value string) (string, bool) {
+	policy, err := parseRestartPolicy(value)
+	if err != nil {
+		return "", false
+	}
+	return formatRestartPolicy(policy), true
+}
+
+func normalizeHealthcheck(value string) (string, bool) {
+	config, err := parseHealthcheck(value)
+	if err != nil {
+		return "", false
+	}
+	return formatHealthcheck(config), true
+}
+
+func normalizeStringMap(value string) (string, bool) {
+	m, err := parseStringMap("", value)
+	if err != nil {
+		return "", false
+	}
+	// map keys are sorted when marshalled
+	data, _ := json.Marshal(m)
+	return string(data), true
+}
+
+func normalizeDevices(value string) (string, bool) {
+	devices, err := parseDevices(value)
+	if err != nil {
+		return "", false
+	}
+	items := make([]string, 0, len(devices))
+	for _, device := range devices {
+		items = append(items, device.PathOnHost+":"+device.PathInContainer+":"+device.CgroupPermissions)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ","), true
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
@@ -111,9 +112,21 @@ func (i *DockerTargetProvider) Get(ctx context.Context, deployment model.Deploym
 
 	ret := make([]model.ComponentSpec, 0)
 	for _, component := range references {
+		if component.Component.Type == composeComponentType {
+			var compose *model.ComponentSpec
+			compose, err = getCompose(ctx, cli, component.Component)
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to get compose project info: %+v", err)
+			} else if compose != nil {
+				sLog.InfofCtx(ctx, "  P (Docker Target): append component: %s", compose.Name)
+				ret = append(ret, *compose)
+			}
+			continue
+		}
 		var info types.ContainerJSON
 		info, err = cli.ContainerInspect(ctx, component.Component.Name)
 		if err == nil {
+			reference := component.Component
 			name := info.Name
 			if len(name) > 0 && name[0] == '/' {
 				name = name[1:]
@@ -148,6 +161,7 @@ func (i *DockerTargetProvider) Get(ctx context.Context, deployment model.Deploym
 				volumeData, _ := json.Marshal(info.Mounts)
 				component.Properties["container.volumeMounts"] = string(volumeData)
 			}
+			reportContainerOptions(info, reference, &component)
 			// get environment varibles that are passed in by the reference
 			env := info.Config.Env
 			if len(env) > 0 {
@@ -192,7 +206,19 @@ func (i *DockerTargetProvider) Apply(ctx context.Context, deployment model.Deplo
 		TargetId:   deployment.ActiveTarget,
 	}
 
-	components := step.GetComponents()
+	// compose projects are checked by reading their documents, other components by the validation rule
+	components := make([]model.ComponentSpec, 0)
+	for _, component := range step.Components {
+		if component.Component.Type != composeComponentType {
+			components = append(components, component.Component)
+		} else if component.Action == model.ComponentUpdate {
+			_, err = readComposeDeployment(component.Component, injections)
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to validate compose component %s: %+v", component.Component.Name, err)
+				return nil, err
+			}
+		}
+	}
 	err = i.GetValidationRule(ctx).Validate(components)
 	if err != nil {
 		sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to validate components: %+v", err)
@@ -213,6 +239,42 @@ func (i *DockerTargetProvider) Apply(ctx context.Context, deployment model.Deplo
 	}
 
 	for _, component := range step.Components {
+		if component.Component.Type == composeComponentType {
+			if component.Action == model.ComponentUpdate {
+				var compose composeDeployment
+				compose, err = readComposeDeployment(component.Component, injections)
+				if err == nil {
+					err = i.applyCompose(ctx, cli, deployment, component.Component, compose)
+				}
+				if err != nil {
+					ret[component.Component.Name] = model.ComponentResultSpec{
+						Status:  v1alpha2.UpdateFailed,
+						Message: err.Error(),
+					}
+					sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to apply compose project: %+v", err)
+					return ret, err
+				}
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.Updated,
+					Message: "",
+				}
+			} else {
+				err = removeCompose(ctx, cli, composeProjectOf(component.Component))
+				if err != nil {
+					ret[component.Component.Name] = model.ComponentResultSpec{
+						Status:  v1alpha2.DeleteFailed,
+						Message: err.Error(),
+					}
+					sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to remove compose project: %+v", err)
+					return ret, err
+				}
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.Deleted,
+					Message: "",
+				}
+			}
+			continue
+		}
 		if component.Action == model.ComponentUpdate {
 			containerImage := model.ReadPropertyCompat(component.Component.Properties, model.ContainerImage, injections)
 			resources := model.ReadPropertyCompat(component.Component.Properties, "container.resources", injections)
@@ -226,6 +288,28 @@ func (i *DockerTargetProvider) Apply(ctx context.Context, deployment model.Deplo
 				sLog.ErrorfCtx(ctx, "  P (Docker Target): %+v", err)
 				return ret, err
 			}
+			var options containerOptions
+			options, err = readContainerOptions(component.Component.Properties, injections)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to read container settings: %+v", err)
+				return ret, err
+			}
+			pullOptions := image.PullOptions{}
+			if options.RegistrySecret != "" {
+				pullOptions.RegistryAuth, err = registryAuth(ctx, i.Context, options.RegistrySecret, deployment.Instance.ObjectMeta.Namespace)
+				if err != nil {
+					ret[component.Component.Name] = model.ComponentResultSpec{
+						Status:  v1alpha2.UpdateFailed,
+						Message: err.Error(),
+					}
+					sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to read registry credentials: %+v", err)
+					return ret, err
+				}
+			}
 
 			alreadyRunning := true
 			_, err = cli.ContainerInspect(ctx, component.Component.Name)
@@ -233,7 +317,7 @@ func (i *DockerTargetProvider) Apply(ctx context.Context, deployment model.Deplo
 				alreadyRunning = false
 			}
 
-			reader, err := cli.ImagePull(ctx, containerImage, image.PullOptions{})
+			reader, err := cli.ImagePull(ctx, containerImage, pullOptions)
 			if err != nil {
 				sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to pull docker image: %+v", err)
 				return ret, err
@@ -306,9 +390,21 @@ func (i *DockerTargetProvider) Apply(ctx context.Context, deployment model.Deplo
 				hostConfig.PortBindings = portBindings
 				containerConfig.ExposedPorts = exposedPorts
 			}
+			if hostConfig == nil {
+				hostConfig = &container.HostConfig{}
+			}
+			networkingConfig := options.apply(&containerConfig, hostConfig)
+			if err = ensureNetworks(ctx, cli, options.Networks); err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to create container networks: %+v", err)
+				return ret, err
+			}
 			var containerResponse container.CreateResponse
 			sLog.InfofCtx(ctx, "  P (Docker Target): create container: %s", component.Component.Name)
-			containerResponse, err = cli.ContainerCreate(ctx, &containerConfig, hostConfig, nil, nil, component.Component.Name)
+			containerResponse, err = cli.ContainerCreate(ctx, &containerConfig, hostConfig, networkingConfig, nil, component.Component.Name)
 			if err != nil {
 				ret[component.Component.Name] = model.ComponentResultSpec{
 					Status:  v1alpha2.UpdateFailed,
@@ -317,6 +413,17 @@ func (i *DockerTargetProvider) Apply(ctx context.Context, deployment model.Deplo
 				sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to create container: %+v", err)
 				return ret, err
 			}
+			for n := 1; n < len(options.Networks); n++ {
+				err = cli.NetworkConnect(ctx, options.Networks[n].Name, containerResponse.ID, &network.EndpointSettings{Aliases: options.Networks[n].Aliases})
+				if err != nil {
+					ret[component.Component.Name] = model.ComponentResultSpec{
+						Status:  v1alpha2.UpdateFailed,
+						Message: err.Error(),
+					}
+					sLog.ErrorfCtx(ctx, "  P (Docker Target): failed to connect container to network %s: %+v", options.Networks[n].Name, err)
+					return ret, err
+				}
+			}
 
 			sLog.InfofCtx(ctx, "  P (Docker Target): start container: %s", component.Component.Name)
 			if err = cli.ContainerStart(ctx, containerResponse.ID, container.StartOptions{}); err != nil {
@@ -365,7 +472,9 @@ func (*DockerTargetProvider) GetValidationRule(ctx context.Context) model.Valida
 		AllowSidecar: false,
 		ComponentValidationRule: model.ComponentValidationRule{
 			RequiredProperties:    []string{model.ContainerImage},
-			OptionalProperties:    []string{"container.resources", "container.ports"},
+			OptionalProperties: []string{"container.resources", "container.ports", containerNetworks, containerRestartPolicy, containerHealthcheck,
+				containerLabels, containerLogDriver, containerLogOptions, containerDevices, containerRegistrySecret,
+				composeDocument, composeFile, composeProjectName},
 			RequiredComponentType: "",
 			RequiredMetadata:      []string{},
 			OptionalMetadata:      []string{},
@@ -373,6 +482,15 @@ func (*DockerTargetProvider) GetValidationRule(ctx context.Context) model.Valida
 				{Name: model.ContainerImage, IgnoreCase: false, SkipIfMissing: false, PropChanged: areContainerImagesChanged},
 				{Name: "container.ports", IgnoreCase: false, SkipIfMissing: true, PropChanged: areContainerPortsChanged},
 				{Name: "container.resources", IgnoreCase: false, SkipIfMissing: true},
+				{Name: containerNetworks, IgnoreCase: false, SkipIfMissing: true, PropChanged: optionChanged(normalizeNetworks)},
+				{Name: containerRestartPolicy, IgnoreCase: false, SkipIfMissing: true, PropChanged: optionChanged(normalizeRestartPolicy)},
+				{Name: containerHealthcheck, IgnoreCase: false, SkipIfMissing: true, PropChanged: optionChanged(normalizeHealthcheck)},
+				{Name: containerLabels, IgnoreCase: false, SkipIfMissing: true, PropChanged: optionChanged(normalizeStringMap)},
+				{Name: containerLogDriver, IgnoreCase: false, SkipIfMissing: true},
+				{Name: containerLogOptions, IgnoreCase: false, SkipIfMissing: true, PropChanged: optionChanged(normalizeStringMap)},
+				{Name: containerDevices, IgnoreCase: false, SkipIfMissing: true, PropChanged: optionChanged(normalizeDevices)},
+				{Name: composeDocument, IgnoreCase: false, SkipIfMissing: true, PropChanged: composeChanged(false)},
+				{Name: composeFile, IgnoreCase: false, SkipIfMissing: true, PropChanged: composeChanged(true)},
 			},
 		},
 	}
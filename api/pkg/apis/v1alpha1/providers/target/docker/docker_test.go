@@ -8,11 +8,21 @@ package docker
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -428,3 +438,345 @@ func TestConformanceSuite(t *testing.T) {
 	assert.Nil(t, err)
 	conformance.ConformanceSuite(t, provider)
 }
+
+func TestReadContainerOptions(t *testing.T) {
+	options, err := readContainerOptions(map[string]interface{}{
+		"container.networks":       []interface{}{"edge-net", map[string]interface{}{"name": "backend", "aliases": []interface{}{"api"}}},
+		"container.restartPolicy":  "on-failure:3",
+		"container.healthcheck":    `{"test":["CMD","curl","-f","http://localhost"],"interval":"30s","timeout":"5s","retries":3}`,
+		"container.labels":         map[string]interface{}{"app": "${{$instance()}}"},
+		"container.logDriver":      "json-file",
+		"container.logOptions":     `{"max-size":"10m"}`,
+		"container.devices":        `["/dev/ttyUSB0","/dev/video0:/dev/camera:r"]`,
+		"container.registrySecret": "registry-creds",
+	}, &model.ValueInjections{InstanceId: "instance1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []containerNetwork{{Name: "edge-net"}, {Name: "backend", Aliases: []string{"api"}}}, options.Networks)
+	assert.Equal(t, container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3}, *options.RestartPolicy)
+	assert.Equal(t, 30*time.Second, options.Healthcheck.Interval)
+	assert.Equal(t, 5*time.Second, options.Healthcheck.Timeout)
+	assert.Equal(t, 3, options.Healthcheck.Retries)
+	assert.Equal(t, map[string]string{"app": "instance1"}, options.Labels)
+	assert.Equal(t, container.LogConfig{Type: "json-file", Config: map[string]string{"max-size": "10m"}}, *options.LogConfig)
+	assert.Equal(t, []container.DeviceMapping{
+		{PathOnHost: "/dev/ttyUSB0", PathInContainer: "/dev/ttyUSB0", CgroupPermissions: "rwm"},
+		{PathOnHost: "/dev/video0", PathInContainer: "/dev/camera", CgroupPermissions: "r"},
+	}, options.Devices)
+	assert.Equal(t, "registry-creds", options.RegistrySecret)
+
+	containerConfig := container.Config{}
+	hostConfig := container.HostConfig{}
+	networkingConfig := options.apply(&containerConfig, &hostConfig)
+	assert.Equal(t, container.NetworkMode("edge-net"), hostConfig.NetworkMode)
+	assert.Equal(t, map[string]*network.EndpointSettings{"edge-net": {}}, networkingConfig.EndpointsConfig)
+	assert.Equal(t, container.RestartPolicyOnFailure, hostConfig.RestartPolicy.Name)
+	assert.Equal(t, 2, len(hostConfig.Resources.Devices))
+	assert.Equal(t, "json-file", hostConfig.LogConfig.Type)
+	assert.Equal(t, options.Healthcheck, containerConfig.Healthcheck)
+	assert.Equal(t, "instance1", containerConfig.Labels["app"])
+}
+
+func TestReadContainerOptionsEmpty(t *testing.T) {
+	options, err := readContainerOptions(map[string]interface{}{model.ContainerImage: "nginx"}, nil)
+	assert.Nil(t, err)
+	hostConfig := container.HostConfig{}
+	assert.Nil(t, options.apply(&container.Config{}, &hostConfig))
+	assert.Equal(t, container.HostConfig{}, hostConfig)
+}
+
+func TestReadContainerOptionsInvalid(t *testing.T) {
+	for key, value := range map[string]interface{}{
+		"container.networks":      `{"name":"edge-net"}`,
+		"container.restartPolicy": "sometimes",
+		"container.healthcheck":   `{"interval":"30s"}`,
+		"container.labels":        `["app"]`,
+		"container.logOptions":    "max-size=10m",
+		"container.devices":       `["/dev/a:/dev/b:rwm:x"]`,
+	} {
+		_, err := readContainerOptions(map[string]interface{}{key: value}, nil)
+		assert.NotNil(t, err, key)
+	}
+	_, err := readContainerOptions(map[string]interface{}{"container.restartPolicy": "always:3"}, nil)
+	assert.NotNil(t, err)
+	_, err = readContainerOptions(map[string]interface{}{"container.healthcheck": `{"test":["CMD","true"],"interval":"often"}`}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestReportContainerOptions(t *testing.T) {
+	info := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			HostConfig: &container.HostConfig{
+				RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+				LogConfig:     container.LogConfig{Type: "json-file", Config: map[string]string{"max-size": "10m"}},
+				Resources: container.Resources{
+					Devices: []container.DeviceMapping{{PathOnHost: "/dev/ttyUSB0", PathInContainer: "/dev/ttyUSB0", CgroupPermissions: "rwm"}},
+				},
+			},
+		},
+		Config: &container.Config{
+			Labels: map[string]string{"app": "web", "org.opencontainers.image.version": "1.0"},
+			Healthcheck: &container.HealthConfig{
+				Test:     []string{"CMD", "true"},
+				Interval: 30 * time.Second,
+			},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"edge-net": {}, "backend": {}},
+		},
+	}
+	desired := model.ComponentSpec{
+		Name: "web",
+		Properties: map[string]interface{}{
+			model.ContainerImage:      "nginx",
+			"container.networks":      []interface{}{"edge-net", map[string]interface{}{"name": "backend", "aliases": []interface{}{"api"}}},
+			"container.restartPolicy": "unless-stopped",
+			"container.healthcheck":   map[string]interface{}{"test": []interface{}{"CMD", "true"}, "interval": "30s"},
+			"container.labels":        map[string]interface{}{"app": "web"},
+			"container.logDriver":     "json-file",
+			"container.logOptions":    map[string]interface{}{"max-size": "10m"},
+			"container.devices":       []interface{}{"/dev/ttyUSB0"},
+		},
+	}
+	current := model.ComponentSpec{Name: "web", Properties: map[string]interface{}{model.ContainerImage: "nginx"}}
+	reportContainerOptions(info, desired, &current)
+	assert.Equal(t, `["backend","edge-net"]`, current.Properties["container.networks"])
+	assert.Equal(t, "unless-stopped", current.Properties["container.restartPolicy"])
+	assert.Equal(t, `{"app":"web"}`, current.Properties["container.labels"])
+
+	rule := (&DockerTargetProvider{}).GetValidationRule(context.Background())
+	assert.False(t, rule.IsComponentChanged(current, desired))
+
+	assert.True(t, rule.IsComponentChanged(current, withProperty(desired, "container.restartPolicy", "always")))
+	assert.True(t, rule.IsComponentChanged(current, withProperty(desired, "container.networks", `["edge-net"]`)))
+	assert.True(t, rule.IsComponentChanged(current, withProperty(desired, "container.labels", `{"app":"api"}`)))
+	assert.True(t, rule.IsComponentChanged(current, withProperty(desired, "container.healthcheck", `{"test":["CMD","true"],"interval":"1m"}`)))
+	assert.True(t, rule.IsComponentChanged(current, withProperty(desired, "container.devices", `["/dev/ttyUSB1"]`)))
+
+	// options that aren't set in the desired state are ignored
+	unset := model.ComponentSpec{Name: "web", Properties: map[string]interface{}{model.ContainerImage: "nginx"}}
+	assert.False(t, rule.IsComponentChanged(current, unset))
+}
+
+func withProperty(component model.ComponentSpec, key string, value interface{}) model.ComponentSpec {
+	properties := make(map[string]interface{}, len(component.Properties))
+	for k, v := range component.Properties {
+		properties[k] = v
+	}
+	properties[key] = value
+	component.Properties = properties
+	return component
+}
+
+type testSecretProvider struct {
+	secrets map[string]map[string]string
+}
+
+func (s *testSecretProvider) Get(ctx context.Context, name string, field string, localContext interface{}) (string, error) {
+	if evalContext, ok := localContext.(*coa_utils.EvaluationContext); !ok || evalContext.Namespace != "edge" {
+		return "", errors.New("unexpected namespace")
+	}
+	if v, ok := s.secrets[name][field]; ok {
+		return v, nil
+	}
+	return "", errors.New("secret not found")
+}
+
+func TestRegistryAuth(t *testing.T) {
+	_, err := registryAuth(context.Background(), nil, "registry-creds", "edge")
+	assert.NotNil(t, err)
+
+	vendorContext := &contexts.VendorContext{
+		EvaluationContext: &coa_utils.EvaluationContext{
+			SecretProvider: &testSecretProvider{secrets: map[string]map[string]string{
+				"registry-creds": {"username": "user", "password": "pass", "serveraddress": "registry.example.com"},
+				"no-password":    {"username": "user"},
+			}},
+		},
+	}
+	managerContext := &contexts.ManagerContext{VencorContext: vendorContext}
+	auth, err := registryAuth(context.Background(), managerContext, "registry-creds", "edge")
+	assert.Nil(t, err)
+	data, err := base64.URLEncoding.DecodeString(auth)
+	assert.Nil(t, err)
+	var config registry.AuthConfig
+	assert.Nil(t, json.Unmarshal(data, &config))
+	assert.Equal(t, "user", config.Username)
+	assert.Equal(t, "pass", config.Password)
+	assert.Equal(t, "registry.example.com", config.ServerAddress)
+
+	_, err = registryAuth(context.Background(), managerContext, "no-password", "edge")
+	assert.NotNil(t, err)
+}
+
+const testComposeDocument = `
+services:
+  web:
+    image: nginx:1.25
+    ports: ["8080:80"]
+    depends_on:
+      api:
+        condition: service_started
+    networks: [front, back]
+  api:
+    image: registry.example.com/edge/api:1.0
+    command: serve --port 9000
+    environment:
+      LOG_LEVEL: debug
+      WORKERS: 4
+    volumes: ["data:/var/lib/api", "/etc/edge:/etc/edge:ro"]
+    networks:
+      back:
+        aliases: [backend]
+    restart: on-failure:3
+    healthcheck:
+      test: curl -f http://localhost:9000/health
+      interval: 30s
+      retries: 3
+networks:
+  front: {}
+  back:
+    driver: bridge
+volumes:
+  data: {}
+`
+
+func TestReadComposeDeployment(t *testing.T) {
+	component := model.ComponentSpec{
+		Name:       "Edge-App",
+		Type:       composeComponentType,
+		Properties: map[string]interface{}{composeDocument: testComposeDocument},
+	}
+	d, err := readComposeDeployment(component, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "edge-app", d.Name)
+	assert.Equal(t, []string{"api", "web"}, d.Order)
+	assert.Equal(t, "edge-app-api-1", d.containerName("api"))
+
+	api := d.Project.Services["api"]
+	assert.Equal(t, []string{"serve", "--port", "9000"}, []string(api.Command))
+	assert.Equal(t, "4", api.Environment["WORKERS"])
+	binds, _, err := d.volumeBinds("api")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"edge-app_data:/var/lib/api", "/etc/edge:/etc/edge:ro"}, binds)
+
+	options, err := d.containerConfigs("api")
+	assert.Nil(t, err)
+	assert.Equal(t, []containerNetwork{{Name: "edge-app_back", Aliases: []string{"api", "backend"}}}, options.Networks)
+	assert.Equal(t, container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3}, *options.RestartPolicy)
+	assert.Equal(t, []string{"CMD-SHELL", "curl -f http://localhost:9000/health"}, options.Healthcheck.Test)
+	assert.Equal(t, 30*time.Second, options.Healthcheck.Interval)
+	assert.Equal(t, "edge-app", options.Labels[composeProjectLabel])
+	assert.Equal(t, "api", options.Labels[composeServiceLabel])
+	assert.Equal(t, d.Hash, options.Labels[composeHashLabel])
+	assert.Equal(t, "2", options.Labels[composeCountLabel])
+
+	web := d.serviceNetworks("web")
+	assert.Equal(t, 2, len(web))
+	assert.Equal(t, "edge-app_back", web[0].Name)
+	assert.Equal(t, "edge-app_front", web[1].Name)
+
+	d, err = readComposeDeployment(withProperty(component, composeProjectName, "edge"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "edge-api-1", d.containerName("api"))
+}
+
+func TestReadComposeDeploymentFile(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/compose.yaml"
+	err := os.WriteFile(file, []byte("services:\n  app:\n    image: alpine\n    volumes: [\"./config:/config\"]\n"), 0644)
+	assert.Nil(t, err)
+	component := model.ComponentSpec{
+		Name:       "app",
+		Type:       composeComponentType,
+		Properties: map[string]interface{}{composeFile: file},
+	}
+	d, err := readComposeDeployment(component, nil)
+	assert.Nil(t, err)
+	binds, _, err := d.volumeBinds("app")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{dir + "/config:/config"}, binds)
+	assert.Equal(t, []containerNetwork{{Name: "app_default", Aliases: []string{"app"}}}, d.serviceNetworks("app"))
+
+	// relative bind mounts need a directory
+	_, err = readComposeDeployment(model.ComponentSpec{
+		Name:       "app",
+		Properties: map[string]interface{}{composeDocument: "services:\n  app:\n    image: alpine\n    volumes: [\"./config:/config\"]\n"},
+	}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestReadComposeDeploymentInvalid(t *testing.T) {
+	documents := map[string]interface{}{
+		"missing":      nil,
+		"no services":  "services: {}",
+		"no image":     "services:\n  app:\n    command: run",
+		"bad name":     "name: Edge_App\nservices:\n  app:\n    image: alpine",
+		"bad network":  "services:\n  app:\n    image: alpine\n    networks: [other]",
+		"bad depends":  "services:\n  app:\n    image: alpine\n    depends_on: [db]",
+		"cycle":        "services:\n  a:\n    image: alpine\n    depends_on: [b]\n  b:\n    image: alpine\n    depends_on: [a]",
+		"bad restart":  "services:\n  app:\n    image: alpine\n    restart: sometimes",
+		"bad ports":    "services:\n  app:\n    image: alpine\n    ports: [\"http:80\"]",
+		"bad document": "services: [",
+	}
+	for name, document := range documents {
+		properties := map[string]interface{}{}
+		if document != nil {
+			properties[composeDocument] = document
+		}
+		_, err := readComposeDeployment(model.ComponentSpec{Name: "app", Properties: properties}, nil)
+		assert.NotNil(t, err, name)
+	}
+
+	_, err := readComposeDeployment(model.ComponentSpec{Name: "app", Properties: map[string]interface{}{
+		composeDocument: "services:\n  app:\n    image: alpine",
+		composeFile:     "/tmp/compose.yaml",
+	}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestComposeComponent(t *testing.T) {
+	reference := model.ComponentSpec{
+		Name:       "edge-app",
+		Type:       composeComponentType,
+		Properties: map[string]interface{}{composeDocument: testComposeDocument},
+	}
+	d, err := readComposeDeployment(reference, nil)
+	assert.Nil(t, err)
+	labels := func(service string) map[string]string {
+		options, _ := d.containerConfigs(service)
+		return options.Labels
+	}
+	containers := []types.Container{
+		{State: "running", Labels: labels("api")},
+		{State: "exited", Labels: labels("web")},
+	}
+	component := composeComponent(reference, containers)
+	assert.Equal(t, composeComponentType, component.Type)
+	assert.Equal(t, d.Hash, component.Properties[composeDocument])
+	assert.Equal(t, `{"api":"running","web":"exited"}`, component.Properties[composeServices])
+
+	// the document changes only with its content, not its formatting
+	changed := composeChanged(false)
+	assert.False(t, changed(component.Properties[composeDocument], testComposeDocument))
+	assert.False(t, changed(component.Properties[composeDocument], map[string]interface{}{
+		"services": map[string]interface{}{
+			"web": map[string]interface{}{"image": "nginx:1.25", "ports": []interface{}{"8080:80"},
+				"depends_on": map[string]interface{}{"api": map[string]interface{}{"condition": "service_started"}},
+				"networks":   []interface{}{"front", "back"}},
+			"api": map[string]interface{}{"image": "registry.example.com/edge/api:1.0", "command": "serve --port 9000",
+				"environment": map[string]interface{}{"LOG_LEVEL": "debug", "WORKERS": 4},
+				"volumes":     []interface{}{"data:/var/lib/api", "/etc/edge:/etc/edge:ro"},
+				"networks":    map[string]interface{}{"back": map[string]interface{}{"aliases": []interface{}{"backend"}}},
+				"restart":     "on-failure:3",
+				"healthcheck": map[string]interface{}{"test": "curl -f http://localhost:9000/health", "interval": "30s", "retries": 3}},
+		},
+		"networks": map[string]interface{}{"front": map[string]interface{}{}, "back": map[string]interface{}{"driver": "bridge"}},
+		"volumes":  map[string]interface{}{"data": map[string]interface{}{}},
+	}))
+	assert.True(t, changed(component.Properties[composeDocument], "services:\n  app:\n    image: alpine"))
+
+	// a missing container is reported as a changed document
+	component = composeComponent(reference, containers[:1])
+	assert.Equal(t, "", component.Properties[composeDocument])
+	assert.True(t, changed(component.Properties[composeDocument], testComposeDocument))
+}
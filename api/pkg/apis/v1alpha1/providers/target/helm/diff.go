@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package helm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	syaml "sigs.k8s.io/yaml"
+)
+
+// manifestResource is a resource of a rendered manifest. Text has the values of Secrets masked,
+// Sum is the hash of the resource before masking, so changes of masked values are still found.
+type manifestResource struct {
+	Kind string
+	Text string
+	Sum  [sha256.Size]byte
+}
+
+// parseManifest splits a rendered manifest into resources keyed by kind, namespace and name
+func parseManifest(manifest string) (map[string]manifestResource, error) {
+	ret := map[string]manifestResource{}
+	reader := yaml.NewYAMLReader(bufio.NewReader(strings.NewReader(manifest)))
+	for {
+		doc, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return ret, nil
+			}
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if _, _, err = decoder.Decode(doc, nil, obj); err != nil {
+			// documents that only have comments aren't resources
+			continue
+		}
+		raw, err := syaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		maskSecrets(obj)
+		data, err := syaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+		if obj.GetNamespace() != "" {
+			key = fmt.Sprintf("%s/%s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		}
+		ret[key] = manifestResource{Kind: obj.GetKind(), Text: string(data), Sum: sha256.Sum256(raw)}
+	}
+}
+
+// maskSecrets replaces the values of data and stringData of a Secret, or of the Secrets in a
+// List, with the redacted value. The keys are kept.
+func maskSecrets(obj *unstructured.Unstructured) {
+	if obj.IsList() {
+		obj.EachListItem(func(item runtime.Object) error {
+			if u, ok := item.(*unstructured.Unstructured); ok {
+				maskSecrets(u)
+			}
+			return nil
+		})
+		return
+	}
+	if obj.GetKind() != "Secret" {
+		return
+	}
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := obj.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range values {
+			values[key] = redactedValue
+		}
+	}
+}
+
+// diffManifests compares the manifest of a live release with a rendered manifest, resource by
+// resource. The values of Secrets are masked in both manifests.
+func diffManifests(live string, desired string) (string, error) {
+	liveResources, err := parseManifest(live)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the manifest of the release: %w", err)
+	}
+	desiredResources, err := parseManifest(desired)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the rendered manifest: %w", err)
+	}
+	keys := make([]string, 0, len(liveResources)+len(desiredResources))
+	for key := range liveResources {
+		keys = append(keys, key)
+	}
+	for key := range desiredResources {
+		if _, ok := liveResources[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var added, changed, removed int
+	var out strings.Builder
+	for _, key := range keys {
+		before, inLive := liveResources[key]
+		after, inDesired := desiredResources[key]
+		switch {
+		case !inLive:
+			added++
+			fmt.Fprintf(&out, "+ %s\n", key)
+			writeDiff(&out, "", after.Text, key)
+		case !inDesired:
+			removed++
+			fmt.Fprintf(&out, "- %s\n", key)
+		case before.Sum != after.Sum:
+			changed++
+			fmt.Fprintf(&out, "~ %s\n", key)
+			if before.Text == after.Text {
+				out.WriteString("  (only masked values changed)\n")
+			} else {
+				writeDiff(&out, before.Text, after.Text, key)
+			}
+		}
+	}
+	if added+changed+removed == 0 {
+		return "no changes", nil
+	}
+	return fmt.Sprintf("%d to add, %d to change, %d to remove\n%s", added, changed, removed, out.String()), nil
+}
+
+func writeDiff(out *strings.Builder, before string, after string, key string) {
+	var lines []string
+	if before != "" {
+		lines = difflib.SplitLines(before)
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines,
+		B:        difflib.SplitLines(after),
+		FromFile: "live/" + key,
+		ToFile:   "desired/" + key,
+		Context:  3,
+	})
+	out.WriteString(diff)
+}
@@ -81,6 +81,12 @@ type (
 		Chart       HelmChartProperty      `json:"chart"`
 		Values      map[string]interface{} `json:"values,omitempty"`
 		ReleaseName string                 `json:"releaseName,omitempty"`
+		// ValuesFrom are catalogs and secrets that values are read from
+		ValuesFrom []HelmValuesSource `json:"valuesFrom,omitempty"`
+		// TargetValues are values by target name, merged over values when deploying to the target
+		TargetValues map[string]map[string]interface{} `json:"targetValues,omitempty"`
+		// Kustomize is a kustomization applied to the rendered manifests
+		Kustomize map[string]interface{} `json:"kustomize,omitempty"`
 	}
 	// HelmChartProperty is the property for the Helm Charts
 	HelmChartProperty struct {
@@ -329,18 +335,22 @@ func (i *HelmTargetProvider) Get(ctx context.Context, deployment model.Deploymen
 					repo = parts[0][9:]
 					name = parts[1][9:]
 				}
-				ret = append(ret, model.ComponentSpec{
-					Name: component.Component.Name,
-					Type: "helm.v3",
-					Properties: map[string]interface{}{
-						"releaseName": res.Name,
-						"chart": map[string]string{
-							"repo":    repo,
-							"name":    name,
-							"version": res.Chart.Metadata.Version,
-						},
-						"values": res.Config,
+				properties := map[string]interface{}{
+					"releaseName": res.Name,
+					"chart": map[string]string{
+						"repo":    repo,
+						"name":    name,
+						"version": res.Chart.Metadata.Version,
 					},
+					"values": res.Config,
+				}
+				if releaseHash, ok := res.Chart.Metadata.Annotations[releaseHashAnnotation]; ok && helmProp != nil {
+					i.reportValues(ctx, deployment, component.Component, helmProp, releaseHash, properties)
+				}
+				ret = append(ret, model.ComponentSpec{
+					Name:       component.Component.Name,
+					Type:       "helm.v3",
+					Properties: properties,
 				})
 			}
 		}
@@ -348,19 +358,42 @@ func (i *HelmTargetProvider) Get(ctx context.Context, deployment model.Deploymen
 	return ret, nil
 }
 
+// reportValues reports the values of a release that records the hash of its values. When the hash
+// matches the values of the reference, the value properties of the reference are reported, otherwise
+// the values of the release with the values read from secrets redacted.
+func (i *HelmTargetProvider) reportValues(ctx context.Context, deployment model.DeploymentSpec, component model.ComponentSpec, helmProp *HelmProperty, releaseHash string, properties map[string]interface{}) {
+	properties["values"] = redactValues(properties["values"].(map[string]interface{}), helmProp.secretPaths())
+	resolved, err := resolveValues(ctx, i.Context, helmProp, deployment)
+	if err != nil {
+		sLog.WarnfCtx(ctx, "  P (Helm Target): failed to resolve values of %s: %+v", component.Name, err)
+		return
+	}
+	if resolved.hash(helmProp.Kustomize) != releaseHash {
+		return
+	}
+	for _, key := range []string{"values", "valuesFrom", "targetValues", "kustomize"} {
+		if v, ok := component.Properties[key]; ok {
+			properties[key] = v
+		} else {
+			delete(properties, key)
+		}
+	}
+}
+
 // GetValidationRule returns the validation rule for this provider
 func (*HelmTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
 	return model.ValidationRule{
 		AllowSidecar: false,
 		ComponentValidationRule: model.ComponentValidationRule{
 			RequiredProperties:    []string{"chart"},
-			OptionalProperties:    []string{"values"},
+			OptionalProperties:    []string{"values", "valuesFrom", "targetValues", "kustomize"},
 			RequiredComponentType: "",
 			RequiredMetadata:      []string{},
 			OptionalMetadata:      []string{},
 			ChangeDetectionProperties: []model.PropertyDesc{
 				{Name: "chart", IgnoreCase: false, SkipIfMissing: true}, //TODO: deep change detection on interface{}
 				{Name: "values", PropChanged: propChange},
+				{Name: "kustomize", PropChanged: propChange},
 			},
 		},
 	}
@@ -448,8 +481,10 @@ func (i *HelmTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 	}
 
 	if isDryRun {
-		sLog.DebugCtx(ctx, "  P (Helm Target): dryRun is enabled, skipping apply")
-		return nil, nil
+		sLog.DebugCtx(ctx, "  P (Helm Target): dryRun is enabled, comparing rendered charts with releases instead of applying them")
+		var ret map[string]model.ComponentResultSpec
+		ret, err = i.plan(ctx, deployment, step)
+		return ret, err
 	}
 
 	ret := step.PrepareResultMap()
@@ -491,6 +526,25 @@ func (i *HelmTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 				return ret, err
 			}
 
+			var resolved *resolvedValues
+			resolved, err = resolveValues(ctx, i.Context, helmProp, deployment)
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Helm Target): failed to resolve values: %+v", err)
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				providerOperationMetrics.ProviderOperationErrors(
+					helm,
+					functionName,
+					metrics.HelmPropertiesOperation,
+					metrics.ApplyOperationType,
+					v1alpha2.GetHelmPropertyFailed.String(),
+				)
+
+				return ret, err
+			}
+
 			var fileName string
 			fileName, err = i.pullChart(ctx, &helmProp.Chart)
 			if err != nil {
@@ -533,11 +587,12 @@ func (i *HelmTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 			}
 
 			chart.Metadata.Tags = "SYM-REPO:" + helmProp.Chart.Repo + ";SYM-NAME:" + helmProp.Chart.Name //this is not used by Helm SDK, we use this to carry repo info
-
-			postRender := &PostRenderer{
-				instance:  deployment.Instance,
-				populator: i.MetaPopulator,
+			if chart.Metadata.Annotations == nil {
+				chart.Metadata.Annotations = map[string]string{}
 			}
+			chart.Metadata.Annotations[releaseHashAnnotation] = resolved.hash(helmProp.Kustomize)
+
+			postRender := i.postRenderer(deployment, helmProp)
 			installClient, err := configureInstallClient(ctx, releaseName, &helmProp.Chart, &deployment, actionConfig, postRender)
 			if err != nil {
 				sLog.ErrorfCtx(ctx, "  P (Helm Target): failed to config helm install client: %+v", err)
@@ -557,9 +612,9 @@ func (i *HelmTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 			utils.EmitUserAuditsLogs(ctx, "  P (Helm Target): Applying chart, releaseName: %s, defined in component: %s, chart: {repo: %s, name: %s, version: %s}, namespace: %s", releaseName, component.Component.Name, helmProp.Chart.Repo, helmProp.Chart.Name, helmProp.Chart.Version, deployment.Instance.Spec.Scope)
 			if releaseExists {
 				sLog.InfofCtx(ctx, "  P (Helm Target): Chart upgrade started. Details - Release Name: %s, Component Name: %s", releaseName, component.Component.Name)
-				if _, err = upgradeClient.Run(releaseName, chart, helmProp.Values); err != nil {
-					sLog.InfofCtx(ctx, "  P (Helm Target): failed to upgrade: %+v", err)
-					err = v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to upgrade chart", providerName), v1alpha2.HelmActionFailed)
+				if _, err = upgradeClient.Run(releaseName, chart, resolved.Values); err != nil {
+					sLog.InfofCtx(ctx, "  P (Helm Target): failed to upgrade: %s", resolved.redact(err.Error()))
+					err = v1alpha2.NewCOAError(errors.New(resolved.redact(err.Error())), fmt.Sprintf("%s: failed to upgrade chart", providerName), v1alpha2.HelmActionFailed)
 					ret[component.Component.Name] = model.ComponentResultSpec{
 						Status:  v1alpha2.UpdateFailed,
 						Message: err.Error(),
@@ -575,9 +630,9 @@ func (i *HelmTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 				}
 			} else {
 				sLog.InfofCtx(ctx, "  P (Helm Target): Chart installation started. Details - Release Name: %s, Component Name: %s", releaseName, component.Component.Name)
-				if _, err := installClient.Run(chart, helmProp.Values); err != nil {
-					sLog.ErrorfCtx(ctx, "  P (Helm Target): failed to install: %+v", err)
-					err = v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to install chart", providerName), v1alpha2.HelmActionFailed)
+				if _, err := installClient.Run(chart, resolved.Values); err != nil {
+					sLog.ErrorfCtx(ctx, "  P (Helm Target): failed to install: %s", resolved.redact(err.Error()))
+					err = v1alpha2.NewCOAError(errors.New(resolved.redact(err.Error())), fmt.Sprintf("%s: failed to install chart", providerName), v1alpha2.HelmActionFailed)
 					ret[component.Component.Name] = model.ComponentResultSpec{
 						Status:  v1alpha2.UpdateFailed,
 						Message: err.Error(),
@@ -641,6 +696,19 @@ func (i *HelmTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 	return ret, nil
 }
 
+// postRenderer returns the post renderer of a component, which adds Symphony metadata to the
+// rendered manifests and applies the kustomization of the component
+func (i *HelmTargetProvider) postRenderer(deployment model.DeploymentSpec, helmProp *HelmProperty) postrender.PostRenderer {
+	postRender := &PostRenderer{
+		instance:  deployment.Instance,
+		populator: i.MetaPopulator,
+	}
+	if len(helmProp.Kustomize) == 0 {
+		return postRender
+	}
+	return chainedPostRenderer{postRender, &KustomizePostRenderer{kustomization: helmProp.Kustomize}}
+}
+
 func (i *HelmTargetProvider) pullChart(ctx context.Context, chart *HelmChartProperty) (fileName string, err error) {
 	fileName = fmt.Sprintf("%s/%s.tgz", tempChartDir, uuid.New().String())
 
@@ -884,6 +952,12 @@ func validateProps(props *HelmProperty) (*HelmProperty, error) {
 	if props.Chart.Repo == "" {
 		return nil, errors.New("chart repo is required")
 	}
+	if err := validateValuesSources(props); err != nil {
+		return nil, err
+	}
+	if err := validateKustomization(props.Kustomize); err != nil {
+		return nil, err
+	}
 
 	return props, nil
 }
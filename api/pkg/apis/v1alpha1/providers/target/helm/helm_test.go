@@ -7,8 +7,10 @@
 package helm
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -19,10 +21,18 @@ import (
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/stretchr/testify/assert"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
 	"helm.sh/helm/v3/pkg/postrender"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/client-go/rest"
 )
 
@@ -1098,3 +1108,352 @@ func TestHelmTargetProviderPullChartUnauthorizedError(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.True(t, isUnauthorized(err))
 }
+
+type testConfigProvider struct {
+	catalogs map[string]map[string]interface{}
+}
+
+func (c *testConfigProvider) Get(ctx context.Context, object string, field string, overrides []string, localContext interface{}) (interface{}, error) {
+	if v, ok := c.catalogs[object][field]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("field %s of catalog %s not found", field, object)
+}
+
+func (c *testConfigProvider) GetObject(ctx context.Context, object string, overrides []string, localContext interface{}) (map[string]interface{}, error) {
+	if v, ok := c.catalogs[object]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("catalog %s not found", object)
+}
+
+type testSecretProvider struct {
+	secrets map[string]map[string]string
+}
+
+func (s *testSecretProvider) Get(ctx context.Context, name string, field string, localContext interface{}) (string, error) {
+	if v, ok := s.secrets[name][field]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("field %s of secret %s not found", field, name)
+}
+
+func newTestManagerContext() *contexts.ManagerContext {
+	return &contexts.ManagerContext{
+		VencorContext: &contexts.VendorContext{
+			EvaluationContext: &coa_utils.EvaluationContext{
+				ConfigProvider: &testConfigProvider{catalogs: map[string]map[string]interface{}{
+					"app-config": {
+						"replicaCount": 2,
+						"image":        map[string]interface{}{"repository": "nginx", "tag": "1.25"},
+						"database":     map[string]interface{}{"host": "db.local"},
+					},
+				}},
+				SecretProvider: &testSecretProvider{secrets: map[string]map[string]string{
+					"db-credentials": {"password": "s3cr3t-pass"},
+				}},
+			},
+		},
+	}
+}
+
+// TestResolveValues tests that values are layered from catalogs, values, target values and secrets
+func TestResolveValues(t *testing.T) {
+	helmProp, err := getHelmPropertyFromComponent(model.ComponentSpec{
+		Name: "web",
+		Properties: map[string]interface{}{
+			"chart":  map[string]interface{}{"repo": "oci://example.azurecr.io/web", "version": "1.0.0"},
+			"values": map[string]interface{}{"image": map[string]interface{}{"tag": "1.26"}},
+			"valuesFrom": []interface{}{
+				map[string]interface{}{"secret": "db-credentials", "field": "password", "path": "database.password"},
+				map[string]interface{}{"catalog": "app-config"},
+				map[string]interface{}{"catalog": "app-config", "field": "database", "path": "backup.database"},
+			},
+			"targetValues": map[string]interface{}{
+				"edge-1": map[string]interface{}{"replicaCount": 1},
+				"edge-2": map[string]interface{}{"replicaCount": 3},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	deployment := model.DeploymentSpec{ActiveTarget: "edge-1", Instance: model.InstanceState{Spec: &model.InstanceSpec{}}}
+	resolved, err := resolveValues(context.Background(), newTestManagerContext(), helmProp, deployment)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"replicaCount": float64(1),
+		"image":        map[string]interface{}{"repository": "nginx", "tag": "1.26"},
+		"database":     map[string]interface{}{"host": "db.local", "password": "s3cr3t-pass"},
+		"backup":       map[string]interface{}{"database": map[string]interface{}{"host": "db.local"}},
+	}, resolved.Values)
+	assert.Equal(t, "password: ***", resolved.redact("password: s3cr3t-pass"))
+	assert.Equal(t, map[string]interface{}{"host": "db.local", "password": redactedValue},
+		redactValues(resolved.Values, helmProp.secretPaths())["database"])
+
+	// the hash changes with the target, and doesn't change with the order of keys
+	hash := resolved.hash(nil)
+	deployment.ActiveTarget = "edge-2"
+	other, err := resolveValues(context.Background(), newTestManagerContext(), helmProp, deployment)
+	assert.Nil(t, err)
+	assert.NotEqual(t, hash, other.hash(nil))
+	resolved, _ = resolveValues(context.Background(), newTestManagerContext(), helmProp, model.DeploymentSpec{ActiveTarget: "edge-1"})
+	assert.Equal(t, hash, resolved.hash(nil))
+	assert.NotEqual(t, hash, resolved.hash(map[string]interface{}{"namePrefix": "edge-"}))
+
+	// the catalog values of the component are not changed
+	assert.Equal(t, map[string]interface{}{"host": "db.local"}, newTestManagerContext().VencorContext.EvaluationContext.ConfigProvider.(*testConfigProvider).catalogs["app-config"]["database"])
+
+	helmProp.ValuesFrom = append(helmProp.ValuesFrom, HelmValuesSource{Secret: "missing", Field: "token", Path: "token"})
+	_, err = resolveValues(context.Background(), newTestManagerContext(), helmProp, deployment)
+	assert.NotNil(t, err)
+	_, err = resolveValues(context.Background(), nil, helmProp, deployment)
+	assert.NotNil(t, err)
+}
+
+func TestHelmPropertyInvalidValuesSources(t *testing.T) {
+	invalid := []interface{}{
+		map[string]interface{}{"catalog": "app-config", "secret": "db-credentials"},
+		map[string]interface{}{"field": "password"},
+		map[string]interface{}{"secret": "db-credentials", "field": "password"},
+		map[string]interface{}{"catalog": "app-config", "path": "config"},
+		map[string]interface{}{"secret": "db-credentials", "field": "password", "path": "database..password"},
+	}
+	for _, source := range invalid {
+		_, err := getHelmPropertyFromComponent(model.ComponentSpec{
+			Name: "web",
+			Properties: map[string]interface{}{
+				"chart":      map[string]interface{}{"repo": "oci://example.azurecr.io/web", "version": "1.0.0"},
+				"valuesFrom": []interface{}{source},
+			},
+		})
+		assert.NotNil(t, err, source)
+	}
+	_, err := getHelmPropertyFromComponent(model.ComponentSpec{
+		Name: "web",
+		Properties: map[string]interface{}{
+			"chart":     map[string]interface{}{"repo": "oci://example.azurecr.io/web", "version": "1.0.0"},
+			"kustomize": map[string]interface{}{"resources": []interface{}{"https://example.com/extra.yaml"}},
+		},
+	})
+	assert.NotNil(t, err)
+}
+
+const testManifest = `---
+# Source: web/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  mode: production
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+`
+
+func TestKustomizePostRenderer(t *testing.T) {
+	renderer := &KustomizePostRenderer{kustomization: map[string]interface{}{
+		"namePrefix": "edge-",
+		"labels":     []interface{}{map[string]interface{}{"pairs": map[string]interface{}{"site": "edge-1"}}},
+		"patches": []interface{}{
+			map[string]interface{}{
+				"target": map[string]interface{}{"kind": "Deployment", "name": "web"},
+				"patch":  "- op: replace\n  path: /spec/replicas\n  value: 3\n",
+			},
+		},
+	}}
+	output, err := renderer.Run(bytes.NewBufferString(testManifest))
+	assert.Nil(t, err)
+	resources, err := parseManifest(output.String())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(resources))
+	assert.Contains(t, resources["Deployment/edge-web"].Text, "replicas: 3")
+	assert.Contains(t, resources["ConfigMap/edge-web-config"].Text, "site: edge-1")
+
+	renderer = &KustomizePostRenderer{kustomization: map[string]interface{}{"patches": "invalid"}}
+	_, err = renderer.Run(bytes.NewBufferString(testManifest))
+	assert.NotNil(t, err)
+}
+
+func TestDiffManifests(t *testing.T) {
+	diff, err := diffManifests(testManifest, testManifest)
+	assert.Nil(t, err)
+	assert.Equal(t, "no changes", diff)
+
+	desired := strings.Replace(testManifest, "replicas: 1", "replicas: 2", 1)
+	desired = strings.Replace(desired, "kind: ConfigMap\nmetadata:\n  name: web-config", "kind: Secret\nmetadata:\n  name: web-secret", 1)
+	diff, err = diffManifests(testManifest, desired)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(diff, "1 to add, 1 to change, 1 to remove\n"))
+	assert.Contains(t, diff, "- ConfigMap/web-config\n")
+	assert.Contains(t, diff, "+ Secret/web-secret\n")
+	assert.Contains(t, diff, "~ Deployment/web\n")
+	assert.Contains(t, diff, "-  replicas: 1\n+  replicas: 2\n")
+	assert.NotContains(t, diff, "production")
+}
+
+const testSecretManifest = `apiVersion: v1
+kind: Secret
+metadata:
+  name: web-secret
+data:
+  password: c2VjcmV0
+stringData:
+  token: plain-token
+`
+
+func TestDiffManifestsMasksSecrets(t *testing.T) {
+	// the values of new Secrets are masked, their keys are shown
+	diff, err := diffManifests("", testSecretManifest)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "+ Secret/web-secret\n")
+	assert.Contains(t, diff, "+  password: '***'\n")
+	assert.NotContains(t, diff, "c2VjcmV0")
+	assert.NotContains(t, diff, "plain-token")
+
+	// changes of values are found without showing them
+	changed := strings.Replace(testSecretManifest, "c2VjcmV0", "b3RoZXI=", 1)
+	diff, err = diffManifests(testSecretManifest, changed)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(diff, "0 to add, 1 to change, 0 to remove\n"))
+	assert.Contains(t, diff, "(only masked values changed)")
+	assert.NotContains(t, diff, "c2VjcmV0")
+	assert.NotContains(t, diff, "b3RoZXI=")
+
+	// other changes of Secrets are shown with masked values
+	changed = strings.Replace(testSecretManifest, "  token: plain-token", "  token: other-token\n  key: plain-key", 1)
+	diff, err = diffManifests(testSecretManifest, changed)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "+  key: '***'\n")
+	assert.NotContains(t, diff, "plain-token")
+	assert.NotContains(t, diff, "other-token")
+	assert.NotContains(t, diff, "plain-key")
+
+	// Secrets in lists are masked as well
+	list := "apiVersion: v1\nkind: List\nmetadata:\n  name: secrets\nitems:\n- " + strings.ReplaceAll(strings.TrimSuffix(testSecretManifest, "\n"), "\n", "\n  ") + "\n"
+	diff, err = diffManifests("", list)
+	assert.Nil(t, err)
+	assert.NotContains(t, diff, "c2VjcmV0")
+	assert.NotContains(t, diff, "plain-token")
+}
+
+func TestRedactEncodedSecrets(t *testing.T) {
+	resolved := &resolvedValues{Secrets: []string{"secret"}}
+	assert.Equal(t, "password: *** or ***", resolved.redact("password: c2VjcmV0 or secret"))
+}
+
+func createTestChart(t *testing.T) string {
+	testChart := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "web", Version: "1.0.0"},
+		Values:   map[string]interface{}{"replicaCount": 1, "database": map[string]interface{}{"password": ""}},
+		Templates: []*chart.File{
+			{Name: "templates/deployment.yaml", Data: []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  replicas: {{ .Values.replicaCount }}
+`)},
+			{Name: "templates/configmap.yaml", Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+data:
+  password: {{ .Values.database.password | quote }}
+`)},
+		},
+	}
+	file, err := chartutil.Save(testChart, t.TempDir())
+	assert.Nil(t, err)
+	return file
+}
+
+// TestHelmTargetProviderPlan tests that dry runs report the differences between rendered charts and releases
+func TestHelmTargetProviderPlan(t *testing.T) {
+	chartFile := createTestChart(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, chartFile)
+	}))
+	defer ts.Close()
+
+	provider := &HelmTargetProvider{}
+	err := provider.Init(HelmTargetProviderConfig{InCluster: true})
+	assert.Nil(t, err)
+	provider.SetContext(newTestManagerContext())
+	store := storage.Init(driver.NewMemory())
+	actionConfig := &action.Configuration{
+		Releases:     store,
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(format string, v ...interface{}) {},
+	}
+	helmProp, err := getHelmPropertyFromComponent(model.ComponentSpec{
+		Name: "web",
+		Properties: map[string]interface{}{
+			"chart":        map[string]interface{}{"repo": ts.URL + "/web-1.0.0.tgz", "version": "1.0.0"},
+			"valuesFrom":   []interface{}{map[string]interface{}{"secret": "db-credentials", "field": "password", "path": "database.password"}},
+			"targetValues": map[string]interface{}{"edge-1": map[string]interface{}{"replicaCount": 2}},
+		},
+	})
+	assert.Nil(t, err)
+	deployment := model.DeploymentSpec{
+		ActiveTarget: "edge-1",
+		Instance:     model.InstanceState{ObjectMeta: model.ObjectMeta{Name: "web-instance"}, Spec: &model.InstanceSpec{}},
+	}
+
+	diff, err := provider.planComponent(context.Background(), deployment, helmProp, "web", actionConfig)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(diff, "2 to add, 0 to change, 0 to remove\n"), diff)
+	assert.Contains(t, diff, "replicas: 2")
+	assert.NotContains(t, diff, "s3cr3t-pass")
+	assert.Contains(t, diff, redactedValue)
+	releases, err := store.ListReleases()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(releases))
+
+	// a deployed release is compared with the rendered chart
+	installClient, err := configureInstallClient(context.Background(), "web", &helmProp.Chart, &deployment, actionConfig, provider.postRenderer(deployment, helmProp))
+	assert.Nil(t, err)
+	installClient.IsUpgrade = false
+	testChart, err := loader.Load(chartFile)
+	assert.Nil(t, err)
+	_, err = installClient.Run(testChart, map[string]interface{}{"replicaCount": 1, "database": map[string]interface{}{"password": "old-pass"}})
+	assert.Nil(t, err)
+
+	diff, err = provider.planComponent(context.Background(), deployment, helmProp, "web", actionConfig)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(diff, "0 to add, 2 to change, 0 to remove\n"), diff)
+	assert.Contains(t, diff, "-  replicas: 1\n+  replicas: 2\n")
+	assert.Contains(t, diff, "-  password: old-pass\n+  password: ***\n")
+	assert.NotContains(t, diff, "s3cr3t-pass")
+	releases, err = store.ListReleases()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(releases))
+}
+
+func TestHelmTargetProviderDryRunDelete(t *testing.T) {
+	provider := &HelmTargetProvider{}
+	err := provider.Init(HelmTargetProviderConfig{InCluster: true})
+	assert.Nil(t, err)
+	ret, err := provider.Apply(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+		model.DeploymentStep{Components: []model.ComponentStep{{
+			Action: model.ComponentDelete,
+			Component: model.ComponentSpec{
+				Name:       "web",
+				Type:       "helm.v3",
+				Properties: map[string]interface{}{"chart": map[string]interface{}{"repo": "oci://example.azurecr.io/web", "version": "1.0.0"}, "releaseName": "web-release"},
+			},
+		}}}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Untouched, ret["web"].Status)
+	assert.Equal(t, "release web-release would be uninstalled", ret["web"].Message)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package helm
+
+import (
+	"bytes"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/postrender"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	syaml "sigs.k8s.io/yaml"
+)
+
+const (
+	kustomizeFolder   = "/symphony"
+	kustomizeManifest = "helm-output.yaml"
+)
+
+// kustomizeUnsupportedFields are kustomization fields that read other files or run plugins, the
+// kustomization only has the rendered manifests of the chart
+var kustomizeUnsupportedFields = []string{"resources", "bases", "components", "crds", "helmCharts", "helmChartInflationGenerator", "helmGlobals", "generators", "transformers", "validators"}
+
+type (
+	// KustomizePostRenderer applies a kustomization to the rendered manifests of a chart
+	KustomizePostRenderer struct {
+		kustomization map[string]interface{}
+	}
+	// chainedPostRenderer runs post renderers in order
+	chainedPostRenderer []postrender.PostRenderer
+)
+
+var (
+	_ postrender.PostRenderer = &KustomizePostRenderer{}
+	_ postrender.PostRenderer = chainedPostRenderer{}
+)
+
+// validateKustomization checks that a kustomization only transforms the rendered manifests
+func validateKustomization(kustomization map[string]interface{}) error {
+	for _, field := range kustomizeUnsupportedFields {
+		if _, ok := kustomization[field]; ok {
+			return fmt.Errorf("kustomize field %s is not supported, the kustomization is applied to the rendered chart", field)
+		}
+	}
+	return nil
+}
+
+// Run implements PostRenderer.
+func (r *KustomizePostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	kustomization := map[string]interface{}{}
+	for k, v := range r.kustomization {
+		kustomization[k] = v
+	}
+	kustomization["resources"] = []string{kustomizeManifest}
+	if _, ok := kustomization["apiVersion"]; !ok {
+		kustomization["apiVersion"] = "kustomize.config.k8s.io/v1beta1"
+	}
+	if _, ok := kustomization["kind"]; !ok {
+		kustomization["kind"] = "Kustomization"
+	}
+	data, err := syaml.Marshal(kustomization)
+	if err != nil {
+		return nil, err
+	}
+
+	fSys := filesys.MakeFsInMemory()
+	if err = fSys.MkdirAll(kustomizeFolder); err != nil {
+		return nil, err
+	}
+	if err = fSys.WriteFile(kustomizeFolder+"/kustomization.yaml", data); err != nil {
+		return nil, err
+	}
+	if err = fSys.WriteFile(kustomizeFolder+"/"+kustomizeManifest, renderedManifests.Bytes()); err != nil {
+		return nil, err
+	}
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, kustomizeFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply kustomization: %w", err)
+	}
+	output, err := resources.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(output), nil
+}
+
+// Run implements PostRenderer.
+func (c chainedPostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	var err error
+	for _, renderer := range c {
+		if renderedManifests, err = renderer.Run(renderedManifests); err != nil {
+			return nil, err
+		}
+	}
+	return renderedManifests, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// plan compares the rendered charts of updated components with their releases, and reports the
+// releases of deleted components, without changing any release. The differences are reported in
+// the messages of the component results.
+func (i *HelmTargetProvider) plan(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep) (map[string]model.ComponentResultSpec, error) {
+	ret := step.PrepareResultMap()
+	var actionConfig *action.Configuration
+	for _, component := range step.Components {
+		helmProp, err := getHelmPropertyFromComponent(component.Component)
+		releaseName := GetReleaseName(component.Component, helmProp)
+		if component.Action != model.ComponentUpdate {
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Untouched,
+				Message: fmt.Sprintf("release %s would be uninstalled", releaseName),
+			}
+			continue
+		}
+		if err != nil {
+			err = v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to get helm properties", providerName), v1alpha2.GetHelmPropertyFailed)
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.UpdateFailed,
+				Message: err.Error(),
+			}
+			return ret, err
+		}
+		if actionConfig == nil {
+			actionConfig, err = i.createActionConfig(ctx, deployment.Instance.Spec.Scope)
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Helm Target): failed to create action config: %+v", err)
+				return ret, err
+			}
+		}
+		var diff string
+		diff, err = i.planComponent(ctx, deployment, helmProp, releaseName, actionConfig)
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (Helm Target): failed to compare chart of %s with release %s: %+v", component.Component.Name, releaseName, err)
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.UpdateFailed,
+				Message: err.Error(),
+			}
+			return ret, err
+		}
+		ret[component.Component.Name] = model.ComponentResultSpec{
+			Status:  v1alpha2.Untouched,
+			Message: diff,
+		}
+	}
+	return ret, nil
+}
+
+// planComponent renders the chart of a component as a dry run of its install or upgrade, and compares
+// the rendered manifest with the manifest of its release
+func (i *HelmTargetProvider) planComponent(ctx context.Context, deployment model.DeploymentSpec, helmProp *HelmProperty, releaseName string, actionConfig *action.Configuration) (string, error) {
+	resolved, err := resolveValues(ctx, i.Context, helmProp, deployment)
+	if err != nil {
+		return "", err
+	}
+	fileName, err := i.pullChart(ctx, &helmProp.Chart)
+	if err != nil {
+		return "", v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to pull chart", providerName), v1alpha2.HelmActionFailed)
+	}
+	defer os.Remove(fileName)
+	chart, err := loader.Load(fileName)
+	if err != nil {
+		return "", v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to load chart", providerName), v1alpha2.HelmActionFailed)
+	}
+	postRender := i.postRenderer(deployment, helmProp)
+
+	live := ""
+	var rendered *release.Release
+	current, err := action.NewGet(actionConfig).Run(releaseName)
+	switch {
+	case err == nil:
+		live = current.Manifest
+		var upgradeClient *action.Upgrade
+		upgradeClient, err = configureUpgradeClient(ctx, &helmProp.Chart, &deployment, actionConfig, postRender)
+		if err != nil {
+			return "", err
+		}
+		upgradeClient.DryRun = true
+		rendered, err = upgradeClient.Run(releaseName, chart, resolved.Values)
+	case errors.Is(err, driver.ErrReleaseNotFound):
+		var installClient *action.Install
+		installClient, err = configureInstallClient(ctx, releaseName, &helmProp.Chart, &deployment, actionConfig, postRender)
+		if err != nil {
+			return "", err
+		}
+		installClient.DryRun = true
+		installClient.IsUpgrade = false
+		rendered, err = installClient.Run(chart, resolved.Values)
+	default:
+		return "", v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to get release %s", providerName, releaseName), v1alpha2.HelmActionFailed)
+	}
+	if err != nil {
+		return "", v1alpha2.NewCOAError(errors.New(resolved.redact(err.Error())), fmt.Sprintf("%s: failed to render chart", providerName), v1alpha2.HelmActionFailed)
+	}
+
+	diff, err := diffManifests(live, rendered.Manifest)
+	if err != nil {
+		return "", v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to compare manifests", providerName), v1alpha2.HelmActionFailed)
+	}
+	return resolved.redact(diff), nil
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package helm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eclipse-symphony/symphony/api/constants"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+)
+
+const (
+	// releaseHashAnnotation records the hash of the values and kustomization of a release in the chart metadata
+	releaseHashAnnotation = constants.GroupPrefix + "/release-hash"
+	redactedValue         = "***"
+)
+
+type (
+	// HelmValuesSource is a catalog or a secret that values are read from
+	HelmValuesSource struct {
+		// Catalog is the name of a catalog, its properties are merged into the values
+		Catalog string `json:"catalog,omitempty"`
+		// Secret is the name of a secret, its field is set at the path in the values
+		Secret string `json:"secret,omitempty"`
+		// Field is the catalog property or secret field to read
+		Field string `json:"field,omitempty"`
+		// Path is the dot separated path the value is set at, such as db.password
+		Path string `json:"path,omitempty"`
+	}
+	// resolvedValues are the values a release is deployed with
+	resolvedValues struct {
+		Values map[string]interface{}
+		// Secrets are the values read from secrets, to redact them
+		Secrets []string
+	}
+)
+
+// hasLayeredValues returns whether the values of a component are layered from other sources than the values property
+func (p *HelmProperty) hasLayeredValues() bool {
+	return len(p.ValuesFrom) > 0 || len(p.TargetValues) > 0
+}
+
+// secretPaths returns the paths of values that are read from secrets
+func (p *HelmProperty) secretPaths() []string {
+	ret := make([]string, 0)
+	for _, source := range p.ValuesFrom {
+		if source.Secret != "" {
+			ret = append(ret, source.Path)
+		}
+	}
+	return ret
+}
+
+// validateValuesSources checks the values sources of a component
+func validateValuesSources(props *HelmProperty) error {
+	for n, source := range props.ValuesFrom {
+		switch {
+		case source.Catalog != "" && source.Secret != "":
+			return fmt.Errorf("valuesFrom[%d] has both a catalog and a secret", n)
+		case source.Catalog == "" && source.Secret == "":
+			return fmt.Errorf("valuesFrom[%d] requires a catalog or a secret", n)
+		case source.Secret != "" && (source.Field == "" || source.Path == ""):
+			return fmt.Errorf("valuesFrom[%d] requires a field and a path for secret %s", n, source.Secret)
+		case source.Catalog != "" && source.Path != "" && source.Field == "":
+			return fmt.Errorf("valuesFrom[%d] requires a field to set at path %s", n, source.Path)
+		}
+		if source.Path != "" {
+			for _, segment := range strings.Split(source.Path, ".") {
+				if segment == "" {
+					return fmt.Errorf("valuesFrom[%d] has an invalid path %s", n, source.Path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveValues layers the values of a component: catalogs of valuesFrom in order, the values property,
+// the values of the active target in targetValues, then secrets of valuesFrom
+func resolveValues(ctx context.Context, managerContext *contexts.ManagerContext, props *HelmProperty, deployment model.DeploymentSpec) (*resolvedValues, error) {
+	ret := &resolvedValues{Values: map[string]interface{}{}}
+	if !props.hasLayeredValues() {
+		mergeValues(ret.Values, props.Values)
+		return ret, nil
+	}
+
+	var evalContext *coa_utils.EvaluationContext
+	if managerContext != nil && managerContext.VencorContext != nil && managerContext.VencorContext.EvaluationContext != nil {
+		evalContext = managerContext.VencorContext.EvaluationContext.Clone()
+		evalContext.Context = ctx
+		evalContext.Namespace = deployment.Instance.ObjectMeta.Namespace
+		evalContext.DeploymentSpec = deployment
+	}
+
+	for _, source := range props.ValuesFrom {
+		if source.Catalog == "" {
+			continue
+		}
+		if evalContext == nil || evalContext.ConfigProvider == nil {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s: no config provider to read catalog %s", providerName, source.Catalog), v1alpha2.BadConfig)
+		}
+		if source.Field == "" {
+			values, err := evalContext.ConfigProvider.GetObject(ctx, source.Catalog, nil, evalContext)
+			if err != nil {
+				return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to read catalog %s", providerName, source.Catalog), v1alpha2.BadConfig)
+			}
+			mergeValues(ret.Values, values)
+			continue
+		}
+		value, err := evalContext.ConfigProvider.Get(ctx, source.Catalog, source.Field, nil, evalContext)
+		if err != nil {
+			return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to read %s of catalog %s", providerName, source.Field, source.Catalog), v1alpha2.BadConfig)
+		}
+		if source.Path != "" {
+			setValue(ret.Values, source.Path, copyValue(value))
+			continue
+		}
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s: %s of catalog %s is not an object, set a path to use it as a value", providerName, source.Field, source.Catalog), v1alpha2.BadConfig)
+		}
+		mergeValues(ret.Values, values)
+	}
+
+	mergeValues(ret.Values, props.Values)
+	if values, ok := props.TargetValues[deployment.ActiveTarget]; ok {
+		mergeValues(ret.Values, values)
+	}
+
+	for _, source := range props.ValuesFrom {
+		if source.Secret == "" {
+			continue
+		}
+		if evalContext == nil || evalContext.SecretProvider == nil {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s: no secret provider to read secret %s", providerName, source.Secret), v1alpha2.BadConfig)
+		}
+		value, err := evalContext.SecretProvider.Get(ctx, source.Secret, source.Field, evalContext)
+		if err != nil {
+			return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("%s: failed to read %s of secret %s", providerName, source.Field, source.Secret), v1alpha2.BadConfig)
+		}
+		setValue(ret.Values, source.Path, value)
+		if value != "" {
+			ret.Secrets = append(ret.Secrets, value)
+		}
+	}
+	return ret, nil
+}
+
+// hash returns the SHA-256 hash of the values and the kustomization of a release
+func (r *resolvedValues) hash(kustomization map[string]interface{}) string {
+	data, _ := json.Marshal(map[string]interface{}{"values": r.Values, "kustomize": kustomization})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// redact replaces the secrets of the values in a text, in plain text and base64 encoded
+func (r *resolvedValues) redact(text string) string {
+	for _, secret := range r.Secrets {
+		text = strings.ReplaceAll(text, base64.StdEncoding.EncodeToString([]byte(secret)), redactedValue)
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+	return text
+}
+
+// redactValues returns a copy of values with the paths that are read from secrets replaced
+func redactValues(values map[string]interface{}, paths []string) map[string]interface{} {
+	ret := map[string]interface{}{}
+	mergeValues(ret, values)
+	for _, path := range paths {
+		if hasValue(ret, path) {
+			setValue(ret, path, redactedValue)
+		}
+	}
+	return ret
+}
+
+// mergeValues merges values into dst, maps are merged recursively and other values are replaced
+func mergeValues(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = copyValue(v)
+	}
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			ret[k] = copyValue(item)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for n, item := range v {
+			ret[n] = copyValue(item)
+		}
+		return ret
+	default:
+		return value
+	}
+}
+
+// setValue sets a value at a dot separated path, creating the maps along the path
+func setValue(values map[string]interface{}, path string, value interface{}) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := values[segment].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[segment] = next
+		}
+		values = next
+	}
+	values[segments[len(segments)-1]] = value
+}
+
+func hasValue(values map[string]interface{}, path string) bool {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := values[segment].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		values = next
+	}
+	_, ok := values[segments[len(segments)-1]]
+	return ok
+}
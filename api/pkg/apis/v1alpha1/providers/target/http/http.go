@@ -117,8 +117,79 @@ func (i *HttpTargetProvider) Get(ctx context.Context, deployment model.Deploymen
 
 	sLog.InfofCtx(ctx, "  P (HTTP Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
 
-	// This provider doesn't remember what it does, so it always return nil when asked
-	return nil, nil
+	injections := &model.ValueInjections{
+		InstanceId:        deployment.Instance.ObjectMeta.Name,
+		SolutionVersionId: deployment.Instance.Spec.SolutionVersion,
+		TargetId:          deployment.ActiveTarget,
+	}
+
+	// Components without a status URL are not tracked, they are applied on every deployment
+	ret := make([]model.ComponentSpec, 0)
+	for _, component := range references {
+		statusUrl := model.ReadPropertyCompat(component.Component.Properties, httpStatusUrl, injections)
+		if statusUrl == "" {
+			continue
+		}
+		var state *model.ComponentSpec
+		state, err = i.getComponentState(ctx, deployment, component.Component, statusUrl, injections)
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (HTTP Target): failed to get state of %s: %+v", component.Component.Name, err)
+			continue
+		}
+		if state != nil {
+			ret = append(ret, *state)
+		}
+	}
+	err = nil
+	return ret, nil
+}
+
+// getComponentState reads the state of a component from its status URL. A component whose status
+// URL responds 404 is not deployed.
+func (i *HttpTargetProvider) getComponentState(ctx context.Context, deployment model.DeploymentSpec, reference model.ComponentSpec, statusUrl string, injections *model.ValueInjections) (*model.ComponentSpec, error) {
+	auth, err := readAuth(ctx, i.Context, reference.Properties, injections, deployment.Instance.ObjectMeta.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := parseSuccessCodes(model.ReadPropertyCompat(reference.Properties, httpSuccessCodes, injections))
+	if err != nil {
+		return nil, err
+	}
+	method := model.ReadPropertyCompat(reference.Properties, httpStatusMethod, injections)
+	if method == "" {
+		method = http.MethodGet
+	}
+	code, body, err := sendRequest(ctx, auth, method, statusUrl, "")
+	if err != nil {
+		return nil, err
+	}
+	if code == http.StatusNotFound {
+		sLog.InfofCtx(ctx, "  P (HTTP Target): component %s is not found", reference.Name)
+		return nil, nil
+	}
+	if !codes.matches(code) {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("status request responded %d: %s", code, string(body)), v1alpha2.HttpErrorResponse)
+	}
+	state, err := extractState(body, model.ReadPropertyCompat(reference.Properties, httpStatePath, injections))
+	if err != nil {
+		return nil, err
+	}
+
+	// the state is compared with http.state if the component sets it, or with http.body
+	ret := model.ComponentSpec{
+		Name:       reference.Name,
+		Type:       reference.Type,
+		Properties: make(map[string]interface{}),
+	}
+	for k, v := range reference.Properties {
+		ret.Properties[k] = v
+	}
+	if _, ok := reference.Properties[httpState]; ok {
+		ret.Properties[httpState] = state
+	} else {
+		ret.Properties[httpBody] = state
+	}
+	return &ret, nil
 }
 
 func (i *HttpTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
@@ -142,9 +213,9 @@ func (i *HttpTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 	)
 
 	injections := &model.ValueInjections{
-		InstanceId: deployment.Instance.ObjectMeta.Name,
+		InstanceId:        deployment.Instance.ObjectMeta.Name,
 		SolutionVersionId: deployment.Instance.Spec.SolutionVersion,
-		TargetId:   deployment.ActiveTarget,
+		TargetId:          deployment.ActiveTarget,
 	}
 	components := step.GetComponents()
 	err = i.GetValidationRule(ctx).Validate(components)
@@ -215,7 +286,30 @@ func (i *HttpTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 			}
 			request.Header.Set("Content-Type", "application/json; charset=UTF-8")
 
-			client := &http.Client{}
+			var auth *requestAuth
+			var codes statusCodes
+			auth, err = readAuth(ctx, i.Context, component.Component.Properties, injections, deployment.Instance.ObjectMeta.Namespace)
+			if err == nil {
+				codes, err = parseSuccessCodes(model.ReadPropertyCompat(component.Component.Properties, httpSuccessCodes, injections))
+			}
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (HTTP Target): %v", err)
+				providerOperationMetrics.ProviderOperationErrors(
+					httpProvider,
+					functionName,
+					metrics.ApplyOperation,
+					metrics.ApplyOperationType,
+					v1alpha2.BadConfig.String(),
+				)
+				return ret, err
+			}
+			auth.authorize(request)
+
+			client := newHttpClient(auth)
 			var resp *http.Response
 			resp, err = client.Do(request)
 			if err != nil {
@@ -233,12 +327,14 @@ func (i *HttpTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 				)
 				return ret, err
 			}
-			if resp.StatusCode != http.StatusOK {
-				bodyBytes, err := io.ReadAll(resp.Body)
+			// the body is closed before the next component is sent
+			bodyBytes, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !codes.matches(resp.StatusCode) {
 				var message string
-				if err != nil {
-					sLog.ErrorfCtx(ctx, "  P (HTTP Target): failed to read response body: %v", err)
-					message = err.Error()
+				if readErr != nil {
+					sLog.ErrorfCtx(ctx, "  P (HTTP Target): failed to read response body: %v", readErr)
+					message = readErr.Error()
 				} else {
 					message = string(bodyBytes)
 				}
@@ -246,7 +342,7 @@ func (i *HttpTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 					Status:  v1alpha2.UpdateFailed,
 					Message: message,
 				}
-				err = errors.New("HTTP request didn't respond 200 OK")
+				err = fmt.Errorf("HTTP request responded %d, which is not a success code", resp.StatusCode)
 				sLog.ErrorfCtx(ctx, "  P (HTTP Target): %v", err)
 				providerOperationMetrics.ProviderOperationErrors(
 					httpProvider,
@@ -263,20 +359,76 @@ func (i *HttpTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 				Message: "HTTP request succeeded",
 			}
 		} else {
-			sLog.InfofCtx(ctx, "  P (HTTP Target): component %s is not in update action, skipping", component.Component.Name)
+			deleteUrl := model.ReadPropertyCompat(component.Component.Properties, httpDeleteUrl, injections)
+			if deleteUrl == "" {
+				sLog.InfofCtx(ctx, "  P (HTTP Target): component %s doesn't have a %s property, skipping", component.Component.Name, httpDeleteUrl)
+				continue
+			}
+			err = i.deleteComponent(ctx, deployment, component.Component, deleteUrl, injections)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.DeleteFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (HTTP Target): failed to delete %s: %v", component.Component.Name, err)
+				providerOperationMetrics.ProviderOperationErrors(
+					httpProvider,
+					functionName,
+					metrics.ApplyOperation,
+					metrics.ApplyOperationType,
+					v1alpha2.HttpErrorResponse.String(),
+				)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Deleted,
+				Message: "HTTP request succeeded",
+			}
 		}
 	}
 	return ret, nil
 }
+
+// deleteComponent sends the delete request of a component. A component that is not found is
+// already deleted.
+func (i *HttpTargetProvider) deleteComponent(ctx context.Context, deployment model.DeploymentSpec, component model.ComponentSpec, deleteUrl string, injections *model.ValueInjections) error {
+	auth, err := readAuth(ctx, i.Context, component.Properties, injections, deployment.Instance.ObjectMeta.Namespace)
+	if err != nil {
+		return err
+	}
+	codes, err := parseSuccessCodes(model.ReadPropertyCompat(component.Properties, httpSuccessCodes, injections))
+	if err != nil {
+		return err
+	}
+	method := model.ReadPropertyCompat(component.Properties, httpDeleteMethod, injections)
+	if method == "" {
+		method = http.MethodDelete
+	}
+	sLog.InfofCtx(ctx, "  P (HTTP Target): start to send delete request to %s", deleteUrl)
+	code, body, err := sendRequest(ctx, auth, method, deleteUrl, model.ReadPropertyCompat(component.Properties, httpDeleteBody, injections))
+	if err != nil {
+		return err
+	}
+	if code != http.StatusNotFound && !codes.matches(code) {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("delete request responded %d: %s", code, string(body)), v1alpha2.HttpErrorResponse)
+	}
+	return nil
+}
+
 func (*HttpTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
 	return model.ValidationRule{
 		AllowSidecar: false,
 		ComponentValidationRule: model.ComponentValidationRule{
-			RequiredProperties:    []string{"http.url"},
-			OptionalProperties:    []string{"http.method", "http.body"},
+			RequiredProperties: []string{"http.url"},
+			OptionalProperties: []string{"http.method", httpBody, httpStatusUrl, httpStatusMethod, httpStatePath, httpState,
+				httpDeleteUrl, httpDeleteMethod, httpDeleteBody, httpSuccessCodes, httpAuthType, httpAuthSecret},
 			RequiredComponentType: "",
 			RequiredMetadata:      []string{},
 			OptionalMetadata:      []string{},
+			ChangeDetectionProperties: []model.PropertyDesc{
+				{Name: httpBody, IgnoreCase: false, SkipIfMissing: true, PropChanged: isStateChanged},
+				{Name: httpState, IgnoreCase: false, SkipIfMissing: true, PropChanged: isStateChanged},
+			},
 		},
 	}
 }
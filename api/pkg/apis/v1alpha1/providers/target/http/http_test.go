@@ -8,12 +8,17 @@ package http
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -358,3 +363,193 @@ func TestConformanceSuite(t *testing.T) {
 	assert.Nil(t, err)
 	conformance.ConformanceSuite(t, provider)
 }
+
+type testSecretProvider struct {
+	secrets map[string]map[string]string
+}
+
+func (s *testSecretProvider) Get(ctx context.Context, name string, field string, localContext interface{}) (string, error) {
+	if evalContext, ok := localContext.(*coa_utils.EvaluationContext); !ok || evalContext.Namespace != "edge" {
+		return "", errors.New("unexpected namespace")
+	}
+	if v, ok := s.secrets[name][field]; ok {
+		return v, nil
+	}
+	return "", errors.New("secret not found")
+}
+
+func newTestManagerContext() *contexts.ManagerContext {
+	return &contexts.ManagerContext{
+		VencorContext: &contexts.VendorContext{
+			EvaluationContext: &coa_utils.EvaluationContext{
+				SecretProvider: &testSecretProvider{secrets: map[string]map[string]string{
+					"device-token": {"token": "secret-token"},
+					"device-login": {"username": "admin", "password": "pass"},
+				}},
+			},
+		},
+	}
+}
+
+// TestHttpTargetProviderLifecycle tests that components are applied, read from their status URL and deleted
+func TestHttpTargetProviderLifecycle(t *testing.T) {
+	var config string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			config = string(data)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			if config == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"status":"ready","config":` + config + `}`))
+		case http.MethodDelete:
+			config = ""
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer ts.Close()
+
+	provider := HttpTargetProvider{}
+	err := provider.Init(HttpTargetProviderConfig{Name: "test"})
+	assert.Nil(t, err)
+	provider.SetContext(newTestManagerContext())
+
+	component := model.ComponentSpec{
+		Name: "http-component",
+		Properties: map[string]interface{}{
+			"http.url":         ts.URL,
+			"http.method":      "PUT",
+			"http.body":        `{"mode":"eco","level":3}`,
+			"http.statusUrl":   ts.URL,
+			"http.statePath":   "$.config",
+			"http.deleteUrl":   ts.URL,
+			"http.auth.type":   "bearer",
+			"http.auth.secret": "device-token",
+		},
+	}
+	deployment := model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "instance", Namespace: "edge"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+	references := []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}
+
+	components, err := provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(components))
+
+	ret, err := provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["http-component"].Status)
+
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+	rule := provider.GetValidationRule(context.Background())
+	assert.False(t, rule.IsComponentChanged(components[0], component))
+	changed := component
+	changed.Properties = map[string]interface{}{"http.body": `{"mode":"boost","level":3}`}
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+
+	// the state is compared with http.state when the component sets it
+	withState := component
+	withState.Properties = map[string]interface{}{}
+	for k, v := range component.Properties {
+		withState.Properties[k] = v
+	}
+	withState.Properties["http.statePath"] = "$.status"
+	withState.Properties["http.state"] = "ready"
+	components, err = provider.Get(context.Background(), deployment, []model.ComponentStep{{Action: model.ComponentUpdate, Component: withState}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+	assert.Equal(t, "ready", components[0].Properties["http.state"])
+	assert.False(t, rule.IsComponentChanged(components[0], withState))
+
+	references[0].Action = model.ComponentDelete
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["http-component"].Status)
+	assert.Equal(t, "", config)
+
+	// deleting a component that is not found succeeds
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["http-component"].Status)
+}
+
+// TestHttpTargetProviderApplyBasicAuth tests that requests are sent with basic credentials and success codes
+func TestHttpTargetProviderApplyBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	provider := HttpTargetProvider{}
+	err := provider.Init(HttpTargetProviderConfig{Name: "test"})
+	assert.Nil(t, err)
+	provider.SetContext(newTestManagerContext())
+	deployment := model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "instance", Namespace: "edge"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+	apply := func(properties map[string]interface{}) error {
+		properties["http.url"] = ts.URL
+		_, err := provider.Apply(context.Background(), deployment, model.DeploymentStep{
+			Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: model.ComponentSpec{Name: "c", Properties: properties}}},
+		}, false)
+		return err
+	}
+	assert.Nil(t, apply(map[string]interface{}{"http.auth.type": "basic", "http.auth.secret": "device-login"}))
+	assert.Nil(t, apply(map[string]interface{}{"http.auth.type": "basic", "http.auth.secret": "device-login", "http.successCodes": "201"}))
+	assert.NotNil(t, apply(map[string]interface{}{"http.auth.type": "basic", "http.auth.secret": "device-login", "http.successCodes": "200,202"}))
+	assert.NotNil(t, apply(map[string]interface{}{}))
+	assert.NotNil(t, apply(map[string]interface{}{"http.auth.type": "basic", "http.auth.secret": "missing"}))
+	assert.NotNil(t, apply(map[string]interface{}{"http.auth.type": "digest", "http.auth.secret": "device-login"}))
+	assert.NotNil(t, apply(map[string]interface{}{"http.auth.type": "bearer"}))
+}
+
+// TestParseSuccessCodes tests that success codes are parsed from codes and classes
+func TestParseSuccessCodes(t *testing.T) {
+	codes, err := parseSuccessCodes("")
+	assert.Nil(t, err)
+	assert.True(t, codes.matches(200))
+	assert.True(t, codes.matches(204))
+	assert.False(t, codes.matches(302))
+
+	codes, err = parseSuccessCodes("2xx, 304")
+	assert.Nil(t, err)
+	assert.True(t, codes.matches(299))
+	assert.True(t, codes.matches(304))
+	assert.False(t, codes.matches(404))
+
+	for _, value := range []string{"ok", "9xx", "42", "200,"} {
+		_, err = parseSuccessCodes(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+// TestIsStateChanged tests that JSON states are compared regardless of formatting
+func TestIsStateChanged(t *testing.T) {
+	assert.False(t, isStateChanged(`{"a":1,"b":[1,2]}`, `{ "b": [1, 2], "a": 1 }`))
+	assert.False(t, isStateChanged(`{"a":1}`, map[string]interface{}{"a": 1}))
+	assert.False(t, isStateChanged("ready", "ready"))
+	assert.False(t, isStateChanged("ready", nil))
+	assert.True(t, isStateChanged(`{"a":1}`, `{"a":2}`))
+	assert.True(t, isStateChanged(nil, "ready"))
+	assert.True(t, isStateChanged("stopped", "ready"))
+}
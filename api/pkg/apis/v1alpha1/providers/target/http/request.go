@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	api_utils "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+)
+
+const (
+	httpStatusUrl    = "http.statusUrl"
+	httpStatusMethod = "http.statusMethod"
+	httpStatePath    = "http.statePath"
+	httpState        = "http.state"
+	httpBody         = "http.body"
+	httpDeleteUrl    = "http.deleteUrl"
+	httpDeleteMethod = "http.deleteMethod"
+	httpDeleteBody   = "http.deleteBody"
+	httpSuccessCodes = "http.successCodes"
+	httpAuthType     = "http.auth.type"
+	httpAuthSecret   = "http.auth.secret"
+
+	authBearer = "bearer"
+	authBasic  = "basic"
+	authMTLS   = "mtls"
+)
+
+// requestAuth holds the credentials requests of a component are sent with
+type requestAuth struct {
+	Type     string
+	Token    string
+	Username string
+	Password string
+	TLS      *tls.Config
+}
+
+// readAuth reads the credentials of a component from the secret provider. Bearer secrets have a
+// token field, basic secrets username and password fields and mTLS secrets cert and key fields,
+// all PEM encoded. All secrets can have a ca field to verify the server with.
+func readAuth(ctx context.Context, managerContext *contexts.ManagerContext, properties map[string]interface{}, injections *model.ValueInjections, namespace string) (*requestAuth, error) {
+	authType := strings.ToLower(model.ReadPropertyCompat(properties, httpAuthType, injections))
+	secretName := model.ReadPropertyCompat(properties, httpAuthSecret, injections)
+	if authType == "" && secretName == "" {
+		return nil, nil
+	}
+	if authType != authBearer && authType != authBasic && authType != authMTLS {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid %s '%s', expected %s, %s or %s", httpAuthType, authType, authBearer, authBasic, authMTLS), v1alpha2.BadConfig)
+	}
+	if secretName == "" {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s is set but %s is not", httpAuthType, httpAuthSecret), v1alpha2.BadConfig)
+	}
+	if managerContext == nil || managerContext.VencorContext == nil || managerContext.VencorContext.EvaluationContext == nil ||
+		managerContext.VencorContext.EvaluationContext.SecretProvider == nil {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s is set but no secret provider is configured", httpAuthSecret), v1alpha2.BadConfig)
+	}
+	evalContext := managerContext.VencorContext.EvaluationContext.Clone()
+	evalContext.Context = ctx
+	evalContext.Namespace = namespace
+	secretProvider := evalContext.SecretProvider
+	read := func(field string) (string, error) {
+		value, err := secretProvider.Get(ctx, secretName, field, evalContext)
+		if err != nil {
+			return "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read %s from secret %s", field, secretName), v1alpha2.BadConfig)
+		}
+		return value, nil
+	}
+
+	auth := &requestAuth{Type: authType}
+	var err error
+	switch authType {
+	case authBearer:
+		if auth.Token, err = read("token"); err != nil {
+			return nil, err
+		}
+	case authBasic:
+		if auth.Username, err = read("username"); err != nil {
+			return nil, err
+		}
+		if auth.Password, err = read("password"); err != nil {
+			return nil, err
+		}
+	case authMTLS:
+		var cert, key string
+		if cert, err = read("cert"); err != nil {
+			return nil, err
+		}
+		if key, err = read("key"); err != nil {
+			return nil, err
+		}
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid client certificate in secret %s", secretName), v1alpha2.BadConfig)
+		}
+		auth.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	}
+	if ca, err := secretProvider.Get(ctx, secretName, "ca", evalContext); err == nil && ca != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid ca certificate in secret %s", secretName), v1alpha2.BadConfig)
+		}
+		if auth.TLS == nil {
+			auth.TLS = &tls.Config{}
+		}
+		auth.TLS.RootCAs = pool
+	}
+	return auth, nil
+}
+
+// newHttpClient returns a client that presents the client certificate of an auth, if any
+func newHttpClient(auth *requestAuth) *http.Client {
+	if auth == nil || auth.TLS == nil {
+		return &http.Client{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = auth.TLS
+	return &http.Client{Transport: transport}
+}
+
+// authorize adds the bearer or basic credentials of an auth to a request
+func (a *requestAuth) authorize(request *http.Request) {
+	if a == nil {
+		return
+	}
+	switch a.Type {
+	case authBearer:
+		request.Header.Set("Authorization", "Bearer "+a.Token)
+	case authBasic:
+		request.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// statusCodes is a list of status codes and ranges that a component considers successful
+type statusCodes [][2]int
+
+// parseSuccessCodes parses a comma separated list of status codes, such as "200,202", and
+// classes, such as "2xx". Any 2xx code is successful by default.
+func parseSuccessCodes(value string) (statusCodes, error) {
+	if strings.TrimSpace(value) == "" {
+		return statusCodes{{200, 299}}, nil
+	}
+	ret := statusCodes{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if len(item) == 3 && strings.HasSuffix(item, "xx") && item[0] >= '1' && item[0] <= '5' {
+			class := int(item[0]-'0') * 100
+			ret = append(ret, [2]int{class, class + 99})
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid %s '%s'", httpSuccessCodes, value), v1alpha2.BadConfig)
+		}
+		ret = append(ret, [2]int{code, code})
+	}
+	return ret, nil
+}
+
+func (c statusCodes) matches(code int) bool {
+	for _, r := range c {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRequest sends a request with the credentials of a component and returns the response
+// status code and body
+func sendRequest(ctx context.Context, auth *requestAuth, method string, url string, body string) (int, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBufferString(body))
+	if err != nil {
+		return 0, nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to create request to %s", url), v1alpha2.HttpNewRequestFailed)
+	}
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	auth.authorize(request)
+	resp, err := newHttpClient(auth).Do(request)
+	if err != nil {
+		return 0, nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to send request to %s", url), v1alpha2.HttpSendRequestFailed)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read response of %s", url), v1alpha2.HttpErrorResponse)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// extractState returns the state of a component from a status response. With a JsonPath, the
+// state is the value the JsonPath selects from the response, otherwise the whole response.
+func extractState(body []byte, statePath string) (string, error) {
+	if statePath == "" {
+		return strings.TrimSpace(string(body)), nil
+	}
+	var obj interface{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return "", v1alpha2.NewCOAError(err, "status response is not JSON", v1alpha2.HttpErrorResponse)
+	}
+	value, err := api_utils.JsonPathQuery(obj, statePath)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// isStateChanged compares a reported state with a desired state. JSON values are compared
+// regardless of formatting and key order.
+func isStateChanged(oldProp, newProp any) bool {
+	desired := toStateString(newProp)
+	if desired == "" {
+		return false
+	}
+	reported := toStateString(oldProp)
+	if desired == reported {
+		return false
+	}
+	var d, r interface{}
+	if json.Unmarshal([]byte(desired), &d) != nil || json.Unmarshal([]byte(reported), &r) != nil {
+		return true
+	}
+	dData, _ := json.Marshal(d)
+	rData, _ := json.Marshal(r)
+	return string(dData) != string(rData)
+}
+
+func toStateString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
@@ -27,6 +27,14 @@ TLS/Certificate settings:
 - clientKeyPath: Path to client private key file for mutual TLS authentication
 - insecureSkipVerify: Skip TLS certificate verification (default: false, use with caution)
 
+Delivery settings:
+- protocolVersion: MQTT protocol version, "5" or "3.1.1" (default: "5")
+- qos: Quality of service of requests and responses, 0, 1 or 2 (default: 0)
+- persistentSession: Connect with clientID and keep the session on the broker across reconnects (default: false)
+- sessionStoreFolder: Folder that keeps in-flight messages of the session across restarts
+- queueSize: Number of requests queued while the broker is unreachable (default: 100)
+- retryIntervalSeconds: Interval between attempts to publish queued requests (default: 5)
+
 */
 
 package mqtt
@@ -46,6 +54,7 @@ import (
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/metrics"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	mqttbinding "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/mqtt"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
@@ -53,7 +62,6 @@ import (
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
 	coalogcontexts "github.com/eclipse-symphony/symphony/coa/pkg/logger/contexts"
-	gmqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 )
 
@@ -86,6 +94,13 @@ type MQTTTargetProviderConfig struct {
 	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
 	Username           string `json:"username,omitempty"`
 	Password           string `json:"password,omitempty"`
+	// Delivery configuration fields
+	ProtocolVersion      string `json:"protocolVersion,omitempty"`
+	QoS                  int    `json:"qos,omitempty"`
+	PersistentSession    bool   `json:"persistentSession,omitempty"`
+	SessionStoreFolder   string `json:"sessionStoreFolder,omitempty"`
+	QueueSize            int    `json:"queueSize,omitempty"`
+	RetryIntervalSeconds int    `json:"retryIntervalSeconds,omitempty"`
 }
 
 var lock sync.Mutex
@@ -98,9 +113,11 @@ type ProxyResponse struct {
 type MQTTTargetProvider struct {
 	Config        MQTTTargetProviderConfig
 	Context       *contexts.ManagerContext
-	MQTTClient    gmqtt.Client
+	MQTTClient    mqttbinding.Client
+	Outbox        *mqttbinding.Outbox
 	ResponseChans sync.Map
 	Initialized   bool
+	cancel        context.CancelFunc
 }
 
 func MQTTTargetProviderConfigFromMap(properties map[string]string) (MQTTTargetProviderConfig, error) {
@@ -182,6 +199,44 @@ func MQTTTargetProviderConfigFromMap(properties map[string]string) (MQTTTargetPr
 		ret.Password = v
 	}
 
+	// Handle delivery configuration
+	if v, ok := properties["protocolVersion"]; ok {
+		ret.ProtocolVersion = v
+	}
+	if v, ok := properties["qos"]; ok {
+		if num, err := strconv.Atoi(v); err == nil {
+			ret.QoS = num
+		} else {
+			return ret, v1alpha2.NewCOAError(nil, "'qos' is not an integer in MQTT provider config", v1alpha2.BadConfig)
+		}
+	}
+	if v, ok := properties["persistentSession"]; ok {
+		ret.PersistentSession = v == "true"
+	}
+	if v, ok := properties["sessionStoreFolder"]; ok {
+		ret.SessionStoreFolder = v
+	}
+	if v, ok := properties["queueSize"]; ok {
+		if num, err := strconv.Atoi(v); err == nil {
+			ret.QueueSize = num
+		} else {
+			return ret, v1alpha2.NewCOAError(nil, "'queueSize' is not an integer in MQTT provider config", v1alpha2.BadConfig)
+		}
+	}
+	if v, ok := properties["retryIntervalSeconds"]; ok {
+		if num, err := strconv.Atoi(v); err == nil {
+			ret.RetryIntervalSeconds = num
+		} else {
+			return ret, v1alpha2.NewCOAError(nil, "'retryIntervalSeconds' is not an integer in MQTT provider config", v1alpha2.BadConfig)
+		}
+	}
+	if err := mqttbinding.ValidateQoS(ret.QoS); err != nil {
+		return ret, v1alpha2.NewCOAError(err, "'qos' is invalid in MQTT provider config", v1alpha2.BadConfig)
+	}
+	if err := mqttbinding.ValidateProtocolVersion(ret.ProtocolVersion); err != nil {
+		return ret, v1alpha2.NewCOAError(err, "'protocolVersion' is invalid in MQTT provider config", v1alpha2.BadConfig)
+	}
+
 	return ret, nil
 }
 
@@ -219,78 +274,72 @@ func (i *MQTTTargetProvider) Init(config providers.IProviderConfig) error {
 		sLog.ErrorfCtx(ctx, "  P (MQTT Target): expected MQTTTargetProviderConfig: %+v", err)
 		return err
 	}
-	i.Config = updateConfig
-	id := uuid.New()
-	opts := gmqtt.NewClientOptions().AddBroker(i.Config.BrokerAddress).SetClientID(id.String())
-	opts.SetKeepAlive(time.Duration(i.Config.KeepAliveSeconds) * time.Second)
-	opts.SetPingTimeout(time.Duration(i.Config.PingTimeoutSeconds) * time.Second)
-	opts.CleanSession = true
-
-	// Configure authentication
-	if i.Config.Username != "" {
-		opts.SetUsername(i.Config.Username)
+	if err = mqttbinding.ValidateQoS(updateConfig.QoS); err != nil {
+		sLog.ErrorfCtx(ctx, "  P (MQTT Target): invalid MQTTTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "'qos' is invalid in MQTT provider config", v1alpha2.BadConfig)
+		return err
 	}
-	if i.Config.Password != "" {
-		opts.SetPassword(i.Config.Password)
+	if err = mqttbinding.ValidateProtocolVersion(updateConfig.ProtocolVersion); err != nil {
+		sLog.ErrorfCtx(ctx, "  P (MQTT Target): invalid MQTTTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "'protocolVersion' is invalid in MQTT provider config", v1alpha2.BadConfig)
+		return err
 	}
+	i.Config = updateConfig
+	clientConfig := mqttbinding.ClientConfig{
+		ProtocolVersion:    i.Config.ProtocolVersion,
+		BrokerAddress:      i.Config.BrokerAddress,
+		ClientID:           uuid.New().String(),
+		Username:           i.Config.Username,
+		Password:           i.Config.Password,
+		KeepAlive:          time.Duration(i.Config.KeepAliveSeconds) * time.Second,
+		PingTimeout:        time.Duration(i.Config.PingTimeoutSeconds) * time.Second,
+		ConnectTimeout:     time.Duration(i.Config.TimeoutSeconds) * time.Second,
+		PersistentSession:  i.Config.PersistentSession,
+		SessionStoreFolder: i.Config.SessionStoreFolder,
+		Topic:              i.Config.ResponseTopic,
+		QoS:                byte(i.Config.QoS),
+		OnMessage:          i.handleResponse,
+	}
+	if i.Config.PersistentSession {
+		// the broker keeps the subscription and the undelivered responses of a session by its client id
+		clientConfig.ClientID = i.Config.ClientID
+	}
+	i.Outbox = mqttbinding.NewOutbox(i.Config.QueueSize, time.Duration(i.Config.TimeoutSeconds)*time.Second)
+	clientConfig.OnConnect = i.Outbox.Flush
 
 	// Configure TLS if enabled
 	if i.Config.UseTLS {
-		tlsConfig, err := i.createTLSConfig(ctx)
+		clientConfig.TLSConfig, err = i.createTLSConfig(ctx)
 		if err != nil {
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to create TLS config - %+v", err)
-			return v1alpha2.NewCOAError(err, "failed to create TLS config", v1alpha2.InternalError)
+			err = v1alpha2.NewCOAError(err, "failed to create TLS config", v1alpha2.InternalError)
+			return err
 		}
-		opts.SetTLSConfig(tlsConfig)
 	}
 
-	i.MQTTClient = gmqtt.NewClient(opts)
-	if token := i.MQTTClient.Connect(); token.Wait() && token.Error() != nil {
-		connErr := token.Error()
-		sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to connect to MQTT broker - %+v", connErr)
-		
+	i.MQTTClient, err = mqttbinding.Connect(clientConfig)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to connect to MQTT broker - %+v", err)
+
 		// Provide specific guidance for common TLS errors
-		if strings.Contains(connErr.Error(), "certificate signed by unknown authority") {
+		if strings.Contains(err.Error(), "certificate signed by unknown authority") {
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): TLS certificate verification failed. Common solutionversions:")
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): 1. Set 'caCertPath' to the path of your broker's CA certificate")
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): 2. Set 'insecureSkipVerify' to 'true' for testing (not recommended for production)")
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): 3. Ensure your broker certificate is issued by a trusted CA")
-		} else if strings.Contains(connErr.Error(), "tls:") {
+		} else if strings.Contains(err.Error(), "tls:") {
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): TLS connection error. Check your TLS configuration:")
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): - Broker address should use 'ssl://' or 'tls://' prefix for TLS connections")
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): - Verify CA certificate path and format")
 			sLog.ErrorfCtx(ctx, "  P (MQTT Target): - Check client certificate and key paths if using mutual TLS")
 		}
-		
-		return v1alpha2.NewCOAError(connErr, "failed to connect to MQTT broker", v1alpha2.InternalError)
-	}
-
-	if token := i.MQTTClient.Subscribe(i.Config.ResponseTopic, 0, func(client gmqtt.Client, msg gmqtt.Message) {
-		var response v1alpha2.COAResponse
-		json.Unmarshal(msg.Payload(), &response)
-		proxyResponse := ProxyResponse{
-			IsOK:    response.State == v1alpha2.OK || response.State == v1alpha2.Accepted,
-			State:   response.State,
-			Payload: response.String(),
-		}
-
-		if !proxyResponse.IsOK {
-			proxyResponse.Payload = string(response.Body)
-		}
 
-		if reqId, ok := response.Metadata["request-id"]; ok {
-			if ch, ok := i.ResponseChans.Load(reqId); ok {
-				ch.(chan ProxyResponse) <- proxyResponse
-				i.ResponseChans.Delete(reqId)
-			}
-		}
-	}); token.Wait() && token.Error() != nil {
-		if token.Error().Error() != "subscription exists" {
-			sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to connect to subscribe to the response topic - %+v", token.Error())
-			err = v1alpha2.NewCOAError(token.Error(), "failed to subscribe to response topic", v1alpha2.InternalError)
-			return err
-		}
+		err = v1alpha2.NewCOAError(err, "failed to connect to MQTT broker", v1alpha2.InternalError)
+		return err
 	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	go i.Outbox.Run(runCtx, i.MQTTClient, time.Duration(i.Config.RetryIntervalSeconds)*time.Second)
 	i.Initialized = true
 
 	once.Do(func() {
@@ -304,6 +353,81 @@ func (i *MQTTTargetProvider) Init(config providers.IProviderConfig) error {
 
 	return err
 }
+
+// Close stops publishing queued requests and disconnects from the broker
+func (i *MQTTTargetProvider) Close() {
+	lock.Lock()
+	defer lock.Unlock()
+	if i.cancel != nil {
+		i.cancel()
+		i.cancel = nil
+	}
+	if i.MQTTClient != nil {
+		i.MQTTClient.Disconnect()
+	}
+	i.Initialized = false
+}
+
+// handleResponse passes a response to the request waiting for it, by its correlation data, or by its
+// request id for agents that don't echo correlation data. With MQTT 3.1.1, the correlation data is
+// read from the metadata of the response.
+func (i *MQTTTargetProvider) handleResponse(client mqttbinding.Client, msg mqttbinding.Message) {
+	var response v1alpha2.COAResponse
+	json.Unmarshal(msg.Payload, &response)
+	proxyResponse := ProxyResponse{
+		IsOK:    response.State == v1alpha2.OK || response.State == v1alpha2.Accepted,
+		State:   response.State,
+		Payload: response.String(),
+	}
+
+	if !proxyResponse.IsOK {
+		proxyResponse.Payload = string(response.Body)
+	}
+
+	reqId, ok := string(msg.CorrelationData), len(msg.CorrelationData) > 0
+	if !ok {
+		reqId, ok = response.Metadata[mqttbinding.CorrelationDataKey]
+	}
+	if !ok {
+		reqId, ok = response.Metadata[mqttbinding.RequestIDKey]
+	}
+	if ok {
+		if ch, ok := i.ResponseChans.LoadAndDelete(reqId); ok {
+			ch.(chan ProxyResponse) <- proxyResponse
+		}
+	}
+}
+
+// publish sends a request with the response topic and the correlation data its response is expected with.
+// They're sent as MQTT 5 properties, or in the metadata of the request with MQTT 3.1.1. The request is
+// queued while the broker is unreachable, and expires when the provider stops waiting for it.
+func (i *MQTTTargetProvider) publish(ctx context.Context, requestId string, request v1alpha2.COARequest) error {
+	expiresAt := time.Now().Add(time.Duration(i.Config.TimeoutSeconds) * time.Second)
+	message := mqttbinding.Message{
+		Topic:     i.Config.RequestTopic,
+		QoS:       byte(i.Config.QoS),
+		ExpiresAt: expiresAt,
+	}
+	if i.MQTTClient.HasProperties() {
+		message.ResponseTopic = i.Config.ResponseTopic
+		message.CorrelationData = []byte(requestId)
+	} else {
+		if request.Metadata == nil {
+			request.Metadata = make(map[string]string)
+		}
+		request.Metadata[mqttbinding.ResponseTopicKey] = i.Config.ResponseTopic
+		request.Metadata[mqttbinding.CorrelationDataKey] = requestId
+		request.Metadata[mqttbinding.ExpiresAtKey] = expiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	var err error
+	message.Payload, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	sLog.InfofCtx(ctx, "  P (MQTT Target): start to publish on topic %s", i.Config.RequestTopic)
+	return i.Outbox.Publish(i.MQTTClient, message)
+}
+
 func toMQTTTargetProviderConfig(config providers.IProviderConfig) (MQTTTargetProviderConfig, error) {
 	ret := MQTTTargetProviderConfig{}
 	data, err := json.Marshal(config)
@@ -330,8 +454,9 @@ func (i *MQTTTargetProvider) Get(ctx context.Context, deployment model.Deploymen
 	ctx = coalogcontexts.GenerateCorrelationIdToParentContextIfMissing(ctx)
 
 	reqId := uuid.New().String()
-	responseChan := make(chan ProxyResponse)
+	responseChan := make(chan ProxyResponse, 1)
 	i.ResponseChans.Store(reqId, responseChan)
+	defer i.ResponseChans.Delete(reqId)
 	request := v1alpha2.COARequest{
 		Route:  "instances",
 		Method: "GET",
@@ -344,10 +469,8 @@ func (i *MQTTTargetProvider) Get(ctx context.Context, deployment model.Deploymen
 	}
 	data, _ = json.Marshal(request)
 
-	sLog.InfofCtx(ctx, "  P (MQTT Target): start to publish on topic %s", i.Config.RequestTopic)
-	if token := i.MQTTClient.Publish(i.Config.RequestTopic, 0, false, data); token.Wait() && token.Error() != nil {
-		sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to getting artifacts - %s", token.Error())
-		err = token.Error()
+	if err = i.publish(ctx, reqId, request); err != nil {
+		sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to getting artifacts - %s", err)
 		return nil, err
 	}
 	timeout := time.After(time.Duration(i.Config.TimeoutSeconds) * time.Second)
@@ -388,8 +511,9 @@ func (i *MQTTTargetProvider) Remove(ctx context.Context, deployment model.Deploy
 	ctx = coalogcontexts.GenerateCorrelationIdToParentContextIfMissing(ctx)
 
 	reqId := uuid.New().String()
-	responseChan := make(chan ProxyResponse)
+	responseChan := make(chan ProxyResponse, 1)
 	i.ResponseChans.Store(reqId, responseChan)
+	defer i.ResponseChans.Delete(reqId)
 	request := v1alpha2.COARequest{
 		Route:  "instances",
 		Method: "DELETE",
@@ -400,11 +524,8 @@ func (i *MQTTTargetProvider) Remove(ctx context.Context, deployment model.Deploy
 		},
 		Context: ctx,
 	}
-	data, _ = json.Marshal(request)
 
-	sLog.InfofCtx(ctx, "  P (MQTT Target): start to publish on topic %s", i.Config.RequestTopic)
-	if token := i.MQTTClient.Publish(i.Config.RequestTopic, 0, false, data); token.Wait() && token.Error() != nil {
-		err = token.Error()
+	if err = i.publish(ctx, reqId, request); err != nil {
 		sLog.ErrorfCtx(ctx, "  P (MQTT Target): failed to publish - %v", err)
 		return err
 	}
@@ -482,16 +603,14 @@ func (i *MQTTTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 			},
 			Context: ctx,
 		}
-		data, _ = json.Marshal(request)
 
 		utils.EmitUserAuditsLogs(ctx, "  P (MQTT Target): Start to send Apply()-Update request over MQTT on topic %s", i.Config.RequestTopic)
 
-		responseChan := make(chan ProxyResponse)
+		responseChan := make(chan ProxyResponse, 1)
 		i.ResponseChans.Store(requestId, responseChan)
+		defer i.ResponseChans.Delete(requestId)
 
-		sLog.InfofCtx(ctx, "  P (MQTT Target): start to publish on topic %s", i.Config.RequestTopic)
-		if token := i.MQTTClient.Publish(i.Config.RequestTopic, 0, false, data); token.Wait() && token.Error() != nil {
-			err = token.Error()
+		if err = i.publish(ctx, requestId, request); err != nil {
 			providerOperationMetrics.ProviderOperationErrors(
 				mqtt,
 				functionName,
@@ -557,15 +676,14 @@ func (i *MQTTTargetProvider) Apply(ctx context.Context, deployment model.Deploym
 			},
 			Context: ctx,
 		}
-		data, _ = json.Marshal(request)
 
 		utils.EmitUserAuditsLogs(ctx, "  P (MQTT Target): Start to send Apply()-Delete action over MQTT on topic %s", i.Config.RequestTopic)
 
-		responseChan := make(chan ProxyResponse)
+		responseChan := make(chan ProxyResponse, 1)
 		i.ResponseChans.Store(requestId, responseChan)
+		defer i.ResponseChans.Delete(requestId)
 
-		if token := i.MQTTClient.Publish(i.Config.RequestTopic, 0, false, data); token.Wait() && token.Error() != nil {
-			err = token.Error()
+		if err = i.publish(ctx, requestId, request); err != nil {
 			providerOperationMetrics.ProviderOperationErrors(
 				mqtt,
 				functionName,
@@ -16,18 +16,21 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	mqttbinding "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/mqtt"
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger/contexts"
 	gmqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
@@ -1168,3 +1171,255 @@ func TestConformanceSuite(t *testing.T) {
 	// assert.Nil(t, err) okay if provider is not fully initialized
 	conformance.ConformanceSuite(t, provider)
 }
+
+// fakeAgent is an MQTT client that answers requests with respond, and fails to publish while it's offline
+type fakeAgent struct {
+	lock       sync.Mutex
+	offline    bool
+	properties bool
+	requests   []v1alpha2.COARequest
+	messages   []mqttbinding.Message
+	respond    func(request v1alpha2.COARequest, message mqttbinding.Message)
+}
+
+func (c *fakeAgent) setOffline(offline bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.offline = offline
+}
+
+func (c *fakeAgent) HasProperties() bool { return c.properties }
+func (c *fakeAgent) IsConnected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.offline
+}
+func (c *fakeAgent) Publish(message mqttbinding.Message, timeout time.Duration) error {
+	c.lock.Lock()
+	if c.offline {
+		c.lock.Unlock()
+		return errors.New("not connected")
+	}
+	var request v1alpha2.COARequest
+	json.Unmarshal(message.Payload, &request)
+	c.requests = append(c.requests, request)
+	c.messages = append(c.messages, message)
+	c.lock.Unlock()
+	if c.respond != nil {
+		c.respond(request, message)
+	}
+	return nil
+}
+func (c *fakeAgent) Disconnect() {}
+
+func newFakeAgentProvider(agent *fakeAgent) *MQTTTargetProvider {
+	provider := &MQTTTargetProvider{
+		Config: MQTTTargetProviderConfig{
+			Name:           "me",
+			RequestTopic:   "coa-request",
+			ResponseTopic:  "coa-response/me",
+			TimeoutSeconds: 2,
+			QoS:            1,
+		},
+		MQTTClient:  agent,
+		Outbox:      mqttbinding.NewOutbox(10, time.Second),
+		Initialized: true,
+	}
+	return provider
+}
+
+// respondWith answers a request with the metadata and the correlation data returned by reply
+func respondWith(provider *MQTTTargetProvider, reply func(request v1alpha2.COARequest, message mqttbinding.Message) (map[string]string, []byte)) func(request v1alpha2.COARequest, message mqttbinding.Message) {
+	return func(request v1alpha2.COARequest, message mqttbinding.Message) {
+		data, _ := json.Marshal([]model.ComponentSpec{{Name: "a"}})
+		metadata, correlationData := reply(request, message)
+		response := v1alpha2.COAResponse{
+			State:    v1alpha2.OK,
+			Body:     data,
+			Metadata: metadata,
+		}
+		data, _ = json.Marshal(response)
+		provider.handleResponse(nil, mqttbinding.Message{Topic: "coa-response", Payload: data, CorrelationData: correlationData})
+	}
+}
+
+// echoMetadata answers like an agent that speaks MQTT 3.1.1
+func echoMetadata(key string) func(request v1alpha2.COARequest, message mqttbinding.Message) (map[string]string, []byte) {
+	return func(request v1alpha2.COARequest, message mqttbinding.Message) (map[string]string, []byte) {
+		return map[string]string{key: request.Metadata[key]}, nil
+	}
+}
+
+func TestMQTTTargetProviderConfigFromMapDelivery(t *testing.T) {
+	properties := map[string]string{
+		"brokerAddress":        "tcp://127.0.0.1:1883",
+		"clientID":             "coa-test2",
+		"requestTopic":         "coa-request",
+		"responseTopic":        "coa-response",
+		"qos":                  "2",
+		"persistentSession":    "true",
+		"sessionStoreFolder":   "/var/lib/symphony/mqtt",
+		"queueSize":            "10",
+		"retryIntervalSeconds": "3",
+	}
+	config, err := MQTTTargetProviderConfigFromMap(properties)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, config.QoS)
+	assert.True(t, config.PersistentSession)
+	assert.Equal(t, "/var/lib/symphony/mqtt", config.SessionStoreFolder)
+	assert.Equal(t, 10, config.QueueSize)
+	assert.Equal(t, 3, config.RetryIntervalSeconds)
+
+	for key, value := range map[string]string{"qos": "3", "queueSize": "many", "retryIntervalSeconds": "soon"} {
+		invalid := map[string]string{}
+		for k, v := range properties {
+			invalid[k] = v
+		}
+		invalid[key] = value
+		_, err = MQTTTargetProviderConfigFromMap(invalid)
+		assert.NotNil(t, err, key)
+	}
+}
+
+func TestInitInvalidQoS(t *testing.T) {
+	provider := MQTTTargetProvider{}
+	err := provider.Init(MQTTTargetProviderConfig{
+		BrokerAddress: "tcp://127.0.0.1:1883",
+		RequestTopic:  "coa-request",
+		ResponseTopic: "coa-response",
+		QoS:           -1,
+	})
+	assert.NotNil(t, err)
+	assert.False(t, provider.Initialized)
+}
+
+func TestGetResponseTopicAndCorrelationData(t *testing.T) {
+	// with MQTT 3.1.1, the response topic, correlation data and expiry are carried in the metadata
+	agent := &fakeAgent{}
+	provider := newFakeAgentProvider(agent)
+	agent.respond = respondWith(provider, echoMetadata(mqttbinding.CorrelationDataKey))
+
+	components, err := provider.Get(context.Background(), model.DeploymentSpec{
+		Instance: model.InstanceState{
+			Spec: &model.InstanceSpec{},
+		},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+
+	assert.Equal(t, 1, len(agent.requests))
+	metadata := agent.requests[0].Metadata
+	assert.Equal(t, "coa-response/me", metadata[mqttbinding.ResponseTopicKey])
+	assert.Equal(t, metadata[mqttbinding.RequestIDKey], metadata[mqttbinding.CorrelationDataKey])
+	assert.False(t, mqttbinding.IsExpired(metadata, time.Now()))
+	assert.True(t, mqttbinding.IsExpired(metadata, time.Now().Add(3*time.Second)))
+}
+
+func TestGetRequestIDResponse(t *testing.T) {
+	agent := &fakeAgent{}
+	provider := newFakeAgentProvider(agent)
+	// agents that don't echo correlation data are matched by request id
+	agent.respond = respondWith(provider, echoMetadata(mqttbinding.RequestIDKey))
+
+	components, err := provider.Get(context.Background(), model.DeploymentSpec{
+		Instance: model.InstanceState{
+			Spec: &model.InstanceSpec{},
+		},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+}
+
+func TestRemoveQueuedWhileOffline(t *testing.T) {
+	agent := &fakeAgent{offline: true, properties: true}
+	provider := newFakeAgentProvider(agent)
+	agent.respond = respondWith(provider, func(request v1alpha2.COARequest, message mqttbinding.Message) (map[string]string, []byte) {
+		return nil, message.CorrelationData
+	})
+
+	go func() {
+		assert.Eventually(t, func() bool {
+			return provider.Outbox.Len() == 1
+		}, time.Second, 10*time.Millisecond)
+		agent.setOffline(false)
+		provider.Outbox.Flush(agent)
+	}()
+	err := provider.Remove(context.Background(), model.DeploymentSpec{
+		Instance: model.InstanceState{
+			Spec: &model.InstanceSpec{},
+		},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, provider.Outbox.Len())
+}
+
+func TestRemoveTimeoutLateResponse(t *testing.T) {
+	agent := &fakeAgent{offline: true}
+	provider := newFakeAgentProvider(agent)
+	provider.Config.TimeoutSeconds = 1
+
+	err := provider.Remove(context.Background(), model.DeploymentSpec{
+		Instance: model.InstanceState{
+			Spec: &model.InstanceSpec{},
+		},
+	}, nil)
+	assert.NotNil(t, err)
+
+	// the expired request isn't sent after the reconnect, and late responses don't block
+	agent.setOffline(false)
+	provider.Outbox.Flush(agent)
+	assert.Empty(t, agent.requests)
+	respondWith(provider, func(request v1alpha2.COARequest, message mqttbinding.Message) (map[string]string, []byte) {
+		return nil, []byte("late")
+	})(v1alpha2.COARequest{}, mqttbinding.Message{})
+}
+
+func TestGetProperties(t *testing.T) {
+	agent := &fakeAgent{properties: true}
+	provider := newFakeAgentProvider(agent)
+	agent.respond = respondWith(provider, func(request v1alpha2.COARequest, message mqttbinding.Message) (map[string]string, []byte) {
+		return nil, message.CorrelationData
+	})
+
+	components, err := provider.Get(context.Background(), model.DeploymentSpec{
+		Instance: model.InstanceState{
+			Spec: &model.InstanceSpec{},
+		},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+
+	// with MQTT 5, the response topic, correlation data and expiry are properties of the request
+	assert.Equal(t, 1, len(agent.messages))
+	message := agent.messages[0]
+	assert.Equal(t, "coa-request", message.Topic)
+	assert.Equal(t, byte(1), message.QoS)
+	assert.Equal(t, "coa-response/me", message.ResponseTopic)
+	assert.Equal(t, agent.requests[0].Metadata[mqttbinding.RequestIDKey], string(message.CorrelationData))
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), message.ExpiresAt, time.Second)
+	for _, key := range []string{mqttbinding.ResponseTopicKey, mqttbinding.CorrelationDataKey, mqttbinding.ExpiresAtKey} {
+		_, ok := agent.requests[0].Metadata[key]
+		assert.False(t, ok, key)
+	}
+}
+
+func TestInitInvalidProtocolVersion(t *testing.T) {
+	_, err := MQTTTargetProviderConfigFromMap(map[string]string{
+		"brokerAddress":   "tcp://127.0.0.1:1883",
+		"clientID":        "coa-test2",
+		"requestTopic":    "coa-request",
+		"responseTopic":   "coa-response",
+		"protocolVersion": "4",
+	})
+	assert.NotNil(t, err)
+
+	provider := MQTTTargetProvider{}
+	err = provider.Init(MQTTTargetProviderConfig{
+		BrokerAddress:   "tcp://127.0.0.1:1883",
+		RequestTopic:    "coa-request",
+		ResponseTopic:   "coa-response",
+		ProtocolVersion: "4",
+	})
+	assert.NotNil(t, err)
+	assert.False(t, provider.Initialized)
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/pluginutils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	utils2 "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+const (
+	loggerName = "providers.target.plugin"
+
+	// HealthRoute, RuleRoute, GetRoute and ApplyRoute are the routes a target plugin serves, relative to its URL
+	HealthRoute = pluginutils.HealthRoute
+	RuleRoute   = "rule"
+	GetRoute    = "get"
+	ApplyRoute  = "apply"
+)
+
+var sLog = logger.NewLogger(loggerName)
+
+type PluginTargetProviderConfig struct {
+	Name string `json:"name"`
+	// URL is the base URL of the plugin, such as http://firmware.tools.svc:8080/v1/
+	URL string `json:"url"`
+	// Token, if set, is sent to the plugin as a bearer token
+	Token string `json:"token,omitempty"`
+	// Timeout is the maximum duration of a call
+	Timeout string `json:"timeout,omitempty"`
+	// HealthInterval is how long a health check result is reused. Set it to "0s" to check before every call.
+	HealthInterval string `json:"healthInterval,omitempty"`
+}
+
+// PluginGetRequest is the body of the get call
+type PluginGetRequest struct {
+	Deployment model.DeploymentSpec  `json:"deployment"`
+	References []model.ComponentStep `json:"references"`
+}
+
+// PluginGetResponse is the body a plugin returns from the get call
+type PluginGetResponse struct {
+	Components []model.ComponentSpec `json:"components"`
+}
+
+// PluginApplyRequest is the body of the apply call. Dry runs are sent to the plugin, which
+// should validate the step without changing anything.
+type PluginApplyRequest struct {
+	Deployment model.DeploymentSpec `json:"deployment"`
+	Step       model.DeploymentStep `json:"step"`
+	IsDryRun   bool                 `json:"isDryRun,omitempty"`
+}
+
+// PluginApplyResponse is the body a plugin returns from the apply call. Components that are
+// missing from the results keep the status of their action.
+type PluginApplyResponse struct {
+	Components map[string]model.ComponentResultSpec `json:"components,omitempty"`
+}
+
+// PluginTargetProvider deploys components with an out-of-process plugin, which serves the plugin
+// HTTP contract shared with stage plugins
+type PluginTargetProvider struct {
+	Config  PluginTargetProviderConfig
+	Context *contexts.ManagerContext
+	client  *pluginutils.Client
+
+	ruleLock sync.Mutex
+	rule     *model.ValidationRule
+}
+
+func PluginTargetProviderConfigFromMap(properties map[string]string) (PluginTargetProviderConfig, error) {
+	ret := PluginTargetProviderConfig{}
+	ret.Name = properties["name"]
+	ret.URL = properties["url"]
+	ret.Token = properties["token"]
+	ret.Timeout = properties["timeout"]
+	ret.HealthInterval = properties["healthInterval"]
+	return ret, nil
+}
+
+func (i *PluginTargetProvider) InitWithMap(properties map[string]string) error {
+	config, err := PluginTargetProviderConfigFromMap(properties)
+	if err != nil {
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *PluginTargetProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *PluginTargetProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("Plugin Target Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Plugin Target): Init()")
+
+	updateConfig, err := toPluginTargetProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Target): expected PluginTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected PluginTargetProviderConfig", v1alpha2.InitFailed)
+		return err
+	}
+	i.client, err = pluginutils.NewClient(updateConfig.URL, updateConfig.Token, updateConfig.Timeout, updateConfig.HealthInterval)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Target): invalid plugin config: %+v", err)
+		return err
+	}
+	updateConfig.URL = i.client.URL
+	i.Config = updateConfig
+
+	i.ruleLock.Lock()
+	i.rule = nil
+	i.ruleLock.Unlock()
+	return nil
+}
+
+func toPluginTargetProviderConfig(config providers.IProviderConfig) (PluginTargetProviderConfig, error) {
+	ret := PluginTargetProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = utils2.UnmarshalJson(data, &ret)
+	return ret, err
+}
+
+// call checks the plugin URL and health, and calls a route of the plugin
+func (i *PluginTargetProvider) call(ctx context.Context, route string, request interface{}, response interface{}) error {
+	if err := i.client.ValidateURL(i.Context); err != nil {
+		return err
+	}
+	if err := i.client.CheckHealth(ctx); err != nil {
+		return v1alpha2.NewCOAError(err, "plugin is unhealthy", v1alpha2.InternalError)
+	}
+	return i.client.Call(ctx, route, request, response)
+}
+
+func (i *PluginTargetProvider) Get(ctx context.Context, deployment model.DeploymentSpec, references []model.ComponentStep) ([]model.ComponentSpec, error) {
+	ctx, span := observability.StartSpan("Plugin Target Provider", ctx, &map[string]string{
+		"method": "Get",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Plugin Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	var response PluginGetResponse
+	err = i.call(ctx, GetRoute, PluginGetRequest{Deployment: deployment, References: references}, &response)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Target): failed to get artifacts - %+v", err)
+		return nil, err
+	}
+	return response.Components, nil
+}
+
+func (i *PluginTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
+	ctx, span := observability.StartSpan("Plugin Target Provider", ctx, &map[string]string{
+		"method": "Apply",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Plugin Target): applying artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	components := step.GetComponents()
+	err = i.GetValidationRule(ctx).Validate(components)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Target): failed to validate components: %+v", err)
+		return nil, err
+	}
+
+	ret := step.PrepareResultMap()
+	var response PluginApplyResponse
+	err = i.call(ctx, ApplyRoute, PluginApplyRequest{Deployment: deployment, Step: step, IsDryRun: isDryRun}, &response)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Plugin Target): failed to apply components - %+v", err)
+		for _, component := range step.GetUpdatedComponents() {
+			ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.UpdateFailed, Message: err.Error()}
+		}
+		for _, component := range step.GetDeletedComponents() {
+			ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.DeleteFailed, Message: err.Error()}
+		}
+		return ret, err
+	}
+	for _, component := range step.GetUpdatedComponents() {
+		ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.Updated, Message: ""}
+	}
+	for _, component := range step.GetDeletedComponents() {
+		ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.Deleted, Message: ""}
+	}
+	for name, result := range response.Components {
+		ret[name] = result
+	}
+	return ret, nil
+}
+
+// GetValidationRule returns the rule the plugin serves on its rule route. The rule is fetched
+// once; while the plugin can't be reached, components aren't validated by the provider.
+func (i *PluginTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
+	i.ruleLock.Lock()
+	defer i.ruleLock.Unlock()
+	if i.rule != nil {
+		return *i.rule
+	}
+
+	var rule model.ValidationRule
+	if err := i.call(ctx, RuleRoute, nil, &rule); err != nil {
+		sLog.WarnfCtx(ctx, "  P (Plugin Target): failed to get the validation rule of the plugin - %+v", err)
+		return model.ValidationRule{
+			ComponentValidationRule: model.ComponentValidationRule{
+				RequiredProperties: []string{},
+				OptionalProperties: []string{},
+				RequiredMetadata:   []string{},
+				OptionalMetadata:   []string{},
+			},
+		}
+	}
+	i.rule = &rule
+	return rule
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPlugin struct {
+	healthy    atomic.Bool
+	ruleCalls  atomic.Int32
+	applyCalls atomic.Int32
+	applied    atomic.Value
+	failApply  bool
+}
+
+func (p *testPlugin) start(t *testing.T) *httptest.Server {
+	p.healthy.Store(true)
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		if !p.healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/v1/rule", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		p.ruleCalls.Add(1)
+		json.NewEncoder(w).Encode(model.ValidationRule{
+			ComponentValidationRule: model.ComponentValidationRule{
+				RequiredProperties: []string{"firmware"},
+			},
+		})
+	})
+	mux.HandleFunc("/v1/get", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		var request PluginGetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		components := []model.ComponentSpec{}
+		for _, reference := range request.References {
+			components = append(components, reference.Component)
+		}
+		json.NewEncoder(w).Encode(PluginGetResponse{Components: components})
+	})
+	mux.HandleFunc("/v1/apply", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		p.applyCalls.Add(1)
+		var request PluginApplyRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p.applied.Store(request)
+		if p.failApply {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "flash failed"})
+			return
+		}
+		results := map[string]model.ComponentResultSpec{}
+		for _, component := range request.Step.Components {
+			if component.Action == model.ComponentUpdate {
+				results[component.Component.Name] = model.ComponentResultSpec{Status: v1alpha2.Updated, Message: "flashed"}
+			}
+		}
+		json.NewEncoder(w).Encode(PluginApplyResponse{Components: results})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProvider(t *testing.T, server *httptest.Server) *PluginTargetProvider {
+	provider := &PluginTargetProvider{}
+	err := provider.Init(PluginTargetProviderConfig{URL: server.URL + "/v1", Token: "secret", HealthInterval: "0s"})
+	require.Nil(t, err)
+	provider.SetContext(&contexts.ManagerContext{
+		VencorContext: &contexts.VendorContext{
+			SecurityPolicy: &contexts.SecurityPolicy{
+				AllowedIPRanges: []string{"127.0.0.1", "::1"},
+			},
+		},
+	})
+	return provider
+}
+
+func deployment() model.DeploymentSpec {
+	return model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "instance-1"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+}
+
+func step() model.DeploymentStep {
+	return model.DeploymentStep{
+		Components: []model.ComponentStep{
+			{
+				Action: model.ComponentUpdate,
+				Component: model.ComponentSpec{
+					Name:       "controller",
+					Properties: map[string]interface{}{"firmware": "2.1.0"},
+				},
+			},
+			{
+				Action: model.ComponentDelete,
+				Component: model.ComponentSpec{
+					Name:       "legacy",
+					Properties: map[string]interface{}{"firmware": "1.0.0"},
+				},
+			},
+		},
+	}
+}
+
+func TestPluginInitWithMap(t *testing.T) {
+	provider := PluginTargetProvider{}
+	err := provider.InitWithMap(map[string]string{"name": "firmware", "url": "http://localhost:8080/v1", "timeout": "10s"})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:8080/v1/", provider.Config.URL)
+
+	err = provider.InitWithMap(map[string]string{"url": "http://localhost:8080/v1", "timeout": "soon"})
+	assert.NotNil(t, err)
+	assert.True(t, v1alpha2.IsBadConfig(err))
+}
+
+func TestPluginApplyAndGet(t *testing.T) {
+	plugin := &testPlugin{}
+	provider := newTestProvider(t, plugin.start(t))
+
+	rule := provider.GetValidationRule(context.Background())
+	assert.Equal(t, []string{"firmware"}, rule.ComponentValidationRule.RequiredProperties)
+
+	ret, err := provider.Apply(context.Background(), deployment(), step(), false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["controller"].Status)
+	assert.Equal(t, "flashed", ret["controller"].Message)
+	// components the plugin doesn't report keep the status of their action
+	assert.Equal(t, v1alpha2.Deleted, ret["legacy"].Status)
+	assert.Equal(t, "instance-1", plugin.applied.Load().(PluginApplyRequest).Deployment.Instance.ObjectMeta.Name)
+
+	// dry runs are sent to the plugin
+	_, err = provider.Apply(context.Background(), deployment(), step(), true)
+	assert.Nil(t, err)
+	assert.True(t, plugin.applied.Load().(PluginApplyRequest).IsDryRun)
+	assert.Equal(t, int32(2), plugin.applyCalls.Load())
+	// the rule is fetched once
+	assert.Equal(t, int32(1), plugin.ruleCalls.Load())
+
+	components, err := provider.Get(context.Background(), deployment(), step().Components)
+	assert.Nil(t, err)
+	assert.Len(t, components, 2)
+	assert.Equal(t, "controller", components[0].Name)
+}
+
+func TestPluginApplyInvalidComponent(t *testing.T) {
+	plugin := &testPlugin{}
+	provider := newTestProvider(t, plugin.start(t))
+
+	invalid := step()
+	invalid.Components[0].Component.Properties = nil
+	_, err := provider.Apply(context.Background(), deployment(), invalid, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(0), plugin.applyCalls.Load())
+}
+
+func TestPluginApplyFailed(t *testing.T) {
+	plugin := &testPlugin{failApply: true}
+	provider := newTestProvider(t, plugin.start(t))
+
+	ret, err := provider.Apply(context.Background(), deployment(), step(), false)
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.InternalError, v1alpha2.GetErrorState(err))
+	assert.Equal(t, v1alpha2.UpdateFailed, ret["controller"].Status)
+	assert.Contains(t, ret["controller"].Message, "flash failed")
+	assert.Equal(t, v1alpha2.DeleteFailed, ret["legacy"].Status)
+}
+
+func TestPluginUnhealthy(t *testing.T) {
+	plugin := &testPlugin{}
+	provider := newTestProvider(t, plugin.start(t))
+	plugin.healthy.Store(false)
+
+	_, err := provider.Get(context.Background(), deployment(), nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "plugin is unhealthy")
+
+	// the rule isn't cached while the plugin can't be reached
+	rule := provider.GetValidationRule(context.Background())
+	assert.Empty(t, rule.ComponentValidationRule.RequiredProperties)
+	plugin.healthy.Store(true)
+	rule = provider.GetValidationRule(context.Background())
+	assert.Equal(t, []string{"firmware"}, rule.ComponentValidationRule.RequiredProperties)
+}
+
+func TestPluginURLNotAllowed(t *testing.T) {
+	plugin := &testPlugin{}
+	provider := newTestProvider(t, plugin.start(t))
+	provider.SetContext(nil)
+
+	_, err := provider.Get(context.Background(), deployment(), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(0), plugin.ruleCalls.Load())
+}
+
+func TestConformanceSuite(t *testing.T) {
+	plugin := &testPlugin{}
+	provider := newTestProvider(t, plugin.start(t))
+	conformance.ConformanceSuite(t, provider)
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package remoteagent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/constants"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	wsbinding "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/websocket"
+	"github.com/google/uuid"
+)
+
+// DefaultHub keeps the connections of the remote agents of this Symphony API. The targets vendor
+// hands the agents that connect to it, and remote agent target providers send their requests through it.
+var DefaultHub = NewHub(wsbinding.DefaultQueueSize)
+
+// Hub keeps a connection per remote agent, and sends requests to agents over their connections.
+// Requests to an agent that isn't connected are queued until it connects, and requests that were
+// sent over a connection that is lost before they are answered are sent again when the agent
+// reconnects. Agents answer requests they get twice with the response of the first one.
+type Hub struct {
+	queueSize int
+	lock      sync.Mutex
+	sessions  map[string]*session
+	queues    map[string][]*call
+	calls     map[string]*call
+}
+
+// session is a connection of an agent, and the requests that were sent over it
+type session struct {
+	conn     *wsbinding.Conn
+	inflight map[string]*call
+	closed   bool
+}
+
+// call is a request that waits for its response
+type call struct {
+	key      string
+	message  wsbinding.Message
+	response chan v1alpha2.COAResponse
+}
+
+// NewHub creates a hub that queues up to queueSize requests for each agent that isn't connected
+func NewHub(queueSize int) *Hub {
+	if queueSize <= 0 {
+		queueSize = wsbinding.DefaultQueueSize
+	}
+	return &Hub{
+		queueSize: queueSize,
+		sessions:  make(map[string]*session),
+		queues:    make(map[string][]*call),
+		calls:     make(map[string]*call),
+	}
+}
+
+func agentKey(namespace string, target string) string {
+	if namespace == "" {
+		namespace = constants.DefaultScope
+	}
+	return namespace + "/" + target
+}
+
+// SetQueueSize changes the number of requests queued for each agent that isn't connected
+func (h *Hub) SetQueueSize(queueSize int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if queueSize > 0 {
+		h.queueSize = queueSize
+	}
+}
+
+// IsConnected returns whether the agent of a target is connected
+func (h *Hub) IsConnected(namespace string, target string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, ok := h.sessions[agentKey(namespace, target)]
+	return ok
+}
+
+// Serve makes a registered connection the connection of the agent of a target, and serves it until
+// it's lost. A previous connection of the agent is closed.
+func (h *Hub) Serve(namespace string, target string, conn *wsbinding.Conn) {
+	key := agentKey(namespace, target)
+	s := &session{conn: conn, inflight: make(map[string]*call)}
+	if err := conn.Send(wsbinding.Message{Type: wsbinding.MessageRegistered}); err != nil {
+		sLog.Errorf("  P (Remote Agent Target): failed to confirm the registration of %s - %+v", key, err)
+		return
+	}
+
+	h.lock.Lock()
+	previous := h.sessions[key]
+	h.sessions[key] = s
+	queued := h.queues[key]
+	delete(h.queues, key)
+	h.lock.Unlock()
+	sLog.Infof("  P (Remote Agent Target): agent of %s connected, %d queued requests", key, len(queued))
+	if previous != nil {
+		previous.conn.Close()
+	}
+	for _, c := range queued {
+		h.dispatch(c)
+	}
+
+	for {
+		message, err := conn.Receive()
+		if err != nil {
+			sLog.Infof("  P (Remote Agent Target): agent of %s disconnected - %v", key, err)
+			break
+		}
+		if message.Type == wsbinding.MessageResponse && message.Response != nil {
+			h.complete(message)
+		}
+	}
+
+	h.lock.Lock()
+	s.closed = true
+	if h.sessions[key] == s {
+		delete(h.sessions, key)
+	}
+	inflight := s.inflight
+	s.inflight = nil
+	h.lock.Unlock()
+	for _, c := range inflight {
+		h.dispatch(c)
+	}
+}
+
+// dispatch sends a request to the agent, or queues it while the agent isn't connected. Requests that
+// were answered or expired are dropped.
+func (h *Hub) dispatch(c *call) error {
+	h.lock.Lock()
+	if _, ok := h.calls[c.message.ID]; !ok || c.message.IsExpired(time.Now()) {
+		h.lock.Unlock()
+		return nil
+	}
+	s, ok := h.sessions[c.key]
+	if !ok || s.closed {
+		defer h.lock.Unlock()
+		queue := make([]*call, 0, len(h.queues[c.key])+1)
+		for _, q := range h.queues[c.key] {
+			if _, ok := h.calls[q.message.ID]; ok && !q.message.IsExpired(time.Now()) && q != c {
+				queue = append(queue, q)
+			}
+		}
+		if len(queue) >= h.queueSize {
+			h.queues[c.key] = queue
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("request queue of the agent of %s is full", c.key), v1alpha2.InternalError)
+		}
+		h.queues[c.key] = append(queue, c)
+		return nil
+	}
+	s.inflight[c.message.ID] = c
+	h.lock.Unlock()
+	if err := s.conn.Send(c.message); err != nil {
+		// the request is sent again when the agent reconnects
+		sLog.Errorf("  P (Remote Agent Target): failed to send request to the agent of %s - %+v", c.key, err)
+		s.conn.Close()
+	}
+	return nil
+}
+
+// complete passes a response to the request waiting for it
+func (h *Hub) complete(message wsbinding.Message) {
+	h.lock.Lock()
+	c, ok := h.calls[message.ID]
+	delete(h.calls, message.ID)
+	if ok {
+		if s, ok := h.sessions[c.key]; ok && s.inflight != nil {
+			delete(s.inflight, message.ID)
+		}
+	}
+	h.lock.Unlock()
+	if ok {
+		c.response <- *message.Response
+	}
+}
+
+// Send sends a request to the agent of a target and waits for its response. The request is queued
+// while the agent isn't connected, and given up after the timeout.
+func (h *Hub) Send(ctx context.Context, namespace string, target string, request v1alpha2.COARequest, timeout time.Duration) (v1alpha2.COAResponse, error) {
+	expiresAt := time.Now().Add(timeout)
+	c := &call{
+		key: agentKey(namespace, target),
+		message: wsbinding.Message{
+			Type:      wsbinding.MessageRequest,
+			ID:        uuid.New().String(),
+			Request:   &request,
+			ExpiresAt: &expiresAt,
+		},
+		response: make(chan v1alpha2.COAResponse, 1),
+	}
+	h.lock.Lock()
+	h.calls[c.message.ID] = c
+	h.lock.Unlock()
+	defer func() {
+		h.lock.Lock()
+		delete(h.calls, c.message.ID)
+		h.lock.Unlock()
+	}()
+
+	if err := h.dispatch(c); err != nil {
+		return v1alpha2.COAResponse{}, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case response := <-c.response:
+		return response, nil
+	case <-ctx.Done():
+		return v1alpha2.COAResponse{}, v1alpha2.NewCOAError(ctx.Err(), fmt.Sprintf("request to the agent of %s was canceled", c.key), v1alpha2.InternalError)
+	case <-timer.C:
+		if !h.IsConnected(namespace, target) {
+			return v1alpha2.COAResponse{}, v1alpha2.NewCOAError(nil, fmt.Sprintf("agent of %s didn't connect within %s", c.key, timeout), v1alpha2.TimedOut)
+		}
+		return v1alpha2.COAResponse{}, v1alpha2.NewCOAError(nil, fmt.Sprintf("agent of %s didn't respond within %s", c.key, timeout), v1alpha2.TimedOut)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package remoteagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	coalogcontexts "github.com/eclipse-symphony/symphony/coa/pkg/logger/contexts"
+)
+
+const (
+	loggerName            = "providers.target.remoteagent"
+	defaultTimeoutSeconds = 60
+
+	// AgentIdentityKey is the binding config that names the identity the agent of a target authenticates with
+	AgentIdentityKey = "agentIdentity"
+	// CreatedByAnnotation records the identity of the agent that registered a target
+	CreatedByAnnotation = "remoteagent.symphony/createdBy"
+)
+
+var sLog = logger.NewLogger(loggerName)
+
+// RemoteAgentTargetProviderConfig is the configuration of the remote agent target provider
+type RemoteAgentTargetProviderConfig struct {
+	Name string `json:"name"`
+	// TargetName is the target of the agent, default is the target of the deployment
+	TargetName string `json:"targetName,omitempty"`
+	// TimeoutSeconds is how long a request waits for the agent to connect and respond, default is 60
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// RemoteAgentTargetProvider deploys to remote agents that dial out to the Symphony API over a websocket
+// connection, so targets behind NAT can be reached. Requests are forwarded to the agent like the requests
+// of the MQTT target provider, and answered by the solution vendor of the agent.
+type RemoteAgentTargetProvider struct {
+	Config  RemoteAgentTargetProviderConfig
+	Context *contexts.ManagerContext
+	Hub     *Hub
+}
+
+func RemoteAgentTargetProviderConfigFromMap(properties map[string]string) (RemoteAgentTargetProviderConfig, error) {
+	ret := RemoteAgentTargetProviderConfig{}
+	if v, ok := properties["name"]; ok {
+		ret.Name = v
+	}
+	if v, ok := properties["targetName"]; ok {
+		ret.TargetName = v
+	}
+	if v, ok := properties["timeoutSeconds"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid remote agent provider config, invalid timeoutSeconds '%s'", v), v1alpha2.BadConfig)
+		}
+		ret.TimeoutSeconds = n
+	}
+	return ret, nil
+}
+
+func (i *RemoteAgentTargetProvider) InitWithMap(properties map[string]string) error {
+	config, err := RemoteAgentTargetProviderConfigFromMap(properties)
+	if err != nil {
+		sLog.Errorf("  P (Remote Agent Target): expected RemoteAgentTargetProviderConfig: %+v", err)
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *RemoteAgentTargetProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *RemoteAgentTargetProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("Remote Agent Target Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Remote Agent Target): Init()")
+
+	updateConfig, err := toRemoteAgentTargetProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): expected RemoteAgentTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected RemoteAgentTargetProviderConfig", v1alpha2.InitFailed)
+		return err
+	}
+	if updateConfig.TimeoutSeconds <= 0 {
+		updateConfig.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	i.Config = updateConfig
+	if i.Hub == nil {
+		i.Hub = DefaultHub
+	}
+	return nil
+}
+
+func toRemoteAgentTargetProviderConfig(config providers.IProviderConfig) (RemoteAgentTargetProviderConfig, error) {
+	ret := RemoteAgentTargetProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// target returns the namespace and the name of the target whose agent serves a deployment
+func (i *RemoteAgentTargetProvider) target(deployment model.DeploymentSpec) (string, string) {
+	target := i.Config.TargetName
+	if target == "" {
+		target = deployment.ActiveTarget
+	}
+	return deployment.Instance.ObjectMeta.Namespace, target
+}
+
+// send forwards a deployment to the agent, and returns the body of a successful response
+func (i *RemoteAgentTargetProvider) send(ctx context.Context, deployment model.DeploymentSpec, method string) ([]byte, error) {
+	namespace, target := i.target(deployment)
+	if target == "" {
+		return nil, v1alpha2.NewCOAError(nil, "remote agent target provider can't find the target of the deployment, set 'targetName' in the provider config", v1alpha2.BadConfig)
+	}
+	data, _ := json.Marshal(deployment)
+	request := v1alpha2.COARequest{
+		Route:  "instances",
+		Method: method,
+		Body:   data,
+		Metadata: map[string]string{
+			"active-target": deployment.ActiveTarget,
+		},
+		Context: coalogcontexts.GenerateCorrelationIdToParentContextIfMissing(ctx),
+	}
+	sLog.InfofCtx(ctx, "  P (Remote Agent Target): send %s request to the agent of %s", method, target)
+	response, err := i.Hub.Send(ctx, namespace, target, request, time.Duration(i.Config.TimeoutSeconds)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if response.State != v1alpha2.OK && response.State != v1alpha2.Accepted {
+		return nil, v1alpha2.NewCOAError(nil, string(response.Body), response.State)
+	}
+	return response.Body, nil
+}
+
+func (i *RemoteAgentTargetProvider) Get(ctx context.Context, deployment model.DeploymentSpec, references []model.ComponentStep) ([]model.ComponentSpec, error) {
+	ctx, span := observability.StartSpan("Remote Agent Target Provider", ctx, &map[string]string{
+		"method": "Get",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Remote Agent Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	var data []byte
+	data, err = i.send(ctx, deployment, "GET")
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): failed to get artifacts - %+v", err)
+		return nil, err
+	}
+	var ret []model.ComponentSpec
+	if err = json.Unmarshal(data, &ret); err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): failed to deserialize components - %+v", err)
+		err = v1alpha2.NewCOAError(err, "failed to deserialize components of the remote agent", v1alpha2.InternalError)
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (i *RemoteAgentTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
+	ctx, span := observability.StartSpan("Remote Agent Target Provider", ctx, &map[string]string{
+		"method": "Apply",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Remote Agent Target): applying artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	components := step.GetComponents()
+	err = i.GetValidationRule(ctx).Validate(components)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): failed to validate components: %+v", err)
+		return nil, err
+	}
+	if isDryRun {
+		sLog.DebugCtx(ctx, "  P (Remote Agent Target): dryRun is enabled, skipping apply")
+		return nil, nil
+	}
+
+	ret := step.PrepareResultMap()
+	if len(step.GetUpdatedComponents()) > 0 {
+		var data []byte
+		data, err = i.send(ctx, deployment, "POST")
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): failed to apply components - %+v", err)
+			for _, component := range step.GetUpdatedComponents() {
+				ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.UpdateFailed, Message: err.Error()}
+			}
+			return ret, err
+		}
+		var summary model.SummarySpec
+		if err = json.Unmarshal(data, &summary); err != nil {
+			sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): failed to deserialize summary - %+v", err)
+			err = v1alpha2.NewCOAError(err, "failed to deserialize summary of the remote agent", v1alpha2.InternalError)
+			return ret, err
+		}
+		for _, targetResult := range summary.TargetResults {
+			for name, componentResult := range targetResult.ComponentResults {
+				ret[name] = componentResult
+			}
+		}
+	}
+	if len(step.GetDeletedComponents()) > 0 {
+		_, err = i.send(ctx, deployment, "DELETE")
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (Remote Agent Target): failed to delete components - %+v", err)
+			for _, component := range step.GetDeletedComponents() {
+				ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.DeleteFailed, Message: err.Error()}
+			}
+			return ret, err
+		}
+		for _, component := range step.GetDeletedComponents() {
+			ret[component.Name] = model.ComponentResultSpec{Status: v1alpha2.Deleted, Message: ""}
+		}
+	}
+	return ret, nil
+}
+
+func (*RemoteAgentTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
+	return model.ValidationRule{
+		AllowSidecar: false,
+		ComponentValidationRule: model.ComponentValidationRule{
+			RequiredProperties:    []string{},
+			OptionalProperties:    []string{},
+			RequiredComponentType: "",
+			RequiredMetadata:      []string{},
+			OptionalMetadata:      []string{},
+		},
+	}
+}
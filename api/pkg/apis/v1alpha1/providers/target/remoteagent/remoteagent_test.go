@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package remoteagent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/constants"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	wsbinding "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/websocket"
+	gws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newHubServer serves the agents that connect to it with a hub, like the targets vendor does
+func newHubServer(t *testing.T, hub *Hub) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&gws.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		conn := wsbinding.NewConn(ws, 1)
+		defer conn.Close()
+		message, err := conn.Receive()
+		if !assert.Nil(t, err) {
+			return
+		}
+		hub.Serve(constants.DefaultScope, message.Registration.Target, conn)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// launchAgent connects an agent whose solution vendor is the handler
+func launchAgent(t *testing.T, serverURL string, handler v1alpha2.COAHandler) *wsbinding.WebSocketBinding {
+	binding := &wsbinding.WebSocketBinding{}
+	err := binding.Launch(wsbinding.WebSocketBindingConfig{
+		ServerURL:           serverURL + "/v1alpha2/",
+		Target:              "edge-01",
+		ReconnectMinSeconds: 1,
+		ReconnectMaxSeconds: 1,
+	}, []v1alpha2.Endpoint{{Route: "solution/instances", Handler: handler}})
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		binding.Shutdown(context.Background())
+	})
+	return binding
+}
+
+func newProvider(t *testing.T, hub *Hub, timeoutSeconds int) *RemoteAgentTargetProvider {
+	provider := &RemoteAgentTargetProvider{Hub: hub}
+	err := provider.Init(RemoteAgentTargetProviderConfig{Name: "remote", TimeoutSeconds: timeoutSeconds})
+	assert.Nil(t, err)
+	return provider
+}
+
+func deployment() model.DeploymentSpec {
+	return model.DeploymentSpec{
+		ActiveTarget: "edge-01",
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "instance-1"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+}
+
+func step(action model.ComponentAction) model.DeploymentStep {
+	return model.DeploymentStep{
+		Components: []model.ComponentStep{
+			{
+				Action:    action,
+				Component: model.ComponentSpec{Name: "app", Type: "container"},
+			},
+		},
+	}
+}
+
+func TestInitWithMap(t *testing.T) {
+	provider := RemoteAgentTargetProvider{}
+	err := provider.InitWithMap(map[string]string{"name": "remote", "targetName": "edge-01"})
+	assert.Nil(t, err)
+	assert.Equal(t, "edge-01", provider.Config.TargetName)
+	assert.Equal(t, defaultTimeoutSeconds, provider.Config.TimeoutSeconds)
+	assert.Equal(t, DefaultHub, provider.Hub)
+
+	err = provider.InitWithMap(map[string]string{"timeoutSeconds": "soon"})
+	assert.NotNil(t, err)
+	assert.True(t, v1alpha2.IsBadConfig(err))
+}
+
+func TestApplyAndGet(t *testing.T) {
+	hub := NewHub(10)
+	server := newHubServer(t, hub)
+	provider := newProvider(t, hub, 10)
+
+	var calls int32
+	handler := func(request v1alpha2.COARequest) v1alpha2.COAResponse {
+		atomic.AddInt32(&calls, 1)
+		var spec model.DeploymentSpec
+		assert.Nil(t, json.Unmarshal(request.Body, &spec))
+		assert.Equal(t, "instance-1", spec.Instance.ObjectMeta.Name)
+		assert.Equal(t, "edge-01", request.Metadata["active-target"])
+		switch request.Method {
+		case "GET":
+			data, _ := json.Marshal([]model.ComponentSpec{{Name: "app", Type: "container"}})
+			return v1alpha2.COAResponse{State: v1alpha2.OK, Body: data}
+		case "POST":
+			summary := model.SummarySpec{TargetResults: map[string]model.TargetResultSpec{
+				"edge-01": {ComponentResults: map[string]model.ComponentResultSpec{
+					"app": {Status: v1alpha2.Updated, Message: "deployed"},
+				}},
+			}}
+			data, _ := json.Marshal(summary)
+			return v1alpha2.COAResponse{State: v1alpha2.OK, Body: data}
+		}
+		return v1alpha2.COAResponse{State: v1alpha2.OK}
+	}
+
+	// the request is queued until the agent connects
+	applied := make(chan map[string]model.ComponentResultSpec, 1)
+	go func() {
+		ret, err := provider.Apply(context.Background(), deployment(), step(model.ComponentUpdate), false)
+		assert.Nil(t, err)
+		applied <- ret
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, hub.IsConnected("", "edge-01"))
+	launchAgent(t, server.URL, handler)
+
+	select {
+	case ret := <-applied:
+		assert.Equal(t, v1alpha2.Updated, ret["app"].Status)
+		assert.Equal(t, "deployed", ret["app"].Message)
+	case <-time.After(10 * time.Second):
+		t.Fatal("apply didn't complete")
+	}
+	assert.True(t, hub.IsConnected("", "edge-01"))
+
+	components, err := provider.Get(context.Background(), deployment(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ComponentSpec{{Name: "app", Type: "container"}}, components)
+
+	ret, err := provider.Apply(context.Background(), deployment(), step(model.ComponentDelete), false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["app"].Status)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// dry runs aren't sent to the agent
+	_, err = provider.Apply(context.Background(), deployment(), step(model.ComponentUpdate), true)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestApplyFailed(t *testing.T) {
+	hub := NewHub(10)
+	server := newHubServer(t, hub)
+	provider := newProvider(t, hub, 10)
+	launchAgent(t, server.URL, func(request v1alpha2.COARequest) v1alpha2.COAResponse {
+		return v1alpha2.COAResponse{State: v1alpha2.InternalError, Body: []byte("image pull failed")}
+	})
+
+	ret, err := provider.Apply(context.Background(), deployment(), step(model.ComponentUpdate), false)
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.InternalError, v1alpha2.GetErrorState(err))
+	assert.Equal(t, v1alpha2.UpdateFailed, ret["app"].Status)
+	assert.Contains(t, ret["app"].Message, "image pull failed")
+}
+
+func TestAgentTimeouts(t *testing.T) {
+	hub := NewHub(1)
+	_, err := hub.Send(context.Background(), "", "edge-01", v1alpha2.COARequest{Route: "instances"}, 100*time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.TimedOut, v1alpha2.GetErrorState(err))
+	assert.Contains(t, err.Error(), "didn't connect within")
+
+	// requests beyond the queue size of an agent that isn't connected are rejected
+	done := make(chan error, 1)
+	go func() {
+		_, err := hub.Send(context.Background(), "", "edge-01", v1alpha2.COARequest{Route: "instances"}, 2*time.Second)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, err = hub.Send(context.Background(), "", "edge-01", v1alpha2.COARequest{Route: "instances"}, 2*time.Second)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "queue")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = hub.Send(ctx, "", "edge-02", v1alpha2.COARequest{Route: "instances"}, 2*time.Second)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "canceled")
+	assert.NotNil(t, <-done)
+
+	// an agent that doesn't answer
+	server := newHubServer(t, hub)
+	launchAgent(t, server.URL, func(request v1alpha2.COARequest) v1alpha2.COAResponse {
+		time.Sleep(2 * time.Second)
+		return v1alpha2.COAResponse{State: v1alpha2.OK}
+	})
+	assert.Eventually(t, func() bool {
+		return hub.IsConnected("", "edge-01")
+	}, 10*time.Second, 50*time.Millisecond)
+	_, err = hub.Send(context.Background(), "", "edge-01", v1alpha2.COARequest{Route: "instances"}, 200*time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "didn't respond within")
+}
+
+func TestResendAfterReconnect(t *testing.T) {
+	hub := NewHub(10)
+	var served int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&gws.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		conn := wsbinding.NewConn(ws, 1)
+		defer conn.Close()
+		if _, err := conn.Receive(); !assert.Nil(t, err) {
+			return
+		}
+		if atomic.AddInt32(&served, 1) == 1 {
+			// the first connection is lost after the request was sent over it
+			go func() {
+				time.Sleep(200 * time.Millisecond)
+				conn.Close()
+			}()
+		}
+		hub.Serve(constants.DefaultScope, "edge-01", conn)
+	}))
+	defer server.Close()
+
+	var calls int32
+	launchAgent(t, server.URL, func(request v1alpha2.COARequest) v1alpha2.COAResponse {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		return v1alpha2.COAResponse{State: v1alpha2.OK, Body: []byte("[]")}
+	})
+	assert.Eventually(t, func() bool {
+		return hub.IsConnected("", "edge-01")
+	}, 10*time.Second, 50*time.Millisecond)
+
+	provider := newProvider(t, hub, 10)
+	components, err := provider.Get(context.Background(), deployment(), nil)
+	assert.Nil(t, err)
+	assert.Empty(t, components)
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&served), int32(2))
+	// the agent answers the request it gets again without running it again
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestConformanceSuite(t *testing.T) {
+	provider := &RemoteAgentTargetProvider{}
+	err := provider.Init(RemoteAgentTargetProviderConfig{})
+	assert.Nil(t, err)
+	conformance.ConformanceSuite(t, provider)
+}
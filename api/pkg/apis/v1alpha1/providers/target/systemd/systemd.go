@@ -0,0 +1,565 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+const (
+	loggerName = "providers.target.systemd"
+
+	systemdUnit        = "systemd.unit"
+	systemdUnitName    = "systemd.unitName"
+	systemdArtifacts   = "systemd.artifacts"
+	systemdVersion     = "systemd.version"
+	systemdActiveState = "systemd.activeState"
+	systemdSubState    = "systemd.subState"
+
+	defaultUnitFolder     = "/etc/systemd/system"
+	defaultArtifactFolder = "/opt/symphony"
+	defaultSystemctl      = "systemctl"
+
+	// dropInName is the drop-in file the provider records the deployed version and hashes in
+	dropInName = "symphony.conf"
+)
+
+var (
+	sLog            = logger.NewLogger(loggerName)
+	unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9:_.\\@-]*\.(service|socket|timer|path|mount|target)$`)
+)
+
+type SystemdTargetProviderConfig struct {
+	Name string `json:"name"`
+	// UnitFolder is the folder unit files are installed to
+	UnitFolder string `json:"unitFolder,omitempty"`
+	// ArtifactFolder is the folder artifacts are installed to, in a subfolder per component
+	ArtifactFolder string `json:"artifactFolder,omitempty"`
+	// SystemctlPath is the systemctl command
+	SystemctlPath string `json:"systemctlPath,omitempty"`
+}
+
+type SystemdTargetProvider struct {
+	Config    SystemdTargetProviderConfig
+	Context   *contexts.ManagerContext
+	systemctl systemctlRunner
+}
+
+// systemctlRunner runs systemctl commands. Tests replace it with a fake.
+type systemctlRunner interface {
+	Run(ctx context.Context, args ...string) (string, error)
+}
+
+type systemctlCommand struct {
+	path string
+}
+
+func (s systemctlCommand) Run(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, s.path, args...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("systemctl %s failed: %s %s", strings.Join(args, " "), err.Error(), strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// artifact is a file installed with a unit
+type artifact struct {
+	// Path is relative to the artifact folder of the component
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// Encoding is empty for text content, or base64
+	Encoding string `json:"encoding,omitempty"`
+	// Mode is an octal file mode, such as 0755
+	Mode string `json:"mode,omitempty"`
+}
+
+func SystemdTargetProviderConfigFromMap(properties map[string]string) (SystemdTargetProviderConfig, error) {
+	ret := SystemdTargetProviderConfig{}
+	if v, ok := properties["name"]; ok {
+		ret.Name = v
+	}
+	if v, ok := properties["unitFolder"]; ok {
+		ret.UnitFolder = v
+	}
+	if v, ok := properties["artifactFolder"]; ok {
+		ret.ArtifactFolder = v
+	}
+	if v, ok := properties["systemctlPath"]; ok {
+		ret.SystemctlPath = v
+	}
+	return ret, nil
+}
+
+func (i *SystemdTargetProvider) InitWithMap(properties map[string]string) error {
+	config, err := SystemdTargetProviderConfigFromMap(properties)
+	if err != nil {
+		sLog.Errorf("  P (Systemd Target): expected SystemdTargetProviderConfig: %+v", err)
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *SystemdTargetProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *SystemdTargetProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("Systemd Target Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Systemd Target): Init()")
+
+	updateConfig, err := toSystemdTargetProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Systemd Target): expected SystemdTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected SystemdTargetProviderConfig", v1alpha2.InitFailed)
+		return err
+	}
+	if updateConfig.UnitFolder == "" {
+		updateConfig.UnitFolder = defaultUnitFolder
+	}
+	if updateConfig.ArtifactFolder == "" {
+		updateConfig.ArtifactFolder = defaultArtifactFolder
+	}
+	if updateConfig.SystemctlPath == "" {
+		updateConfig.SystemctlPath = defaultSystemctl
+	}
+	i.Config = updateConfig
+	if i.systemctl == nil {
+		i.systemctl = systemctlCommand{path: updateConfig.SystemctlPath}
+	}
+	return nil
+}
+
+func toSystemdTargetProviderConfig(config providers.IProviderConfig) (SystemdTargetProviderConfig, error) {
+	ret := SystemdTargetProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+func (i *SystemdTargetProvider) Get(ctx context.Context, deployment model.DeploymentSpec, references []model.ComponentStep) ([]model.ComponentSpec, error) {
+	ctx, span := observability.StartSpan("Systemd Target Provider", ctx, &map[string]string{
+		"method": "Get",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Systemd Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	ret := make([]model.ComponentSpec, 0)
+	for _, component := range references {
+		unit, uerr := validUnitName(component.Component)
+		if uerr != nil {
+			sLog.ErrorfCtx(ctx, "  P (Systemd Target): skip component %s: %+v", component.Component.Name, uerr)
+			continue
+		}
+		var out string
+		out, err = i.systemctl.Run(ctx, "show", "--property=LoadState,ActiveState,SubState", "--", unit)
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (Systemd Target): failed to get state of unit %s: %+v", unit, err)
+			continue
+		}
+		state := parseProperties(out)
+		if state["LoadState"] == "not-found" || state["LoadState"] == "" {
+			sLog.InfofCtx(ctx, "  P (Systemd Target): unit %s is not found", unit)
+			continue
+		}
+		recorded := i.readDropIn(unit)
+		spec := model.ComponentSpec{
+			Name: component.Component.Name,
+			Type: component.Component.Type,
+			Properties: map[string]interface{}{
+				systemdUnit:        recorded["X-Symphony-Unit-Hash"],
+				systemdActiveState: state["ActiveState"],
+				systemdSubState:    state["SubState"],
+			},
+		}
+		if v, ok := recorded["X-Symphony-Version"]; ok {
+			spec.Properties[systemdVersion] = v
+		}
+		if _, ok := component.Component.Properties[systemdArtifacts]; ok {
+			spec.Properties[systemdArtifacts] = recorded["X-Symphony-Artifacts-Hash"]
+		}
+		if _, ok := component.Component.Properties[systemdUnitName]; ok {
+			spec.Properties[systemdUnitName] = unit
+		}
+		sLog.InfofCtx(ctx, "  P (Systemd Target): append component: %s", spec.Name)
+		ret = append(ret, spec)
+	}
+	err = nil
+	return ret, nil
+}
+
+func (i *SystemdTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
+	ctx, span := observability.StartSpan("Systemd Target Provider", ctx, &map[string]string{
+		"method": "Apply",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Systemd Target): applying artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	injections := &model.ValueInjections{
+		InstanceId:        deployment.Instance.ObjectMeta.Name,
+		SolutionVersionId: deployment.Instance.Spec.SolutionVersion,
+		TargetId:          deployment.ActiveTarget,
+	}
+
+	components := step.GetComponents()
+	err = i.GetValidationRule(ctx).Validate(components)
+	if err == nil {
+		for _, component := range step.Components {
+			if err = validateComponent(component.Component); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Systemd Target): failed to validate components: %+v", err)
+		return nil, err
+	}
+	if isDryRun {
+		sLog.DebugCtx(ctx, "  P (Systemd Target): dryRun is enabled, skipping apply")
+		err = nil
+		return nil, nil
+	}
+
+	ret := step.PrepareResultMap()
+	for _, component := range step.Components {
+		if component.Action == model.ComponentUpdate {
+			err = i.installUnit(ctx, component.Component, injections)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Systemd Target): failed to install unit of %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Updated,
+				Message: "",
+			}
+		} else {
+			err = i.removeUnit(ctx, component.Component)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.DeleteFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Systemd Target): failed to remove unit of %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Deleted,
+				Message: "",
+			}
+		}
+	}
+	return ret, nil
+}
+
+// installUnit writes the artifacts and the unit file of a component, then enables and restarts the unit
+func (i *SystemdTargetProvider) installUnit(ctx context.Context, component model.ComponentSpec, injections *model.ValueInjections) error {
+	unit, err := validUnitName(component)
+	if err != nil {
+		return err
+	}
+	artifacts, err := readArtifacts(component.Properties)
+	if err != nil {
+		return err
+	}
+	folder, err := i.artifactFolder(component)
+	if err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		content := []byte(model.ResolveString(a.Content, injections))
+		if a.Encoding == "base64" {
+			content, _ = base64.StdEncoding.DecodeString(a.Content)
+		}
+		mode, _ := strconv.ParseUint(a.Mode, 8, 32)
+		if mode == 0 {
+			mode = 0644
+		}
+		path := filepath.Join(folder, a.Path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		sLog.InfofCtx(ctx, "  P (Systemd Target): write artifact %s", path)
+		if err = os.WriteFile(path, content, os.FileMode(mode)); err != nil {
+			return err
+		}
+		if err = os.Chmod(path, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	unitFile := filepath.Join(i.Config.UnitFolder, unit)
+	sLog.InfofCtx(ctx, "  P (Systemd Target): write unit file %s", unitFile)
+	if err = os.MkdirAll(i.Config.UnitFolder, 0755); err != nil {
+		return err
+	}
+	content := model.ResolveString(model.ReadPropertyCompat(component.Properties, systemdUnit, nil), injections)
+	if err = os.WriteFile(unitFile, []byte(content), 0644); err != nil {
+		return err
+	}
+	if err = i.writeDropIn(component, unit); err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--", unit}, {"restart", "--", unit}} {
+		if _, err = i.systemctl.Run(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUnit stops and disables the unit of a component, then deletes its unit file and artifacts
+func (i *SystemdTargetProvider) removeUnit(ctx context.Context, component model.ComponentSpec) error {
+	unit, err := validUnitName(component)
+	if err != nil {
+		return err
+	}
+	folder, err := i.artifactFolder(component)
+	if err != nil {
+		return err
+	}
+	out, err := i.systemctl.Run(ctx, "show", "--property=LoadState", "--", unit)
+	if err != nil {
+		return err
+	}
+	if state := parseProperties(out)["LoadState"]; state != "not-found" && state != "" {
+		sLog.InfofCtx(ctx, "  P (Systemd Target): stop and disable unit %s", unit)
+		if _, err = i.systemctl.Run(ctx, "disable", "--now", "--", unit); err != nil {
+			return err
+		}
+	}
+	unitFile := filepath.Join(i.Config.UnitFolder, unit)
+	for _, path := range []string{unitFile + ".d", unitFile, folder} {
+		if err = os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	_, err = i.systemctl.Run(ctx, "daemon-reload")
+	return err
+}
+
+// artifactFolder returns the folder of the artifacts of a component, which is named after the component
+func (i *SystemdTargetProvider) artifactFolder(component model.ComponentSpec) (string, error) {
+	if err := validateName(component); err != nil {
+		return "", err
+	}
+	return filepath.Join(i.Config.ArtifactFolder, component.Name), nil
+}
+
+// writeDropIn records the version of a component and the hashes of its unit and artifacts in a
+// drop-in file, which systemd ignores as the keys have the X- prefix
+func (i *SystemdTargetProvider) writeDropIn(component model.ComponentSpec, unit string) error {
+	folder := filepath.Join(i.Config.UnitFolder, unit+".d")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+	lines := []string{
+		"# Written by Symphony, don't edit",
+		"[Unit]",
+		"X-Symphony-Unit-Hash=" + propertyHash(component.Properties[systemdUnit]),
+		"X-Symphony-Artifacts-Hash=" + propertyHash(component.Properties[systemdArtifacts]),
+	}
+	if version := model.ReadPropertyCompat(component.Properties, systemdVersion, nil); version != "" {
+		lines = append(lines, "X-Symphony-Version="+version)
+	}
+	return os.WriteFile(filepath.Join(folder, dropInName), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func (i *SystemdTargetProvider) readDropIn(unit string) map[string]string {
+	ret := make(map[string]string)
+	file, err := os.Open(filepath.Join(i.Config.UnitFolder, unit+".d", dropInName))
+	if err != nil {
+		return ret
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), "="); ok && strings.HasPrefix(k, "X-Symphony-") {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// unitName returns the unit name of a component, the component name with the .service suffix by default
+func unitName(component model.ComponentSpec) string {
+	if name := model.ReadPropertyCompat(component.Properties, systemdUnitName, nil); name != "" {
+		return name
+	}
+	return component.Name + ".service"
+}
+
+// validUnitName returns the unit name of a component once it's checked, as it's passed to systemctl
+// and names the unit file. Names can't start with a dash, which systemctl would read as an option.
+func validUnitName(component model.ComponentSpec) (string, error) {
+	unit := unitName(component)
+	if !unitNamePattern.MatchString(unit) {
+		return "", v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid unit name '%s' of component %s", unit, component.Name), v1alpha2.BadRequest)
+	}
+	return unit, nil
+}
+
+// validateName checks that the name of a component is a single path element, as the artifact
+// folder of the component is named after it and deleted with the component
+func validateName(component model.ComponentSpec) error {
+	name := component.Name
+	if name == "" || name == "." || !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid component name '%s'", name), v1alpha2.BadRequest)
+	}
+	return nil
+}
+
+func validateComponent(component model.ComponentSpec) error {
+	if err := validateName(component); err != nil {
+		return err
+	}
+	if _, err := validUnitName(component); err != nil {
+		return err
+	}
+	if _, err := readArtifacts(component.Properties); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readArtifacts reads the artifacts of a component, given as a list or as a JSON string
+func readArtifacts(properties map[string]interface{}) ([]artifact, error) {
+	v, ok := properties[systemdArtifacts]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	var data []byte
+	if s, ok := v.(string); ok {
+		data = []byte(s)
+	} else {
+		data, _ = json.Marshal(v)
+	}
+	var ret []artifact
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid %s format", systemdArtifacts), v1alpha2.BadRequest)
+	}
+	for _, a := range ret {
+		// artifacts stay in the artifact folder of the component
+		if a.Path == "" || filepath.IsAbs(a.Path) || !filepath.IsLocal(a.Path) {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid artifact path '%s', expected a relative path", a.Path), v1alpha2.BadRequest)
+		}
+		if a.Encoding != "" && a.Encoding != "base64" {
+			return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid encoding '%s' of artifact %s, expected base64", a.Encoding, a.Path), v1alpha2.BadRequest)
+		}
+		if a.Encoding == "base64" {
+			if _, err := base64.StdEncoding.DecodeString(a.Content); err != nil {
+				return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid base64 content of artifact %s", a.Path), v1alpha2.BadRequest)
+			}
+		}
+		if a.Mode != "" {
+			if _, err := strconv.ParseUint(a.Mode, 8, 32); err != nil {
+				return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid mode '%s' of artifact %s", a.Mode, a.Path), v1alpha2.BadRequest)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// parseProperties parses the key=value lines of systemctl show
+func parseProperties(out string) map[string]string {
+	ret := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// propertyHash returns the hash of a property value, objects are hashed as JSON
+func propertyHash(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	var data []byte
+	if s, ok := value.(string); ok {
+		data = []byte(strings.TrimSpace(s))
+	} else {
+		data, _ = json.Marshal(value)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isHashChanged compares the recorded hash of a property with the hash of its desired value
+func isHashChanged(oldProp, newProp any) bool {
+	if newProp == nil {
+		return false
+	}
+	return fmt.Sprintf("%v", oldProp) != propertyHash(newProp)
+}
+
+// isActiveStateChanged reports a unit that is not in the desired state, active by default
+func isActiveStateChanged(oldProp, newProp any) bool {
+	desired := "active"
+	if newProp != nil && fmt.Sprintf("%v", newProp) != "" {
+		desired = fmt.Sprintf("%v", newProp)
+	}
+	return fmt.Sprintf("%v", oldProp) != desired
+}
+
+func (*SystemdTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
+	return model.ValidationRule{
+		AllowSidecar: false,
+		ComponentValidationRule: model.ComponentValidationRule{
+			RequiredProperties:    []string{systemdUnit},
+			OptionalProperties:    []string{systemdUnitName, systemdArtifacts, systemdVersion, systemdActiveState},
+			RequiredComponentType: "",
+			RequiredMetadata:      []string{},
+			OptionalMetadata:      []string{},
+			ChangeDetectionProperties: []model.PropertyDesc{
+				{Name: systemdUnit, IgnoreCase: false, SkipIfMissing: false, PropChanged: isHashChanged},
+				{Name: systemdArtifacts, IgnoreCase: false, SkipIfMissing: true, PropChanged: isHashChanged},
+				{Name: systemdVersion, IgnoreCase: false, SkipIfMissing: true},
+				{Name: systemdActiveState, IgnoreCase: false, SkipIfMissing: false, PropChanged: isActiveStateChanged},
+			},
+		},
+	}
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package systemd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSystemctl keeps the state of units in memory, units are loaded when their unit file exists
+type fakeSystemctl struct {
+	unitFolder string
+	active     map[string]bool
+	enabled    map[string]bool
+	calls      []string
+	fail       string
+}
+
+func newFakeSystemctl(unitFolder string) *fakeSystemctl {
+	return &fakeSystemctl{unitFolder: unitFolder, active: map[string]bool{}, enabled: map[string]bool{}}
+}
+
+func (f *fakeSystemctl) Run(ctx context.Context, args ...string) (string, error) {
+	call := strings.Join(args, " ")
+	f.calls = append(f.calls, call)
+	if f.fail != "" && strings.HasPrefix(call, f.fail) {
+		return "", errors.New("systemctl failed")
+	}
+	// units are passed after --, so they aren't read as options
+	unit := args[len(args)-1]
+	if len(args) > 1 && args[len(args)-2] != "--" {
+		return "", errors.New("unit is not passed after --")
+	}
+	switch args[0] {
+	case "show":
+		if _, err := os.Stat(filepath.Join(f.unitFolder, unit)); err != nil {
+			return "LoadState=not-found\nActiveState=inactive\nSubState=dead\n", nil
+		}
+		if f.active[unit] {
+			return "LoadState=loaded\nActiveState=active\nSubState=running\n", nil
+		}
+		return "LoadState=loaded\nActiveState=failed\nSubState=failed\n", nil
+	case "enable":
+		f.enabled[unit] = true
+	case "restart":
+		f.active[unit] = true
+	case "disable":
+		f.enabled[unit] = false
+		f.active[unit] = false
+	}
+	return "", nil
+}
+
+func createTestProvider(t *testing.T) (*SystemdTargetProvider, *fakeSystemctl) {
+	unitFolder := t.TempDir()
+	fake := newFakeSystemctl(unitFolder)
+	provider := &SystemdTargetProvider{systemctl: fake}
+	err := provider.Init(SystemdTargetProviderConfig{UnitFolder: unitFolder, ArtifactFolder: t.TempDir()})
+	assert.Nil(t, err)
+	return provider, fake
+}
+
+const testUnit = `[Unit]
+Description=Sensor collector
+
+[Service]
+ExecStart=/opt/symphony/collector/collector --instance ${{$instance()}}
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func TestSystemdTargetProviderConfigFromMap(t *testing.T) {
+	config, err := SystemdTargetProviderConfigFromMap(map[string]string{
+		"name":       "systemd",
+		"unitFolder": "/etc/systemd/user",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "/etc/systemd/user", config.UnitFolder)
+
+	provider := SystemdTargetProvider{}
+	err = provider.InitWithMap(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultUnitFolder, provider.Config.UnitFolder)
+	assert.Equal(t, defaultArtifactFolder, provider.Config.ArtifactFolder)
+	assert.Equal(t, systemctlCommand{path: defaultSystemctl}, provider.systemctl)
+}
+
+func TestSystemdTargetProviderLifecycle(t *testing.T) {
+	provider, fake := createTestProvider(t)
+	component := model.ComponentSpec{
+		Name: "collector",
+		Properties: map[string]interface{}{
+			systemdUnit:    testUnit,
+			systemdVersion: "1.2.0",
+			systemdArtifacts: []interface{}{
+				map[string]interface{}{"path": "collector", "content": "IyEvYmluL3NoCg==", "encoding": "base64", "mode": "0755"},
+				map[string]interface{}{"path": "conf/collector.conf", "content": "instance=${{$instance()}}"},
+			},
+		},
+	}
+	deployment := model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "edge-instance"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+	references := []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}
+
+	components, err := provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(components))
+
+	ret, err := provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["collector"].Status)
+	assert.Equal(t, []string{"show --property=LoadState,ActiveState,SubState -- collector.service", "daemon-reload", "enable -- collector.service", "restart -- collector.service"}, fake.calls)
+
+	data, err := os.ReadFile(filepath.Join(provider.Config.UnitFolder, "collector.service"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "--instance edge-instance")
+	data, err = os.ReadFile(filepath.Join(provider.Config.ArtifactFolder, "collector", "conf", "collector.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "instance=edge-instance", string(data))
+	info, err := os.Stat(filepath.Join(provider.Config.ArtifactFolder, "collector", "collector"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+	assert.Equal(t, "1.2.0", components[0].Properties[systemdVersion])
+	assert.Equal(t, "active", components[0].Properties[systemdActiveState])
+	rule := provider.GetValidationRule(context.Background())
+	assert.False(t, rule.IsComponentChanged(components[0], component))
+
+	// a new version, a changed unit and a failed unit are deployed again
+	changed := model.ComponentSpec{Name: "collector", Properties: map[string]interface{}{}}
+	for k, v := range component.Properties {
+		changed.Properties[k] = v
+	}
+	changed.Properties[systemdVersion] = "1.3.0"
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+	changed.Properties[systemdVersion] = "1.2.0"
+	changed.Properties[systemdUnit] = strings.Replace(testUnit, "Restart=always", "Restart=on-failure", 1)
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+	fake.active["collector.service"] = false
+	components, _ = provider.Get(context.Background(), deployment, references)
+	assert.True(t, rule.IsComponentChanged(components[0], component))
+
+	fake.calls = nil
+	references[0].Action = model.ComponentDelete
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["collector"].Status)
+	assert.Equal(t, []string{"show --property=LoadState -- collector.service", "disable --now -- collector.service", "daemon-reload"}, fake.calls)
+	_, err = os.Stat(filepath.Join(provider.Config.UnitFolder, "collector.service"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(provider.Config.ArtifactFolder, "collector"))
+	assert.True(t, os.IsNotExist(err))
+
+	// removing a unit that is not installed succeeds
+	fake.calls = nil
+	_, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"show --property=LoadState -- collector.service", "daemon-reload"}, fake.calls)
+}
+
+func TestSystemdTargetProviderApplyFailed(t *testing.T) {
+	provider, fake := createTestProvider(t)
+	fake.fail = "restart"
+	component := model.ComponentSpec{
+		Name:       "collector",
+		Properties: map[string]interface{}{systemdUnit: testUnit, systemdUnitName: "collector@edge.service"},
+	}
+	ret, err := provider.Apply(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+		model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}}, false)
+	assert.NotNil(t, err)
+	assert.Equal(t, v1alpha2.UpdateFailed, ret["collector"].Status)
+	_, err = os.Stat(filepath.Join(provider.Config.UnitFolder, "collector@edge.service"))
+	assert.Nil(t, err)
+}
+
+func TestSystemdTargetProviderValidation(t *testing.T) {
+	provider, fake := createTestProvider(t)
+	invalid := []map[string]interface{}{
+		{systemdUnit: testUnit, systemdUnitName: "../collector.service"},
+		{systemdUnit: testUnit, systemdUnitName: "collector"},
+		{systemdUnit: testUnit, systemdArtifacts: `[{"path":"../../etc/passwd","content":""}]`},
+		{systemdUnit: testUnit, systemdArtifacts: `[{"path":"/etc/passwd","content":""}]`},
+		{systemdUnit: testUnit, systemdArtifacts: `[{"path":"bin","content":"%%","encoding":"base64"}]`},
+		{systemdUnit: testUnit, systemdArtifacts: `[{"path":"bin","content":"","mode":"rwx"}]`},
+		{systemdUnit: testUnit, systemdArtifacts: `{"path":"bin"}`},
+	}
+	for _, properties := range invalid {
+		_, err := provider.Apply(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+			model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: model.ComponentSpec{Name: "collector", Properties: properties}}}}, false)
+		assert.NotNil(t, err, properties)
+	}
+	assert.Equal(t, 0, len(fake.calls))
+}
+
+func TestSystemdTargetProviderInvalidName(t *testing.T) {
+	provider, fake := createTestProvider(t)
+	marker := filepath.Join(provider.Config.ArtifactFolder, "keep")
+	assert.Nil(t, os.WriteFile(marker, []byte("keep"), 0644))
+	for _, name := range []string{"", ".", "..", "../collector", "bin/collector", `bin\collector`} {
+		for _, properties := range []map[string]interface{}{
+			{systemdUnit: testUnit},
+			{systemdUnit: testUnit, systemdUnitName: "collector.service"},
+		} {
+			for _, action := range []model.ComponentAction{model.ComponentUpdate, model.ComponentDelete} {
+				_, err := provider.Apply(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+					model.DeploymentStep{Components: []model.ComponentStep{{Action: action, Component: model.ComponentSpec{Name: name, Properties: properties}}}}, false)
+				assert.NotNil(t, err, name)
+			}
+		}
+		// the artifact folder is checked before anything is deleted
+		err := provider.removeUnit(context.Background(), model.ComponentSpec{Name: name, Properties: map[string]interface{}{systemdUnitName: "collector.service"}})
+		assert.NotNil(t, err, name)
+	}
+	assert.Equal(t, 0, len(fake.calls))
+	_, err := os.Stat(marker)
+	assert.Nil(t, err)
+}
+
+func TestSystemdTargetProviderOptionUnitName(t *testing.T) {
+	provider, fake := createTestProvider(t)
+	// a unit name that systemctl would read as the -H option
+	for _, component := range []model.ComponentSpec{
+		{Name: "collector", Properties: map[string]interface{}{systemdUnit: testUnit, systemdUnitName: "-Hroot@host.service"}},
+		{Name: "-Hroot@host", Properties: map[string]interface{}{systemdUnit: testUnit}},
+	} {
+		_, err := provider.Apply(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+			model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}}, false)
+		assert.NotNil(t, err)
+		components, err := provider.Get(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+			[]model.ComponentStep{{Action: model.ComponentUpdate, Component: component}})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(components))
+		err = provider.removeUnit(context.Background(), component)
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 0, len(fake.calls))
+}
+
+func TestConformanceSuite(t *testing.T) {
+	provider, _ := createTestProvider(t)
+	conformance.ConformanceSuite(t, provider)
+}
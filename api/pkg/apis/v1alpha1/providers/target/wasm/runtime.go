@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+)
+
+// wasmPageSize is the size of a page of linear memory
+const wasmPageSize = 64 * 1024
+
+// moduleRuntime starts, stops and reports the modules of components
+type moduleRuntime interface {
+	// Start starts a module, and records how to find it again in the deployed module
+	Start(ctx context.Context, folder string, deployed *deployedModule) error
+	// Stop stops a module if it is running
+	Stop(ctx context.Context, deployed *deployedModule) error
+	// Status returns whether a module is running or stopped
+	Status(ctx context.Context, deployed *deployedModule) (string, error)
+}
+
+// cliRuntime runs each module in a process of the wasmtime or wasmedge command. The processes
+// keep running when the provider restarts, and are found again by their recorded ids.
+type cliRuntime struct {
+	kind        string
+	path        string
+	stopTimeout time.Duration
+}
+
+func (r *cliRuntime) Start(ctx context.Context, folder string, deployed *deployedModule) error {
+	log, err := os.OpenFile(filepath.Join(folder, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(r.path, r.args(deployed.Module)...)
+	cmd.Dir = folder
+	cmd.Stdout = log
+	cmd.Stderr = log
+	detach(cmd)
+	if err = cmd.Start(); err != nil {
+		log.Close()
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to start %s", r.path), v1alpha2.InternalError)
+	}
+	deployed.Pid = cmd.Process.Pid
+	go func() {
+		// reaps the process when it exits before the provider
+		cmd.Wait()
+		log.Close()
+	}()
+	return nil
+}
+
+func (r *cliRuntime) Stop(ctx context.Context, deployed *deployedModule) error {
+	if !r.isRunning(deployed) {
+		return nil
+	}
+	if err := terminate(deployed.Pid, r.stopTimeout); err != nil {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to stop module %s", deployed.Module.Name), v1alpha2.InternalError)
+	}
+	return nil
+}
+
+func (r *cliRuntime) Status(ctx context.Context, deployed *deployedModule) (string, error) {
+	if r.isRunning(deployed) {
+		return stateRunning, nil
+	}
+	return stateStopped, nil
+}
+
+// isRunning checks that the recorded process runs the module, as process ids are reused
+func (r *cliRuntime) isRunning(deployed *deployedModule) bool {
+	if deployed.Pid <= 0 || !isProcessRunning(deployed.Pid) {
+		return false
+	}
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", deployed.Pid))
+	if err != nil {
+		// there is no procfs to check the command with
+		return true
+	}
+	return strings.Contains(string(cmdline), deployed.Module.Path)
+}
+
+// args returns the arguments of the runtime command that runs a module
+func (r *cliRuntime) args(module moduleSpec) []string {
+	var ret []string
+	envNames := make([]string, 0, len(module.Env))
+	for k := range module.Env {
+		envNames = append(envNames, k)
+	}
+	sort.Strings(envNames)
+	switch r.kind {
+	case runtimeWasmedge:
+		for _, dir := range module.Dirs {
+			ret = append(ret, "--dir", dir+":"+dir)
+		}
+		for _, k := range envNames {
+			ret = append(ret, "--env", k+"="+module.Env[k])
+		}
+		if module.MaxMemory > 0 {
+			pages := (module.MaxMemory + wasmPageSize - 1) / wasmPageSize
+			ret = append(ret, "--memory-page-limit", strconv.FormatInt(pages, 10))
+		}
+		if module.Fuel > 0 {
+			ret = append(ret, "--gas-limit", strconv.FormatUint(module.Fuel, 10))
+		}
+		if module.TimeoutMs > 0 {
+			ret = append(ret, "--time-limit", strconv.FormatInt(module.TimeoutMs, 10))
+		}
+	default:
+		ret = append(ret, "run")
+		for _, dir := range module.Dirs {
+			ret = append(ret, "--dir", dir+"::"+dir)
+		}
+		for _, k := range envNames {
+			ret = append(ret, "--env", k+"="+module.Env[k])
+		}
+		if module.MaxMemory > 0 {
+			ret = append(ret, "-W", "max-memory-size="+strconv.FormatInt(module.MaxMemory, 10))
+		}
+		if module.Fuel > 0 {
+			ret = append(ret, "-W", "fuel="+strconv.FormatUint(module.Fuel, 10))
+		}
+		if module.TimeoutMs > 0 {
+			ret = append(ret, "-W", "timeout="+strconv.FormatInt(module.TimeoutMs, 10)+"ms")
+		}
+	}
+	ret = append(ret, module.Path)
+	return append(ret, module.Args...)
+}
+
+// shimRuntime hands modules to a local shim process that runs them, through its HTTP API:
+//
+//	PUT    /modules/{name}  starts or replaces a module, with the module spec as the body
+//	DELETE /modules/{name}  stops a module
+//	GET    /modules/{name}  returns {"state": "running"} or {"state": "stopped"}, or 404
+type shimRuntime struct {
+	baseUrl string
+	client  *http.Client
+}
+
+type shimStatus struct {
+	State string `json:"state"`
+}
+
+// newShimRuntime creates a client of the shim at an http(s):// address, or a unix:// socket
+func newShimRuntime(address string) (*shimRuntime, error) {
+	u, err := url.Parse(address)
+	if err != nil || address == "" {
+		return nil, fmt.Errorf("invalid shim address '%s'", address)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &shimRuntime{baseUrl: strings.TrimSuffix(address, "/"), client: &http.Client{Timeout: 30 * time.Second}}, nil
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &shimRuntime{baseUrl: "http://shim", client: &http.Client{Transport: transport, Timeout: 30 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("invalid shim address '%s', expected an http, https or unix URL", address)
+	}
+}
+
+func (r *shimRuntime) Start(ctx context.Context, folder string, deployed *deployedModule) error {
+	data, err := json.Marshal(deployed.Module)
+	if err != nil {
+		return err
+	}
+	_, err = r.send(ctx, http.MethodPut, deployed.Module.Name, data)
+	return err
+}
+
+func (r *shimRuntime) Stop(ctx context.Context, deployed *deployedModule) error {
+	_, err := r.send(ctx, http.MethodDelete, deployed.Module.Name, nil)
+	if v1alpha2.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *shimRuntime) Status(ctx context.Context, deployed *deployedModule) (string, error) {
+	data, err := r.send(ctx, http.MethodGet, deployed.Module.Name, nil)
+	if v1alpha2.IsNotFound(err) {
+		return stateStopped, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var status shimStatus
+	if err = json.Unmarshal(data, &status); err != nil {
+		return "", v1alpha2.NewCOAError(err, "invalid module state from the shim", v1alpha2.InternalError)
+	}
+	if status.State != stateRunning {
+		return stateStopped, nil
+	}
+	return stateRunning, nil
+}
+
+func (r *shimRuntime) send(ctx context.Context, method string, name string, body []byte) ([]byte, error) {
+	u := r.baseUrl + "/modules/" + url.PathEscape(name)
+	request, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to create request to %s", u), v1alpha2.HttpNewRequestFailed)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(request)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to send request to the shim", v1alpha2.HttpSendRequestFailed)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("module %s is not found by the shim", name), v1alpha2.NotFound)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s %s responded %d: %s", method, u, resp.StatusCode, strings.TrimSpace(string(data))), v1alpha2.HttpErrorResponse)
+	}
+	return data, nil
+}
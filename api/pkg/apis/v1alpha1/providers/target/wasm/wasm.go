@@ -0,0 +1,624 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	loggerName = "providers.target.wasm"
+
+	wasmUrl       = "wasm.url"
+	wasmSha256    = "wasm.sha256"
+	wasmArgs      = "wasm.args"
+	wasmEnv       = "wasm.env"
+	wasmDir       = "wasm.dir"
+	wasmMaxMemory = "wasm.maxMemory"
+	wasmFuel      = "wasm.fuel"
+	wasmTimeout   = "wasm.timeout"
+	wasmState     = "wasm.state"
+
+	runtimeWasmtime = "wasmtime"
+	runtimeWasmedge = "wasmedge"
+	runtimeShim     = "shim"
+
+	stateRunning = "running"
+	stateStopped = "stopped"
+
+	defaultModuleFolder       = "/opt/symphony/wasm"
+	defaultStopTimeoutSeconds = 10
+
+	moduleFile = "module.wasm"
+	recordFile = "module.json"
+	logFile    = "module.log"
+)
+
+var (
+	sLog          = logger.NewLogger(loggerName)
+	sha256Pattern = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+	envPattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// wasmMagic starts WebAssembly modules and components in binary format
+	wasmMagic = []byte{0x00, 'a', 's', 'm'}
+	// recordedProperties are the component properties recorded with a module, which Get reports
+	recordedProperties = []string{wasmUrl, wasmArgs, wasmEnv, wasmDir, wasmMaxMemory, wasmFuel, wasmTimeout}
+)
+
+type WasmTargetProviderConfig struct {
+	Name string `json:"name"`
+	// Runtime runs the modules: wasmtime, wasmedge or shim
+	Runtime string `json:"runtime,omitempty"`
+	// RuntimePath is the command of the wasmtime or wasmedge runtime
+	RuntimePath string `json:"runtimePath,omitempty"`
+	// ShimAddress is the unix:// or http(s):// address of the shim process
+	ShimAddress string `json:"shimAddress,omitempty"`
+	// ModuleFolder is the folder modules are installed to, in a subfolder per component
+	ModuleFolder       string `json:"moduleFolder,omitempty"`
+	StopTimeoutSeconds int    `json:"stopTimeoutSeconds,omitempty"`
+}
+
+type WasmTargetProvider struct {
+	Config  WasmTargetProviderConfig
+	Context *contexts.ManagerContext
+	runtime moduleRuntime
+}
+
+// moduleSpec is a module and the way it runs, read from component properties
+type moduleSpec struct {
+	Name string `json:"name"`
+	// Path is the module file
+	Path string `json:"path"`
+	// Digest is the SHA-256 digest of the module file, in hex
+	Digest string            `json:"digest"`
+	Args   []string          `json:"args,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	// Dirs are host folders the module can access, at the same paths
+	Dirs []string `json:"dirs,omitempty"`
+	// MaxMemory is the limit of the linear memory of the module in bytes
+	MaxMemory int64 `json:"maxMemory,omitempty"`
+	// Fuel is the limit of instructions the module runs, as fuel in wasmtime and gas in wasmedge
+	Fuel uint64 `json:"fuel,omitempty"`
+	// TimeoutMs is the limit of the run time of the module in milliseconds
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
+}
+
+// deployedModule is recorded in the folder of a component when its module is started
+type deployedModule struct {
+	Module moduleSpec `json:"module"`
+	Url    string     `json:"url"`
+	// Properties are the component properties the module was deployed with
+	Properties map[string]interface{} `json:"properties"`
+	// Pid is the process of the module when it is run by a runtime command
+	Pid       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+func WasmTargetProviderConfigFromMap(properties map[string]string) (WasmTargetProviderConfig, error) {
+	ret := WasmTargetProviderConfig{}
+	if v, ok := properties["name"]; ok {
+		ret.Name = v
+	}
+	if v, ok := properties["runtime"]; ok {
+		ret.Runtime = v
+	}
+	if v, ok := properties["runtimePath"]; ok {
+		ret.RuntimePath = v
+	}
+	if v, ok := properties["shimAddress"]; ok {
+		ret.ShimAddress = v
+	}
+	if v, ok := properties["moduleFolder"]; ok {
+		ret.ModuleFolder = v
+	}
+	if v, ok := properties["stopTimeoutSeconds"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid wasm provider config, invalid stopTimeoutSeconds '%s'", v), v1alpha2.BadConfig)
+		}
+		ret.StopTimeoutSeconds = n
+	}
+	return ret, nil
+}
+
+func (i *WasmTargetProvider) InitWithMap(properties map[string]string) error {
+	config, err := WasmTargetProviderConfigFromMap(properties)
+	if err != nil {
+		sLog.Errorf("  P (Wasm Target): expected WasmTargetProviderConfig: %+v", err)
+		return err
+	}
+	return i.Init(config)
+}
+
+func (s *WasmTargetProvider) SetContext(ctx *contexts.ManagerContext) {
+	s.Context = ctx
+}
+
+func (i *WasmTargetProvider) Init(config providers.IProviderConfig) error {
+	ctx, span := observability.StartSpan("Wasm Target Provider", context.TODO(), &map[string]string{
+		"method": "Init",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfoCtx(ctx, "  P (Wasm Target): Init()")
+
+	updateConfig, err := toWasmTargetProviderConfig(config)
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Wasm Target): expected WasmTargetProviderConfig: %+v", err)
+		err = v1alpha2.NewCOAError(err, "expected WasmTargetProviderConfig", v1alpha2.InitFailed)
+		return err
+	}
+	if updateConfig.Runtime == "" {
+		updateConfig.Runtime = runtimeWasmtime
+	}
+	if updateConfig.ModuleFolder == "" {
+		updateConfig.ModuleFolder = defaultModuleFolder
+	}
+	if updateConfig.StopTimeoutSeconds <= 0 {
+		updateConfig.StopTimeoutSeconds = defaultStopTimeoutSeconds
+	}
+	switch updateConfig.Runtime {
+	case runtimeWasmtime, runtimeWasmedge:
+		if updateConfig.RuntimePath == "" {
+			updateConfig.RuntimePath = updateConfig.Runtime
+		}
+		if i.runtime == nil {
+			i.runtime = &cliRuntime{
+				kind:        updateConfig.Runtime,
+				path:        updateConfig.RuntimePath,
+				stopTimeout: time.Duration(updateConfig.StopTimeoutSeconds) * time.Second,
+			}
+		}
+	case runtimeShim:
+		if i.runtime == nil {
+			i.runtime, err = newShimRuntime(updateConfig.ShimAddress)
+			if err != nil {
+				sLog.ErrorfCtx(ctx, "  P (Wasm Target): invalid shim address: %+v", err)
+				err = v1alpha2.NewCOAError(err, "invalid wasm provider config", v1alpha2.BadConfig)
+				return err
+			}
+		}
+	default:
+		err = v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid wasm provider config, unknown runtime '%s', expected %s, %s or %s", updateConfig.Runtime, runtimeWasmtime, runtimeWasmedge, runtimeShim), v1alpha2.BadConfig)
+		sLog.ErrorfCtx(ctx, "  P (Wasm Target): %+v", err)
+		return err
+	}
+	i.Config = updateConfig
+	return nil
+}
+
+func toWasmTargetProviderConfig(config providers.IProviderConfig) (WasmTargetProviderConfig, error) {
+	ret := WasmTargetProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+func (i *WasmTargetProvider) Get(ctx context.Context, deployment model.DeploymentSpec, references []model.ComponentStep) ([]model.ComponentSpec, error) {
+	ctx, span := observability.StartSpan("Wasm Target Provider", ctx, &map[string]string{
+		"method": "Get",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Wasm Target): getting artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	ret := make([]model.ComponentSpec, 0)
+	for _, component := range references {
+		deployed, rerr := readDeployed(i.componentFolder(component.Component))
+		if rerr != nil {
+			sLog.InfofCtx(ctx, "  P (Wasm Target): module of %s is not deployed", component.Component.Name)
+			continue
+		}
+		var state string
+		state, err = i.runtime.Status(ctx, deployed)
+		if err != nil {
+			sLog.ErrorfCtx(ctx, "  P (Wasm Target): failed to get state of module %s: %+v", component.Component.Name, err)
+			return nil, err
+		}
+		spec := model.ComponentSpec{
+			Name:       component.Component.Name,
+			Type:       component.Component.Type,
+			Properties: map[string]interface{}{},
+		}
+		for k, v := range deployed.Properties {
+			spec.Properties[k] = v
+		}
+		spec.Properties[wasmSha256] = deployed.Module.Digest
+		spec.Properties[wasmState] = state
+		sLog.InfofCtx(ctx, "  P (Wasm Target): append component: %s, module is %s", spec.Name, state)
+		ret = append(ret, spec)
+	}
+	return ret, nil
+}
+
+func (i *WasmTargetProvider) Apply(ctx context.Context, deployment model.DeploymentSpec, step model.DeploymentStep, isDryRun bool) (map[string]model.ComponentResultSpec, error) {
+	ctx, span := observability.StartSpan("Wasm Target Provider", ctx, &map[string]string{
+		"method": "Apply",
+	})
+	var err error = nil
+	defer observ_utils.CloseSpanWithError(span, &err)
+	defer observ_utils.EmitUserDiagnosticsLogs(ctx, &err)
+
+	sLog.InfofCtx(ctx, "  P (Wasm Target): applying artifacts: %s - %s", deployment.Instance.Spec.Scope, deployment.Instance.ObjectMeta.Name)
+
+	injections := &model.ValueInjections{
+		InstanceId:        deployment.Instance.ObjectMeta.Name,
+		SolutionVersionId: deployment.Instance.Spec.SolutionVersion,
+		TargetId:          deployment.ActiveTarget,
+	}
+
+	components := step.GetComponents()
+	err = i.GetValidationRule(ctx).Validate(components)
+	if err == nil {
+		for _, component := range step.GetUpdatedComponents() {
+			if _, err = readModuleSpec(component, injections); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		sLog.ErrorfCtx(ctx, "  P (Wasm Target): failed to validate components: %+v", err)
+		return nil, err
+	}
+	if isDryRun {
+		sLog.DebugCtx(ctx, "  P (Wasm Target): dryRun is enabled, skipping apply")
+		err = nil
+		return nil, nil
+	}
+
+	ret := step.PrepareResultMap()
+	for _, component := range step.Components {
+		if component.Action == model.ComponentUpdate {
+			err = i.deploy(ctx, component.Component, injections)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.UpdateFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Wasm Target): failed to deploy module of %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Updated,
+				Message: "",
+			}
+		} else {
+			err = i.remove(ctx, component.Component)
+			if err != nil {
+				ret[component.Component.Name] = model.ComponentResultSpec{
+					Status:  v1alpha2.DeleteFailed,
+					Message: err.Error(),
+				}
+				sLog.ErrorfCtx(ctx, "  P (Wasm Target): failed to remove module of %s: %+v", component.Component.Name, err)
+				return ret, err
+			}
+			ret[component.Component.Name] = model.ComponentResultSpec{
+				Status:  v1alpha2.Deleted,
+				Message: "",
+			}
+		}
+	}
+	return ret, nil
+}
+
+// deploy downloads the module of a component, stops the module that runs for the component and starts the new one
+func (i *WasmTargetProvider) deploy(ctx context.Context, component model.ComponentSpec, injections *model.ValueInjections) error {
+	spec, err := readModuleSpec(component, injections)
+	if err != nil {
+		return err
+	}
+	folder := i.componentFolder(component)
+	if err = os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+	sourceUrl := model.ReadPropertyCompat(component.Properties, wasmUrl, injections)
+	spec.Path = filepath.Join(folder, moduleFile)
+	if spec.Digest, err = download(ctx, sourceUrl, spec); err != nil {
+		return err
+	}
+
+	if deployed, err := readDeployed(folder); err == nil {
+		sLog.InfofCtx(ctx, "  P (Wasm Target): stop module of %s", component.Name)
+		if err = i.runtime.Stop(ctx, deployed); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(spec.Path+".download", spec.Path); err != nil {
+		return err
+	}
+
+	deployed := &deployedModule{
+		Module:     spec,
+		Url:        sourceUrl,
+		Properties: map[string]interface{}{},
+		StartedAt:  time.Now().UTC(),
+	}
+	for _, key := range recordedProperties {
+		if v, ok := component.Properties[key]; ok {
+			deployed.Properties[key] = v
+		}
+	}
+	sLog.InfofCtx(ctx, "  P (Wasm Target): start module of %s with digest %s", component.Name, spec.Digest)
+	if err = i.runtime.Start(ctx, folder, deployed); err != nil {
+		return err
+	}
+	return writeDeployed(folder, deployed)
+}
+
+// remove stops the module of a component and deletes its folder
+func (i *WasmTargetProvider) remove(ctx context.Context, component model.ComponentSpec) error {
+	folder := i.componentFolder(component)
+	if deployed, err := readDeployed(folder); err == nil {
+		sLog.InfofCtx(ctx, "  P (Wasm Target): stop module of %s", component.Name)
+		if err = i.runtime.Stop(ctx, deployed); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(folder)
+}
+
+func (i *WasmTargetProvider) componentFolder(component model.ComponentSpec) string {
+	return filepath.Join(i.Config.ModuleFolder, component.Name)
+}
+
+func readDeployed(folder string) (*deployedModule, error) {
+	data, err := os.ReadFile(filepath.Join(folder, recordFile))
+	if err != nil {
+		return nil, err
+	}
+	var ret deployedModule
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func writeDeployed(folder string, deployed *deployedModule) error {
+	data, err := json.MarshalIndent(deployed, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(folder, recordFile)
+	if err = os.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// download writes a module next to its path with the .download suffix, and checks that it is a
+// WebAssembly binary with the pinned digest. It returns the digest of the module.
+func download(ctx context.Context, source string, spec moduleSpec) (string, error) {
+	var reader io.ReadCloser
+	u, _ := url.Parse(source)
+	switch u.Scheme {
+	case "http", "https":
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to create request to %s", source), v1alpha2.HttpNewRequestFailed)
+		}
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return "", v1alpha2.NewCOAError(err, fmt.Sprintf("failed to send request to %s", source), v1alpha2.HttpSendRequestFailed)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			resp.Body.Close()
+			return "", v1alpha2.NewCOAError(nil, fmt.Sprintf("request to %s responded %d", source, resp.StatusCode), v1alpha2.HttpErrorResponse)
+		}
+		reader = resp.Body
+	default:
+		file, err := os.Open(localPath(u))
+		if err != nil {
+			return "", err
+		}
+		reader = file
+	}
+	defer reader.Close()
+
+	target := spec.Path + ".download"
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), reader)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(target)
+		return "", fmt.Errorf("failed to download module from %s: %w", source, err)
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if spec.Digest != "" && digest != spec.Digest {
+		os.Remove(target)
+		return "", v1alpha2.NewCOAError(nil, fmt.Sprintf("digest of module %s is %s, expected %s", source, digest, spec.Digest), v1alpha2.BadRequest)
+	}
+	if !isWasmBinary(target) {
+		os.Remove(target)
+		return "", v1alpha2.NewCOAError(nil, fmt.Sprintf("%s is not a WebAssembly binary", source), v1alpha2.BadRequest)
+	}
+	return digest, nil
+}
+
+func isWasmBinary(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, len(wasmMagic))
+	if _, err = io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return string(header) == string(wasmMagic)
+}
+
+// localPath returns the file of a file:// URL or a path
+func localPath(u *url.URL) string {
+	if u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return u.String()
+}
+
+// readModuleSpec reads and checks the module of a component
+func readModuleSpec(component model.ComponentSpec, injections *model.ValueInjections) (moduleSpec, error) {
+	read := func(key string) string {
+		return strings.TrimSpace(model.ReadPropertyCompat(component.Properties, key, injections))
+	}
+	ret := moduleSpec{
+		Name:   component.Name,
+		Digest: strings.TrimPrefix(strings.ToLower(read(wasmSha256)), "sha256:"),
+	}
+	invalid := func(format string, args ...interface{}) (moduleSpec, error) {
+		return ret, v1alpha2.NewCOAError(nil, fmt.Sprintf("component %s: %s", component.Name, fmt.Sprintf(format, args...)), v1alpha2.BadRequest)
+	}
+	if component.Name == "" || !filepath.IsLocal(component.Name) || strings.ContainsAny(component.Name, `/\`) {
+		return invalid("invalid component name")
+	}
+	source := read(wasmUrl)
+	u, err := url.Parse(source)
+	if err != nil || source == "" {
+		return invalid("invalid %s '%s'", wasmUrl, source)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return invalid("invalid %s '%s'", wasmUrl, source)
+		}
+	case "file", "":
+		if !filepath.IsAbs(localPath(u)) {
+			return invalid("invalid %s '%s', expected an http, https or file URL, or an absolute path", wasmUrl, source)
+		}
+	default:
+		return invalid("invalid %s '%s', expected an http, https or file URL, or an absolute path", wasmUrl, source)
+	}
+	if ret.Digest != "" && !sha256Pattern.MatchString(ret.Digest) {
+		return invalid("invalid %s '%s', expected 64 hex digits", wasmSha256, ret.Digest)
+	}
+	if err = readJSONProperty(component.Properties, wasmArgs, &ret.Args); err != nil {
+		return invalid("invalid %s, expected a list of strings", wasmArgs)
+	}
+	if err = readJSONProperty(component.Properties, wasmEnv, &ret.Env); err != nil {
+		return invalid("invalid %s, expected an object of strings", wasmEnv)
+	}
+	for k := range ret.Env {
+		if !envPattern.MatchString(k) {
+			return invalid("invalid environment variable name '%s'", k)
+		}
+	}
+	if v, ok := component.Properties[wasmDir]; ok && v != nil {
+		if s, ok := v.(string); ok && !strings.HasPrefix(strings.TrimSpace(s), "[") {
+			ret.Dirs = []string{s}
+		} else if err = readJSONProperty(component.Properties, wasmDir, &ret.Dirs); err != nil {
+			return invalid("invalid %s, expected a folder or a list of folders", wasmDir)
+		}
+	}
+	for _, dir := range ret.Dirs {
+		if !filepath.IsAbs(dir) {
+			return invalid("invalid %s '%s', expected an absolute path", wasmDir, dir)
+		}
+	}
+	if v := read(wasmMaxMemory); v != "" {
+		q, err := resource.ParseQuantity(v)
+		if err != nil || q.Value() <= 0 {
+			return invalid("invalid %s '%s', expected a quantity such as 64Mi", wasmMaxMemory, v)
+		}
+		ret.MaxMemory = q.Value()
+	}
+	if v := read(wasmFuel); v != "" {
+		if ret.Fuel, err = strconv.ParseUint(v, 10, 64); err != nil || ret.Fuel == 0 {
+			return invalid("invalid %s '%s', expected a positive integer", wasmFuel, v)
+		}
+	}
+	if v := read(wasmTimeout); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Millisecond {
+			return invalid("invalid %s '%s', expected a duration such as 30s", wasmTimeout, v)
+		}
+		ret.TimeoutMs = d.Milliseconds()
+	}
+	return ret, nil
+}
+
+// readJSONProperty reads a property given as a value or as a JSON string
+func readJSONProperty(properties map[string]interface{}, key string, target interface{}) error {
+	v, ok := properties[key]
+	if !ok || v == nil {
+		return nil
+	}
+	var data []byte
+	if s, ok := v.(string); ok {
+		data = []byte(s)
+	} else {
+		data, _ = json.Marshal(v)
+	}
+	return json.Unmarshal(data, target)
+}
+
+// isDigestChanged compares a module digest with a desired digest, which can have the sha256: prefix
+func isDigestChanged(oldProp, newProp any) bool {
+	desired := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", newProp))), "sha256:")
+	if newProp == nil || desired == "" {
+		return false
+	}
+	return fmt.Sprintf("%v", oldProp) != desired
+}
+
+// isStateChanged reports a module that is not running
+func isStateChanged(oldProp, newProp any) bool {
+	return fmt.Sprintf("%v", oldProp) != stateRunning
+}
+
+func (*WasmTargetProvider) GetValidationRule(ctx context.Context) model.ValidationRule {
+	changeDetection := []model.PropertyDesc{
+		{Name: wasmSha256, IgnoreCase: true, SkipIfMissing: true, PropChanged: isDigestChanged},
+		{Name: wasmState, IgnoreCase: false, SkipIfMissing: false, PropChanged: isStateChanged},
+	}
+	for _, key := range recordedProperties {
+		changeDetection = append(changeDetection, model.PropertyDesc{Name: key, IgnoreCase: false, SkipIfMissing: false})
+	}
+	return model.ValidationRule{
+		AllowSidecar: false,
+		ComponentValidationRule: model.ComponentValidationRule{
+			RequiredProperties:        []string{wasmUrl},
+			OptionalProperties:        []string{wasmSha256, wasmArgs, wasmEnv, wasmDir, wasmMaxMemory, wasmFuel, wasmTimeout},
+			RequiredComponentType:     "",
+			RequiredMetadata:          []string{},
+			OptionalMetadata:          []string{},
+			ChangeDetectionProperties: changeDetection,
+		},
+	}
+}
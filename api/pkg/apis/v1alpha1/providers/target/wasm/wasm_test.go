@@ -0,0 +1,379 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/conformance"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/stretchr/testify/assert"
+)
+
+var testModule = append([]byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}, []byte("detector")...)
+
+// fakeRuntime records the arguments it runs with, and runs until it is stopped
+const fakeRuntime = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args.txt"
+while true; do sleep 1; done
+`
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func serveModules(t *testing.T, modules map[string][]byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := modules[r.URL.Path]; ok {
+			w.Write(data)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func createCLIProvider(t *testing.T) *WasmTargetProvider {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping because the fake runtime is a shell script")
+	}
+	runtimeFolder := t.TempDir()
+	runtimePath := filepath.Join(runtimeFolder, "wasmtime")
+	err := os.WriteFile(runtimePath, []byte(fakeRuntime), 0755)
+	assert.Nil(t, err)
+	provider := &WasmTargetProvider{}
+	err = provider.Init(WasmTargetProviderConfig{RuntimePath: runtimePath, ModuleFolder: t.TempDir(), StopTimeoutSeconds: 2})
+	assert.Nil(t, err)
+	return provider
+}
+
+func readArgs(t *testing.T, provider *WasmTargetProvider) string {
+	file := filepath.Join(filepath.Dir(provider.Config.RuntimePath), "args.txt")
+	var data []byte
+	assert.Eventually(t, func() bool {
+		var err error
+		data, err = os.ReadFile(file)
+		return err == nil && len(data) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	os.Remove(file)
+	return strings.TrimSpace(string(data))
+}
+
+func TestWasmTargetProviderConfigFromMap(t *testing.T) {
+	config, err := WasmTargetProviderConfigFromMap(map[string]string{
+		"name":               "wasm",
+		"runtime":            "wasmedge",
+		"stopTimeoutSeconds": "5",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "wasmedge", config.Runtime)
+	assert.Equal(t, 5, config.StopTimeoutSeconds)
+
+	_, err = WasmTargetProviderConfigFromMap(map[string]string{"stopTimeoutSeconds": "soon"})
+	assert.NotNil(t, err)
+
+	provider := WasmTargetProvider{}
+	err = provider.InitWithMap(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, runtimeWasmtime, provider.Config.Runtime)
+	assert.Equal(t, defaultModuleFolder, provider.Config.ModuleFolder)
+	assert.Equal(t, &cliRuntime{kind: runtimeWasmtime, path: runtimeWasmtime, stopTimeout: defaultStopTimeoutSeconds * time.Second}, provider.runtime)
+
+	for _, properties := range []map[string]string{
+		{"runtime": "wasmer"},
+		{"runtime": "shim"},
+		{"runtime": "shim", "shimAddress": "tcp://localhost:8090"},
+	} {
+		provider = WasmTargetProvider{}
+		err = provider.InitWithMap(properties)
+		assert.NotNil(t, err, properties)
+	}
+	provider = WasmTargetProvider{}
+	err = provider.InitWithMap(map[string]string{"runtime": "shim", "shimAddress": "unix:///run/symphony/wasm-shim.sock"})
+	assert.Nil(t, err)
+}
+
+func TestCLIRuntimeArgs(t *testing.T) {
+	module := moduleSpec{
+		Path:      "/opt/symphony/wasm/detector/module.wasm",
+		Args:      []string{"--threshold", "0.8"},
+		Env:       map[string]string{"MODE": "edge", "LEVEL": "debug"},
+		Dirs:      []string{"/data"},
+		MaxMemory: 64 * 1024 * 1024,
+		Fuel:      1000000,
+		TimeoutMs: 30000,
+	}
+	wasmtime := &cliRuntime{kind: runtimeWasmtime}
+	assert.Equal(t, []string{"run", "--dir", "/data::/data", "--env", "LEVEL=debug", "--env", "MODE=edge",
+		"-W", "max-memory-size=67108864", "-W", "fuel=1000000", "-W", "timeout=30000ms",
+		module.Path, "--threshold", "0.8"}, wasmtime.args(module))
+	wasmedge := &cliRuntime{kind: runtimeWasmedge}
+	assert.Equal(t, []string{"--dir", "/data:/data", "--env", "LEVEL=debug", "--env", "MODE=edge",
+		"--memory-page-limit", "1024", "--gas-limit", "1000000", "--time-limit", "30000",
+		module.Path, "--threshold", "0.8"}, wasmedge.args(module))
+	assert.Equal(t, []string{"run", "/module.wasm"}, wasmtime.args(moduleSpec{Path: "/module.wasm"}))
+}
+
+func TestReadModuleSpec(t *testing.T) {
+	spec, err := readModuleSpec(model.ComponentSpec{
+		Name: "detector",
+		Properties: map[string]interface{}{
+			wasmUrl:       "https://contoso.com/detector.wasm",
+			wasmSha256:    "SHA256:" + strings.ToUpper(digest(testModule)),
+			wasmArgs:      []interface{}{"--instance", "${{$instance()}}"},
+			wasmEnv:       `{"MODE":"edge"}`,
+			wasmDir:       "/data",
+			wasmMaxMemory: "64Mi",
+			wasmFuel:      "1000",
+			wasmTimeout:   "1m",
+		},
+	}, &model.ValueInjections{InstanceId: "edge-instance"})
+	assert.Nil(t, err)
+	assert.Equal(t, digest(testModule), spec.Digest)
+	assert.Equal(t, []string{"--instance", "${{$instance()}}"}, spec.Args)
+	assert.Equal(t, map[string]string{"MODE": "edge"}, spec.Env)
+	assert.Equal(t, []string{"/data"}, spec.Dirs)
+	assert.Equal(t, int64(64*1024*1024), spec.MaxMemory)
+	assert.Equal(t, uint64(1000), spec.Fuel)
+	assert.Equal(t, int64(60000), spec.TimeoutMs)
+
+	spec, err = readModuleSpec(model.ComponentSpec{
+		Name:       "detector",
+		Properties: map[string]interface{}{wasmUrl: "file:///opt/modules/detector.wasm", wasmDir: []interface{}{"/data", "/models"}},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/data", "/models"}, spec.Dirs)
+
+	invalid := []map[string]interface{}{
+		{},
+		{wasmUrl: "ftp://contoso.com/detector.wasm"},
+		{wasmUrl: "detector.wasm"},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmSha256: "abc"},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmArgs: "--threshold 0.8"},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmEnv: []interface{}{"MODE=edge"}},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmEnv: map[string]interface{}{"MODE=": "edge"}},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmDir: "data"},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmMaxMemory: "lots"},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmFuel: "-1"},
+		{wasmUrl: "https://contoso.com/detector.wasm", wasmTimeout: "30"},
+	}
+	for _, properties := range invalid {
+		_, err = readModuleSpec(model.ComponentSpec{Name: "detector", Properties: properties}, nil)
+		assert.NotNil(t, err, properties)
+	}
+	_, err = readModuleSpec(model.ComponentSpec{Name: "../detector", Properties: map[string]interface{}{wasmUrl: "/detector.wasm"}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestWasmTargetProviderLifecycle(t *testing.T) {
+	provider := createCLIProvider(t)
+	updated := append(append([]byte{}, testModule...), '2')
+	server := serveModules(t, map[string][]byte{"/detector.wasm": testModule, "/detector-2.wasm": updated})
+	component := model.ComponentSpec{
+		Name: "detector",
+		Properties: map[string]interface{}{
+			wasmUrl:       server.URL + "/detector.wasm",
+			wasmSha256:    "sha256:" + digest(testModule),
+			wasmArgs:      []interface{}{"--instance", "edge"},
+			wasmMaxMemory: "64Mi",
+		},
+	}
+	deployment := model.DeploymentSpec{
+		Instance: model.InstanceState{
+			ObjectMeta: model.ObjectMeta{Name: "edge-instance"},
+			Spec:       &model.InstanceSpec{},
+		},
+	}
+	references := []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}
+
+	components, err := provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(components))
+
+	ret, err := provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["detector"].Status)
+	modulePath := filepath.Join(provider.Config.ModuleFolder, "detector", moduleFile)
+	assert.Equal(t, "run -W max-memory-size=67108864 "+modulePath+" --instance edge", readArgs(t, provider))
+	data, err := os.ReadFile(modulePath)
+	assert.Nil(t, err)
+	assert.Equal(t, testModule, data)
+
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(components))
+	assert.Equal(t, stateRunning, components[0].Properties[wasmState])
+	assert.Equal(t, digest(testModule), components[0].Properties[wasmSha256])
+	rule := provider.GetValidationRule(context.Background())
+	assert.False(t, rule.IsComponentChanged(components[0], component))
+
+	// changed arguments, a removed limit and a new module are deployed again
+	changed := model.ComponentSpec{Name: "detector", Properties: map[string]interface{}{}}
+	for k, v := range component.Properties {
+		changed.Properties[k] = v
+	}
+	changed.Properties[wasmArgs] = []interface{}{"--instance", "cloud"}
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+	delete(changed.Properties, wasmMaxMemory)
+	changed.Properties[wasmArgs] = component.Properties[wasmArgs]
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+	changed.Properties[wasmUrl] = server.URL + "/detector-2.wasm"
+	changed.Properties[wasmSha256] = digest(updated)
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+
+	deployed, err := readDeployed(filepath.Join(provider.Config.ModuleFolder, "detector"))
+	assert.Nil(t, err)
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: changed}}}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Updated, ret["detector"].Status)
+	assert.Equal(t, "run "+modulePath+" --instance edge", readArgs(t, provider))
+	assert.Eventually(t, func() bool {
+		return !isProcessRunning(deployed.Pid)
+	}, 5*time.Second, 50*time.Millisecond)
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, digest(updated), components[0].Properties[wasmSha256])
+	assert.False(t, rule.IsComponentChanged(components[0], changed))
+
+	// a stopped module is deployed again
+	deployed, err = readDeployed(filepath.Join(provider.Config.ModuleFolder, "detector"))
+	assert.Nil(t, err)
+	err = terminate(deployed.Pid, 2*time.Second)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		components, err = provider.Get(context.Background(), deployment, references)
+		return err == nil && components[0].Properties[wasmState] == stateStopped
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.True(t, rule.IsComponentChanged(components[0], changed))
+
+	references[0].Action = model.ComponentDelete
+	ret, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, v1alpha2.Deleted, ret["detector"].Status)
+	_, err = os.Stat(filepath.Join(provider.Config.ModuleFolder, "detector"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWasmTargetProviderDigestMismatch(t *testing.T) {
+	provider := createCLIProvider(t)
+	server := serveModules(t, map[string][]byte{"/detector.wasm": testModule, "/detector.txt": []byte("not a module")})
+	for _, properties := range []map[string]interface{}{
+		{wasmUrl: server.URL + "/detector.wasm", wasmSha256: digest([]byte("other"))},
+		{wasmUrl: server.URL + "/detector.txt"},
+		{wasmUrl: server.URL + "/missing.wasm"},
+	} {
+		ret, err := provider.Apply(context.Background(), model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}},
+			model.DeploymentStep{Components: []model.ComponentStep{{Action: model.ComponentUpdate, Component: model.ComponentSpec{Name: "detector", Properties: properties}}}}, false)
+		assert.NotNil(t, err, properties)
+		assert.Equal(t, v1alpha2.UpdateFailed, ret["detector"].Status)
+		_, err = os.Stat(filepath.Join(provider.Config.ModuleFolder, "detector", moduleFile))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+// fakeShim keeps modules in memory
+type fakeShim struct {
+	lock    sync.Mutex
+	modules map[string]moduleSpec
+}
+
+func (s *fakeShim) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/modules/")
+	switch r.Method {
+	case http.MethodPut:
+		var module moduleSpec
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &module); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.modules[name] = module
+	case http.MethodDelete:
+		if _, ok := s.modules[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.modules, name)
+	case http.MethodGet:
+		if _, ok := s.modules[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"state":"running"}`))
+	}
+}
+
+func TestWasmTargetProviderShim(t *testing.T) {
+	shim := &fakeShim{modules: map[string]moduleSpec{}}
+	shimServer := httptest.NewServer(shim)
+	defer shimServer.Close()
+	server := serveModules(t, map[string][]byte{"/detector.wasm": testModule})
+
+	provider := &WasmTargetProvider{}
+	err := provider.Init(WasmTargetProviderConfig{Runtime: runtimeShim, ShimAddress: shimServer.URL, ModuleFolder: t.TempDir()})
+	assert.Nil(t, err)
+	component := model.ComponentSpec{
+		Name: "detector",
+		Properties: map[string]interface{}{
+			wasmUrl:  server.URL + "/detector.wasm",
+			wasmEnv:  map[string]interface{}{"MODE": "edge"},
+			wasmFuel: "1000",
+		},
+	}
+	deployment := model.DeploymentSpec{Instance: model.InstanceState{Spec: &model.InstanceSpec{}}}
+	references := []model.ComponentStep{{Action: model.ComponentUpdate, Component: component}}
+	_, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, moduleSpec{
+		Name:   "detector",
+		Path:   filepath.Join(provider.Config.ModuleFolder, "detector", moduleFile),
+		Digest: digest(testModule),
+		Env:    map[string]string{"MODE": "edge"},
+		Fuel:   1000,
+	}, shim.modules["detector"])
+
+	components, err := provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, stateRunning, components[0].Properties[wasmState])
+	assert.False(t, provider.GetValidationRule(context.Background()).IsComponentChanged(components[0], component))
+
+	// a module the shim lost is reported as stopped
+	delete(shim.modules, "detector")
+	components, err = provider.Get(context.Background(), deployment, references)
+	assert.Nil(t, err)
+	assert.Equal(t, stateStopped, components[0].Properties[wasmState])
+
+	references[0].Action = model.ComponentDelete
+	_, err = provider.Apply(context.Background(), deployment, model.DeploymentStep{Components: references}, false)
+	assert.Nil(t, err)
+	assert.Empty(t, shim.modules)
+}
+
+func TestConformanceSuite(t *testing.T) {
+	provider := &WasmTargetProvider{}
+	err := provider.Init(WasmTargetProviderConfig{ModuleFolder: t.TempDir()})
+	assert.Nil(t, err)
+	conformance.ConformanceSuite(t, provider)
+}
@@ -39,6 +39,7 @@ type (
 		client        *http.Client
 		caCertPath    string
 		useSATokens   bool
+		siteIdentity  *SiteIdentity
 	}
 
 	ApiClientOption func(*apiClient)
@@ -88,6 +89,10 @@ type (
 		GetCatalogVersionsWithFilter(ctx context.Context, namespace string, filterType string, filterValue string, user string, password string) ([]model.CatalogVersionState, error)
 		UpdateSite(ctx context.Context, site string, payload []byte, user string, password string) error
 		GetABatchForSite(ctx context.Context, site string, user string, password string) (model.SyncPackage, error)
+		AckBatchForSite(ctx context.Context, site string, receipts []string, user string, password string) error
+		WaitForBatchForSite(ctx context.Context, site string, cursor string, wait time.Duration, user string, password string) (model.SyncPackage, error)
+		EnrollSite(ctx context.Context, request model.SiteEnrollmentRequest, user string, password string) (model.SiteEnrollment, error)
+		GetSiteEnrollment(ctx context.Context, site string, user string, password string) (model.SiteEnrollment, error)
 		SyncStageStatus(ctx context.Context, status model.StageStatus, user string, password string) error
 		SendVisualizationPacket(ctx context.Context, payload []byte, user string, password string) error
 		ReportCatalogVersions(ctx context.Context, instance string, components []model.ComponentSpec, user string, password string) error
@@ -148,6 +153,10 @@ func WithUserPassword(ctx context.Context) ApiClientOption {
 	return func(a *apiClient) {
 		a.useSATokens = false
 		a.tokenProvider = func(ctx context.Context, baseUrl string, _ *http.Client, user string, password string) (string, error) {
+			if user == "" && a.siteIdentity != nil && a.siteIdentity.Ready() {
+				// an enrolled site without credentials authenticates with its certificate only
+				return "", nil
+			}
 			request := AuthRequest{UserName: user, Password: password}
 			requestData, _ := json.Marshal(request)
 			ret, err := a.callRestAPI(ctx, "users/auth", "POST", requestData, "")
@@ -189,6 +198,17 @@ func WithCertAuth(caCertPath string) ApiClientOption {
 	}
 }
 
+// WithSiteIdentity authenticates requests with the key and certificate of a site, by
+// signing them and by presenting the certificate to TLS servers asking for one
+func WithSiteIdentity(identity *SiteIdentity) ApiClientOption {
+	return func(a *apiClient) {
+		a.siteIdentity = identity
+		if transport, ok := a.client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+			transport.TLSClientConfig.GetClientCertificate = identity.ClientCertificate
+		}
+	}
+}
+
 func NewApiClient(ctx context.Context, baseUrl string, opts ...ApiClientOption) (*apiClient, error) {
 	rUrl, err := url.Parse(baseUrl)
 	if err != nil {
@@ -883,7 +903,37 @@ func (a *apiClient) GetABatchForSite(ctx context.Context, site string, user stri
 		return ret, err
 	}
 
-	response, err := a.callRestAPI(ctx, "federation/sync/"+url.QueryEscape(site)+"?count=10", "GET", nil, token)
+	response, err := a.callRestAPI(ctx, "federation/sync/"+url.QueryEscape(site)+"?count=10&ack=true", "GET", nil, token)
+	if err != nil {
+		return ret, err
+	}
+
+	err = json.Unmarshal(response, &ret)
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// WaitForBatchForSite gets a batch of jobs for a site like GetABatchForSite, but when there
+// are no jobs the parent holds the request for up to wait until jobs are queued after the
+// given cursor. The returned package carries the cursor to pass on the next call.
+func (a *apiClient) WaitForBatchForSite(ctx context.Context, site string, cursor string, wait time.Duration, user string, password string) (model.SyncPackage, error) {
+	ret := model.SyncPackage{}
+	token, err := a.tokenProvider(ctx, a.baseUrl, a.client, user, password)
+
+	if err != nil {
+		return ret, err
+	}
+
+	query := url.Values{}
+	query.Set("count", "10")
+	query.Set("ack", "true")
+	query.Set("wait", wait.String())
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	response, err := a.callRestAPI(ctx, "federation/sync/"+url.QueryEscape(site)+"?"+query.Encode(), "GET", nil, token)
 	if err != nil {
 		return ret, err
 	}
@@ -895,6 +945,70 @@ func (a *apiClient) GetABatchForSite(ctx context.Context, site string, user stri
 	return ret, nil
 }
 
+// EnrollSite asks the parent site to issue a certificate for a site. The request doesn't need
+// credentials: a new enrollment waits for approval at the parent, and the renewal of an
+// enrolled site is authenticated with its current certificate.
+func (a *apiClient) EnrollSite(ctx context.Context, request model.SiteEnrollmentRequest, user string, password string) (model.SiteEnrollment, error) {
+	ret := model.SiteEnrollment{}
+	token := ""
+	var err error
+	if user != "" {
+		token, err = a.tokenProvider(ctx, a.baseUrl, a.client, user, password)
+		if err != nil {
+			return ret, err
+		}
+	}
+	jData, _ := json.Marshal(request)
+	response, err := a.callRestAPI(ctx, "federation/enroll", "POST", jData, token)
+	if err != nil {
+		return ret, err
+	}
+
+	err = json.Unmarshal(response, &ret)
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// GetSiteEnrollment gets the enrollment of a site from the parent site
+func (a *apiClient) GetSiteEnrollment(ctx context.Context, site string, user string, password string) (model.SiteEnrollment, error) {
+	ret := model.SiteEnrollment{}
+	token := ""
+	var err error
+	if user != "" {
+		token, err = a.tokenProvider(ctx, a.baseUrl, a.client, user, password)
+		if err != nil {
+			return ret, err
+		}
+	}
+	response, err := a.callRestAPI(ctx, "federation/enroll/"+url.QueryEscape(site), "GET", nil, token)
+	if err != nil {
+		return ret, err
+	}
+
+	err = json.Unmarshal(response, &ret)
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+func (a *apiClient) AckBatchForSite(ctx context.Context, site string, receipts []string, user string, password string) error {
+	token, err := a.tokenProvider(ctx, a.baseUrl, a.client, user, password)
+
+	if err != nil {
+		return err
+	}
+	jData, _ := json.Marshal(model.SyncAck{Receipts: receipts})
+	_, err = a.callRestAPI(ctx, "federation/ack/"+url.QueryEscape(site), "POST", jData, token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (a *apiClient) SyncStageStatus(ctx context.Context, status model.StageStatus, user string, password string) error {
 	token, err := a.tokenProvider(ctx, a.baseUrl, a.client, user, password)
 
@@ -958,6 +1072,12 @@ func (a *apiClient) callRestAPI(ctx context.Context, route string, method string
 	if token != "" {
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
+	if a.siteIdentity != nil {
+		err = a.siteIdentity.Sign(req, payload, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var resp *http.Response
 	var userError error
@@ -1003,7 +1123,7 @@ func (a *apiClient) callRestAPI(ctx context.Context, route string, method string
 			userError = NewAPIError(v1alpha2.GetHttpStatus(resp.StatusCode), fmt.Sprintf("Symphony API: %s", string(bodyBytes)))
 		}
 		return nil
-	}, b)
+	}, backoff.WithContext(b, ctx))
 
 	if retryErr == nil {
 		if userError != nil {
@@ -1202,11 +1322,16 @@ func newHttpClient(ctx context.Context, secure bool) (*http.Client, error) {
 	updateTransport := func(certBytes []byte) {
 		caCertPool := x509.NewCertPool()
 		caCertPool.AppendCertsFromPEM(certBytes)
+		tlsConfig := &tls.Config{
+			RootCAs:            caCertPool,
+			InsecureSkipVerify: false,
+		}
+		// keep presenting the client certificate after the cert pool is reloaded
+		if transport, ok := client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+			tlsConfig.GetClientCertificate = transport.TLSClientConfig.GetClientCertificate
+		}
 		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs:            caCertPool,
-				InsecureSkipVerify: false,
-			},
+			TLSClientConfig: tlsConfig,
 		}
 	}
 
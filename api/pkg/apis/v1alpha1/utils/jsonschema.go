@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// jsonSchemaURL is the location schemas are compiled at. Schemas can't load other resources, so
+// references resolve within the schema only.
+const jsonSchemaURL = "mem:///schema.json"
+
+var jsonSchemaPrinter = message.NewPrinter(language.English)
+
+// JSONSchemaError is a violation of a JSON Schema, located by the JSON pointer of the value
+type JSONSchemaError struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// ValidateJSONSchema validates a value against a JSON Schema (draft 2020-12 unless the schema
+// declares another draft), and asserts formats. References are resolved within the schema only.
+// Violations are sorted by their pointer and message.
+// It returns the violations found, or an error if the schema itself is invalid.
+func ValidateJSONSchema(schema interface{}, value interface{}) ([]JSONSchemaError, error) {
+	// values and schemas are compared in their JSON form
+	doc, err := toJSONValue(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	value, err = toJSONValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.AssertFormat()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{})
+	if err = compiler.AddResource(jsonSchemaURL, doc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	compiled, err := compiler.Compile(jsonSchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	err = compiled.Validate(value)
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	ret := make([]JSONSchemaError, 0)
+	if err = collectJSONSchemaErrors(validationErr, &ret); err != nil {
+		return nil, err
+	}
+	// the causes of a violation aren't in a stable order
+	sort.SliceStable(ret, func(a, b int) bool {
+		if ret[a].Pointer != ret[b].Pointer {
+			return ret[a].Pointer < ret[b].Pointer
+		}
+		return ret[a].Message < ret[b].Message
+	})
+	return ret, nil
+}
+
+// collectJSONSchemaErrors flattens the violations to the keywords that failed. The alternatives
+// of anyOf and oneOf are reported as one violation, as each of them failing isn't an error.
+// Reference cycles are errors of the schema.
+func collectJSONSchemaErrors(err *jsonschema.ValidationError, ret *[]JSONSchemaError) error {
+	switch err.ErrorKind.(type) {
+	case *kind.RefCycle:
+		return fmt.Errorf("invalid schema: %s", err.ErrorKind.LocalizedString(jsonSchemaPrinter))
+	case *kind.AnyOf, *kind.OneOf:
+	default:
+		if len(err.Causes) > 0 {
+			for _, cause := range err.Causes {
+				if cErr := collectJSONSchemaErrors(cause, ret); cErr != nil {
+					return cErr
+				}
+			}
+			return nil
+		}
+	}
+	*ret = append(*ret, JSONSchemaError{
+		Pointer: jsonPointerOf(err.InstanceLocation),
+		Message: jsonSchemaMessage(err.ErrorKind),
+	})
+	return nil
+}
+
+// jsonSchemaMessage describes a violation. Numeric limits are formatted without the digit
+// grouping of the printer, so a limit of 65535 doesn't read as 65,535.
+func jsonSchemaMessage(errKind jsonschema.ErrorKind) string {
+	switch k := errKind.(type) {
+	case *kind.Minimum:
+		return fmt.Sprintf("minimum: got %s, want %s", ratString(k.Got), ratString(k.Want))
+	case *kind.Maximum:
+		return fmt.Sprintf("maximum: got %s, want %s", ratString(k.Got), ratString(k.Want))
+	case *kind.ExclusiveMinimum:
+		return fmt.Sprintf("exclusiveMinimum: got %s, want %s", ratString(k.Got), ratString(k.Want))
+	case *kind.ExclusiveMaximum:
+		return fmt.Sprintf("exclusiveMaximum: got %s, want %s", ratString(k.Got), ratString(k.Want))
+	case *kind.MultipleOf:
+		return fmt.Sprintf("multipleOf: got %s, want %s", ratString(k.Got), ratString(k.Want))
+	}
+	return errKind.LocalizedString(jsonSchemaPrinter)
+}
+
+func ratString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	f, _ := r.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func toJSONValue(value interface{}) (interface{}, error) {
+	jData, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = json.Unmarshal(jData, &ret)
+	return ret, err
+}
+
+func jsonPointerOf(tokens []string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return sb.String()
+}
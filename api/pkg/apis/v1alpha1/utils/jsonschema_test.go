@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseJSON(t *testing.T, data string) interface{} {
+	var ret interface{}
+	err := json.Unmarshal([]byte(data), &ret)
+	assert.Nil(t, err)
+	return ret
+}
+
+func pointersOf(errs []JSONSchemaError) []string {
+	ret := make([]string, 0)
+	for _, e := range errs {
+		ret = append(ret, e.Pointer)
+	}
+	return ret
+}
+
+func TestJSONSchemaKeywords(t *testing.T) {
+	cases := []struct {
+		name     string
+		schema   string
+		value    string
+		pointers []string
+	}{
+		{"type", `{"type": "string"}`, `1`, []string{""}},
+		{"type list", `{"type": ["string", "null"]}`, `null`, []string{}},
+		{"integer", `{"type": "integer"}`, `1.5`, []string{""}},
+		{"integer float", `{"type": "integer"}`, `2.0`, []string{}},
+		{"enum", `{"enum": ["a", 1]}`, `1`, []string{}},
+		{"const", `{"const": {"a": 1}}`, `{"a": 2}`, []string{""}},
+		{"nested", `{"properties": {"a": {"properties": {"b": {"type": "number"}}}}}`, `{"a": {"b": "x"}}`, []string{"/a/b"}},
+		{"required", `{"required": ["a", "b"]}`, `{"a": 1}`, []string{""}},
+		{"additionalProperties", `{"properties": {"a": {}}, "patternProperties": {"^x-": {}}, "additionalProperties": false}`, `{"a": 1, "x-b": 2, "c": 3}`, []string{""}},
+		{"additionalProperties schema", `{"additionalProperties": {"type": "string"}}`, `{"a/b": 1}`, []string{"/a~1b"}},
+		{"propertyNames", `{"propertyNames": {"pattern": "^[a-z]+$"}}`, `{"A": 1}`, []string{""}},
+		{"min and max properties", `{"minProperties": 2, "maxProperties": 3}`, `{"a": 1}`, []string{""}},
+		{"items", `{"prefixItems": [{"type": "string"}], "items": {"type": "number"}}`, `["a", 1, "b"]`, []string{"/2"}},
+		{"no extra items", `{"prefixItems": [{}], "items": false}`, `[1, 2]`, []string{"/1"}},
+		{"min and max items", `{"minItems": 1, "maxItems": 2}`, `[]`, []string{""}},
+		{"uniqueItems", `{"uniqueItems": true}`, `[{"a": 1}, {"a": 1}]`, []string{""}},
+		{"contains", `{"contains": {"const": 3}, "maxContains": 1}`, `[3, 3]`, []string{""}},
+		{"range", `{"minimum": 1, "exclusiveMaximum": 10}`, `10`, []string{""}},
+		{"multipleOf", `{"multipleOf": 0.5}`, `2.5`, []string{}},
+		{"length", `{"minLength": 2, "maxLength": 3}`, `"äöüß"`, []string{""}},
+		{"pattern", `{"pattern": "^[a-z]+$"}`, `"abc1"`, []string{""}},
+		{"format", `{"properties": {"ip": {"format": "ipv4"}, "at": {"format": "date-time"}, "id": {"format": "uuid"}}}`,
+			`{"ip": "::1", "at": "2024-01-01T00:00:00Z", "id": "nope"}`, []string{"/id", "/ip"}},
+		{"allOf", `{"allOf": [{"type": "number"}, {"minimum": 5}]}`, `3`, []string{""}},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "boolean"}]}`, `1`, []string{""}},
+		{"oneOf", `{"oneOf": [{"type": "number"}, {"minimum": 0}]}`, `1`, []string{""}},
+		{"not", `{"not": {"type": "null"}}`, `null`, []string{""}},
+		{"if then else", `{"if": {"properties": {"kind": {"const": "tcp"}}}, "then": {"required": ["port"]}, "else": {"required": ["path"]}}`,
+			`{"kind": "tcp"}`, []string{""}},
+		{"dependentRequired", `{"dependentRequired": {"user": ["password"]}}`, `{"user": "a"}`, []string{""}},
+		{"dependentSchemas", `{"dependentSchemas": {"tls": {"required": ["cert"]}}}`, `{"tls": true}`, []string{""}},
+		{"ref", `{"$defs": {"port": {"type": "integer", "maximum": 65535}}, "properties": {"ports": {"items": {"$ref": "#/$defs/port"}}}}`,
+			`{"ports": [80, 70000]}`, []string{"/ports/1"}},
+		{"recursive ref", `{"properties": {"name": {"type": "string"}, "children": {"items": {"$ref": "#"}}}}`,
+			`{"name": "a", "children": [{"name": "b", "children": [{"name": 1}]}]}`, []string{"/children/0/children/0/name"}},
+		{"false schema", `{"properties": {"a": false}}`, `{"a": 1}`, []string{"/a"}},
+		{"unevaluatedProperties", `{"allOf": [{"properties": {"a": {}}}], "unevaluatedProperties": false}`, `{"a": 1, "b": 2}`, []string{"/b"}},
+		{"unevaluatedItems", `{"prefixItems": [{}], "unevaluatedItems": {"type": "string"}}`, `[1, 2]`, []string{"/1"}},
+		{"anchor", `{"$defs": {"port": {"$anchor": "port", "type": "integer"}}, "properties": {"port": {"$ref": "#port"}}}`,
+			`{"port": "80"}`, []string{"/port"}},
+		{"id", `{"$id": "https://example.com/root.json", "$defs": {"name": {"$id": "name.json", "type": "string"}}, "properties": {"name": {"$ref": "name.json"}}}`,
+			`{"name": 1}`, []string{"/name"}},
+		{"dynamicRef", `{"$dynamicAnchor": "node", "properties": {"children": {"items": {"$dynamicRef": "#node"}}, "name": {"type": "string"}}}`,
+			`{"children": [{"name": 1}]}`, []string{"/children/0/name"}},
+	}
+	for _, c := range cases {
+		errs, err := ValidateJSONSchema(parseJSON(t, c.schema), parseJSON(t, c.value))
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.pointers, pointersOf(errs), c.name)
+	}
+}
+
+func TestJSONSchemaGoValues(t *testing.T) {
+	// values built in Go are checked in their JSON form
+	schema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"count": map[string]interface{}{"type": "integer", "maximum": 3},
+			"tags":  map[string]interface{}{"items": map[string]interface{}{"type": "string"}},
+		},
+	}
+	errs, err := ValidateJSONSchema(schema, map[string]interface{}{
+		"count": 4,
+		"tags":  []string{"a", "b"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []JSONSchemaError{{Pointer: "/count", Message: "maximum: got 4, want 3"}}, errs)
+}
+
+func TestJSONSchemaInvalidSchema(t *testing.T) {
+	for _, schema := range []string{
+		`{"properties": {"a": {"pattern": "("}}}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "https://example.com/schema.json"}`,
+		`{"properties": {"a": 1}}`,
+		`{"$ref": "#"}`,
+	} {
+		_, err := ValidateJSONSchema(parseJSON(t, schema), parseJSON(t, `{"a": "b"}`))
+		assert.NotNil(t, err, schema)
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type":    "object",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, schema.Rules)
+	assert.Equal(t, "object", schema.JSONSchema["type"])
+
+	schema, err = ParseSchema(map[string]interface{}{
+		"rules": map[string]interface{}{
+			"email": map[string]interface{}{"pattern": "<email>"},
+		},
+		"jsonSchema": map[string]interface{}{"required": []string{"email"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "<email>", schema.Rules["email"].Pattern)
+	assert.NotNil(t, schema.JSONSchema)
+}
+
+func TestCheckPropertiesWithJSONSchema(t *testing.T) {
+	schema := Schema{
+		Rules: map[string]Rule{
+			"email": {Pattern: "<email>"},
+		},
+		JSONSchema: map[string]interface{}{
+			"required": []string{"name"},
+			"properties": map[string]interface{}{
+				"settings": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"retries": map[string]interface{}{"type": "integer", "minimum": 0},
+					},
+				},
+			},
+		},
+	}
+	result, err := schema.CheckProperties(ctx, map[string]interface{}{
+		"email":    "not an email",
+		"settings": map[string]interface{}{"retries": -1},
+	}, nil)
+	assert.Nil(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, 3, len(result.Errors))
+	assert.Equal(t, `missing property 'name'`, result.Errors[""].Error)
+	assert.Equal(t, "minimum: got -1, want 0", result.Errors["/settings/retries"].Error)
+	assert.Contains(t, result.Errors["email"].Error, "property does not match pattern")
+}
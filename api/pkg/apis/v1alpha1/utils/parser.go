@@ -52,6 +52,39 @@ const (
 	TILDE
 )
 
+const invalidFunctionName = "invalid function name"
+
+// functionNames are the functions FunctionNode.Eval understands. Analyze uses the same
+// table to report unknown functions before an expression is evaluated.
+var functionNames = map[string]bool{
+	"param":        true,
+	"property":     true,
+	"input":        true,
+	"output":       true,
+	"trigger":      true,
+	"equal":        true,
+	"and":          true,
+	"or":           true,
+	"not":          true,
+	"gt":           true,
+	"ge":           true,
+	"if":           true,
+	"in":           true,
+	"lt":           true,
+	"between":      true,
+	"le":           true,
+	"config":       true,
+	"secret":       true,
+	"instance":     true,
+	"val":          true,
+	"context":      true,
+	"base64decode": true,
+	"base64encode": true,
+	"jsonpath":     true,
+	"json":         true,
+	"str":          true,
+}
+
 var opNames = map[Token]string{
 	PLUS:       "+",
 	MINUS:      "-",
@@ -576,6 +609,9 @@ func formatFloats(left, right interface{}, operator string) interface{} {
 }
 
 func (n *FunctionNode) Eval(context utils.EvaluationContext) (interface{}, error) {
+	if !functionNames[n.Name] {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("%s: '%s'", invalidFunctionName, n.Name), v1alpha2.BadConfig)
+	}
 	switch n.Name {
 	case "param":
 		if len(n.Args) == 1 {
@@ -1034,7 +1070,7 @@ func (n *FunctionNode) Eval(context utils.EvaluationContext) (interface{}, error
 		}
 		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("$str() expects 1 argument, found %d", len(n.Args)), v1alpha2.BadConfig)
 	}
-	return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid function name: '%s'", n.Name), v1alpha2.BadConfig)
+	return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("function '%s' is not implemented", n.Name), v1alpha2.InternalError)
 }
 
 type Parser struct {
@@ -1084,6 +1120,129 @@ func (p *Parser) Eval(context utils.EvaluationContext) (interface{}, error) {
 	return ret, nil
 }
 
+// Analyze parses all expression segments without evaluating them. It returns
+// the literal values that appear in the text (plain segments, identifiers and
+// quoted strings inside expressions) and whether the text contains any
+// expression at all. Syntax errors and unknown function names are reported as
+// errors, so problems can be caught before the text is evaluated at runtime.
+func (p *Parser) Analyze() ([]string, bool, error) {
+	literals := make([]string, 0)
+	hasExpression := false
+	for _, s := range p.Segments {
+		if strings.HasPrefix(s, "${{") && strings.HasSuffix(s, "}}") {
+			hasExpression = true
+			parser := newExpressionParser(s[3 : len(s)-2])
+			for {
+				n, err := parser.expr(false)
+				if err != nil {
+					return nil, true, err
+				}
+				if _, ok := n.(*NullNode); ok {
+					break
+				}
+				if err := collectLiterals(n, &literals); err != nil {
+					return nil, true, err
+				}
+				parser.next()
+			}
+		} else if strings.HasPrefix(s, "${{") {
+			return nil, true, v1alpha2.NewCOAError(nil, fmt.Sprintf("unterminated expression: '%s'", s), v1alpha2.BadConfig)
+		} else if s != "" {
+			literals = append(literals, s)
+		}
+	}
+	return literals, hasExpression, nil
+}
+
+func collectLiterals(n Node, literals *[]string) error {
+	switch node := n.(type) {
+	case *IdentifierNode:
+		*literals = append(*literals, strings.Trim(removeQuotes(node.Value), "\""))
+	case *UnaryNode:
+		return collectLiterals(node.Expr, literals)
+	case *BinaryNode:
+		if err := collectLiterals(node.Left, literals); err != nil {
+			return err
+		}
+		return collectLiterals(node.Right, literals)
+	case *FunctionNode:
+		if !functionNames[node.Name] {
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("%s: '%s'", invalidFunctionName, node.Name), v1alpha2.BadConfig)
+		}
+		for _, arg := range node.Args {
+			if err := collectLiterals(arg, literals); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ConfigReferences returns the catalog versions the text reads with $config(), including
+// overlays. Only references made of literals are returned, as others are only known when the
+// text is evaluated.
+func (p *Parser) ConfigReferences() ([]string, error) {
+	refs := make([]string, 0)
+	for _, s := range p.Segments {
+		if !strings.HasPrefix(s, "${{") || !strings.HasSuffix(s, "}}") {
+			continue
+		}
+		parser := newExpressionParser(s[3 : len(s)-2])
+		for {
+			n, err := parser.expr(false)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := n.(*NullNode); ok {
+				break
+			}
+			collectConfigReferences(n, &refs)
+			parser.next()
+		}
+	}
+	return refs, nil
+}
+
+func collectConfigReferences(n Node, refs *[]string) {
+	switch node := n.(type) {
+	case *UnaryNode:
+		collectConfigReferences(node.Expr, refs)
+	case *BinaryNode:
+		collectConfigReferences(node.Left, refs)
+		collectConfigReferences(node.Right, refs)
+	case *FunctionNode:
+		if node.Name == "config" && len(node.Args) >= 2 {
+			for i, arg := range node.Args {
+				// the second argument is the field
+				if i == 1 {
+					continue
+				}
+				if isLiteral(arg) {
+					if v, err := arg.Eval(utils.EvaluationContext{}); err == nil {
+						*refs = append(*refs, FormatAsString(v))
+					}
+				}
+			}
+		}
+		for _, arg := range node.Args {
+			collectConfigReferences(arg, refs)
+		}
+	}
+}
+
+// isLiteral checks if an expression is made of literals only, such as name:version
+func isLiteral(n Node) bool {
+	switch node := n.(type) {
+	case *IdentifierNode, *NumberNode, *IntNode:
+		return true
+	case *UnaryNode:
+		return isLiteral(node.Expr)
+	case *BinaryNode:
+		return (node.Left == nil || isLiteral(node.Left)) && (node.Right == nil || isLiteral(node.Right))
+	}
+	return false
+}
+
 func newExpressionParser(text string) *ExpressionParser {
 	text = strings.TrimSpace(text)
 	//text = normalizeSingleQuotedStrings(text) // <-- ADD THIS
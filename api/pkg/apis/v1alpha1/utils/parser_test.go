@@ -3207,3 +3207,74 @@ func TestCircularErrorIsBadConfig(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, v1alpha2.BadConfig, cErr.State)
 }
+
+func TestAnalyzeLiteral(t *testing.T) {
+	literals, hasExpression, err := NewParser("stage2").Analyze()
+	assert.Nil(t, err)
+	assert.False(t, hasExpression)
+	assert.Equal(t, []string{"stage2"}, literals)
+}
+
+func TestAnalyzeExpression(t *testing.T) {
+	literals, hasExpression, err := NewParser("${{$if($equal($output(stage1,status),200),stage2,'stage3')}}").Analyze()
+	assert.Nil(t, err)
+	assert.True(t, hasExpression)
+	assert.Contains(t, literals, "stage1")
+	assert.Contains(t, literals, "stage2")
+	assert.Contains(t, literals, "stage3")
+}
+
+func TestAnalyzeUnknownFunction(t *testing.T) {
+	_, _, err := NewParser("${{$foo(stage1)}}").Analyze()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid function name")
+}
+
+func TestAnalyzeUnbalancedParentheses(t *testing.T) {
+	_, _, err := NewParser("${{$output(stage1,status}}").Analyze()
+	assert.NotNil(t, err)
+}
+
+func TestAnalyzeUnterminatedExpression(t *testing.T) {
+	_, hasExpression, err := NewParser("${{$output(stage1,status)").Analyze()
+	assert.NotNil(t, err)
+	assert.True(t, hasExpression)
+}
+
+func TestConfigReferences(t *testing.T) {
+	refs, err := NewParser("${{$config('app-config:v1', 'db')}}:${{$config(base:v2, port, 'site:v1')}}").ConfigReferences()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app-config:v1", "base:v2", "site:v1"}, refs)
+
+	refs, err = NewParser("${{$if($equal($config('flags:v1', 'x'), 1), 'a', 'b')}}").ConfigReferences()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"flags:v1"}, refs)
+
+	// references that are evaluated are not known
+	refs, err = NewParser("${{$config($input(catalog), 'db')}}").ConfigReferences()
+	assert.Nil(t, err)
+	assert.Empty(t, refs)
+
+	_, err = NewParser("${{$config('a:v1', 'db'}}").ConfigReferences()
+	assert.NotNil(t, err)
+}
+
+func TestFunctionNames(t *testing.T) {
+	for _, name := range []string{"param", "property", "input", "output", "trigger", "equal", "and", "or", "not",
+		"gt", "ge", "if", "in", "lt", "between", "le", "config", "secret", "instance", "val", "context",
+		"base64decode", "base64encode", "jsonpath", "json", "str"} {
+		assert.True(t, functionNames[name], name)
+	}
+	assert.False(t, functionNames["foo"])
+
+	// every function in the table is implemented by FunctionNode.Eval
+	for name := range functionNames {
+		_, err := (&FunctionNode{Name: name}).Eval(utils.EvaluationContext{})
+		if err != nil {
+			assert.NotContains(t, err.Error(), "is not implemented", name)
+		}
+	}
+	_, err := (&FunctionNode{Name: "foo"}).Eval(utils.EvaluationContext{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), invalidFunctionName)
+}
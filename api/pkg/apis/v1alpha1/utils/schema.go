@@ -8,8 +8,10 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -24,6 +26,30 @@ type Rule struct {
 }
 type Schema struct {
 	Rules map[string]Rule `json:"rules,omitempty"`
+	// JSONSchema is a JSON Schema (draft 2020-12) the properties are validated against, in
+	// addition to the rules
+	JSONSchema map[string]interface{} `json:"jsonSchema,omitempty"`
+}
+
+// ParseSchema reads the spec of a schema catalog. The spec has legacy rules and an optional
+// jsonSchema, or is a JSON Schema itself when it declares a $schema.
+func ParseSchema(spec interface{}) (Schema, error) {
+	var ret Schema
+	jData, err := json.Marshal(spec)
+	if err != nil {
+		return ret, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(jData, &fields)
+	if err != nil {
+		return ret, err
+	}
+	if _, ok := fields["$schema"]; ok {
+		ret.JSONSchema = fields
+		return ret, nil
+	}
+	err = json.Unmarshal(jData, &ret)
+	return ret, err
 }
 
 type RuleResult struct {
@@ -40,9 +66,14 @@ func (s *SchemaResult) ToErrorMessages() string {
 	if s.Valid {
 		return ""
 	}
+	keys := make([]string, 0, len(s.Errors))
+	for k := range s.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 	errorMessages := make([]string, 0)
-	for k, v := range s.Errors {
-		errorMessages = append(errorMessages, fmt.Sprintf("%s: %s\n", k, v.Error))
+	for _, k := range keys {
+		errorMessages = append(errorMessages, fmt.Sprintf("%s: %s\n", k, s.Errors[k].Error))
 	}
 	return strings.Join(errorMessages, ";")
 }
@@ -124,6 +155,20 @@ func (s *Schema) CheckProperties(ctx context.Context, properties map[string]inte
 			}
 		}
 	}
+	if s.JSONSchema != nil {
+		// JSON Schema errors are keyed by the JSON pointer of the offending value
+		errs, err := ValidateJSONSchema(s.JSONSchema, properties)
+		if err != nil {
+			return ret, err
+		}
+		for _, e := range errs {
+			ret.Valid = false
+			if existing, ok := ret.Errors[e.Pointer]; ok {
+				e.Message = existing.Error + "; " + e.Message
+			}
+			ret.Errors[e.Pointer] = RuleResult{Valid: false, Error: e.Message}
+		}
+	}
 	return ret, nil
 }
 func (s *Schema) matchPattern(value string, pattern string) (bool, error) {
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
+)
+
+// SiteIdentity is the key and certificate a site authenticates to its parent site with.
+// Requests are signed with the key, and the certificate is presented to the parent when
+// the connection uses TLS. An identity without a certificate doesn't authenticate.
+type SiteIdentity struct {
+	lock    sync.RWMutex
+	site    string
+	key     crypto.Signer
+	cert    *x509.Certificate
+	tlsCert *tls.Certificate
+}
+
+var parentSiteIdentity = &SiteIdentity{}
+
+// ParentSiteIdentity returns the identity clients of the parent site's API authenticate with
+func ParentSiteIdentity() *SiteIdentity {
+	return parentSiteIdentity
+}
+
+// Load replaces the key and certificate of the identity, after checking they belong together
+func (i *SiteIdentity) Load(site string, keyPEM []byte, certPEM []byte) error {
+	key, err := ca.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to parse site key", v1alpha2.BadConfig)
+	}
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "site certificate doesn't match the site key", v1alpha2.BadConfig)
+	}
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to parse site certificate", v1alpha2.BadConfig)
+	}
+	if cert.Subject.CommonName != site {
+		return v1alpha2.NewCOAError(nil, "site certificate is issued to "+cert.Subject.CommonName+", not "+site, v1alpha2.BadConfig)
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.site = site
+	i.key = key
+	i.cert = cert
+	i.tlsCert = &tlsCert
+	return nil
+}
+
+// Certificate returns the certificate of the identity, or nil if the site isn't enrolled
+func (i *SiteIdentity) Certificate() *x509.Certificate {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return i.cert
+}
+
+// Ready reports whether the identity can authenticate requests
+func (i *SiteIdentity) Ready() bool {
+	return i.Certificate() != nil
+}
+
+// Sign adds the site authentication headers to a request. The signature covers the method,
+// the path, the query, the time, a random nonce and the body of the request, so the parent
+// can reject requests that are replayed or altered.
+func (i *SiteIdentity) Sign(req *http.Request, body []byte, now time.Time) error {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	if i.cert == nil {
+		return nil
+	}
+	timestamp := now.UTC().Format(time.RFC3339)
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return v1alpha2.NewCOAError(err, "failed to generate request nonce", v1alpha2.InternalError)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	digest := sha256.Sum256(SiteSigningPayload(req.Method, req.URL.Path, req.URL.RawQuery, timestamp, nonce, body))
+	signature, err := i.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to sign request", v1alpha2.InternalError)
+	}
+	req.Header.Set(v1alpha2.SiteIdHeader, i.site)
+	req.Header.Set(v1alpha2.SiteTimestampHeader, timestamp)
+	req.Header.Set(v1alpha2.SiteNonceHeader, nonce)
+	req.Header.Set(v1alpha2.SiteSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// ClientCertificate presents the site certificate to TLS servers asking for one
+func (i *SiteIdentity) ClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	if i.tlsCert == nil {
+		// no certificate, the server decides whether to accept the connection
+		return &tls.Certificate{}, nil
+	}
+	return i.tlsCert, nil
+}
+
+// GenerateSiteKey generates a PEM encoded key for a site
+func GenerateSiteKey() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// CreateSiteCSR creates a PEM encoded certificate signing request for a site's key
+func CreateSiteCSR(site string, keyPEM []byte) ([]byte, error) {
+	key, err := ca.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: site},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// SiteSigningPayload returns the data a site signs for a request. The raw query is canonicalized,
+// so the signer and the verifier agree on it regardless of how each side encodes it.
+func SiteSigningPayload(method string, path string, query string, timestamp string, nonce string, body []byte) []byte {
+	bodyDigest := sha256.Sum256(body)
+	return []byte(method + "\n" + path + "\n" + canonicalQuery(query) + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyDigest[:]))
+}
+
+// canonicalQuery encodes the parameters of a raw query sorted by key. A query that doesn't
+// parse is kept as it is.
+func canonicalQuery(query string) string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	return values.Encode()
+}
+
+// VerifySiteSignature checks a request signature against the public key of a site certificate
+func VerifySiteSignature(cert *x509.Certificate, method string, path string, query string, timestamp string, nonce string, body []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "site signature is not base64 encoded", v1alpha2.Unauthorized)
+	}
+	digest := sha256.Sum256(SiteSigningPayload(method, path, query, timestamp, nonce, body))
+	valid := false
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !valid {
+		return v1alpha2.NewCOAError(nil, "site signature is invalid", v1alpha2.Unauthorized)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package utils
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
+	"github.com/stretchr/testify/assert"
+)
+
+func issueSiteCert(t *testing.T, site string) ([]byte, []byte) {
+	issuer := &ca.CACertProvider{}
+	err := issuer.Init(ca.CACertProviderConfig{Name: "ca"})
+	assert.Nil(t, err)
+	keyPEM, err := GenerateSiteKey()
+	assert.Nil(t, err)
+	csr, err := CreateSiteCSR(site, keyPEM)
+	assert.Nil(t, err)
+	certPEM, err := issuer.IssueCert(csr, time.Hour)
+	assert.Nil(t, err)
+	return keyPEM, certPEM
+}
+
+func TestSiteIdentitySign(t *testing.T) {
+	identity := &SiteIdentity{}
+	req, _ := http.NewRequest(http.MethodPost, "http://parent/v1alpha2/federation/sync?site=site1&count=10", nil)
+	// an identity without a certificate leaves requests alone
+	err := identity.Sign(req, []byte("body"), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "", req.Header.Get(v1alpha2.SiteSignatureHeader))
+	assert.False(t, identity.Ready())
+
+	keyPEM, certPEM := issueSiteCert(t, "site1")
+	err = identity.Load("site1", keyPEM, certPEM)
+	assert.Nil(t, err)
+	assert.True(t, identity.Ready())
+
+	err = identity.Sign(req, []byte("body"), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "site1", req.Header.Get(v1alpha2.SiteIdHeader))
+	timestamp := req.Header.Get(v1alpha2.SiteTimestampHeader)
+	nonce := req.Header.Get(v1alpha2.SiteNonceHeader)
+	assert.Equal(t, 32, len(nonce))
+	signature := req.Header.Get(v1alpha2.SiteSignatureHeader)
+
+	cert := identity.Certificate()
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "site=site1&count=10", timestamp, nonce, []byte("body"), signature)
+	assert.Nil(t, err)
+	// the query is signed, but the order and encoding of its parameters don't matter
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "count=10&site=%73ite1", timestamp, nonce, []byte("body"), signature)
+	assert.Nil(t, err)
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "site=site2&count=10", timestamp, nonce, []byte("body"), signature)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "", timestamp, nonce, []byte("body"), signature)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/ack", "site=site1&count=10", timestamp, nonce, []byte("body"), signature)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "site=site1&count=10", timestamp, "0000", []byte("body"), signature)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "site=site1&count=10", timestamp, nonce, []byte("other"), signature)
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+	err = VerifySiteSignature(cert, http.MethodPost, "/v1alpha2/federation/sync", "site=site1&count=10", timestamp, nonce, []byte("body"), "not base64!")
+	assert.Equal(t, v1alpha2.Unauthorized, err.(v1alpha2.COAError).State)
+
+	tlsCert, err := identity.ClientCertificate(&tls.CertificateRequestInfo{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tlsCert.Certificate))
+}
+
+func TestSiteIdentityLoadMismatch(t *testing.T) {
+	identity := &SiteIdentity{}
+	keyPEM, certPEM := issueSiteCert(t, "site1")
+	err := identity.Load("site2", keyPEM, certPEM)
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+
+	otherKeyPEM, err := GenerateSiteKey()
+	assert.Nil(t, err)
+	err = identity.Load("site1", otherKeyPEM, certPEM)
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+	assert.False(t, identity.Ready())
+}
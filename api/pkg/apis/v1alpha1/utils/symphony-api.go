@@ -92,7 +92,7 @@ func GetParentApiClient(baseUrl string) (*apiClient, error) {
 	}
 
 	log.Infof("Configuring parent API client with user/password token provider for baseUrl: %s", baseUrl)
-	clientOptions = append(clientOptions, WithUserPassword(context.TODO()))
+	clientOptions = append(clientOptions, WithUserPassword(context.TODO()), WithSiteIdentity(ParentSiteIdentity()))
 	client, err := NewApiClient(context.Background(), baseUrl, clientOptions...)
 	if err != nil {
 		return nil, err
@@ -17,6 +17,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eclipse-symphony/symphony/api/constants"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
@@ -151,6 +152,18 @@ func MergeCollection(cols ...map[string]string) map[string]string {
 	return ret
 }
 
+// SleepWithContext waits for the duration, or returns the error of the context when it's done first
+func SleepWithContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func MergeCollection_StringAny(cols ...map[string]interface{}) map[string]interface{} {
 	ret := make(map[string]interface{})
 	for _, col := range cols {
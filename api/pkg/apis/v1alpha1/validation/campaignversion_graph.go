@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	api_utils "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+)
+
+// ProviderLookupFunc reports whether a stage provider type is known
+type ProviderLookupFunc func(providerType string) bool
+
+// stageNode is a stage in the static stage graph. Edges point to the stages the
+// stageSelector may select; canExit is false only when the selector can never
+// evaluate to an empty stage (i.e. it's a plain reference to another stage).
+type stageNode struct {
+	edges   []string
+	canExit bool
+}
+
+// ValidateStageGraph performs static analysis of a campaign version:
+// 1. All expressions (stageSelector, contexts, inputs and configs) parse
+// 2. Providers of stages and tasks are known
+// 3. stageSelectors don't reference missing stages (dead ends)
+// 4. All stages are reachable from firstStage
+// 5. There are no cycles that can never exit
+// 6. Timeouts are valid durations and compensation stages exist
+func (c *CampaignVersionValidator) ValidateStageGraph(campaignversion model.CampaignVersionState, providerLookup ProviderLookupFunc) []model.CampaignValidationIssue {
+	issues := make([]model.CampaignValidationIssue, 0)
+	spec := campaignversion.Spec
+	if spec == nil {
+		return issues
+	}
+	if field := c.ValidateFirstStage(campaignversion); field != nil {
+		issues = append(issues, model.CampaignValidationIssue{
+			Severity:  model.ValidationSeverity_Error,
+			FieldPath: field.FieldPath,
+			Value:     field.Value,
+			Message:   field.DetailedMessage,
+		})
+	}
+
+	names := make([]string, 0, len(spec.Stages))
+	for name := range spec.Stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	graph := make(map[string]stageNode, len(spec.Stages))
+	for _, name := range names {
+		stage := spec.Stages[name]
+		prefix := fmt.Sprintf("spec.stages.%s", name)
+
+		if stage.Provider != "" && providerLookup != nil && !providerLookup(stage.Provider) {
+			issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, prefix+".provider", stage.Provider, fmt.Sprintf("unknown stage provider '%s'", stage.Provider)))
+		}
+		if stage.Provider == "" && len(stage.Tasks) == 0 {
+			issues = append(issues, newStageIssue(model.ValidationSeverity_Warning, name, prefix+".provider", "", "stage has neither a provider nor tasks"))
+		}
+		for i, task := range stage.Tasks {
+			if task.Provider == "" || (providerLookup != nil && !providerLookup(task.Provider)) {
+				issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, fmt.Sprintf("%s.tasks[%d].provider", prefix, i), task.Provider, fmt.Sprintf("unknown task provider '%s'", task.Provider)))
+			}
+			issues = append(issues, validateExpressions(name, fmt.Sprintf("%s.tasks[%d].inputs", prefix, i), task.Inputs)...)
+			issues = append(issues, validateExpressions(name, fmt.Sprintf("%s.tasks[%d].config", prefix, i), task.Config)...)
+		}
+		for i, task := range stage.Tasks {
+			if task.Timeout != "" {
+				if _, err := time.ParseDuration(task.Timeout); err != nil {
+					issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, fmt.Sprintf("%s.tasks[%d].timeout", prefix, i), task.Timeout, fmt.Sprintf("invalid timeout: %s", err.Error())))
+				}
+			}
+		}
+		if stage.Timeout != "" {
+			if _, err := time.ParseDuration(stage.Timeout); err != nil {
+				issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, prefix+".timeout", stage.Timeout, fmt.Sprintf("invalid timeout: %s", err.Error())))
+			}
+		}
+		if stage.Compensation != "" {
+			if _, ok := spec.Stages[stage.Compensation]; !ok {
+				issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, prefix+".compensation", stage.Compensation, fmt.Sprintf("compensation stage '%s' does not exist", stage.Compensation)))
+			}
+		}
+		issues = append(issues, validateExpressions(name, prefix+".contexts", stage.Contexts)...)
+		issues = append(issues, validateExpressions(name, prefix+".inputs", stage.Inputs)...)
+		issues = append(issues, validateExpressions(name, prefix+".config", stage.Config)...)
+
+		node := stageNode{canExit: true}
+		if stage.StageSelector != "" {
+			literals, hasExpression, err := api_utils.NewParser(stage.StageSelector).Analyze()
+			if err != nil {
+				issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, prefix+".stageSelector", stage.StageSelector, fmt.Sprintf("invalid expression: %s", err.Error())))
+			} else if !hasExpression {
+				if _, ok := spec.Stages[stage.StageSelector]; ok {
+					node.edges = append(node.edges, stage.StageSelector)
+					node.canExit = false
+				} else {
+					issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, prefix+".stageSelector", stage.StageSelector, fmt.Sprintf("dead end: stage '%s' does not exist", stage.StageSelector)))
+				}
+			} else {
+				for _, literal := range literals {
+					if _, ok := spec.Stages[literal]; ok {
+						node.edges = append(node.edges, literal)
+					}
+				}
+			}
+		}
+		graph[name] = node
+	}
+
+	if _, ok := graph[spec.FirstStage]; ok {
+		reachable := walkStageGraph(graph, spec.FirstStage)
+		// compensation stages are reachable through the stages they compensate
+		for _, name := range names {
+			if _, ok := reachable[name]; !ok {
+				continue
+			}
+			if compensation := spec.Stages[name].Compensation; compensation != "" {
+				if _, ok := graph[compensation]; ok {
+					for visited := range walkStageGraph(graph, compensation) {
+						reachable[visited] = struct{}{}
+					}
+				}
+			}
+		}
+		for _, name := range names {
+			if _, ok := reachable[name]; !ok {
+				issues = append(issues, newStageIssue(model.ValidationSeverity_Warning, name, fmt.Sprintf("spec.stages.%s", name), name, fmt.Sprintf("stage is unreachable from firstStage '%s'", spec.FirstStage)))
+			}
+		}
+	}
+
+	for _, name := range names {
+		canExit := false
+		for visited := range walkStageGraph(graph, name) {
+			if graph[visited].canExit {
+				canExit = true
+				break
+			}
+		}
+		if !canExit {
+			issues = append(issues, newStageIssue(model.ValidationSeverity_Error, name, fmt.Sprintf("spec.stages.%s.stageSelector", name), spec.Stages[name].StageSelector, "stage leads into a cycle without an exit"))
+		}
+	}
+	return issues
+}
+
+func walkStageGraph(graph map[string]stageNode, start string) map[string]struct{} {
+	visited := map[string]struct{}{start: {}}
+	queue := []string{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range graph[current].edges {
+			if _, ok := visited[next]; !ok {
+				visited[next] = struct{}{}
+				queue = append(queue, next)
+			}
+		}
+	}
+	return visited
+}
+
+func validateExpressions(stage string, path string, value interface{}) []model.CampaignValidationIssue {
+	issues := make([]model.CampaignValidationIssue, 0)
+	switch v := value.(type) {
+	case string:
+		if _, _, err := api_utils.NewParser(v).Analyze(); err != nil {
+			issues = append(issues, newStageIssue(model.ValidationSeverity_Error, stage, path, v, fmt.Sprintf("invalid expression: %s", err.Error())))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			issues = append(issues, validateExpressions(stage, fmt.Sprintf("%s.%s", path, k), v[k])...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			issues = append(issues, validateExpressions(stage, fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+	}
+	return issues
+}
+
+func newStageIssue(severity model.ValidationSeverity, stage string, path string, value interface{}, message string) model.CampaignValidationIssue {
+	return model.CampaignValidationIssue{
+		Severity:  severity,
+		Stage:     stage,
+		FieldPath: path,
+		Value:     value,
+		Message:   message,
+	}
+}
@@ -117,9 +117,7 @@ func (c *CatalogVersionValidator) ValidateSchema(ctx context.Context, new model.
 		}
 		if spec, ok := catalogversion.Spec.Properties["spec"]; ok {
 			// 2). Extract Schema object from the catalogversion object
-			var schemaObj utils.Schema
-			jData, _ := json.Marshal(spec)
-			err := json.Unmarshal(jData, &schemaObj)
+			schemaObj, err := utils.ParseSchema(spec)
 			if err != nil {
 				return &ErrorField{
 					FieldPath:       "spec.metadata.schema",
@@ -0,0 +1,405 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	api_utils "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+var log = logger.NewLogger("coa.runtime")
+
+// ImpactCheckProperty is the manager property of the impact check policy for deletions
+const ImpactCheckProperty = "impact.check"
+
+// ObjectListFunc lists the objects of a resource type in a namespace
+type ObjectListFunc func(ctx context.Context, resourceType ResourceType, namespace string) ([]interface{}, error)
+
+// graphResourceTypes are the resource types in a dependency graph
+var graphResourceTypes = []ResourceType{Catalog, CatalogVersion, Solution, SolutionVersion, Target, Instance, Campaign, CampaignVersion, Activation}
+
+// DependencyGraph is the dependencies of the Symphony objects of a namespace
+type DependencyGraph struct {
+	Namespace    string
+	Dependencies []model.Dependency
+	// dependents are the dependencies on each object
+	dependents map[model.ObjectKey][]model.Dependency
+	// requires are the dependencies of each object
+	requires map[model.ObjectKey][]model.Dependency
+	objects  map[model.ObjectKey]bool
+}
+
+type graphObject struct {
+	ObjectMeta model.ObjectMeta       `json:"metadata"`
+	Kind       string                 `json:"kind,omitempty"`
+	Spec       map[string]interface{} `json:"spec,omitempty"`
+}
+
+// BuildDependencyGraph reads the objects of a namespace and links them by their references:
+// versions to their root resources, catalog versions to their parents, instances to their
+// solution versions and targets, activations to their campaign versions, and all of them to the
+// catalog versions they read with $config().
+func BuildDependencyGraph(ctx context.Context, listFunc ObjectListFunc, namespace string) (*DependencyGraph, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+	g := &DependencyGraph{
+		Namespace:    namespace,
+		Dependencies: make([]model.Dependency, 0),
+		dependents:   make(map[model.ObjectKey][]model.Dependency),
+		requires:     make(map[model.ObjectKey][]model.Dependency),
+		objects:      make(map[model.ObjectKey]bool),
+	}
+	objects := make(map[ResourceType][]graphObject)
+	targets := make([]model.TargetState, 0)
+	for _, resourceType := range graphResourceTypes {
+		list, err := listFunc(ctx, resourceType, namespace)
+		if err != nil {
+			if api_utils.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		_, _, _, kind := GetResourceMetadata(resourceType)
+		for _, item := range list {
+			jData, _ := json.Marshal(item)
+			var object graphObject
+			if err = json.Unmarshal(jData, &object); err != nil {
+				return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read %s objects", resourceType), v1alpha2.InternalError)
+			}
+			// not all state providers keep resource types apart
+			if object.Kind != "" && object.Kind != kind || object.ObjectMeta.Name == "" {
+				continue
+			}
+			objects[resourceType] = append(objects[resourceType], object)
+			g.objects[g.key(resourceType, object.ObjectMeta.Name)] = true
+			if resourceType == Target {
+				var target model.TargetState
+				if json.Unmarshal(jData, &target) == nil && target.Spec != nil {
+					targets = append(targets, target)
+				}
+			}
+		}
+	}
+
+	containers := map[ResourceType]ResourceType{
+		CatalogVersion:  Catalog,
+		SolutionVersion: Solution,
+		CampaignVersion: Campaign,
+	}
+	for _, resourceType := range graphResourceTypes {
+		for _, object := range objects[resourceType] {
+			from := g.key(resourceType, object.ObjectMeta.Name)
+			spec := object.Spec
+			if container, ok := containers[resourceType]; ok {
+				if root := specString(spec, "rootResource"); root != "" {
+					g.link(from, g.key(container, root), model.RelationContainer)
+				}
+			}
+			switch resourceType {
+			case CatalogVersion:
+				if parent := specString(spec, "parentName"); parent != "" {
+					g.link(from, g.key(CatalogVersion, ConvertReferenceToObjectName(parent)), model.RelationParent)
+				}
+			case Instance:
+				if solution := specString(spec, "solutionversion"); solution != "" {
+					g.link(from, g.key(SolutionVersion, ConvertReferenceToObjectName(solution)), model.RelationSolutionVersion)
+				}
+				jData, _ := json.Marshal(object)
+				var instance model.InstanceState
+				if json.Unmarshal(jData, &instance) == nil && instance.Spec != nil {
+					for _, target := range api_utils.MatchTargets(instance, targets) {
+						g.link(from, g.key(Target, target.ObjectMeta.Name), model.RelationTarget)
+					}
+				}
+			case Activation:
+				if campaign := specString(spec, "campaignversion"); campaign != "" {
+					g.link(from, g.key(CampaignVersion, ConvertReferenceToObjectName(campaign)), model.RelationCampaignVersion)
+				}
+			}
+			for _, ref := range configReferences(spec) {
+				g.link(from, g.key(CatalogVersion, ConvertReferenceToObjectName(ref)), model.RelationConfig)
+			}
+		}
+	}
+	return g, nil
+}
+
+func (g *DependencyGraph) key(resourceType ResourceType, name string) model.ObjectKey {
+	return model.ObjectKey{Kind: string(resourceType), Name: name, Namespace: g.Namespace}
+}
+
+func (g *DependencyGraph) link(from model.ObjectKey, to model.ObjectKey, relation string) {
+	if from == to {
+		return
+	}
+	for _, d := range g.requires[from] {
+		if d.To == to && d.Relation == relation {
+			return
+		}
+	}
+	d := model.Dependency{From: from, To: to, Relation: relation}
+	g.Dependencies = append(g.Dependencies, d)
+	g.dependents[to] = append(g.dependents[to], d)
+	g.requires[from] = append(g.requires[from], d)
+}
+
+// Exists checks if an object is in the graph
+func (g *DependencyGraph) Exists(key model.ObjectKey) bool {
+	return g.objects[key]
+}
+
+// DependenciesOf returns the objects an object depends on directly. References to missing
+// objects are included.
+func (g *DependencyGraph) DependenciesOf(key model.ObjectKey) []model.Dependency {
+	ret := make([]model.Dependency, len(g.requires[key]))
+	copy(ret, g.requires[key])
+	sortDependencies(ret, func(d model.Dependency) model.ObjectKey { return d.To })
+	return ret
+}
+
+// Impact returns the objects that depend on an object directly or through other objects
+func (g *DependencyGraph) Impact(key model.ObjectKey) model.ImpactReport {
+	ret := model.ImpactReport{Object: key, Affected: make([]model.ImpactedObject, 0)}
+	visited := map[model.ObjectKey]bool{key: true}
+	current := []model.ObjectKey{key}
+	for depth := 1; len(current) > 0; depth++ {
+		level := make([]model.ImpactedObject, 0)
+		for _, object := range current {
+			dependents := make([]model.Dependency, len(g.dependents[object]))
+			copy(dependents, g.dependents[object])
+			sortDependencies(dependents, func(d model.Dependency) model.ObjectKey { return d.From })
+			for _, d := range dependents {
+				if visited[d.From] {
+					continue
+				}
+				visited[d.From] = true
+				level = append(level, model.ImpactedObject{ObjectKey: d.From, Relation: d.Relation, Via: d.To, Depth: depth})
+			}
+		}
+		sort.SliceStable(level, func(i, j int) bool {
+			return compareKeys(level[i].ObjectKey, level[j].ObjectKey) < 0
+		})
+		current = make([]model.ObjectKey, 0, len(level))
+		for _, affected := range level {
+			current = append(current, affected.ObjectKey)
+		}
+		ret.Affected = append(ret.Affected, level...)
+	}
+	return ret
+}
+
+// ImpactChecker applies the impact check policy of a manager to changes of its objects. With the
+// block policy, changes that would break the dependencies of other objects are refused; with the
+// warn policy, the affected objects are logged.
+type ImpactChecker struct {
+	Policy       string
+	ResourceType ResourceType
+	ListFunc     ObjectListFunc
+}
+
+// NewImpactChecker reads the impact check policy from the properties of a manager. The objects
+// are listed with listFunc, which must see the objects of all managers for dependents to be found.
+func NewImpactChecker(properties map[string]string, resourceType ResourceType, listFunc ObjectListFunc) (*ImpactChecker, error) {
+	policy := properties[ImpactCheckProperty]
+	if err := ValidateImpactCheck(policy); err != nil {
+		return nil, err
+	}
+	return &ImpactChecker{Policy: policy, ResourceType: resourceType, ListFunc: listFunc}, nil
+}
+
+// CheckDelete applies the policy to the deletion of an object, which breaks all objects that
+// depend on it
+func (c *ImpactChecker) CheckDelete(ctx context.Context, name string, namespace string) error {
+	return c.check(ctx, name, namespace, nil)
+}
+
+// CheckUpdate applies the policy to the update of an object. Only the objects that stop depending
+// on the object are affected, such as the instances whose target selector no longer matches an
+// updated target.
+func (c *ImpactChecker) CheckUpdate(ctx context.Context, name string, namespace string, object interface{}) error {
+	if object == nil {
+		return nil
+	}
+	return c.check(ctx, name, namespace, object)
+}
+
+func (c *ImpactChecker) check(ctx context.Context, name string, namespace string, object interface{}) error {
+	if c == nil || c.Policy == "" || c.ListFunc == nil {
+		return nil
+	}
+	listFunc := cachedList(c.ListFunc)
+	g, err := BuildDependencyGraph(ctx, listFunc, namespace)
+	if err != nil {
+		return err
+	}
+	key := g.key(c.ResourceType, name)
+	report := g.Impact(key)
+	action := "delete"
+	if object != nil {
+		action = "update"
+		if len(report.Affected) == 0 {
+			return nil
+		}
+		var updated *DependencyGraph
+		updated, err = BuildDependencyGraph(ctx, replaceObject(listFunc, c.ResourceType, name, object), namespace)
+		if err != nil {
+			return err
+		}
+		report = brokenDependents(report, updated.Impact(key))
+	}
+	if len(report.Affected) == 0 {
+		return nil
+	}
+	if c.Policy == model.ImpactCheckBlock {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("Failed to %s %s %s: %s", action, key.Kind, key.Name, DescribeImpact(report)), v1alpha2.BadRequest)
+	}
+	log.WarnfCtx(ctx, " M (Impact Check): %s of %s %s, %s", action, key.Kind, key.Name, DescribeImpact(report))
+	return nil
+}
+
+// cachedList lists each resource type once, so a graph can be built again with changed objects
+func cachedList(listFunc ObjectListFunc) ObjectListFunc {
+	type result struct {
+		list []interface{}
+		err  error
+	}
+	cache := make(map[ResourceType]result)
+	return func(ctx context.Context, resourceType ResourceType, namespace string) ([]interface{}, error) {
+		if r, ok := cache[resourceType]; ok {
+			return r.list, r.err
+		}
+		list, err := listFunc(ctx, resourceType, namespace)
+		cache[resourceType] = result{list: list, err: err}
+		return list, err
+	}
+}
+
+// replaceObject lists the objects with an object of a resource type replaced by its new value
+func replaceObject(listFunc ObjectListFunc, resourceType ResourceType, name string, object interface{}) ObjectListFunc {
+	return func(ctx context.Context, t ResourceType, namespace string) ([]interface{}, error) {
+		list, err := listFunc(ctx, t, namespace)
+		if t != resourceType {
+			return list, err
+		}
+		if err != nil && !api_utils.IsNotFound(err) {
+			return nil, err
+		}
+		jData, _ := json.Marshal(object)
+		var updated graphObject
+		if err = json.Unmarshal(jData, &updated); err != nil {
+			return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to read %s %s", resourceType, name), v1alpha2.InternalError)
+		}
+		updated.ObjectMeta.Name = name
+		ret := []interface{}{updated}
+		for _, item := range list {
+			jData, _ = json.Marshal(item)
+			var existing graphObject
+			if json.Unmarshal(jData, &existing) == nil && existing.ObjectMeta.Name == name {
+				continue
+			}
+			ret = append(ret, item)
+		}
+		return ret, nil
+	}
+}
+
+// brokenDependents returns the affected objects of a report that no longer depend on the object
+// after it's changed
+func brokenDependents(before model.ImpactReport, after model.ImpactReport) model.ImpactReport {
+	remaining := make(map[model.ObjectKey]bool, len(after.Affected))
+	for _, affected := range after.Affected {
+		remaining[affected.ObjectKey] = true
+	}
+	ret := model.ImpactReport{Object: before.Object, Affected: make([]model.ImpactedObject, 0)}
+	for _, affected := range before.Affected {
+		if !remaining[affected.ObjectKey] {
+			ret.Affected = append(ret.Affected, affected)
+		}
+	}
+	return ret
+}
+
+// ValidateImpactCheck checks an impact check policy
+func ValidateImpactCheck(policy string) error {
+	if policy != "" && policy != model.ImpactCheckBlock && policy != model.ImpactCheckWarn {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid impact check '%s', expected '%s' or '%s'", policy, model.ImpactCheckBlock, model.ImpactCheckWarn), v1alpha2.BadConfig)
+	}
+	return nil
+}
+
+// DescribeImpact summarizes the affected objects of an impact report
+func DescribeImpact(report model.ImpactReport) string {
+	names := make([]string, 0, len(report.Affected))
+	for _, affected := range report.Affected {
+		names = append(names, affected.Kind+" "+affected.Name)
+	}
+	return fmt.Sprintf("%d objects depend on it: %s", len(report.Affected), strings.Join(names, ", "))
+}
+
+func sortDependencies(dependencies []model.Dependency, by func(model.Dependency) model.ObjectKey) {
+	sort.SliceStable(dependencies, func(i, j int) bool {
+		if c := compareKeys(by(dependencies[i]), by(dependencies[j])); c != 0 {
+			return c < 0
+		}
+		return dependencies[i].Relation < dependencies[j].Relation
+	})
+}
+
+func compareKeys(a model.ObjectKey, b model.ObjectKey) int {
+	if a.Kind != b.Kind {
+		return strings.Compare(a.Kind, b.Kind)
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func specString(spec map[string]interface{}, key string) string {
+	if v, ok := spec[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// configReferences returns the catalog versions read with $config() in any string of a spec
+func configReferences(value interface{}) []string {
+	ret := make([]string, 0)
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, "${{") {
+			// expressions that don't parse are reported when the object is validated or deployed
+			if refs, err := api_utils.NewParser(v).ConfigReferences(); err == nil {
+				ret = append(ret, refs...)
+			}
+		}
+	case map[string]interface{}:
+		for _, k := range sortedMapKeys(v) {
+			ret = append(ret, configReferences(v[k])...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			ret = append(ret, configReferences(item)...)
+		}
+	}
+	return ret
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -7,6 +7,8 @@
 package vendors
 
 import (
+	"encoding/json"
+
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/campaignversions"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
@@ -69,7 +71,51 @@ func (o *CampaignVersionsVendor) GetEndpoints() []v1alpha2.Endpoint {
 	}
 }
 
+// onValidate validates a campaign version without saving it. It's reached with POST
+// campaignversions?action=validate, so it can't be shadowed by a campaign version name.
+func (c *CampaignVersionsVendor) onValidate(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("CampaignVersions Vendor", request.Context, &map[string]string{
+		"method": "onValidate",
+	})
+	defer span.End()
+	cLog.InfofCtx(pCtx, "V (CampaignVersions): onValidate, method: %s", string(request.Method))
+
+	switch request.Method {
+	case fasthttp.MethodPost:
+		var validationRequest model.CampaignValidationRequest
+		err := utils2.UnmarshalJson(request.Body, &validationRequest)
+		if err != nil {
+			cLog.ErrorfCtx(pCtx, "V (CampaignVersions): onValidate failed - %s", err.Error())
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte(err.Error()),
+			})
+		}
+		if request.Parameters["simulate"] == "true" {
+			validationRequest.Simulate = true
+		}
+		result := c.CampaignVersionsManager.ValidateCampaignVersion(pCtx, validationRequest)
+		jData, _ := json.Marshal(result)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+	}
+	cLog.InfoCtx(pCtx, "V (CampaignVersions): onValidate failed - 405 method not allowed")
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+
 func (c *CampaignVersionsVendor) onCampaignVersions(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	if request.Method == fasthttp.MethodPost && request.Parameters["action"] == "validate" {
+		return c.onValidate(request)
+	}
 	pCtx, span := observability.StartSpan("CampaignVersions Vendor", request.Context, &map[string]string{
 		"method": "onCampaignVersions",
 	})
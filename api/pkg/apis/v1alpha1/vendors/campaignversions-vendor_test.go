@@ -184,3 +184,55 @@ func TestCampaignVersionsWrongMethod(t *testing.T) {
 	})
 	assert.Equal(t, v1alpha2.MethodNotAllowed, resp.State)
 }
+
+func TestCampaignVersionsOnValidate(t *testing.T) {
+	vendor := createCampaignVersionsVendor()
+	validationRequest := model.CampaignValidationRequest{
+		CampaignVersion: model.CampaignVersionState{
+			ObjectMeta: model.ObjectMeta{
+				Name:      "campaignversion1-v-version1",
+				Namespace: "default",
+			},
+			Spec: &model.CampaignVersionSpec{
+				FirstStage:  "deploy",
+				SelfDriving: true,
+				Stages: map[string]model.StageSpec{
+					"deploy": {
+						Name:          "deploy",
+						Provider:      "providers.stage.mock",
+						StageSelector: "${{$if($equal($output(deploy,status),200),verify,'')}}",
+					},
+					"verify": {
+						Name:     "verify",
+						Provider: "providers.stage.mock",
+					},
+				},
+			},
+		},
+	}
+	data, _ := json.Marshal(validationRequest)
+	resp := vendor.onCampaignVersions(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Body:    data,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"action":   "validate",
+			"simulate": "true",
+		},
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+	var result model.CampaignValidationResult
+	err := json.Unmarshal(resp.Body, &result)
+	assert.Nil(t, err)
+	assert.True(t, result.Valid)
+	assert.NotNil(t, result.Simulation)
+	assert.True(t, result.Simulation.Completed)
+	assert.Equal(t, 2, len(result.Simulation.StageHistory))
+	assert.Equal(t, "verify", result.Simulation.StageHistory[0].NextStage)
+
+	resp = vendor.onValidate(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.MethodNotAllowed, resp.State)
+}
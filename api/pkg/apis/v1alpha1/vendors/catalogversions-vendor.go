@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/catalogversions"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
@@ -65,20 +66,27 @@ func (e *CatalogVersionsVendor) Init(config vendors.VendorConfig, factories []ma
 				err = utils2.UnmarshalJson(jData, &catalogversion)
 				origin := event.Metadata["origin"]
 				if err == nil {
-					name := fmt.Sprintf("%s-%s", origin, catalogversion.ObjectMeta.Name)
-					catalogversion.ObjectMeta.Name = name
-					catalogversion.Spec.RootResource = validation.GetRootResourceFromName(name)
-					if catalogversion.Spec.ParentName != "" {
-						catalogversion.Spec.ParentName = fmt.Sprintf("%s-%s", origin, catalogversion.Spec.ParentName)
-					}
 					ctx := context.TODO()
 					if event.Context != nil {
 						ctx = event.Context
 					}
-					err := e.CatalogVersionsManager.UpsertState(ctx, name, catalogversion)
+					if job.Action == "" {
+						job.Action = v1alpha2.JobUpdate
+					}
+					conflict, err := e.CatalogVersionsManager.ApplySyncedState(ctx, origin, job.Action, catalogversion)
 					if err != nil {
 						return err
 					}
+					// conflicts are recorded in the site status until they're resolved
+					if conflict != nil {
+						e.Vendor.Context.Publish("catalogversion-conflict", v1alpha2.Event{
+							Metadata: map[string]string{
+								"name": fmt.Sprintf("%s-%s", origin, catalogversion.ObjectMeta.Name),
+							},
+							Body:    conflict,
+							Context: ctx,
+						})
+					}
 				} else {
 					iLog.Errorf("Failed to unmarshal job body: %v", err)
 					return v1alpha2.NewCOAError(err, "failed to unmarshal job body", v1alpha2.BadConfig)
@@ -117,6 +125,34 @@ func (e *CatalogVersionsVendor) GetEndpoints() []v1alpha2.Endpoint {
 			Version: e.Version,
 			Handler: e.onCheck,
 		},
+		{
+			Methods:    []string{fasthttp.MethodGet},
+			Route:      route + "/effective",
+			Version:    e.Version,
+			Handler:    e.onEffective,
+			Parameters: []string{"name"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodGet},
+			Route:      route + "/history",
+			Version:    e.Version,
+			Handler:    e.onHistory,
+			Parameters: []string{"name"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodGet},
+			Route:      route + "/diff",
+			Version:    e.Version,
+			Handler:    e.onDiff,
+			Parameters: []string{"name"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodPost},
+			Route:      route + "/restore",
+			Version:    e.Version,
+			Handler:    e.onRestore,
+			Parameters: []string{"name"},
+		},
 		{
 			Methods:    []string{fasthttp.MethodPost},
 			Route:      route + "/status",
@@ -126,6 +162,207 @@ func (e *CatalogVersionsVendor) GetEndpoints() []v1alpha2.Endpoint {
 		},
 	}
 }
+func (e *CatalogVersionsVendor) onEffective(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	rCtx, span := observability.StartSpan("CatalogVersions Vendor", request.Context, &map[string]string{
+		"method": "onEffective",
+	})
+	defer span.End()
+
+	lLog.InfofCtx(rCtx, "V (CatalogVersions Vendor): onEffective, method: %s", string(request.Method))
+	namespace, namesapceSupplied := request.Parameters["namespace"]
+	if !namesapceSupplied {
+		namespace = "default"
+	}
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onEffective-GET", rCtx, nil)
+		id := request.Parameters["__name"]
+		effective, err := e.CatalogVersionsManager.GetEffectiveState(ctx, id, namespace)
+		if err != nil {
+			if utils.IsNotFound(err) {
+				return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+					State: v1alpha2.NotFound,
+					Body:  []byte(fmt.Sprintf("catalogversion '%s' is not found in namespace %s", id, namespace)),
+				})
+			}
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := utils.FormatObject(effective, false, request.Parameters["path"], request.Parameters["doc-type"])
+		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+		if request.Parameters["doc-type"] == "yaml" {
+			resp.ContentType = "text/plain"
+		}
+		return resp
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+func (e *CatalogVersionsVendor) onHistory(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	rCtx, span := observability.StartSpan("CatalogVersions Vendor", request.Context, &map[string]string{
+		"method": "onHistory",
+	})
+	defer span.End()
+
+	lLog.InfofCtx(rCtx, "V (CatalogVersions Vendor): onHistory, method: %s", string(request.Method))
+	namespace, namesapceSupplied := request.Parameters["namespace"]
+	if !namesapceSupplied {
+		namespace = "default"
+	}
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onHistory-GET", rCtx, nil)
+		id := request.Parameters["__name"]
+		var history interface{}
+		var err error
+		isArray := false
+		if v, ok := request.Parameters["revision"]; ok {
+			revision, perr := strconv.ParseInt(v, 10, 64)
+			if perr != nil {
+				return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+					State: v1alpha2.BadRequest,
+					Body:  []byte("invalid revision: " + v),
+				})
+			}
+			history, err = e.CatalogVersionsManager.GetRevision(ctx, id, namespace, revision)
+		} else {
+			history, err = e.CatalogVersionsManager.ListRevisions(ctx, id, namespace)
+			isArray = true
+		}
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := utils.FormatObject(history, isArray, request.Parameters["path"], request.Parameters["doc-type"])
+		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+		if request.Parameters["doc-type"] == "yaml" {
+			resp.ContentType = "text/plain"
+		}
+		return resp
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+func (e *CatalogVersionsVendor) onDiff(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	rCtx, span := observability.StartSpan("CatalogVersions Vendor", request.Context, &map[string]string{
+		"method": "onDiff",
+	})
+	defer span.End()
+
+	lLog.InfofCtx(rCtx, "V (CatalogVersions Vendor): onDiff, method: %s", string(request.Method))
+	namespace, namesapceSupplied := request.Parameters["namespace"]
+	if !namesapceSupplied {
+		namespace = "default"
+	}
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onDiff-GET", rCtx, nil)
+		id := request.Parameters["__name"]
+		revisions := make(map[string]int64)
+		for _, key := range []string{"from", "to"} {
+			v, ok := request.Parameters[key]
+			if !ok || v == "" {
+				continue
+			}
+			revision, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || revision < 0 {
+				return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+					State: v1alpha2.BadRequest,
+					Body:  []byte(fmt.Sprintf("invalid %s revision: %s", key, v)),
+				})
+			}
+			revisions[key] = revision
+		}
+		diff, err := e.CatalogVersionsManager.DiffRevisions(ctx, id, namespace, revisions["from"], revisions["to"])
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := json.Marshal(diff)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+func (e *CatalogVersionsVendor) onRestore(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	rCtx, span := observability.StartSpan("CatalogVersions Vendor", request.Context, &map[string]string{
+		"method": "onRestore",
+	})
+	defer span.End()
+
+	lLog.InfofCtx(rCtx, "V (CatalogVersions Vendor): onRestore, method: %s", string(request.Method))
+	namespace, namesapceSupplied := request.Parameters["namespace"]
+	if !namesapceSupplied {
+		namespace = "default"
+	}
+
+	switch request.Method {
+	case fasthttp.MethodPost:
+		ctx, span := observability.StartSpan("onRestore-POST", rCtx, nil)
+		id := request.Parameters["__name"]
+		revision, err := strconv.ParseInt(request.Parameters["revision"], 10, 64)
+		if err != nil || revision <= 0 {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte("missing or invalid revision"),
+			})
+		}
+		ctx = catalogversions.WithAuthor(ctx, request.Metadata[v1alpha2.AuthenticatedUser])
+		err = e.CatalogVersionsManager.RestoreRevision(ctx, id, namespace, revision)
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.OK,
+		})
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
 func (e *CatalogVersionsVendor) onStatus(request v1alpha2.COARequest) v1alpha2.COAResponse {
 	rCtx, span := observability.StartSpan("CatalogVersions Vendor", request.Context, &map[string]string{
 		"method": "onStatus",
@@ -164,7 +401,7 @@ func (e *CatalogVersionsVendor) onStatus(request v1alpha2.COARequest) v1alpha2.C
 			})
 		}
 		existingCatalogVersion.Spec.Properties["reported"] = components
-		err = e.CatalogVersionsManager.UpsertState(rCtx, id, existingCatalogVersion)
+		err = e.CatalogVersionsManager.UpsertState(catalogversions.WithAuthor(rCtx, request.Metadata[v1alpha2.AuthenticatedUser]), id, existingCatalogVersion)
 		if err != nil {
 			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
 				State: v1alpha2.GetErrorState(err),
@@ -359,6 +596,7 @@ func (e *CatalogVersionsVendor) onCatalogVersions(request v1alpha2.COARequest) v
 			})
 		}
 
+		ctx = catalogversions.WithAuthor(ctx, request.Metadata[v1alpha2.AuthenticatedUser])
 		err = e.CatalogVersionsManager.UpsertState(ctx, id, catalogversion)
 		if err != nil {
 			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
@@ -371,6 +609,7 @@ func (e *CatalogVersionsVendor) onCatalogVersions(request v1alpha2.COARequest) v
 		})
 	case fasthttp.MethodDelete:
 		ctx, span := observability.StartSpan("onCatalogVersions-DELETE", pCtx, nil)
+		ctx = catalogversions.WithAuthor(ctx, request.Metadata[v1alpha2.AuthenticatedUser])
 		err := e.CatalogVersionsManager.DeleteState(ctx, id, namespace)
 		if err != nil {
 			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
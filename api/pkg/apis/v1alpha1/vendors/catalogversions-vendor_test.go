@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -117,9 +118,13 @@ func CatalogVersionVendorInit() CatalogVersionsVendor {
 	graphProvider := &memorygraph.MemoryGraphProvider{}
 	graphProvider.Init(memorygraph.MemoryGraphProviderConfig{})
 
+	historyProvider := &memorystate.MemoryStateProvider{}
+	historyProvider.Init(memorystate.MemoryStateProviderConfig{})
+
 	catalogversionProviders := make(map[string]providers.IProvider)
 	catalogversionProviders["StateProvider"] = stateProvider
 	catalogversionProviders["GraphProvider"] = graphProvider
+	catalogversionProviders["HistoryProvider"] = historyProvider
 	pubSubProvider := memory.InMemoryPubSubProvider{}
 	pubSubProvider.Init(memory.InMemoryPubSubConfig{Name: "test"})
 	vendor := CatalogVersionsVendor{}
@@ -134,6 +139,7 @@ func CatalogVersionVendorInit() CatalogVersionsVendor {
 				Type: "managers.symphony.catalogversions",
 				Properties: map[string]string{
 					"providers.persistentstate": "StateProvider",
+					"providers.historystate":    "HistoryProvider",
 				},
 			},
 		},
@@ -503,6 +509,14 @@ func TestCatalogVersionSubscribe(t *testing.T) {
 	vendor := CatalogVersionVendorInit()
 	vendor.CatalogVersionsManager.CatalogVersionValidator = validation.NewCatalogVersionValidator(vendor.CatalogVersionsManager.CatalogVersionLookup, nil, vendor.CatalogVersionsManager.ChildCatalogVersionLookup)
 
+	var conflicts atomic.Int32
+	vendor.Context.Subscribe("catalogversion-conflict", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			conflicts.Add(1)
+			return nil
+		},
+	})
+
 	origin := "parent"
 	vendor.Context.Publish("catalogversion-sync", v1alpha2.Event{
 		Metadata: map[string]string{
@@ -535,4 +549,146 @@ func TestCatalogVersionSubscribe(t *testing.T) {
 		}
 	}
 	assert.Equal(t, v1alpha2.OK, response.State)
+	// items that are synced without a conflict don't publish one
+	assert.Never(t, func() bool {
+		return conflicts.Load() > 0
+	}, 500*time.Millisecond, 50*time.Millisecond)
+}
+
+func TestCatalogVersionOnEffective(t *testing.T) {
+	vendor := CatalogVersionVendorInit()
+	vendor.CatalogVersionsManager.CatalogVersionValidator = validation.NewCatalogVersionValidator(vendor.CatalogVersionsManager.CatalogVersionLookup, nil, vendor.CatalogVersionsManager.ChildCatalogVersionLookup)
+
+	catalogversionState.Spec.CatalogType = "config"
+	err := CreateSimpleChain("effective-v-version1", 2, *vendor.CatalogVersionsManager, catalogversionState)
+	assert.Nil(t, err)
+
+	response := vendor.onEffective(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__name": "effective-v-version1-1",
+		},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var effective model.EffectiveCatalog
+	err = json.Unmarshal(response.Body, &effective)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"effective-v-version1-1", "effective-v-version1"}, effective.Chain)
+	assert.Equal(t, "value1", effective.Properties["property1"])
+	assert.Equal(t, "effective-v-version1-1", effective.Provenance["/property1"])
+
+	response = vendor.onEffective(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__name": "missing-v-version1",
+		},
+	})
+	assert.Equal(t, v1alpha2.NotFound, response.State)
+
+	response = vendor.onEffective(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.MethodNotAllowed, response.State)
+}
+
+func TestCatalogVersionHistory(t *testing.T) {
+	vendor := CatalogVersionVendorInit()
+	vendor.CatalogVersionsManager.CatalogVersionValidator = validation.NewCatalogVersionValidator(vendor.CatalogVersionsManager.CatalogVersionLookup, nil, vendor.CatalogVersionsManager.ChildCatalogVersionLookup)
+
+	post := func(level string) {
+		state := model.CatalogVersionState{
+			ObjectMeta: model.ObjectMeta{Name: "history-v-version1"},
+			Spec: &model.CatalogVersionSpec{
+				CatalogType:  "config",
+				RootResource: "history",
+				Properties:   map[string]interface{}{"level": level},
+			},
+		}
+		b, err := json.Marshal(state)
+		assert.Nil(t, err)
+		response := vendor.onCatalogVersions(v1alpha2.COARequest{
+			Method:     fasthttp.MethodPost,
+			Context:    context.Background(),
+			Body:       b,
+			Parameters: map[string]string{"__name": "history-v-version1"},
+			Metadata:   map[string]string{v1alpha2.AuthenticatedUser: "alice"},
+		})
+		assert.Equal(t, v1alpha2.OK, response.State)
+	}
+	post("info")
+	post("debug")
+
+	response := vendor.onHistory(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "history-v-version1"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var revisions []model.CatalogRevision
+	err := json.Unmarshal(response.Body, &revisions)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, "alice", revisions[1].Author)
+
+	response = vendor.onHistory(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "history-v-version1", "revision": "1"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var revision model.CatalogRevision
+	err = json.Unmarshal(response.Body, &revision)
+	assert.Nil(t, err)
+	assert.Equal(t, "info", revision.Spec.Properties["level"])
+
+	response = vendor.onDiff(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "history-v-version1", "from": "1", "to": "2"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var diff model.CatalogDiff
+	err = json.Unmarshal(response.Body, &diff)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.PropertyChange{
+		{Property: "/properties/level", Operation: model.ChangeReplaced, Old: "info", New: "debug"},
+	}, diff.Changes)
+
+	response = vendor.onDiff(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "history-v-version1", "from": "one"},
+	})
+	assert.Equal(t, v1alpha2.BadRequest, response.State)
+
+	response = vendor.onRestore(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "history-v-version1", "revision": "1"},
+		Metadata:   map[string]string{v1alpha2.AuthenticatedUser: "bob"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	state, err := vendor.CatalogVersionsManager.GetState(context.Background(), "history-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "info", state.Spec.Properties["level"])
+	revision, err = vendor.CatalogVersionsManager.GetRevision(context.Background(), "history-v-version1", "default", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RevisionRestored, revision.Action)
+	assert.Equal(t, "bob", revision.Author)
+
+	response = vendor.onRestore(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "history-v-version1", "revision": "9"},
+	})
+	assert.Equal(t, v1alpha2.NotFound, response.State)
+
+	response = vendor.onRestore(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.MethodNotAllowed, response.State)
 }
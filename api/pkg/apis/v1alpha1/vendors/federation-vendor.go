@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/catalogversions"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/sites"
@@ -92,6 +93,10 @@ func (f *FederationVendor) Init(config vendors.VendorConfig, factories []manager
 				return err
 			}
 			for _, site := range sites {
+				// sites further down the topology get catalogs from their parent
+				if site.Spec.Parent != "" && site.Spec.Parent != f.Vendor.Context.SiteInfo.SiteId {
+					continue
+				}
 				if site.Spec.Name != f.Vendor.Context.SiteInfo.SiteId {
 					event.Metadata["site"] = site.Spec.Name
 					ctx := context.TODO()
@@ -106,7 +111,7 @@ func (f *FederationVendor) Init(config vendors.VendorConfig, factories []manager
 	})
 	f.Vendor.Context.Subscribe("remote", v1alpha2.EventHandler{
 		Handler: func(topic string, event v1alpha2.Event) error {
-			_, ok := event.Metadata["site"]
+			site, ok := event.Metadata["site"]
 			if !ok {
 				return v1alpha2.NewCOAError(nil, "site is not supplied", v1alpha2.BadRequest)
 			}
@@ -114,10 +119,45 @@ func (f *FederationVendor) Init(config vendors.VendorConfig, factories []manager
 			if event.Context != nil {
 				ctx = event.Context
 			}
+			// jobs for sites further down the topology are queued for the site that relays them
+			nextHop, err := f.SitesManager.NextHop(ctx, site)
+			if err != nil {
+				fLog.ErrorfCtx(ctx, "V (Federation): failed to route job for site %s: %v", site, err)
+				return err
+			}
+			event.Metadata["site"] = nextHop
+			event.Metadata["destination"] = site
+			if f.SitesManager.ExpiresJobs(ctx, nextHop) {
+				var job v1alpha2.JobData
+				jData, _ := json.Marshal(event.Body)
+				if err = utils2.UnmarshalJson(jData, &job); err == nil && job.Action == v1alpha2.JobRun {
+					f.expireJobs(ctx, nextHop, []v1alpha2.JobData{job})
+					return nil
+				}
+			}
 			f.StagingManager.HandleJobEvent(ctx, event) //TODO: how to handle errors in this case?
 			return nil
 		},
 	})
+	f.Vendor.Context.Subscribe(sites.SiteHealthTopic, v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			ctx := context.TODO()
+			if event.Context != nil {
+				ctx = event.Context
+			}
+			site := event.Metadata["site"]
+			if event.Metadata["health"] != model.SiteOffline || !f.SitesManager.ExpiresJobs(ctx, site) {
+				// jobs of offline sites are held until the sites are back
+				return nil
+			}
+			jobs, err := f.StagingManager.ExpireJobsForSite(site)
+			if err != nil {
+				fLog.ErrorfCtx(ctx, "V (Federation): failed to expire jobs of site %s: %v", site, err)
+			}
+			f.expireJobs(ctx, site, jobs)
+			return nil
+		},
+	})
 	f.Vendor.Context.Subscribe("report", v1alpha2.EventHandler{
 		Handler: func(topic string, event v1alpha2.Event) error {
 			ctx := context.TODO()
@@ -144,6 +184,21 @@ func (f *FederationVendor) Init(config vendors.VendorConfig, factories []manager
 			return v1alpha2.NewCOAError(nil, "report is not an activation status", v1alpha2.BadRequest)
 		},
 	})
+	f.Vendor.Context.Subscribe("catalogversion-conflict", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			ctx := context.TODO()
+			if event.Context != nil {
+				ctx = event.Context
+			}
+			var conflict *model.CatalogConflict
+			jData, _ := json.Marshal(event.Body)
+			err := utils2.UnmarshalJson(jData, &conflict)
+			if err != nil {
+				return v1alpha2.NewCOAError(err, "event body is not a catalog conflict", v1alpha2.BadRequest)
+			}
+			return f.SitesManager.UpdateCatalogConflict(ctx, f.Vendor.Context.SiteInfo.SiteId, event.Metadata["name"], conflict)
+		},
+	})
 	f.Vendor.Context.Subscribe("trail", v1alpha2.EventHandler{
 		Handler: func(topic string, event v1alpha2.Event) error {
 			ctx := context.TODO()
@@ -204,11 +259,45 @@ func (f *FederationVendor) GetEndpoints() []v1alpha2.Endpoint {
 		},
 		{
 			Methods:    []string{fasthttp.MethodPost},
+			Route:      route + "/ack",
+			Version:    f.Version,
+			Handler:    f.onAck,
+			Parameters: []string{"site"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodPost, fasthttp.MethodGet},
 			Route:      route + "/status",
 			Version:    f.Version,
 			Handler:    f.onStatus,
 			Parameters: []string{"name"},
 		},
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   route + "/health",
+			Version: f.Version,
+			Handler: f.onHealth,
+		},
+		{
+			Methods:    []string{fasthttp.MethodPost},
+			Route:      route + "/conflicts",
+			Version:    f.Version,
+			Handler:    f.onConflicts,
+			Parameters: []string{"name"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodPost, fasthttp.MethodGet},
+			Route:      route + "/enroll",
+			Version:    f.Version,
+			Handler:    f.onEnroll,
+			Parameters: []string{"site?"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodPost, fasthttp.MethodGet},
+			Route:      route + "/enrollments",
+			Version:    f.Version,
+			Handler:    f.onEnrollments,
+			Parameters: []string{"site?"},
+		},
 		{
 			Methods: []string{fasthttp.MethodPost},
 			Route:   route + "/trail",
@@ -235,6 +324,15 @@ func (c *FederationVendor) onStatus(request v1alpha2.COARequest) v1alpha2.COARes
 		var state model.SiteState
 		utils2.UnmarshalJson(request.Body, &state)
 
+		if state.Spec == nil {
+			state.Spec = &model.SiteSpec{}
+		}
+		if state.Spec.Parent == "" {
+			state.Spec.Parent = c.Context.SiteInfo.SiteId
+		}
+		if resp, ok := c.authenticateSite(pCtx, request, c.reportingSite(pCtx, state)); !ok {
+			return observ_utils.CloseSpanWithCOAResponse(span, resp)
+		}
 		err := c.SitesManager.ReportState(pCtx, state)
 
 		if err != nil {
@@ -246,6 +344,68 @@ func (c *FederationVendor) onStatus(request v1alpha2.COARequest) v1alpha2.COARes
 		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
 			State: v1alpha2.OK,
 		})
+	case fasthttp.MethodGet:
+		if resp, ok := c.authenticateSite(pCtx, request, request.Parameters["__name"]); !ok {
+			return observ_utils.CloseSpanWithCOAResponse(span, resp)
+		}
+		status, err := c.StagingManager.GetQueueStatus(request.Parameters["__name"])
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := utils.FormatObject(status, false, request.Parameters["path"], request.Parameters["doc-type"])
+		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+		if request.Parameters["doc-type"] == "yaml" {
+			resp.ContentType = "text/plain"
+		}
+		return resp
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+func (f *FederationVendor) onAck(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Federation Vendor", request.Context, &map[string]string{
+		"method": "onAck",
+	})
+	defer span.End()
+
+	tLog.InfoCtx(pCtx, "V (Federation): onAck")
+	switch request.Method {
+	case fasthttp.MethodPost:
+		if resp, ok := f.authenticateSite(pCtx, request, request.Parameters["__site"]); !ok {
+			return observ_utils.CloseSpanWithCOAResponse(span, resp)
+		}
+		var ack model.SyncAck
+		err := utils2.UnmarshalJson(request.Body, &ack)
+		if err != nil {
+			tLog.ErrorfCtx(pCtx, "V (Federation): failed to unmarshal sync ack: %v", err)
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte(err.Error()),
+			})
+		}
+		err = f.StagingManager.AckBatchForSite(request.Parameters["__site"], ack.Receipts)
+		if err != nil {
+			tLog.ErrorfCtx(pCtx, "V (Federation): failed to acknowledge jobs: %v", err)
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.OK,
+		})
 	}
 	resp := v1alpha2.COAResponse{
 		State:       v1alpha2.MethodNotAllowed,
@@ -270,7 +430,9 @@ func (f *FederationVendor) onRegistry(request v1alpha2.COARequest) v1alpha2.COAR
 		var err error
 		var state interface{}
 		isArray := false
-		if id == "" {
+		if request.Parameters["view"] == "tree" {
+			state, err = f.SitesManager.GetTree(ctx)
+		} else if id == "" {
 			state, err = f.SitesManager.ListState(ctx)
 			isArray = true
 		} else {
@@ -313,6 +475,9 @@ func (f *FederationVendor) onRegistry(request v1alpha2.COARequest) v1alpha2.COAR
 			})
 		}
 		//TODO: generate site key pair as needed
+		if site.Spec != nil && site.Spec.Parent == "" && !site.Spec.IsSelf {
+			site.Spec.Parent = f.Context.SiteInfo.SiteId
+		}
 		err = f.SitesManager.UpsertState(ctx, id, site)
 		if err != nil {
 			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
@@ -352,6 +517,9 @@ func (f *FederationVendor) onSync(request v1alpha2.COARequest) v1alpha2.COARespo
 	defer span.End()
 
 	tLog.Info("V (Federation): onSync")
+	if resp, ok := f.authenticateSite(pCtx, request, request.Parameters["__site"]); !ok {
+		return observ_utils.CloseSpanWithCOAResponse(span, resp)
+	}
 	switch request.Method {
 	case fasthttp.MethodPost:
 		var status model.StageStatus
@@ -363,18 +531,13 @@ func (f *FederationVendor) onSync(request v1alpha2.COARequest) v1alpha2.COARespo
 				Body:  []byte(err.Error()),
 			})
 		}
-		err = f.Vendor.Context.Publish("job-report", v1alpha2.Event{
-			Body:    status,
-			Context: pCtx,
-		})
+		err = f.reportJobStatus(pCtx, status)
 		if err != nil {
-			tLog.ErrorfCtx(pCtx, "V (Federation): failed to publish job report: %v", err)
 			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
 				State: v1alpha2.GetErrorState(err),
 				Body:  []byte(err.Error()),
 			})
 		}
-		tLog.Debugf("V (Federation): published job report: %v", status)
 		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
 			State: v1alpha2.OK,
 		})
@@ -396,10 +559,39 @@ func (f *FederationVendor) onSync(request v1alpha2.COARequest) v1alpha2.COARespo
 				Body:  []byte(err.Error()),
 			})
 		}
-		batch, err := f.StagingManager.GetABatchForSite(id, intCount)
+		var wait time.Duration
+		if v := request.Parameters["wait"]; v != "" {
+			wait, err = time.ParseDuration(v)
+			if err != nil || wait < 0 {
+				return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+					State: v1alpha2.BadRequest,
+					Body:  []byte("invalid wait: " + v),
+				})
+			}
+			if wait > staging.MaxSyncWait {
+				wait = staging.MaxSyncWait
+			}
+		}
+		// sites that acknowledge their batches opt in with ack=true, the jobs of other sites
+		// are removed from the queue when they're delivered
+		ack := request.Parameters["ack"] == "true"
+		// the cursor is taken before the batch, so jobs queued in between aren't missed
+		cursor := f.StagingManager.Cursor(id)
+		batch, receipts, err := f.StagingManager.GetABatchForSite(id, intCount, ack)
+		if err == nil && len(batch) == 0 && wait > 0 {
+			// long poll: a site that has seen the current cursor waits for new jobs, a site
+			// that hasn't (or that comes back after a restart) gets the cursor right away
+			if request.Parameters["cursor"] == cursor {
+				if f.StagingManager.WaitForJobs(ctx, id, cursor, wait) {
+					cursor = f.StagingManager.Cursor(id)
+					batch, receipts, err = f.StagingManager.GetABatchForSite(id, intCount, ack)
+				}
+			}
+		}
 
 		pack := model.SyncPackage{
 			Origin: f.Context.SiteInfo.SiteId,
+			Cursor: cursor,
 		}
 
 		if err != nil {
@@ -410,12 +602,24 @@ func (f *FederationVendor) onSync(request v1alpha2.COARequest) v1alpha2.COARespo
 		}
 		catalogversions := make([]model.CatalogVersionState, 0)
 		jobs := make([]v1alpha2.JobData, 0)
-		for _, c := range batch {
+		tombstones := make([]model.CatalogVersionTombstone, 0)
+		var dropped []string
+		for i, c := range batch {
 			if c.Action == v1alpha2.JobRun { //TODO: I don't really like this
 				jobs = append(jobs, c)
+			} else if c.Action == v1alpha2.JobDelete {
+				tombstones = append(tombstones, toTombstone(c, namespace))
 			} else {
 				catalogversion, err := f.CatalogVersionsManager.GetState(ctx, c.Id, namespace)
 				if err != nil {
+					if utils.IsNotFound(err) {
+						// the catalog version was deleted since the job was queued, its tombstone follows
+						tLog.InfofCtx(ctx, "V (Federation): dropping job for catalog version %s as it's not found", c.Id)
+						if receipts != nil {
+							dropped = append(dropped, receipts[i])
+						}
+						continue
+					}
 					return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
 						State: v1alpha2.GetErrorState(err),
 						Body:  []byte(err.Error()),
@@ -423,9 +627,19 @@ func (f *FederationVendor) onSync(request v1alpha2.COARequest) v1alpha2.COARespo
 				}
 				catalogversions = append(catalogversions, catalogversion)
 			}
+			if receipts != nil {
+				pack.Receipts = append(pack.Receipts, receipts[i])
+			}
+		}
+		if len(dropped) > 0 {
+			err = f.StagingManager.AckBatchForSite(id, dropped)
+			if err != nil {
+				tLog.ErrorfCtx(ctx, "V (Federation): failed to acknowledge dropped jobs: %v", err)
+			}
 		}
 		pack.CatalogVersions = catalogversions
 		pack.Jobs = jobs
+		pack.Tombstones = liveTombstones(tombstones, catalogversions)
 		jData, _ := utils.FormatObject(pack, true, request.Parameters["path"], request.Parameters["doc-type"])
 		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
 			State:       v1alpha2.OK,
@@ -445,6 +659,171 @@ func (f *FederationVendor) onSync(request v1alpha2.COARequest) v1alpha2.COARespo
 	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
 	return resp
 }
+// reportJobStatus hands the status of a remote job to the stage vendor, or passes it on towards
+// the site that runs the campaign if the job was relayed by this site
+func (f *FederationVendor) reportJobStatus(ctx context.Context, status model.StageStatus) error {
+	if origin, ok := status.Outputs["__originSite"].(string); ok && origin != "" && origin != f.Context.SiteInfo.SiteId {
+		err := f.apiClient.SyncStageStatus(ctx, status,
+			f.Vendor.Context.SiteInfo.ParentSite.Username,
+			f.Vendor.Context.SiteInfo.ParentSite.Password)
+		if err != nil {
+			tLog.ErrorfCtx(ctx, "V (Federation): failed to relay job report: %v", err)
+		}
+		return err
+	}
+	err := f.Vendor.Context.Publish("job-report", v1alpha2.Event{
+		Body:    status,
+		Context: ctx,
+	})
+	if err != nil {
+		tLog.ErrorfCtx(ctx, "V (Federation): failed to publish job report: %v", err)
+		return err
+	}
+	tLog.Debugf("V (Federation): published job report: %v", status)
+	return nil
+}
+
+// expireJobs fails the campaign stages of run jobs that won't be delivered to an offline site
+func (f *FederationVendor) expireJobs(ctx context.Context, site string, jobs []v1alpha2.JobData) {
+	for _, job := range jobs {
+		jData, _ := json.Marshal(job.Body)
+		var dataPackage v1alpha2.InputOutputData
+		if err := utils2.UnmarshalJson(jData, &dataPackage); err != nil || dataPackage.Inputs["__activation"] == nil {
+			tLog.InfofCtx(ctx, "V (Federation): dropping expired job %s of offline site %s", job.Id, site)
+			continue
+		}
+		outputs := map[string]interface{}{
+			"__site": site,
+		}
+		for _, key := range []string{"__campaignversion", "__namespace", "__activation", "__activationGeneration", "__stage", "__originSite"} {
+			if v, ok := dataPackage.Inputs[key]; ok {
+				outputs[key] = v
+			}
+		}
+		message := fmt.Sprintf("site '%s' is offline, its job expired", site)
+		tLog.InfofCtx(ctx, "V (Federation): %s, failing stage %v of activation %v", message, outputs["__stage"], outputs["__activation"])
+		f.reportJobStatus(ctx, model.StageStatus{
+			Outputs:       outputs,
+			Status:        v1alpha2.InternalError,
+			StatusMessage: v1alpha2.InternalError.String(),
+			ErrorMessage:  message,
+		})
+	}
+}
+
+// onHealth summarizes the health of the sites in the registry
+func (f *FederationVendor) onHealth(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Federation Vendor", request.Context, &map[string]string{
+		"method": "onHealth",
+	})
+	defer span.End()
+
+	tLog.InfoCtx(pCtx, "V (Federation): onHealth")
+	switch request.Method {
+	case fasthttp.MethodGet:
+		health, err := f.SitesManager.GetFleetHealth(pCtx)
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := utils.FormatObject(health, false, request.Parameters["path"], request.Parameters["doc-type"])
+		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+		if request.Parameters["doc-type"] == "yaml" {
+			resp.ContentType = "text/plain"
+		}
+		return resp
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+func (f *FederationVendor) onConflicts(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Federation Vendor", request.Context, &map[string]string{
+		"method": "onConflicts",
+	})
+	defer span.End()
+
+	tLog.InfoCtx(pCtx, "V (Federation): onConflicts")
+	switch request.Method {
+	case fasthttp.MethodPost:
+		name := request.Parameters["__name"]
+		err := f.resolveConflict(pCtx, name, request.Parameters["resolution"])
+		if err != nil {
+			tLog.ErrorfCtx(pCtx, "V (Federation): failed to resolve conflict of %s: %v", name, err)
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.OK,
+		})
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+
+// resolveConflict resolves the sync conflict of a catalog version either by keeping the local
+// changes ("child"), or by applying the parent's current version ("parent")
+func (f *FederationVendor) resolveConflict(ctx context.Context, name string, resolution string) error {
+	if f.CatalogVersionsManager == nil {
+		return v1alpha2.NewCOAError(nil, "catalogversions manager is not supplied", v1alpha2.MissingConfig)
+	}
+	site, err := f.SitesManager.GetState(ctx, f.Vendor.Context.SiteInfo.SiteId)
+	if err != nil {
+		return err
+	}
+	conflict, ok := site.Status.CatalogConflicts[name]
+	if !ok {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("catalog version '%s' has no conflict", name), v1alpha2.NotFound)
+	}
+	switch resolution {
+	case "child":
+		err = f.CatalogVersionsManager.AcceptLocalState(ctx, name, conflict.Namespace)
+	case "parent":
+		var parent model.CatalogVersionState
+		parent, err = f.apiClient.GetCatalogVersion(ctx, conflict.SourceName, conflict.Namespace,
+			f.Vendor.Context.SiteInfo.ParentSite.Username,
+			f.Vendor.Context.SiteInfo.ParentSite.Password)
+		if err != nil && !utils.IsNotFound(err) {
+			return err
+		}
+		if err != nil {
+			// the catalog version was deleted at the parent site
+			err = f.CatalogVersionsManager.DeleteState(ctx, name, conflict.Namespace)
+			if err != nil && !utils.IsNotFound(err) {
+				return err
+			}
+		} else {
+			err = f.CatalogVersionsManager.AcceptLocalState(ctx, name, conflict.Namespace)
+			if err != nil && !utils.IsNotFound(err) {
+				return err
+			}
+			_, err = f.CatalogVersionsManager.ApplySyncedState(ctx, conflict.Origin, v1alpha2.JobUpdate, parent)
+		}
+	default:
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid resolution '%s', expected 'parent' or 'child'", resolution), v1alpha2.BadRequest)
+	}
+	if err != nil {
+		return err
+	}
+	return f.SitesManager.UpdateCatalogConflict(ctx, f.Vendor.Context.SiteInfo.SiteId, name, nil)
+}
 func (f *FederationVendor) onTrail(request v1alpha2.COARequest) v1alpha2.COAResponse {
 	_, span := observability.StartSpan("Federation Vendor", request.Context, &map[string]string{
 		"method": "onTrail",
@@ -508,3 +887,260 @@ func (f *FederationVendor) onK8sHook(request v1alpha2.COARequest) v1alpha2.COARe
 	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
 	return resp
 }
+
+func toTombstone(job v1alpha2.JobData, namespace string) model.CatalogVersionTombstone {
+	var catalogversion model.CatalogVersionState
+	jData, _ := json.Marshal(job.Body)
+	json.Unmarshal(jData, &catalogversion)
+	tombstone := model.CatalogVersionTombstone{
+		Name:       job.Id,
+		Namespace:  catalogversion.ObjectMeta.Namespace,
+		Generation: catalogversion.ObjectMeta.ObjGeneration,
+	}
+	if tombstone.Namespace == "" {
+		tombstone.Namespace = namespace
+	}
+	if catalogversion.Spec != nil {
+		tombstone.CatalogType = catalogversion.Spec.CatalogType
+	}
+	return tombstone
+}
+
+// liveTombstones filters out the tombstones of catalog versions that were recreated, as the
+// batch carries their current version
+func liveTombstones(tombstones []model.CatalogVersionTombstone, catalogversions []model.CatalogVersionState) []model.CatalogVersionTombstone {
+	ret := make([]model.CatalogVersionTombstone, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		recreated := false
+		for _, catalogversion := range catalogversions {
+			if catalogversion.ObjectMeta.Name == tombstone.Name {
+				recreated = true
+				break
+			}
+		}
+		if !recreated {
+			ret = append(ret, tombstone)
+		}
+	}
+	return ret
+}
+
+// authenticateSite checks the site credentials of a federation request. Requests without
+// site credentials are let through when they're authenticated by the JWT middleware, unless
+// site authentication is required. A request for a site (if given) must be authenticated as
+// that site.
+func (f *FederationVendor) authenticateSite(ctx context.Context, request v1alpha2.COARequest, site string) (v1alpha2.COAResponse, bool) {
+	authenticated, err := f.SitesManager.AuthenticateSite(ctx, siteCredentials(request))
+	if err != nil {
+		tLog.ErrorfCtx(ctx, "V (Federation): failed to authenticate site: %v", err)
+		return v1alpha2.COAResponse{
+			State: v1alpha2.GetErrorState(err),
+			Body:  []byte(err.Error()),
+		}, false
+	}
+	if authenticated == "" {
+		// paths the JWT middleware ignores are only open to authenticated sites
+		if f.SitesManager.SiteAuthRequired() || request.Metadata[v1alpha2.AuthenticationSkipped] == "true" {
+			return v1alpha2.COAResponse{
+				State: v1alpha2.Unauthorized,
+				Body:  []byte("site authentication is required"),
+			}, false
+		}
+		return v1alpha2.COAResponse{}, true
+	}
+	if site != "" && site != authenticated {
+		// relay sites act for the sites below them
+		if relayed, err := f.SitesManager.IsDescendant(ctx, site, authenticated); err == nil && relayed {
+			return v1alpha2.COAResponse{}, true
+		}
+		return v1alpha2.COAResponse{
+			State: v1alpha2.Forbidden,
+			Body:  []byte(fmt.Sprintf("site '%s' can't act for site '%s'", authenticated, site)),
+		}, false
+	}
+	return v1alpha2.COAResponse{}, true
+}
+
+// reportingSite returns the site a status report must be authenticated for. A site that isn't
+// registered yet is reported by a relay site for the first time, and the relay must be able to
+// act for its parent.
+func (f *FederationVendor) reportingSite(ctx context.Context, state model.SiteState) string {
+	if state.Spec.Parent == f.Context.SiteInfo.SiteId {
+		return state.Id
+	}
+	if _, err := f.SitesManager.GetState(ctx, state.Id); err != nil && utils.IsNotFound(err) {
+		return state.Spec.Parent
+	}
+	return state.Id
+}
+
+func siteCredentials(request v1alpha2.COARequest) sites.SiteCredentials {
+	credentials := sites.SiteCredentials{
+		Method:    request.Method,
+		Path:      request.Route,
+		Body:      request.Body,
+		Site:      request.Metadata[v1alpha2.SiteIdHeader],
+		Timestamp: request.Metadata[v1alpha2.SiteTimestampHeader],
+		Nonce:     request.Metadata[v1alpha2.SiteNonceHeader],
+		Signature: request.Metadata[v1alpha2.SiteSignatureHeader],
+	}
+	if request.Context == nil {
+		return credentials
+	}
+	if reqCtx, ok := request.Context.Value(v1alpha2.COAFastHTTPContextKey).(*fasthttp.RequestCtx); ok {
+		credentials.Query = string(reqCtx.URI().QueryString())
+		if tlsState := reqCtx.TLSConnectionState(); tlsState != nil {
+			credentials.PeerCertificates = tlsState.PeerCertificates
+		}
+	}
+	return credentials
+}
+
+// onEnroll is called by child sites to request a certificate (POST) and to check whether
+// it's issued (GET). Renewals are authenticated with the site's current certificate.
+func (f *FederationVendor) onEnroll(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Federation Vendor", request.Context, &map[string]string{
+		"method": "onEnroll",
+	})
+	defer span.End()
+
+	tLog.InfoCtx(pCtx, "V (Federation): onEnroll")
+	switch request.Method {
+	case fasthttp.MethodPost:
+		var enrollmentRequest model.SiteEnrollmentRequest
+		err := utils2.UnmarshalJson(request.Body, &enrollmentRequest)
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte(err.Error()),
+			})
+		}
+		authenticated, err := f.SitesManager.AuthenticateSite(pCtx, siteCredentials(request))
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		if authenticated != "" && authenticated != enrollmentRequest.Site {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.Forbidden,
+				Body:  []byte(fmt.Sprintf("site '%s' can't enroll site '%s'", authenticated, enrollmentRequest.Site)),
+			})
+		}
+		enrollment, err := f.SitesManager.RequestEnrollment(pCtx, enrollmentRequest, authenticated != "")
+		if err != nil {
+			tLog.ErrorfCtx(pCtx, "V (Federation): failed to enroll site %s: %v", enrollmentRequest.Site, err)
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, enrollmentResponse(enrollment))
+	case fasthttp.MethodGet:
+		enrollment, err := f.SitesManager.GetEnrollment(pCtx, request.Parameters["__site"])
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, enrollmentResponse(enrollment))
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+
+// enrollmentResponse returns an enrollment to the site that requested it. The certificate
+// signing request isn't needed by the site, and the certificate is public.
+func enrollmentResponse(enrollment model.SiteEnrollment) v1alpha2.COAResponse {
+	enrollment.CSR = ""
+	jData, _ := json.Marshal(enrollment)
+	return v1alpha2.COAResponse{
+		State:       v1alpha2.OK,
+		Body:        jData,
+		ContentType: "application/json",
+	}
+}
+
+// onEnrollments lets operators review (GET), approve, revoke and delete (POST with an
+// "action" parameter) site enrollments
+func (f *FederationVendor) onEnrollments(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Federation Vendor", request.Context, &map[string]string{
+		"method": "onEnrollments",
+	})
+	defer span.End()
+
+	tLog.InfoCtx(pCtx, "V (Federation): onEnrollments")
+	site := request.Parameters["__site"]
+	switch request.Method {
+	case fasthttp.MethodGet:
+		var result interface{}
+		var err error
+		if site == "" {
+			result, err = f.SitesManager.ListEnrollments(pCtx)
+		} else {
+			result, err = f.SitesManager.GetEnrollment(pCtx, site)
+		}
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := utils.FormatObject(result, site == "", request.Parameters["path"], request.Parameters["doc-type"])
+		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+		if request.Parameters["doc-type"] == "yaml" {
+			resp.ContentType = "text/plain"
+		}
+		return resp
+	case fasthttp.MethodPost:
+		if site == "" {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte("site is required"),
+			})
+		}
+		var enrollment model.SiteEnrollment
+		var err error
+		switch action := request.Parameters["action"]; action {
+		case "approve":
+			enrollment, err = f.SitesManager.ApproveEnrollment(pCtx, site, request.Parameters["fingerprint"])
+		case "revoke":
+			enrollment, err = f.SitesManager.RevokeEnrollment(pCtx, site)
+		case "delete":
+			err = f.SitesManager.DeleteEnrollment(pCtx, site)
+			if err == nil {
+				return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+					State: v1alpha2.OK,
+				})
+			}
+		default:
+			err = v1alpha2.NewCOAError(nil, fmt.Sprintf("invalid action '%s', expected 'approve', 'revoke' or 'delete'", action), v1alpha2.BadRequest)
+		}
+		if err != nil {
+			tLog.ErrorfCtx(pCtx, "V (Federation): failed to update enrollment of site %s: %v", site, err)
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, enrollmentResponse(enrollment))
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
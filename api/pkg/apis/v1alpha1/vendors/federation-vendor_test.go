@@ -3,19 +3,24 @@ package vendors
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	sym_mgr "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
 	memorygraph "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/graph/memory"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
 	mockledger "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/ledger/mock"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
 	memoryqueue "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue/memory"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/vendors"
 	"github.com/stretchr/testify/assert"
@@ -431,6 +436,282 @@ func TestFederationOnSyncGet(t *testing.T) {
 
 }
 
+func TestFederationOnAck(t *testing.T) {
+	vendor := federationVendorInit()
+	vendor.StagingManager.QueueProvider.Enqueue("ack-site", v1alpha2.JobData{
+		Id:     "job1",
+		Action: v1alpha2.JobRun,
+	})
+	response := vendor.onSync(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__site": "ack-site",
+			"count":  "10",
+			"ack":    "true",
+		},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var pack model.SyncPackage
+	err := json.Unmarshal(response.Body, &pack)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pack.Jobs))
+	assert.Equal(t, 1, len(pack.Receipts))
+
+	statusRequest := v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__name": "ack-site",
+		},
+	}
+	response = vendor.onStatus(statusRequest)
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var status model.SiteQueueStatus
+	err = json.Unmarshal(response.Body, &status)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, status.InFlight)
+
+	b, _ := json.Marshal(model.SyncAck{Receipts: pack.Receipts})
+	response = vendor.onAck(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__site": "ack-site",
+		},
+		Body: b,
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+
+	response = vendor.onStatus(statusRequest)
+	assert.Equal(t, v1alpha2.OK, response.State)
+	err = json.Unmarshal(response.Body, &status)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, status.InFlight)
+	assert.Equal(t, 0, status.Pending)
+
+	response = vendor.onAck(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__site": "ack-site",
+		},
+		Body: []byte("not json"),
+	})
+	assert.Equal(t, v1alpha2.BadRequest, response.State)
+}
+
+func TestFederationOnSyncGetTombstones(t *testing.T) {
+	vendor := federationVendorInit()
+	vendor.CatalogVersionsManager.CatalogVersionValidator = validation.NewCatalogVersionValidator(vendor.CatalogVersionsManager.CatalogVersionLookup, nil, vendor.CatalogVersionsManager.ChildCatalogVersionLookup)
+	deleted := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:          "deleted-v-version1",
+			Namespace:     "default",
+			ObjGeneration: 2,
+		},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType: "config",
+		},
+	}
+	recreated := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "recreated-v-version1",
+			Namespace: "default",
+		},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType:  "config",
+			RootResource: "recreated",
+		},
+	}
+	err := vendor.CatalogVersionsManager.UpsertState(context.Background(), recreated.ObjectMeta.Name, recreated)
+	assert.Nil(t, err)
+	for _, job := range []v1alpha2.JobData{
+		{Id: deleted.ObjectMeta.Name, Action: v1alpha2.JobDelete, Body: deleted},
+		{Id: recreated.ObjectMeta.Name, Action: v1alpha2.JobDelete, Body: recreated},
+		{Id: recreated.ObjectMeta.Name, Action: v1alpha2.JobUpdate},
+	} {
+		vendor.StagingManager.QueueProvider.Enqueue("tombstone-site", job)
+	}
+	response := vendor.onSync(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__site": "tombstone-site",
+			"count":  "10",
+			"ack":    "true",
+		},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var pack model.SyncPackage
+	err = json.Unmarshal(response.Body, &pack)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pack.Receipts))
+	assert.Equal(t, 1, len(pack.CatalogVersions))
+	assert.Equal(t, recreated.ObjectMeta.Name, pack.CatalogVersions[0].ObjectMeta.Name)
+	// the recreated catalog version isn't deleted
+	assert.Equal(t, 1, len(pack.Tombstones))
+	assert.Equal(t, model.CatalogVersionTombstone{
+		Name:        deleted.ObjectMeta.Name,
+		Namespace:   "default",
+		CatalogType: "config",
+		Generation:  2,
+	}, pack.Tombstones[0])
+}
+
+func TestFederationOnSyncLongPoll(t *testing.T) {
+	vendor := federationVendorInit()
+	sync := func(cursor string, wait string) model.SyncPackage {
+		response := vendor.onSync(v1alpha2.COARequest{
+			Method:  fasthttp.MethodGet,
+			Context: context.Background(),
+			Parameters: map[string]string{
+				"__site": "push-site",
+				"count":  "10",
+				"cursor": cursor,
+				"wait":   wait,
+			},
+		})
+		assert.Equal(t, v1alpha2.OK, response.State)
+		var pack model.SyncPackage
+		err := json.Unmarshal(response.Body, &pack)
+		assert.Nil(t, err)
+		return pack
+	}
+
+	// without a known cursor the request returns right away with the current cursor
+	pack := sync("", "1m")
+	assert.NotEqual(t, "", pack.Cursor)
+	assert.Equal(t, 0, len(pack.Jobs))
+
+	// with the current cursor the request is held until a job is queued
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		vendor.StagingManager.HandleJobEvent(context.Background(), v1alpha2.Event{
+			Metadata: map[string]string{
+				"site": "push-site",
+			},
+			Body: v1alpha2.JobData{
+				Id:     "job1",
+				Action: v1alpha2.JobRun,
+			},
+		})
+	}()
+	started := time.Now()
+	next := sync(pack.Cursor, "1m")
+	assert.Less(t, time.Since(started), 30*time.Second)
+	assert.Equal(t, 1, len(next.Jobs))
+	assert.Equal(t, "job1", next.Jobs[0].Id)
+	assert.NotEqual(t, pack.Cursor, next.Cursor)
+
+	// nothing new, the request returns empty once the wait elapses
+	last := sync(next.Cursor, "20ms")
+	assert.Equal(t, 0, len(last.Jobs))
+	assert.Equal(t, next.Cursor, last.Cursor)
+
+	response := vendor.onSync(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__site": "push-site",
+			"wait":   "soon",
+		},
+	})
+	assert.Equal(t, v1alpha2.BadRequest, response.State)
+}
+
+func TestFederationOnConflicts(t *testing.T) {
+	vendor := federationVendorInit()
+	vendor.CatalogVersionsManager.CatalogVersionValidator = validation.NewCatalogVersionValidator(vendor.CatalogVersionsManager.CatalogVersionLookup, nil, vendor.CatalogVersionsManager.ChildCatalogVersionLookup)
+	parent := model.CatalogVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "config-v-version1",
+			Namespace: "default",
+		},
+		Spec: &model.CatalogVersionSpec{
+			CatalogType: "config",
+			Properties: map[string]interface{}{
+				"foo": "parent",
+			},
+		},
+	}
+	_, err := vendor.CatalogVersionsManager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, parent)
+	assert.Nil(t, err)
+	local, err := vendor.CatalogVersionsManager.GetState(context.Background(), "hq-config-v-version1", "default")
+	assert.Nil(t, err)
+	local.Spec.Properties = map[string]interface{}{"foo": "local"}
+	err = vendor.CatalogVersionsManager.UpsertState(context.Background(), local.ObjectMeta.Name, local)
+	assert.Nil(t, err)
+
+	vendor.Context.Publish("catalogversion-conflict", v1alpha2.Event{
+		Metadata: map[string]string{
+			"name": "hq-config-v-version1",
+		},
+		Body: &model.CatalogConflict{
+			Origin:      "hq",
+			SourceName:  "config-v-version1",
+			Namespace:   "default",
+			CatalogType: "config",
+			Action:      v1alpha2.JobUpdate,
+			Policy:      model.ConflictPolicyManual,
+		},
+	})
+	siteId := vendor.Context.SiteInfo.SiteId
+	for i := 0; i < 50; i++ {
+		site, err := vendor.SitesManager.GetState(context.Background(), siteId)
+		assert.Nil(t, err)
+		if len(site.Status.CatalogConflicts) == 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	site, err := vendor.SitesManager.GetState(context.Background(), siteId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(site.Status.CatalogConflicts))
+
+	response := vendor.onConflicts(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__name":     "hq-config-v-version1",
+			"resolution": "newest",
+		},
+	})
+	assert.Equal(t, v1alpha2.BadRequest, response.State)
+
+	response = vendor.onConflicts(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__name":     "hq-other",
+			"resolution": "child",
+		},
+	})
+	assert.Equal(t, v1alpha2.NotFound, response.State)
+
+	response = vendor.onConflicts(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+		Parameters: map[string]string{
+			"__name":     "hq-config-v-version1",
+			"resolution": "child",
+		},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	site, err = vendor.SitesManager.GetState(context.Background(), siteId)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(site.Status.CatalogConflicts))
+
+	// the local copy takes updates from the parent again
+	parent.Spec.Properties = map[string]interface{}{"foo": "parent2"}
+	conflict, err := vendor.CatalogVersionsManager.ApplySyncedState(context.Background(), "hq", v1alpha2.JobUpdate, parent)
+	assert.Nil(t, err)
+	assert.Nil(t, conflict)
+	local, err = vendor.CatalogVersionsManager.GetState(context.Background(), "hq-config-v-version1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "parent2", local.Spec.Properties["foo"])
+}
+
 // Commented due to race
 // func TestFederationOnTrail(t *testing.T) {
 // 	vendor := federationVendorInit()
@@ -511,3 +792,325 @@ func TestFederationOnK8SHook(t *testing.T) {
 	response = vendor.onK8sHook(*requestPatch)
 	assert.Equal(t, v1alpha2.MethodNotAllowed, response.State)
 }
+
+func TestFederationSiteEnrollment(t *testing.T) {
+	vendor := federationVendorInit()
+	issuer := &ca.CACertProvider{}
+	err := issuer.Init(ca.CACertProviderConfig{Name: "ca"})
+	assert.Nil(t, err)
+	enrollmentProvider := &memorystate.MemoryStateProvider{}
+	enrollmentProvider.Init(memorystate.MemoryStateProviderConfig{})
+	err = vendor.SitesManager.Init(vendor.Context, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "StateProvider",
+			"providers.certs":           "ca",
+			"providers.enrollmentstate": "EnrollmentStateProvider",
+			"enrollment.required":       "true",
+		},
+	}, map[string]providers.IProvider{
+		"StateProvider":           vendor.SitesManager.StateProvider,
+		"EnrollmentStateProvider": enrollmentProvider,
+		"ca":                      issuer,
+	})
+	assert.Nil(t, err)
+
+	keyPEM, err := utils.GenerateSiteKey()
+	assert.Nil(t, err)
+	csr, err := utils.CreateSiteCSR("child1", keyPEM)
+	assert.Nil(t, err)
+	b, _ := json.Marshal(model.SiteEnrollmentRequest{Site: "child1", CSR: string(csr)})
+	response := vendor.onEnroll(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+		Body:    b,
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var enrollment model.SiteEnrollment
+	err = json.Unmarshal(response.Body, &enrollment)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentPending, enrollment.State)
+
+	response = vendor.onEnrollments(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": ""},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var enrollments []model.SiteEnrollment
+	err = json.Unmarshal(response.Body, &enrollments)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(enrollments))
+
+	response = vendor.onEnrollments(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": "child1", "action": "approve", "fingerprint": enrollment.Fingerprint},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+
+	response = vendor.onEnroll(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": "child1"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	err = json.Unmarshal(response.Body, &enrollment)
+	assert.Nil(t, err)
+	assert.Equal(t, model.SiteEnrollmentApproved, enrollment.State)
+	assert.Equal(t, "", enrollment.CSR)
+
+	// sync requests must be signed by the site they're for
+	syncRequest := func(site string, signed bool) v1alpha2.COARequest {
+		request := v1alpha2.COARequest{
+			Method:     fasthttp.MethodGet,
+			Route:      "/v1alpha2/federation/sync/" + site,
+			Context:    context.Background(),
+			Parameters: map[string]string{"__site": site},
+		}
+		if signed {
+			identity := &utils.SiteIdentity{}
+			err := identity.Load("child1", keyPEM, []byte(enrollment.Certificate))
+			assert.Nil(t, err)
+			req, _ := http.NewRequest(request.Method, "http://parent"+request.Route, nil)
+			err = identity.Sign(req, nil, time.Now())
+			assert.Nil(t, err)
+			request.Metadata = map[string]string{}
+			for _, h := range v1alpha2.SiteAuthHeaders {
+				request.Metadata[h] = req.Header.Get(h)
+			}
+		}
+		return request
+	}
+	response = vendor.onSync(syncRequest("child1", false))
+	assert.Equal(t, v1alpha2.Unauthorized, response.State)
+	response = vendor.onSync(syncRequest("child1", true))
+	assert.Equal(t, v1alpha2.OK, response.State)
+	response = vendor.onSync(syncRequest("child2", true))
+	assert.Equal(t, v1alpha2.Forbidden, response.State)
+
+	response = vendor.onEnrollments(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": "child1", "action": "revoke"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	response = vendor.onSync(syncRequest("child1", true))
+	assert.Equal(t, v1alpha2.Unauthorized, response.State)
+
+	response = vendor.onEnrollments(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": "child1", "action": "suspend"},
+	})
+	assert.Equal(t, v1alpha2.BadRequest, response.State)
+}
+
+func TestFederationSyncSkippedAuthentication(t *testing.T) {
+	vendor := federationVendorInit()
+	request := v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Route:      "/v1alpha2/federation/sync/child1",
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": "child1"},
+		Metadata:   map[string]string{v1alpha2.AuthenticatedUser: "operator"},
+	}
+	response := vendor.onSync(request)
+	assert.Equal(t, v1alpha2.OK, response.State)
+
+	// requests the JWT middleware let through without a token must be signed by a site
+	request.Metadata = map[string]string{v1alpha2.AuthenticationSkipped: "true"}
+	response = vendor.onSync(request)
+	assert.Equal(t, v1alpha2.Unauthorized, response.State)
+	response = vendor.onAck(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__site": "child1"},
+		Metadata:   map[string]string{v1alpha2.AuthenticationSkipped: "true"},
+		Body:       []byte("{}"),
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, response.State)
+	response = vendor.onStatus(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__name": "child1"},
+		Metadata:   map[string]string{v1alpha2.AuthenticationSkipped: "true"},
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, response.State)
+}
+
+func TestFederationRelayTopology(t *testing.T) {
+	vendor := federationVendorInit()
+	ctx := context.Background()
+	relayed := make(chan model.StageStatus, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.URL.Path {
+		case "/federation/sync":
+			var status model.StageStatus
+			json.NewDecoder(r.Body).Decode(&status)
+			relayed <- status
+		case "/users/auth":
+			response = utils.AuthResponse{AccessToken: "test-token", TokenType: "Bearer"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+	var err error
+	vendor.apiClient, err = utils.GetParentApiClient(ts.URL)
+	assert.Nil(t, err)
+
+	// a site registered without a parent syncs with this site
+	b, _ := json.Marshal(model.SiteState{Id: "relay1", Spec: &model.SiteSpec{Name: "relay1"}})
+	response := vendor.onRegistry(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    ctx,
+		Parameters: map[string]string{"__name": "relay1"},
+		Body:       b,
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+
+	// the relay reports the status of the sites below it
+	b, _ = json.Marshal(model.SiteState{
+		Id:     "leaf1",
+		Spec:   &model.SiteSpec{Name: "leaf1", Parent: "relay1"},
+		Status: &model.SiteStatus{IsOnline: true},
+	})
+	response = vendor.onStatus(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Context:    ctx,
+		Parameters: map[string]string{"__name": "leaf1"},
+		Body:       b,
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+
+	response = vendor.onRegistry(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    ctx,
+		Parameters: map[string]string{"view": "tree"},
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var tree model.SiteTreeNode
+	err = json.Unmarshal(response.Body, &tree)
+	assert.Nil(t, err)
+	assert.Equal(t, "exampleSiteId", tree.Site.Id)
+	assert.Equal(t, 1, len(tree.Children))
+	assert.Equal(t, "relay1", tree.Children[0].Site.Id)
+	assert.Equal(t, 1, len(tree.Children[0].Children))
+	assert.Equal(t, "leaf1", tree.Children[0].Children[0].Site.Id)
+
+	nextHop, err := vendor.SitesManager.NextHop(ctx, "leaf1")
+	assert.Nil(t, err)
+	assert.Equal(t, "relay1", nextHop)
+
+	// the status of a job relayed by this site goes on to the site that runs the campaign
+	b, _ = json.Marshal(model.StageStatus{
+		Stage:   "stage1",
+		Status:  v1alpha2.Done,
+		Outputs: map[string]interface{}{"__originSite": "root", "__site": "leaf1"},
+	})
+	response = vendor.onSync(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: ctx,
+		Body:    b,
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	select {
+	case status := <-relayed:
+		assert.Equal(t, "stage1", status.Stage)
+		assert.Equal(t, "leaf1", status.Outputs["__site"])
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "job status wasn't relayed")
+	}
+}
+
+func TestFederationOfflineSite(t *testing.T) {
+	vendor := federationVendorInit()
+	ctx := context.Background()
+	reports := make(chan model.StageStatus, 2)
+	vendor.Context.Subscribe("job-report", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			reports <- event.Body.(model.StageStatus)
+			return nil
+		},
+	})
+
+	// site1 stopped reporting an hour ago, and its jobs expire while it's offline
+	_, err := vendor.SitesManager.StateProvider.Upsert(ctx, states.UpsertRequest{
+		Value: states.StateEntry{
+			ID: "site1",
+			Body: model.SiteState{
+				Id: "site1",
+				Spec: &model.SiteSpec{
+					Name:      "site1",
+					Heartbeat: &model.SiteHeartbeatSpec{OfflineJobs: model.OfflineJobsExpire},
+				},
+				Status: &model.SiteStatus{
+					IsOnline:     true,
+					LastReported: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+				},
+			},
+		},
+		Metadata: map[string]interface{}{
+			"version":  "v1",
+			"group":    model.FederationGroup,
+			"resource": "sites",
+		},
+	})
+	assert.Nil(t, err)
+	job := v1alpha2.JobData{
+		Action: v1alpha2.JobRun,
+		Body: v1alpha2.InputOutputData{
+			Inputs: map[string]interface{}{
+				"__activation":      "activation1",
+				"__campaignversion": "campaign1:v1",
+				"__namespace":       "default",
+				"__stage":           "stage1",
+				"__site":            "site1",
+			},
+		},
+	}
+	err = vendor.StagingManager.QueueProvider.Enqueue("site1", job)
+	assert.Nil(t, err)
+
+	err = vendor.SitesManager.CheckHealth(ctx)
+	assert.Nil(t, err)
+	select {
+	case status := <-reports:
+		assert.Equal(t, v1alpha2.InternalError, status.Status)
+		assert.Equal(t, "activation1", status.Outputs["__activation"])
+		assert.Equal(t, "site1", status.Outputs["__site"])
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expired job wasn't reported")
+	}
+	assert.Equal(t, 0, vendor.StagingManager.QueueProvider.Size("site1"))
+
+	// jobs for the offline site expire right away
+	err = vendor.Context.Publish("remote", v1alpha2.Event{
+		Metadata: map[string]string{"site": "site1", "objectType": "task"},
+		Body:     job,
+	})
+	assert.Nil(t, err)
+	select {
+	case status := <-reports:
+		assert.Equal(t, "stage1", status.Outputs["__stage"])
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "expired job wasn't reported")
+	}
+	assert.Equal(t, 0, vendor.StagingManager.QueueProvider.Size("site1"))
+
+	response := vendor.onHealth(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: ctx,
+	})
+	assert.Equal(t, v1alpha2.OK, response.State)
+	var health model.FleetHealth
+	err = json.Unmarshal(response.Body, &health)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, health.Sites[model.SiteOffline])
+
+	response = vendor.onHealth(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: ctx,
+	})
+	assert.Equal(t, v1alpha2.MethodNotAllowed, response.State)
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package vendors
+
+import (
+	"encoding/json"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/impact"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/vendors"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"github.com/valyala/fasthttp"
+)
+
+var imLog = logger.NewLogger("coa.runtime")
+
+type ImpactVendor struct {
+	vendors.Vendor
+	ImpactManager *impact.ImpactManager
+}
+
+func (o *ImpactVendor) GetInfo() vendors.VendorInfo {
+	return vendors.VendorInfo{
+		Version:  o.Vendor.Version,
+		Name:     "Impact",
+		Producer: "Microsoft",
+	}
+}
+
+func (e *ImpactVendor) Init(config vendors.VendorConfig, factories []managers.IManagerFactroy, providers map[string]map[string]providers.IProvider, pubsubProvider pubsub.IPubSubProvider) error {
+	err := e.Vendor.Init(config, factories, providers, pubsubProvider)
+	if err != nil {
+		return err
+	}
+	for _, m := range e.Managers {
+		if c, ok := m.(*impact.ImpactManager); ok {
+			e.ImpactManager = c
+		}
+	}
+	if e.ImpactManager == nil {
+		return v1alpha2.NewCOAError(nil, "impact manager is not supplied", v1alpha2.MissingConfig)
+	}
+	return nil
+}
+
+func (o *ImpactVendor) GetEndpoints() []v1alpha2.Endpoint {
+	route := "impact"
+	if o.Route != "" {
+		route = o.Route
+	}
+	return []v1alpha2.Endpoint{
+		{
+			Methods: []string{fasthttp.MethodGet},
+			Route:   route + "/graph",
+			Version: o.Version,
+			Handler: o.onGraph,
+		},
+		{
+			Methods:    []string{fasthttp.MethodGet},
+			Route:      route + "/dependents",
+			Version:    o.Version,
+			Handler:    o.onDependents,
+			Parameters: []string{"kind", "name"},
+		},
+		{
+			Methods:    []string{fasthttp.MethodGet},
+			Route:      route + "/dependencies",
+			Version:    o.Version,
+			Handler:    o.onDependencies,
+			Parameters: []string{"kind", "name"},
+		},
+	}
+}
+
+func (c *ImpactVendor) onGraph(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Impact Vendor", request.Context, &map[string]string{
+		"method": "onGraph",
+	})
+	defer span.End()
+	imLog.DebugfCtx(pCtx, "V (Impact): onGraph, method: %s", request.Method)
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onGraph-GET", pCtx, nil)
+		graph, err := c.ImpactManager.GetGraph(ctx, request.Parameters["namespace"])
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := json.Marshal(graph)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+
+func (c *ImpactVendor) onDependents(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Impact Vendor", request.Context, &map[string]string{
+		"method": "onDependents",
+	})
+	defer span.End()
+	imLog.DebugfCtx(pCtx, "V (Impact): onDependents, method: %s", request.Method)
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onDependents-GET", pCtx, nil)
+		report, err := c.ImpactManager.GetImpact(ctx, request.Parameters["__kind"], request.Parameters["__name"], request.Parameters["namespace"])
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := json.Marshal(report)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+
+func (c *ImpactVendor) onDependencies(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Impact Vendor", request.Context, &map[string]string{
+		"method": "onDependencies",
+	})
+	defer span.End()
+	imLog.DebugfCtx(pCtx, "V (Impact): onDependencies, method: %s", request.Method)
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onDependencies-GET", pCtx, nil)
+		dependencies, err := c.ImpactManager.GetDependencies(ctx, request.Parameters["__kind"], request.Parameters["__name"], request.Parameters["namespace"])
+		if err != nil {
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := json.Marshal(dependencies)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+	}
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
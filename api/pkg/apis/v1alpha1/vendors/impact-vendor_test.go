@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package vendors
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	sym_mgr "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/vendors"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func createImpactVendor() ImpactVendor {
+	stateProvider := memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	vendor := ImpactVendor{}
+	vendor.Init(vendors.VendorConfig{
+		Properties: map[string]string{
+			"test": "true",
+		},
+		Managers: []managers.ManagerConfig{
+			{
+				Name: "impact-manager",
+				Type: "managers.symphony.impact",
+				Properties: map[string]string{
+					"providers.persistentstate": "mem-state",
+				},
+				Providers: map[string]managers.ProviderConfig{
+					"mem-state": {
+						Type:   "providers.state.memory",
+						Config: memorystate.MemoryStateProviderConfig{},
+					},
+				},
+			},
+		},
+	}, []managers.IManagerFactroy{
+		&sym_mgr.SymphonyManagerFactory{},
+	}, map[string]map[string]providers.IProvider{
+		"impact-manager": {
+			"mem-state": &stateProvider,
+		},
+	}, nil)
+	return vendor
+}
+
+func upsertImpactObject(vendor ImpactVendor, kind string, name string, spec map[string]interface{}) {
+	vendor.ImpactManager.StateProvider.Upsert(context.Background(), states.UpsertRequest{
+		Value: states.StateEntry{
+			ID: name,
+			Body: map[string]interface{}{
+				"kind":     kind,
+				"metadata": map[string]interface{}{"name": name, "namespace": "default"},
+				"spec":     spec,
+			},
+		},
+		Metadata: map[string]interface{}{"namespace": "default"},
+	})
+}
+
+func TestImpactVendorInit(t *testing.T) {
+	vendor := createImpactVendor()
+	assert.NotNil(t, vendor.ImpactManager)
+	assert.Equal(t, "Impact", vendor.GetInfo().Name)
+	assert.Equal(t, 3, len(vendor.GetEndpoints()))
+}
+
+func TestImpactVendorDependents(t *testing.T) {
+	vendor := createImpactVendor()
+	upsertImpactObject(vendor, "Target", "edge", map[string]interface{}{})
+	upsertImpactObject(vendor, "Instance", "app", map[string]interface{}{
+		"solutionversion": "app:v1",
+		"target":          map[string]interface{}{"name": "edge"},
+	})
+
+	resp := vendor.onDependents(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__kind": "target", "__name": "edge"},
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+	var report model.ImpactReport
+	err := json.Unmarshal(resp.Body, &report)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(report.Affected))
+	assert.Equal(t, "app", report.Affected[0].Name)
+	assert.Equal(t, model.RelationTarget, report.Affected[0].Relation)
+
+	resp = vendor.onDependencies(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__kind": "instance", "__name": "app"},
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+	var dependencies []model.Dependency
+	err = json.Unmarshal(resp.Body, &dependencies)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(dependencies))
+
+	resp = vendor.onGraph(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+
+	resp = vendor.onDependents(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Context:    context.Background(),
+		Parameters: map[string]string{"__kind": "target", "__name": "cloud"},
+	})
+	assert.Equal(t, v1alpha2.NotFound, resp.State)
+
+	resp = vendor.onDependents(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.MethodNotAllowed, resp.State)
+}
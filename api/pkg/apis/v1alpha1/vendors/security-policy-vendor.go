@@ -32,7 +32,11 @@ import (
 //	  "route": "security-policy",
 //	  "properties": {
 //	    "allowedIPRanges": "[\"10.0.5.0/24\",\"192.168.1.100\"]",
-//	    "allowListExclusive": "true"
+//	    "allowListExclusive": "true",
+//	    "allowedImages": "[\"myregistry.azurecr.io/steps/*\"]",
+//	    "maxContainerCPU": "2",
+//	    "maxContainerMemory": "1Gi",
+//	    "maxContainerTimeout": "30m"
 //	  }
 //	}
 type SecurityPolicyVendor struct {
@@ -77,6 +81,18 @@ func (v *SecurityPolicyVendor) Init(cfg vendors.VendorConfig, factories []manage
 		}
 	}
 
+	// Parse allowedImages: a JSON array string of image patterns, e.g. "[\"docker.io/library/*\"]".
+	if raw, ok := cfg.Properties["allowedImages"]; ok && raw != "" {
+		var images []string
+		if err := json.Unmarshal([]byte(raw), &images); err != nil {
+			return v1alpha2.NewCOAError(err, "invalid allowedImages in security policy vendor config", v1alpha2.BadConfig)
+		}
+		v.policy.AllowedImages = images
+	}
+	v.policy.MaxContainerCPU = cfg.Properties["maxContainerCPU"]
+	v.policy.MaxContainerMemory = cfg.Properties["maxContainerMemory"]
+	v.policy.MaxContainerTimeout = cfg.Properties["maxContainerTimeout"]
+
 	return nil
 }
 
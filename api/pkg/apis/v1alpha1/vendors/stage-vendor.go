@@ -210,6 +210,13 @@ func (s *StageVendor) Init(config vendors.VendorConfig, factories []managers.IMa
 						Context: ctx,
 					})
 				}
+				if stage.IsCampaignFailed(status) {
+					err = s.compensate(ctx, *campaignversion.Spec, triggerData)
+					if err != nil {
+						sLog.ErrorfCtx(ctx, "V (Stage): failed to compensate activation %s: %v", triggerData.Activation, err)
+						return err
+					}
+				}
 			}
 			log.InfoCtx(ctx, "V (Stage): Finished handling trigger event")
 			return nil
@@ -270,6 +277,25 @@ func (s *StageVendor) Init(config vendors.VendorConfig, factories []managers.IMa
 						})
 					}
 				}
+			} else if stage.IsCampaignFailed(status) {
+				campaignversionName := api_utils.ConvertReferenceToObjectName(campaignversion)
+				campaignversionState, err := s.CampaignVersionsManager.GetState(ctx, campaignversionName, namespace)
+				if err != nil {
+					sLog.ErrorfCtx(ctx, "V (Stage): failed to get campaignversion spec '%s': %v", campaignversion, err)
+					return err
+				}
+				activationGeneration, _ := status.Outputs["__activationGeneration"].(string)
+				err = s.compensate(ctx, *campaignversionState.Spec, v1alpha2.ActivationData{
+					CampaignVersion:      campaignversion,
+					Activation:           activation,
+					ActivationGeneration: activationGeneration,
+					Stage:                status.Stage,
+					Namespace:            namespace,
+				})
+				if err != nil {
+					sLog.ErrorfCtx(ctx, "V (Stage): failed to compensate activation %s: %v", activation, err)
+					return err
+				}
 			}
 
 			return nil
@@ -338,6 +364,10 @@ func (s *StageVendor) Init(config vendors.VendorConfig, factories []managers.IMa
 				return v1alpha2.NewCOAError(nil, fmt.Sprintf("operation %v is not supported", dataPackage.Inputs["operation"]), v1alpha2.BadRequest)
 			}
 			status := s.StageManager.HandleDirectTriggerEvent(ctx, triggerData)
+			if originSite, ok := dataPackage.Inputs["__originSite"]; ok {
+				// relay sites forward the status towards the site that runs the campaign
+				status.Outputs["__originSite"] = originSite
+			}
 			sLog.DebugfCtx(ctx, "V (Stage): reporting status: %v", status)
 			s.Vendor.Context.Publish("report", v1alpha2.Event{
 				Body:    status,
@@ -365,3 +395,21 @@ func (s *StageVendor) reportActivationStatusWithBadRequest(activation string, na
 	}
 	return err
 }
+
+// compensate runs the compensation stages of the stages that succeeded before
+// the activation failed and records their results in the stage history
+func (s *StageVendor) compensate(ctx context.Context, campaignversion model.CampaignVersionSpec, triggerData v1alpha2.ActivationData) error {
+	activationState, err := s.ActivationsManager.GetState(ctx, triggerData.Activation, triggerData.Namespace)
+	if err != nil {
+		return err
+	}
+	if activationState.Status == nil {
+		return nil
+	}
+	if triggerData.Inputs == nil && activationState.Spec != nil {
+		triggerData.Inputs = activationState.Spec.Inputs
+	}
+	return s.StageManager.HandleCompensation(ctx, campaignversion, triggerData, activationState.Status.StageHistory, func(status model.StageStatus) error {
+		return s.ActivationsManager.ReportStageStatus(ctx, triggerData.Activation, triggerData.Namespace, status)
+	})
+}
@@ -7,13 +7,18 @@
 package vendors
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	sym_mgr "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	coa_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/vendors"
 	"github.com/stretchr/testify/assert"
 )
@@ -32,6 +37,70 @@ func TestStageInfo(t *testing.T) {
 	assert.NotNil(t, info)
 	assert.Equal(t, "1.0", info.Version)
 }
+func TestStageJobReportCompensation(t *testing.T) {
+	vendor := createStageVendor()
+	vendor.Context.EvaluationContext = &coa_utils.EvaluationContext{}
+	ctx := context.Background()
+	err := vendor.CampaignVersionsManager.UpsertState(ctx, "test-campaign-v-v1", model.CampaignVersionState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "test-campaign-v-v1",
+			Namespace: "default",
+		},
+		Spec: &model.CampaignVersionSpec{
+			RootResource: "test-campaign",
+			FirstStage:   "a",
+			Stages: map[string]model.StageSpec{
+				"a":      {Name: "a", Provider: "providers.stage.mock", StageSelector: "b", Compensation: "undo-a"},
+				"b":      {Name: "b", Provider: "providers.stage.remote"},
+				"undo-a": {Name: "undo-a", Provider: "providers.stage.mock"},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	err = vendor.ActivationsManager.UpsertState(ctx, "test-activation", model.ActivationState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "test-activation",
+			Namespace: "default",
+		},
+		Spec: &model.ActivationSpec{
+			CampaignVersion: "test-campaign:v1",
+		},
+	})
+	assert.Nil(t, err)
+	err = vendor.ActivationsManager.ReportStageStatus(ctx, "test-activation", "default", model.StageStatus{
+		Stage:     "a",
+		NextStage: "b",
+		Status:    v1alpha2.Done,
+	})
+	assert.Nil(t, err)
+
+	// a remote stage that fails compensates the stages that succeeded before it
+	err = vendor.Context.Publish("job-report", v1alpha2.Event{
+		Body: model.StageStatus{
+			Stage:  "b",
+			Status: v1alpha2.InternalError,
+			Outputs: map[string]interface{}{
+				"__campaignversion": "test-campaign:v1",
+				"__activation":      "test-activation",
+				"__namespace":       "default",
+			},
+			ErrorMessage: "remote stage failed",
+		},
+		Context: ctx,
+	})
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		state, err := vendor.ActivationsManager.GetState(ctx, "test-activation", "default")
+		return err == nil && state.Status != nil && len(state.Status.StageHistory) == 3
+	}, 10*time.Second, 100*time.Millisecond)
+	state, err := vendor.ActivationsManager.GetState(ctx, "test-activation", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "undo-a", state.Status.StageHistory[2].Stage)
+	assert.Equal(t, "a", state.Status.StageHistory[2].CompensatedStage)
+	assert.Equal(t, v1alpha2.Done, state.Status.StageHistory[2].Status)
+}
+
 func createStageVendor() StageVendor {
 	stateProvider := memorystate.MemoryStateProvider{}
 	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
@@ -48,6 +117,7 @@ func createStageVendor() StageVendor {
 				Type: "managers.symphony.stage",
 				Properties: map[string]string{
 					"providers.persistentstate": "mem-state",
+					"providers.volatilestate":   "mem-state",
 				},
 				Providers: map[string]managers.ProviderConfig{
 					"mem-state": {
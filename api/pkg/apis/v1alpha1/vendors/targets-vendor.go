@@ -7,15 +7,21 @@
 package vendors
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/eclipse-symphony/symphony/api/constants"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/sites"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/targets"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/remoteagent"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	wsbinding "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/websocket"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
 	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
@@ -34,6 +40,11 @@ var tLog = logger.NewLogger("coa.runtime")
 type TargetsVendor struct {
 	vendors.Vendor
 	TargetsManager *targets.TargetsManager
+	// SitesManager authenticates remote agents with the site certificates it issues
+	SitesManager *sites.SitesManager
+	// AgentHub keeps the connections of remote agents, default is the hub of the remote agent target providers
+	AgentHub              *remoteagent.Hub
+	agentHeartbeatSeconds int
 }
 
 func (o *TargetsVendor) GetInfo() vendors.VendorInfo {
@@ -53,10 +64,28 @@ func (e *TargetsVendor) Init(config vendors.VendorConfig, factories []managers.I
 		if c, ok := m.(*targets.TargetsManager); ok {
 			e.TargetsManager = c
 		}
+		if c, ok := m.(*sites.SitesManager); ok {
+			e.SitesManager = c
+		}
 	}
 	if e.TargetsManager == nil {
 		return v1alpha2.NewCOAError(nil, "targets manager is not supplied", v1alpha2.MissingConfig)
 	}
+	if e.AgentHub == nil {
+		e.AgentHub = remoteagent.DefaultHub
+	}
+	if v, ok := e.Config.Properties["agentHeartbeatSeconds"]; ok {
+		if e.agentHeartbeatSeconds, err = strconv.Atoi(v); err != nil {
+			return v1alpha2.NewCOAError(err, fmt.Sprintf("invalid agentHeartbeatSeconds '%s'", v), v1alpha2.BadConfig)
+		}
+	}
+	if v, ok := e.Config.Properties["agentQueueSize"]; ok {
+		queueSize, err := strconv.Atoi(v)
+		if err != nil {
+			return v1alpha2.NewCOAError(err, fmt.Sprintf("invalid agentQueueSize '%s'", v), v1alpha2.BadConfig)
+		}
+		e.AgentHub.SetQueueSize(queueSize)
+	}
 	return nil
 }
 
@@ -100,6 +129,13 @@ func (o *TargetsVendor) GetEndpoints() []v1alpha2.Endpoint {
 			Handler:    o.onDownload,
 			Parameters: []string{"doc-type", "name"},
 		},
+		{
+			Methods:    []string{fasthttp.MethodGet},
+			Route:      route + "/connect",
+			Version:    o.Version,
+			Handler:    o.onConnect,
+			Parameters: []string{"name"},
+		},
 	}
 }
 
@@ -503,3 +539,227 @@ func (c *TargetsVendor) onHeartBeat(request v1alpha2.COARequest) v1alpha2.COARes
 	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
 	return resp
 }
+
+// onConnect upgrades the connection of a remote agent to a websocket, over which the agent registers its
+// target and answers the requests of remote agent target providers
+func (c *TargetsVendor) onConnect(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("Targets Vendor", request.Context, &map[string]string{
+		"method": "onConnect",
+	})
+	defer span.End()
+	tLog.InfofCtx(pCtx, "V (Targets) : onConnect, method: %s", request.Method)
+
+	if request.Method != fasthttp.MethodGet {
+		tLog.ErrorCtx(pCtx, "V (Targets) : onConnect failed - method not allowed")
+		resp := v1alpha2.COAResponse{
+			State:       v1alpha2.MethodNotAllowed,
+			Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+			ContentType: "application/json",
+		}
+		observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+		return resp
+	}
+	namespace, exist := request.Parameters["namespace"]
+	if !exist {
+		namespace = constants.DefaultScope
+	}
+	name := request.Parameters["__name"]
+	reqCtx, ok := request.Context.Value(v1alpha2.COAFastHTTPContextKey).(*fasthttp.RequestCtx)
+	if !ok {
+		tLog.ErrorCtx(pCtx, "V (Targets) : onConnect failed - not an HTTP request")
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.BadRequest,
+			Body:  []byte("remote agents connect over HTTP"),
+		})
+	}
+	identity, err := c.authenticateAgent(pCtx, request)
+	if err != nil {
+		tLog.ErrorfCtx(pCtx, "V (Targets) : onConnect failed to authenticate the agent of %s - %s", name, err.Error())
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.GetErrorState(err),
+			Body:  []byte(err.Error()),
+		})
+	}
+	err = wsbinding.Upgrade(reqCtx, c.agentHeartbeatSeconds, func(conn *wsbinding.Conn) {
+		c.serveAgent(namespace, name, identity, conn)
+	})
+	if err != nil {
+		tLog.ErrorfCtx(pCtx, "V (Targets) : onConnect failed - %s", err.Error())
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.GetErrorState(err),
+			Body:  []byte(err.Error()),
+		})
+	}
+	return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+		State: v1alpha2.OK,
+	})
+}
+
+// authenticateAgent returns the identity of a remote agent, which is the site its client certificate or
+// request signature is issued to. The JWT pipeline only tells that the agent may call the API, the identity
+// tells which targets it may serve.
+func (c *TargetsVendor) authenticateAgent(ctx context.Context, request v1alpha2.COARequest) (string, error) {
+	if c.SitesManager == nil {
+		return "", v1alpha2.NewCOAError(nil, "remote agents are authenticated by the sites manager, which is not supplied", v1alpha2.MissingConfig)
+	}
+	identity, err := c.SitesManager.AuthenticateSite(ctx, siteCredentials(request))
+	if err != nil {
+		return "", err
+	}
+	if identity == "" {
+		return "", v1alpha2.NewCOAError(nil, "remote agents must authenticate with a site certificate or signature", v1alpha2.Unauthorized)
+	}
+	return identity, nil
+}
+
+// serveAgent registers the target of a remote agent, and serves the agent until it disconnects
+func (c *TargetsVendor) serveAgent(namespace string, name string, identity string, conn *wsbinding.Conn) {
+	ctx, span := observability.StartSpan("Targets Vendor", context.Background(), &map[string]string{
+		"method": "serveAgent",
+	})
+	var err error
+	defer observ_utils.CloseSpanWithError(span, &err)
+
+	message, err := conn.Receive()
+	if err != nil {
+		tLog.ErrorfCtx(ctx, "V (Targets) : serveAgent failed to read the registration of %s - %s", name, err.Error())
+		return
+	}
+	err = c.registerAgent(ctx, namespace, name, identity, message)
+	if err != nil {
+		tLog.ErrorfCtx(ctx, "V (Targets) : serveAgent failed to register %s - %s", name, err.Error())
+		conn.Send(wsbinding.Message{Type: wsbinding.MessageError, Error: err.Error()})
+		return
+	}
+	c.reportAgentState(ctx, namespace, name, "connected", message.Registration.Properties)
+	c.AgentHub.Serve(namespace, name, conn)
+	c.reportAgentState(ctx, namespace, name, "disconnected", nil)
+}
+
+// registerAgent checks the registration of a remote agent. An agent that registers with a target spec
+// creates its target with a single remote agent binding for its identity, and updates only the targets it created.
+// Other agents connect to existing targets whose remote agent binding names their identity.
+func (c *TargetsVendor) registerAgent(ctx context.Context, namespace string, name string, identity string, message wsbinding.Message) error {
+	if message.Type != wsbinding.MessageRegister || message.Registration == nil {
+		return v1alpha2.NewCOAError(nil, "expected a registration", v1alpha2.BadRequest)
+	}
+	registration := message.Registration
+	if registration.Target != name || (registration.Namespace != "" && registration.Namespace != namespace) {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("registration of %s doesn't match the connection of %s", registration.Target, name), v1alpha2.BadRequest)
+	}
+	existing, err := c.TargetsManager.GetState(ctx, name, namespace)
+	if err != nil && (len(registration.Spec) == 0 || !utils.IsNotFound(err)) {
+		return err
+	}
+	if len(registration.Spec) == 0 {
+		if !agentIdentities(existing)[identity] {
+			return v1alpha2.NewCOAError(nil, fmt.Sprintf("target %s isn't bound to the agent identity %s", name, identity), v1alpha2.Forbidden)
+		}
+		return nil
+	}
+	if err == nil && existing.ObjectMeta.Annotations[remoteagent.CreatedByAnnotation] != identity {
+		return v1alpha2.NewCOAError(nil, fmt.Sprintf("target %s wasn't registered by the agent identity %s", name, identity), v1alpha2.Forbidden)
+	}
+
+	var target model.TargetState
+	if err := utils2.UnmarshalJson(registration.Spec, &target); err != nil {
+		return v1alpha2.NewCOAError(err, "invalid target spec", v1alpha2.BadRequest)
+	}
+	target.ObjectMeta.Name = name
+	target.ObjectMeta.Namespace = namespace
+	target.ObjectMeta.UpdateAnnotation(remoteagent.CreatedByAnnotation, identity)
+	if target.Spec == nil {
+		target.Spec = &model.TargetSpec{}
+	}
+	// the providers of a target run on the control plane, so an agent can only bind its target to itself
+	found := false
+	for t := range target.Spec.Topologies {
+		for n := range target.Spec.Topologies[t].Bindings {
+			b := &target.Spec.Topologies[t].Bindings[n]
+			if b.Provider != "providers.target.remoteagent" || found {
+				return v1alpha2.NewCOAError(nil, fmt.Sprintf("target %s of a remote agent can only have a single providers.target.remoteagent binding", name), v1alpha2.Forbidden)
+			}
+			// the requests of the target go to the agent of the connection
+			config := map[string]string{
+				"targetName":                 name,
+				remoteagent.AgentIdentityKey: identity,
+			}
+			if v, ok := b.Config["timeoutSeconds"]; ok {
+				config["timeoutSeconds"] = v
+			}
+			b.Config = config
+			found = true
+		}
+	}
+	if !found {
+		if len(target.Spec.Topologies) == 0 {
+			target.Spec.Topologies = append(target.Spec.Topologies, model.TopologySpec{})
+		}
+		last := len(target.Spec.Topologies) - 1
+		target.Spec.Topologies[last].Bindings = append(target.Spec.Topologies[last].Bindings, model.BindingSpec{
+			Role:     "instance",
+			Provider: "providers.target.remoteagent",
+			Config: map[string]string{
+				"targetName":                 name,
+				remoteagent.AgentIdentityKey: identity,
+			},
+		})
+	}
+	if err := c.TargetsManager.UpsertState(ctx, name, target); err != nil {
+		return err
+	}
+	if c.Config.Properties["useJobManager"] == "true" {
+		c.Context.Publish("job", v1alpha2.Event{
+			Metadata: map[string]string{
+				"objectType": "target",
+				"namespace":  namespace,
+			},
+			Body: v1alpha2.JobData{
+				Id:     name,
+				Action: v1alpha2.JobUpdate,
+				Scope:  namespace,
+			},
+			Context: ctx,
+		})
+	}
+	return nil
+}
+
+// agentIdentities returns the identities the remote agent bindings of a target are bound to
+func agentIdentities(target model.TargetState) map[string]bool {
+	ret := map[string]bool{}
+	if target.Spec == nil {
+		return ret
+	}
+	for _, t := range target.Spec.Topologies {
+		for _, b := range t.Bindings {
+			if b.Provider == "providers.target.remoteagent" && b.Config[remoteagent.AgentIdentityKey] != "" {
+				ret[b.Config[remoteagent.AgentIdentityKey]] = true
+			}
+		}
+	}
+	return ret
+}
+
+// reportAgentState reports whether the agent of a target is connected in the status of the target
+func (c *TargetsVendor) reportAgentState(ctx context.Context, namespace string, name string, state string, properties map[string]string) {
+	status := map[string]string{
+		"remoteAgent": state,
+	}
+	for k, v := range properties {
+		status[k] = v
+	}
+	_, err := c.TargetsManager.ReportState(ctx, model.TargetState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Status: model.TargetStatus{
+			Properties:   status,
+			LastModified: time.Now().UTC(),
+		},
+	})
+	if err != nil {
+		tLog.ErrorfCtx(ctx, "V (Targets) : failed to report the agent of %s as %s - %s", name, state, err.Error())
+	}
+}
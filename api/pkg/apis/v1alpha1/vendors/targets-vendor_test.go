@@ -9,19 +9,28 @@ package vendors
 import (
 	"context"
 	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	sym_mgr "github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/sites"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/providers/target/remoteagent"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
 	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/validation"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	wsbinding "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/websocket"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/vendors"
 	"github.com/google/uuid"
+	gws "github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
 )
@@ -30,7 +39,7 @@ func TestTargetsEndpoints(t *testing.T) {
 	vendor := createTargetsVendor()
 	vendor.Route = "targets"
 	endpoints := vendor.GetEndpoints()
-	assert.Equal(t, 5, len(endpoints))
+	assert.Equal(t, 6, len(endpoints))
 }
 
 func TestTargetsInfo(t *testing.T) {
@@ -292,4 +301,204 @@ func TestTargetWrongMethod(t *testing.T) {
 		Context: context.Background(),
 	})
 	assert.Equal(t, v1alpha2.MethodNotAllowed, resp.State)
+
+	resp = vendor.onConnect(v1alpha2.COARequest{
+		Method:  fasthttp.MethodPost,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.MethodNotAllowed, resp.State)
+}
+
+// enrollAgents enrolls the identities of remote agents with the sites manager of the vendor
+func enrollAgents(t *testing.T, vendor *TargetsVendor, agents ...string) map[string]*utils.SiteIdentity {
+	issuer := &ca.CACertProvider{}
+	assert.Nil(t, issuer.Init(ca.CACertProviderConfig{Name: "ca"}))
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	enrollmentProvider := &memorystate.MemoryStateProvider{}
+	enrollmentProvider.Init(memorystate.MemoryStateProviderConfig{})
+	vendor.SitesManager = &sites.SitesManager{}
+	err := vendor.SitesManager.Init(vendor.Context, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "StateProvider",
+			"providers.certs":           "ca",
+			"providers.enrollmentstate": "EnrollmentStateProvider",
+		},
+	}, map[string]providers.IProvider{
+		"StateProvider":           stateProvider,
+		"EnrollmentStateProvider": enrollmentProvider,
+		"ca":                      issuer,
+	})
+	assert.Nil(t, err)
+
+	ret := map[string]*utils.SiteIdentity{}
+	for _, agent := range agents {
+		keyPEM, err := utils.GenerateSiteKey()
+		assert.Nil(t, err)
+		csr, err := utils.CreateSiteCSR(agent, keyPEM)
+		assert.Nil(t, err)
+		_, err = vendor.SitesManager.RequestEnrollment(context.Background(), model.SiteEnrollmentRequest{Site: agent, CSR: string(csr)}, false)
+		assert.Nil(t, err)
+		enrollment, err := vendor.SitesManager.ApproveEnrollment(context.Background(), agent, "")
+		assert.Nil(t, err)
+		ret[agent] = &utils.SiteIdentity{}
+		assert.Nil(t, ret[agent].Load(agent, keyPEM, []byte(enrollment.Certificate)))
+	}
+	return ret
+}
+
+func TestTargetsOnConnect(t *testing.T) {
+	vendor := createTargetsVendor()
+	vendor.AgentHub = remoteagent.NewHub(10)
+	identities := enrollAgents(t, &vendor, "agent-1", "agent-2")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &fasthttp.Server{
+		Handler: func(reqCtx *fasthttp.RequestCtx) {
+			request := v1alpha2.COARequest{
+				Method: string(reqCtx.Method()),
+				Route:  string(reqCtx.Path()),
+				Parameters: map[string]string{
+					"__name": strings.TrimPrefix(string(reqCtx.Path()), "/v1alpha2/targets/connect/"),
+				},
+				Metadata: map[string]string{},
+				Context:  context.WithValue(context.Background(), v1alpha2.COAFastHTTPContextKey, reqCtx),
+			}
+			for _, h := range v1alpha2.SiteAuthHeaders {
+				request.Metadata[h] = string(reqCtx.Request.Header.Peek(h))
+			}
+			resp := vendor.onConnect(request)
+			if resp.State != v1alpha2.OK {
+				reqCtx.SetStatusCode(int(resp.State))
+			}
+		},
+	}
+	go server.Serve(listener)
+	defer server.Shutdown()
+	dial := func(target string, agent string) (*wsbinding.Conn, *http.Response, error) {
+		address := "ws://" + listener.Addr().String() + "/v1alpha2/targets/connect/" + target
+		header := http.Header{}
+		if agent != "" {
+			req, _ := http.NewRequest(http.MethodGet, address, nil)
+			assert.Nil(t, identities[agent].Sign(req, nil, time.Now()))
+			header = req.Header
+		}
+		ws, resp, err := gws.DefaultDialer.Dial(address, header)
+		if err != nil {
+			return nil, resp, err
+		}
+		return wsbinding.NewConn(ws, 1), resp, nil
+	}
+	register := func(target string, agent string, spec string) wsbinding.Message {
+		conn, _, err := dial(target, agent)
+		assert.Nil(t, err)
+		defer conn.Close()
+		assert.Nil(t, conn.Send(wsbinding.Message{Type: wsbinding.MessageRegister, Registration: &wsbinding.Registration{Target: target, Spec: []byte(spec)}}))
+		message, err := conn.Receive()
+		assert.Nil(t, err)
+		return message
+	}
+
+	// agents must authenticate with a site identity
+	_, resp, err := dial("edge-01", "")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// a registration for another target is rejected
+	conn, _, err := dial("edge-01", "agent-1")
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Send(wsbinding.Message{Type: wsbinding.MessageRegister, Registration: &wsbinding.Registration{Target: "edge-02"}}))
+	message, err := conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, wsbinding.MessageError, message.Type)
+	conn.Close()
+
+	// an agent that registers with a spec creates its target with a remote agent binding
+	conn, _, err = dial("edge-01", "agent-1")
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Send(wsbinding.Message{
+		Type: wsbinding.MessageRegister,
+		Registration: &wsbinding.Registration{
+			Target:     "edge-01",
+			Spec:       []byte(`{"spec":{"displayName":"edge-01"}}`),
+			Properties: map[string]string{"os": "linux"},
+		},
+	}))
+	message, err = conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, wsbinding.MessageRegistered, message.Type)
+	assert.Eventually(t, func() bool {
+		return vendor.AgentHub.IsConnected("", "edge-01")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	state, err := vendor.TargetsManager.GetState(context.Background(), "edge-01", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "edge-01", state.Spec.DisplayName)
+	assert.Equal(t, "providers.target.remoteagent", state.Spec.Topologies[0].Bindings[0].Provider)
+	assert.Equal(t, "edge-01", state.Spec.Topologies[0].Bindings[0].Config["targetName"])
+	assert.Equal(t, "agent-1", state.Spec.Topologies[0].Bindings[0].Config[remoteagent.AgentIdentityKey])
+	assert.Equal(t, "agent-1", state.ObjectMeta.Annotations[remoteagent.CreatedByAnnotation])
+	assert.Equal(t, "connected", state.Status.Properties["remoteAgent"])
+	assert.Equal(t, "linux", state.Status.Properties["os"])
+
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		state, err := vendor.TargetsManager.GetState(context.Background(), "edge-01", "default")
+		return err == nil && state.Status.Properties["remoteAgent"] == "disconnected"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// other agents can neither take over the target nor connect to it
+	assert.Equal(t, wsbinding.MessageError, register("edge-01", "agent-2", `{"spec":{"displayName":"taken"}}`).Type)
+	assert.Equal(t, wsbinding.MessageError, register("edge-01", "agent-2", "").Type)
+	assert.Equal(t, wsbinding.MessageRegistered, register("edge-01", "agent-1", "").Type)
+	// an agent that binds its target to another identity is bound to its own
+	assert.Equal(t, wsbinding.MessageRegistered, register("edge-01", "agent-1", `{"spec":{"topologies":[{"bindings":[{"role":"instance","provider":"providers.target.remoteagent","config":{"agentIdentity":"agent-2"}}]}]}}`).Type)
+	state, err = vendor.TargetsManager.GetState(context.Background(), "edge-01", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "agent-1", state.Spec.Topologies[0].Bindings[0].Config[remoteagent.AgentIdentityKey])
+	// and to the target of its connection
+	assert.Equal(t, wsbinding.MessageRegistered, register("edge-01", "agent-1", `{"spec":{"topologies":[{"bindings":[{"role":"instance","provider":"providers.target.remoteagent","config":{"targetName":"edge-02","timeoutSeconds":"120"}}]}]}}`).Type)
+	state, err = vendor.TargetsManager.GetState(context.Background(), "edge-01", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"targetName": "edge-01", remoteagent.AgentIdentityKey: "agent-1", "timeoutSeconds": "120"}, state.Spec.Topologies[0].Bindings[0].Config)
+
+	// agents can't bind their targets to providers that run on the control plane
+	message = register("edge-01", "agent-1", `{"spec":{"topologies":[{"bindings":[{"role":"instance","provider":"providers.target.script","config":{"applyScript":"deploy.sh"}}]}]}}`)
+	assert.Equal(t, wsbinding.MessageError, message.Type)
+	assert.Contains(t, message.Error, "single providers.target.remoteagent binding")
+	err = vendor.registerAgent(context.Background(), "default", "edge-03", "agent-1", wsbinding.Message{
+		Type: wsbinding.MessageRegister,
+		Registration: &wsbinding.Registration{
+			Target: "edge-03",
+			Spec:   []byte(`{"spec":{"topologies":[{"bindings":[{"role":"instance","provider":"providers.target.script"}]}]}}`),
+		},
+	})
+	assert.Equal(t, v1alpha2.Forbidden, v1alpha2.GetErrorState(err))
+	_, err = vendor.TargetsManager.GetState(context.Background(), "edge-03", "default")
+	assert.True(t, utils.IsNotFound(err))
+	message = register("edge-01", "agent-1", `{"spec":{"topologies":[{"bindings":[{"role":"instance","provider":"providers.target.remoteagent"},{"role":"instance","provider":"providers.target.remoteagent"}]}]}}`)
+	assert.Equal(t, wsbinding.MessageError, message.Type)
+	state, err = vendor.TargetsManager.GetState(context.Background(), "edge-01", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(state.Spec.Topologies[0].Bindings))
+	assert.Equal(t, "providers.target.remoteagent", state.Spec.Topologies[0].Bindings[0].Provider)
+
+	// targets that weren't registered by the agent aren't overwritten
+	err = vendor.TargetsManager.UpsertState(context.Background(), "edge-02", model.TargetState{
+		ObjectMeta: model.ObjectMeta{Name: "edge-02", Namespace: "default"},
+		Spec:       &model.TargetSpec{DisplayName: "edge-02"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, wsbinding.MessageError, register("edge-02", "agent-1", `{"spec":{"displayName":"edge-02"}}`).Type)
+	assert.Equal(t, wsbinding.MessageError, register("edge-02", "agent-1", "").Type)
+	state, err = vendor.TargetsManager.GetState(context.Background(), "edge-02", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(state.Spec.Topologies))
+
+	// requests that aren't websocket handshakes are rejected
+	resp2 := vendor.onConnect(v1alpha2.COARequest{
+		Method:  fasthttp.MethodGet,
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.BadRequest, resp2.State)
 }
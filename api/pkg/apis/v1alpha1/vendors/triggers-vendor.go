@@ -0,0 +1,479 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package vendors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/constants"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/activations"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/triggers"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability"
+	observ_utils "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/observability/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub"
+	utils2 "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/vendors"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"github.com/valyala/fasthttp"
+)
+
+var atLog = logger.NewLogger("coa.runtime")
+
+// webhookSignatureTolerance is how far the timestamp of a signed webhook delivery may be off the current time
+const webhookSignatureTolerance = 5 * time.Minute
+
+type ActivationTriggersVendor struct {
+	vendors.Vendor
+	ActivationTriggersManager *triggers.ActivationTriggersManager
+	ActivationsManager        *activations.ActivationsManager
+	topics                    map[string]bool
+	topicLock                 sync.Mutex
+}
+
+func (o *ActivationTriggersVendor) GetInfo() vendors.VendorInfo {
+	return vendors.VendorInfo{
+		Version:  o.Vendor.Version,
+		Name:     "ActivationTriggers",
+		Producer: "Microsoft",
+	}
+}
+
+func (e *ActivationTriggersVendor) Init(config vendors.VendorConfig, factories []managers.IManagerFactroy, providers map[string]map[string]providers.IProvider, pubsubProvider pubsub.IPubSubProvider) error {
+	err := e.Vendor.Init(config, factories, providers, pubsubProvider)
+	if err != nil {
+		return err
+	}
+	for _, m := range e.Managers {
+		if c, ok := m.(*triggers.ActivationTriggersManager); ok {
+			e.ActivationTriggersManager = c
+		}
+		if c, ok := m.(*activations.ActivationsManager); ok {
+			e.ActivationsManager = c
+		}
+	}
+	if e.ActivationTriggersManager == nil {
+		return v1alpha2.NewCOAError(nil, "activation triggers manager is not supplied", v1alpha2.MissingConfig)
+	}
+	if e.ActivationsManager == nil {
+		return v1alpha2.NewCOAError(nil, "activations manager is not supplied", v1alpha2.MissingConfig)
+	}
+
+	e.Vendor.Context.Subscribe("catalogversion", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			var job v1alpha2.JobData
+			jData, _ := json.Marshal(event.Body)
+			err := utils2.UnmarshalJson(jData, &job)
+			if err != nil || job.Action != v1alpha2.JobUpdate {
+				return nil
+			}
+			var catalogversion model.CatalogVersionState
+			jData, _ = json.Marshal(job.Body)
+			err = utils2.UnmarshalJson(jData, &catalogversion)
+			if err != nil {
+				return nil
+			}
+			e.onEvent(getEventContext(event), model.TriggerSourceType_Object, model.TriggerObjectType_CatalogVersion, event.Metadata["objectType"], catalogversion.ObjectMeta.Namespace, job.Body)
+			return nil
+		},
+		Group: "triggers",
+	})
+	e.Vendor.Context.Subscribe(model.InstanceSummaryTopic, v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			var job v1alpha2.JobData
+			jData, _ := json.Marshal(event.Body)
+			err := utils2.UnmarshalJson(jData, &job)
+			if err != nil {
+				return nil
+			}
+			var summary model.SummarySpec
+			jData, _ = json.Marshal(job.Body)
+			err = utils2.UnmarshalJson(jData, &summary)
+			if err != nil {
+				return nil
+			}
+			status := "Succeeded"
+			if !summary.AllAssignedDeployed {
+				status = "Failed"
+			}
+			payload := map[string]interface{}{
+				"name":      job.Id,
+				"namespace": job.Scope,
+				"status":    status,
+				"summary":   job.Body,
+			}
+			e.onEvent(getEventContext(event), model.TriggerSourceType_Object, model.TriggerObjectType_Instance, "", job.Scope, payload)
+			return nil
+		},
+		Group: "triggers",
+	})
+
+	// Topic triggers may be created at any time, so topic subscriptions are
+	// established for existing triggers here and for new ones on upsert
+	list, err := e.ActivationTriggersManager.ListState(context.TODO(), "")
+	if err != nil {
+		atLog.Warnf("V (ActivationTriggers): failed to list existing triggers - %s", err.Error())
+		return nil
+	}
+	for _, trigger := range list {
+		e.ensureTopicSubscription(trigger)
+	}
+	return nil
+}
+
+func (o *ActivationTriggersVendor) GetEndpoints() []v1alpha2.Endpoint {
+	route := "triggers"
+	if o.Route != "" {
+		route = o.Route
+	}
+	return []v1alpha2.Endpoint{
+		{
+			Methods:    []string{fasthttp.MethodGet, fasthttp.MethodPost, fasthttp.MethodDelete},
+			Route:      route + "/registry",
+			Version:    o.Version,
+			Handler:    o.onTriggers,
+			Parameters: []string{"name?"},
+		},
+		{
+			// The trigger name is passed as a query parameter so that the webhook path
+			// can be exempted from token authentication; callers authenticate with the
+			// trigger's shared secret instead
+			Methods: []string{fasthttp.MethodPost},
+			Route:   route + "/webhook",
+			Version: o.Version,
+			Handler: o.onWebhook,
+		},
+	}
+}
+
+func (c *ActivationTriggersVendor) onTriggers(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	pCtx, span := observability.StartSpan("ActivationTriggers Vendor", request.Context, &map[string]string{
+		"method": "onTriggers",
+	})
+	defer span.End()
+
+	atLog.InfofCtx(pCtx, "V (ActivationTriggers): onTriggers, method: %s", string(request.Method))
+
+	namespace, namespaceSupplied := request.Parameters["namespace"]
+	if !namespaceSupplied {
+		namespace = "default"
+	}
+
+	switch request.Method {
+	case fasthttp.MethodGet:
+		ctx, span := observability.StartSpan("onTriggers-GET", pCtx, nil)
+		id := request.Parameters["__name"]
+		var err error
+		var state interface{}
+		isArray := false
+		if id == "" {
+			if !namespaceSupplied {
+				namespace = ""
+			}
+			state, err = c.ActivationTriggersManager.ListState(ctx, namespace)
+			isArray = true
+		} else {
+			state, err = c.ActivationTriggersManager.GetState(ctx, id, namespace)
+		}
+		if err != nil {
+			atLog.InfofCtx(ctx, "V (ActivationTriggers): onTriggers failed - %s", err.Error())
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		jData, _ := utils.FormatObject(state, isArray, request.Parameters["path"], request.Parameters["doc-type"])
+		resp := observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State:       v1alpha2.OK,
+			Body:        jData,
+			ContentType: "application/json",
+		})
+		if request.Parameters["doc-type"] == "yaml" {
+			resp.ContentType = "text/plain"
+		}
+		return resp
+	case fasthttp.MethodPost:
+		ctx, span := observability.StartSpan("onTriggers-POST", pCtx, nil)
+		id := request.Parameters["__name"]
+
+		var trigger model.ActivationTriggerState
+		err := utils2.UnmarshalJson(request.Body, &trigger)
+		if err != nil {
+			atLog.ErrorfCtx(ctx, "V (ActivationTriggers): onTriggers failed - %s", err.Error())
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte(err.Error()),
+			})
+		}
+		if trigger.ObjectMeta.Namespace == "" {
+			trigger.ObjectMeta.Namespace = namespace
+		}
+		err = c.ActivationTriggersManager.UpsertState(ctx, id, trigger)
+		if err != nil {
+			atLog.ErrorfCtx(ctx, "V (ActivationTriggers): onTriggers failed - %s", err.Error())
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		c.ensureTopicSubscription(trigger)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.OK,
+		})
+	case fasthttp.MethodDelete:
+		ctx, span := observability.StartSpan("onTriggers-DELETE", pCtx, nil)
+		id := request.Parameters["__name"]
+		err := c.ActivationTriggersManager.DeleteState(ctx, id, namespace)
+		if err != nil {
+			atLog.ErrorfCtx(ctx, "V (ActivationTriggers): onTriggers failed - %s", err.Error())
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.GetErrorState(err),
+				Body:  []byte(err.Error()),
+			})
+		}
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.OK,
+		})
+	}
+	atLog.InfoCtx(pCtx, "V (ActivationTriggers): onTriggers failed - 405 method not allowed")
+	resp := v1alpha2.COAResponse{
+		State:       v1alpha2.MethodNotAllowed,
+		Body:        []byte("{\"result\":\"405 - method not allowed\"}"),
+		ContentType: "application/json",
+	}
+	observ_utils.UpdateSpanStatusFromCOAResponse(span, resp)
+	return resp
+}
+
+func (c *ActivationTriggersVendor) onWebhook(request v1alpha2.COARequest) v1alpha2.COAResponse {
+	ctx, span := observability.StartSpan("ActivationTriggers Vendor", request.Context, &map[string]string{
+		"method": "onWebhook",
+	})
+	defer span.End()
+
+	name := request.Parameters["name"]
+	namespace, namespaceSupplied := request.Parameters["namespace"]
+	if !namespaceSupplied {
+		namespace = "default"
+	}
+	atLog.InfofCtx(ctx, "V (ActivationTriggers): onWebhook, name: %s, namespace: %s", name, namespace)
+
+	// Unknown and mismatched triggers are reported as unauthorized to avoid leaking trigger names
+	unauthorized := v1alpha2.COAResponse{
+		State:       v1alpha2.Unauthorized,
+		Body:        []byte("{\"result\":\"401 - unauthorized\"}"),
+		ContentType: "application/json",
+	}
+	trigger, err := c.ActivationTriggersManager.GetState(ctx, name, namespace)
+	if err != nil || trigger.Spec.Source.Type != model.TriggerSourceType_Webhook {
+		atLog.InfofCtx(ctx, "V (ActivationTriggers): onWebhook failed - webhook trigger %s is not found", name)
+		return observ_utils.CloseSpanWithCOAResponse(span, unauthorized)
+	}
+	secret, err := c.ActivationTriggersManager.ResolveSecret(ctx, trigger)
+	if err != nil || secret == "" {
+		atLog.ErrorfCtx(ctx, "V (ActivationTriggers): onWebhook failed - unable to resolve secret of trigger %s", name)
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.InternalError,
+			Body:  []byte("failed to resolve webhook secret"),
+		})
+	}
+	if !verifyWebhook(request, secret) {
+		atLog.InfofCtx(ctx, "V (ActivationTriggers): onWebhook failed - invalid signature for trigger %s", name)
+		return observ_utils.CloseSpanWithCOAResponse(span, unauthorized)
+	}
+
+	var payload interface{}
+	if len(request.Body) > 0 {
+		err = json.Unmarshal(request.Body, &payload)
+		if err != nil {
+			atLog.InfofCtx(ctx, "V (ActivationTriggers): onWebhook failed - %s", err.Error())
+			return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+				State: v1alpha2.BadRequest,
+				Body:  []byte(err.Error()),
+			})
+		}
+	}
+
+	activation, err := c.fire(ctx, trigger, payload)
+	if err != nil {
+		return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+			State: v1alpha2.GetErrorState(err),
+			Body:  []byte(err.Error()),
+		})
+	}
+	jData, _ := json.Marshal(map[string]interface{}{
+		"fired":      activation != "",
+		"activation": activation,
+	})
+	return observ_utils.CloseSpanWithCOAResponse(span, v1alpha2.COAResponse{
+		State:       v1alpha2.OK,
+		Body:        jData,
+		ContentType: "application/json",
+	})
+}
+
+// verifyWebhook accepts either an HMAC-SHA256 signature of the timestamp and body or the plain shared secret.
+// Signatures with a timestamp outside of webhookSignatureTolerance are rejected so deliveries can't be replayed.
+func verifyWebhook(request v1alpha2.COARequest, secret string) bool {
+	if signature := request.Metadata[v1alpha2.WebhookSignatureHeader]; signature != "" {
+		timestamp := request.Metadata[v1alpha2.WebhookTimestampHeader]
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return false
+		}
+		age := time.Since(time.Unix(seconds, 0))
+		if age > webhookSignatureTolerance || age < -webhookSignatureTolerance {
+			return false
+		}
+		signature = strings.TrimPrefix(signature, "sha256=")
+		expected, err := hex.DecodeString(signature)
+		if err != nil {
+			return false
+		}
+		return hmac.Equal(webhookSignature(secret, timestamp, request.Body), expected)
+	}
+	if token := request.Metadata[v1alpha2.WebhookTokenHeader]; token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	return false
+}
+
+// webhookSignature is the HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret
+func webhookSignature(secret string, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (c *ActivationTriggersVendor) ensureTopicSubscription(trigger model.ActivationTriggerState) {
+	if trigger.Spec == nil || trigger.Spec.Source.Type != model.TriggerSourceType_Topic {
+		return
+	}
+	topic := trigger.Spec.Source.Topic
+	c.topicLock.Lock()
+	defer c.topicLock.Unlock()
+	if c.topics == nil {
+		c.topics = make(map[string]bool)
+	}
+	if c.topics[topic] {
+		return
+	}
+	err := c.Vendor.Context.Subscribe(topic, v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			var payload interface{}
+			jData, _ := json.Marshal(event.Body)
+			json.Unmarshal(jData, &payload)
+			c.onEvent(getEventContext(event), model.TriggerSourceType_Topic, topic, "", "", payload)
+			return nil
+		},
+		Group: "triggers",
+	})
+	if err != nil {
+		atLog.Errorf("V (ActivationTriggers): failed to subscribe to topic %s - %s", topic, err.Error())
+		return
+	}
+	c.topics[topic] = true
+}
+
+// onEvent fires all triggers matching the event. An empty namespace matches triggers in all namespaces.
+func (c *ActivationTriggersVendor) onEvent(ctx context.Context, sourceType model.TriggerSourceType, topicOrObjectType string, catalogType string, namespace string, body interface{}) {
+	list, err := c.ActivationTriggersManager.ListState(ctx, namespace)
+	if err != nil {
+		atLog.ErrorfCtx(ctx, "V (ActivationTriggers): failed to list triggers - %s", err.Error())
+		return
+	}
+	var payload interface{}
+	jData, _ := json.Marshal(body)
+	json.Unmarshal(jData, &payload)
+	for _, trigger := range list {
+		if triggers.Matches(trigger, sourceType, topicOrObjectType, catalogType) {
+			c.fire(ctx, trigger, payload)
+		}
+	}
+}
+
+// fire creates an activation from the trigger and returns its name, or an empty
+// name if the event was filtered out or de-duplicated
+func (c *ActivationTriggersVendor) fire(ctx context.Context, trigger model.ActivationTriggerState, payload interface{}) (string, error) {
+	if trigger.Spec.Disabled {
+		return "", nil
+	}
+	activation, err := c.ActivationTriggersManager.Fire(ctx, trigger, payload)
+	if err == nil && activation != nil {
+		err = c.createActivation(ctx, *activation)
+		if err != nil {
+			// the payload didn't fire, so a retry of it isn't a duplicate
+			if rErr := c.ActivationTriggersManager.ReleaseDeduplication(ctx, trigger, payload); rErr != nil {
+				atLog.WarnfCtx(ctx, "V (ActivationTriggers): failed to release deduplication key of trigger %s - %s", trigger.ObjectMeta.Name, rErr.Error())
+			}
+		}
+	}
+	if err != nil {
+		atLog.ErrorfCtx(ctx, "V (ActivationTriggers): trigger %s failed to fire - %s", trigger.ObjectMeta.Name, err.Error())
+		c.ActivationTriggersManager.ReportFired(ctx, trigger.ObjectMeta.Name, trigger.ObjectMeta.Namespace, "", err)
+		return "", err
+	}
+	if activation == nil {
+		return "", nil
+	}
+	atLog.InfofCtx(ctx, "V (ActivationTriggers): trigger %s created activation %s", trigger.ObjectMeta.Name, activation.ObjectMeta.Name)
+	err = c.ActivationTriggersManager.ReportFired(ctx, trigger.ObjectMeta.Name, trigger.ObjectMeta.Namespace, activation.ObjectMeta.Name, nil)
+	if err != nil {
+		atLog.WarnfCtx(ctx, "V (ActivationTriggers): failed to update status of trigger %s - %s", trigger.ObjectMeta.Name, err.Error())
+	}
+	return activation.ObjectMeta.Name, nil
+}
+
+func (c *ActivationTriggersVendor) createActivation(ctx context.Context, activation model.ActivationState) error {
+	name := activation.ObjectMeta.Name
+	err := c.ActivationsManager.UpsertState(ctx, name, activation)
+	if err != nil {
+		return err
+	}
+	if c.Config.Properties["useJobManager"] != "true" {
+		return nil
+	}
+	entry, err := c.ActivationsManager.GetState(ctx, name, activation.ObjectMeta.Namespace)
+	if err != nil {
+		return err
+	}
+	if entry.Status.UpdateTime != "" || entry.ObjectMeta.Labels[constants.StatusMessage] != "" {
+		return nil
+	}
+	return c.Context.Publish("activation", v1alpha2.Event{
+		Body: v1alpha2.ActivationData{
+			CampaignVersion:      activation.Spec.CampaignVersion,
+			ActivationGeneration: entry.ObjectMeta.ETag,
+			Activation:           name,
+			Stage:                activation.Spec.Stage,
+			Inputs:               activation.Spec.Inputs,
+			Namespace:            activation.ObjectMeta.Namespace,
+		},
+		Context: ctx,
+	})
+}
+
+func getEventContext(event v1alpha2.Event) context.Context {
+	if event.Context != nil {
+		return event.Context
+	}
+	return context.TODO()
+}
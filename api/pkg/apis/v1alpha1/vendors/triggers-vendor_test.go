@@ -0,0 +1,402 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package vendors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/activations"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/managers/triggers"
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub/memory"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/states/memorystate"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func createActivationTriggersVendor(t *testing.T) *ActivationTriggersVendor {
+	stateProvider := &memorystate.MemoryStateProvider{}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	volatileProvider := &memorystate.MemoryStateProvider{}
+	volatileProvider.Init(memorystate.MemoryStateProviderConfig{})
+	triggersManager := triggers.ActivationTriggersManager{}
+	err := triggersManager.Init(nil, managers.ManagerConfig{
+		Properties: map[string]string{
+			"providers.persistentstate": "memory-state",
+			"providers.volatilestate":   "volatile-state",
+		},
+	}, map[string]providers.IProvider{
+		"memory-state":   stateProvider,
+		"volatile-state": volatileProvider,
+	})
+	assert.Nil(t, err)
+	activationsStateProvider := &memorystate.MemoryStateProvider{}
+	activationsStateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	activationsManager := activations.ActivationsManager{
+		StateProvider: activationsStateProvider,
+	}
+	vendor := &ActivationTriggersVendor{
+		ActivationTriggersManager: &triggersManager,
+		ActivationsManager:        &activationsManager,
+	}
+	vendor.Config.Properties = map[string]string{
+		"useJobManager": "true",
+	}
+	vendor.Context = &contexts.VendorContext{}
+	pubSubProvider := memory.InMemoryPubSubProvider{}
+	pubSubProvider.Init(memory.InMemoryPubSubConfig{Name: "test"})
+	vendor.Context.Init(&pubSubProvider)
+	return vendor
+}
+
+func webhookTrigger() model.ActivationTriggerState {
+	return model.ActivationTriggerState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "webhook1",
+			Namespace: "default",
+		},
+		Spec: &model.ActivationTriggerSpec{
+			CampaignVersion: "campaign-v-v1",
+			Source: model.TriggerSourceSpec{
+				Type:   model.TriggerSourceType_Webhook,
+				Secret: "s3cret",
+			},
+			Inputs: map[string]interface{}{
+				"ref": "${{$val('$.ref')}}",
+			},
+		},
+	}
+}
+
+func TestActivationTriggersEndpoints(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	vendor.Route = "triggers"
+	endpoints := vendor.GetEndpoints()
+	assert.Equal(t, 2, len(endpoints))
+	assert.Equal(t, "triggers/webhook", endpoints[1].Route)
+}
+
+func TestActivationTriggersInfo(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	vendor.Version = "1.0"
+	info := vendor.GetInfo()
+	assert.Equal(t, "1.0", info.Version)
+}
+
+func TestActivationTriggersOnTriggers(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	data, _ := json.Marshal(webhookTrigger())
+	resp := vendor.onTriggers(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       data,
+		Parameters: map[string]string{"__name": "webhook1"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+
+	resp = vendor.onTriggers(v1alpha2.COARequest{
+		Method:     fasthttp.MethodGet,
+		Parameters: map[string]string{"__name": "webhook1"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+	var trigger model.ActivationTriggerState
+	err := json.Unmarshal(resp.Body, &trigger)
+	assert.Nil(t, err)
+	assert.Equal(t, "campaign-v-v1", trigger.Spec.CampaignVersion)
+
+	invalid := webhookTrigger()
+	invalid.Spec.Source.Secret = ""
+	data, _ = json.Marshal(invalid)
+	resp = vendor.onTriggers(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       data,
+		Parameters: map[string]string{"__name": "webhook1"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.BadRequest, resp.State)
+
+	resp = vendor.onTriggers(v1alpha2.COARequest{
+		Method:     fasthttp.MethodDelete,
+		Parameters: map[string]string{"__name": "webhook1"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+}
+
+func TestActivationTriggersOnWebhook(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	err := vendor.ActivationTriggersManager.UpsertState(context.Background(), "webhook1", webhookTrigger())
+	assert.Nil(t, err)
+
+	sigs := make(chan v1alpha2.ActivationData, 1)
+	vendor.Context.Subscribe("activation", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			var activation v1alpha2.ActivationData
+			jData, _ := json.Marshal(event.Body)
+			json.Unmarshal(jData, &activation)
+			sigs <- activation
+			return nil
+		},
+	})
+
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	resp := vendor.onWebhook(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		Parameters: map[string]string{"name": "webhook1"},
+		Metadata:   map[string]string{v1alpha2.WebhookSignatureHeader: "sha256=00"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, resp.State)
+
+	resp = vendor.onWebhook(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		Parameters: map[string]string{"name": "unknown"},
+		Metadata:   map[string]string{v1alpha2.WebhookTokenHeader: "s3cret"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, resp.State)
+
+	sign := func(timestamp string) string {
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	// signatures without a timestamp, or with a stale one, are rejected so deliveries can't be replayed
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	resp = vendor.onWebhook(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		Parameters: map[string]string{"name": "webhook1"},
+		Metadata:   map[string]string{v1alpha2.WebhookSignatureHeader: "sha256=" + hex.EncodeToString(mac.Sum(nil))},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, resp.State)
+
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	resp = vendor.onWebhook(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		Parameters: map[string]string{"name": "webhook1"},
+		Metadata: map[string]string{
+			v1alpha2.WebhookSignatureHeader: sign(stale),
+			v1alpha2.WebhookTimestampHeader: stale,
+		},
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, resp.State)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	resp = vendor.onWebhook(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		Parameters: map[string]string{"name": "webhook1"},
+		Metadata: map[string]string{
+			v1alpha2.WebhookSignatureHeader: sign(stale),
+			v1alpha2.WebhookTimestampHeader: now,
+		},
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.Unauthorized, resp.State)
+
+	resp = vendor.onWebhook(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		Parameters: map[string]string{"name": "webhook1"},
+		Metadata: map[string]string{
+			v1alpha2.WebhookSignatureHeader: sign(now),
+			v1alpha2.WebhookTimestampHeader: now,
+		},
+		Context: context.Background(),
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+	var result map[string]interface{}
+	err = json.Unmarshal(resp.Body, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, true, result["fired"])
+
+	select {
+	case activation := <-sigs:
+		assert.Equal(t, "campaign-v-v1", activation.CampaignVersion)
+		assert.Equal(t, result["activation"], activation.Activation)
+		assert.Equal(t, "refs/heads/main", activation.Inputs["ref"])
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "timed out waiting for activation event")
+	}
+
+	trigger, err := vendor.ActivationTriggersManager.GetState(context.Background(), "webhook1", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, trigger.Status.FireCount)
+}
+
+func TestActivationTriggersOnTopic(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	trigger := model.ActivationTriggerState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "topic1",
+			Namespace: "default",
+		},
+		Spec: &model.ActivationTriggerSpec{
+			CampaignVersion: "campaign-v-v1",
+			Source: model.TriggerSourceSpec{
+				Type:  model.TriggerSourceType_Topic,
+				Topic: "alerts",
+			},
+			Inputs: map[string]interface{}{
+				"device": "${{$val('$.device')}}",
+			},
+			Deduplication: &model.TriggerDeduplicationSpec{
+				Key: "${{$val('$.device')}}",
+			},
+		},
+	}
+	data, _ := json.Marshal(trigger)
+	resp := vendor.onTriggers(v1alpha2.COARequest{
+		Method:     fasthttp.MethodPost,
+		Body:       data,
+		Parameters: map[string]string{"__name": "topic1"},
+		Context:    context.Background(),
+	})
+	assert.Equal(t, v1alpha2.OK, resp.State)
+
+	sigs := make(chan v1alpha2.ActivationData, 2)
+	vendor.Context.Subscribe("activation", v1alpha2.EventHandler{
+		Handler: func(topic string, event v1alpha2.Event) error {
+			var activation v1alpha2.ActivationData
+			jData, _ := json.Marshal(event.Body)
+			json.Unmarshal(jData, &activation)
+			sigs <- activation
+			return nil
+		},
+	})
+	vendor.Context.Publish("alerts", v1alpha2.Event{
+		Body: map[string]interface{}{"device": "camera-1"},
+	})
+	select {
+	case activation := <-sigs:
+		assert.Equal(t, "camera-1", activation.Inputs["device"])
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "timed out waiting for activation event")
+	}
+
+	// the duplicated event is dropped
+	vendor.Context.Publish("alerts", v1alpha2.Event{
+		Body: map[string]interface{}{"device": "camera-1"},
+	})
+	select {
+	case <-sigs:
+		assert.Fail(t, "duplicated event should not fire the trigger")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// unavailableStateProvider fails to save states while it's unavailable
+type unavailableStateProvider struct {
+	*memorystate.MemoryStateProvider
+	unavailable bool
+}
+
+func (s *unavailableStateProvider) Upsert(ctx context.Context, request states.UpsertRequest) (string, error) {
+	if s.unavailable {
+		return "", v1alpha2.NewCOAError(nil, "state store is unavailable", v1alpha2.InternalError)
+	}
+	return s.MemoryStateProvider.Upsert(ctx, request)
+}
+
+func TestActivationTriggersFireRetriesFailedActivation(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	stateProvider := &unavailableStateProvider{MemoryStateProvider: &memorystate.MemoryStateProvider{}, unavailable: true}
+	stateProvider.Init(memorystate.MemoryStateProviderConfig{})
+	vendor.ActivationsManager.StateProvider = stateProvider
+	trigger := model.ActivationTriggerState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "topic1",
+			Namespace: "default",
+		},
+		Spec: &model.ActivationTriggerSpec{
+			CampaignVersion: "campaign-v-v1",
+			Source: model.TriggerSourceSpec{
+				Type:  model.TriggerSourceType_Topic,
+				Topic: "alerts",
+			},
+			Deduplication: &model.TriggerDeduplicationSpec{
+				Key: "${{$val('$.device')}}",
+			},
+		},
+	}
+	payload := map[string]interface{}{"device": "camera-1"}
+	_, err := vendor.fire(context.Background(), trigger, payload)
+	assert.NotNil(t, err)
+
+	// the retry of an event whose activation failed to be created isn't a duplicate
+	stateProvider.unavailable = false
+	name, err := vendor.fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, name)
+
+	name, err = vendor.fire(context.Background(), trigger, payload)
+	assert.Nil(t, err)
+	assert.Empty(t, name)
+}
+
+func TestActivationTriggersOnInstanceSummary(t *testing.T) {
+	vendor := createActivationTriggersVendor(t)
+	vendor.Config.Properties = map[string]string{}
+	err := vendor.ActivationTriggersManager.UpsertState(context.Background(), "instance1", model.ActivationTriggerState{
+		ObjectMeta: model.ObjectMeta{
+			Name:      "instance1",
+			Namespace: "default",
+		},
+		Spec: &model.ActivationTriggerSpec{
+			CampaignVersion: "campaign-v-v1",
+			Source: model.TriggerSourceSpec{
+				Type:       model.TriggerSourceType_Object,
+				ObjectType: model.TriggerObjectType_Instance,
+			},
+			Filter: "${{$equal($val('$.status'), 'Failed')}}",
+			Inputs: map[string]interface{}{
+				"instance": "${{$val('$.name')}}",
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	vendor.onEvent(context.Background(), model.TriggerSourceType_Object, model.TriggerObjectType_Instance, "", "default", map[string]interface{}{
+		"name":   "instance-a",
+		"status": "Succeeded",
+	})
+	list, err := vendor.ActivationsManager.ListState(context.Background(), "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list))
+
+	vendor.onEvent(context.Background(), model.TriggerSourceType_Object, model.TriggerObjectType_Instance, "", "default", map[string]interface{}{
+		"name":   "instance-a",
+		"status": "Failed",
+	})
+	list, err = vendor.ActivationsManager.ListState(context.Background(), "default")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "instance-a", list[0].Spec.Inputs["instance"])
+	assert.Equal(t, "instance1", list[0].ObjectMeta.Labels[triggers.TriggerLabel])
+}
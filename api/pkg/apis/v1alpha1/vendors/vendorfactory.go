@@ -63,6 +63,8 @@ func (c SymphonyVendorFactory) CreateVendor(config vendors.VendorConfig) (vendor
 		return &SettingsVendor{}, nil
 	case "vendors.trails":
 		return &TrailsVendor{}, nil
+	case "vendors.triggers":
+		return &ActivationTriggersVendor{}, nil
 	case "vendors.backgroundjob":
 		return &BackgroundJobVendor{}, nil
 	case "vendors.visualization.client":
@@ -73,6 +75,8 @@ func (c SymphonyVendorFactory) CreateVendor(config vendors.VendorConfig) (vendor
 		return &ProcessorVendor{}, nil
 	case "vendors.securitypolicy":
 		return &SecurityPolicyVendor{}, nil
+	case "vendors.impact":
+		return &ImpactVendor{}, nil
 	default:
 		return nil, nil //Can't throw errors as other factories may create it...
 	}
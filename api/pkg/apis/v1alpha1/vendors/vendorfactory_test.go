@@ -111,8 +111,18 @@ func TestCreateVendor(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, vendor.(*TrailsVendor))
 
+	config.Type = "vendors.triggers"
+	vendor, err = factory.CreateVendor(config)
+	assert.Nil(t, err)
+	assert.NotNil(t, vendor.(*ActivationTriggersVendor))
+
 	config.Type = "vendors.backgroundjob"
 	vendor, err = factory.CreateVendor(config)
 	assert.Nil(t, err)
 	assert.NotNil(t, vendor.(*BackgroundJobVendor))
+
+	config.Type = "vendors.impact"
+	vendor, err = factory.CreateVendor(config)
+	assert.Nil(t, err)
+	assert.NotNil(t, vendor.(*ImpactVendor))
 }
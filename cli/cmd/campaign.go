@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/cli/config"
+	"github.com/eclipse-symphony/symphony/cli/utils"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	campaignFile     string
+	campaignSimulate bool
+	campaignInputs   map[string]string
+	campaignStubs    string
+)
+
+var CampaignCmd = &cobra.Command{
+	Use:   "campaign",
+	Short: "Work with Symphony campaigns",
+}
+
+var CampaignValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate a campaign version definition",
+	Long: `Validate a campaign version definition before it's deployed.
+
+The Symphony API parses all expressions, checks stage providers and walks the
+stage graph from the first stage to report dead ends, unreachable stages and
+cycles without exits. With --simulate, the campaign version is also run with
+mock stage providers. Use --stubs to supply a YAML file that maps stage names
+to the outputs those stages should produce during the simulation.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.GetMaestroConfig(configFile)
+		ctx := c.DefaultContext
+		if configContext != "" {
+			ctx = configContext
+		}
+		if ctx == "" {
+			ctx = "default"
+		}
+
+		payload, err := os.ReadFile(campaignFile)
+		if err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		var stubOutputs map[string]map[string]interface{}
+		if campaignStubs != "" {
+			data, err := os.ReadFile(campaignStubs)
+			if err == nil {
+				err = yaml.Unmarshal(data, &stubOutputs)
+			}
+			if err != nil {
+				fmt.Printf("\n%s  failed to read stubs: %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+				return
+			}
+		}
+		inputs := make(map[string]interface{})
+		for k, v := range campaignInputs {
+			inputs[k] = v
+		}
+
+		resp, err := utils.ValidateCampaignVersion(
+			c.Contexts[ctx].Url,
+			c.Contexts[ctx].User,
+			c.Contexts[ctx].Secret,
+			payload,
+			campaignSimulate,
+			inputs,
+			stubOutputs)
+		if err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		var result model.CampaignValidationResult
+		if err := json.Unmarshal(resp, &result); err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		outputCampaignValidationResult(result)
+	},
+}
+
+func outputCampaignValidationResult(result model.CampaignValidationResult) {
+	if len(result.Issues) > 0 {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Severity", "Stage", "Field", "Message"})
+		for _, issue := range result.Issues {
+			t.AppendRow(table.Row{issue.Severity, issue.Stage, issue.FieldPath, issue.Message})
+		}
+		t.SetStyle(table.StyleColoredBright)
+		t.Render()
+	}
+	if result.Simulation != nil {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Stage", "Status", "Next Stage", "Error"})
+		for _, stage := range result.Simulation.StageHistory {
+			t.AppendRow(table.Row{stage.Stage, stage.StatusMessage, stage.NextStage, stage.ErrorMessage})
+		}
+		t.SetStyle(table.StyleColoredBright)
+		t.Render()
+		if result.Simulation.Message != "" {
+			fmt.Printf("\n%s  %s%s\n", utils.ColorYellow(), result.Simulation.Message, utils.ColorReset())
+		}
+	}
+	if result.Valid {
+		fmt.Printf("\n%s  Campaign version is valid.%s\n\n", utils.ColorCyan(), utils.ColorReset())
+	} else {
+		fmt.Printf("\n%s  Campaign version is invalid.%s\n\n", utils.ColorRed(), utils.ColorReset())
+	}
+}
+
+func init() {
+	CampaignValidateCmd.Flags().StringVarP(&campaignFile, "file", "f", "", "Campaign version definition file (YAML or JSON)")
+	CampaignValidateCmd.Flags().BoolVarP(&campaignSimulate, "simulate", "", false, "Simulate the campaign version with mock stage providers")
+	CampaignValidateCmd.Flags().StringToStringVarP(&campaignInputs, "inputs", "i", nil, "Activation inputs used by the simulation (key=value)")
+	CampaignValidateCmd.Flags().StringVarP(&campaignStubs, "stubs", "", "", "YAML file with stubbed outputs per stage used by the simulation")
+	CampaignValidateCmd.Flags().StringVarP(&configFile, "config", "c", "", "Maestro CLI config file")
+	CampaignValidateCmd.Flags().StringVarP(&configContext, "context", "", "", "Maestro CLI configuration context")
+	CampaignValidateCmd.MarkFlagRequired("file")
+	CampaignCmd.AddCommand(CampaignValidateCmd)
+	RootCmd.AddCommand(CampaignCmd)
+}
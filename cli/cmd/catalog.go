@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eclipse-symphony/symphony/api/pkg/apis/v1alpha1/model"
+	"github.com/eclipse-symphony/symphony/cli/config"
+	"github.com/eclipse-symphony/symphony/cli/utils"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	catalogNamespace string
+	catalogFrom      int64
+	catalogTo        int64
+	catalogRevision  int64
+)
+
+var CatalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Work with Symphony catalogs",
+}
+
+var CatalogHistoryCmd = &cobra.Command{
+	Use:   "history <catalog version>",
+	Short: "List the revisions of a catalog version",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, ctx := catalogContext()
+		resp, err := utils.CatalogHistory(c.Contexts[ctx].Url, c.Contexts[ctx].User, c.Contexts[ctx].Secret, catalogObjectName(args[0]), catalogNamespace)
+		if err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		var revisions []model.CatalogRevision
+		if err := json.Unmarshal(resp, &revisions); err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Revision", "Action", "Generation", "Author", "Timestamp"})
+		for _, revision := range revisions {
+			action := revision.Action
+			if revision.RestoredFrom > 0 {
+				action = fmt.Sprintf("%s (from %d)", action, revision.RestoredFrom)
+			}
+			t.AppendRow(table.Row{revision.Revision, action, revision.Generation, revision.Author, revision.Timestamp})
+		}
+		t.SetStyle(table.StyleColoredBright)
+		t.Render()
+	},
+}
+
+var CatalogDiffCmd = &cobra.Command{
+	Use:   "diff <catalog version>",
+	Short: "Compare two revisions of a catalog version",
+	Long: `Compare two revisions of a catalog version.
+
+Changes are listed by the JSON pointer of the changed value. Without --to, the
+latest revision is compared; without --from, the revision before it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, ctx := catalogContext()
+		resp, err := utils.CatalogDiff(c.Contexts[ctx].Url, c.Contexts[ctx].User, c.Contexts[ctx].Secret, catalogObjectName(args[0]), catalogNamespace, catalogFrom, catalogTo)
+		if err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		var diff model.CatalogDiff
+		if err := json.Unmarshal(resp, &diff); err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		if len(diff.Changes) == 0 {
+			fmt.Printf("\n%s  No changes from revision %d to %d.%s\n\n", utils.ColorCyan(), diff.From, diff.To, utils.ColorReset())
+			return
+		}
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Property", "Change", fmt.Sprintf("Revision %d", diff.From), fmt.Sprintf("Revision %d", diff.To)})
+		for _, change := range diff.Changes {
+			t.AppendRow(table.Row{change.Property, change.Operation, formatChangeValue(change.Old), formatChangeValue(change.New)})
+		}
+		t.SetStyle(table.StyleColoredBright)
+		t.Render()
+	},
+}
+
+var CatalogRestoreCmd = &cobra.Command{
+	Use:   "restore <catalog version>",
+	Short: "Restore a catalog version to a revision",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, ctx := catalogContext()
+		err := utils.CatalogRestore(c.Contexts[ctx].Url, c.Contexts[ctx].User, c.Contexts[ctx].Secret, catalogObjectName(args[0]), catalogNamespace, catalogRevision)
+		if err != nil {
+			fmt.Printf("\n%s  %s%s\n\n", utils.ColorRed(), err.Error(), utils.ColorReset())
+			return
+		}
+		fmt.Printf("\n%s  Catalog version %s is restored to revision %d.%s\n\n", utils.ColorCyan(), args[0], catalogRevision, utils.ColorReset())
+	},
+}
+
+func catalogContext() (config.MaestroConfig, string) {
+	c := config.GetMaestroConfig(configFile)
+	ctx := c.DefaultContext
+	if configContext != "" {
+		ctx = configContext
+	}
+	if ctx == "" {
+		ctx = "default"
+	}
+	return c, ctx
+}
+
+// catalogObjectName accepts catalog versions as references (name:version) or object names
+func catalogObjectName(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[:i] + "-v-" + name[i+1:]
+	}
+	return name
+}
+
+func formatChangeValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{CatalogHistoryCmd, CatalogDiffCmd, CatalogRestoreCmd} {
+		cmd.Flags().StringVarP(&catalogNamespace, "namespace", "n", "", "Namespace of the catalog version")
+		cmd.Flags().StringVarP(&configFile, "config", "c", "", "Maestro CLI config file")
+		cmd.Flags().StringVarP(&configContext, "context", "", "", "Maestro CLI configuration context")
+		CatalogCmd.AddCommand(cmd)
+	}
+	CatalogDiffCmd.Flags().Int64VarP(&catalogFrom, "from", "", 0, "Revision to compare from")
+	CatalogDiffCmd.Flags().Int64VarP(&catalogTo, "to", "", 0, "Revision to compare to")
+	CatalogRestoreCmd.Flags().Int64VarP(&catalogRevision, "revision", "r", 0, "Revision to restore")
+	CatalogRestoreCmd.MarkFlagRequired("revision")
+	RootCmd.AddCommand(CatalogCmd)
+}
@@ -147,6 +147,37 @@ func Upsert(url string, username string, password string, objType string, objNam
 	return nil
 }
 
+// ValidateCampaignVersion sends a campaign version definition (YAML or JSON) to the Symphony API for
+// static validation. When simulate is set, the API also runs the campaign version with mock stage
+// providers, using inputs as activation inputs and stubOutputs (keyed by stage name) as stage outputs.
+func ValidateCampaignVersion(url string, username string, password string, payload []byte, simulate bool, inputs map[string]interface{}, stubOutputs map[string]map[string]interface{}) ([]byte, error) {
+	token, err := Login(url, username, password)
+	if err != nil {
+		return nil, err
+	}
+	payload, err = yamlToJson(payload)
+	if err != nil {
+		return nil, err
+	}
+	request, err := json.Marshal(map[string]interface{}{
+		"campaignVersion": json.RawMessage(payload),
+		"simulate":        simulate,
+		"inputs":          inputs,
+		"stubOutputs":     stubOutputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := callRestAPI(url, "/campaignversions", "POST", request, token, map[string]string{"action": "validate"})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("campaign version validation is not supported by the Symphony API")
+	}
+	return resp, nil
+}
+
 func yamlToJson(payload []byte) ([]byte, error) {
 	var m map[string]interface{}
 	if err := yaml.Unmarshal(payload, &m); err != nil {
@@ -274,3 +305,53 @@ func callRestAPI(url string, route string, method string, payload []byte, token
 	}
 	return bodyBytes, nil
 }
+
+// CatalogHistory returns the revisions of a catalog version
+func CatalogHistory(url string, username string, password string, name string, namespace string) ([]byte, error) {
+	return catalogHistoryCall(url, username, password, "/catalogversions/history/"+name, "GET", namespaceParameters(namespace, nil))
+}
+
+// CatalogDiff compares two revisions of a catalog version. A zero to revision is the latest
+// revision, and a zero from revision is the revision before to.
+func CatalogDiff(url string, username string, password string, name string, namespace string, from int64, to int64) ([]byte, error) {
+	params := make(map[string]string)
+	if from > 0 {
+		params["from"] = fmt.Sprintf("%d", from)
+	}
+	if to > 0 {
+		params["to"] = fmt.Sprintf("%d", to)
+	}
+	return catalogHistoryCall(url, username, password, "/catalogversions/diff/"+name, "GET", namespaceParameters(namespace, params))
+}
+
+// CatalogRestore brings a catalog version back to the spec of a revision
+func CatalogRestore(url string, username string, password string, name string, namespace string, revision int64) error {
+	params := map[string]string{"revision": fmt.Sprintf("%d", revision)}
+	_, err := catalogHistoryCall(url, username, password, "/catalogversions/restore/"+name, "POST", namespaceParameters(namespace, params))
+	return err
+}
+
+func catalogHistoryCall(url string, username string, password string, route string, method string, params map[string]string) ([]byte, error) {
+	token, err := Login(url, username, password)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := callRestAPI(url, route, method, nil, token, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("catalog version or revision is not found, or history is not supported by the Symphony API")
+	}
+	return resp, nil
+}
+
+func namespaceParameters(namespace string, params map[string]string) map[string]string {
+	if params == nil {
+		params = make(map[string]string)
+	}
+	if namespace != "" {
+		params["namespace"] = namespace
+	}
+	return params
+}
@@ -8,6 +8,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -17,6 +18,7 @@ import (
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs"
 	autogen "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/autogen"
+	ca "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/ca"
 	localfile "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/certs/localfile"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/pubsub"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
@@ -42,6 +44,9 @@ type HttpBindingConfig struct {
 	Pipeline     []MiddlewareConfig `json:"pipeline"`
 	TLS          bool               `json:"tls"`
 	CertProvider CertProviderConfig `json:"certProvider"`
+	// RequestClientCert asks TLS clients for a certificate, so handlers can authenticate
+	// them. The certificate is verified by the handlers, not by the server.
+	RequestClientCert bool `json:"requestClientCert,omitempty"`
 }
 
 // HttpBinding provides service endpoints as a fasthttp web server
@@ -71,6 +76,8 @@ func (h *HttpBinding) Launch(config HttpBindingConfig, endpoints []v1alpha2.Endp
 			h.CertProvider = &autogen.AutoGenCertProvider{}
 		case "certs.localfile":
 			h.CertProvider = &localfile.LocalCertFileProvider{}
+		case "certs.ca":
+			h.CertProvider = &ca.CACertProvider{}
 		default:
 			return v1alpha2.NewCOAError(nil, fmt.Sprintf("cert provider type '%s' is not recognized", config.CertProvider.Type), v1alpha2.BadConfig)
 		}
@@ -83,6 +90,11 @@ func (h *HttpBinding) Launch(config HttpBindingConfig, endpoints []v1alpha2.Endp
 	h.server = &fasthttp.Server{
 		Handler: h.pipeline.Apply(handler),
 	}
+	if config.TLS && config.RequestClientCert {
+		h.server.TLSConfig = &tls.Config{
+			ClientAuth: tls.RequestClientCert,
+		}
+	}
 
 	go func() {
 		var serverErr error
@@ -183,6 +195,31 @@ func wrapAsHTTPHandler(endpoint v1alpha2.Endpoint, handler v1alpha2.COAHandler)
 			}
 			req.Metadata["Authorization"] = string(auth)
 		}
+		// The authenticated user is only set by the JWT middleware, never by the client.
+		delete(req.Metadata, v1alpha2.AuthenticatedUser)
+		if user := reqCtx.UserValue(v1alpha2.AuthenticatedUser); user != nil {
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]string)
+			}
+			req.Metadata[v1alpha2.AuthenticatedUser] = utils.FormatAsString(user)
+		}
+		delete(req.Metadata, v1alpha2.AuthenticationSkipped)
+		if reqCtx.UserValue(v1alpha2.AuthenticationSkipped) != nil {
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]string)
+			}
+			req.Metadata[v1alpha2.AuthenticationSkipped] = "true"
+		}
+		// Propagate webhook signature and site authentication headers so inbound
+		// webhooks and federation requests can be authenticated.
+		for _, h := range append(v1alpha2.WebhookHeaders, v1alpha2.SiteAuthHeaders...) {
+			if val := reqCtx.Request.Header.Peek(h); len(val) > 0 {
+				if req.Metadata == nil {
+					req.Metadata = make(map[string]string)
+				}
+				req.Metadata[h] = string(val)
+			}
+		}
 		req.Parameters = make(map[string]string)
 
 		for _, p := range endpoint.Parameters {
@@ -79,7 +79,10 @@ func (j JWT) JWT(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
 		if j.IgnorePaths != nil {
 			for _, p := range j.IgnorePaths {
-				if p == string(ctx.Path()) {
+				// a trailing "*" ignores all paths with the prefix
+				if p == string(ctx.Path()) || (strings.HasSuffix(p, "*") && strings.HasPrefix(string(ctx.Path()), strings.TrimSuffix(p, "*"))) {
+					// handlers of ignored paths can tell the request wasn't authenticated
+					ctx.SetUserValue(v1alpha2.AuthenticationSkipped, true)
 					next(ctx)
 					return
 				}
@@ -107,12 +110,13 @@ func (j JWT) JWT(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 					return
 				}
 				log.Debugf("JWT: Validating token with username plus pwd.")
-				_, roles, err := j.validateToken(tokenStr)
+				claims, roles, err := j.validateToken(tokenStr)
 				if err != nil {
 					log.Error("JWT: Validate token with user creds failed. %s\n", err.Error())
 					ctx.Response.SetStatusCode(fasthttp.StatusUnauthorized)
 					return
 				} else {
+					setAuthenticatedUser(ctx, claims)
 					if j.EnableRBAC {
 						path := string(ctx.Path())
 						method := string(ctx.Method())
@@ -152,6 +156,17 @@ func (j JWT) JWT(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 		}
 	}
 }
+
+// setAuthenticatedUser keeps the user of a validated token on the request, from the "user" claim
+// of Symphony tokens or the subject of other tokens
+func setAuthenticatedUser(ctx *fasthttp.RequestCtx, claims map[string]interface{}) {
+	for _, claim := range []string{"user", "sub"} {
+		if user, ok := claims[claim].(string); ok && user != "" {
+			ctx.SetUserValue(v1alpha2.AuthenticatedUser, user)
+			return
+		}
+	}
+}
 func (j JWT) readAuthHeader(ctx *fasthttp.RequestCtx) string {
 	v := ctx.Request.Header.Peek(j.AuthHeader)
 	if v != nil {
@@ -286,6 +301,7 @@ func (j *JWT) validateServiceAccountToken(ctx *fasthttp.RequestCtx, tokenStr str
 			log.Errorf("JWT: Validate token with k8s failed. K8s returned invalid username, %s\n", result.Status.User.Username)
 			return v1alpha2.NewCOAError(nil, "Authentication failed.", v1alpha2.Unauthorized)
 		}
+		ctx.SetUserValue(v1alpha2.AuthenticatedUser, result.Status.User.Username)
 	}
 	return nil
 
@@ -14,8 +14,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
 )
 
 func generateJWTToken(signingKey interface{}, method jwt.SigningMethod, userName string, expiresAt time.Time, issuedAt time.Time, notAfter time.Time, issuer string, subject string, audiences []string) (string, error) {
@@ -142,3 +144,51 @@ func TestValidateWithTokenWithCert(t *testing.T) {
 	_, _, err = j.validateToken(token)
 	assert.Nil(t, err)
 }
+
+func TestJWTIgnorePaths(t *testing.T) {
+	j := JWT{
+		AuthHeader:  "Authorization",
+		IgnorePaths: []string{"/v1alpha2/greetings", "/v1alpha2/federation/sync*"},
+	}
+	handler := j.JWT(func(ctx *fasthttp.RequestCtx) {
+		// requests of ignored paths are marked as unauthenticated
+		if ctx.UserValue(v1alpha2.AuthenticationSkipped) != true {
+			ctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.Response.SetStatusCode(fasthttp.StatusOK)
+	})
+	for path, status := range map[string]int{
+		"/v1alpha2/greetings":            fasthttp.StatusOK,
+		"/v1alpha2/greetings/more":       fasthttp.StatusUnauthorized,
+		"/v1alpha2/federation/sync":      fasthttp.StatusOK,
+		"/v1alpha2/federation/sync/site": fasthttp.StatusOK,
+		"/v1alpha2/federation/registry":  fasthttp.StatusUnauthorized,
+	} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(path)
+		handler(ctx)
+		assert.Equal(t, status, ctx.Response.StatusCode(), path)
+	}
+}
+
+func TestJWTAuthenticatedUser(t *testing.T) {
+	signingKey := "TestKey"
+	j := JWT{
+		AuthHeader: "Authorization",
+		VerifyKey:  signingKey,
+	}
+	var user interface{}
+	handler := j.JWT(func(ctx *fasthttp.RequestCtx) {
+		user = ctx.UserValue(v1alpha2.AuthenticatedUser)
+		ctx.Response.SetStatusCode(fasthttp.StatusOK)
+	})
+	token, err := generateJWTToken([]byte(signingKey), jwt.SigningMethodHS256, "operator", time.Now().Add(time.Hour), time.Now(), time.Now(), "symphony", "symphony", []string{"*"})
+	assert.Nil(t, err)
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/v1alpha2/catalogversions/registry")
+	ctx.Request.Header.Set("Authorization", "Bearer "+token)
+	handler(ctx)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, "operator", user)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+const (
+	// ProtocolVersion5 carries the response topic, correlation data and expiry of requests as MQTT 5 properties
+	ProtocolVersion5 = "5"
+	// ProtocolVersion311 carries them in the metadata of requests and responses, for brokers that only speak MQTT 3.1.1
+	ProtocolVersion311 = "3.1.1"
+
+	defaultTimeout = 8 * time.Second
+)
+
+// Message is a message published or received by a Client
+type Message struct {
+	Topic   string
+	QoS     byte
+	Payload []byte
+	// ResponseTopic and CorrelationData are the request-response properties of MQTT 5, they're empty with MQTT 3.1.1
+	ResponseTopic   string
+	CorrelationData []byte
+	// ExpiresAt is the time after which the message is dropped, messages without it don't expire.
+	// With MQTT 5, it's sent as the message expiry interval.
+	ExpiresAt time.Time
+}
+
+// MessageHandler is called with the messages received on the subscribed topic
+type MessageHandler func(client Client, message Message)
+
+// Client is a connection to an MQTT broker with MQTT 5 or MQTT 3.1.1
+type Client interface {
+	// HasProperties returns whether messages carry the properties of MQTT 5
+	HasProperties() bool
+	IsConnected() bool
+	// Publish publishes a message and waits up to timeout for it to be acknowledged. A publish that is still
+	// in flight after the timeout is delivered by the client once acknowledged, and doesn't return an error.
+	Publish(message Message, timeout time.Duration) error
+	Disconnect()
+}
+
+// ClientConfig is how a Client connects, and the topic it subscribes to on each connection
+type ClientConfig struct {
+	// ProtocolVersion is ProtocolVersion5 or ProtocolVersion311, MQTT 5 is used when it's empty
+	ProtocolVersion string
+	BrokerAddress   string
+	ClientID        string
+	Username        string
+	Password        string
+	TLSConfig       *tls.Config
+	KeepAlive       time.Duration
+	PingTimeout     time.Duration
+	ConnectTimeout  time.Duration
+	// PersistentSession keeps the session on the broker across reconnects
+	PersistentSession bool
+	// SessionStoreFolder keeps in-flight messages of the session across restarts
+	SessionStoreFolder string
+	Topic              string
+	QoS                byte
+	OnMessage          MessageHandler
+	// OnConnect is called after each connection, once the topic is subscribed to
+	OnConnect func(client Client)
+}
+
+// ValidateProtocolVersion checks that a protocol version is empty, 5 or 3.1.1
+func ValidateProtocolVersion(version string) error {
+	switch version {
+	case "", ProtocolVersion5, ProtocolVersion311:
+		return nil
+	}
+	return fmt.Errorf("invalid protocol version '%s', expected '%s' or '%s'", version, ProtocolVersion5, ProtocolVersion311)
+}
+
+// Connect connects to the broker and subscribes to the topic of the config. The client reconnects and
+// subscribes again when the connection is lost.
+func Connect(config ClientConfig) (Client, error) {
+	if err := ValidateProtocolVersion(config.ProtocolVersion); err != nil {
+		return nil, err
+	}
+	if config.ConnectTimeout <= 0 {
+		config.ConnectTimeout = defaultTimeout
+	}
+	if config.ProtocolVersion == ProtocolVersion311 {
+		return connectV311(config)
+	}
+	return connectV5(config)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package mqtt
+
+import (
+	"time"
+
+	gmqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// v311Client is a Client that speaks MQTT 3.1.1, messages don't carry properties
+type v311Client struct {
+	config ClientConfig
+	client gmqtt.Client
+}
+
+func connectV311(config ClientConfig) (Client, error) {
+	ret := &v311Client{config: config}
+	opts := gmqtt.NewClientOptions().AddBroker(config.BrokerAddress).SetClientID(config.ClientID)
+	opts.SetKeepAlive(config.KeepAlive)
+	opts.SetPingTimeout(config.PingTimeout)
+	opts.SetConnectTimeout(config.ConnectTimeout)
+	opts.SetWriteTimeout(config.ConnectTimeout)
+	opts.CleanSession = !config.PersistentSession
+	if config.Username != "" {
+		opts.SetUsername(config.Username)
+	}
+	if config.Password != "" {
+		opts.SetPassword(config.Password)
+	}
+	if config.TLSConfig != nil {
+		opts.SetTLSConfig(config.TLSConfig)
+	}
+	if config.SessionStoreFolder != "" {
+		opts.SetStore(gmqtt.NewFileStore(config.SessionStoreFolder))
+	}
+	opts.SetOnConnectHandler(func(client gmqtt.Client) {
+		// a clean session loses the subscription when the client reconnects
+		if err := ret.subscribe(); err != nil {
+			log.Errorf("MQTT Binding: failed to subscribe to topic %s after reconnecting - %+v", config.Topic, err)
+		}
+		if config.OnConnect != nil {
+			config.OnConnect(ret)
+		}
+	})
+
+	ret.client = gmqtt.NewClient(opts)
+	if token := ret.client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	if err := ret.subscribe(); err != nil {
+		ret.Disconnect()
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *v311Client) subscribe() error {
+	if c.config.Topic == "" {
+		return nil
+	}
+	if token := c.client.Subscribe(c.config.Topic, c.config.QoS, c.handleMessage); token.Wait() && token.Error() != nil {
+		if token.Error().Error() != "subscription exists" {
+			return token.Error()
+		}
+	}
+	return nil
+}
+
+func (c *v311Client) handleMessage(client gmqtt.Client, msg gmqtt.Message) {
+	if c.config.OnMessage != nil {
+		c.config.OnMessage(c, Message{
+			Topic:   msg.Topic(),
+			QoS:     msg.Qos(),
+			Payload: msg.Payload(),
+		})
+	}
+}
+
+func (c *v311Client) HasProperties() bool {
+	return false
+}
+
+func (c *v311Client) IsConnected() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c *v311Client) Publish(message Message, timeout time.Duration) error {
+	token := c.client.Publish(message.Topic, message.QoS, false, message.Payload)
+	// a publish that is still in flight is delivered by the client once acknowledged
+	if token.WaitTimeout(timeout) && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *v311Client) Disconnect() {
+	c.client.Disconnect(1000)
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	"github.com/eclipse/paho.golang/paho/store/file"
+)
+
+// v5Client is a Client that speaks MQTT 5, the connection is restored by the autopaho connection manager
+type v5Client struct {
+	config    ClientConfig
+	manager   *autopaho.ConnectionManager
+	connected atomic.Bool
+}
+
+func connectV5(config ClientConfig) (Client, error) {
+	serverURL, err := url.Parse(config.BrokerAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker address '%s': %w", config.BrokerAddress, err)
+	}
+	ret := &v5Client{config: config}
+	// the result of the first connection attempt, so a broker that can't be reached is reported
+	firstAttempt := make(chan error, 1)
+	report := func(err error) {
+		select {
+		case firstAttempt <- err:
+		default:
+		}
+	}
+
+	clientConfig := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverURL},
+		TlsCfg:                        config.TLSConfig,
+		KeepAlive:                     uint16(config.KeepAlive.Seconds()),
+		CleanStartOnInitialConnection: !config.PersistentSession,
+		ConnectTimeout:                config.ConnectTimeout,
+		ConnectUsername:               config.Username,
+		ConnectPassword:               []byte(config.Password),
+		OnConnectionUp: func(manager *autopaho.ConnectionManager, connack *paho.Connack) {
+			ret.connected.Store(true)
+			// the broker may have lost the session, so the subscription is renewed on every connection
+			err := ret.subscribe(manager)
+			if err != nil {
+				log.Errorf("MQTT Binding: failed to subscribe to topic %s - %+v", config.Topic, err)
+			}
+			report(err)
+			if config.OnConnect != nil {
+				go config.OnConnect(ret)
+			}
+		},
+		OnConnectError: func(err error) {
+			log.Debugf("MQTT Binding: failed to connect to MQTT broker - %+v", err)
+			report(err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: config.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(received paho.PublishReceived) (bool, error) {
+					if config.OnMessage != nil {
+						config.OnMessage(ret, fromPublish(received.Packet, time.Now()))
+					}
+					return true, nil
+				},
+			},
+			OnClientError: func(err error) {
+				ret.connected.Store(false)
+			},
+			OnServerDisconnect: func(disconnect *paho.Disconnect) {
+				ret.connected.Store(false)
+			},
+		},
+	}
+	if config.PersistentSession {
+		// like a session of MQTT 3.1.1 that isn't clean, the session doesn't expire
+		clientConfig.SessionExpiryInterval = math.MaxUint32
+	}
+	if config.SessionStoreFolder != "" {
+		clientStore, err := file.New(config.SessionStoreFolder, "client", ".pkt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open session store folder %s: %w", config.SessionStoreFolder, err)
+		}
+		serverStore, err := file.New(config.SessionStoreFolder, "server", ".pkt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open session store folder %s: %w", config.SessionStoreFolder, err)
+		}
+		clientConfig.Session = state.New(clientStore, serverStore)
+	}
+
+	ret.manager, err = autopaho.NewConnection(context.Background(), clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	// the attempt itself times out after the connect timeout
+	select {
+	case err = <-firstAttempt:
+	case <-time.After(config.ConnectTimeout + time.Second):
+		err = fmt.Errorf("timed out connecting to %s", config.BrokerAddress)
+	}
+	if err != nil {
+		ret.Disconnect()
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *v5Client) subscribe(manager *autopaho.ConnectionManager) error {
+	if c.config.Topic == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.ConnectTimeout)
+	defer cancel()
+	suback, err := manager.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: c.config.Topic, QoS: c.config.QoS}},
+	})
+	if err != nil {
+		return err
+	}
+	if len(suback.Reasons) > 0 && suback.Reasons[0] >= 0x80 {
+		return fmt.Errorf("subscription to topic %s was refused with reason code %d", c.config.Topic, suback.Reasons[0])
+	}
+	return nil
+}
+
+// fromPublish reads the properties of a received message
+func fromPublish(publish *paho.Publish, now time.Time) Message {
+	ret := Message{
+		Topic:   publish.Topic,
+		QoS:     publish.QoS,
+		Payload: publish.Payload,
+	}
+	if publish.Properties != nil {
+		ret.ResponseTopic = publish.Properties.ResponseTopic
+		ret.CorrelationData = publish.Properties.CorrelationData
+		if publish.Properties.MessageExpiry != nil {
+			ret.ExpiresAt = now.Add(time.Duration(*publish.Properties.MessageExpiry) * time.Second)
+		}
+	}
+	return ret
+}
+
+// toPublish sets the properties of a message to publish. The expiry interval is rounded up to a second.
+func toPublish(message Message, now time.Time) *paho.Publish {
+	ret := &paho.Publish{
+		Topic:   message.Topic,
+		QoS:     message.QoS,
+		Payload: message.Payload,
+		Properties: &paho.PublishProperties{
+			ResponseTopic:   message.ResponseTopic,
+			CorrelationData: message.CorrelationData,
+		},
+	}
+	if !message.ExpiresAt.IsZero() {
+		seconds := math.Ceil(message.ExpiresAt.Sub(now).Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+		expiry := uint32(seconds)
+		ret.Properties.MessageExpiry = &expiry
+	}
+	return ret
+}
+
+func (c *v5Client) HasProperties() bool {
+	return true
+}
+
+func (c *v5Client) IsConnected() bool {
+	return c.connected.Load()
+}
+
+func (c *v5Client) Publish(message Message, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := c.manager.Publish(ctx, toPublish(message, time.Now()))
+	if errors.Is(err, context.DeadlineExceeded) {
+		// a publish that is part of the session is still delivered
+		return nil
+	}
+	return err
+}
+
+func (c *v5Client) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.manager.Disconnect(ctx)
+	c.connected.Store(false)
+}
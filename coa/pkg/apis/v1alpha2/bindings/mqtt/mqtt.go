@@ -14,6 +14,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,10 +42,22 @@ type MQTTBindingConfig struct {
 	InsecureSkipVerify string `json:"insecureSkipVerify,omitempty"`
 	Username           string `json:"username,omitempty"`
 	Password           string `json:"password,omitempty"`
+	// ProtocolVersion is "5", the default, or "3.1.1"
+	ProtocolVersion string `json:"protocolVersion,omitempty"`
+	// QoS is the quality of service of subscriptions and responses, 0, 1 or 2
+	QoS int `json:"qos,omitempty"`
+	// SessionStoreFolder keeps in-flight messages of the session across restarts
+	SessionStoreFolder string `json:"sessionStoreFolder,omitempty"`
+	// QueueSize is the number of responses queued while the broker is unreachable
+	QueueSize            int `json:"queueSize,omitempty"`
+	RetryIntervalSeconds int `json:"retryIntervalSeconds,omitempty"`
 }
 
 type MQTTBinding struct {
-	MQTTClient gmqtt.Client
+	MQTTClient Client
+	Outbox     *Outbox
+	config     MQTTBindingConfig
+	cancel     context.CancelFunc
 }
 
 var routeTable map[string]v1alpha2.Endpoint
@@ -60,6 +73,155 @@ func (m *MQTTBinding) Launch(config MQTTBindingConfig, endpoints []v1alpha2.Endp
 		routeTable[route] = endpoint
 	}
 
+	if err := ValidateQoS(config.QoS); err != nil {
+		return v1alpha2.NewCOAError(err, "invalid MQTT binding config", v1alpha2.BadConfig)
+	}
+	if err := ValidateProtocolVersion(config.ProtocolVersion); err != nil {
+		return v1alpha2.NewCOAError(err, "invalid MQTT binding config", v1alpha2.BadConfig)
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 8
+	}
+	m.config = config
+	m.Outbox = NewOutbox(config.QueueSize, time.Duration(config.TimeoutSeconds)*time.Second)
+
+	clientConfig, err := NewClientConfig(config)
+	if err != nil {
+		return err
+	}
+	clientConfig.Topic = config.RequestTopic
+	clientConfig.OnMessage = m.handleRequest
+	clientConfig.OnConnect = m.Outbox.Flush
+
+	m.MQTTClient, err = Connect(clientConfig)
+	if err != nil {
+		log.Errorf("MQTT Binding: failed to connect to MQTT broker - %+v", err)
+
+		// Provide specific guidance for common TLS errors
+		if strings.Contains(err.Error(), "certificate signed by unknown authority") {
+			log.Errorf("MQTT Binding: TLS certificate verification failed. Common solutionversions:")
+			log.Errorf("MQTT Binding: 1. Set 'caCertPath' to the path of your broker's CA certificate")
+			log.Errorf("MQTT Binding: 2. Set 'insecureSkipVerify' to 'true' for testing (not recommended for production)")
+			log.Errorf("MQTT Binding: 3. Ensure your broker certificate is issued by a trusted CA")
+		} else if strings.Contains(err.Error(), "tls:") {
+			log.Errorf("MQTT Binding: TLS connection error. Check your TLS configuration:")
+			log.Errorf("MQTT Binding: - Broker address should use 'ssl://' or 'tls://' prefix for TLS connections")
+			log.Errorf("MQTT Binding: - Verify CA certificate path and format")
+			log.Errorf("MQTT Binding: - Check client certificate and key paths if using mutual TLS")
+		}
+
+		return v1alpha2.NewCOAError(err, "failed to connect to MQTT broker", v1alpha2.InternalError)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go m.Outbox.Run(ctx, m.MQTTClient, time.Duration(config.RetryIntervalSeconds)*time.Second)
+
+	return nil
+}
+
+// handleRequest routes a request to its endpoint and publishes the response on the response topic of the
+// request, or on the response topic of the binding. The response topic, correlation data and expiry of a
+// request are read from its MQTT 5 properties, or from its metadata when it was sent with MQTT 3.1.1.
+func (m *MQTTBinding) handleRequest(client Client, msg Message) {
+	var request v1alpha2.COARequest
+	var response v1alpha2.COAResponse
+	if request.Context == nil {
+		request.Context = context.TODO()
+	}
+	// patch correlation id if missing
+	contexts.GenerateCorrelationIdToParentContextIfMissing(request.Context)
+	err := json.Unmarshal(msg.Payload, &request)
+	expiresAt := msg.ExpiresAt
+	if v, ok := request.Metadata[ExpiresAtKey]; ok && expiresAt.IsZero() {
+		expiresAt, _ = time.Parse(time.RFC3339Nano, v)
+	}
+	if err != nil {
+		response = v1alpha2.COAResponse{
+			State:       v1alpha2.BadRequest,
+			ContentType: "text/plain",
+			Body:        []byte(err.Error()),
+		}
+	} else if !expiresAt.IsZero() && time.Now().After(expiresAt) {
+		// the requester no longer waits for the response, such as requests kept by a persistent session
+		log.Infof("MQTT Binding: dropped expired request %s %s", request.Method, request.Route)
+		return
+	} else {
+		//check if the route is in the route table
+		if _, ok := routeTable[request.Route]; !ok {
+			response = v1alpha2.COAResponse{
+				State:       v1alpha2.NotFound,
+				ContentType: "text/plain",
+				Body:        []byte("route not found"),
+			}
+		} else {
+			response = routeTable[request.Route].Handler(request)
+		}
+	}
+
+	// needs to carry request-id and correlation-data from request into response
+	response.Metadata = replyMetadata(request.Metadata, response.Metadata)
+
+	data, _ := json.Marshal(response)
+
+	message := Message{
+		Topic:           m.config.ResponseTopic,
+		QoS:             byte(m.config.QoS),
+		Payload:         data,
+		CorrelationData: msg.CorrelationData,
+		ExpiresAt:       expiresAt,
+	}
+	if msg.ResponseTopic != "" {
+		message.Topic = msg.ResponseTopic
+	} else if v, ok := request.Metadata[ResponseTopicKey]; ok && v != "" {
+		message.Topic = v
+	}
+	go func() {
+		if err := m.Outbox.Publish(client, message); err != nil {
+			log.Errorf("failed to handle request from MOTT: %s", err)
+		}
+	}()
+}
+
+// NewClientConfig builds the client config for the broker, credentials, TLS and session settings of a
+// binding config. The binding connects with a persistent session.
+func NewClientConfig(config MQTTBindingConfig) (ClientConfig, error) {
+	ret := ClientConfig{
+		ProtocolVersion:    config.ProtocolVersion,
+		BrokerAddress:      config.BrokerAddress,
+		ClientID:           config.ClientID,
+		Username:           config.Username,
+		Password:           config.Password,
+		KeepAlive:          time.Duration(config.KeepAliveSeconds) * time.Second,
+		PingTimeout:        time.Duration(config.PingTimeoutSeconds) * time.Second,
+		ConnectTimeout:     time.Duration(config.TimeoutSeconds) * time.Second,
+		PersistentSession:  true,
+		SessionStoreFolder: config.SessionStoreFolder,
+		QoS:                byte(config.QoS),
+	}
+	if ret.KeepAlive <= 0 {
+		ret.KeepAlive = 2 * time.Second
+	}
+	if ret.PingTimeout <= 0 {
+		ret.PingTimeout = 1 * time.Second
+	}
+	if ret.ConnectTimeout <= 0 {
+		ret.ConnectTimeout = defaultTimeout
+	}
+	if config.UseTLS == "true" {
+		tlsConfig, err := (&MQTTBinding{}).createTLSConfig(config)
+		if err != nil {
+			log.Errorf("MQTT Binding: failed to create TLS config - %+v", err)
+			return ret, v1alpha2.NewCOAError(err, "failed to create TLS config", v1alpha2.InternalError)
+		}
+		ret.TLSConfig = tlsConfig
+	}
+	return ret, nil
+}
+
+// NewClientOptions builds the MQTT 3.1.1 client options for the broker, credentials and TLS
+// settings of a binding config, for components that publish notifications without the binding
+func NewClientOptions(config MQTTBindingConfig) (*gmqtt.ClientOptions, error) {
 	// Set default values
 	if config.TimeoutSeconds <= 0 {
 		config.TimeoutSeconds = 8
@@ -91,94 +253,53 @@ func (m *MQTTBinding) Launch(config MQTTBindingConfig, endpoints []v1alpha2.Endp
 
 	// Configure TLS if enabled
 	if config.UseTLS == "true" {
-		tlsConfig, err := m.createTLSConfig(config)
+		tlsConfig, err := (&MQTTBinding{}).createTLSConfig(config)
 		if err != nil {
 			log.Errorf("MQTT Binding: failed to create TLS config - %+v", err)
-			return v1alpha2.NewCOAError(err, "failed to create TLS config", v1alpha2.InternalError)
+			return nil, v1alpha2.NewCOAError(err, "failed to create TLS config", v1alpha2.InternalError)
 		}
 		opts.SetTLSConfig(tlsConfig)
 	}
-
-	m.MQTTClient = gmqtt.NewClient(opts)
-	if token := m.MQTTClient.Connect(); token.Wait() && token.Error() != nil {
-		connErr := token.Error()
-		log.Errorf("MQTT Binding: failed to connect to MQTT broker - %+v", connErr)
-		
-		// Provide specific guidance for common TLS errors
-		if strings.Contains(connErr.Error(), "certificate signed by unknown authority") {
-			log.Errorf("MQTT Binding: TLS certificate verification failed. Common solutionversions:")
-			log.Errorf("MQTT Binding: 1. Set 'caCertPath' to the path of your broker's CA certificate")
-			log.Errorf("MQTT Binding: 2. Set 'insecureSkipVerify' to 'true' for testing (not recommended for production)")
-			log.Errorf("MQTT Binding: 3. Ensure your broker certificate is issued by a trusted CA")
-		} else if strings.Contains(connErr.Error(), "tls:") {
-			log.Errorf("MQTT Binding: TLS connection error. Check your TLS configuration:")
-			log.Errorf("MQTT Binding: - Broker address should use 'ssl://' or 'tls://' prefix for TLS connections")
-			log.Errorf("MQTT Binding: - Verify CA certificate path and format")
-			log.Errorf("MQTT Binding: - Check client certificate and key paths if using mutual TLS")
-		}
-		
-		return v1alpha2.NewCOAError(connErr, "failed to connect to MQTT broker", v1alpha2.InternalError)
+	if config.SessionStoreFolder != "" {
+		opts.SetStore(gmqtt.NewFileStore(config.SessionStoreFolder))
 	}
+	return opts, nil
+}
 
-	if token := m.MQTTClient.Subscribe(config.RequestTopic, 0, func(client gmqtt.Client, msg gmqtt.Message) {
-		var request v1alpha2.COARequest
-		var response v1alpha2.COAResponse
-		if request.Context == nil {
-			request.Context = context.TODO()
-		}
-		// patch correlation id if missing
-		contexts.GenerateCorrelationIdToParentContextIfMissing(request.Context)
-		err := json.Unmarshal(msg.Payload(), &request)
-		if err != nil {
-			response = v1alpha2.COAResponse{
-				State:       v1alpha2.BadRequest,
-				ContentType: "text/plain",
-				Body:        []byte(err.Error()),
-			}
-		} else {
-			//check if the route is in the route table
-			if _, ok := routeTable[request.Route]; !ok {
-				response = v1alpha2.COAResponse{
-					State:       v1alpha2.NotFound,
-					ContentType: "text/plain",
-					Body:        []byte("route not found"),
-				}
-			} else {
-				response = routeTable[request.Route].Handler(request)
-			}
-		}
-
-		// needs to carry request-id from request into response
-		if request.Metadata != nil {
-			if v, ok := request.Metadata["request-id"]; ok {
-				if response.Metadata == nil {
-					response.Metadata = make(map[string]string)
-				}
-				response.Metadata["request-id"] = v
-			}
-			if v, ok := request.Metadata["request-id"]; ok {
-				if response.Metadata == nil {
-					response.Metadata = make(map[string]string)
-				}
-				response.Metadata["request-id"] = v
-			}
-		}
-
-		data, _ := json.Marshal(response)
-
-		go func() {
-			if token := client.Publish(config.ResponseTopic, 0, false, data); token.Wait() && token.Error() != nil {
-				log.Errorf("failed to handle request from MOTT: %s", token.Error())
+// ConfigFromProperties reads a binding config from flat manager properties, where each
+// field is keyed by the prefix followed by its JSON name, such as "push.mqtt.brokerAddress"
+func ConfigFromProperties(properties map[string]string, prefix string) (MQTTBindingConfig, error) {
+	config := MQTTBindingConfig{
+		BrokerAddress:      properties[prefix+"brokerAddress"],
+		ClientID:           properties[prefix+"clientID"],
+		RequestTopic:       properties[prefix+"requestTopic"],
+		ResponseTopic:      properties[prefix+"responseTopic"],
+		UseTLS:             properties[prefix+"useTLS"],
+		CACertPath:         properties[prefix+"caCertPath"],
+		ClientCertPath:     properties[prefix+"clientCertPath"],
+		ClientKeyPath:      properties[prefix+"clientKeyPath"],
+		InsecureSkipVerify: properties[prefix+"insecureSkipVerify"],
+		Username:           properties[prefix+"username"],
+		Password:           properties[prefix+"password"],
+		SessionStoreFolder: properties[prefix+"sessionStoreFolder"],
+	}
+	for key, field := range map[string]*int{
+		"timeoutSeconds":       &config.TimeoutSeconds,
+		"keepAliveSeconds":     &config.KeepAliveSeconds,
+		"pingTimeoutSeconds":   &config.PingTimeoutSeconds,
+		"qos":                  &config.QoS,
+		"queueSize":            &config.QueueSize,
+		"retryIntervalSeconds": &config.RetryIntervalSeconds,
+	} {
+		if v, ok := properties[prefix+key]; ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return config, v1alpha2.NewCOAError(err, fmt.Sprintf("invalid %s%s: %s", prefix, key, v), v1alpha2.BadConfig)
 			}
-		}()
-	}); token.Wait() && token.Error() != nil {
-		if token.Error().Error() != "subscription exists" {
-			log.Errorf("  P (MQTT Target): faild to connect to subscribe to request topic - %+v", token.Error())
-			return v1alpha2.NewCOAError(token.Error(), "failed to subscribe to request topic", v1alpha2.InternalError)
+			*field = n
 		}
 	}
-
-	return nil
+	return config, nil
 }
 
 // createTLSConfig creates a TLS configuration for MQTT client authentication
@@ -260,6 +381,11 @@ func isCertificatePEM(data []byte) bool {
 
 // Shutdown stops the MQTT binding
 func (m *MQTTBinding) Shutdown(ctx context.Context) error {
-	m.MQTTClient.Disconnect(1000)
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.MQTTClient != nil {
+		m.MQTTClient.Disconnect()
+	}
 	return nil
 }
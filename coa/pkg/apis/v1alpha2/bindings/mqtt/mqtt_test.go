@@ -210,3 +210,255 @@ func TestMQTTEchoWithCallContext(t *testing.T) {
 	token.Wait()
 	<-sig
 }
+
+func TestConfigFromProperties(t *testing.T) {
+	config, err := ConfigFromProperties(map[string]string{
+		"push.mqtt.brokerAddress":  "tcp://localhost:1883",
+		"push.mqtt.clientID":       "site-a",
+		"push.mqtt.useTLS":         "true",
+		"push.mqtt.timeoutSeconds": "5",
+		"push.mqtt.qos":            "1",
+		"brokerAddress":            "tcp://ignored:1883",
+	}, "push.mqtt.")
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp://localhost:1883", config.BrokerAddress)
+	assert.Equal(t, "site-a", config.ClientID)
+	assert.Equal(t, "true", config.UseTLS)
+	assert.Equal(t, 5, config.TimeoutSeconds)
+	assert.Equal(t, 0, config.KeepAliveSeconds)
+	assert.Equal(t, 1, config.QoS)
+
+	_, err = ConfigFromProperties(map[string]string{
+		"push.mqtt.keepAliveSeconds": "soon",
+	}, "push.mqtt.")
+	assert.NotNil(t, err)
+}
+
+func TestNewClientOptions(t *testing.T) {
+	opts, err := NewClientOptions(MQTTBindingConfig{
+		BrokerAddress: "tcp://localhost:1883",
+		ClientID:      "site-a",
+		Username:      "user",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "site-a", opts.ClientID)
+	assert.Equal(t, "user", opts.Username)
+	assert.Equal(t, 8*time.Second, opts.ConnectTimeout)
+	assert.Equal(t, int64(2), opts.KeepAlive)
+}
+
+func newTestBinding() *MQTTBinding {
+	routeTable = map[string]v1alpha2.Endpoint{
+		"greetings": {
+			Methods: []string{"GET"},
+			Route:   "greetings",
+			Handler: func(c v1alpha2.COARequest) v1alpha2.COAResponse {
+				return v1alpha2.COAResponse{
+					State: v1alpha2.OK,
+					Body:  []byte("Hi there!!"),
+				}
+			},
+		},
+	}
+	return &MQTTBinding{
+		Outbox: NewOutbox(10, time.Second),
+		config: MQTTBindingConfig{
+			RequestTopic:  "coa-request",
+			ResponseTopic: "coa-response",
+			QoS:           1,
+		},
+	}
+}
+
+func handleTestRequest(t *testing.T, binding *MQTTBinding, client *fakeClient, request v1alpha2.COARequest) (Message, v1alpha2.COAResponse) {
+	data, _ := json.Marshal(request)
+	binding.handleRequest(client, Message{Topic: "coa-request", Payload: data})
+	var messages []Message
+	assert.Eventually(t, func() bool {
+		messages = client.messages()
+		return len(messages) == 1
+	}, time.Second, 10*time.Millisecond)
+	var response v1alpha2.COAResponse
+	err := json.Unmarshal(messages[0].Payload, &response)
+	assert.Nil(t, err)
+	return messages[0], response
+}
+
+func TestHandleRequestResponseTopic(t *testing.T) {
+	binding := newTestBinding()
+	client := &fakeClient{}
+	message, response := handleTestRequest(t, binding, client, v1alpha2.COARequest{
+		Route:  "greetings",
+		Method: "GET",
+		Metadata: map[string]string{
+			RequestIDKey:       "1",
+			ResponseTopicKey:   "coa-response/target-a",
+			CorrelationDataKey: "abc",
+		},
+	})
+	assert.Equal(t, "coa-response/target-a", message.Topic)
+	assert.Equal(t, byte(1), message.QoS)
+	assert.Equal(t, "Hi there!!", string(response.Body))
+	assert.Equal(t, "1", response.Metadata[RequestIDKey])
+	assert.Equal(t, "abc", response.Metadata[CorrelationDataKey])
+}
+
+func TestHandleRequestDefaultResponseTopic(t *testing.T) {
+	binding := newTestBinding()
+	client := &fakeClient{}
+	message, response := handleTestRequest(t, binding, client, v1alpha2.COARequest{
+		Route:    "greetings",
+		Method:   "GET",
+		Metadata: map[string]string{RequestIDKey: "1"},
+	})
+	assert.Equal(t, "coa-response", message.Topic)
+	assert.Equal(t, "1", response.Metadata[RequestIDKey])
+	_, ok := response.Metadata[CorrelationDataKey]
+	assert.False(t, ok)
+}
+
+func TestHandleRequestExpired(t *testing.T) {
+	binding := newTestBinding()
+	client := &fakeClient{}
+	called := false
+	routeTable["greetings"] = v1alpha2.Endpoint{
+		Handler: func(c v1alpha2.COARequest) v1alpha2.COAResponse {
+			called = true
+			return v1alpha2.COAResponse{}
+		},
+	}
+	data, _ := json.Marshal(v1alpha2.COARequest{
+		Route:    "greetings",
+		Method:   "GET",
+		Metadata: map[string]string{ExpiresAtKey: time.Now().Add(-time.Minute).Format(time.RFC3339Nano)},
+	})
+	binding.handleRequest(client, Message{Topic: "coa-request", Payload: data})
+	assert.False(t, called)
+	assert.Equal(t, 0, binding.Outbox.Len())
+	assert.Empty(t, client.messages())
+}
+
+func TestHandleRequestQueuedWhileOffline(t *testing.T) {
+	binding := newTestBinding()
+	client := &fakeClient{offline: true}
+	data, _ := json.Marshal(v1alpha2.COARequest{
+		Route:    "greetings",
+		Method:   "GET",
+		Metadata: map[string]string{RequestIDKey: "1"},
+	})
+	binding.handleRequest(client, Message{Topic: "coa-request", Payload: data})
+	assert.Eventually(t, func() bool {
+		return binding.Outbox.Len() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	client.setOffline(false)
+	binding.Outbox.Flush(client)
+	messages := client.messages()
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "coa-response", messages[0].Topic)
+}
+
+func TestHandleRequestProperties(t *testing.T) {
+	binding := newTestBinding()
+	client := &fakeClient{properties: true}
+	expiresAt := time.Now().Add(time.Minute)
+	data, _ := json.Marshal(v1alpha2.COARequest{
+		Route:  "greetings",
+		Method: "GET",
+	})
+	binding.handleRequest(client, Message{
+		Topic:           "coa-request",
+		Payload:         data,
+		ResponseTopic:   "coa-response/target-a",
+		CorrelationData: []byte("abc"),
+		ExpiresAt:       expiresAt,
+	})
+	var messages []Message
+	assert.Eventually(t, func() bool {
+		messages = client.messages()
+		return len(messages) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "coa-response/target-a", messages[0].Topic)
+	assert.Equal(t, []byte("abc"), messages[0].CorrelationData)
+	assert.Equal(t, expiresAt, messages[0].ExpiresAt)
+	var response v1alpha2.COAResponse
+	assert.Nil(t, json.Unmarshal(messages[0].Payload, &response))
+	assert.Equal(t, "Hi there!!", string(response.Body))
+	// the properties aren't copied into the metadata
+	assert.Empty(t, response.Metadata)
+}
+
+func TestHandleRequestExpiredProperty(t *testing.T) {
+	binding := newTestBinding()
+	client := &fakeClient{properties: true}
+	data, _ := json.Marshal(v1alpha2.COARequest{Route: "greetings", Method: "GET"})
+	binding.handleRequest(client, Message{Topic: "coa-request", Payload: data, ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Equal(t, 0, binding.Outbox.Len())
+	assert.Empty(t, client.messages())
+}
+
+func TestPublishProperties(t *testing.T) {
+	now := time.Now()
+	publish := toPublish(Message{
+		Topic:           "coa-request",
+		QoS:             1,
+		Payload:         []byte("{}"),
+		ResponseTopic:   "coa-response",
+		CorrelationData: []byte("abc"),
+		ExpiresAt:       now.Add(1500 * time.Millisecond),
+	}, now)
+	assert.Equal(t, "coa-response", publish.Properties.ResponseTopic)
+	assert.Equal(t, []byte("abc"), publish.Properties.CorrelationData)
+	assert.Equal(t, uint32(2), *publish.Properties.MessageExpiry)
+
+	message := fromPublish(publish, now)
+	assert.Equal(t, "coa-request", message.Topic)
+	assert.Equal(t, byte(1), message.QoS)
+	assert.Equal(t, "coa-response", message.ResponseTopic)
+	assert.Equal(t, []byte("abc"), message.CorrelationData)
+	assert.Equal(t, now.Add(2*time.Second), message.ExpiresAt)
+
+	// messages without expiry don't expire
+	publish = toPublish(Message{Topic: "coa-request"}, now)
+	assert.Nil(t, publish.Properties.MessageExpiry)
+	assert.True(t, fromPublish(publish, now).ExpiresAt.IsZero())
+}
+
+func TestLaunchInvalidQoS(t *testing.T) {
+	binding := MQTTBinding{}
+	err := binding.Launch(MQTTBindingConfig{BrokerAddress: "tcp://localhost:1883", QoS: 3}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestLaunchInvalidProtocolVersion(t *testing.T) {
+	binding := MQTTBinding{}
+	err := binding.Launch(MQTTBindingConfig{BrokerAddress: "tcp://localhost:1883", ProtocolVersion: "4"}, nil)
+	assert.NotNil(t, err)
+	assert.True(t, v1alpha2.IsBadConfig(err))
+	assert.Nil(t, ValidateProtocolVersion(""))
+	assert.Nil(t, ValidateProtocolVersion(ProtocolVersion311))
+}
+
+func TestNewClientConfig(t *testing.T) {
+	config, err := NewClientConfig(MQTTBindingConfig{
+		BrokerAddress:   "tcp://localhost:1883",
+		ClientID:        "agent-a",
+		ProtocolVersion: ProtocolVersion311,
+		QoS:             1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, ProtocolVersion311, config.ProtocolVersion)
+	assert.Equal(t, "agent-a", config.ClientID)
+	assert.True(t, config.PersistentSession)
+	assert.Equal(t, byte(1), config.QoS)
+	assert.Equal(t, 8*time.Second, config.ConnectTimeout)
+	assert.Equal(t, 2*time.Second, config.KeepAlive)
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, IsExpired(nil, now))
+	assert.False(t, IsExpired(map[string]string{ExpiresAtKey: now.Add(time.Minute).Format(time.RFC3339Nano)}, now))
+	assert.True(t, IsExpired(map[string]string{ExpiresAtKey: now.Add(-time.Minute).Format(time.RFC3339Nano)}, now))
+	assert.False(t, IsExpired(map[string]string{ExpiresAtKey: "soon"}, now))
+}
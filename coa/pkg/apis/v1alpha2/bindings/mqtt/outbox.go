@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultQueueSize is the default number of messages an outbox holds
+	DefaultQueueSize = 100
+	// DefaultRetryIntervalSeconds is the default interval between attempts to publish queued messages
+	DefaultRetryIntervalSeconds = 5
+)
+
+// Outbox queues the messages that couldn't be published while the broker is unreachable, and publishes
+// them in order once the client is connected again
+type Outbox struct {
+	size     int
+	timeout  time.Duration
+	lock     sync.Mutex
+	messages []Message
+}
+
+// NewOutbox creates an outbox that holds up to size messages, and waits up to timeout for each publish
+func NewOutbox(size int, timeout time.Duration) *Outbox {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &Outbox{
+		size:    size,
+		timeout: timeout,
+	}
+}
+
+// Publish queues a message and publishes the queue if the client is connected. Messages stay queued
+// when the publish fails, and an error is only returned when the queue is full.
+func (o *Outbox) Publish(client Client, message Message) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.dropExpired(time.Now())
+	if len(o.messages) >= o.size {
+		return fmt.Errorf("outbox is full with %d messages", len(o.messages))
+	}
+	o.messages = append(o.messages, message)
+	o.flush(client)
+	return nil
+}
+
+// Flush publishes the queued messages in order, until a publish fails
+func (o *Outbox) Flush(client Client) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.dropExpired(time.Now())
+	o.flush(client)
+}
+
+// Len returns the number of queued messages
+func (o *Outbox) Len() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.messages)
+}
+
+// Run flushes the outbox at an interval until the context is done
+func (o *Outbox) Run(ctx context.Context, client Client, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRetryIntervalSeconds * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.Flush(client)
+		}
+	}
+}
+
+func (o *Outbox) flush(client Client) {
+	for len(o.messages) > 0 && client.IsConnected() {
+		message := o.messages[0]
+		if err := client.Publish(message, o.timeout); err != nil {
+			log.Debugf("MQTT Binding: failed to publish queued message on topic %s - %+v", message.Topic, err)
+			return
+		}
+		o.messages = o.messages[1:]
+	}
+}
+
+func (o *Outbox) dropExpired(now time.Time) {
+	kept := o.messages[:0]
+	for _, message := range o.messages {
+		if message.ExpiresAt.IsZero() || now.Before(message.ExpiresAt) {
+			kept = append(kept, message)
+		} else {
+			log.Debugf("MQTT Binding: dropped expired message on topic %s", message.Topic)
+		}
+	}
+	o.messages = kept
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient records published messages, and fails to publish while it's offline
+type fakeClient struct {
+	lock       sync.Mutex
+	offline    bool
+	properties bool
+	published  []Message
+}
+
+func (c *fakeClient) setOffline(offline bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.offline = offline
+}
+
+func (c *fakeClient) messages() []Message {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Message{}, c.published...)
+}
+
+func (c *fakeClient) HasProperties() bool { return c.properties }
+func (c *fakeClient) IsConnected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.offline
+}
+func (c *fakeClient) Publish(message Message, timeout time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.offline {
+		return errors.New("not connected")
+	}
+	c.published = append(c.published, message)
+	return nil
+}
+func (c *fakeClient) Disconnect() {}
+
+func TestOutboxPublish(t *testing.T) {
+	client := &fakeClient{}
+	outbox := NewOutbox(0, time.Second)
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", QoS: 1, Payload: []byte("1")}))
+	assert.Equal(t, 0, outbox.Len())
+	assert.Equal(t, []Message{{Topic: "a", QoS: 1, Payload: []byte("1")}}, client.messages())
+}
+
+func TestOutboxQueuesWhileOffline(t *testing.T) {
+	client := &fakeClient{offline: true}
+	outbox := NewOutbox(10, time.Second)
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("1")}))
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("2")}))
+	assert.Equal(t, 2, outbox.Len())
+	assert.Empty(t, client.messages())
+
+	client.setOffline(false)
+	// messages published after a reconnect are sent after the queued ones
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("3")}))
+	assert.Equal(t, 0, outbox.Len())
+	messages := client.messages()
+	assert.Equal(t, 3, len(messages))
+	for n, message := range messages {
+		assert.Equal(t, []byte{byte('1' + n)}, message.Payload)
+	}
+}
+
+func TestOutboxFull(t *testing.T) {
+	client := &fakeClient{offline: true}
+	outbox := NewOutbox(1, time.Second)
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("1")}))
+	assert.NotNil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("2")}))
+	assert.Equal(t, 1, outbox.Len())
+}
+
+func TestOutboxDropsExpiredMessages(t *testing.T) {
+	client := &fakeClient{offline: true}
+	outbox := NewOutbox(1, time.Second)
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("1"), ExpiresAt: time.Now().Add(-time.Second)}))
+	// the expired message makes room for the next one
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("2")}))
+
+	client.setOffline(false)
+	outbox.Flush(client)
+	assert.Equal(t, []Message{{Topic: "a", Payload: []byte("2")}}, client.messages())
+}
+
+func TestOutboxRun(t *testing.T) {
+	client := &fakeClient{offline: true}
+	outbox := NewOutbox(1, time.Second)
+	assert.Nil(t, outbox.Publish(client, Message{Topic: "a", Payload: []byte("1")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outbox.Run(ctx, client, 10*time.Millisecond)
+	client.setOffline(false)
+	assert.Eventually(t, func() bool {
+		return len(client.messages()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
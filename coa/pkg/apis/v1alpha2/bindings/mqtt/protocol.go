@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package mqtt
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metadata keys of requests and responses exchanged between the MQTT target provider and the binding.
+// With MQTT 5, the response topic, correlation data and expiry are properties of the messages. With
+// MQTT 3.1.1, they're carried in the metadata of the messages instead.
+const (
+	// RequestIDKey is the id of a request, which is echoed in its response
+	RequestIDKey = "request-id"
+	// ResponseTopicKey is the topic a request is answered on, like the response topic property of MQTT 5.
+	// Requests without it are answered on the response topic of the binding.
+	ResponseTopicKey = "response-topic"
+	// CorrelationDataKey correlates a response with its request, like the correlation data property of MQTT 5
+	CorrelationDataKey = "correlation-data"
+	// ExpiresAtKey is the RFC 3339 time after which the requester no longer waits for a response, like the
+	// message expiry interval of MQTT 5. Expired requests aren't handled.
+	ExpiresAtKey = "expires-at"
+)
+
+// ValidateQoS checks that a quality of service level is 0, 1 or 2
+func ValidateQoS(qos int) error {
+	if qos < 0 || qos > 2 {
+		return fmt.Errorf("invalid QoS %d, expected 0, 1 or 2", qos)
+	}
+	return nil
+}
+
+// IsExpired returns whether the metadata of a request has an expiry time that has passed
+func IsExpired(metadata map[string]string, now time.Time) bool {
+	if v, ok := metadata[ExpiresAtKey]; ok {
+		if expiresAt, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return now.After(expiresAt)
+		}
+	}
+	return false
+}
+
+// replyMetadata copies the request id and correlation data of a request into the metadata of its response
+func replyMetadata(request map[string]string, response map[string]string) map[string]string {
+	for _, key := range []string{RequestIDKey, CorrelationDataKey} {
+		if v, ok := request[key]; ok {
+			if response == nil {
+				response = make(map[string]string)
+			}
+			response[key] = v
+		}
+	}
+	return response
+}
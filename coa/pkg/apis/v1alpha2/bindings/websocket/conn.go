@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+)
+
+// Conn is a websocket connection of a remote agent. Messages can be sent from any goroutine, and are
+// received by a single goroutine. A connection sends a ping every heartbeat interval, and is closed when
+// nothing is received from the other side for a few intervals.
+type Conn struct {
+	conn      *gws.Conn
+	heartbeat time.Duration
+	lock      sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConn wraps a websocket connection and starts its heartbeats
+func NewConn(conn *gws.Conn, heartbeatSeconds int) *Conn {
+	c := &Conn{
+		conn:      conn,
+		heartbeat: heartbeatInterval(heartbeatSeconds),
+		done:      make(chan struct{}),
+	}
+	c.extendDeadline()
+	conn.SetPongHandler(func(string) error {
+		c.extendDeadline()
+		return nil
+	})
+	conn.SetPingHandler(func(data string) error {
+		c.extendDeadline()
+		err := conn.WriteControl(gws.PongMessage, []byte(data), time.Now().Add(writeTimeout))
+		if err == gws.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	go c.sendHeartbeats()
+	return c
+}
+
+func (c *Conn) extendDeadline() {
+	c.conn.SetReadDeadline(time.Now().Add(missedHeartbeats * c.heartbeat))
+}
+
+func (c *Conn) sendHeartbeats() {
+	ticker := time.NewTicker(c.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(gws.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// Send writes a message
+func (c *Conn) Send(message Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(message)
+}
+
+// Receive reads the next message, and skips messages that can't be read. It returns an error when the
+// connection is closed or lost.
+func (c *Conn) Receive() (Message, error) {
+	for {
+		var message Message
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return message, err
+		}
+		c.extendDeadline()
+		if err = json.Unmarshal(data, &message); err != nil {
+			log.Errorf("WebSocket Binding: dropped invalid message - %+v", err)
+			continue
+		}
+		return message, nil
+	}
+}
+
+// Done is closed when the connection is closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close sends a close message and closes the connection
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.WriteControl(gws.CloseMessage, gws.FormatCloseMessage(gws.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		err = c.conn.Close()
+	})
+	return err
+}
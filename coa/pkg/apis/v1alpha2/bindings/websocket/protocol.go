@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+)
+
+// Types of the messages exchanged between a remote agent and the Symphony API. An agent dials out to
+// the API, sends a register message and waits for a registered (or error) message. After that, the API
+// sends request messages over the connection, and the agent answers each with a response message of
+// the same id. Both sides send websocket pings as heartbeats.
+const (
+	MessageRegister   = "register"
+	MessageRegistered = "registered"
+	MessageRequest    = "request"
+	MessageResponse   = "response"
+	MessageError      = "error"
+)
+
+const (
+	// ConnectRoute is the route of the targets vendor agents connect to, followed by the target name
+	ConnectRoute = "targets/connect"
+	// DefaultHeartbeatSeconds is the default interval between heartbeats
+	DefaultHeartbeatSeconds = 15
+	// DefaultQueueSize is the default number of messages queued while an agent is disconnected
+	DefaultQueueSize = 100
+	// missedHeartbeats is the number of heartbeat intervals without any message after which a
+	// connection is considered lost
+	missedHeartbeats = 3
+	// writeTimeout is how long writing a message can take
+	writeTimeout = 10 * time.Second
+)
+
+// Message is a message exchanged between a remote agent and the Symphony API
+type Message struct {
+	Type string `json:"type"`
+	// ID identifies a request, and is echoed in its response. Requests that are sent again after a
+	// reconnect keep their id, so agents can answer them without running them twice.
+	ID           string                `json:"id,omitempty"`
+	Registration *Registration         `json:"registration,omitempty"`
+	Request      *v1alpha2.COARequest  `json:"request,omitempty"`
+	Response     *v1alpha2.COAResponse `json:"response,omitempty"`
+	// ExpiresAt is the time after which the API no longer waits for the response of a request.
+	// Expired requests aren't run.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Registration is sent by an agent when it connects
+type Registration struct {
+	Target    string `json:"target"`
+	Namespace string `json:"namespace,omitempty"`
+	// Spec is the target spec the agent registers its target with. Agents without a spec connect to
+	// a target that already exists.
+	Spec json.RawMessage `json:"spec,omitempty"`
+	// Properties are reported as the status properties of the target
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// IsExpired returns whether a message has an expiry time that has passed
+func (m Message) IsExpired(now time.Time) bool {
+	return m.ExpiresAt != nil && now.After(*m.ExpiresAt)
+}
+
+func heartbeatInterval(seconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = DefaultHeartbeatSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	gws "github.com/gorilla/websocket"
+	"github.com/valyala/fasthttp"
+)
+
+var upgrader = gws.Upgrader{}
+
+// IsUpgradeRequest returns whether a request asks to switch to the websocket protocol
+func IsUpgradeRequest(reqCtx *fasthttp.RequestCtx) bool {
+	return reqCtx.IsGet() &&
+		headerContains(reqCtx, "Connection", "upgrade") &&
+		headerContains(reqCtx, "Upgrade", "websocket") &&
+		headerContains(reqCtx, "Sec-WebSocket-Version", "13") &&
+		len(reqCtx.Request.Header.Peek("Sec-WebSocket-Key")) > 0
+}
+
+func headerContains(reqCtx *fasthttp.RequestCtx, key string, value string) bool {
+	for _, token := range strings.Split(string(reqCtx.Request.Header.Peek(key)), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Upgrade switches the connection of a request that is served by the HTTP binding to the websocket
+// protocol. The handler runs on its own goroutine once the request handler returns, and the connection
+// is closed when the handler returns.
+func Upgrade(reqCtx *fasthttp.RequestCtx, heartbeatSeconds int, handler func(conn *Conn)) error {
+	if !IsUpgradeRequest(reqCtx) {
+		return v1alpha2.NewCOAError(nil, "not a websocket handshake", v1alpha2.BadRequest)
+	}
+	request, err := toHTTPRequest(reqCtx)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "invalid websocket handshake", v1alpha2.BadRequest)
+	}
+	// the handshake response is written by the upgrader, not by the HTTP binding
+	reqCtx.HijackSetNoResponse(true)
+	reqCtx.Hijack(func(netConn net.Conn) {
+		conn, err := upgrader.Upgrade(&hijackedWriter{conn: netConn, header: http.Header{}}, request, nil)
+		if err != nil {
+			log.Errorf("WebSocket Binding: failed to upgrade connection from %s - %+v", netConn.RemoteAddr(), err)
+			netConn.Close()
+			return
+		}
+		c := NewConn(conn, heartbeatSeconds)
+		defer c.Close()
+		handler(c)
+	})
+	return nil
+}
+
+func toHTTPRequest(reqCtx *fasthttp.RequestCtx) (*http.Request, error) {
+	request, err := http.NewRequest(string(reqCtx.Method()), reqCtx.URI().String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	reqCtx.Request.Header.VisitAll(func(key, value []byte) {
+		request.Header.Add(string(key), string(value))
+	})
+	request.Host = string(reqCtx.Host())
+	request.RemoteAddr = reqCtx.RemoteAddr().String()
+	return request, nil
+}
+
+// hijackedWriter hands a connection that is already hijacked from fasthttp to the upgrader
+type hijackedWriter struct {
+	conn   net.Conn
+	header http.Header
+	status int
+}
+
+func (w *hijackedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hijackedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// Write answers handshakes the upgrader rejects
+func (w *hijackedWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	fmt.Fprintf(w.conn, "HTTP/1.1 %d %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", w.status, http.StatusText(w.status), len(data))
+	return w.conn.Write(data)
+}
+
+func (w *hijackedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
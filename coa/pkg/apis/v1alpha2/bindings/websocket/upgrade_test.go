@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package websocket
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestUpgrade(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &fasthttp.Server{
+		Handler: func(reqCtx *fasthttp.RequestCtx) {
+			err := Upgrade(reqCtx, 1, func(conn *Conn) {
+				message, err := conn.Receive()
+				if err == nil {
+					message.Type = MessageRegistered
+					conn.Send(message)
+				}
+			})
+			if err != nil {
+				reqCtx.SetStatusCode(fasthttp.StatusBadRequest)
+				reqCtx.SetBodyString(err.Error())
+			}
+		},
+	}
+	go server.Serve(listener)
+	defer server.Shutdown()
+
+	address := "ws://" + listener.Addr().String() + "/v1alpha2/targets/connect/edge"
+	ws, _, err := gws.DefaultDialer.Dial(address, nil)
+	assert.Nil(t, err)
+	conn := NewConn(ws, 1)
+	defer conn.Close()
+	assert.Nil(t, conn.Send(Message{Type: MessageRegister, Registration: &Registration{Target: "edge"}}))
+	message, err := conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, MessageRegistered, message.Type)
+	assert.Equal(t, "edge", message.Registration.Target)
+
+	// the handler returns when the connection is closed by the other side
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// requests that aren't websocket handshakes are answered by the HTTP server
+	resp, err := http.Get("http://" + listener.Addr().String() + "/v1alpha2/targets/connect/edge")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
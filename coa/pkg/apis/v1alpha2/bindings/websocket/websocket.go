@@ -0,0 +1,387 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger/contexts"
+	gws "github.com/gorilla/websocket"
+)
+
+var log = logger.NewLogger("coa.runtime")
+
+const (
+	defaultReconnectMinSeconds = 1
+	defaultReconnectMaxSeconds = 60
+	// recentResponses is the number of responses an agent remembers, to answer requests that are sent
+	// again after a reconnect without running them twice
+	recentResponses = 64
+)
+
+// WebSocketBindingConfig configures a remote agent that dials out to the Symphony API
+type WebSocketBindingConfig struct {
+	// ServerURL is the base URL of the Symphony API, such as https://symphony:8081/v1alpha2/
+	ServerURL string `json:"serverUrl"`
+	// Target is the name of the target the agent serves
+	Target    string `json:"target"`
+	Namespace string `json:"namespace,omitempty"`
+	// TargetSpec registers the target with this spec when the agent connects
+	TargetSpec map[string]interface{} `json:"targetSpec,omitempty"`
+	// Properties are reported as the status properties of the target
+	Properties map[string]string `json:"properties,omitempty"`
+	// Token is sent as a bearer token. TokenPath is read again on every connection, so rotated
+	// tokens are picked up.
+	Token              string `json:"token,omitempty"`
+	TokenPath          string `json:"tokenPath,omitempty"`
+	CACertPath         string `json:"caCertPath,omitempty"`
+	ClientCertPath     string `json:"clientCertPath,omitempty"`
+	ClientKeyPath      string `json:"clientKeyPath,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	HeartbeatSeconds   int    `json:"heartbeatSeconds,omitempty"`
+	// ReconnectMinSeconds and ReconnectMaxSeconds bound the backoff between connection attempts
+	ReconnectMinSeconds int `json:"reconnectMinSeconds,omitempty"`
+	ReconnectMaxSeconds int `json:"reconnectMaxSeconds,omitempty"`
+	// QueueSize is the number of responses queued while the agent is disconnected
+	QueueSize int `json:"queueSize,omitempty"`
+}
+
+// WebSocketBinding serves the endpoints of an agent to the Symphony API over a websocket connection the
+// agent dials out, so the API can reach agents behind NAT. The agent reconnects with backoff when the
+// connection is lost, and keeps the responses it couldn't send until it's connected again.
+type WebSocketBinding struct {
+	config     WebSocketBindingConfig
+	routeTable map[string]v1alpha2.Endpoint
+	dialer     *gws.Dialer
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+
+	lock      sync.Mutex
+	conn      *Conn
+	outbox    []Message
+	running   map[string]bool
+	responses map[string]Message
+	order     []string
+}
+
+// Launch validates the config and starts connecting to the Symphony API. It doesn't wait for the first
+// connection, as the API may not be reachable yet.
+func (w *WebSocketBinding) Launch(config WebSocketBindingConfig, endpoints []v1alpha2.Endpoint) error {
+	if config.ServerURL == "" {
+		return v1alpha2.NewCOAError(nil, "'serverUrl' is missing in websocket binding config", v1alpha2.BadConfig)
+	}
+	if config.Target == "" {
+		return v1alpha2.NewCOAError(nil, "'target' is missing in websocket binding config", v1alpha2.BadConfig)
+	}
+	if config.ReconnectMinSeconds <= 0 {
+		config.ReconnectMinSeconds = defaultReconnectMinSeconds
+	}
+	if config.ReconnectMaxSeconds < config.ReconnectMinSeconds {
+		config.ReconnectMaxSeconds = defaultReconnectMaxSeconds
+		if config.ReconnectMaxSeconds < config.ReconnectMinSeconds {
+			config.ReconnectMaxSeconds = config.ReconnectMinSeconds
+		}
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if _, err := ConnectURL(config); err != nil {
+		return v1alpha2.NewCOAError(err, "invalid 'serverUrl' in websocket binding config", v1alpha2.BadConfig)
+	}
+	tlsConfig, err := createTLSConfig(config)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to create TLS config", v1alpha2.BadConfig)
+	}
+	w.config = config
+	w.dialer = &gws.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: writeTimeout,
+		TLSClientConfig:  tlsConfig,
+	}
+	w.routeTable = make(map[string]v1alpha2.Endpoint)
+	for _, endpoint := range endpoints {
+		route := endpoint.Route
+		lastSlash := strings.LastIndex(endpoint.Route, "/")
+		if lastSlash > 0 {
+			route = strings.TrimPrefix(route, route[:lastSlash+1])
+		}
+		w.routeTable[route] = endpoint
+	}
+	w.running = make(map[string]bool)
+	w.responses = make(map[string]Message)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.stopped = make(chan struct{})
+	go w.run(ctx)
+	return nil
+}
+
+// ConnectURL returns the websocket URL an agent connects to
+func ConnectURL(config WebSocketBindingConfig) (string, error) {
+	u, err := url.Parse(config.ServerURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + ConnectRoute + "/" + config.Target
+	if config.Namespace != "" {
+		u.RawQuery = url.Values{"namespace": []string{config.Namespace}}.Encode()
+	}
+	return u.String(), nil
+}
+
+// run connects to the API until the binding is shut down, with exponential backoff between attempts
+func (w *WebSocketBinding) run(ctx context.Context) {
+	defer close(w.stopped)
+	backoff := time.Duration(w.config.ReconnectMinSeconds) * time.Second
+	maxBackoff := time.Duration(w.config.ReconnectMaxSeconds) * time.Second
+	for {
+		registered, err := w.connect(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if registered {
+			backoff = time.Duration(w.config.ReconnectMinSeconds) * time.Second
+		}
+		log.Infof("WebSocket Binding: disconnected from %s, reconnecting in %s - %v", w.config.ServerURL, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// connect dials the API, registers the agent and serves requests until the connection is lost. It
+// returns whether the agent was registered.
+func (w *WebSocketBinding) connect(ctx context.Context) (bool, error) {
+	address, _ := ConnectURL(w.config)
+	header := http.Header{}
+	token, err := w.token()
+	if err != nil {
+		return false, err
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	ws, resp, err := w.dialer.DialContext(ctx, address, header)
+	if err != nil {
+		if resp != nil {
+			return false, fmt.Errorf("%v (%s)", err, resp.Status)
+		}
+		return false, err
+	}
+	conn := NewConn(ws, w.config.HeartbeatSeconds)
+	defer conn.Close()
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-conn.Done():
+		}
+	}()
+
+	registration := Registration{
+		Target:     w.config.Target,
+		Namespace:  w.config.Namespace,
+		Properties: w.config.Properties,
+	}
+	if w.config.TargetSpec != nil {
+		registration.Spec, _ = json.Marshal(w.config.TargetSpec)
+	}
+	if err = conn.Send(Message{Type: MessageRegister, Registration: &registration}); err != nil {
+		return false, err
+	}
+	message, err := conn.Receive()
+	if err != nil {
+		return false, err
+	}
+	if message.Type != MessageRegistered {
+		return false, fmt.Errorf("registration of target %s was rejected: %s", w.config.Target, message.Error)
+	}
+	log.Infof("WebSocket Binding: connected to %s as target %s", w.config.ServerURL, w.config.Target)
+
+	w.lock.Lock()
+	w.conn = conn
+	queued := w.outbox
+	w.outbox = nil
+	w.lock.Unlock()
+	defer func() {
+		w.lock.Lock()
+		if w.conn == conn {
+			w.conn = nil
+		}
+		w.lock.Unlock()
+	}()
+	for _, response := range queued {
+		w.send(response)
+	}
+
+	for {
+		message, err = conn.Receive()
+		if err != nil {
+			return true, err
+		}
+		if message.Type == MessageRequest && message.Request != nil {
+			go w.handleRequest(message)
+		}
+	}
+}
+
+func (w *WebSocketBinding) token() (string, error) {
+	if w.config.TokenPath != "" {
+		data, err := os.ReadFile(w.config.TokenPath)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return w.config.Token, nil
+}
+
+// handleRequest routes a request to its endpoint and sends the response. A request that is sent again
+// while it's running is ignored, and a request that already ran is answered with its response.
+func (w *WebSocketBinding) handleRequest(message Message) {
+	w.lock.Lock()
+	if response, ok := w.responses[message.ID]; ok {
+		w.lock.Unlock()
+		w.send(response)
+		return
+	}
+	if w.running[message.ID] {
+		w.lock.Unlock()
+		return
+	}
+	w.running[message.ID] = true
+	w.lock.Unlock()
+
+	request := *message.Request
+	if message.IsExpired(time.Now()) {
+		log.Infof("WebSocket Binding: dropped expired request %s %s", request.Method, request.Route)
+		w.lock.Lock()
+		delete(w.running, message.ID)
+		w.lock.Unlock()
+		return
+	}
+	// the request carries the log contexts of the caller in its metadata
+	if request.Context == nil {
+		request.Context = context.TODO()
+	}
+	request.Context = contexts.GenerateCorrelationIdToParentContextIfMissing(request.Context)
+	var response v1alpha2.COAResponse
+	if endpoint, ok := w.routeTable[request.Route]; ok {
+		response = endpoint.Handler(request)
+	} else {
+		response = v1alpha2.COAResponse{
+			State:       v1alpha2.NotFound,
+			ContentType: "text/plain",
+			Body:        []byte("route not found"),
+		}
+	}
+	reply := Message{Type: MessageResponse, ID: message.ID, Response: &response, ExpiresAt: message.ExpiresAt}
+
+	w.lock.Lock()
+	delete(w.running, message.ID)
+	w.responses[message.ID] = reply
+	w.order = append(w.order, message.ID)
+	if len(w.order) > recentResponses {
+		delete(w.responses, w.order[0])
+		w.order = w.order[1:]
+	}
+	w.lock.Unlock()
+	w.send(reply)
+}
+
+// send sends a response, or queues it while the agent is disconnected. The oldest responses are
+// dropped when the queue is full, and expired responses aren't sent.
+func (w *WebSocketBinding) send(response Message) {
+	if response.IsExpired(time.Now()) {
+		return
+	}
+	w.lock.Lock()
+	conn := w.conn
+	w.lock.Unlock()
+	if conn != nil {
+		if err := conn.Send(response); err == nil {
+			return
+		}
+		conn.Close()
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.outbox) >= w.config.QueueSize {
+		log.Errorf("WebSocket Binding: response queue is full, dropped response %s", w.outbox[0].ID)
+		w.outbox = w.outbox[1:]
+	}
+	w.outbox = append(w.outbox, response)
+}
+
+func createTLSConfig(config WebSocketBindingConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CACertPath != "" {
+		caCert, err := os.ReadFile(config.CACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate %s", config.CACertPath)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if config.ClientCertPath != "" || config.ClientKeyPath != "" {
+		if config.ClientCertPath == "" || config.ClientKeyPath == "" {
+			return nil, fmt.Errorf("both clientCertPath and clientKeyPath must be provided for client certificate authentication")
+		}
+		clientCert, err := tls.LoadX509KeyPair(config.ClientCertPath, config.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate and key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
+
+// Shutdown closes the connection and stops reconnecting
+func (w *WebSocketBinding) Shutdown(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
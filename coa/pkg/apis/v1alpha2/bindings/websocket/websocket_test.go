@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	gws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer accepts agent connections, and hands each of them to the test after checking its
+// registration
+type fakeServer struct {
+	server      *httptest.Server
+	conns       chan *Conn
+	connections int32
+	reject      string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{conns: make(chan *Conn, 10)}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1alpha2/targets/connect/edge-01", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		ws, err := (&gws.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		atomic.AddInt32(&s.connections, 1)
+		conn := NewConn(ws, 1)
+		message, err := conn.Receive()
+		if !assert.Nil(t, err) {
+			return
+		}
+		assert.Equal(t, MessageRegister, message.Type)
+		assert.Equal(t, "edge-01", message.Registration.Target)
+		assert.Equal(t, "line-1", message.Registration.Namespace)
+		assert.JSONEq(t, `{"spec":{"displayName":"edge"}}`, string(message.Registration.Spec))
+		if s.reject != "" {
+			conn.Send(Message{Type: MessageError, Error: s.reject})
+			conn.Close()
+			return
+		}
+		conn.Send(Message{Type: MessageRegistered})
+		s.conns <- conn
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *fakeServer) accept(t *testing.T) *Conn {
+	select {
+	case conn := <-s.conns:
+		return conn
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent didn't connect")
+	}
+	return nil
+}
+
+func launchBinding(t *testing.T, serverURL string, handler v1alpha2.COAHandler) *WebSocketBinding {
+	binding := &WebSocketBinding{}
+	err := binding.Launch(WebSocketBindingConfig{
+		ServerURL:  serverURL + "/v1alpha2/",
+		Target:     "edge-01",
+		Namespace:  "line-1",
+		TargetSpec: map[string]interface{}{"spec": map[string]interface{}{"displayName": "edge"}},
+		Token:      "secret",
+	}, []v1alpha2.Endpoint{{Route: "solution/instances", Handler: handler}})
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		binding.Shutdown(context.Background())
+	})
+	return binding
+}
+
+func request(id string, method string) Message {
+	return Message{Type: MessageRequest, ID: id, Request: &v1alpha2.COARequest{Route: "instances", Method: method, Body: []byte(id)}}
+}
+
+func TestWebSocketBindingConfig(t *testing.T) {
+	address, err := ConnectURL(WebSocketBindingConfig{ServerURL: "https://symphony:8081/v1alpha2/", Target: "edge 01", Namespace: "line-1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "wss://symphony:8081/v1alpha2/targets/connect/edge%2001?namespace=line-1", address)
+	address, err = ConnectURL(WebSocketBindingConfig{ServerURL: "http://localhost:8082/v1alpha2", Target: "edge"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ws://localhost:8082/v1alpha2/targets/connect/edge", address)
+
+	for _, config := range []WebSocketBindingConfig{
+		{Target: "edge"},
+		{ServerURL: "http://localhost:8082/v1alpha2/"},
+		{ServerURL: "ftp://localhost/", Target: "edge"},
+		{ServerURL: "http://localhost:8082/v1alpha2/", Target: "edge", ClientCertPath: "cert.pem"},
+		{ServerURL: "http://localhost:8082/v1alpha2/", Target: "edge", CACertPath: "missing.pem"},
+	} {
+		binding := &WebSocketBinding{}
+		err = binding.Launch(config, nil)
+		assert.NotNil(t, err, config)
+	}
+}
+
+func TestWebSocketBindingServesRequests(t *testing.T) {
+	server := newFakeServer(t)
+	var calls int32
+	launchBinding(t, server.server.URL, func(request v1alpha2.COARequest) v1alpha2.COAResponse {
+		atomic.AddInt32(&calls, 1)
+		return v1alpha2.COAResponse{State: v1alpha2.OK, Body: append([]byte(request.Method+" "), request.Body...)}
+	})
+	conn := server.accept(t)
+
+	assert.Nil(t, conn.Send(request("1", "GET")))
+	message, err := conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, MessageResponse, message.Type)
+	assert.Equal(t, "1", message.ID)
+	assert.Equal(t, v1alpha2.OK, message.Response.State)
+	assert.Equal(t, "GET 1", string(message.Response.Body))
+
+	// a request that is sent again is answered without running it again
+	assert.Nil(t, conn.Send(request("1", "GET")))
+	message, err = conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", message.ID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// expired requests aren't run
+	expired := request("2", "POST")
+	expiresAt := time.Now().Add(-time.Second)
+	expired.ExpiresAt = &expiresAt
+	assert.Nil(t, conn.Send(expired))
+	unknown := request("3", "GET")
+	unknown.Request.Route = "campaigns"
+	assert.Nil(t, conn.Send(unknown))
+	message, err = conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "3", message.ID)
+	assert.Equal(t, v1alpha2.NotFound, message.Response.State)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestWebSocketBindingReconnectsAndQueuesResponses(t *testing.T) {
+	server := newFakeServer(t)
+	release := make(chan struct{})
+	launchBinding(t, server.server.URL, func(request v1alpha2.COARequest) v1alpha2.COAResponse {
+		<-release
+		return v1alpha2.COAResponse{State: v1alpha2.OK, Body: request.Body}
+	})
+	conn := server.accept(t)
+	assert.Nil(t, conn.Send(request("1", "POST")))
+	time.Sleep(100 * time.Millisecond)
+
+	// the response of a request that completes while the agent is disconnected is sent after it reconnects
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	conn = server.accept(t)
+	message, err := conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, MessageResponse, message.Type)
+	assert.Equal(t, "1", message.ID)
+	assert.Equal(t, "1", string(message.Response.Body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.connections))
+}
+
+func TestWebSocketBindingRetriesRejectedRegistration(t *testing.T) {
+	server := newFakeServer(t)
+	server.reject = "target edge-01 is not found"
+	launchBinding(t, server.server.URL, nil)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&server.connections) >= 2
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestConnHeartbeats(t *testing.T) {
+	lost := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&gws.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		conn := NewConn(ws, 1)
+		defer conn.Close()
+		_, err = conn.Receive()
+		lost <- err
+	}))
+	defer server.Close()
+
+	// a peer that doesn't answer pings is lost after a few heartbeats
+	ws, _, err := gws.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+	assert.Nil(t, err)
+	defer ws.Close()
+	select {
+	case err = <-lost:
+		assert.NotNil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection wasn't lost")
+	}
+}
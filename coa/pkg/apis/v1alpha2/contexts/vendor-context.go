@@ -13,7 +13,7 @@ import (
 	logger "github.com/eclipse-symphony/symphony/coa/pkg/logger"
 )
 
-// SecurityPolicy defines server-side restrictions on outbound URL access for providers.
+// SecurityPolicy defines server-side restrictions on outbound URL access and container execution for providers.
 // It is populated by the SecurityPolicyVendor and propagated to all managers and providers
 // via VendorContext. Providers read it through their ManagerContext to enforce allow-lists
 // and exclusive-mode restrictions without exposing these settings in user-editable CRDs.
@@ -25,6 +25,14 @@ type SecurityPolicy struct {
 	// AllowListExclusive, when true, requires the target host to resolve to an address
 	// within AllowedIPRanges. All other addresses are rejected, including public IPs.
 	AllowListExclusive bool `json:"allowListExclusive,omitempty"`
+	// AllowedImages is a list of container image patterns that container stages may run.
+	// A '*' matches any sequence of characters. No image is allowed if the list is empty.
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	// MaxContainerCPU, MaxContainerMemory and MaxContainerTimeout cap the resources a
+	// container stage may request, in Kubernetes quantity and duration formats.
+	MaxContainerCPU     string `json:"maxContainerCPU,omitempty"`
+	MaxContainerMemory  string `json:"maxContainerMemory,omitempty"`
+	MaxContainerTimeout string `json:"maxContainerTimeout,omitempty"`
 }
 
 type VendorContext struct {
@@ -21,6 +21,7 @@ import (
 	bindings "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings"
 	http "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/http"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/mqtt"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/bindings/websocket"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
 	mf "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/managers"
 	pf "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providerfactory"
@@ -305,6 +306,12 @@ func (h *APIHost) Launch(config HostConfig,
 					return err
 				}
 				h.Bindings = append(h.Bindings, binding)
+			case "bindings.websocket":
+				binding, err := h.launchWebSocket(b.Config, endpoints)
+				if err != nil {
+					return err
+				}
+				h.Bindings = append(h.Bindings, binding)
 			default:
 				return v1alpha2.NewCOAError(nil, fmt.Sprintf("binding type '%s' is not recognized", b.Type), v1alpha2.BadConfig)
 			}
@@ -380,3 +387,17 @@ func (h *APIHost) launchMQTT(config interface{}, endpoints []v1alpha2.Endpoint)
 	binding := &mqtt.MQTTBinding{}
 	return binding, binding.Launch(mqttConfig, endpoints)
 }
+
+func (h *APIHost) launchWebSocket(config interface{}, endpoints []v1alpha2.Endpoint) (bindings.IBinding, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	webSocketConfig := websocket.WebSocketBindingConfig{}
+	err = json.Unmarshal(data, &webSocketConfig)
+	if err != nil {
+		return nil, err
+	}
+	binding := &websocket.WebSocketBinding{}
+	return binding, binding.Launch(webSocketConfig, endpoints)
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+)
+
+var log = logger.NewLogger("coa.runtime")
+
+const (
+	defaultCommonName = "Symphony CA"
+	caValidity        = 10 * 365 * 24 * time.Hour
+	serverValidity    = 365 * 24 * time.Hour
+	// clockSkew backdates issued certificates, so they're valid on hosts whose clocks lag behind
+	clockSkew = 5 * time.Minute
+)
+
+type CACertProviderConfig struct {
+	Name       string `json:"name"`
+	CertFile   string `json:"caCert,omitempty"`
+	KeyFile    string `json:"caKey,omitempty"`
+	CommonName string `json:"commonName,omitempty"`
+}
+
+// CACertProvider is a certificate authority that issues server certificates for the HTTP
+// binding and client certificates for certificate signing requests. The authority is loaded
+// from the configured files, or generated (and saved to the files, if configured) when they
+// don't exist.
+type CACertProvider struct {
+	Config  CACertProviderConfig
+	caCert  *x509.Certificate
+	caKey   crypto.Signer
+	certPEM []byte
+}
+
+func (w *CACertProvider) ID() string {
+	return w.Config.Name
+}
+func (s *CACertProvider) SetContext(ctx contexts.ManagerContext) error {
+	return v1alpha2.NewCOAError(nil, "CA cert provider doesn't support manager context", v1alpha2.InternalError)
+}
+func (w *CACertProvider) Init(config providers.IProviderConfig) error {
+	certConfig, err := toCACertProviderConfig(config)
+	if err != nil {
+		log.Errorf("  P (CA): failed to parse provider config %+v", err)
+		return v1alpha2.NewCOAError(nil, "provided config is not a valid CA cert provider config", v1alpha2.InvalidArgument)
+	}
+	if (certConfig.CertFile == "") != (certConfig.KeyFile == "") {
+		return v1alpha2.NewCOAError(nil, "caCert and caKey must be configured together", v1alpha2.BadConfig)
+	}
+	if certConfig.CommonName == "" {
+		certConfig.CommonName = defaultCommonName
+	}
+	w.Config = certConfig
+	if w.Config.CertFile != "" {
+		certPEM, certErr := os.ReadFile(w.Config.CertFile)
+		keyPEM, keyErr := os.ReadFile(w.Config.KeyFile)
+		if certErr == nil && keyErr == nil {
+			return w.load(certPEM, keyPEM)
+		}
+		if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+			log.Errorf("  P (CA): failed to read CA files: %v, %v", certErr, keyErr)
+			return v1alpha2.NewCOAError(nil, "failed to read CA certificate or key", v1alpha2.InternalError)
+		}
+	}
+	return w.generate()
+}
+
+func toCACertProviderConfig(config providers.IProviderConfig) (CACertProviderConfig, error) {
+	ret := CACertProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+func (w *CACertProvider) load(certPEM []byte, keyPEM []byte) error {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return v1alpha2.NewCOAError(nil, "CA certificate is not PEM encoded", v1alpha2.BadConfig)
+	}
+	caCert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to parse CA certificate", v1alpha2.BadConfig)
+	}
+	caKey, err := ParsePrivateKey(keyPEM)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to parse CA key", v1alpha2.BadConfig)
+	}
+	w.caCert = caCert
+	w.caKey = caKey
+	w.certPEM = certPEM
+	return nil
+}
+
+func (w *CACertProvider) generate() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to generate CA key", v1alpha2.InternalError)
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: w.Config.CommonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to create CA certificate", v1alpha2.InternalError)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to encode CA key", v1alpha2.InternalError)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if w.Config.CertFile != "" {
+		// persist the authority, so certificates it issued stay valid across restarts
+		if err = os.WriteFile(w.Config.KeyFile, keyPEM, 0600); err != nil {
+			return v1alpha2.NewCOAError(err, "failed to save CA key", v1alpha2.InternalError)
+		}
+		if err = os.WriteFile(w.Config.CertFile, certPEM, 0644); err != nil {
+			return v1alpha2.NewCOAError(err, "failed to save CA certificate", v1alpha2.InternalError)
+		}
+		log.Infof("  P (CA): generated certificate authority %s", w.Config.CertFile)
+	}
+	return w.load(certPEM, keyPEM)
+}
+
+// GetCert issues a server certificate for the host, followed by the CA certificate
+func (w *CACertProvider) GetCert(host string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, v1alpha2.NewCOAError(err, "failed to generate server key", v1alpha2.InternalError)
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     now.Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, w.caCert, &key.PublicKey, w.caKey)
+	if err != nil {
+		return nil, nil, v1alpha2.NewCOAError(err, "failed to create server certificate", v1alpha2.InternalError)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, v1alpha2.NewCOAError(err, "failed to encode server key", v1alpha2.InternalError)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPEM = append(certPEM, w.certPEM...)
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+func (w *CACertProvider) GetCACert() ([]byte, error) {
+	if w.caCert == nil {
+		return nil, v1alpha2.NewCOAError(nil, "CA cert provider isn't initialized", v1alpha2.InternalError)
+	}
+	return w.certPEM, nil
+}
+
+// IssueCert issues a client certificate for the subject of a certificate signing request
+func (w *CACertProvider) IssueCert(csr []byte, validity time.Duration) ([]byte, error) {
+	if w.caCert == nil {
+		return nil, v1alpha2.NewCOAError(nil, "CA cert provider isn't initialized", v1alpha2.InternalError)
+	}
+	block, _ := pem.Decode(csr)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, v1alpha2.NewCOAError(nil, "certificate signing request is not PEM encoded", v1alpha2.BadRequest)
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to parse certificate signing request", v1alpha2.BadRequest)
+	}
+	if err = request.CheckSignature(); err != nil {
+		return nil, v1alpha2.NewCOAError(err, "certificate signing request has an invalid signature", v1alpha2.BadRequest)
+	}
+	if request.Subject.CommonName == "" {
+		return nil, v1alpha2.NewCOAError(nil, "certificate signing request has no common name", v1alpha2.BadRequest)
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: request.Subject.CommonName},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, w.caCert, request.PublicKey, w.caKey)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to issue certificate", v1alpha2.InternalError)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// ParsePrivateKey parses a PEM encoded EC, PKCS#1 or PKCS#8 private key
+func ParsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("key is not PEM encoded")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key can't sign")
+	}
+	return signer, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to generate serial number", v1alpha2.InternalError)
+	}
+	return serial, nil
+}
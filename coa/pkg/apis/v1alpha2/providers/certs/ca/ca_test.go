@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetContext(t *testing.T) {
+	provider := CACertProvider{}
+	err := provider.SetContext(contexts.ManagerContext{})
+	assert.NotNil(t, err)
+}
+
+func TestID(t *testing.T) {
+	provider := CACertProvider{}
+	err := provider.Init(CACertProviderConfig{
+		Name: "test",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "test", provider.ID())
+}
+
+func TestInitPartialConfig(t *testing.T) {
+	provider := CACertProvider{}
+	err := provider.Init(CACertProviderConfig{
+		Name:     "test",
+		CertFile: "ca.crt",
+	})
+	assert.Equal(t, v1alpha2.BadConfig, err.(v1alpha2.COAError).State)
+}
+
+func TestGetCert(t *testing.T) {
+	provider := CACertProvider{}
+	err := provider.Init(CACertProviderConfig{
+		Name: "test",
+	})
+	assert.Nil(t, err)
+	certPEM, keyPEM, err := provider.GetCert("localhost")
+	assert.Nil(t, err)
+	_, err = tls.X509KeyPair(certPEM, keyPEM)
+	assert.Nil(t, err)
+
+	cert := parseCert(t, certPEM)
+	assert.Equal(t, []string{"localhost"}, cert.DNSNames)
+	assert.Nil(t, verify(t, &provider, cert, x509.ExtKeyUsageServerAuth))
+}
+
+func TestIssueCert(t *testing.T) {
+	provider := CACertProvider{}
+	err := provider.Init(CACertProviderConfig{
+		Name: "test",
+	})
+	assert.Nil(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "site1"},
+	}, key)
+	assert.Nil(t, err)
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	certPEM, err := provider.IssueCert(csr, time.Hour)
+	assert.Nil(t, err)
+	cert := parseCert(t, certPEM)
+	assert.Equal(t, "site1", cert.Subject.CommonName)
+	assert.True(t, cert.PublicKey.(*ecdsa.PublicKey).Equal(&key.PublicKey))
+	assert.True(t, cert.NotAfter.Before(time.Now().Add(2*time.Hour)))
+	assert.Nil(t, verify(t, &provider, cert, x509.ExtKeyUsageClientAuth))
+
+	// certificates of another authority don't verify
+	other := CACertProvider{}
+	err = other.Init(CACertProviderConfig{
+		Name: "other",
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, verify(t, &other, cert, x509.ExtKeyUsageClientAuth))
+
+	_, err = provider.IssueCert([]byte("not a csr"), time.Hour)
+	assert.Equal(t, v1alpha2.BadRequest, err.(v1alpha2.COAError).State)
+}
+
+func TestPersistedAuthority(t *testing.T) {
+	dir := t.TempDir()
+	config := CACertProviderConfig{
+		Name:     "test",
+		CertFile: filepath.Join(dir, "ca.crt"),
+		KeyFile:  filepath.Join(dir, "ca.key"),
+	}
+	provider := CACertProvider{}
+	err := provider.Init(config)
+	assert.Nil(t, err)
+	caPEM, err := provider.GetCACert()
+	assert.Nil(t, err)
+	saved, err := os.ReadFile(config.CertFile)
+	assert.Nil(t, err)
+	assert.Equal(t, caPEM, saved)
+
+	// a restarted provider loads the same authority
+	restarted := CACertProvider{}
+	err = restarted.Init(config)
+	assert.Nil(t, err)
+	reloaded, err := restarted.GetCACert()
+	assert.Nil(t, err)
+	assert.Equal(t, caPEM, reloaded)
+	assert.Equal(t, defaultCommonName, restarted.caCert.Subject.CommonName)
+}
+
+func parseCert(t *testing.T, certPEM []byte) *x509.Certificate {
+	block, _ := pem.Decode(certPEM)
+	assert.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+	return cert
+}
+
+func verify(t *testing.T, provider *CACertProvider, cert *x509.Certificate, usage x509.ExtKeyUsage) error {
+	caPEM, err := provider.GetCACert()
+	assert.Nil(t, err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{usage},
+	})
+	return err
+}
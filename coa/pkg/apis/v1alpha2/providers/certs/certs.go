@@ -7,6 +7,8 @@
 package certs
 
 import (
+	"time"
+
 	providers "github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
 )
 
@@ -15,3 +17,12 @@ type ICertProvider interface {
 	Init(config providers.IProviderConfig) error
 	GetCert(host string) ([]byte, []byte, error)
 }
+
+// ICertIssuer is implemented by cert providers that act as a certificate authority
+type ICertIssuer interface {
+	// GetCACert returns the PEM encoded certificate of the authority
+	GetCACert() ([]byte, error)
+	// IssueCert signs a PEM encoded certificate signing request with the authority and
+	// returns the PEM encoded client certificate
+	IssueCert(csr []byte, validity time.Duration) ([]byte, error)
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/json"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
@@ -30,6 +31,7 @@ type InMemoryPubSubProvider struct {
 	Config      InMemoryPubSubConfig               `json:"config"`
 	Subscribers map[string][]v1alpha2.EventHandler `json:"subscribers"`
 	Context     *contexts.ManagerContext
+	lock        sync.RWMutex
 }
 
 type InMemoryPubSubConfig struct {
@@ -102,7 +104,9 @@ func (i *InMemoryPubSubProvider) Init(config providers.IProviderConfig) error {
 	return nil
 }
 func (i *InMemoryPubSubProvider) Publish(topic string, event v1alpha2.Event) error {
+	i.lock.RLock()
 	arr, ok := i.Subscribers[topic]
+	i.lock.RUnlock()
 	if ok && arr != nil {
 		for _, s := range arr {
 			go func(handler v1alpha2.EventHandler, topic string, event v1alpha2.Event) {
@@ -121,6 +125,8 @@ func (i *InMemoryPubSubProvider) Publish(topic string, event v1alpha2.Event) err
 	return nil
 }
 func (i *InMemoryPubSubProvider) Subscribe(topic string, handler v1alpha2.EventHandler) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	arr, ok := i.Subscribers[topic]
 	if !ok || arr == nil {
 		i.Subscribers[topic] = make([]v1alpha2.EventHandler, 0)
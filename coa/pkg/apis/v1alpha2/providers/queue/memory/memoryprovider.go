@@ -9,12 +9,18 @@ package memoryqueue
 import (
 	"encoding/json"
 	"errors"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue"
 	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
 	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"github.com/google/uuid"
 )
 
 var mLog = logger.NewLogger("coa.runtime")
@@ -22,6 +28,8 @@ var mLock sync.Mutex
 
 type MemoryQueueProviderConfig struct {
 	Name string `json:"name"`
+	// MaxDeliveries is the number of deliveries after which a message is dead-lettered
+	MaxDeliveries int `json:"maxDeliveries,omitempty"`
 }
 
 func MemoryQueueProviderConfigFromMap(properties map[string]string) (MemoryQueueProviderConfig, error) {
@@ -29,13 +37,30 @@ func MemoryQueueProviderConfigFromMap(properties map[string]string) (MemoryQueue
 	if v, ok := properties["name"]; ok {
 		ret.Name = utils.ParseProperty(v)
 	}
+	if v, ok := properties["maxDeliveries"]; ok && v != "" {
+		n, err := strconv.Atoi(utils.ParseProperty(v))
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(err, "invalid int value in the 'maxDeliveries' setting of memory queue provider", v1alpha2.BadConfig)
+		}
+		ret.MaxDeliveries = n
+	}
 	return ret, nil
 }
 
+// memoryMessage is a queued element with the delivery information used by reliable delivery
+type memoryMessage struct {
+	id         string
+	body       interface{}
+	deliveries int
+	deadline   time.Time
+}
+
 type MemoryQueueProvider struct {
-	Config  MemoryQueueProviderConfig
-	Data    map[string][]interface{}
-	Context *contexts.ManagerContext
+	Config      MemoryQueueProviderConfig
+	Data        map[string][]interface{}
+	Context     *contexts.ManagerContext
+	inFlight    map[string]map[string]*memoryMessage
+	deadLetters map[string][]*memoryMessage
 }
 
 func (s *MemoryQueueProvider) ID() string {
@@ -71,8 +96,13 @@ func (s *MemoryQueueProvider) Init(config providers.IProviderConfig) error {
 	if err != nil {
 		return errors.New("expected MemoryQueueProviderConfig")
 	}
+	if stateConfig.MaxDeliveries <= 0 {
+		stateConfig.MaxDeliveries = queue.DefaultMaxDeliveries
+	}
 	s.Config = stateConfig
 	s.Data = make(map[string][]interface{})
+	s.inFlight = make(map[string]map[string]*memoryMessage)
+	s.deadLetters = make(map[string][]*memoryMessage)
 	return nil
 }
 
@@ -82,7 +112,7 @@ func (s *MemoryQueueProvider) Enqueue(queue string, data interface{}) error {
 	if _, ok := s.Data[queue]; !ok {
 		s.Data[queue] = make([]interface{}, 0)
 	}
-	s.Data[queue] = append(s.Data[queue], data)
+	s.Data[queue] = append(s.Data[queue], &memoryMessage{id: uuid.New().String(), body: data})
 	return nil
 }
 func (s *MemoryQueueProvider) Dequeue(queue string) (interface{}, error) {
@@ -98,7 +128,7 @@ func (s *MemoryQueueProvider) Dequeue(queue string) (interface{}, error) {
 	// s.Data[queue] = s.Data[queue][:len(s.Data[queue])-1]
 	ret := s.Data[queue][0]
 	s.Data[queue] = s.Data[queue][1:]
-	return ret, nil
+	return ret.(*memoryMessage).body, nil
 }
 
 func (s *MemoryQueueProvider) Peek(queue string) (interface{}, error) {
@@ -111,7 +141,7 @@ func (s *MemoryQueueProvider) Peek(queue string) (interface{}, error) {
 		return nil, errors.New("queue is empty")
 	}
 	//return s.Data[queue][len(s.Data[queue])-1], nil
-	return s.Data[queue][0], nil
+	return s.Data[queue][0].(*memoryMessage).body, nil
 }
 
 func (s *MemoryQueueProvider) Size(queue string) int {
@@ -122,3 +152,108 @@ func (s *MemoryQueueProvider) Size(queue string) int {
 	}
 	return len(s.Data[queue])
 }
+
+// Receive leases up to count messages for the visibility timeout. Expired leases are
+// returned to the front of the queue, or dead-lettered after the maximum deliveries.
+func (s *MemoryQueueProvider) Receive(queueName string, count int, visibilityTimeout time.Duration) ([]queue.QueueMessage, error) {
+	mLock.Lock()
+	defer mLock.Unlock()
+	s.requeueExpired(queueName)
+	ret := make([]queue.QueueMessage, 0)
+	for len(ret) < count && len(s.Data[queueName]) > 0 {
+		message := s.Data[queueName][0].(*memoryMessage)
+		s.Data[queueName] = s.Data[queueName][1:]
+		message.deliveries++
+		message.deadline = time.Now().Add(visibilityTimeout)
+		if _, ok := s.inFlight[queueName]; !ok {
+			s.inFlight[queueName] = make(map[string]*memoryMessage)
+		}
+		s.inFlight[queueName][message.id] = message
+		ret = append(ret, toQueueMessage(message))
+	}
+	return ret, nil
+}
+
+// Ack removes delivered messages. Unknown ids, such as ids of messages that have been
+// acknowledged already, are ignored.
+func (s *MemoryQueueProvider) Ack(queueName string, ids []string) error {
+	mLock.Lock()
+	defer mLock.Unlock()
+	for _, id := range ids {
+		delete(s.inFlight[queueName], id)
+	}
+	return nil
+}
+
+func (s *MemoryQueueProvider) InFlight(queueName string) int {
+	mLock.Lock()
+	defer mLock.Unlock()
+	s.requeueExpired(queueName)
+	return len(s.inFlight[queueName])
+}
+
+// InFlightMessages lists the leased messages of a queue, in the order their leases expire
+func (s *MemoryQueueProvider) InFlightMessages(queueName string) ([]queue.QueueMessage, error) {
+	mLock.Lock()
+	defer mLock.Unlock()
+	s.requeueExpired(queueName)
+	messages := make([]*memoryMessage, 0, len(s.inFlight[queueName]))
+	for _, message := range s.inFlight[queueName] {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(a, b int) bool { return messages[a].deadline.Before(messages[b].deadline) })
+	ret := make([]queue.QueueMessage, 0, len(messages))
+	for _, message := range messages {
+		ret = append(ret, toQueueMessage(message))
+	}
+	return ret, nil
+}
+
+func (s *MemoryQueueProvider) DeadLetters(queueName string) ([]queue.QueueMessage, error) {
+	mLock.Lock()
+	defer mLock.Unlock()
+	s.requeueExpired(queueName)
+	ret := make([]queue.QueueMessage, 0, len(s.deadLetters[queueName]))
+	for _, message := range s.deadLetters[queueName] {
+		ret = append(ret, toQueueMessage(message))
+	}
+	return ret, nil
+}
+
+// requeueExpired must be called with mLock held
+func (s *MemoryQueueProvider) requeueExpired(queueName string) {
+	if s.inFlight == nil {
+		s.inFlight = make(map[string]map[string]*memoryMessage)
+		s.deadLetters = make(map[string][]*memoryMessage)
+	}
+	now := time.Now()
+	expired := make([]*memoryMessage, 0)
+	for id, message := range s.inFlight[queueName] {
+		if now.After(message.deadline) {
+			expired = append(expired, message)
+			delete(s.inFlight[queueName], id)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	sort.Slice(expired, func(a, b int) bool { return expired[a].deadline.Before(expired[b].deadline) })
+	requeued := make([]interface{}, 0, len(expired))
+	for _, message := range expired {
+		if message.deliveries >= s.Config.MaxDeliveries {
+			mLog.Infof("  P (Memory Queue): message %s in queue %s is moved to the dead-letter queue after %d deliveries", message.id, queueName, message.deliveries)
+			s.deadLetters[queueName] = append(s.deadLetters[queueName], message)
+		} else {
+			requeued = append(requeued, message)
+		}
+	}
+	s.Data[queueName] = append(requeued, s.Data[queueName]...)
+}
+
+func toQueueMessage(message *memoryMessage) queue.QueueMessage {
+	return queue.QueueMessage{
+		ID:         message.id,
+		Body:       message.body,
+		Deliveries: message.deliveries,
+	}
+}
@@ -8,6 +8,7 @@ package memoryqueue
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -70,3 +71,76 @@ func TestSize(t *testing.T) {
 	queue.Enqueue("queue1", "c")
 	assert.Equal(t, 3, queue.Size("queue1"))
 }
+func TestReceiveAndAck(t *testing.T) {
+	queue := MemoryQueueProvider{}
+	err := queue.Init(MemoryQueueProviderConfig{})
+	assert.Nil(t, err)
+	queue.Enqueue("queue1", "a")
+	queue.Enqueue("queue1", "b")
+	queue.Enqueue("queue1", "c")
+	messages, err := queue.Receive("queue1", 2, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "a", messages[0].Body)
+	assert.Equal(t, "b", messages[1].Body)
+	assert.Equal(t, 1, messages[0].Deliveries)
+	assert.Equal(t, 1, queue.Size("queue1"))
+	assert.Equal(t, 2, queue.InFlight("queue1"))
+
+	inFlight, err := queue.InFlightMessages("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(inFlight))
+
+	err = queue.Ack("queue1", []string{messages[0].ID, messages[1].ID})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, queue.InFlight("queue1"))
+	inFlight, err = queue.InFlightMessages("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(inFlight))
+	messages, err = queue.Receive("queue1", 2, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "c", messages[0].Body)
+}
+func TestRedeliveryAfterVisibilityTimeout(t *testing.T) {
+	queue := MemoryQueueProvider{}
+	err := queue.Init(MemoryQueueProviderConfig{})
+	assert.Nil(t, err)
+	queue.Enqueue("queue1", "a")
+	queue.Enqueue("queue1", "b")
+	messages, err := queue.Receive("queue1", 1, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	time.Sleep(20 * time.Millisecond)
+	// the expired message is delivered again, before the messages behind it
+	redelivered, err := queue.Receive("queue1", 1, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(redelivered))
+	assert.Equal(t, messages[0].ID, redelivered[0].ID)
+	assert.Equal(t, "a", redelivered[0].Body)
+	assert.Equal(t, 2, redelivered[0].Deliveries)
+}
+func TestDeadLetter(t *testing.T) {
+	queue := MemoryQueueProvider{}
+	err := queue.InitWithMap(map[string]string{
+		"maxDeliveries": "2",
+	})
+	assert.Nil(t, err)
+	queue.Enqueue("queue1", "a")
+	for i := 0; i < 2; i++ {
+		messages, err := queue.Receive("queue1", 1, time.Millisecond)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(messages))
+		time.Sleep(5 * time.Millisecond)
+	}
+	messages, err := queue.Receive("queue1", 1, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(messages))
+	deadLetters, err := queue.DeadLetters("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deadLetters))
+	assert.Equal(t, "a", deadLetters[0].Body)
+	assert.Equal(t, 2, deadLetters[0].Deliveries)
+	assert.Equal(t, 0, queue.Size("queue1"))
+	assert.Equal(t, 0, queue.InFlight("queue1"))
+}
@@ -6,9 +6,36 @@
 
 package queue
 
+import "time"
+
+// DefaultMaxDeliveries is the number of deliveries after which an unacknowledged message
+// is moved to the dead-letter queue
+const DefaultMaxDeliveries = 5
+
 type IQueueProvider interface {
 	Enqueue(queue string, element interface{}) error
 	Dequeue(queue string) (interface{}, error)
 	Peek(queue string) (interface{}, error)
 	Size(queue string) int
 }
+
+// QueueMessage is a message received from a reliable queue
+type QueueMessage struct {
+	ID         string      `json:"id"`
+	Body       interface{} `json:"body"`
+	Deliveries int         `json:"deliveries"`
+}
+
+// IReliableQueueProvider is a queue with acknowledged delivery. A received message stays
+// invisible to other receivers until it's acknowledged, or until its visibility timeout
+// expires and it's delivered again. Messages that aren't acknowledged after the maximum
+// number of deliveries are moved to the queue's dead-letter queue. InFlightMessages lists
+// the messages that are received but not acknowledged yet.
+type IReliableQueueProvider interface {
+	IQueueProvider
+	Receive(queue string, count int, visibilityTimeout time.Duration) ([]QueueMessage, error)
+	Ack(queue string, ids []string) error
+	InFlight(queue string) int
+	InFlightMessages(queue string) ([]QueueMessage, error)
+	DeadLetters(queue string) ([]QueueMessage, error)
+}
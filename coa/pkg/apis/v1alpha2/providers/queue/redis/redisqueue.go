@@ -0,0 +1,399 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package redisqueue
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/contexts"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/providers/queue"
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2/utils"
+	"github.com/eclipse-symphony/symphony/coa/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var rLog = logger.NewLogger("coa.runtime")
+
+const defaultKeyPrefix = "symphony-queue"
+
+// Each queue is stored in five keys: a list of ready message ids, a hash of message bodies,
+// a hash of delivery counts, a sorted set of in-flight message ids scored by their visibility
+// deadline, and a list of dead-lettered message ids. The scripts below keep them consistent.
+
+// receiveScript returns expired in-flight messages to the front of the queue (or dead-letters
+// them), then leases up to ARGV[3] messages, returning id, body and delivery count triples.
+var receiveScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local deadline = tonumber(ARGV[2])
+local count = tonumber(ARGV[3])
+local maxDeliveries = tonumber(ARGV[4])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', now)
+local requeued = {}
+for _, id in ipairs(expired) do
+  redis.call('ZREM', KEYS[4], id)
+  local deliveries = tonumber(redis.call('HGET', KEYS[3], id) or '0')
+  if deliveries >= maxDeliveries then
+    redis.call('RPUSH', KEYS[5], id)
+  else
+    table.insert(requeued, id)
+  end
+end
+for i = #requeued, 1, -1 do
+  redis.call('LPUSH', KEYS[1], requeued[i])
+end
+local ret = {}
+while #ret < count * 3 do
+  local id = redis.call('LPOP', KEYS[1])
+  if not id then
+    break
+  end
+  local body = redis.call('HGET', KEYS[2], id)
+  if body then
+    local deliveries = redis.call('HINCRBY', KEYS[3], id, 1)
+    redis.call('ZADD', KEYS[4], deadline, id)
+    table.insert(ret, id)
+    table.insert(ret, body)
+    table.insert(ret, deliveries)
+  end
+end
+return ret
+`)
+
+// dequeueScript removes and returns the first message body of the queue
+var dequeueScript = redis.NewScript(`
+while true do
+  local id = redis.call('LPOP', KEYS[1])
+  if not id then
+    return false
+  end
+  local body = redis.call('HGET', KEYS[2], id)
+  if body then
+    redis.call('HDEL', KEYS[2], id)
+    redis.call('HDEL', KEYS[3], id)
+    return body
+  end
+end
+`)
+
+type RedisQueueProviderConfig struct {
+	Name        string `json:"name"`
+	Host        string `json:"host"`
+	Password    string `json:"password,omitempty"`
+	RequiresTLS bool   `json:"requiresTLS,omitempty"`
+	// KeyPrefix is prepended to the redis keys of all queues
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	// MaxDeliveries is the number of deliveries after which a message is dead-lettered
+	MaxDeliveries int `json:"maxDeliveries,omitempty"`
+}
+
+func RedisQueueProviderConfigFromMap(properties map[string]string) (RedisQueueProviderConfig, error) {
+	ret := RedisQueueProviderConfig{}
+	if v, ok := properties["name"]; ok {
+		ret.Name = utils.ParseProperty(v)
+	}
+	if v, ok := properties["host"]; ok {
+		ret.Host = utils.ParseProperty(v)
+	} else {
+		return ret, v1alpha2.NewCOAError(nil, "Redis queue provider host name is not set", v1alpha2.BadConfig)
+	}
+	if v, ok := properties["password"]; ok {
+		ret.Password = utils.ParseProperty(v)
+	}
+	if v, ok := properties["requiresTLS"]; ok && v != "" {
+		bVal, err := strconv.ParseBool(utils.ParseProperty(v))
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(err, "invalid bool value in the 'requiresTLS' setting of Redis queue provider", v1alpha2.BadConfig)
+		}
+		ret.RequiresTLS = bVal
+	}
+	if v, ok := properties["keyPrefix"]; ok {
+		ret.KeyPrefix = utils.ParseProperty(v)
+	}
+	if v, ok := properties["maxDeliveries"]; ok && v != "" {
+		n, err := strconv.Atoi(utils.ParseProperty(v))
+		if err != nil {
+			return ret, v1alpha2.NewCOAError(err, "invalid int value in the 'maxDeliveries' setting of Redis queue provider", v1alpha2.BadConfig)
+		}
+		ret.MaxDeliveries = n
+	}
+	return ret, nil
+}
+
+type RedisQueueProvider struct {
+	Config  RedisQueueProviderConfig
+	Context *contexts.ManagerContext
+	Client  *redis.Client
+	Ctx     context.Context
+	Cancel  context.CancelFunc
+}
+
+func (r *RedisQueueProvider) ID() string {
+	return r.Config.Name
+}
+
+func (r *RedisQueueProvider) SetContext(ctx *contexts.ManagerContext) {
+	r.Context = ctx
+}
+
+func (i *RedisQueueProvider) InitWithMap(properties map[string]string) error {
+	config, err := RedisQueueProviderConfigFromMap(properties)
+	if err != nil {
+		return err
+	}
+	return i.Init(config)
+}
+
+func toRedisQueueProviderConfig(config providers.IProviderConfig) (RedisQueueProviderConfig, error) {
+	ret := RedisQueueProviderConfig{}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+func (r *RedisQueueProvider) Init(config providers.IProviderConfig) error {
+	vConfig, err := toRedisQueueProviderConfig(config)
+	if err != nil {
+		rLog.Debugf("  P (Redis Queue): failed to parse provider config %+v", err)
+		return v1alpha2.NewCOAError(nil, "provided config is not a valid redis queue provider config", v1alpha2.BadConfig)
+	}
+	if vConfig.Host == "" {
+		return v1alpha2.NewCOAError(nil, "Redis host is not supplied", v1alpha2.MissingConfig)
+	}
+	if vConfig.KeyPrefix == "" {
+		vConfig.KeyPrefix = defaultKeyPrefix
+	}
+	if vConfig.MaxDeliveries <= 0 {
+		vConfig.MaxDeliveries = queue.DefaultMaxDeliveries
+	}
+	r.Config = vConfig
+	r.Ctx, r.Cancel = context.WithCancel(context.Background())
+	options := &redis.Options{
+		Addr:            r.Config.Host,
+		Password:        r.Config.Password,
+		DB:              0,
+		MaxRetries:      3,
+		MaxRetryBackoff: time.Second * 2,
+	}
+	if r.Config.RequiresTLS {
+		options.TLSConfig = &tls.Config{
+			InsecureSkipVerify: !r.Config.RequiresTLS,
+		}
+	}
+	client := redis.NewClient(options)
+	if _, err := client.Ping(r.Ctx).Result(); err != nil {
+		rLog.Debugf("  P (Redis Queue): failed to connect to redis %+v", err)
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("redis queue: error connecting to redis at %s", r.Config.Host), v1alpha2.InternalError)
+	}
+	r.Client = client
+	rLog.Debug("  P (Redis Queue): Successfully launch redis queue provider")
+	return nil
+}
+
+// keys returns the redis keys of a queue. The queue name is wrapped in a hash tag, so all keys
+// of a queue map to the same slot and the scripts touching several of them work on Redis Cluster.
+func (r *RedisQueueProvider) keys(name string) []string {
+	prefix := fmt.Sprintf("%s:{%s}", r.Config.KeyPrefix, name)
+	return []string{
+		prefix + ":ready",
+		prefix + ":bodies",
+		prefix + ":deliveries",
+		prefix + ":inflight",
+		prefix + ":dlq",
+	}
+}
+
+func (r *RedisQueueProvider) Enqueue(name string, element interface{}) error {
+	body, err := json.Marshal(element)
+	if err != nil {
+		return v1alpha2.NewCOAError(err, "failed to serialize queue element", v1alpha2.SerializationError)
+	}
+	keys := r.keys(name)
+	id := uuid.New().String()
+	_, err = r.Client.TxPipelined(r.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(r.Ctx, keys[1], id, body)
+		pipe.RPush(r.Ctx, keys[0], id)
+		return nil
+	})
+	if err != nil {
+		rLog.Errorf("  P (Redis Queue): failed to enqueue to %s: %+v", name, err)
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to enqueue to queue %s", name), v1alpha2.InternalError)
+	}
+	return nil
+}
+
+// Dequeue removes the first element without acknowledgement. Elements are returned as
+// their JSON-decoded form, such as map[string]interface{} for structs.
+func (r *RedisQueueProvider) Dequeue(name string) (interface{}, error) {
+	body, err := dequeueScript.Run(r.Ctx, r.Client, r.keys(name)).Text()
+	if err == redis.Nil {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("queue %s is empty", name), v1alpha2.NotFound)
+	}
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to dequeue from queue %s", name), v1alpha2.InternalError)
+	}
+	return decode(body)
+}
+
+func (r *RedisQueueProvider) Peek(name string) (interface{}, error) {
+	keys := r.keys(name)
+	id, err := r.Client.LIndex(r.Ctx, keys[0], 0).Result()
+	if err == redis.Nil {
+		return nil, v1alpha2.NewCOAError(nil, fmt.Sprintf("queue %s is empty", name), v1alpha2.NotFound)
+	}
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to peek queue %s", name), v1alpha2.InternalError)
+	}
+	body, err := r.Client.HGet(r.Ctx, keys[1], id).Result()
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to peek queue %s", name), v1alpha2.InternalError)
+	}
+	return decode(body)
+}
+
+func (r *RedisQueueProvider) Size(name string) int {
+	size, err := r.Client.LLen(r.Ctx, r.keys(name)[0]).Result()
+	if err != nil {
+		rLog.Errorf("  P (Redis Queue): failed to get size of %s: %+v", name, err)
+		return 0
+	}
+	return int(size)
+}
+
+func (r *RedisQueueProvider) Receive(name string, count int, visibilityTimeout time.Duration) ([]queue.QueueMessage, error) {
+	now := time.Now()
+	result, err := receiveScript.Run(r.Ctx, r.Client, r.keys(name),
+		now.UnixMilli(),
+		now.Add(visibilityTimeout).UnixMilli(),
+		count,
+		r.Config.MaxDeliveries).Slice()
+	if err != nil && err != redis.Nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to receive from queue %s", name), v1alpha2.InternalError)
+	}
+	ret := make([]queue.QueueMessage, 0, len(result)/3)
+	for i := 0; i+2 < len(result); i += 3 {
+		body, err := decode(fmt.Sprint(result[i+1]))
+		if err != nil {
+			return nil, err
+		}
+		deliveries, _ := result[i+2].(int64)
+		ret = append(ret, queue.QueueMessage{
+			ID:         fmt.Sprint(result[i]),
+			Body:       body,
+			Deliveries: int(deliveries),
+		})
+	}
+	return ret, nil
+}
+
+func (r *RedisQueueProvider) Ack(name string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := r.keys(name)
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	_, err := r.Client.TxPipelined(r.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(r.Ctx, keys[3], members...)
+		pipe.HDel(r.Ctx, keys[1], ids...)
+		pipe.HDel(r.Ctx, keys[2], ids...)
+		return nil
+	})
+	if err != nil {
+		return v1alpha2.NewCOAError(err, fmt.Sprintf("failed to acknowledge messages of queue %s", name), v1alpha2.InternalError)
+	}
+	return nil
+}
+
+func (r *RedisQueueProvider) InFlight(name string) int {
+	size, err := r.Client.ZCard(r.Ctx, r.keys(name)[3]).Result()
+	if err != nil {
+		rLog.Errorf("  P (Redis Queue): failed to get in-flight count of %s: %+v", name, err)
+		return 0
+	}
+	return int(size)
+}
+
+// InFlightMessages lists the leased messages of a queue, in the order their leases expire
+func (r *RedisQueueProvider) InFlightMessages(name string) ([]queue.QueueMessage, error) {
+	keys := r.keys(name)
+	ids, err := r.Client.ZRange(r.Ctx, keys[3], 0, -1).Result()
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to list in-flight messages of queue %s", name), v1alpha2.InternalError)
+	}
+	ret, err := r.readMessages(keys, ids)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to list in-flight messages of queue %s", name), v1alpha2.InternalError)
+	}
+	return ret, nil
+}
+
+func (r *RedisQueueProvider) DeadLetters(name string) ([]queue.QueueMessage, error) {
+	keys := r.keys(name)
+	ids, err := r.Client.LRange(r.Ctx, keys[4], 0, -1).Result()
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to list dead letters of queue %s", name), v1alpha2.InternalError)
+	}
+	ret, err := r.readMessages(keys, ids)
+	if err != nil {
+		return nil, v1alpha2.NewCOAError(err, fmt.Sprintf("failed to list dead letters of queue %s", name), v1alpha2.InternalError)
+	}
+	return ret, nil
+}
+
+// readMessages reads the bodies and delivery counts of messages. Messages that have been
+// acknowledged in the meantime are skipped.
+func (r *RedisQueueProvider) readMessages(keys []string, ids []string) ([]queue.QueueMessage, error) {
+	ret := make([]queue.QueueMessage, 0, len(ids))
+	if len(ids) == 0 {
+		return ret, nil
+	}
+	bodies, err := r.Client.HMGet(r.Ctx, keys[1], ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := r.Client.HMGet(r.Ctx, keys[2], ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if bodies[i] == nil {
+			continue
+		}
+		body, err := decode(fmt.Sprint(bodies[i]))
+		if err != nil {
+			return nil, err
+		}
+		count, _ := strconv.Atoi(fmt.Sprint(deliveries[i]))
+		ret = append(ret, queue.QueueMessage{
+			ID:         id,
+			Body:       body,
+			Deliveries: count,
+		})
+	}
+	return ret, nil
+}
+
+func decode(body string) (interface{}, error) {
+	var ret interface{}
+	if err := json.Unmarshal([]byte(body), &ret); err != nil {
+		return nil, v1alpha2.NewCOAError(err, "failed to deserialize queue element", v1alpha2.DeserializeError)
+	}
+	return ret, nil
+}
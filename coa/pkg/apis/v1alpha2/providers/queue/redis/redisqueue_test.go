@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package redisqueue
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse-symphony/symphony/coa/pkg/apis/v1alpha2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestPayload struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func TestWithEmptyConfig(t *testing.T) {
+	provider := RedisQueueProvider{}
+	err := provider.Init(RedisQueueProviderConfig{})
+	assert.NotNil(t, err)
+	coaErr, ok := err.(v1alpha2.COAError)
+	assert.True(t, ok)
+	assert.Equal(t, v1alpha2.MissingConfig, coaErr.State)
+}
+
+func TestConfigFromMap(t *testing.T) {
+	config, err := RedisQueueProviderConfigFromMap(map[string]string{
+		"name":          "test",
+		"host":          "localhost:6379",
+		"requiresTLS":   "true",
+		"keyPrefix":     "test-queue",
+		"maxDeliveries": "3",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:6379", config.Host)
+	assert.True(t, config.RequiresTLS)
+	assert.Equal(t, "test-queue", config.KeyPrefix)
+	assert.Equal(t, 3, config.MaxDeliveries)
+
+	_, err = RedisQueueProviderConfigFromMap(map[string]string{
+		"name": "test",
+	})
+	assert.NotNil(t, err)
+	_, err = RedisQueueProviderConfigFromMap(map[string]string{
+		"host":          "localhost:6379",
+		"maxDeliveries": "many",
+	})
+	assert.NotNil(t, err)
+}
+
+func TestKeysShareHashTag(t *testing.T) {
+	provider := RedisQueueProvider{
+		Config: RedisQueueProviderConfig{
+			KeyPrefix: "test-queue",
+		},
+	}
+	keys := provider.keys("queue1")
+	assert.Equal(t, 5, len(keys))
+	for _, key := range keys {
+		assert.True(t, strings.HasPrefix(key, "test-queue:{queue1}:"), key)
+	}
+}
+
+func initializeProvider(t *testing.T) RedisQueueProvider {
+	testRedis := os.Getenv("TEST_REDIS")
+	if testRedis == "" {
+		t.Skip("Skipping because TEST_REDIS enviornment variable is not set")
+	}
+	provider := RedisQueueProvider{}
+	err := provider.Init(RedisQueueProviderConfig{
+		Name:          "test",
+		Host:          "localhost:6379",
+		KeyPrefix:     "test-" + uuid.New().String(),
+		MaxDeliveries: 2,
+	})
+	assert.Nil(t, err)
+	return provider
+}
+
+func TestEnqueueDequeue(t *testing.T) {
+	provider := initializeProvider(t)
+	err := provider.Enqueue("queue1", "a")
+	assert.Nil(t, err)
+	err = provider.Enqueue("queue1", TestPayload{Name: "b", Value: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, provider.Size("queue1"))
+	element, err := provider.Peek("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", element)
+	element, err = provider.Dequeue("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", element)
+	element, err = provider.Dequeue("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "b", "value": float64(1)}, element)
+	_, err = provider.Dequeue("queue1")
+	assert.NotNil(t, err)
+}
+
+func TestReceiveAckAndDeadLetter(t *testing.T) {
+	provider := initializeProvider(t)
+	provider.Enqueue("queue1", "a")
+	provider.Enqueue("queue1", "b")
+	messages, err := provider.Receive("queue1", 1, 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, "a", messages[0].Body)
+	assert.Equal(t, 1, provider.InFlight("queue1"))
+	inFlight, err := provider.InFlightMessages("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(inFlight))
+	assert.Equal(t, messages[0].ID, inFlight[0].ID)
+	assert.Equal(t, "a", inFlight[0].Body)
+
+	// "a" isn't acknowledged, so it's delivered again
+	time.Sleep(100 * time.Millisecond)
+	messages, err = provider.Receive("queue1", 2, 50*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "a", messages[0].Body)
+	assert.Equal(t, 2, messages[0].Deliveries)
+	assert.Equal(t, "b", messages[1].Body)
+	err = provider.Ack("queue1", []string{messages[1].ID})
+	assert.Nil(t, err)
+
+	// "a" reached the maximum deliveries
+	time.Sleep(100 * time.Millisecond)
+	messages, err = provider.Receive("queue1", 2, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(messages))
+	deadLetters, err := provider.DeadLetters("queue1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deadLetters))
+	assert.Equal(t, "a", deadLetters[0].Body)
+	assert.Equal(t, 2, deadLetters[0].Deliveries)
+	assert.Equal(t, 0, provider.InFlight("queue1"))
+}
@@ -122,6 +122,13 @@ func ListObjectStateWithLabels(ctx context.Context, stateProvider IStateProvider
 	return objectStateList, nil
 }
 
+// ObjectLister returns a function that lists all objects of a resource type from a state provider
+func ObjectLister(stateProvider IStateProvider) validation.ObjectListFunc {
+	return func(ctx context.Context, resourceType validation.ResourceType, namespace string) ([]interface{}, error) {
+		return ListObjectStateWithLabels(ctx, stateProvider, resourceType, namespace, nil, 0)
+	}
+}
+
 func GetObjectStateWithUniqueName(ctx context.Context, stateProvider IStateProvider, resourceType validation.ResourceType, displayName string, namespace string) (interface{}, error) {
 	objectList, err := ListObjectStateWithLabels(ctx, stateProvider, resourceType, namespace, map[string]string{constants.DisplayName: utils.ConvertStringToValidLabel(displayName)}, 1)
 	if err != nil {
@@ -382,6 +382,39 @@ func (s State) String() string {
 	}
 }
 
+const (
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of "<timestamp>.<body>" of a webhook, as "sha256=<hex>"
+	WebhookSignatureHeader = "X-Symphony-Signature"
+	// WebhookTimestampHeader carries the Unix time in seconds a webhook signature was created at
+	WebhookTimestampHeader = "X-Symphony-Timestamp"
+	// WebhookTokenHeader carries the plain shared secret of a webhook
+	WebhookTokenHeader = "X-Symphony-Token"
+)
+
+// WebhookHeaders are the request headers propagated to COA request metadata for webhook authentication
+var WebhookHeaders = []string{WebhookSignatureHeader, WebhookTimestampHeader, WebhookTokenHeader}
+
+const (
+	// SiteIdHeader carries the id of the site that signed a federation request
+	SiteIdHeader = "X-Symphony-Site"
+	// SiteTimestampHeader carries the time a federation request was signed, as RFC 3339
+	SiteTimestampHeader = "X-Symphony-Site-Timestamp"
+	// SiteNonceHeader carries a random value that makes each signed federation request unique
+	SiteNonceHeader = "X-Symphony-Site-Nonce"
+	// SiteSignatureHeader carries the base64 signature of a federation request by the site's key
+	SiteSignatureHeader = "X-Symphony-Site-Signature"
+)
+
+// SiteAuthHeaders are the request headers propagated to COA request metadata for site authentication
+var SiteAuthHeaders = []string{SiteIdHeader, SiteTimestampHeader, SiteNonceHeader, SiteSignatureHeader}
+
+// AuthenticatedUser is the COA request metadata key of the user authenticated by the JWT middleware
+const AuthenticatedUser = "__authenticatedUser"
+
+// AuthenticationSkipped is the COA request metadata key that is set to "true" when the JWT middleware
+// let a request through without a token because its path is ignored
+const AuthenticationSkipped = "__authenticationSkipped"
+
 const (
 	COAMetaHeader            = "COA_META_HEADER"
 	TracingExporterConsole   = "tracing.exporters.console"
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package v1
+
+import (
+	k8smodel "gopls-workspace/apis/model/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatalogRevisionSpec is a change of a catalog version, recorded in its history. The head
+// revision of a catalog version only keeps the number of its latest revision.
+type CatalogRevisionSpec struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Revision numbers the changes of a catalog version, from 1
+	Revision   int64  `json:"revision"`
+	Generation int64  `json:"generation,omitempty"`
+	Action     string `json:"action,omitempty"`
+	Author     string `json:"author,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	// RestoredFrom is the revision a restore brought back
+	RestoredFrom int64 `json:"restoredFrom,omitempty"`
+	// Spec is the spec after the change, or before a deletion
+	Spec *k8smodel.CatalogVersionSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// CatalogRevision is the Schema for the catalogrevisions API
+type CatalogRevision struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CatalogRevisionSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// CatalogRevisionList contains a list of CatalogRevision
+type CatalogRevisionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatalogRevision `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CatalogRevision{}, &CatalogRevisionList{})
+}
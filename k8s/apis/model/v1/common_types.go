@@ -390,8 +390,9 @@ type TaskSpec struct {
 	Config runtime.RawExtension `json:"config,omitempty"`
 	// +kubebuilder:pruning:PreserveUnknownFields
 	// +kubebuilder:validation:Schemaless
-	Inputs runtime.RawExtension `json:"inputs,omitempty"`
-	Target string               `json:"target,omitempty"`
+	Inputs  runtime.RawExtension `json:"inputs,omitempty"`
+	Target  string               `json:"target,omitempty"`
+	Timeout string               `json:"timeout,omitempty"`
 }
 
 // +kubebuilder:object:generate=true
@@ -412,6 +413,8 @@ type StageSpec struct {
 	Target          string               `json:"target,omitempty"`
 	Tasks           []TaskSpec           `json:"tasks,omitempty"`
 	TaskOption      model.TaskOption     `json:"taskOption,omitempty"`
+	Timeout         string               `json:"timeout,omitempty"`
+	Compensation    string               `json:"compensation,omitempty"`
 }
 
 // UnmarshalJSON customizes the JSON unmarshalling for StageSpec
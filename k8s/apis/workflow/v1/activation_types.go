@@ -35,6 +35,8 @@ type StageStatus struct {
 	StatusMessage string               `json:"statusMessage,omitempty"`
 	ErrorMessage  string               `json:"errorMessage,omitempty"`
 	IsActive      bool                 `json:"isActive,omitempty"`
+	// CompensatedStage is set when this entry records a compensation run
+	CompensatedStage string `json:"compensatedStage,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) Microsoft Corporation.
+ * Licensed under the MIT license.
+ * SPDX-License-Identifier: MIT
+ */
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type TriggerSourceSpec struct {
+	// +kubebuilder:validation:Enum=topic;webhook;object
+	Type string `json:"type"`
+	// Topic is the pubsub topic to listen on (topic sources)
+	Topic string `json:"topic,omitempty"`
+	// Secret is the shared secret signed webhook deliveries are checked with (webhook sources)
+	Secret string `json:"secret,omitempty"`
+	// ObjectType is the type of object changes to listen on: catalogversion or instance (object sources)
+	ObjectType string `json:"objectType,omitempty"`
+	// CatalogType narrows catalogversion changes to the given catalog type
+	CatalogType string `json:"catalogType,omitempty"`
+}
+
+type TriggerDeduplicationSpec struct {
+	// Key is an expression evaluated against the event payload. Events yielding
+	// a key that already fired within Window are dropped
+	Key string `json:"key"`
+	// Window is the de-duplication window in duration format, defaults to 1h
+	Window string `json:"window,omitempty"`
+}
+
+// ActivationTriggerSpec starts an activation of a campaign version when an event matches
+type ActivationTriggerSpec struct {
+	CampaignVersion string            `json:"campaignversion"`
+	Stage           string            `json:"stage,omitempty"`
+	Source          TriggerSourceSpec `json:"source"`
+	// Filter is an expression evaluated against the event payload; the trigger
+	// only fires when it evaluates to true
+	Filter string `json:"filter,omitempty"`
+	// Inputs maps the event payload to activation inputs using expressions
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Inputs        runtime.RawExtension      `json:"inputs,omitempty"`
+	Deduplication *TriggerDeduplicationSpec `json:"deduplication,omitempty"`
+	Disabled      bool                      `json:"disabled,omitempty"`
+}
+
+type ActivationTriggerStatus struct {
+	FireCount      int    `json:"fireCount,omitempty"`
+	LastFired      string `json:"lastFired,omitempty"`
+	LastActivation string `json:"lastActivation,omitempty"`
+	LastError      string `json:"lastError,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.source.type`
+// +kubebuilder:printcolumn:name="CampaignVersion",type=string,JSONPath=`.spec.campaignversion`
+// +kubebuilder:printcolumn:name="Fired",type=integer,JSONPath=`.status.fireCount`
+// ActivationTrigger is the Schema for the activationtriggers API
+type ActivationTrigger struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ActivationTriggerSpec   `json:"spec,omitempty"`
+	Status ActivationTriggerStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// ActivationTriggerList contains a list of ActivationTrigger
+type ActivationTriggerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ActivationTrigger `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ActivationTrigger{}, &ActivationTriggerList{})
+}
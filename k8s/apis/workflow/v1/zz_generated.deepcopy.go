@@ -95,6 +95,102 @@ func (in *ActivationStatus) DeepCopy() *ActivationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivationTrigger) DeepCopyInto(out *ActivationTrigger) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivationTrigger.
+func (in *ActivationTrigger) DeepCopy() *ActivationTrigger {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivationTrigger)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ActivationTrigger) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivationTriggerList) DeepCopyInto(out *ActivationTriggerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ActivationTrigger, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivationTriggerList.
+func (in *ActivationTriggerList) DeepCopy() *ActivationTriggerList {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivationTriggerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ActivationTriggerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivationTriggerSpec) DeepCopyInto(out *ActivationTriggerSpec) {
+	*out = *in
+	out.Source = in.Source
+	in.Inputs.DeepCopyInto(&out.Inputs)
+	if in.Deduplication != nil {
+		in, out := &in.Deduplication, &out.Deduplication
+		*out = new(TriggerDeduplicationSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivationTriggerSpec.
+func (in *ActivationTriggerSpec) DeepCopy() *ActivationTriggerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivationTriggerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivationTriggerStatus) DeepCopyInto(out *ActivationTriggerStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivationTriggerStatus.
+func (in *ActivationTriggerStatus) DeepCopy() *ActivationTriggerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivationTriggerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CampaignVersion) DeepCopyInto(out *CampaignVersion) {
 	*out = *in
@@ -243,3 +339,33 @@ func (in *StageStatus) DeepCopy() *StageStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TriggerDeduplicationSpec) DeepCopyInto(out *TriggerDeduplicationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TriggerDeduplicationSpec.
+func (in *TriggerDeduplicationSpec) DeepCopy() *TriggerDeduplicationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TriggerDeduplicationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TriggerSourceSpec) DeepCopyInto(out *TriggerSourceSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TriggerSourceSpec.
+func (in *TriggerSourceSpec) DeepCopy() *TriggerSourceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TriggerSourceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -38,6 +38,7 @@ type CatalogVersionReconciler struct {
 //+kubebuilder:rbac:groups=federation.symphony,resources=catalogversions,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=federation.symphony,resources=catalogversions/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=federation.symphony,resources=catalogversions/finalizers,verbs=update
+//+kubebuilder:rbac:groups=federation.symphony,resources=catalogrevisions,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
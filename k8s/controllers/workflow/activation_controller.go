@@ -40,6 +40,7 @@ type ActivationReconciler struct {
 //+kubebuilder:rbac:groups=workflow.symphony,resources=activations,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=workflow.symphony,resources=activations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=workflow.symphony,resources=activations/finalizers,verbs=update
+//+kubebuilder:rbac:groups=workflow.symphony,resources=activationtriggers,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.